@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/admin"
+	"github.com/e2u/dynamic-proxy/internal/buildinfo"
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/internal/eventlog"
+	"github.com/e2u/dynamic-proxy/internal/logging"
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+	"github.com/e2u/dynamic-proxy/internal/state"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+	"github.com/e2u/dynamic-proxy/pkg/rotator"
+)
+
+// registerAdminRoutes 註冊管理 API 路由
+func registerAdminRoutes(srv *admin.Server, ps *rotator.ProxyServer, cfg *config.Config) {
+	// GET /healthz 數據庫狀態與可用代理數（容器健康檢查）
+	srv.HandleFunc("GET /healthz", handleHealthz)
+
+	// GET /livez 存活探針，GET /readyz 就緒探針（可用代理數達到 admin.ready_min_healthy）
+	srv.HandleFunc("GET /livez", handleLivez)
+	srv.HandleFunc("GET /readyz", handleReadyz)
+
+	// GET /metrics Prometheus 文本格式指標
+	srv.Handle("GET /metrics", metrics.Default.Handler())
+
+	// GET /api/version 構建版本信息
+	srv.HandleFunc("GET /api/version", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, buildinfo.Get())
+	})
+
+	// GET /api/state 供部署工具斷言的運行狀態（結構見 /api/state/schema）
+	srv.HandleFunc("GET /api/state", func(w http.ResponseWriter, r *http.Request) {
+		doc, err := buildState(cfg)
+		if err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, doc)
+	})
+
+	// GET /api/state/schema 狀態文檔的 JSON Schema
+	srv.HandleFunc("GET /api/state/schema", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(state.Schema)
+	})
+
+	// GET /api/log/levels 當前全局與各組件日誌級別
+	srv.HandleFunc("GET /api/log/levels", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, logging.CurrentLevels())
+	})
+
+	// PUT /api/log/levels {"level":"info","components":{"validator":"error","gather":""}}
+	// 只修改請求中給出的項，組件級別為空字符串表示刪除覆蓋
+	srv.HandleProtected("PUT /api/log/levels", func(w http.ResponseWriter, r *http.Request) {
+		var req logging.Levels
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		if err := setLogLevels(req); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.WithField("levels", req).Info("log levels changed")
+		admin.WriteJSON(w, http.StatusOK, logging.CurrentLevels())
+	})
+
+	// POST /api/config/reload 重新加載配置文件（同 SIGHUP），校驗失敗時返回 400 並保留原配置
+	srv.HandleProtected("POST /api/config/reload", func(w http.ResponseWriter, r *http.Request) {
+		cfg, err := reloader.Reload()
+		if err != nil {
+			admin.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, map[string]string{"config_hash": cfg.Hash()})
+	})
+
+	// GET /api/proxies 所有代理記錄及其使用次數與健康度
+	srv.HandleFunc("GET /api/proxies", func(w http.ResponseWriter, r *http.Request) {
+		ps, err := listProxiesWithUsage()
+		if err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, ps)
+	})
+
+	// GET /api/proxies/{key}/usage 單個代理（ip:port）的使用次數與健康度
+	srv.HandleFunc("GET /api/proxies/{key}/usage", func(w http.ResponseWriter, r *http.Request) {
+		u, err := proxyStore.Usage(r.PathValue("key"))
+		if err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, u)
+	})
+
+	// PUT /api/proxies/{key}/tags {"tags":["residential","paid"]} 替換代理（ip:port）的標籤
+	srv.HandleProtected("PUT /api/proxies/{key}/tags", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		p, err := proxyStore.SetTags(r.PathValue("key"), req.Tags)
+		if errors.Is(err, pool.ErrProxyNotFound) {
+			admin.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		log.WithFields(logger.Fields{"proxy": p.Key(), "tags": p.Tags}).Info("proxy tags changed")
+		admin.WriteJSON(w, http.StatusOK, p)
+	})
+
+	// PUT /api/proxies/{key}/disabled {"disabled":true} 手動禁用或啟用代理（ip:port）
+	srv.HandleProtected("PUT /api/proxies/{key}/disabled", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Disabled *bool `json:"disabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		if req.Disabled == nil {
+			admin.WriteError(w, http.StatusBadRequest, errors.New("missing field: disabled"))
+			return
+		}
+		p, err := proxyStore.SetDisabled(r.PathValue("key"), *req.Disabled)
+		if errors.Is(err, pool.ErrProxyNotFound) {
+			admin.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		log.WithFields(logger.Fields{"proxy": p.Key(), "disabled": p.Disable}).Info("proxy disabled state changed manually")
+		admin.WriteJSON(w, http.StatusOK, p)
+	})
+
+	// POST /validate {"proxies":["1.2.3.4:8080"]} 驗證任意代理，返回協議、延遲、匿名級別和出口地址
+	srv.HandleProtected("POST /validate", handleValidate)
+
+	// GET /api/pool/history?since=24h&format=csv 代理池統計快照
+	srv.HandleFunc("GET /api/pool/history", handleHistory)
+
+	// GET /api/events?type=proxy_disabled,proxy_deleted&proxy=ip:port&since=1h&limit=100 事件記錄，最新的在前
+	srv.HandleFunc("GET /api/events", func(w http.ResponseWriter, r *http.Request) {
+		q := eventlog.Query{Proxy: r.URL.Query().Get("proxy"), Limit: admin.QueryInt(r, "limit", 100)}
+		if v := r.URL.Query().Get("type"); v != "" {
+			q.Types = strings.Split(v, ",")
+		}
+		if v := r.URL.Query().Get("since"); v != "" {
+			since, err := parseTimeParam(v, time.Now())
+			if err != nil {
+				admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("since: %w", err))
+				return
+			}
+			q.Since = since
+		}
+		list, err := events.List(q)
+		if err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if list == nil {
+			list = []eventlog.Event{}
+		}
+		admin.WriteJSON(w, http.StatusOK, list)
+	})
+
+	registerClusterRoutes(srv)
+
+	// GET /api/feed?type=proxy_validated,proxy_disabled 以 Server-Sent Events 實時推送代理池變化
+	srv.HandleFunc("GET /api/feed", handleFeed)
+
+	// GET /api/sources 按來源的採集、驗證統計與評分
+	srv.HandleFunc("GET /api/sources", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, sourceStats.Reports())
+	})
+
+	// GET /api/lifetime 代理存活時間中位數與存活曲線（全池及按來源）
+	srv.HandleFunc("GET /api/lifetime", func(w http.ResponseWriter, r *http.Request) {
+		report, err := collectLifetime()
+		if err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, report)
+	})
+
+	// GET /api/domains?burned=true 按（代理，目標域名）記錄的近期結果，burned 為 true 時只返回被封禁的
+	srv.HandleFunc("GET /api/domains", func(w http.ResponseWriter, r *http.Request) {
+		burned, _ := strconv.ParseBool(r.URL.Query().Get("burned"))
+		admin.WriteJSON(w, http.StatusOK, ps.DomainRecords(burned))
+	})
+
+	// GET /api/clients/top?n=10&by=requests|bytes|errors
+	srv.HandleFunc("GET /api/clients/top", func(w http.ResponseWriter, r *http.Request) {
+		n := admin.QueryInt(r, "n", 10)
+		by := r.URL.Query().Get("by")
+		if by == "" {
+			by = rotator.TopByRequests
+		}
+		admin.WriteJSON(w, http.StatusOK, ps.TopClients(n, by))
+	})
+
+	registerDashboardRoutes(srv, ps)
+}
+
+// setLogLevels 先校驗全部級別再應用，避免部分生效
+func setLogLevels(req logging.Levels) error {
+	if req.Level != "" {
+		if _, err := logger.ParseLevel(req.Level); err != nil {
+			return err
+		}
+	}
+	for name, lvl := range req.Components {
+		if lvl == "" {
+			continue
+		}
+		if _, err := logger.ParseLevel(lvl); err != nil {
+			return fmt.Errorf("component %s: %w", name, err)
+		}
+	}
+
+	if req.Level != "" {
+		if err := logging.SetLevel("", req.Level); err != nil {
+			return err
+		}
+	}
+	for name, lvl := range req.Components {
+		if err := logging.SetLevel(name, lvl); err != nil {
+			return fmt.Errorf("component %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/chat"
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/internal/extractor"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+const (
+	// metaChatCursors 頻道消息的讀取位置
+	metaChatCursors = "chat_cursors"
+	// chatFetchTimeout 一次拉取所有頻道的時限
+	chatFetchTimeout = 2 * time.Minute
+)
+
+// chatSources 按配置創建頻道消息來源，未設置 bot_token 的平台不拉取
+func chatSources(cfg config.ChatConfig) []chat.Source {
+	client := &http.Client{Timeout: 30 * time.Second}
+	var sources []chat.Source
+	if cfg.Telegram.BotToken != "" {
+		sources = append(sources, &chat.Telegram{
+			Token:    cfg.Telegram.BotToken,
+			Channels: cfg.Telegram.Channels,
+			APIURL:   cfg.Telegram.APIURL,
+			Client:   client,
+		})
+	}
+	if cfg.Discord.BotToken != "" {
+		sources = append(sources, &chat.Discord{
+			Token:    cfg.Discord.BotToken,
+			Channels: cfg.Discord.Channels,
+			APIURL:   cfg.Discord.APIURL,
+			Client:   client,
+		})
+	}
+	return sources
+}
+
+// ingestChat 拉取頻道的新消息，提取其中的代理寫入數據庫（新代理進入待驗證隊列）；
+// 代理的來源記為頻道標識（如 telegram:@freeproxies），計入來源統計
+func ingestChat(cfg config.ChatConfig) {
+	sources := chatSources(cfg)
+	if len(sources) == 0 {
+		return
+	}
+	cur := chat.Cursors{}
+	if _, err := pool.LoadMeta(bdb, metaChatCursors, &cur); err != nil {
+		gatherLog.Warnf("failed to load chat cursors: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), chatFetchTimeout)
+	defer cancel()
+	var msgs []chat.Message
+	for _, src := range sources {
+		got, err := src.Fetch(ctx, cur)
+		if err != nil {
+			gatherLog.WithError(err).Warn("failed to fetch chat messages")
+		}
+		msgs = append(msgs, got...)
+	}
+	// 讀取位置在消息中的代理寫入數據庫之後才保存，寫入失敗時下次重新拉取這些消息
+	saveCursors := func() {
+		if err := pool.SaveMeta(bdb, metaChatCursors, cur); err != nil {
+			gatherLog.Warnf("failed to save chat cursors: %v", err)
+		}
+	}
+	if len(msgs) == 0 {
+		saveCursors()
+		return
+	}
+
+	// 同一頻道的消息合併後一次提取
+	var channels []string
+	texts := make(map[string][]byte)
+	for _, m := range msgs {
+		if _, ok := texts[m.Channel]; !ok {
+			channels = append(channels, m.Channel)
+		}
+		texts[m.Channel] = append(append(texts[m.Channel], m.Text...), '\n')
+	}
+
+	proxiesChan := make(chan *pool.Proxy, 100)
+	done := make(chan struct{})
+	var added, updated int64
+	var storeErr error
+	go func() {
+		defer close(done)
+		added, updated, storeErr = storeCandidates(proxiesChan)
+	}()
+	for _, channel := range channels {
+		sourceStats.RecordGather(channel)
+		out, wait := tagSource(proxiesChan, config.SourceConfig{URL: channel, Tags: cfg.Tags})
+		count, err := extractor.Extract(out, texts[channel], channel, "text")
+		wait()
+		sourceStats.RecordExtracted(channel, count)
+		if err != nil {
+			gatherLog.WithField("channel", channel).WithError(err).Warn("failed to extract proxies from messages")
+		}
+	}
+	close(proxiesChan)
+	<-done
+	if storeErr != nil {
+		gatherLog.Warnf("chat cursors not advanced, messages will be fetched again: %v", storeErr)
+	} else {
+		saveCursors()
+	}
+
+	saveSourceStats()
+	gatherLog.Infof("Ingested %d chat messages, new: %d, updated: %d", len(msgs), added, updated)
+}
+
+// watchChat 立即並每隔 interval 拉取頻道消息（interval 為 0 時不拉取），返回停止拉取的函數；
+// 機器人與頻道取自當前生效的配置
+func watchChat(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ingestChat(reloader.Config().Chat)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ingestChat(reloader.Config().Chat)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/internal/chat"
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// telegramChannel 模擬 Bot API，返回一條包含代理地址的頻道消息
+func telegramChannel(t *testing.T) config.ChatConfig {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok":true,"result":[{"update_id":41,"channel_post":{"chat":{"id":-100,"username":"freeproxies"},"date":1700000000,"text":"10.1.2.3:8080"}}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	return config.ChatConfig{Telegram: config.ChatChannelConfig{BotToken: "token", Channels: []string{"@freeproxies"}, APIURL: srv.URL}}
+}
+
+func TestIngestChatSavesCursorsAfterStoring(t *testing.T) {
+	db := openTestDB(t)
+	prev := proxyStore
+	t.Cleanup(func() { proxyStore = prev })
+
+	// 寫入代理失敗時不保存讀取位置，下次重新拉取這些消息
+	closed, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	proxyStore = pool.New(closed)
+	cfg := telegramChannel(t)
+	ingestChat(cfg)
+	cur := chat.Cursors{}
+	if ok, err := pool.LoadMeta(db, metaChatCursors, &cur); err != nil || ok {
+		t.Fatalf("cursors saved after a failed store: %v (%v)", cur, err)
+	}
+
+	proxyStore = pool.New(db)
+	ingestChat(cfg)
+	if ok, err := pool.LoadMeta(db, metaChatCursors, &cur); err != nil || !ok || cur["telegram"] != "42" {
+		t.Errorf("cursors = %v (%v), want telegram at 42", cur, err)
+	}
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 1 || ps[0].Key() != "10.1.2.3:8080" || ps[0].Source != "telegram:@freeproxies" {
+		t.Errorf("stored proxies = %v, want 10.1.2.3:8080 from telegram:@freeproxies", ps)
+	}
+}
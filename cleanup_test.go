@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// seedStaleProxies 寫入 n 個超過 max_age 的代理，清理時全部刪除
+func seedStaleProxies(t *testing.T, db *badger.DB, n int) {
+	t.Helper()
+	records := make(map[string]any, n)
+	for i := range n {
+		p := validated(fmt.Sprintf("10.%d.%d.1", i/256, i%256), 48*time.Hour)
+		records[p.Key()] = p
+	}
+	seedProxies(t, db, records)
+}
+
+// useCleanupStore 以 onDelete 作為刪除鉤子替換全局的 proxyStore，並設置只保留 24 小時內驗證過的代理的清理策略
+func useCleanupStore(t *testing.T, db *badger.DB, onDelete func(key string)) {
+	t.Helper()
+	prevStore, prevPolicy := proxyStore, cleanupPolicy
+	proxyStore = pool.New(db, pool.WithHooks(pool.Hooks{
+		OnProxyDeleted: func(key string, _ *pool.Proxy) { onDelete(key) },
+	}))
+	cleanupPolicy = pool.CleanupPolicy{MaxAge: 24 * time.Hour}
+	t.Cleanup(func() { proxyStore, cleanupPolicy = prevStore, prevPolicy })
+}
+
+func TestCleanupProxiesFromDB(t *testing.T) {
+	db := openTestDB(t)
+	n := 2*cleanupBatchSize + 10
+	seedStaleProxies(t, db, n)
+	seedProxies(t, db, map[string]any{"10.255.0.1:80": validated("10.255.0.1", time.Hour)})
+
+	deleted := make(map[string]int)
+	useCleanupStore(t, db, func(key string) { deleted[key]++ })
+
+	count, err := cleanupProxiesFromDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != n || len(deleted) != n {
+		t.Errorf("deleted %d proxies with %d hook calls, want %d", count, len(deleted), n)
+	}
+	for key, calls := range deleted {
+		if calls != 1 {
+			t.Errorf("OnProxyDeleted called %d times for %s", calls, key)
+		}
+	}
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 1 || ps[0].Key() != "10.255.0.1:80" {
+		t.Errorf("remaining proxies = %v, want only 10.255.0.1:80", ps)
+	}
+}
+
+func TestCleanupProxiesFromDBPartialFailure(t *testing.T) {
+	db := openTestDB(t)
+	seedStaleProxies(t, db, cleanupBatchSize+10)
+
+	// 第一批刪除後關閉數據庫，第二批失敗
+	calls := 0
+	useCleanupStore(t, db, func(string) {
+		if calls++; calls == cleanupBatchSize {
+			db.Close()
+		}
+	})
+
+	count, err := cleanupProxiesFromDB()
+	if err == nil {
+		t.Fatal("cleanup should fail once the database is closed")
+	}
+	if count != cleanupBatchSize || calls != cleanupBatchSize {
+		t.Errorf("reported %d deleted with %d hook calls, want %d", count, calls, cleanupBatchSize)
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/admin"
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// clusterClient 從集群成員拉取驗證結果的 HTTP 客戶端
+var clusterClient = &http.Client{Timeout: time.Minute}
+
+// clusterToken 請求集群成員時發送的令牌（admin.token），啟動時設置
+var clusterToken string
+
+// newClusterRequest 創建發往集群成員的請求，設置了令牌時附帶 Authorization 頭
+func newClusterRequest(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if clusterToken != "" {
+		req.Header.Set("Authorization", "Bearer "+clusterToken)
+	}
+	return req, nil
+}
+
+const (
+	// leaseName 採集和健康檢查任務的租約
+	leaseName = "jobs"
+	// leaseRequestTimeout 向每個成員請求或釋放租約的超時，超時的成員視為不授予
+	leaseRequestTimeout = 5 * time.Second
+	// leaseMargin 本實例認為租約有效的時間比授予的 ttl 短此值，抵消成員間的時鐘頻率偏差和 Badger 按秒計算的過期時間
+	leaseMargin = 2 * time.Second
+)
+
+// leaseRetryDelay 未獲得租約時下次嘗試前的隨機等待（lease_ttl 的十二分之一到三分之一），
+// 同時啟動、各自先授予自己而都未得到多數的成員錯開重試，不會反復平票
+func leaseRetryDelay(ttl time.Duration) time.Duration {
+	return ttl/12 + mrand.N(ttl/4)
+}
+
+// clusterMember 集群成員的身份（GET /api/cluster/member）
+type clusterMember struct {
+	ID            string    `json:"id"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+	Leader        bool      `json:"leader"` // 是否持有採集和健康檢查任務的租約
+}
+
+// selfMember 本實例的身份，ID 由主機名、PID 和隨機後綴組成（容器中 PID 往往相同），同時作為租約的持有者名稱
+var selfMember = newClusterMember()
+
+func newClusterMember() clusterMember {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return clusterMember{ID: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix)), StartedAt: time.Now()}
+}
+
+// currentMember 帶當前運行時間和領導者狀態的本實例身份
+func currentMember() clusterMember {
+	m := selfMember
+	m.UptimeSeconds = time.Since(m.StartedAt).Seconds()
+	m.Leader = holdsLease()
+	return m
+}
+
+// lease 本實例持有的租約：until 之前為領導者（本地時鐘），零值表示未持有
+var lease struct {
+	sync.Mutex
+	until time.Time
+}
+
+// leaseAttempt 串行化獲得、續約和釋放租約，任務觸發的獲得與 watchLease 的續約不會交錯
+var leaseAttempt sync.Mutex
+
+// holdsLease 本實例是否持有未過期的租約
+func holdsLease() bool {
+	lease.Lock()
+	defer lease.Unlock()
+	return time.Now().Before(lease.until)
+}
+
+// leaseRequest POST /api/cluster/lease 的請求體
+type leaseRequest struct {
+	Holder     string  `json:"holder"`
+	TTLSeconds float64 `json:"ttl_seconds"`
+}
+
+// leaseResponse POST /api/cluster/lease 的響應
+type leaseResponse struct {
+	Granted bool   `json:"granted"`
+	Holder  string `json:"holder"` // 當前的持有者
+}
+
+// requestLease 請求成員 peer 把租約授予（或續約給）本實例
+func requestLease(ctx context.Context, peer string, ttl time.Duration) (leaseResponse, error) {
+	var res leaseResponse
+	body, _ := json.Marshal(leaseRequest{Holder: selfMember.ID, TTLSeconds: ttl.Seconds()})
+	req, err := newClusterRequest(ctx, http.MethodPost, strings.TrimRight(peer, "/")+"/api/cluster/lease", bytes.NewReader(body))
+	if err != nil {
+		return res, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := clusterClient.Do(req)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return res, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	return res, err
+}
+
+// acquireLease 向本地數據庫和各成員請求租約（已持有時即續約），返回本實例是否持有租約。
+// 包括本實例在內的多數成員授予時，租約有效至發出請求的時刻加上 lease_ttl 減去 leaseMargin：各成員的記錄在收到請求之後
+// 才開始計時，不會早於本實例認為的截止時間過期，因此同一時刻至多一個實例持有租約。
+// 未得到多數授予時保留此前尚未過期的租約，到期後不再是領導者；未持有租約時撤回本次得到的授予，
+// 平票時各成員不會一直為自己保留授予而使選舉停滯
+func acquireLease(cfg config.ClusterConfig) bool {
+	leaseAttempt.Lock()
+	defer leaseAttempt.Unlock()
+
+	start := time.Now()
+	var mu sync.Mutex
+	votes := 0
+	var granted []string // 授予了本實例的成員
+	localGrant, holder, err := pool.GrantLease(bdb, leaseName, selfMember.ID, cfg.LeaseTTL)
+	switch {
+	case err != nil:
+		clusterLog.Warnf("failed to grant cluster lease locally: %v", err)
+	case localGrant:
+		votes++
+	default:
+		clusterLog.Debugf("cluster lease held by %s locally", holder)
+	}
+	var wg sync.WaitGroup
+	for _, peer := range cfg.Peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), leaseRequestTimeout)
+			defer cancel()
+			res, err := requestLease(ctx, peer, cfg.LeaseTTL)
+			if err != nil {
+				clusterLog.Debugf("cluster member %s did not answer the lease request: %v", peer, err)
+				return
+			}
+			if !res.Granted {
+				clusterLog.Debugf("cluster member %s refused the lease, held by %s", peer, res.Holder)
+				return
+			}
+			mu.Lock()
+			votes++
+			granted = append(granted, peer)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	lease.Lock()
+	wasLeader := time.Now().Before(lease.until)
+	if votes > (len(cfg.Peers)+1)/2 {
+		lease.until = start.Add(cfg.LeaseTTL - leaseMargin)
+	}
+	isLeader := time.Now().Before(lease.until)
+	lease.Unlock()
+	switch {
+	case isLeader && !wasLeader:
+		clusterLog.Infof("Acquired the cluster lease (%d of %d members), running gather and health jobs", votes, len(cfg.Peers)+1)
+	case !isLeader && wasLeader:
+		clusterLog.Warnf("Lost the cluster lease (%d of %d members granted)", votes, len(cfg.Peers)+1)
+	}
+	if !isLeader && votes > 0 {
+		clusterLog.Debugf("No majority for the cluster lease (%d of %d members), withdrawing the grants", votes, len(cfg.Peers)+1)
+		if localGrant {
+			releaseLocalLease()
+		}
+		releasePeerLeases(granted)
+	}
+	return isLeader
+}
+
+// releaseLocalLease 刪除本地數據庫中授予本實例的租約
+func releaseLocalLease() {
+	if _, err := pool.ReleaseLease(bdb, leaseName, selfMember.ID); err != nil {
+		clusterLog.Warnf("failed to release cluster lease locally: %v", err)
+	}
+}
+
+// releasePeerLeases 請求成員刪除授予本實例的租約
+func releasePeerLeases(peers []string) {
+	for _, peer := range peers {
+		ctx, cancel := context.WithTimeout(context.Background(), leaseRequestTimeout)
+		u := strings.TrimRight(peer, "/") + "/api/cluster/lease?holder=" + url.QueryEscape(selfMember.ID)
+		req, err := newClusterRequest(ctx, http.MethodDelete, u, nil)
+		if err == nil {
+			var resp *http.Response
+			if resp, err = clusterClient.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+		cancel()
+		if err != nil {
+			clusterLog.Debugf("failed to release cluster lease at %s: %v", peer, err)
+		}
+	}
+}
+
+// releaseLease 停止時釋放本實例持有的租約（本地及各成員），其他成員無需等待過期即可接替
+func releaseLease(cfg config.ClusterConfig) {
+	leaseAttempt.Lock()
+	defer leaseAttempt.Unlock()
+
+	lease.Lock()
+	held := time.Now().Before(lease.until)
+	lease.until = time.Time{}
+	lease.Unlock()
+	if !held {
+		return
+	}
+	releaseLocalLease()
+	releasePeerLeases(cfg.Peers)
+	clusterLog.Info("Released the cluster lease")
+}
+
+// handleLeaseGrant POST /api/cluster/lease：把租約授予請求的成員，租約由其他成員持有且未過期時不授予
+func handleLeaseGrant(w http.ResponseWriter, r *http.Request) {
+	var req leaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.Holder == "" || req.TTLSeconds <= 0 {
+		admin.WriteError(w, http.StatusBadRequest, errors.New("holder and a positive ttl_seconds are required"))
+		return
+	}
+	granted, holder, err := pool.GrantLease(bdb, leaseName, req.Holder, time.Duration(req.TTLSeconds*float64(time.Second)))
+	if err != nil {
+		admin.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	admin.WriteJSON(w, http.StatusOK, leaseResponse{Granted: granted, Holder: holder})
+}
+
+// handleLeaseRelease DELETE /api/cluster/lease?holder=：持有者釋放租約
+func handleLeaseRelease(w http.ResponseWriter, r *http.Request) {
+	holder := r.URL.Query().Get("holder")
+	if holder == "" {
+		admin.WriteError(w, http.StatusBadRequest, errors.New("missing holder"))
+		return
+	}
+	released, err := pool.ReleaseLease(bdb, leaseName, holder)
+	if err != nil {
+		admin.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	admin.WriteJSON(w, http.StatusOK, map[string]bool{"released": released})
+}
+
+// leaderOnly 啟用領導者選舉時包裝任務 name：只在本實例持有租約時運行（未持有時先嘗試獲得），否則跳過本次運行
+func leaderOnly(cfg config.ClusterConfig, name string, run func()) func() {
+	if !cfg.LeaderElection || len(cfg.Peers) == 0 {
+		return run
+	}
+	return func() {
+		if !holdsLease() && !acquireLease(cfg) {
+			clusterLog.Infof("Skipping %s job: another member holds the cluster lease or no majority is reachable", name)
+			return
+		}
+		run()
+	}
+}
+
+// registerClusterRoutes 註冊集群成員之間使用的接口（交換驗證結果與領導者選舉）
+func registerClusterRoutes(srv *admin.Server) {
+	// GET /api/cluster/proxies?since=2024-01-01T00:00:00Z 健康評分在 since 之後更新的代理記錄，集群成員據此交換驗證結果
+	srv.HandleProtected("GET /api/cluster/proxies", func(w http.ResponseWriter, r *http.Request) {
+		var since time.Time
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			if since, err = parseTimeParam(v, time.Now()); err != nil {
+				admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("since: %w", err))
+				return
+			}
+		}
+		ps, err := validatedSince(since)
+		if err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, ps)
+	})
+
+	// GET /api/cluster/member 本實例在集群中的身份、運行時間及是否為領導者
+	srv.HandleProtected("GET /api/cluster/member", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, currentMember())
+	})
+
+	// POST /api/cluster/lease {"holder":"id","ttl_seconds":60} 領導者選舉：授予或續約採集和健康檢查任務的租約
+	srv.HandleProtected("POST /api/cluster/lease", handleLeaseGrant)
+
+	// DELETE /api/cluster/lease?holder=id 持有者停止時釋放租約
+	srv.HandleProtected("DELETE /api/cluster/lease", handleLeaseRelease)
+}
+
+// startClusterAPI 定時任務模式下在 admin.listen 上只提供集群接口，成員據此拉取本實例的驗證結果、請求租約；
+// 未配置成員或管理 API 時不啟動。返回停止服務的函數
+func startClusterAPI(cfg *config.Config) (func(), error) {
+	if len(cfg.Cluster.Peers) == 0 || cfg.Admin.Listen == "" {
+		return func() {}, nil
+	}
+	svcTLS, err := newServiceTLS(cfg)
+	if err != nil {
+		return nil, err
+	}
+	srv := admin.New(cfg.Admin.Listen)
+	srv.TLSConfig = svcTLS.admin
+	srv.Token = cfg.Admin.Token
+	srv.HandleFunc("GET /healthz", handleHealthz)
+	registerClusterRoutes(srv)
+	if err := srv.Start(); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := srv.Stop(); err != nil {
+			clusterLog.Warnf("failed to stop cluster API: %v", err)
+		}
+	}, nil
+}
+
+// validatedSince 健康評分在 since 之後更新（驗證過）的代理記錄，包括從其他成員合併來的
+func validatedSince(since time.Time) ([]*pool.Proxy, error) {
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*pool.Proxy, 0)
+	for _, p := range ps {
+		if p.ScoredAt.After(since) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// pullFromPeer 拉取成員 peer 在 since 之後驗證的代理並合併到本地代理池，
+// 返回收到的記錄中最新的評分時間（成員自己的時鐘，作為下次拉取的起點；沒有記錄時為 since）
+func pullFromPeer(peer string, since time.Time) (time.Time, error) {
+	u := strings.TrimRight(peer, "/") + "/api/cluster/proxies"
+	if !since.IsZero() {
+		u += "?since=" + url.QueryEscape(since.Format(time.RFC3339Nano))
+	}
+	req, err := newClusterRequest(context.Background(), http.MethodGet, u, nil)
+	if err != nil {
+		return since, err
+	}
+	resp, err := clusterClient.Do(req)
+	if err != nil {
+		return since, fmt.Errorf("failed to fetch validated proxies: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return since, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	var ps []*pool.Proxy
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil {
+		return since, fmt.Errorf("failed to decode validated proxies: %w", err)
+	}
+
+	res, err := proxyStore.Merge(ps)
+	if err != nil {
+		return since, fmt.Errorf("failed to merge validated proxies: %w", err)
+	}
+	if res.Added > 0 || res.Updated > 0 {
+		clusterLog.Infof("Merged verdicts from %s: %d new proxies, %d updated, %d skipped", peer, res.Added, res.Updated, res.Skipped)
+	}
+	latest := since
+	for _, p := range ps {
+		if p.ScoredAt.After(latest) {
+			latest = p.ScoredAt
+		}
+	}
+	return latest, nil
+}
+
+// watchCluster 立即並每隔 cluster.interval 從各成員拉取新的驗證結果（未配置成員時不拉取），返回停止拉取的函數；
+// 每個成員的拉取起點只保存在內存中，重啟後第一次拉取該成員驗證過的全部代理。啟用領導者選舉時同時維持租約（見 watchLease）
+func watchCluster(cfg config.ClusterConfig) func() {
+	if len(cfg.Peers) == 0 {
+		return func() {}
+	}
+	stopLease := watchLease(cfg)
+	done := make(chan struct{})
+	go func() {
+		cursors := make(map[string]time.Time, len(cfg.Peers))
+		pull := func() {
+			for _, peer := range cfg.Peers {
+				latest, err := pullFromPeer(peer, cursors[peer])
+				if err != nil {
+					clusterLog.Warnf("cluster pull from %s failed: %v", peer, err)
+					continue
+				}
+				cursors[peer] = latest
+			}
+		}
+		pull()
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pull()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		stopLease()
+	}
+}
+
+// watchLease 啟用領導者選舉時立即獲得租約，持有時每隔 lease_ttl 的三分之一續約，未獲得時隨機等待後重試（見 leaseRetryDelay）；
+// 返回的函數停止續約並釋放租約
+func watchLease(cfg config.ClusterConfig) func() {
+	if !cfg.LeaderElection {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			next := cfg.LeaseTTL / 3
+			if !acquireLease(cfg) {
+				next = leaseRetryDelay(cfg.LeaseTTL)
+			}
+			select {
+			case <-time.After(next):
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		releaseLease(cfg)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// openTestDB 創建內存數據庫並替換全局的 bdb
+func openTestDB(t *testing.T) *badger.DB {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open badger: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	prev := bdb
+	bdb = db
+	t.Cleanup(func() { bdb = prev })
+	return db
+}
+
+// leasePeer 模擬一個集群成員：以自己的數據庫授予租約，返回成員地址、數據庫和收到的請求數
+func leasePeer(t *testing.T) (*httptest.Server, *badger.DB, *int) {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open badger: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	requests := new(int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			released, _ := pool.ReleaseLease(db, leaseName, r.URL.Query().Get("holder"))
+			json.NewEncoder(w).Encode(map[string]bool{"released": released})
+			return
+		}
+		*requests++
+		var req leaseRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		granted, holder, err := pool.GrantLease(db, leaseName, req.Holder, time.Duration(req.TTLSeconds*float64(time.Second)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(leaseResponse{Granted: granted, Holder: holder})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, db, requests
+}
+
+// resetLease 清除本實例持有的租約
+func resetLease() {
+	lease.Lock()
+	lease.until = time.Time{}
+	lease.Unlock()
+}
+
+func TestLeaderOnly(t *testing.T) {
+	ran := 0
+	run := func() { ran++ }
+	if leaderOnly(config.ClusterConfig{Peers: []string{"http://127.0.0.1:1"}}, "gather", run)(); ran != 1 {
+		t.Fatal("jobs should run unconditionally without leader election")
+	}
+
+	tests := []struct {
+		name     string
+		heldBy   []string // 本地及兩個成員上已有的租約持有者（空表示空閒）
+		down     []bool   // 兩個成員是否不可達
+		wantRuns bool
+	}{
+		{"all members grant", []string{"", "", ""}, []bool{false, false}, true},
+		{"majority despite an unreachable member", []string{"", "", ""}, []bool{false, true}, true},
+		{"minority partition", []string{"", "", ""}, []bool{true, true}, false},
+		{"another member holds the lease", []string{"other", "other", ""}, []bool{false, false}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetLease()
+			t.Cleanup(resetLease)
+			local := openTestDB(t)
+			dbs := []*badger.DB{local}
+			var peers []string
+			for i := range 2 {
+				srv, db, _ := leasePeer(t)
+				dbs = append(dbs, db)
+				peers = append(peers, srv.URL)
+				if tt.down[i] {
+					srv.Close()
+				}
+			}
+			for i, holder := range tt.heldBy {
+				if holder != "" {
+					if _, _, err := pool.GrantLease(dbs[i], leaseName, holder, time.Minute); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			ran := 0
+			leaderOnly(config.ClusterConfig{Peers: peers, LeaderElection: true, LeaseTTL: time.Minute}, "gather", func() { ran++ })()
+			if got := ran == 1; got != tt.wantRuns {
+				t.Errorf("job ran = %v, want %v", got, tt.wantRuns)
+			}
+			if holdsLease() != tt.wantRuns {
+				t.Errorf("holdsLease() = %v, want %v", holdsLease(), tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestLeaseSplitVote(t *testing.T) {
+	resetLease()
+	t.Cleanup(resetLease)
+	// 本實例與成員 A 同時啟動、各自先授予了自己，C、D 不可達：本實例只得到自己和 B 的授予，不足五個成員的多數
+	local := openTestDB(t)
+	srvA, dbA, _ := leasePeer(t)
+	srvB, dbB, _ := leasePeer(t)
+	srvC, _, _ := leasePeer(t)
+	srvC.Close()
+	srvD, _, _ := leasePeer(t)
+	srvD.Close()
+	if _, _, err := pool.GrantLease(dbA, leaseName, "A", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.ClusterConfig{Peers: []string{srvA.URL, srvB.URL, srvC.URL, srvD.URL}, LeaderElection: true, LeaseTTL: time.Minute}
+
+	if acquireLease(cfg) {
+		t.Fatal("acquired the lease with 2 of 5 members")
+	}
+	// 未得到多數時撤回本地和 B 的授予，A 重試時即可得到多數，選舉不會停滯
+	for name, db := range map[string]*badger.DB{"local": local, "A": dbA, "B": dbB} {
+		if granted, holder, _ := pool.GrantLease(db, leaseName, "A", time.Minute); !granted {
+			t.Errorf("%s still grants the lease to %q after the failed vote", name, holder)
+		}
+	}
+	if acquireLease(cfg) {
+		t.Error("acquired the lease while A holds the majority")
+	}
+}
+
+func TestWatchLeaseRetries(t *testing.T) {
+	resetLease()
+	t.Cleanup(resetLease)
+	local := openTestDB(t)
+	srvA, dbA, _ := leasePeer(t)
+	srvC, _, _ := leasePeer(t)
+	srvC.Close()
+	if _, _, err := pool.GrantLease(dbA, leaseName, "A", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.ClusterConfig{Peers: []string{srvA.URL, srvC.URL}, LeaderElection: true, LeaseTTL: 3 * time.Second}
+
+	stop := watchLease(cfg)
+	time.Sleep(100 * time.Millisecond)
+	if holdsLease() {
+		t.Fatal("acquired the lease with 1 of 3 members")
+	}
+	// A 撤回自己的授予後，下一次隨機等待後的重試獲得租約
+	if _, err := pool.ReleaseLease(dbA, leaseName, "A"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for !holdsLease() {
+		if time.Now().After(deadline) {
+			t.Fatal("lease not acquired after the rival withdrew")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	stop()
+	if holdsLease() {
+		t.Error("lease still held after stop")
+	}
+	for name, db := range map[string]*badger.DB{"local": local, "A": dbA} {
+		if granted, _, _ := pool.GrantLease(db, leaseName, "other", time.Minute); !granted {
+			t.Errorf("%s did not release the lease on stop", name)
+		}
+	}
+}
+
+func TestLeaseRenewAndRelease(t *testing.T) {
+	resetLease()
+	t.Cleanup(resetLease)
+	local := openTestDB(t)
+	srvA, dbA, requestsA := leasePeer(t)
+	srvB, _, _ := leasePeer(t)
+	cfg := config.ClusterConfig{Peers: []string{srvA.URL, srvB.URL}, LeaderElection: true, LeaseTTL: time.Minute}
+
+	ran := 0
+	job := leaderOnly(cfg, "health", func() { ran++ })
+	job()
+	job()
+	// 持有租約期間運行任務不再請求成員，續約由 watchLease 負責
+	if ran != 2 || *requestsA != 1 {
+		t.Fatalf("ran %d jobs with %d lease requests, want 2 jobs and 1 request", ran, *requestsA)
+	}
+	if !acquireLease(cfg) || *requestsA != 2 {
+		t.Error("holder should renew its lease")
+	}
+
+	// 其他實例在租約有效期內得不到本實例已獲得的授予
+	if granted, holder, _ := pool.GrantLease(dbA, leaseName, "other", time.Minute); granted || holder != selfMember.ID {
+		t.Errorf("peer granted a held lease to another member (holder %q)", holder)
+	}
+
+	// 釋放後本地記錄被刪除，租約不再由本實例持有；成員上的記錄經由 DELETE 請求釋放
+	releaseLease(config.ClusterConfig{LeaseTTL: time.Minute})
+	if holdsLease() {
+		t.Error("lease still held after release")
+	}
+	if granted, _, _ := pool.GrantLease(local, leaseName, "other", time.Minute); !granted {
+		t.Error("local lease record not released")
+	}
+}
+
+func TestClusterToken(t *testing.T) {
+	resetLease()
+	t.Cleanup(resetLease)
+	db := openTestDB(t)
+	prevStore, prevToken := proxyStore, clusterToken
+	proxyStore, clusterToken = pool.New(db), "s3cret"
+	t.Cleanup(func() { proxyStore, clusterToken = prevStore, prevToken })
+
+	// 成員只接受帶正確令牌的請求
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode([]*pool.Proxy{})
+		case http.MethodPost:
+			json.NewEncoder(w).Encode(leaseResponse{Granted: true, Holder: selfMember.ID})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	cfg := config.ClusterConfig{Peers: []string{srv.URL}, LeaderElection: true, LeaseTTL: time.Minute}
+
+	if _, err := pullFromPeer(srv.URL, time.Time{}); err != nil {
+		t.Errorf("pullFromPeer: %v", err)
+	}
+	if !acquireLease(cfg) {
+		t.Error("lease not acquired from a member requiring the token")
+	}
+	releaseLease(cfg)
+	want := []string{"GET /api/cluster/proxies", "POST /api/cluster/lease", "DELETE /api/cluster/lease"}
+	if strings.Join(paths, ", ") != strings.Join(want, ", ") {
+		t.Errorf("authorized requests = %v, want %v", paths, want)
+	}
+}
+
+func TestHandleLeaseGrant(t *testing.T) {
+	openTestDB(t)
+	post := func(body string) (int, leaseResponse) {
+		w := httptest.NewRecorder()
+		handleLeaseGrant(w, httptest.NewRequest(http.MethodPost, "/api/cluster/lease", strings.NewReader(body)))
+		var res leaseResponse
+		json.NewDecoder(w.Body).Decode(&res)
+		return w.Code, res
+	}
+
+	if code, _ := post(`{"holder":"a"}`); code != http.StatusBadRequest {
+		t.Errorf("missing ttl: status %d, want 400", code)
+	}
+	if code, res := post(`{"holder":"a","ttl_seconds":60}`); code != http.StatusOK || !res.Granted {
+		t.Errorf("free lease: %d %+v", code, res)
+	}
+	if _, res := post(`{"holder":"b","ttl_seconds":60}`); res.Granted || res.Holder != "a" {
+		t.Errorf("held lease: %+v, want refused with holder a", res)
+	}
+
+	w := httptest.NewRecorder()
+	handleLeaseRelease(w, httptest.NewRequest(http.MethodDelete, "/api/cluster/lease?holder=a", nil))
+	if _, res := post(`{"holder":"b","ttl_seconds":60}`); w.Code != http.StatusOK || !res.Granted {
+		t.Errorf("after release: %d, %+v", w.Code, res)
+	}
+}
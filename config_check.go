@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/internal/extractor"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted 輸出配置時替換敏感值
+const redacted = "REDACTED"
+
+// runConfigCheck 校驗生效配置（配置文件 + 命令行參數）並輸出，不打開數據庫也不啟動任何任務
+func runConfigCheck(cfg *config.Config, out io.Writer) error {
+	data, err := yaml.Marshal(redactConfig(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	fmt.Fprintf(out, "# effective configuration (hash %s)\n%s", cfg.Hash(), data)
+
+	if err := checkConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "# config OK")
+	return nil
+}
+
+// checkConfig 執行啟動時會進行的所有校驗，返回全部問題
+func checkConfig(cfg *config.Config) error {
+	var errs []error
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := logger.ParseLevel(cfg.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log: %w", err))
+	}
+	for name, lvl := range cfg.Log.Components {
+		if _, err := logger.ParseLevel(lvl); err != nil {
+			errs = append(errs, fmt.Errorf("log: component %s: %w", name, err))
+		}
+	}
+
+	if err := validateSourceParsers(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := newHeaderRewriter(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("header_rules: %w", err))
+	}
+	if _, err := newNotifier(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("notify: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// validateSourceParsers 檢查來源指定的解析器是否已註冊
+func validateSourceParsers(cfg *config.Config) error {
+	var errs []error
+	for _, s := range cfg.Sources {
+		if s.Parser == "" {
+			continue
+		}
+		if _, ok := extractor.Lookup(s.Parser); !ok {
+			errs = append(errs, fmt.Errorf("sources: %s: unknown parser %q (available: %s)", s.Name(), s.Parser, strings.Join(extractor.Names(), ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// redactConfig 返回隱藏了 Webhook、頻道機器人、GitHub 憑據、管理 API 令牌及 OTLP 導出頭部的配置副本
+func redactConfig(cfg *config.Config) *config.Config {
+	c := *cfg
+	c.Notify.Webhooks = append([]config.WebhookConfig(nil), cfg.Notify.Webhooks...)
+	for i := range c.Notify.Webhooks {
+		h := &c.Notify.Webhooks[i]
+		if h.Token != "" {
+			h.Token = redacted
+		}
+		// Slack 等 Webhook 的路徑即憑據，只保留協議與主機
+		if u, err := url.Parse(h.URL); err == nil && u.Path != "" && u.Path != "/" {
+			h.URL = u.Scheme + "://" + u.Host + "/" + redacted
+		}
+	}
+	for _, t := range []*string{&c.Chat.Telegram.BotToken, &c.Chat.Discord.BotToken, &c.DB.EncryptionKey, &c.Admin.Token} {
+		if *t != "" {
+			*t = redacted
+		}
+	}
+	c.Sources = append([]config.SourceConfig(nil), cfg.Sources...)
+	for i := range c.Sources {
+		if g := c.Sources[i].GitHub; g != nil && g.Token != "" {
+			gc := *g
+			gc.Token = redacted
+			c.Sources[i].GitHub = &gc
+		}
+	}
+	if len(cfg.Telemetry.Headers) > 0 {
+		c.Telemetry.Headers = make(map[string]string, len(cfg.Telemetry.Headers))
+		for name := range cfg.Telemetry.Headers {
+			c.Telemetry.Headers[name] = redacted
+		}
+	}
+	return &c
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/e2u/dynamic-proxy/internal/admin"
+	"github.com/e2u/dynamic-proxy/pkg/rotator"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+var (
+	// errJobRunning 已有任務在運行
+	errJobRunning = errors.New("another job is running")
+	// errUnknownJob 不能從管理 API 觸發的任務名
+	errUnknownJob = errors.New("unknown job")
+)
+
+// jobRunner 返回可從管理 API 觸發的任務（健康檢查驗證全部代理）
+func jobRunner(name string) (func(), bool) {
+	switch name {
+	case jobGather:
+		return gatherProxies, true
+	case jobHealth:
+		return func() { checkAllProxiesHealth(true) }, true
+	case jobCleanup:
+		return func() { cleanupProxiesFromDB() }, true
+	}
+	return nil, false
+}
+
+// triggerJob 在後台運行任務，已有任務在運行時返回 errJobRunning 而不排隊
+func triggerJob(name string) error {
+	run, ok := jobRunner(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", errUnknownJob, name)
+	}
+	if !cronMutex.TryLock() {
+		return errJobRunning
+	}
+	applyPendingSettings()
+	go func() {
+		defer unlockJobs()
+		log.Infof("Job %s triggered from admin API", name)
+		run()
+	}()
+	return nil
+}
+
+// registerDashboardRoutes 註冊管理界面及其使用的接口
+func registerDashboardRoutes(srv *admin.Server, ps *rotator.ProxyServer) {
+	ui, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+
+	// GET /ui/ 內置管理界面
+	srv.Handle("GET /ui/", http.StripPrefix("/ui/", http.FileServerFS(ui)))
+	srv.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ui/", http.StatusFound)
+	})
+
+	// GET /api/requests/recent?n=50 最近完成的請求，最新的在前
+	srv.HandleFunc("GET /api/requests/recent", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, ps.RecentRequests(admin.QueryInt(r, "n", 50)))
+	})
+
+	// POST /api/jobs/{name} 立即運行 gather、health 或 cleanup 任務
+	srv.HandleProtected("POST /api/jobs/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		err := triggerJob(name)
+		switch {
+		case errors.Is(err, errUnknownJob):
+			admin.WriteError(w, http.StatusNotFound, err)
+		case errors.Is(err, errJobRunning):
+			admin.WriteError(w, http.StatusConflict, err)
+		default:
+			admin.WriteJSON(w, http.StatusAccepted, map[string]string{"job": name, "state": "started"})
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// compactDiscardRatio 壓縮時值日誌文件中過期數據超過此比例才重寫
+const compactDiscardRatio = 0.5
+
+// prefixStats 一類鍵的數量與大小
+type prefixStats struct {
+	Prefix string `json:"prefix"` // proxies 為代理記錄，其餘為元數據鍵前綴（如 _meta:queue:）
+	Keys   int    `json:"keys"`
+	Bytes  int64  `json:"bytes"` // 鍵與值的總大小
+}
+
+// levelStats LSM 樹一層的表數和大小
+type levelStats struct {
+	Level  int   `json:"level"`
+	Tables int   `json:"tables"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// dbStats db stats 的輸出
+type dbStats struct {
+	Path      string        `json:"path"`
+	LSMBytes  int64         `json:"lsm_bytes"`  // SST 文件總大小
+	VlogBytes int64         `json:"vlog_bytes"` // 值日誌文件總大小
+	Keys      []prefixStats `json:"keys"`
+	Levels    []levelStats  `json:"levels"` // 非空的 LSM 層
+}
+
+// keyGroup 鍵所屬的分組：代理記錄為 proxies，元數據鍵取到名稱後的第一個冒號（如 _meta:queue:），
+// 單條元數據為完整鍵（如 _meta:run）
+func keyGroup(key string) string {
+	name, ok := strings.CutPrefix(key, pool.MetaPrefix)
+	if !ok {
+		return "proxies"
+	}
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return pool.MetaPrefix + name[:i+1]
+	}
+	return key
+}
+
+// dbFileSizes 數據庫目錄中 SST 與值日誌文件各自的總大小
+func dbFileSizes(dir string) (lsm, vlog int64) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".sst":
+			lsm += fi.Size()
+		case ".vlog":
+			vlog += fi.Size()
+		}
+		return nil
+	})
+	return lsm, vlog
+}
+
+// collectDBStats 統計各類鍵的數量與大小、LSM 各層和文件大小
+func collectDBStats(db *badger.DB, dir string) (dbStats, error) {
+	st := dbStats{Path: dir}
+	st.LSMBytes, st.VlogBytes = dbFileSizes(dir)
+
+	groups := make(map[string]*prefixStats)
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			name := keyGroup(string(item.Key()))
+			g, ok := groups[name]
+			if !ok {
+				g = &prefixStats{Prefix: name}
+				groups[name] = g
+			}
+			g.Keys++
+			g.Bytes += int64(len(item.Key())) + item.ValueSize()
+		}
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+	for _, g := range groups {
+		st.Keys = append(st.Keys, *g)
+	}
+	slices.SortFunc(st.Keys, func(a, b prefixStats) int { return strings.Compare(a.Prefix, b.Prefix) })
+
+	for _, l := range db.Levels() {
+		if l.NumTables == 0 {
+			continue
+		}
+		st.Levels = append(st.Levels, levelStats{Level: l.Level, Tables: l.NumTables, Bytes: l.Size})
+	}
+	return st, nil
+}
+
+// runDBCommand 執行 db 子命令：stats 以 JSON 輸出統計，compact 合併 LSM 樹並回收值日誌空間
+func runDBCommand(cmd string, db *badger.DB, dir string, out io.Writer) error {
+	switch cmd {
+	case "stats":
+		st, err := collectDBStats(db, dir)
+		if err != nil {
+			return err
+		}
+		jb, err := json.MarshalIndent(st, "", "\t")
+		if err != nil {
+			return fmt.Errorf("failed to marshal stats: %w", err)
+		}
+		fmt.Fprintln(out, string(jb))
+		return nil
+	case "compact":
+		return compactDB(db, dir, out)
+	}
+	return fmt.Errorf("unknown db command %q", cmd)
+}
+
+// compactDB 把 LSM 樹合併到一層並反復回收值日誌，直到沒有可回收的文件
+func compactDB(db *badger.DB, dir string, out io.Writer) error {
+	lsm, vlog := dbFileSizes(dir)
+	fmt.Fprintf(out, "before: lsm %s, vlog %s\n", formatBytes(lsm), formatBytes(vlog))
+
+	if err := db.Flatten(2); err != nil {
+		return fmt.Errorf("failed to flatten LSM tree: %w", err)
+	}
+	rewritten := 0
+	for {
+		err := db.RunValueLogGC(compactDiscardRatio)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("value log GC failed: %w", err)
+		}
+		rewritten++
+	}
+
+	lsm, vlog = dbFileSizes(dir)
+	fmt.Fprintf(out, "after:  lsm %s, vlog %s (%d value log files rewritten)\n", formatBytes(lsm), formatBytes(vlog), rewritten)
+	return nil
+}
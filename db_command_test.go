@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestKeyGroup(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"1.2.3.4:8080", "proxies"},
+		{"[2001:db8::1]:1080", "proxies"},
+		{"_meta:run", "_meta:run"},
+		{"_meta:queue:1.2.3.4:8080", "_meta:queue:"},
+		{"_meta:lease:jobs", "_meta:lease:"},
+		{"_meta:", "_meta:"},
+		{"_met", "proxies"},
+	}
+	for _, tt := range tests {
+		if got := keyGroup(tt.key); got != tt.want {
+			t.Errorf("keyGroup(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestCollectDBStats(t *testing.T) {
+	dir := t.TempDir()
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(txn *badger.Txn) error {
+		for k, v := range map[string]string{
+			"1.2.3.4:80":         "{}",
+			"5.6.7.8:1080":       "{}",
+			"_meta:queue:a:1":    "",
+			"_meta:queue:bb:2":   "",
+			"_meta:run":          "xyz",
+			"_meta:stats:a:1:ok": "12",
+		} {
+			if err := txn.Set([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := collectDBStats(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []prefixStats{
+		{Prefix: "_meta:queue:", Keys: 2, Bytes: 15 + 16},
+		{Prefix: "_meta:run", Keys: 1, Bytes: 9 + 3},
+		{Prefix: "_meta:stats:", Keys: 1, Bytes: 18 + 2},
+		{Prefix: "proxies", Keys: 2, Bytes: 10 + 2 + 12 + 2},
+	}
+	if !reflect.DeepEqual(st.Keys, want) {
+		t.Errorf("keys = %+v, want %+v", st.Keys, want)
+	}
+	if st.Path != dir || st.VlogBytes == 0 {
+		t.Errorf("path %q, vlog %d bytes; want %q with a value log", st.Path, st.VlogBytes, dir)
+	}
+}
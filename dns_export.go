@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/internal/dnszone"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// buildZone 由數據庫中的可用代理構建 DNS 區域
+func buildZone(cfg config.DNSConfig) (*dnszone.Zone, error) {
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		return nil, err
+	}
+	if tags := pool.NormalizeTags(cfg.Tags); len(tags) > 0 {
+		ps = slices.DeleteFunc(ps, func(p *pool.Proxy) bool { return !p.HasTags(tags) })
+	}
+	return dnszone.Build(cfg.Zone, cfg.TTL, ps)
+}
+
+// exportZone 把區域文件寫到 path（"-" 表示標準輸出）
+func exportZone(cfg config.DNSConfig, path string) error {
+	z, err := buildZone(cfg)
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		_, err = z.WriteTo(os.Stdout)
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create zone file: %w", err)
+	}
+	if _, err := z.WriteTo(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write zone file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Infof("Exported %d proxies to zone file %s (%s)", z.Proxies, path, z.Origin)
+	return nil
+}
+
+// startDNSServer 啟動內置 DNS 服務器，每隔 cfg.Refresh 從數據庫重建區域；返回停止函數
+func startDNSServer(cfg config.DNSConfig) (func(), error) {
+	z, err := buildZone(cfg)
+	if err != nil {
+		return nil, err
+	}
+	srv := dnszone.NewServer(cfg.Listen, cfg.MaxAnswers)
+	srv.SetZone(z)
+	if err := srv.Start(); err != nil {
+		return nil, err
+	}
+	log.Infof("DNS zone %s published with %d proxies", z.Origin, z.Proxies)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(cfg.Refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				z, err := buildZone(cfg)
+				if err != nil {
+					log.Errorf("failed to rebuild dns zone: %v", err)
+					continue
+				}
+				srv.SetZone(z)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		if err := srv.Stop(); err != nil {
+			log.Warnf("failed to stop DNS server: %v", err)
+		}
+	}, nil
+}
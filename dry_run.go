@@ -0,0 +1,129 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// printCleanupPlan 輸出清理任務會刪除的代理及原因（-cleanup -dry-run），不修改數據庫
+func printCleanupPlan(w io.Writer) error {
+	now := time.Now()
+	plan, scanned, err := planCleanup(now)
+	if err != nil {
+		return err
+	}
+	slices.SortStableFunc(plan, func(a, b cleanupCandidate) int { return cmp.Compare(a.key, b.key) })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tREASON\tDETAIL")
+	for _, c := range plan {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.key, c.reason, cleanupDetail(c, now))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "# dry run: %d of %d proxies would be deleted\n", len(plan), scanned)
+	return nil
+}
+
+// cleanupDetail 刪除原因對應的依據（時間、評分與策略閾值）
+func cleanupDetail(c cleanupCandidate, now time.Time) string {
+	p := c.proxy
+	switch c.reason {
+	case cleanupInvalid:
+		return "record cannot be parsed"
+	case "never validated":
+		return fmt.Sprintf("added %s ago, max_age %s", age(now, p.Added), cleanupPolicy.MaxAge)
+	case "stale":
+		return fmt.Sprintf("last validated %s ago, max_age %s", age(now, p.Updated), cleanupPolicy.MaxAge)
+	case "low score":
+		return fmt.Sprintf("score %.2f, min_score %.2f", p.ScoreAt(now, pool.CurrentValidationPolicy().ScoreHalfLife), cleanupPolicy.MinScore)
+	case "disabled":
+		return fmt.Sprintf("disabled %s ago, quarantine %s", age(now, cmp.Or(p.DisabledAt, p.Updated)), cleanupPolicy.Quarantine)
+	case cleanupEvicted:
+		return fmt.Sprintf("disabled: %t, last validated %s ago, pool limit %d", p.Disable, age(now, p.Updated), cleanupPolicy.MaxProxies)
+	}
+	return ""
+}
+
+// age 距 t 的時長（秒級），t 為零值時為 never
+func age(now, t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return now.Sub(t).Round(time.Second).String()
+}
+
+// revalidation 模擬重新驗證一個代理的結果
+type revalidation struct {
+	proxy  *pool.Proxy // 驗證前的記錄
+	after  pool.Proxy  // 應用驗證結果後的副本（不寫入數據庫）
+	result pool.ValidationResult
+}
+
+// printRevalidationPlan 驗證全部代理（與 -check 相同，包括待驗證的候選代理），輸出狀態會變化（禁用或恢復）的代理及原因
+// （-check -dry-run）；驗證結果只應用到副本，不寫入數據庫也不移出待驗證隊列
+func printRevalidationPlan(w io.Writer) error {
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		return err
+	}
+
+	results := make([]revalidation, len(ps))
+	sem := make(chan struct{}, max(validationCfg.QueueWorkers, 1))
+	var wg sync.WaitGroup
+	for i, p := range ps {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r := pool.Validate(p)
+			after := *p
+			r.ApplyTo(&after)
+			results[i] = revalidation{proxy: p, after: after, result: r}
+		}()
+	}
+	wg.Wait()
+	slices.SortStableFunc(results, func(a, b revalidation) int { return cmp.Compare(a.proxy.Key(), b.proxy.Key()) })
+
+	disabled, recovered := 0, 0
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tACTION\tREASON\tSCORE")
+	for _, rv := range results {
+		var action string
+		switch {
+		case rv.after.Disable && !rv.proxy.Disable:
+			action = "disable"
+			disabled++
+		case !rv.after.Disable && rv.proxy.Disable:
+			action = "recover"
+			recovered++
+		default:
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f -> %.2f (score_exclude %.2f)\n", rv.proxy.Key(), action, revalidationReason(rv.result),
+			rv.proxy.CurrentScore(), rv.after.Score, pool.CurrentValidationPolicy().ScoreExclude)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "# dry run: %d of %d proxies would be disabled, %d recovered\n", disabled, len(ps), recovered)
+	return nil
+}
+
+// revalidationReason 驗證結果的簡述
+func revalidationReason(r pool.ValidationResult) string {
+	switch {
+	case !r.Tested:
+		return "invalid address"
+	case r.Protocol == "":
+		return "unreachable"
+	case !r.Healthy:
+		return "validation failed"
+	}
+	return "validation passed"
+}
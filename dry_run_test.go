@@ -0,0 +1,144 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// seedProxies 寫入代理記錄，值為 string 時按原樣寫入（無法解析的記錄）
+func seedProxies(t *testing.T, db *badger.DB, records map[string]any) {
+	t.Helper()
+	err := db.Update(func(txn *badger.Txn) error {
+		for key, r := range records {
+			var val []byte
+			switch r := r.(type) {
+			case string:
+				val = []byte(r)
+			case *pool.Proxy:
+				val = r.DumpJSON()
+			}
+			if err := txn.Set([]byte(key), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dumpDB 數據庫中的全部鍵值
+func dumpDB(t *testing.T, db *badger.DB) map[string]string {
+	t.Helper()
+	kv := make(map[string]string)
+	err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			v, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			kv[string(it.Item().KeyCopy(nil))] = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kv
+}
+
+// validated 最後一次在 ago 之前通過驗證的代理
+func validated(ip string, ago time.Duration) *pool.Proxy {
+	at := time.Now().Add(-ago)
+	return &pool.Proxy{IP: ip, Port: "80", Protocol: "http", Added: at, Updated: at, Score: 0.9, ScoredAt: at}
+}
+
+func TestPrintCleanupPlan(t *testing.T) {
+	db := openTestDB(t)
+	prev := cleanupPolicy
+	cleanupPolicy = pool.CleanupPolicy{MaxAge: 24 * time.Hour, Quarantine: time.Hour, MaxProxies: 2}
+	t.Cleanup(func() { cleanupPolicy = prev })
+
+	disabled := validated("10.0.0.2", 3*time.Hour)
+	disabled.Disable, disabled.DisabledAt = true, time.Now().Add(-2*time.Hour)
+	seedProxies(t, db, map[string]any{
+		"10.0.0.1:80": validated("10.0.0.1", 48*time.Hour),
+		"10.0.0.2:80": disabled,
+		"10.0.0.3:80": "not json",
+		"10.0.0.4:80": &pool.Proxy{IP: "10.0.0.4", Port: "80", Added: time.Now()},
+		"10.0.0.5:80": validated("10.0.0.5", time.Hour),
+		"10.0.0.6:80": validated("10.0.0.6", 2*time.Hour),
+		"10.0.0.7:80": validated("10.0.0.7", 3*time.Hour),
+	})
+	before := dumpDB(t, db)
+
+	var out strings.Builder
+	if err := printCleanupPlan(&out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []struct{ key, reason string }{
+		{"10.0.0.1:80", "stale"},
+		{"10.0.0.2:80", "disabled"},
+		{"10.0.0.3:80", cleanupInvalid},
+		{"10.0.0.4:80", "never validated"},
+		{"10.0.0.7:80", cleanupEvicted},
+	}
+	if len(lines) != len(want)+2 {
+		t.Fatalf("plan output:\n%s", out.String())
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i+1], w.key+" ") || !strings.Contains(lines[i+1], "  "+w.reason+"  ") {
+			t.Errorf("line %d = %q, want %s %s", i+1, lines[i+1], w.key, w.reason)
+		}
+	}
+	if !strings.Contains(lines[2], "quarantine 1h0m0s") || !strings.Contains(lines[5], "pool limit 2") {
+		t.Errorf("plan details missing policy thresholds:\n%s", out.String())
+	}
+	if last := lines[len(lines)-1]; last != "# dry run: 5 of 7 proxies would be deleted" {
+		t.Errorf("summary = %q", last)
+	}
+	if after := dumpDB(t, db); !maps.Equal(before, after) {
+		t.Error("dry run modified the database")
+	}
+}
+
+func TestPrintRevalidationPlan(t *testing.T) {
+	db := openTestDB(t)
+	// 127.0.0.2:1 拒絕連接，驗證失敗後評分低於 score_exclude 而禁用；127.0.0.1 不驗證，狀態不變
+	failing := validated("127.0.0.2", time.Minute)
+	failing.Port, failing.Score, failing.ScoredAt = "1", pool.CurrentValidationPolicy().ScoreExclude+0.01, time.Now()
+	skipped := validated("127.0.0.1", time.Minute)
+	skipped.Disable = true
+	seedProxies(t, db, map[string]any{
+		failing.Key(): failing,
+		skipped.Key(): skipped,
+	})
+	before := dumpDB(t, db)
+
+	var out strings.Builder
+	if err := printRevalidationPlan(&out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("plan output:\n%s", out.String())
+	}
+	if f := strings.Fields(lines[1]); f[0] != failing.Key() || f[1] != "disable" || !strings.Contains(lines[1], "unreachable") {
+		t.Errorf("plan line = %q, want %s disable unreachable", lines[1], failing.Key())
+	}
+	if lines[2] != "# dry run: 1 of 2 proxies would be disabled, 0 recovered" {
+		t.Errorf("summary = %q", lines[2])
+	}
+	if after := dumpDB(t, db); !maps.Equal(before, after) {
+		t.Error("dry run modified the database")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/feed"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+const (
+	// feedBuffer 每個訂閱者緩衝的事件數，超出時斷開訂閱者
+	feedBuffer = 1024
+	// feedHeartbeat 沒有事件時發送注釋行的間隔，避免中間代理斷開空閒連接
+	feedHeartbeat = 15 * time.Second
+)
+
+// handleFeed GET /api/feed?type=proxy_validated,proxy_disabled 以 Server-Sent Events 實時推送代理池變化；
+// 連接被服務端關閉表示訂閱者跟不上推送或服務正在退出，重新連接後應全量同步一次（GET /api/proxies）
+func handleFeed(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	var types []string
+	if v := r.URL.Query().Get("type"); v != "" {
+		types = strings.Split(v, ",")
+	}
+	sub := proxyFeed.Subscribe(feedBuffer, types...)
+	defer proxyFeed.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(feedHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Errorf("failed to encode feed event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// publishValidation 推送驗證結果：通過驗證的代理推送 proxy_validated
+func publishValidation(p *pool.Proxy, healthy bool) {
+	if healthy {
+		proxyFeed.Publish(feed.ProxyValidated, p.Key(), p)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/admin"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+const (
+	// dbCheckInterval 長駐模式下檢查數據庫的間隔
+	dbCheckInterval = 30 * time.Second
+	// maxDBFailures 數據庫連續檢查失敗此次數後視為致命狀態並退出
+	maxDBFailures = 3
+	// metaHeartbeat 數據庫檢查寫入的心跳記錄
+	metaHeartbeat = "heartbeat"
+)
+
+// draining 進程正在關閉，/readyz 返回 503 以便先從服務輪換中摘除
+var draining atomic.Bool
+
+// healthReport /healthz 與 /readyz 響應
+type healthReport struct {
+	Status   string `json:"status"` // ok、fail 或 not_ready
+	DB       string `json:"db"`     // ok 或錯誤信息
+	Healthy  int    `json:"healthy"`
+	Total    int    `json:"total"`
+	Required int    `json:"required,omitempty"` // 就緒所需的最少可用代理數（/readyz）
+	Reason   string `json:"reason,omitempty"`   // 未就緒的原因（/readyz）
+}
+
+// checkDB 檢查數據庫可讀寫：寫入心跳記錄後讀回
+func checkDB() error {
+	if bdb == nil || bdb.IsClosed() {
+		return errors.New("database is closed")
+	}
+	now := time.Now()
+	if err := pool.SaveMeta(bdb, metaHeartbeat, now); err != nil {
+		return err
+	}
+	var got time.Time
+	if ok, err := pool.LoadMeta(bdb, metaHeartbeat, &got); err != nil {
+		return err
+	} else if !ok || !got.Equal(now) {
+		return errors.New("heartbeat record not readable")
+	}
+	return nil
+}
+
+// handleHealthz 報告數據庫狀態和可用代理數，數據庫不可用時返回 503；不需要認證，供容器健康檢查使用
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	report := healthReport{Status: "ok", DB: "ok"}
+	if err := checkDB(); err != nil {
+		report.Status, report.DB = "fail", err.Error()
+		admin.WriteJSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	st, err := collectPoolStats()
+	if err != nil {
+		report.Status, report.DB = "fail", err.Error()
+		admin.WriteJSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	report.Healthy, report.Total = st.Healthy, st.Total
+	admin.WriteJSON(w, http.StatusOK, report)
+}
+
+// handleLivez 存活探針：進程在運行且能處理 HTTP 請求即返回 200，不檢查數據庫和代理池，
+// 避免冷啟動或代理暫時不足時被編排系統重啟
+func handleLivez(w http.ResponseWriter, r *http.Request) {
+	admin.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz 就緒探針：數據庫可用且可用代理數不少於 admin.ready_min_healthy 時返回 200，
+// 冷啟動尚未驗證出足夠代理或正在關閉時返回 503，避免在能轉發流量之前被加入服務輪換
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := healthReport{Status: "not_ready", DB: "ok", Required: reloader.Config().Admin.ReadyMinHealthy}
+	if draining.Load() {
+		report.Reason = "shutting down"
+		admin.WriteJSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	if err := checkDB(); err != nil {
+		report.DB, report.Reason = err.Error(), "database unavailable"
+		admin.WriteJSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	st, err := collectPoolStats()
+	if err != nil {
+		report.DB, report.Reason = err.Error(), "database unavailable"
+		admin.WriteJSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	report.Healthy, report.Total = st.Healthy, st.Total
+	if st.Healthy < report.Required {
+		report.Reason = "not enough healthy proxies"
+		admin.WriteJSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	report.Status = "ok"
+	admin.WriteJSON(w, http.StatusOK, report)
+}
+
+// watchDB 定期檢查數據庫，連續 maxDBFailures 次失敗時報告致命狀態（進程以非零狀態退出，由編排系統重啟）；
+// 返回停止檢查的函數
+func watchDB() func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(dbCheckInterval)
+		defer ticker.Stop()
+		failures := 0
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			err := checkDB()
+			if err == nil {
+				failures = 0
+				continue
+			}
+			failures++
+			log.Warnf("database check failed (%d/%d): %v", failures, maxDBFailures, err)
+			if failures >= maxDBFailures {
+				reportFatal(fmt.Errorf("database unavailable: %w", err))
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/admin"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// defaultHistoryWindow /api/pool/history 未指定 since 時返回的時間範圍
+const defaultHistoryWindow = 24 * time.Hour
+
+// recordSnapshot 記錄一個代理池統計快照，同時更新代理池規模指標
+func recordSnapshot(retention time.Duration) {
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		storeLog.Warnf("failed to record pool snapshot: %v", err)
+		return
+	}
+	updatePoolMetrics(ps)
+	pending, err := pool.QueueLen(bdb)
+	if err != nil {
+		storeLog.Warnf("failed to record pool snapshot: %v", err)
+		return
+	}
+	if err := pool.SaveSnapshot(bdb, pool.TakeSnapshot(ps, pending, time.Now()), retention); err != nil {
+		storeLog.Warnf("failed to save pool snapshot: %v", err)
+	}
+}
+
+// watchHistory 立即並每隔 interval 記錄代理池統計快照（interval 為 0 時不記錄），返回停止記錄的函數；
+// 保留時長取自當前生效的配置
+func watchHistory(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		recordSnapshot(reloader.Config().History.Retention)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				recordSnapshot(reloader.Config().History.Retention)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// parseTimeParam 解析時間參數：RFC 3339 時間，或表示距今多久的時長（如 24h、168h）
+func parseTimeParam(v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (want a duration such as 24h or an RFC 3339 time)", v)
+	}
+	return t, nil
+}
+
+// handleHistory GET /api/pool/history?since=24h&until=...&format=json|csv
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := time.Now()
+	since, until := now.Add(-defaultHistoryWindow), time.Time{}
+	var err error
+	if v := q.Get("since"); v != "" {
+		if since, err = parseTimeParam(v, now); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("since: %w", err))
+			return
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if until, err = parseTimeParam(v, now); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("until: %w", err))
+			return
+		}
+	}
+
+	list, err := pool.LoadSnapshots(bdb, since, until)
+	if err != nil {
+		admin.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	switch q.Get("format") {
+	case "", "json":
+		if list == nil {
+			list = []pool.Snapshot{}
+		}
+		admin.WriteJSON(w, http.StatusOK, list)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		if err := writeHistoryCSV(w, list); err != nil {
+			log.Errorf("failed to write history CSV: %v", err)
+		}
+	default:
+		admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown format %q (want json or csv)", q.Get("format")))
+	}
+}
+
+// writeHistoryCSV 以 CSV 輸出快照，countries 列寫作 DE=12;US=3（按國家代碼排序）
+func writeHistoryCSV(w io.Writer, list []pool.Snapshot) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "total", "healthy", "pending", "avg_latency_ms", "countries"})
+	for _, s := range list {
+		countries := make([]string, 0, len(s.Countries))
+		for _, code := range slices.Sorted(maps.Keys(s.Countries)) {
+			countries = append(countries, code+"="+strconv.Itoa(s.Countries[code]))
+		}
+		cw.Write([]string{
+			s.Time.UTC().Format(time.RFC3339),
+			strconv.Itoa(s.Total),
+			strconv.Itoa(s.Healthy),
+			strconv.Itoa(s.Pending),
+			strconv.FormatFloat(s.AvgLatencyMs, 'f', 1, 64),
+			strings.Join(countries, ";"),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// exportHistoryCSV 把保留的全部快照以 CSV 寫到 path（"-" 表示標準輸出）
+func exportHistoryCSV(path string) error {
+	list, err := pool.LoadSnapshots(bdb, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		return writeHistoryCSV(os.Stdout, list)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create history file: %w", err)
+	}
+	if err := writeHistoryCSV(f, list); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Infof("Exported %d pool snapshots to %s", len(list), path)
+	return nil
+}
@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/logging"
+)
+
+var log = logging.For("admin")
+
+// Server 管理 API 服務器（與代理監聽端口分離）
+type Server struct {
+	ListenAddr string
+	// TLSConfig 非 nil 時以 HTTPS 提供服務（在 Start 之前設置）
+	TLSConfig *tls.Config
+	// Token 非空時經 HandleProtected 註冊的接口需要請求頭 Authorization: Bearer <Token>（在 Start 之前設置）
+	Token      string
+	mux        *http.ServeMux
+	httpServer *http.Server
+}
+
+// New 創建管理 API 服務器
+func New(listenAddr string) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		ListenAddr: listenAddr,
+		mux:        mux,
+		httpServer: &http.Server{
+			Addr:              listenAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Handle 註冊處理器
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc 註冊處理函數
+func (s *Server) HandleFunc(pattern string, fn http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, fn)
+}
+
+// HandleProtected 註冊需要令牌的處理函數（集群接口及修改狀態的接口），未設置 Token 時同 HandleFunc
+func (s *Server) HandleProtected(pattern string, fn http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			WriteError(w, http.StatusUnauthorized, errors.New("missing or invalid admin token"))
+			return
+		}
+		fn(w, r)
+	})
+}
+
+// authorized 請求是否帶有正確的令牌（以固定時間比較）
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// Start 啟動管理 API 服務器
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen admin API on %s: %w", s.ListenAddr, err)
+	}
+
+	if s.TLSConfig != nil {
+		ln = tls.NewListener(ln, s.TLSConfig)
+		log.Infof("Admin API listening on %s (TLS)", ln.Addr())
+	} else {
+		log.Infof("Admin API listening on %s", ln.Addr())
+	}
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("admin API server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop 停止管理 API 服務器
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.httpServer.Shutdown(ctx)
+}
+
+// WriteJSON 以 JSON 格式輸出響應
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(v); err != nil {
+		log.Errorf("failed to encode admin response: %v", err)
+	}
+}
+
+// WriteError 以 JSON 格式輸出錯誤
+func WriteError(w http.ResponseWriter, status int, err error) {
+	WriteJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// QueryInt 讀取整數查詢參數，缺失或無效時返回預設值
+func QueryInt(r *http.Request, name string, def int) int {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleProtected(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	tests := []struct {
+		name   string
+		token  string // 服務器的令牌
+		header string // 請求的 Authorization 頭
+		want   int
+	}{
+		{"no token configured", "", "", http.StatusNoContent},
+		{"missing token", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "Bearer other", http.StatusUnauthorized},
+		{"not a bearer token", "s3cret", "s3cret", http.StatusUnauthorized},
+		{"valid token", "s3cret", "Bearer s3cret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New("")
+			s.Token = tt.token
+			s.HandleProtected("PUT /api/log/levels", ok)
+			s.HandleFunc("GET /api/log/levels", ok)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/log/levels", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.mux.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("PUT status = %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 response without WWW-Authenticate")
+			}
+
+			// 只讀接口不需要令牌
+			w = httptest.NewRecorder()
+			s.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/log/levels", nil))
+			if w.Code != http.StatusNoContent {
+				t.Errorf("GET status = %d, want %d", w.Code, http.StatusNoContent)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package buildinfo 構建版本信息，發布時通過 ldflags 注入：
+//
+//	go build -ldflags "-X github.com/e2u/dynamic-proxy/internal/buildinfo.Version=v1.2.0 \
+//		-X github.com/e2u/dynamic-proxy/internal/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//		-X github.com/e2u/dynamic-proxy/internal/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// 未注入時 Commit 與 Date 取自 Go 工具鏈記錄的 VCS 信息（如有）。
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+)
+
+// 通過 -ldflags "-X ..." 注入的構建信息
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info 構建信息
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// buildInfo 構建信息指標（值恆為 1，信息在標籤中）
+var buildInfo = metrics.NewGaugeVec("dynamic_proxy_build_info",
+	"Build information of the running binary.", "version", "commit", "date", "go_version")
+
+func init() {
+	info := Get()
+	buildInfo.Set(1, info.Version, info.Commit, info.Date, info.GoVersion)
+}
+
+// Get 返回當前二進制的構建信息
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+					if len(info.Commit) > 12 {
+						info.Commit = info.Commit[:12]
+					}
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+// String 單行描述，如 "v1.2.0 (commit 3f2a9c1, built 2026-10-16T08:00:00Z, go1.24.0)"
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", i.Version, i.Commit, i.Date, i.GoVersion)
+}
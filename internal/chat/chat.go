@@ -0,0 +1,58 @@
+// Package chat 從 Telegram 和 Discord 頻道拉取新消息，供從中提取頻道裡發佈的代理列表
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/logging"
+)
+
+var log = logging.For("chat")
+
+// maxResponseBytes 單次 API 響應的最大讀取長度
+const maxResponseBytes = 8 << 20
+
+// Message 一條頻道消息
+type Message struct {
+	Channel string // 頻道標識，如 telegram:@freeproxies、discord:123456789
+	Text    string
+	Time    time.Time
+}
+
+// Cursors 各來源已讀到的位置（Telegram 為下一個 update_id，Discord 為每個頻道最後一條消息的 ID），
+// 持久化後重啟不會重複拉取
+type Cursors map[string]string
+
+// Source 頻道消息來源
+type Source interface {
+	// Fetch 拉取 cur 記錄的位置之後的新消息，並推進 cur
+	Fetch(ctx context.Context, cur Cursors) ([]Message, error)
+}
+
+// getJSON 請求 API 並把響應解碼到 v，非 2xx 響應返回帶狀態碼的錯誤；client 為 nil 時使用 http.DefaultClient
+func getJSON(ctx context.Context, client *http.Client, req *http.Request, v any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %d: %.200s", req.URL.Path, resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
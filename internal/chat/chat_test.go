@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTelegramFetch(t *testing.T) {
+	var offsets []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botTOKEN/getUpdates" {
+			http.NotFound(w, r)
+			return
+		}
+		offsets = append(offsets, r.URL.Query().Get("offset"))
+		fmt.Fprint(w, `{"ok":true,"result":[
+			{"update_id":10,"channel_post":{"chat":{"id":-1001,"username":"FreeProxies"},"date":1700000000,"text":"1.2.3.4:8080"}},
+			{"update_id":11,"channel_post":{"chat":{"id":-1002},"date":1700000000,"text":"5.6.7.8:3128"}},
+			{"update_id":12,"message":{"chat":{"id":-1003},"date":1700000000,"caption":"9.9.9.9:80"}}
+		]}`)
+	}))
+	defer srv.Close()
+
+	tg := &Telegram{Token: "TOKEN", Channels: []string{"@freeproxies", "-1003"}, APIURL: srv.URL}
+	cur := Cursors{}
+	msgs, err := tg.Fetch(context.Background(), cur)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Channel != "telegram:@freeproxies" || msgs[1].Text != "9.9.9.9:80" {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	if cur[telegramCursor] != "13" {
+		t.Errorf("cursor = %q, want 13", cur[telegramCursor])
+	}
+	if _, err := tg.Fetch(context.Background(), cur); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if offsets[0] != "" || offsets[1] != "13" {
+		t.Errorf("offsets = %q, want [\"\" 13]", offsets)
+	}
+}
+
+func TestTelegramErrorHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"ok":false,"description":"Unauthorized"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	tg := &Telegram{Token: "SECRET", Channels: []string{"@x"}, APIURL: srv.URL}
+	_, err := tg.Fetch(context.Background(), Cursors{})
+	if err == nil {
+		t.Fatal("Fetch succeeded, want error")
+	}
+	if strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("error leaks token: %v", err)
+	}
+}
+
+func TestDiscordFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bot TOKEN" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/channels/100/messages":
+			if r.URL.Query().Get("after") == "998" {
+				fmt.Fprint(w, `[]`)
+				return
+			}
+			fmt.Fprint(w, `[{"id":"998","content":"1.2.3.4:8080"},{"id":"997","content":""}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dc := &Discord{Token: "TOKEN", Channels: []string{"100", "200"}, APIURL: srv.URL}
+	cur := Cursors{}
+	msgs, err := dc.Fetch(context.Background(), cur)
+	if err == nil || !strings.Contains(err.Error(), "channel 200") {
+		t.Errorf("err = %v, want channel 200 error", err)
+	}
+	if len(msgs) != 1 || msgs[0].Channel != "discord:100" || msgs[0].Text != "1.2.3.4:8080" {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	if cur["discord:100"] != "998" {
+		t.Errorf("cursor = %q, want 998", cur["discord:100"])
+	}
+	if msgs, _ := dc.Fetch(context.Background(), cur); len(msgs) != 0 {
+		t.Errorf("second fetch = %+v, want none", msgs)
+	}
+}
+
+func TestSnowflakeLess(t *testing.T) {
+	if !snowflakeLess("", "1") || !snowflakeLess("99", "100") || snowflakeLess("100", "99") || snowflakeLess("5", "5") {
+		t.Error("snowflakeLess ordering is wrong")
+	}
+}
@@ -0,0 +1,98 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DiscordAPI Discord REST API 地址
+const DiscordAPI = "https://discord.com/api/v10"
+
+const (
+	// discordPageSize 每次請求的消息數（API 上限）
+	discordPageSize = 100
+	// discordMaxPages 每個頻道每次最多翻的頁數，積壓更多時下次繼續
+	discordMaxPages = 10
+)
+
+// Discord 經由機器人賬號讀取頻道消息；機器人需有頻道的 View Channel 與 Read Message History 權限，
+// 並啟用 Message Content Intent
+type Discord struct {
+	Token    string
+	Channels []string // 頻道 ID
+	APIURL   string   // 為空時使用 DiscordAPI
+	Client   *http.Client
+}
+
+type discordMessage struct {
+	ID        string    `json:"id"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// snowflakeLess Discord 消息 ID（十進制雪花 ID）的大小比較
+func snowflakeLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// Fetch 實現 Source；頻道沒有記錄位置時只取最近一頁消息。單個頻道失敗時繼續其餘頻道，返回第一個錯誤
+func (d *Discord) Fetch(ctx context.Context, cur Cursors) ([]Message, error) {
+	var msgs []Message
+	var firstErr error
+	for _, ch := range d.Channels {
+		got, err := d.fetchChannel(ctx, ch, cur)
+		msgs = append(msgs, got...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return msgs, firstErr
+}
+
+// fetchChannel 拉取頻道 ch 在 cur 記錄的位置之後的消息
+func (d *Discord) fetchChannel(ctx context.Context, ch string, cur Cursors) ([]Message, error) {
+	api := d.APIURL
+	if api == "" {
+		api = DiscordAPI
+	}
+	key := "discord:" + ch
+	var msgs []Message
+	for page := 0; page < discordMaxPages; page++ {
+		q := url.Values{}
+		q.Set("limit", fmt.Sprint(discordPageSize))
+		after := cur[key]
+		if after != "" {
+			q.Set("after", after)
+		}
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/channels/%s/messages?%s", strings.TrimRight(api, "/"), url.PathEscape(ch), q.Encode()), nil)
+		if err != nil {
+			return msgs, err
+		}
+		req.Header.Set("Authorization", "Bot "+d.Token)
+		var list []discordMessage
+		if err := getJSON(ctx, d.Client, req, &list); err != nil {
+			return msgs, fmt.Errorf("discord: channel %s: %w", ch, err)
+		}
+		for _, m := range list {
+			if snowflakeLess(cur[key], m.ID) {
+				cur[key] = m.ID
+			}
+			if m.Content != "" {
+				msgs = append(msgs, Message{Channel: key, Text: m.Content, Time: m.Timestamp})
+			}
+		}
+		// 首次拉取只取最近一頁，不回溯整個頻道歷史
+		if after == "" || len(list) < discordPageSize {
+			break
+		}
+	}
+	log.Debugf("discord: %d messages from channel %s", len(msgs), ch)
+	return msgs, nil
+}
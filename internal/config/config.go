@@ -0,0 +1,1509 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/retry"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Config 應用配置（從 YAML 配置文件加載，未設置的字段使用預設值）
+type Config struct {
+	Server      ServerConfig       `yaml:"server"`
+	Admin       AdminConfig        `yaml:"admin"`
+	ACME        ACMEConfig         `yaml:"acme"`
+	DNS         DNSConfig          `yaml:"dns"`
+	Log         LogConfig          `yaml:"log"`
+	DB          DBConfig           `yaml:"db"`
+	Replica     ReplicaConfig      `yaml:"replica"`
+	Cluster     ClusterConfig      `yaml:"cluster"`
+	Notify      NotifyConfig       `yaml:"notify"`
+	Validation  ValidationConfig   `yaml:"validation"`
+	HeaderRules []HeaderRuleConfig `yaml:"header_rules"`
+	// Sources 代理列表來源
+	Sources []SourceConfig `yaml:"sources"`
+	// Pools 命名代理池：每個池有自己的篩選條件和監聽端口，共用同一個數據庫（僅 -serve 模式）
+	Pools    []PoolConfig   `yaml:"pools"`
+	Gather   GatherConfig   `yaml:"gather"`
+	Retry    RetryConfig    `yaml:"retry"`
+	Schedule ScheduleConfig `yaml:"schedule"`
+	Cleanup  CleanupConfig  `yaml:"cleanup"`
+	History  HistoryConfig  `yaml:"history"`
+	Events   EventsConfig   `yaml:"events"`
+	Chat     ChatConfig     `yaml:"chat"`
+	// Telemetry 以 OTLP 導出追蹤和指標
+	Telemetry TelemetryConfig `yaml:"telemetry"`
+}
+
+// SourceConfig 代理列表來源，配置文件中也可以直接寫 URL 字符串
+type SourceConfig struct {
+	URL    string `yaml:"url"`
+	Parser string `yaml:"parser"` // 解析器名稱（空表示按 URL 自動選擇）
+	// Tags 給此來源採集到的代理添加的標籤（如 paid）
+	Tags []string `yaml:"tags,omitempty"`
+	// Pagination 分頁採集（API 類來源），為空表示只請求 URL 本身
+	Pagination *PaginationConfig `yaml:"pagination,omitempty"`
+	// Timeout 覆蓋 gather.source_timeout，0 表示沿用
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Method 請求方法（如 POST），預設 GET
+	Method string `yaml:"method,omitempty"`
+	// Headers 附加的請求頭（如 Referer、Authorization），設置 User-Agent 時替換隨機 UserAgent
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// UserAgent 此來源固定使用的 User-Agent，省略時從 gather.user_agents 中隨機選擇；與 headers 中的 User-Agent 互斥
+	UserAgent string `yaml:"user_agent,omitempty"`
+	// Cookies 隨請求發送的 Cookie
+	Cookies map[string]string `yaml:"cookies,omitempty"`
+	// Body 請求體（如 POST 表單或 JSON），分頁來源的每一頁使用相同的請求體
+	Body string `yaml:"body,omitempty"`
+	// ViaPool 覆蓋 gather.via_pool，省略時沿用
+	ViaPool *bool `yaml:"via_pool,omitempty"`
+	// Proxy 經由指定代理採集此來源（http://、https:// 或 socks5:// URL，可帶用戶名密碼），優先於 via_pool
+	Proxy string `yaml:"proxy,omitempty"`
+	// GitHub 採集 GitHub 倉庫中的純文本列表（此時不設置 url）：按 ETag / Last-Modified 條件請求，
+	// 未變化的文件不重新下載
+	GitHub *GitHubSourceConfig `yaml:"github,omitempty"`
+}
+
+// GitHubSourceConfig GitHub 倉庫中的一組純文本代理列表
+type GitHubSourceConfig struct {
+	Repo  string   `yaml:"repo"`  // owner/name
+	Ref   string   `yaml:"ref"`   // 分支、標籤或提交，省略時為默認分支（cdn 為 jsdelivr 時必填）
+	Paths []string `yaml:"paths"` // 文件路徑，可含通配符（如 *.txt、proxies/*.txt，* 不跨越 /）
+	CDN   string   `yaml:"cdn"`   // github（raw.githubusercontent.com，預設）或 jsdelivr
+	Token string   `yaml:"token"` // GitHub API Token（可選，用於列出文件時提高速率限制）
+}
+
+// validate 檢查 GitHub 來源配置
+func (g *GitHubSourceConfig) validate() error {
+	if owner, name, ok := strings.Cut(g.Repo, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("github.repo %q must be owner/name", g.Repo)
+	}
+	if len(g.Paths) == 0 {
+		return errors.New("github.paths is required")
+	}
+	for _, p := range g.Paths {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("github.paths: invalid pattern %q", p)
+		}
+	}
+	switch g.CDN {
+	case "", "github":
+	case "jsdelivr":
+		if g.Ref == "" {
+			return errors.New("github.ref is required for the jsdelivr cdn")
+		}
+	default:
+		return fmt.Errorf("github.cdn: unknown cdn %q (want github or jsdelivr)", g.CDN)
+	}
+	return nil
+}
+
+// Name 來源在日誌和錯誤信息中的名稱：url，GitHub 來源為 github:owner/name
+func (s *SourceConfig) Name() string {
+	if s.GitHub != nil && s.URL == "" {
+		return "github:" + s.GitHub.Repo
+	}
+	return s.URL
+}
+
+// validate 檢查來源的請求設置
+func (s *SourceConfig) validate() error {
+	if s.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if s.Method != "" && !validMethod(s.Method) {
+		return fmt.Errorf("invalid method %q", s.Method)
+	}
+	for name := range s.Headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if s.UserAgent != "" && strings.EqualFold(name, "User-Agent") {
+			return errors.New("user_agent and a User-Agent header are mutually exclusive")
+		}
+	}
+	if strings.ContainsAny(s.UserAgent, "\r\n") {
+		return fmt.Errorf("invalid user_agent %q", s.UserAgent)
+	}
+	if s.GitHub != nil {
+		if s.URL != "" {
+			return errors.New("url and github are mutually exclusive")
+		}
+		if s.Pagination != nil {
+			return errors.New("pagination is not supported for github sources")
+		}
+		if err := s.GitHub.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Proxy != "" {
+		u, err := url.Parse(s.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy %q: %w", s.Proxy, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("invalid proxy %q: scheme must be http, https or socks5", s.Proxy)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("invalid proxy %q: missing host", s.Proxy)
+		}
+	}
+	return nil
+}
+
+// validMethod 請求方法是否為合法的 HTTP token
+func validMethod(m string) bool {
+	for _, r := range m {
+		if r < '!' || r > '~' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return m != ""
+}
+
+// PaginationConfig 來源分頁參數：從 start_page 起逐頁請求，最多 max_pages 頁
+type PaginationConfig struct {
+	PageParam   string `yaml:"page_param"`    // 頁碼查詢參數名（如 page）
+	SizeParam   string `yaml:"size_param"`    // 每頁條數查詢參數名（如 limit，可選）
+	PageSize    int    `yaml:"page_size"`     // 每頁條數，寫入 size_param
+	StartPage   int    `yaml:"start_page"`    // 起始頁碼（配置文件中省略時為 1）
+	MaxPages    int    `yaml:"max_pages"`     // 最多請求的頁數
+	StopOnEmpty bool   `yaml:"stop_on_empty"` // 某頁沒有提取到代理時停止翻頁
+}
+
+// UnmarshalYAML 省略 start_page 時從第 1 頁開始，從 0 開始計頁的 API 可顯式寫 0
+func (p *PaginationConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain PaginationConfig
+	v := plain{StartPage: 1}
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	*p = PaginationConfig(v)
+	return nil
+}
+
+// PageURL 返回第 n 頁（從 0 開始計）的 URL，已有的同名查詢參數會被覆蓋
+func (p *PaginationConfig) PageURL(base string, n int) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(p.PageParam, strconv.Itoa(p.StartPage+n))
+	if p.SizeParam != "" && p.PageSize > 0 {
+		q.Set(p.SizeParam, strconv.Itoa(p.PageSize))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// validate 檢查分頁參數
+func (p *PaginationConfig) validate() error {
+	if p.PageParam == "" {
+		return errors.New("pagination.page_param is required")
+	}
+	if p.MaxPages < 1 {
+		return errors.New("pagination.max_pages must be at least 1")
+	}
+	if p.PageSize < 0 || p.StartPage < 0 {
+		return errors.New("pagination.page_size and pagination.start_page must not be negative")
+	}
+	if p.SizeParam != "" && p.PageSize == 0 {
+		return errors.New("pagination.page_size is required when size_param is set")
+	}
+	return nil
+}
+
+// UnmarshalYAML 支持 "https://..." 簡寫
+func (s *SourceConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		s.URL = value.Value
+		return nil
+	}
+	type plain SourceConfig
+	return value.Decode((*plain)(s))
+}
+
+// GatherConfig 代理採集配置
+type GatherConfig struct {
+	// ViaPool 池中可用代理足夠時，採集請求經由池中隨機代理發出而非本機 IP
+	ViaPool bool `yaml:"via_pool"`
+	// MinHealthy 啟用 ViaPool 所需的最少可用代理數
+	MinHealthy int `yaml:"min_healthy"`
+	// FallbackDirect 代理全部失敗時退回本機直連
+	FallbackDirect bool `yaml:"fallback_direct"`
+	// DemoteBelow 來源評分（0–1）低於此值時降低採集頻率，0 表示不降頻
+	DemoteBelow float64 `yaml:"demote_below"`
+	// DemoteEvery 降頻來源每隔多少輪採集一次
+	DemoteEvery int `yaml:"demote_every"`
+	// DemoteMinSamples 來源評分所需的最少新候選代理數
+	DemoteMinSamples int64 `yaml:"demote_min_samples"`
+	// BackoffInitial 來源返回 429 或 5xx 後暫停採集的時長，連續出錯時每輪翻倍，0 表示不退避
+	BackoffInitial time.Duration `yaml:"backoff_initial"`
+	// BackoffMax 退避時長的上限
+	BackoffMax time.Duration `yaml:"backoff_max"`
+	// UserAgents 採集請求輪換使用的 User-Agent，每個來源隨機選擇一個；為空時使用內置的常見瀏覽器列表
+	UserAgents []string `yaml:"user_agents"`
+	// Delay 同一來源域名相鄰請求的最小間隔
+	Delay time.Duration `yaml:"delay"`
+	// Jitter 在 delay 之上額外的隨機延遲（0 到 jitter）
+	Jitter time.Duration `yaml:"jitter"`
+	// Parallelism 同一來源域名的最大並發請求數
+	Parallelism int `yaml:"parallelism"`
+	// Domains 按域名覆蓋 delay、jitter、parallelism，按順序匹配第一條
+	Domains []GatherDomainConfig `yaml:"domains"`
+	// Concurrency 同時採集的來源數；同一域名的來源依次採集，以遵守按域名的間隔與並發限制
+	Concurrency int `yaml:"concurrency"`
+	// SourceTimeout 單個來源（含分頁與重試）的採集時限，超時放棄該來源而不影響其他來源
+	SourceTimeout time.Duration `yaml:"source_timeout"`
+}
+
+// GatherDomainConfig 按域名覆蓋的採集間隔與並發
+type GatherDomainConfig struct {
+	Domain      string        `yaml:"domain"` // 主機名通配符（如 *.example.com），帶端口的來源需寫上端口
+	Delay       time.Duration `yaml:"delay"`
+	Jitter      time.Duration `yaml:"jitter"`
+	Parallelism int           `yaml:"parallelism"` // 0 表示沿用 gather.parallelism
+}
+
+// validatePoliteness 檢查採集間隔與並發配置
+func (g *GatherConfig) validatePoliteness() error {
+	if g.Delay < 0 || g.Jitter < 0 {
+		return errors.New("delay and jitter must not be negative")
+	}
+	if g.Parallelism < 1 {
+		return errors.New("parallelism must be at least 1")
+	}
+	for _, d := range g.Domains {
+		if d.Domain == "" {
+			return errors.New("domains: domain is required")
+		}
+		if _, err := path.Match(d.Domain, ""); err != nil {
+			return fmt.Errorf("domains: invalid pattern %q", d.Domain)
+		}
+		if d.Delay < 0 || d.Jitter < 0 {
+			return fmt.Errorf("domains: %s: delay and jitter must not be negative", d.Domain)
+		}
+		if d.Parallelism < 0 {
+			return fmt.Errorf("domains: %s: parallelism must not be negative", d.Domain)
+		}
+	}
+	return nil
+}
+
+// RetryConfig 重試策略：代理轉發、代理驗證和來源採集使用同一套配置項
+type RetryConfig struct {
+	Forward    RetryPolicyConfig `yaml:"forward"`    // 代理轉發（換代理重試，CONNECT 隧道換代理重撥）
+	Validation RetryPolicyConfig `yaml:"validation"` // 代理驗證的每次檢測
+	Fetch      RetryPolicyConfig `yaml:"fetch"`      // 代理列表來源採集（經由代理池時每次重試換代理）
+}
+
+// RetryPolicyConfig 單個場景的重試策略
+type RetryPolicyConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"`    // 最多嘗試次數（含首次）
+	AttemptTimeout time.Duration `yaml:"attempt_timeout"` // 單次嘗試等待響應的時限（0 表示不單獨限制）
+	RetryOn        []string      `yaml:"retry_on"`        // 可重試的錯誤類別：timeout, connect, reset, any
+	RetryStatus    []int         `yaml:"retry_status"`    // 可重試的響應狀態碼
+	HedgeDelay     time.Duration `yaml:"hedge_delay"`     // 超過此時間未響應即並行發起下一次嘗試（0 表示不對沖）
+	Backoff        time.Duration `yaml:"backoff"`         // 重試前等待，按已失敗次數線性增加
+}
+
+// Policy 轉換為 retry.Policy
+func (r RetryPolicyConfig) Policy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:    r.MaxAttempts,
+		AttemptTimeout: r.AttemptTimeout,
+		RetryOn:        r.RetryOn,
+		RetryStatus:    r.RetryStatus,
+		HedgeDelay:     r.HedgeDelay,
+		Backoff:        r.Backoff,
+	}
+}
+
+// ForwardRetry 代理轉發的重試策略
+// 兼容舊配置：設置了 server.response_slo 而未設置 retry.forward.attempt_timeout 時，
+// 按 SLO 作為單次嘗試時限、slo_retries 作為重試次數
+func (c *Config) ForwardRetry() RetryPolicyConfig {
+	r := c.Retry.Forward
+	if c.Server.ResponseSLO <= 0 || r.AttemptTimeout > 0 {
+		return r
+	}
+	r.AttemptTimeout = c.Server.ResponseSLO
+	r.MaxAttempts = max(r.MaxAttempts, 1+c.Server.SLORetries)
+	if !slices.Contains(r.RetryOn, retry.ErrorTimeout) {
+		r.RetryOn = append(slices.Clone(r.RetryOn), retry.ErrorTimeout)
+	}
+	return r
+}
+
+// ServerConfig 代理服務器配置
+type ServerConfig struct {
+	Listen            string        `yaml:"listen"`             // 監聽地址
+	Timeout           time.Duration `yaml:"timeout"`            // 請求總時限，包括讀取響應體（0 表示不限制）
+	RotateInterval    time.Duration `yaml:"rotate_interval"`    // 出口輪換間隔（0 表示每請求輪換）
+	DomainConcurrency int           `yaml:"domain_concurrency"` // 每個目標域名最大並發（0 表示不限制）
+	ResponseSLO       time.Duration `yaml:"response_slo"`       // 上遊響應頭到達時限（0 表示不啟用，舊配置項，見 retry.forward）
+	SLORetries        int           `yaml:"slo_retries"`        // SLO 超時後換代理重試的次數（舊配置項，見 retry.forward）
+	SelectionStrategy string        `yaml:"selection_strategy"` // 代理選擇策略：random, throughput, score
+	BodyBufferBytes   int64         `yaml:"body_buffer_bytes"`  // 重試用請求體內存緩衝上限
+	BodySpoolBytes    int64         `yaml:"body_spool_bytes"`   // 請求體落盤上限（0 表示不落盤，超出內存上限即不重試）
+	BodySpoolDir      string        `yaml:"body_spool_dir"`     // 請求體落盤目錄（空表示系統臨時目錄）
+	// 定期輸出客戶端使用排行的間隔（0 表示不輸出）
+	ClientStatsLogInterval time.Duration `yaml:"client_stats_log_interval"`
+	// 連接、TLS 握手、響應頭及隧道空閒各階段的時限
+	Timeouts TimeoutsConfig `yaml:"timeouts"`
+	// 以 TLS 提供代理端點（HTTPS 代理）
+	TLS ListenerTLSConfig `yaml:"tls"`
+	// 同時打開的客戶端連接數與隧道數（CONNECT 及協議升級）上限，超過時返回 503（0 表示不限制）
+	MaxConnections int `yaml:"max_connections"`
+	MaxTunnels     int `yaml:"max_tunnels"`
+	// 轉發限速
+	Bandwidth BandwidthConfig `yaml:"bandwidth"`
+	// 允許使用代理的客戶端地址（IP 或 CIDR，如 10.0.0.0/8），空表示不限制
+	ClientAllow []string `yaml:"client_allow"`
+	// 出口多樣性約束
+	Diversity DiversityConfig `yaml:"diversity"`
+	// 按（代理，目標域名）記錄近期結果，避開被目標封禁的代理
+	DomainMemory DomainMemoryConfig `yaml:"domain_memory"`
+	// 識別目標的封禁響應，把代理標記為被該域名封禁（需啟用 domain_memory）
+	BanDetection BanDetectionConfig `yaml:"ban_detection"`
+	// 替換發往目標的 User-Agent
+	UserAgent UserAgentConfig `yaml:"user_agent"`
+	// 按會話應用的請求頭模板
+	HeaderProfiles HeaderProfilesConfig `yaml:"header_profiles"`
+	// 嚴格出站清理：刪除 Via、Forwarded 及所有 X- 頭部（hygiene_allow_headers 除外）
+	StrictHygiene       bool     `yaml:"strict_hygiene"`
+	HygieneAllowHeaders []string `yaml:"hygiene_allow_headers"`
+	// X-Forwarded-For 處理方式：append（追加客戶端地址）、replace（只發送客戶端地址）、omit（不發送）
+	ForwardedFor string `yaml:"forwarded_for"`
+	// 預設標籤：請求未通過 X-Proxy-Tag 指定標籤時只選擇帶有這些標籤的代理
+	Tags []string `yaml:"tags"`
+	// 目標主機訪問控制
+	TargetACL TargetACLConfig `yaml:"target_acl"`
+	// 目標主機名解析方式：remote（交給上遊代理解析，避免 DNS 洩漏）、local（本機解析後以 IP 連接）
+	DNSResolution string `yaml:"dns_resolution"`
+	// 匿名模式
+	Anonymity AnonymityConfig `yaml:"anonymity"`
+	// MITM 模式
+	MITM MITMConfig `yaml:"mitm"`
+	// 請求鏡像與篡改檢測
+	Mirror MirrorConfig `yaml:"mirror"`
+	// 在返回給客戶端的響應中添加 X-Dynamic-Proxy-Version 頭
+	VersionHeader bool `yaml:"version_header"`
+	// 在返回給客戶端的響應中添加 X-Request-Id 頭（值與日誌中的 request_id 相同）
+	RequestIDHeader bool `yaml:"request_id_header"`
+	// 按上遊代理緩存的 Transport 數，經由同一代理的請求復用連接（0 表示每個請求新建連接）
+	TransportCacheSize int `yaml:"transport_cache_size"`
+	// 緩存連接的空閒超時
+	UpstreamIdleTimeout time.Duration `yaml:"upstream_idle_timeout"`
+	// 連接 https 上遊代理（與代理之間使用 TLS）時的證書校驗
+	UpstreamProxyTLS ProxyTLSConfig `yaml:"upstream_proxy_tls"`
+}
+
+// ProxyTLSConfig https 上遊代理的證書校驗配置，同時用於驗證和轉發
+type ProxyTLSConfig struct {
+	CAFile             string `yaml:"ca_file"`              // 額外信任的 CA 證書（PEM），空表示只使用系統根證書
+	ServerName         string `yaml:"server_name"`          // 校驗證書使用的主機名（空表示代理 IP）
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // 不校驗代理證書（連接仍加密，但無法防止中間人）
+}
+
+// ListenerTLSConfig 對外服務（代理端點、管理 API）的 TLS 證書配置：cert_file/key_file 與 acme_domains 二選一，都未設置時不啟用
+type ListenerTLSConfig struct {
+	CertFile    string   `yaml:"cert_file"`    // 證書（PEM，可包含中間證書）
+	KeyFile     string   `yaml:"key_file"`     // 私鑰（PEM）
+	ACMEDomains []string `yaml:"acme_domains"` // 經由 ACME 自動申請並續期證書的域名（賬戶設置見頂層 acme）
+}
+
+// ACMEConfig ACME（如 Let's Encrypt）賬戶設置，代理端點與管理 API 共用
+type ACMEConfig struct {
+	Email        string `yaml:"email"`         // 賬戶聯繫郵箱
+	CacheDir     string `yaml:"cache_dir"`     // 證書緩存目錄（空表示數據目錄下的 acme）
+	DirectoryURL string `yaml:"directory_url"` // ACME 服務目錄地址（空表示 Let's Encrypt 正式環境）
+	// HTTPListen 處理 HTTP-01 驗證的監聽地址（如 :80，空表示只使用 TLS-ALPN-01，需要在 443 端口提供服務）
+	HTTPListen string `yaml:"http_listen"`
+}
+
+// Enabled 是否配置了證書來源
+func (t ListenerTLSConfig) Enabled() bool {
+	return t.CertFile != "" || len(t.ACMEDomains) > 0
+}
+
+// validate 檢查證書來源
+func (t ListenerTLSConfig) validate() error {
+	if t.CertFile != "" && len(t.ACMEDomains) > 0 {
+		return errors.New("cert_file and acme_domains are mutually exclusive")
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("cert_file and key_file must be set together")
+	}
+	for _, d := range t.ACMEDomains {
+		if d == "" || strings.ContainsAny(d, "/:* ") {
+			return fmt.Errorf("invalid acme domain %q", d)
+		}
+	}
+	return nil
+}
+
+// TimeoutsConfig 轉發各階段的時限（請求總時限見 server.timeout）
+type TimeoutsConfig struct {
+	Dial           time.Duration `yaml:"dial"`            // 連接上遊代理並完成代理握手
+	TLSHandshake   time.Duration `yaml:"tls_handshake"`   // 與 HTTPS 目標的 TLS 握手
+	ResponseHeader time.Duration `yaml:"response_header"` // 等待響應頭（0 表示不限制）
+	IdleTunnel     time.Duration `yaml:"idle_tunnel"`     // CONNECT 隧道與協議升級連接兩個方向都沒有數據時關閉（0 表示不限制）
+	TunnelLifetime time.Duration `yaml:"tunnel_lifetime"` // CONNECT 隧道與協議升級連接的最長存續時間（0 表示不限制）
+}
+
+// BandwidthConfig 轉發限速配置（每秒字節數，0 表示不限制）：作用於響應體、CONNECT 隧道及升級連接，兩個方向的流量合計
+type BandwidthConfig struct {
+	GlobalBytesPerSecond int64 `yaml:"global_bytes_per_second"` // 所有客戶端合計
+	ClientBytesPerSecond int64 `yaml:"client_bytes_per_second"` // 每個客戶端
+}
+
+// DiversityConfig 出口多樣性約束配置：最近 window 次選擇至少使用 min_networks 個不同 /16 網段
+type DiversityConfig struct {
+	Window      int    `yaml:"window"`       // 統計窗口（請求數，0 表示不啟用）
+	MinNetworks int    `yaml:"min_networks"` // 窗口內最少的不同網段數
+	Scope       string `yaml:"scope"`        // global 或 client
+}
+
+// DomainMemoryConfig 按（代理，目標域名）記錄近期結果：連續失敗 failures 次的代理在 ttl 內視為被該域名封禁，
+// 訪問該域名的請求不選擇它，ttl 後自動解除
+type DomainMemoryConfig struct {
+	TTL      time.Duration `yaml:"ttl"`      // 封禁及記錄的保留時長（0 表示不啟用）
+	Failures int           `yaml:"failures"` // 視為封禁的連續失敗次數
+}
+
+// BanDetectionConfig 目標封禁響應識別配置：狀態碼在 status 中或響應體開頭匹配 body_patterns 的響應表示上遊代理已被目標封禁
+type BanDetectionConfig struct {
+	Status       []int    `yaml:"status"`         // 表示封禁的狀態碼（如 403、429）
+	BodyPatterns []string `yaml:"body_patterns"`  // 匹配響應體開頭的正則（如驗證碼頁面），只檢查文本類響應
+	MaxBodyBytes int64    `yaml:"max_body_bytes"` // 匹配正則時讀取的響應體上限
+	Retries      int      `yaml:"retries"`        // 被封禁後換代理透明重試的次數（0 表示只標記）
+}
+
+// Enabled 是否配置了封禁識別規則
+func (b BanDetectionConfig) Enabled() bool {
+	return len(b.Status) > 0 || len(b.BodyPatterns) > 0
+}
+
+// validate 檢查狀態碼、正則與數值
+func (b BanDetectionConfig) validate() error {
+	for _, code := range b.Status {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid status %d", code)
+		}
+	}
+	for _, pattern := range b.BodyPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid body pattern %q: %w", pattern, err)
+		}
+	}
+	if b.MaxBodyBytes < 0 || b.Retries < 0 {
+		return errors.New("max_body_bytes and retries must not be negative")
+	}
+	return nil
+}
+
+// UserAgentConfig User-Agent 輪換配置：把客戶端的 User-Agent 替換為 list 中的一個（list 為空時生成常見瀏覽器的 User-Agent）
+type UserAgentConfig struct {
+	Rotate string   `yaml:"rotate"` // 輪換範圍：request（每個請求）、client（每個客戶端固定）、proxy（每個出口固定），空表示不替換
+	List   []string `yaml:"list"`   // 候選 User-Agent
+}
+
+// HeaderProfilesConfig 頭部模板配置：scope 範圍內的請求固定使用 profiles 中的同一個模板
+type HeaderProfilesConfig struct {
+	Scope    string                `yaml:"scope"`    // request、client 或 proxy
+	Profiles []HeaderProfileConfig `yaml:"profiles"` // 為空表示不啟用
+}
+
+// HeaderProfileConfig 命名的頭部模板
+type HeaderProfileConfig struct {
+	Name    string              `yaml:"name"`
+	Headers []HeaderFieldConfig `yaml:"headers"`
+}
+
+// HeaderFieldConfig 頭部模板中的一個頭部
+type HeaderFieldConfig struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// validate 檢查範圍與模板
+func (h HeaderProfilesConfig) validate() error {
+	switch h.Scope {
+	case "request", "client", "proxy":
+	default:
+		return fmt.Errorf("unknown scope %q", h.Scope)
+	}
+	names := make(map[string]bool, len(h.Profiles))
+	for i, p := range h.Profiles {
+		if p.Name == "" {
+			return fmt.Errorf("profile %d: name is required", i)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate profile %q", p.Name)
+		}
+		names[p.Name] = true
+		if len(p.Headers) == 0 {
+			return fmt.Errorf("profile %q: no headers", p.Name)
+		}
+		for _, f := range p.Headers {
+			if f.Name == "" {
+				return fmt.Errorf("profile %q: header name is required", p.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// AnonymityConfig 匿名模式配置：刪除發往目標的請求中可識別客戶端的頭部（X-Forwarded-For、Via、Forwarded 等）
+// 及名稱匹配通配符（path.Match 語法）的頭部和 Cookie
+type AnonymityConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	StripHeaders []string `yaml:"strip_headers"` // 頭部名稱通配符，不區分大小寫（如 X-Client-*）
+	StripCookies []string `yaml:"strip_cookies"` // Cookie 名稱通配符，區分大小寫（如 _ga*）
+}
+
+// validate 檢查通配符
+func (a *AnonymityConfig) validate() error {
+	for _, pattern := range append(slices.Clone(a.StripHeaders), a.StripCookies...) {
+		if pattern == "" {
+			return errors.New("empty pattern")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// TargetACLConfig 目標主機訪問控制配置：規則為精確主機名、域名後綴（.example.com 或 *.example.com）或 IP/CIDR；
+// 拒絕列表優先，允許列表非空時只允許匹配的目標，預設拒絕私有、環回、鏈路本地等地址（防止 SSRF）
+type TargetACLConfig struct {
+	Allow        []string `yaml:"allow"`         // 允許的目標（空表示不限制）
+	Deny         []string `yaml:"deny"`          // 拒絕的目標
+	AllowPrivate bool     `yaml:"allow_private"` // 允許訪問私有、環回、鏈路本地等地址
+}
+
+// validate 檢查 CIDR 規則
+func (t *TargetACLConfig) validate() error {
+	for _, rule := range append(slices.Clone(t.Allow), t.Deny...) {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			return errors.New("empty rule")
+		}
+		if strings.Contains(rule, "/") {
+			if _, err := netip.ParsePrefix(rule); err != nil {
+				return fmt.Errorf("invalid CIDR %q", rule)
+			}
+		}
+	}
+	return nil
+}
+
+// validateClientRule 檢查客戶端允許列表中的一條規則（IP 或 CIDR）
+func validateClientRule(rule string) error {
+	rule = strings.TrimSpace(rule)
+	if strings.Contains(rule, "/") {
+		if _, err := netip.ParsePrefix(rule); err != nil {
+			return fmt.Errorf("invalid CIDR %q", rule)
+		}
+		return nil
+	}
+	if _, err := netip.ParseAddr(rule); err != nil {
+		return fmt.Errorf("invalid IP %q", rule)
+	}
+	return nil
+}
+
+// MITMConfig MITM 模式配置：用本地 CA 解密 CONNECT 隧道，使頭部改寫、匿名處理和日誌同樣作用於 HTTPS 請求
+type MITMConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	CACert  string `yaml:"ca_cert"` // CA 證書路徑（空表示數據目錄下的 mitm-ca.pem），不存在時自動生成
+	CAKey   string `yaml:"ca_key"`  // CA 私鑰路徑（空表示數據目錄下的 mitm-ca-key.pem）
+}
+
+// MirrorConfig 請求鏡像配置：按比例將 GET 請求經由另一個代理再發送一次並比較響應，禁用篡改內容的代理
+type MirrorConfig struct {
+	Rate         float64 `yaml:"rate"`           // 鏡像的請求比例（0~1，0 表示不啟用）
+	MaxBodyBytes int64   `yaml:"max_body_bytes"` // 參與比較的響應體上限，超出的響應不比較
+}
+
+// AdminConfig 管理 API 配置
+type AdminConfig struct {
+	Listen string `yaml:"listen"` // 管理 API 監聽地址（空表示不啟動）
+	// ReadyMinHealthy /readyz 報告就緒所需的最少可用代理數（0 表示數據庫可用即就緒）
+	ReadyMinHealthy int `yaml:"ready_min_healthy"`
+	// 以 HTTPS 提供管理 API
+	TLS ListenerTLSConfig `yaml:"tls"`
+	// Token 非空時集群接口和修改狀態的接口需要 Authorization: Bearer <token>；集群成員之間以此令牌互相請求，需設置相同的值
+	Token string `yaml:"token"`
+}
+
+// PoolConfig 命名代理池：在獨立端口上提供只使用滿足條件的代理的輪換服務，其餘行為與 server 相同
+type PoolConfig struct {
+	Name      string   `yaml:"name"`      // 池名稱（如 elite-us）
+	Listen    string   `yaml:"listen"`    // 監聽地址
+	Sites     []string `yaml:"sites"`     // 代理必須通過探測的站點標籤
+	Tags      []string `yaml:"tags"`      // 代理必須帶有的標籤（請求的 X-Proxy-Tag 只能進一步收窄）
+	Countries []string `yaml:"countries"` // 允許的國家代碼（如 US）
+	Anonymity []string `yaml:"anonymity"` // 允許的匿名級別：transparent, anonymous, elite
+	Protocols []string `yaml:"protocols"` // 允許的代理協議：http, https, socks4, socks5
+	Google    bool     `yaml:"google"`    // 只使用能訪問 Google 搜索的代理
+}
+
+// validate 檢查命名代理池配置
+func (p *PoolConfig) validate() error {
+	if p.Listen == "" {
+		return errors.New("listen is required")
+	}
+	for _, a := range p.Anonymity {
+		switch strings.ToLower(a) {
+		case "transparent", "anonymous", "elite":
+		default:
+			return fmt.Errorf("unknown anonymity %q (want transparent, anonymous or elite)", a)
+		}
+	}
+	for _, proto := range p.Protocols {
+		switch strings.ToLower(proto) {
+		case "http", "https", "socks4", "socks5":
+		default:
+			return fmt.Errorf("unknown protocol %q (want http, https, socks4 or socks5)", proto)
+		}
+	}
+	return nil
+}
+
+// DNSConfig DNS 導出配置（內置 DNS 服務器與 -export-zone 區域文件）
+type DNSConfig struct {
+	Listen     string        `yaml:"listen"`      // 內置 DNS 服務器監聽地址（UDP 與 TCP，空表示不啟動，僅 -serve 模式）
+	Zone       string        `yaml:"zone"`        // 區域名
+	TTL        time.Duration `yaml:"ttl"`         // 記錄 TTL
+	MaxAnswers int           `yaml:"max_answers"` // 每次應答最多返回的代理記錄數（多於此數時隨機選取）
+	Refresh    time.Duration `yaml:"refresh"`     // 從數據庫重建區域的間隔
+	Tags       []string      `yaml:"tags"`        // 只發佈帶有所有這些標籤的代理（空表示不限制）
+}
+
+// validate 檢查 DNS 導出配置
+func (d *DNSConfig) validate() error {
+	zone := strings.TrimSuffix(d.Zone, ".")
+	if zone == "" {
+		return errors.New("zone is required")
+	}
+	for _, label := range strings.Split(zone, ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("invalid zone name %q", d.Zone)
+		}
+	}
+	if d.TTL < time.Second {
+		return errors.New("ttl must be at least 1s")
+	}
+	if d.MaxAnswers < 1 {
+		return errors.New("max_answers must be at least 1")
+	}
+	if d.Refresh <= 0 {
+		return errors.New("refresh must be positive")
+	}
+	return nil
+}
+
+// CleanupConfig 清理任務配置
+type CleanupConfig struct {
+	MaxAge     time.Duration `yaml:"max_age"`     // 最後一次通過驗證（從未驗證的為入庫時間）超過此時長的代理被刪除
+	Quarantine time.Duration `yaml:"quarantine"`  // 被禁用的代理保留的時長，期間照常重新驗證（0 表示立即刪除）
+	MaxProxies int           `yaml:"max_proxies"` // 代理總數上限，超出時優先淘汰禁用的、其次最久未被確認可用的代理（0 表示不限制）
+	MinScore   float64       `yaml:"min_score"`   // 當前健康評分低於此值的代理被刪除，不等待隔離期（0 表示不按評分刪除）
+}
+
+// HistoryConfig 代理池統計快照：定期記錄總數、可用數、平均延遲和按國家的數量，用於觀察長期趨勢
+type HistoryConfig struct {
+	Interval  time.Duration `yaml:"interval"`  // 記錄間隔（0 表示不記錄）
+	Retention time.Duration `yaml:"retention"` // 快照保留時長，只對之後記錄的快照生效
+}
+
+// EventsConfig 事件記錄：代理新增、禁用、恢復、刪除，採集開始與結束，配置重新加載
+type EventsConfig struct {
+	Capacity int `yaml:"capacity"` // 保留的事件數，超出時刪除最舊的（0 表示不記錄）
+}
+
+// TelemetryConfig 以 OTLP/HTTP 導出追蹤和指標，接入現有的可觀測性系統（OpenTelemetry Collector、Jaeger、Tempo 等）
+type TelemetryConfig struct {
+	Endpoint       string            `yaml:"otlp_endpoint"`   // OTLP/HTTP 地址（如 http://otel-collector:4318），為空表示不導出
+	Headers        map[string]string `yaml:"headers"`         // 隨導出請求發送的頭部（如認證令牌）
+	Traces         bool              `yaml:"traces"`          // 導出追蹤
+	Metrics        bool              `yaml:"metrics"`         // 導出指標（與管理端 /metrics 相同的指標）
+	SampleRatio    float64           `yaml:"sample_ratio"`    // 新追蹤的採樣比例（0 至 1），客戶端已採樣的請求總是記錄
+	MetricInterval time.Duration     `yaml:"metric_interval"` // 指標導出間隔
+	ServiceName    string            `yaml:"service_name"`    // 資源屬性 service.name
+}
+
+// validate 檢查導出配置
+func (c TelemetryConfig) validate() error {
+	if c.Endpoint != "" {
+		if err := validateHTTPURL(c.Endpoint); err != nil {
+			return err
+		}
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return errors.New("sample_ratio must be between 0 and 1")
+	}
+	if c.MetricInterval <= 0 {
+		return errors.New("metric_interval must be positive")
+	}
+	return nil
+}
+
+// ChatConfig 從 Telegram / Discord 頻道拉取消息，提取其中發佈的代理並加入待驗證隊列
+type ChatConfig struct {
+	Interval time.Duration     `yaml:"interval"` // 拉取間隔（0 表示不拉取）
+	Tags     []string          `yaml:"tags"`     // 給頻道中採集到的代理添加的標籤
+	Telegram ChatChannelConfig `yaml:"telegram"`
+	Discord  ChatChannelConfig `yaml:"discord"`
+}
+
+// ChatChannelConfig 一種聊天平台的機器人與頻道，未設置 bot_token 時不拉取
+type ChatChannelConfig struct {
+	BotToken string   `yaml:"bot_token"`
+	Channels []string `yaml:"channels"` // Telegram 為頻道 ID 或 @用戶名，Discord 為頻道 ID
+	APIURL   string   `yaml:"api_url"`  // 覆蓋 API 地址（如自建的 Telegram Bot API 服務）
+}
+
+// validate 檢查平台配置
+func (c ChatChannelConfig) validate() error {
+	if c.BotToken != "" && len(c.Channels) == 0 {
+		return errors.New("channels are required when bot_token is set")
+	}
+	if c.APIURL != "" {
+		return validateHTTPURL(c.APIURL)
+	}
+	return nil
+}
+
+// ScheduleOff 定時任務的 cron 表達式設為此值時禁用該任務
+const ScheduleOff = "off"
+
+// ScheduleConfig 定時任務（cron 模式）的 cron 表達式，支持標準五段式和 @every 1h 等描述符；
+// 設為 off 的任務既不定時運行，也不在啟動時運行
+type ScheduleConfig struct {
+	Health  string `yaml:"health"`  // 重新驗證到期的代理
+	Cleanup string `yaml:"cleanup"` // 清理禁用和過期的代理
+	Gather  string `yaml:"gather"`  // 採集代理列表
+}
+
+// validate 檢查 cron 表達式
+func (s *ScheduleConfig) validate() error {
+	for _, job := range []struct{ name, spec string }{
+		{"health", s.Health},
+		{"cleanup", s.Cleanup},
+		{"gather", s.Gather},
+	} {
+		if job.spec == ScheduleOff {
+			continue
+		}
+		if job.spec == "" {
+			return fmt.Errorf("%s is empty (use %q to disable the job)", job.name, ScheduleOff)
+		}
+		if _, err := cron.ParseStandard(job.spec); err != nil {
+			return fmt.Errorf("%s: invalid cron expression %q: %w", job.name, job.spec, err)
+		}
+	}
+	return nil
+}
+
+// LogConfig 日誌配置
+type LogConfig struct {
+	Level      string            `yaml:"level"`      // 全局日誌級別
+	Format     string            `yaml:"format"`     // 輸出格式：text, json
+	Components map[string]string `yaml:"components"` // 按組件覆蓋的日誌級別（如 validator: trace）
+	File       string            `yaml:"file"`       // 日誌文件（空表示輸出到標準錯誤，作為 Windows 服務運行時寫入平台日誌目錄）
+}
+
+// DBConfig 數據庫配置
+type DBConfig struct {
+	Path string `yaml:"path"` // Badger 數據庫目錄（空表示平台數據目錄，工作目錄下已有 proxy_badger_db 時沿用）
+	// Recovery 打開失敗時的恢復模式：off, repair（重試一次，預設）, reset（仍失敗時備份目錄並以空數據庫啟動，需顯式設置）
+	Recovery string `yaml:"recovery"`
+	// EncryptionKey 靜態加密密鑰（AES，16、24 或 32 字節，寫作 hex 或 base64），留空表示不加密；
+	// 建議通過環境變量 DYNAMIC_PROXY_DB_ENCRYPTION_KEY 設置而不是寫入配置文件
+	EncryptionKey string `yaml:"encryption_key"`
+	// EncryptionKeyFile 從文件讀取加密密鑰（內容為 hex 或 base64，與 encryption_key 格式相同），兩者二選一
+	EncryptionKeyFile string `yaml:"encryption_key_file"`
+}
+
+// Key 返回數據庫加密密鑰，未配置時返回 nil
+func (d DBConfig) Key() ([]byte, error) {
+	if d.EncryptionKey != "" {
+		return decodeKey([]byte(d.EncryptionKey))
+	}
+	if d.EncryptionKeyFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(d.EncryptionKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+	}
+	key, err := decodeKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", d.EncryptionKeyFile, err)
+	}
+	return key, nil
+}
+
+// decodeKey 解碼 hex 或 base64 形式的密鑰並檢查長度
+func decodeKey(text []byte) ([]byte, error) {
+	s := strings.TrimSpace(string(text))
+	if key, err := hex.DecodeString(s); err == nil && validKeyLen(len(key)) {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && validKeyLen(len(key)) {
+		return key, nil
+	}
+	return nil, errors.New("encryption key must be 16, 24 or 32 bytes written as hex or base64")
+}
+
+// validKeyLen AES-128/192/256 的密鑰長度
+func validKeyLen(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+// isHTTPURL 是否為帶主機的 http 或 https URL
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// ReplicaConfig 只讀副本：從主實例的管理 API 同步代理池，自身不採集、不驗證、不清理（僅 -serve 模式）
+type ReplicaConfig struct {
+	Primary  string        `yaml:"primary"`  // 主實例管理 API 地址（如 http://10.0.0.1:9090），空表示不作為副本運行
+	Interval time.Duration `yaml:"interval"` // 同步間隔
+}
+
+// ClusterConfig 集群模式：定期從其他實例拉取它們新驗證的代理和驗證結果合併到本地，分擔驗證工作
+type ClusterConfig struct {
+	Peers    []string      `yaml:"peers"`    // 其他實例的管理 API 地址（如 http://10.0.0.2:9090），空表示不啟用
+	Interval time.Duration `yaml:"interval"` // 拉取間隔
+	// LeaderElection 只由持有租約的成員（領導者）運行採集和健康檢查任務，避免各實例重複請求來源；
+	// 租約由包括本實例在內的多數成員授予，記錄在各成員的數據庫中
+	LeaderElection bool `yaml:"leader_election"`
+	// LeaseTTL 租約的有效期，領導者每隔三分之一有效期續約；領導者停止響應後最多經過此時間由其他成員接替
+	LeaseTTL time.Duration `yaml:"lease_ttl"`
+}
+
+// NotifyConfig 代理池事件通知配置
+type NotifyConfig struct {
+	PoolLowThreshold int             `yaml:"pool_low_threshold"` // 健康代理數低於此值時通知（0 表示只在池為空時通知）
+	Webhooks         []WebhookConfig `yaml:"webhooks"`
+}
+
+// WebhookConfig 通知目標配置
+type WebhookConfig struct {
+	Type   string   `yaml:"type"`    // generic, slack, telegram
+	URL    string   `yaml:"url"`     // Webhook 地址（telegram 可選，覆蓋 Bot API 地址）
+	Token  string   `yaml:"token"`   // telegram Bot Token
+	ChatID string   `yaml:"chat_id"` // telegram 會話 ID
+	Events []string `yaml:"events"`  // 訂閱的事件（空表示全部）
+}
+
+// ValidationConfig 代理驗證策略配置
+type ValidationConfig struct {
+	TestURLs          []string         `yaml:"test_urls"`          // 通用檢測 URL（期望返回 204）
+	Timeout           time.Duration    `yaml:"timeout"`            // 單次檢測超時
+	RequiredSuccesses int              `yaml:"required_successes"` // 需要成功的檢測次數
+	RequireHTTPS      bool             `yaml:"require_https"`      // 是否要求能訪問 HTTPS 目標
+	Targets           []string         `yaml:"targets"`            // 用戶指定目標，代理必須能訪問
+	ProbeTargets      []ProbeTarget    `yaml:"probe_targets"`      // 站點探測目標，通過的站點記錄為代理標籤
+	SpeedTestURL      string           `yaml:"speed_test_url"`     // 測速下載地址（空表示不測速）
+	Integrity         []IntegrityCheck `yaml:"integrity"`          // 內容完整性檢測，校驗和不一致的代理標記為篡改內容
+	QueueRate         float64          `yaml:"queue_rate"`         // 待驗證隊列每秒最多開始驗證的代理數
+	QueueWorkers      int              `yaml:"queue_workers"`      // 待驗證隊列同時驗證的代理數上限
+	RecheckMin        time.Duration    `yaml:"recheck_min"`        // 新代理或不穩定代理的重新驗證間隔
+	RecheckMax        time.Duration    `yaml:"recheck_max"`        // 長期穩定代理的重新驗證間隔上限
+	GoogleProbeURL    string           `yaml:"google_probe_url"`   // Google 搜索探測地址，判斷代理是否被 Google 攔截（空表示不探測）
+	JudgeURL          string           `yaml:"judge_url"`          // 判定服務地址（返回請求來源地址和請求頭），用於檢測出口地址和匿名級別
+	KnownBadTTL       time.Duration    `yaml:"known_bad_ttl"`      // 首次驗證即失敗的候選代理在此時長內再次採集到時跳過驗證（0 表示不跳過）
+	ProbeRate         float64          `yaml:"probe_rate"`         // 所有驗證每秒最多發出的檢測請求數（0 表示不限制）
+	ProbeTargetRate   float64          `yaml:"probe_target_rate"`  // 每個檢測目標網段（/24）每秒最多接收的檢測請求數（0 表示不限制）
+	ProbeJitter       time.Duration    `yaml:"probe_jitter"`       // 每次檢測前的隨機延遲上限（0 表示不延遲）
+	ScoreHalfLife     time.Duration    `yaml:"score_half_life"`    // 健康評分的衰減半衰期（0 表示不衰減）
+	ScoreExclude      float64          `yaml:"score_exclude"`      // 驗證後健康評分低於此值的代理被禁用，不參與選擇
+}
+
+// ProbeTarget 站點探測目標配置
+type ProbeTarget struct {
+	Name         string `yaml:"name"`          // 站點標籤（如 google）
+	URL          string `yaml:"url"`           // 探測 URL
+	ExpectStatus int    `yaml:"expect_status"` // 期望狀態碼（0 表示 < 400 即可）
+}
+
+// IntegrityCheck 內容完整性檢測配置
+type IntegrityCheck struct {
+	URL    string `yaml:"url"`    // 靜態資源地址
+	SHA256 string `yaml:"sha256"` // 期望的響應體 SHA-256（十六進制）
+}
+
+// HeaderRuleConfig 頭部改寫規則配置
+type HeaderRuleConfig struct {
+	Domain    string `yaml:"domain"`    // 目標域名（後綴匹配，空表示所有域名）
+	Direction string `yaml:"direction"` // request 或 response
+	Action    string `yaml:"action"`    // add, set, remove, replace
+	Name      string `yaml:"name"`      // 頭部名稱
+	Value     string `yaml:"value"`     // 新值或替換模板
+	Match     string `yaml:"match"`     // 值匹配正則
+}
+
+// Default 返回預設配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Listen:            ":8080",
+			Timeout:           30 * time.Second,
+			SLORetries:        2,
+			SelectionStrategy: "random",
+			BodyBufferBytes:   1 << 20,
+
+			ClientStatsLogInterval: 10 * time.Minute,
+			Timeouts:               TimeoutsConfig{Dial: 30 * time.Second, TLSHandshake: 10 * time.Second, IdleTunnel: 5 * time.Minute},
+			Diversity:              DiversityConfig{Scope: "global"},
+			DomainMemory:           DomainMemoryConfig{Failures: 3},
+			BanDetection:           BanDetectionConfig{MaxBodyBytes: 64 << 10},
+			HeaderProfiles:         HeaderProfilesConfig{Scope: "proxy"},
+			ForwardedFor:           "append",
+			DNSResolution:          "remote",
+			Mirror:                 MirrorConfig{MaxBodyBytes: 1 << 20},
+			TransportCacheSize:     64,
+			UpstreamIdleTimeout:    90 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		DB: DBConfig{
+			Recovery: "repair",
+		},
+		Admin: AdminConfig{ReadyMinHealthy: 1},
+		DNS: DNSConfig{
+			Zone:       "proxies.internal.",
+			TTL:        60 * time.Second,
+			MaxAnswers: 16,
+			Refresh:    time.Minute,
+		},
+		Sources: []SourceConfig{
+			// group 1
+			{URL: "https://free-proxy-list.net/en/"},
+			{URL: "https://free-proxy-list.net/en/socks-proxy.html"},
+			{URL: "https://free-proxy-list.net/en/uk-proxy.html"},
+			{URL: "https://free-proxy-list.net/en/ssl-proxy.html"},
+			{URL: "https://free-proxy-list.net/en/anonymous-proxy.html"},
+			{URL: "https://free-proxy-list.net/en/google-proxy.html"},
+			// group 2
+			{URL: "https://api.proxyscrape.com/v4/free-proxy-list/get?request=get_proxies&proxy_format=protocolipport&format=json"},
+			{
+				URL: "https://proxylist.geonode.com/api/proxy-list?sort_by=lastChecked&sort_type=desc",
+				Pagination: &PaginationConfig{
+					PageParam:   "page",
+					SizeParam:   "limit",
+					PageSize:    500,
+					StartPage:   1,
+					MaxPages:    10,
+					StopOnEmpty: true,
+				},
+			},
+			{URL: "https://cdn.jsdelivr.net/gh/proxifly/free-proxy-list@main/proxies/all/data.json"},
+		},
+
+		Gather: GatherConfig{
+			MinHealthy:       20,
+			FallbackDirect:   true,
+			DemoteEvery:      4,
+			DemoteMinSamples: 200,
+			BackoffInitial:   4 * time.Hour,
+			BackoffMax:       48 * time.Hour,
+			Delay:            time.Second,
+			Jitter:           2 * time.Second,
+			Parallelism:      1,
+			Concurrency:      4,
+			SourceTimeout:    2 * time.Minute,
+		},
+		Retry: RetryConfig{
+			Forward: RetryPolicyConfig{
+				MaxAttempts: 1,
+				RetryOn:     []string{retry.ErrorTimeout},
+			},
+			Validation: RetryPolicyConfig{
+				MaxAttempts: 1,
+			},
+			Fetch: RetryPolicyConfig{
+				MaxAttempts: 3,
+				RetryOn:     []string{retry.ErrorTimeout, retry.ErrorConnect, retry.ErrorReset},
+				RetryStatus: []int{429, 500, 502, 503, 504},
+				Backoff:     2 * time.Second,
+			},
+		},
+		Cleanup: CleanupConfig{
+			MaxAge:   72 * time.Hour,
+			MinScore: 0.1,
+		},
+		Replica: ReplicaConfig{
+			Interval: 30 * time.Second,
+		},
+		Cluster: ClusterConfig{
+			Interval: 30 * time.Second,
+			LeaseTTL: time.Minute,
+		},
+		History: HistoryConfig{
+			Interval:  5 * time.Minute,
+			Retention: 30 * 24 * time.Hour,
+		},
+		Events: EventsConfig{Capacity: 10000},
+		Chat:   ChatConfig{Interval: 10 * time.Minute},
+		Telemetry: TelemetryConfig{
+			Traces:         true,
+			Metrics:        true,
+			SampleRatio:    1,
+			MetricInterval: time.Minute,
+			ServiceName:    "dynamic-proxy",
+		},
+		Schedule: ScheduleConfig{
+			Health:  "*/15 * * * *",
+			Cleanup: "30 */1 * * *",
+			Gather:  "0 */2 * * *",
+		},
+		Validation: ValidationConfig{
+			TestURLs: []string{
+				"https://www.google.com/generate_204",
+				"http://www.gstatic.com/generate_204",
+				"https://connectivitycheck.gstatic.com/generate_204",
+				"http://edge-http.microsoft.com/captiveportal/generate_204",
+				"http://cp.cloudflare.com/generate_204",
+			},
+			Timeout:           10 * time.Second,
+			RequiredSuccesses: 1,
+			QueueRate:         5,
+			QueueWorkers:      10,
+			RecheckMin:        15 * time.Minute,
+			RecheckMax:        12 * time.Hour,
+			GoogleProbeURL:    "https://www.google.com/search?q=weather",
+			JudgeURL:          "http://httpbin.org/get",
+			KnownBadTTL:       6 * time.Hour,
+			ProbeTargetRate:   10,
+			ProbeJitter:       500 * time.Millisecond,
+			ScoreHalfLife:     24 * time.Hour,
+			ScoreExclude:      0.4,
+		},
+	}
+}
+
+// Load 加載配置文件並應用環境變量覆蓋（見 ApplyEnv），path 為空時只使用預設配置和環境變量
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.ApplyEnv(lookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		if path == "" {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate 檢查配置的基本有效性
+func (c *Config) Validate() error {
+	v := c.Validation
+	if len(v.TestURLs) == 0 && len(v.Targets) == 0 {
+		return errors.New("validation: at least one test_url or target is required")
+	}
+	if v.Timeout <= 0 {
+		return errors.New("validation: timeout must be positive")
+	}
+	if v.RequiredSuccesses < 1 {
+		return errors.New("validation: required_successes must be at least 1")
+	}
+	for _, u := range append(append([]string{}, v.TestURLs...), v.Targets...) {
+		if err := validateHTTPURL(u); err != nil {
+			return fmt.Errorf("validation: %w", err)
+		}
+	}
+	seenProbe := make(map[string]bool)
+	for _, t := range v.ProbeTargets {
+		if t.Name == "" {
+			return errors.New("validation: probe_targets name is required")
+		}
+		if seenProbe[strings.ToLower(t.Name)] {
+			return fmt.Errorf("validation: duplicate probe target %q", t.Name)
+		}
+		seenProbe[strings.ToLower(t.Name)] = true
+		if err := validateHTTPURL(t.URL); err != nil {
+			return fmt.Errorf("validation: probe target %s: %w", t.Name, err)
+		}
+	}
+	if v.SpeedTestURL != "" {
+		if err := validateHTTPURL(v.SpeedTestURL); err != nil {
+			return fmt.Errorf("validation: speed_test_url: %w", err)
+		}
+	}
+	if v.GoogleProbeURL != "" {
+		if err := validateHTTPURL(v.GoogleProbeURL); err != nil {
+			return fmt.Errorf("validation: google_probe_url: %w", err)
+		}
+	}
+	if v.KnownBadTTL < 0 {
+		return errors.New("validation: known_bad_ttl must not be negative")
+	}
+	if v.ProbeRate < 0 || v.ProbeTargetRate < 0 {
+		return errors.New("validation: probe_rate and probe_target_rate must not be negative")
+	}
+	if v.ProbeJitter < 0 {
+		return errors.New("validation: probe_jitter must not be negative")
+	}
+	if v.ScoreHalfLife < 0 {
+		return errors.New("validation: score_half_life must not be negative")
+	}
+	if v.ScoreExclude < 0 || v.ScoreExclude > 1 {
+		return errors.New("validation: score_exclude must be between 0 and 1")
+	}
+	if v.JudgeURL != "" {
+		if err := validateHTTPURL(v.JudgeURL); err != nil {
+			return fmt.Errorf("validation: judge_url: %w", err)
+		}
+	}
+	for _, check := range v.Integrity {
+		if err := validateHTTPURL(check.URL); err != nil {
+			return fmt.Errorf("validation: integrity: %w", err)
+		}
+		if sum, err := hex.DecodeString(check.SHA256); err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("validation: integrity %s: sha256 must be 64 hex characters", check.URL)
+		}
+	}
+	if v.RequireHTTPS && !hasHTTPS(v.TestURLs) && !hasHTTPS(v.Targets) {
+		return errors.New("validation: require_https needs at least one https test_url or target")
+	}
+	if v.QueueRate <= 0 {
+		return errors.New("validation: queue_rate must be positive")
+	}
+	if v.QueueWorkers < 1 {
+		return errors.New("validation: queue_workers must be at least 1")
+	}
+	if v.RecheckMin <= 0 || v.RecheckMax < v.RecheckMin {
+		return errors.New("validation: recheck_min must be positive and recheck_max at least recheck_min")
+	}
+	if c.Server.Timeout < 0 {
+		return errors.New("server: timeout must not be negative")
+	}
+	if t := c.Server.Timeouts; t.Dial < 0 || t.TLSHandshake < 0 || t.ResponseHeader < 0 || t.IdleTunnel < 0 || t.TunnelLifetime < 0 {
+		return errors.New("server: timeouts must not be negative")
+	}
+	if err := c.Server.TLS.validate(); err != nil {
+		return fmt.Errorf("server: tls: %w", err)
+	}
+	if c.Server.MaxConnections < 0 || c.Server.MaxTunnels < 0 {
+		return errors.New("server: max_connections and max_tunnels must not be negative")
+	}
+	if c.Server.Bandwidth.GlobalBytesPerSecond < 0 || c.Server.Bandwidth.ClientBytesPerSecond < 0 {
+		return errors.New("server: bandwidth limits must not be negative")
+	}
+	for _, rule := range c.Server.ClientAllow {
+		if err := validateClientRule(rule); err != nil {
+			return fmt.Errorf("server: client_allow: %w", err)
+		}
+	}
+	if c.Server.DomainConcurrency < 0 {
+		return errors.New("server: domain_concurrency must not be negative")
+	}
+	if c.Server.ResponseSLO < 0 || c.Server.SLORetries < 0 {
+		return errors.New("server: response_slo and slo_retries must not be negative")
+	}
+	if c.Server.BodyBufferBytes < 0 || c.Server.BodySpoolBytes < 0 {
+		return errors.New("server: body_buffer_bytes and body_spool_bytes must not be negative")
+	}
+	if c.Server.TransportCacheSize < 0 {
+		return errors.New("server: transport_cache_size must not be negative")
+	}
+	if c.Server.UpstreamIdleTimeout <= 0 {
+		return errors.New("server: upstream_idle_timeout must be positive")
+	}
+	switch c.Server.SelectionStrategy {
+	case "random", "throughput", "score":
+	default:
+		return fmt.Errorf("server: unknown selection_strategy %q", c.Server.SelectionStrategy)
+	}
+	switch c.Server.ForwardedFor {
+	case "append", "replace", "omit":
+	default:
+		return fmt.Errorf("server: unknown forwarded_for %q (want append, replace or omit)", c.Server.ForwardedFor)
+	}
+	switch c.Server.DNSResolution {
+	case "remote", "local":
+	default:
+		return fmt.Errorf("server: unknown dns_resolution %q (want remote or local)", c.Server.DNSResolution)
+	}
+	if m := c.Server.Mirror; m.Rate < 0 || m.Rate > 1 || m.MaxBodyBytes <= 0 {
+		return errors.New("server: mirror rate must be between 0 and 1 and max_body_bytes positive")
+	}
+	if (c.Server.MITM.CACert == "") != (c.Server.MITM.CAKey == "") {
+		return errors.New("server: mitm: ca_cert and ca_key must be set together")
+	}
+	if err := c.Server.TargetACL.validate(); err != nil {
+		return fmt.Errorf("server: target_acl: %w", err)
+	}
+	if err := c.Server.Anonymity.validate(); err != nil {
+		return fmt.Errorf("server: anonymity: %w", err)
+	}
+	d := c.Server.Diversity
+	if d.Window < 0 || d.MinNetworks < 0 {
+		return errors.New("server: diversity window and min_networks must not be negative")
+	}
+	if d.MinNetworks > d.Window {
+		return errors.New("server: diversity min_networks must not exceed window")
+	}
+	switch d.Scope {
+	case "global", "client":
+	default:
+		return fmt.Errorf("server: unknown diversity scope %q", d.Scope)
+	}
+	if dm := c.Server.DomainMemory; dm.TTL < 0 || dm.Failures < 1 {
+		return errors.New("server: domain_memory ttl must not be negative and failures must be positive")
+	}
+	if err := c.Server.BanDetection.validate(); err != nil {
+		return fmt.Errorf("server: ban_detection: %w", err)
+	}
+	switch c.Server.UserAgent.Rotate {
+	case "", "request", "client", "proxy":
+	default:
+		return fmt.Errorf("server: unknown user_agent rotate scope %q", c.Server.UserAgent.Rotate)
+	}
+	if slices.Contains(c.Server.UserAgent.List, "") {
+		return errors.New("server: user_agent list must not contain empty entries")
+	}
+	if err := c.Server.HeaderProfiles.validate(); err != nil {
+		return fmt.Errorf("server: header_profiles: %w", err)
+	}
+	if c.Server.BanDetection.Enabled() && c.Server.DomainMemory.TTL <= 0 {
+		return errors.New("server: ban_detection requires domain_memory.ttl")
+	}
+	if err := c.Admin.TLS.validate(); err != nil {
+		return fmt.Errorf("admin: tls: %w", err)
+	}
+	if c.ACME.HTTPListen != "" && len(c.Server.TLS.ACMEDomains) == 0 && len(c.Admin.TLS.ACMEDomains) == 0 {
+		return errors.New("acme: http_listen requires acme_domains in server.tls or admin.tls")
+	}
+	if c.Admin.ReadyMinHealthy < 0 {
+		return errors.New("admin: ready_min_healthy must not be negative")
+	}
+	if c.Notify.PoolLowThreshold < 0 {
+		return errors.New("notify: pool_low_threshold must not be negative")
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("log: unknown format %q", c.Log.Format)
+	}
+	switch c.DB.Recovery {
+	case "off", "repair", "reset":
+	default:
+		return fmt.Errorf("db: unknown recovery mode %q (want off, repair or reset)", c.DB.Recovery)
+	}
+	if c.DB.EncryptionKey != "" {
+		if c.DB.EncryptionKeyFile != "" {
+			return errors.New("db: encryption_key and encryption_key_file are mutually exclusive")
+		}
+		if _, err := decodeKey([]byte(c.DB.EncryptionKey)); err != nil {
+			return fmt.Errorf("db: %w", err)
+		}
+	}
+	if c.Replica.Primary != "" {
+		if !isHTTPURL(c.Replica.Primary) {
+			return fmt.Errorf("replica: primary must be an http or https URL, got %q", c.Replica.Primary)
+		}
+		if c.Replica.Interval <= 0 {
+			return errors.New("replica: interval must be positive")
+		}
+	}
+	if len(c.Cluster.Peers) > 0 {
+		if c.Replica.Primary != "" {
+			return errors.New("cluster: a replica cannot also be a cluster member")
+		}
+		for _, peer := range c.Cluster.Peers {
+			if !isHTTPURL(peer) {
+				return fmt.Errorf("cluster: peer must be an http or https URL, got %q", peer)
+			}
+		}
+		if c.Cluster.Interval <= 0 {
+			return errors.New("cluster: interval must be positive")
+		}
+		if c.Cluster.LeaderElection && c.Cluster.LeaseTTL < 10*time.Second {
+			return errors.New("cluster: lease_ttl must be at least 10s")
+		}
+	}
+	if err := c.DNS.validate(); err != nil {
+		return fmt.Errorf("dns: %w", err)
+	}
+	seenPools := make(map[string]bool)
+	listens := map[string]bool{c.Server.Listen: true}
+	for _, p := range c.Pools {
+		if p.Name == "" {
+			return errors.New("pools: name is required")
+		}
+		if seenPools[p.Name] {
+			return fmt.Errorf("pools: duplicate pool %q", p.Name)
+		}
+		seenPools[p.Name] = true
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("pools: %s: %w", p.Name, err)
+		}
+		if listens[p.Listen] {
+			return fmt.Errorf("pools: %s: listen address %s is already in use", p.Name, p.Listen)
+		}
+		listens[p.Listen] = true
+	}
+	if c.Cleanup.MaxAge <= 0 {
+		return errors.New("cleanup: max_age must be positive")
+	}
+	if c.Cleanup.Quarantine < 0 || c.Cleanup.MaxProxies < 0 {
+		return errors.New("cleanup: quarantine and max_proxies must not be negative")
+	}
+	if c.Cleanup.MinScore < 0 || c.Cleanup.MinScore > 1 {
+		return errors.New("cleanup: min_score must be between 0 and 1")
+	}
+	if c.History.Interval < 0 || c.History.Retention < 0 {
+		return errors.New("history: interval and retention must not be negative")
+	}
+	if c.Events.Capacity < 0 {
+		return errors.New("events: capacity must not be negative")
+	}
+	if c.Chat.Interval < 0 {
+		return errors.New("chat: interval must not be negative")
+	}
+	if err := c.Chat.Telegram.validate(); err != nil {
+		return fmt.Errorf("chat.telegram: %w", err)
+	}
+	if err := c.Chat.Discord.validate(); err != nil {
+		return fmt.Errorf("chat.discord: %w", err)
+	}
+	if err := c.Telemetry.validate(); err != nil {
+		return fmt.Errorf("telemetry: %w", err)
+	}
+	if err := c.Schedule.validate(); err != nil {
+		return fmt.Errorf("schedule: %w", err)
+	}
+	if c.Gather.MinHealthy < 0 {
+		return errors.New("gather: min_healthy must not be negative")
+	}
+	if c.Gather.DemoteBelow < 0 || c.Gather.DemoteBelow > 1 {
+		return errors.New("gather: demote_below must be between 0 and 1")
+	}
+	if c.Gather.DemoteEvery < 1 || c.Gather.DemoteMinSamples < 0 {
+		return errors.New("gather: demote_every must be at least 1 and demote_min_samples must not be negative")
+	}
+	if c.Gather.BackoffInitial < 0 || (c.Gather.BackoffInitial > 0 && c.Gather.BackoffMax < c.Gather.BackoffInitial) {
+		return errors.New("gather: backoff_initial must not be negative and backoff_max must be at least backoff_initial")
+	}
+	for _, ua := range c.Gather.UserAgents {
+		if strings.TrimSpace(ua) == "" || strings.ContainsAny(ua, "\r\n") {
+			return fmt.Errorf("gather: invalid user_agents entry %q", ua)
+		}
+	}
+	if err := c.Gather.validatePoliteness(); err != nil {
+		return fmt.Errorf("gather: %w", err)
+	}
+	if c.Gather.Concurrency < 1 {
+		return errors.New("gather: concurrency must be at least 1")
+	}
+	if c.Gather.SourceTimeout <= 0 {
+		return errors.New("gather: source_timeout must be positive")
+	}
+	for _, r := range []struct {
+		name   string
+		policy RetryPolicyConfig
+	}{
+		{"forward", c.Retry.Forward},
+		{"validation", c.Retry.Validation},
+		{"fetch", c.Retry.Fetch},
+	} {
+		if err := r.policy.Policy().Validate(); err != nil {
+			return fmt.Errorf("retry.%s: %w", r.name, err)
+		}
+	}
+	// 只讀副本從主實例同步代理池，不需要來源
+	if len(c.Sources) == 0 && c.Replica.Primary == "" {
+		return errors.New("sources: at least one source url is required")
+	}
+	for _, s := range c.Sources {
+		if s.GitHub == nil {
+			if err := validateHTTPURL(s.URL); err != nil {
+				return fmt.Errorf("sources: %w", err)
+			}
+		}
+		if s.Pagination != nil {
+			if err := s.Pagination.validate(); err != nil {
+				return fmt.Errorf("sources: %s: %w", s.Name(), err)
+			}
+		}
+		if err := s.validate(); err != nil {
+			return fmt.Errorf("sources: %s: %w", s.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Hash 生效配置（含命令行覆蓋）的摘要，用於區分不同運行使用的配置
+func (c *Config) Hash() string {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// validateHTTPURL 檢查是否為有效的 http/https URL
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid url %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid url %q: missing host", raw)
+	}
+	return nil
+}
+
+// hasHTTPS 列表中是否包含 https URL
+func hasHTTPS(urls []string) bool {
+	for _, u := range urls {
+		if strings.HasPrefix(strings.ToLower(u), "https://") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix 環境變量前綴：配置項按 YAML 路徑大寫並以下劃線連接，如 server.listen 對應 DYNAMIC_PROXY_SERVER_LISTEN
+const EnvPrefix = "DYNAMIC_PROXY_"
+
+// ApplyEnv 用環境變量覆蓋配置（優先於配置文件）。值按 YAML 解析，因此時長寫作 30s、布爾值寫作 true；
+// 字符串列表可寫作逗號分隔（paid,residential），其他列表用 YAML 流式寫法（[a, b]），
+// 字符串映射可寫作 key=value 逗號分隔或 {key: value}。整個配置段不能直接設置，只能設置其中的字段
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix, lookup)
+}
+
+// applyEnv 按 YAML 字段名遞歸查找環境變量並設置結構體字段
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + strings.ToUpper(name)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, key+"_", lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		val, ok := lookup(key)
+		if !ok {
+			continue
+		}
+		if err := setFromEnv(field, val); err != nil {
+			return fmt.Errorf("env %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setFromEnv 把環境變量的值解析到字段
+func setFromEnv(field reflect.Value, val string) error {
+	trimmed := strings.TrimSpace(val)
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(val)
+		return nil
+	case field.Kind() == reflect.Slice && !strings.HasPrefix(trimmed, "["):
+		if field.Type().Elem().Kind() == reflect.String {
+			var list []string
+			for _, item := range strings.Split(trimmed, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			field.Set(reflect.ValueOf(list).Convert(field.Type()))
+			return nil
+		}
+		val = "[" + val + "]"
+	case field.Kind() == reflect.Map && !strings.HasPrefix(trimmed, "{"):
+		// key=value,key=value 轉為 YAML 流式映射
+		var pairs []string
+		for _, pair := range strings.Split(trimmed, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("invalid entry %q (want key=value)", pair)
+			}
+			pairs = append(pairs, fmt.Sprintf("%q: %q", strings.TrimSpace(k), strings.TrimSpace(v)))
+		}
+		val = "{" + strings.Join(pairs, ", ") + "}"
+	}
+
+	// 列表和映射整體替換，而不是與配置文件中的值合併
+	ptr := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(val), ptr.Interface()); err != nil {
+		return err
+	}
+	field.Set(ptr.Elem())
+	return nil
+}
+
+// lookupEnv 讀取進程環境變量
+func lookupEnv(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"DYNAMIC_PROXY_SERVER_LISTEN":          ":9000",
+		"DYNAMIC_PROXY_SERVER_TIMEOUT":         "45s",
+		"DYNAMIC_PROXY_SERVER_STRICT_HYGIENE":  "true",
+		"DYNAMIC_PROXY_SERVER_TAGS":            "paid, residential",
+		"DYNAMIC_PROXY_SERVER_TARGET_ACL_DENY": "[example.com, 10.0.0.0/8]",
+		"DYNAMIC_PROXY_VALIDATION_QUEUE_RATE":  "2.5",
+		"DYNAMIC_PROXY_LOG_COMPONENTS":         "validator=debug,server=trace",
+		"DYNAMIC_PROXY_SOURCES":                "https://example.com/a.txt, https://example.com/b.txt",
+		"DYNAMIC_PROXY_SERVER":                 "ignored: true",
+	}
+	cfg := Default()
+	err := cfg.ApplyEnv(func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.Listen != ":9000" || cfg.Server.Timeout != 45*time.Second || !cfg.Server.StrictHygiene {
+		t.Errorf("server scalars not applied: %+v", cfg.Server)
+	}
+	if !slices.Equal(cfg.Server.Tags, []string{"paid", "residential"}) {
+		t.Errorf("tags = %v", cfg.Server.Tags)
+	}
+	if !slices.Equal(cfg.Server.TargetACL.Deny, []string{"example.com", "10.0.0.0/8"}) {
+		t.Errorf("target_acl.deny = %v", cfg.Server.TargetACL.Deny)
+	}
+	if cfg.Validation.QueueRate != 2.5 {
+		t.Errorf("queue_rate = %v", cfg.Validation.QueueRate)
+	}
+	if cfg.Log.Components["validator"] != "debug" || cfg.Log.Components["server"] != "trace" {
+		t.Errorf("log components = %v", cfg.Log.Components)
+	}
+	if len(cfg.Sources) != 2 || cfg.Sources[1].URL != "https://example.com/b.txt" {
+		t.Errorf("sources = %+v", cfg.Sources)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("config from env should be valid: %v", err)
+	}
+
+	bad := Default()
+	if err := bad.ApplyEnv(func(key string) (string, bool) {
+		return "soon", key == "DYNAMIC_PROXY_SERVER_TIMEOUT"
+	}); err == nil {
+		t.Error("invalid duration should fail")
+	}
+}
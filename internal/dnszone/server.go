@@ -0,0 +1,268 @@
+package dnszone
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/logging"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var log = logging.For("dns")
+
+const (
+	// udpLimit 未使用 EDNS 的 UDP 應答大小上限（RFC 1035）
+	udpLimit = 512
+	// ednsLimit 接受的 EDNS UDP 緩衝區上限
+	ednsLimit = 4096
+	// tcpTimeout TCP 連接的讀寫超時
+	tcpTimeout = 10 * time.Second
+)
+
+// Server 權威應答代理區域的內置 DNS 服務器（UDP 與 TCP）
+type Server struct {
+	Addr string
+	// MaxAnswers 每次應答最多返回的代理記錄數，多於此數時隨機選取
+	MaxAnswers int
+
+	zone atomic.Pointer[Zone]
+	udp  net.PacketConn
+	tcp  net.Listener
+	wg   sync.WaitGroup
+}
+
+// NewServer 創建 DNS 服務器，調用 SetZone 後才有記錄可應答
+func NewServer(addr string, maxAnswers int) *Server {
+	return &Server{Addr: addr, MaxAnswers: maxAnswers}
+}
+
+// SetZone 替換應答使用的區域
+func (s *Server) SetZone(z *Zone) {
+	s.zone.Store(z)
+}
+
+// Start 在 Addr 上監聽 UDP 與 TCP
+func (s *Server) Start() error {
+	udp, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen dns on udp %s: %w", s.Addr, err)
+	}
+	// TCP 使用 UDP 實際綁定的端口，支持 :0
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return fmt.Errorf("failed to listen dns on tcp %s: %w", s.Addr, err)
+	}
+	s.udp, s.tcp = udp, tcp
+	log.Infof("DNS server listening on %s (udp/tcp)", udp.LocalAddr())
+
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return nil
+}
+
+// LocalAddr 返回實際監聽的地址（Start 之後有效）
+func (s *Server) LocalAddr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// Stop 關閉監聽並等待處理中的請求結束
+func (s *Server) Stop() error {
+	err := errors.Join(s.udp.Close(), s.tcp.Close())
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Errorf("dns udp read error: %v", err)
+			}
+			return
+		}
+		if resp := s.handle(buf[:n], true); resp != nil {
+			if _, err := s.udp.WriteTo(resp, addr); err != nil {
+				log.Debugf("dns udp write to %s failed: %v", addr, err)
+			}
+		}
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Errorf("dns tcp accept error: %v", err)
+			}
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn 處理一個 TCP 連接上的查詢（每條消息前有 2 字節長度）
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	var size [2]byte
+	for {
+		conn.SetDeadline(time.Now().Add(tcpTimeout))
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		resp := s.handle(req, false)
+		if resp == nil {
+			return
+		}
+		if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(resp)))); err != nil {
+			return
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle 應答一條查詢，無法解析頭部時返回 nil（丟棄）
+func (s *Server) handle(req []byte, udp bool) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(req)
+	if err != nil || h.Response {
+		return nil
+	}
+	resp := dnsmessage.Message{Header: dnsmessage.Header{
+		ID:               h.ID,
+		Response:         true,
+		OpCode:           h.OpCode,
+		RecursionDesired: h.RecursionDesired,
+	}}
+	q, err := p.Question()
+	if err != nil {
+		resp.RCode = dnsmessage.RCodeFormatError
+		return pack(resp)
+	}
+	resp.Questions = []dnsmessage.Question{q}
+
+	limit := udpLimit
+	edns := false
+	if p.SkipAllQuestions() == nil && p.SkipAllAnswers() == nil && p.SkipAllAuthorities() == nil {
+		for {
+			rh, err := p.AdditionalHeader()
+			if err != nil {
+				break
+			}
+			if rh.Type == dnsmessage.TypeOPT {
+				edns = true
+				limit = min(max(int(rh.Class), udpLimit), ednsLimit)
+			}
+			if p.SkipAdditional() != nil {
+				break
+			}
+		}
+	}
+	if !udp {
+		limit = 65535
+	}
+
+	z := s.zone.Load()
+	s.answer(z, &resp, q)
+	var opt []dnsmessage.Resource
+	if edns {
+		rr := dnsmessage.Resource{Body: &dnsmessage.OPTResource{}}
+		rr.Header.Name = dnsmessage.MustNewName(".")
+		rr.Header.SetEDNS0(ednsLimit, dnsmessage.RCodeSuccess, false)
+		opt = append(opt, rr)
+	}
+
+	// 超出 UDP 大小時減少應答記錄並設置 TC，客戶端可改用 TCP
+	for {
+		resp.Additionals = append(glue(z, resp.Answers), opt...)
+		out := pack(resp)
+		if len(out) <= limit || len(resp.Answers) == 0 {
+			return out
+		}
+		resp.Truncated = true
+		resp.Answers = resp.Answers[:len(resp.Answers)-1]
+	}
+}
+
+// answer 按區域填充應答
+func (s *Server) answer(z *Zone, resp *dnsmessage.Message, q dnsmessage.Question) {
+	name := strings.ToLower(q.Name.String())
+	if resp.OpCode != 0 {
+		resp.RCode = dnsmessage.RCodeNotImplemented
+		return
+	}
+	if z == nil || q.Class != dnsmessage.ClassINET || !z.contains(name) {
+		resp.RCode = dnsmessage.RCodeRefused
+		return
+	}
+	resp.Authoritative = true
+
+	rrs, exists := z.lookup(name, q.Type)
+	if !exists {
+		resp.RCode = dnsmessage.RCodeNameError
+	}
+	if len(rrs) == 0 {
+		// NXDOMAIN 或無此類型記錄：授權段帶 SOA 以便否定緩存
+		resp.Authorities = []dnsmessage.Resource{z.soa}
+		return
+	}
+	if s.MaxAnswers > 0 && len(rrs) > s.MaxAnswers && q.Type != dnsmessage.TypeSOA {
+		// 每次隨機選取不同的代理，客戶端按應答順序使用時自然分散負載
+		rand.Shuffle(len(rrs), func(i, j int) { rrs[i], rrs[j] = rrs[j], rrs[i] })
+		rrs = rrs[:s.MaxAnswers]
+	}
+	resp.Answers = rrs
+}
+
+// glue SRV 目標主機的 A / AAAA 記錄，放在附加段避免客戶端再次查詢
+func glue(z *Zone, answers []dnsmessage.Resource) []dnsmessage.Resource {
+	var extra []dnsmessage.Resource
+	for _, rr := range answers {
+		srv, ok := rr.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+		target := srv.Target.String()
+		for _, t := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+			addrs, _ := z.lookup(target, t)
+			extra = append(extra, addrs...)
+		}
+	}
+	return extra
+}
+
+// pack 序列化應答，失敗時返回 SERVFAIL
+func pack(m dnsmessage.Message) []byte {
+	out, err := m.Pack()
+	if err != nil {
+		log.Errorf("failed to pack dns response: %v", err)
+		fail := dnsmessage.Message{Header: m.Header, Questions: m.Questions}
+		fail.RCode = dnsmessage.RCodeServerFailure
+		out, _ = fail.Pack()
+	}
+	return out
+}
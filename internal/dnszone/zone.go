@@ -0,0 +1,248 @@
+// Package dnszone 把可用代理發佈為 DNS 記錄，可輸出為區域文件或由內置 DNS 服務器應答，
+// 供只能解析 DNS 的舊工具以服務發現的方式獲取代理
+//
+// 記錄佈局（以區域 proxies.internal. 為例）：
+//
+//	proxies.internal.                 TXT   "http://1.2.3.4:8080"          每個代理一條
+//	_http._tcp.proxies.internal.      SRV   0 1 8080 p-1-2-3-4-8080.proxies.internal.
+//	p-1-2-3-4-8080.proxies.internal.  A     1.2.3.4
+//	p-1-2-3-4-8080.proxies.internal.  TXT   "protocol=http" "country=US"
+//
+// SRV 服務名取自代理協議：_http._tcp、_https._tcp、_socks4._tcp、_socks5._tcp。
+package dnszone
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Zone 由代理池生成的只讀區域
+type Zone struct {
+	Origin  string // 區域名（小寫，帶結尾點）
+	TTL     uint32
+	Serial  uint32
+	Proxies int // 發佈的代理數
+
+	soa   dnsmessage.Resource
+	order []string                         // 名稱按加入順序排列，用於輸出區域文件
+	names map[string][]dnsmessage.Resource // 小寫完整域名 -> 記錄
+}
+
+// NormalizeOrigin 返回小寫、帶結尾點的區域名，名稱無效時返回錯誤
+func NormalizeOrigin(origin string) (string, error) {
+	origin = strings.ToLower(strings.TrimSpace(origin))
+	if origin == "" || origin == "." {
+		return "", errors.New("zone name is required")
+	}
+	if !strings.HasSuffix(origin, ".") {
+		origin += "."
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(origin, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return "", fmt.Errorf("invalid zone name %q", origin)
+		}
+	}
+	if _, err := dnsmessage.NewName(origin); err != nil {
+		return "", fmt.Errorf("invalid zone name %q: %w", origin, err)
+	}
+	return origin, nil
+}
+
+// Build 由代理列表構建區域，只發佈已驗證且未禁用的代理
+func Build(origin string, ttl time.Duration, proxies []*pool.Proxy) (*Zone, error) {
+	origin, err := NormalizeOrigin(origin)
+	if err != nil {
+		return nil, err
+	}
+	z := &Zone{
+		Origin: origin,
+		TTL:    uint32(max(ttl, time.Second) / time.Second),
+		Serial: uint32(time.Now().Unix()),
+		names:  make(map[string][]dnsmessage.Resource),
+	}
+	z.soa = z.resource(origin, dnsmessage.TypeSOA, &dnsmessage.SOAResource{
+		NS:      dnsmessage.MustNewName("ns." + origin),
+		MBox:    dnsmessage.MustNewName("hostmaster." + origin),
+		Serial:  z.Serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		MinTTL:  z.TTL,
+	})
+	z.add(z.soa)
+	z.add(z.resource(origin, dnsmessage.TypeNS, &dnsmessage.NSResource{NS: dnsmessage.MustNewName("ns." + origin)}))
+
+	// 按鍵排序，保證區域文件輸出穩定
+	sorted := slices.Clone(proxies)
+	slices.SortFunc(sorted, func(a, b *pool.Proxy) int { return strings.Compare(a.Key(), b.Key()) })
+	for _, p := range sorted {
+		if p.Disable || p.Updated.IsZero() || p.Tampering {
+			continue
+		}
+		addr, err := netip.ParseAddr(p.IP)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.ParseUint(p.Port, 10, 16)
+		if err != nil || port == 0 {
+			continue
+		}
+		proto := strings.ToLower(p.Protocol)
+		if proto == "" {
+			proto = "http"
+		}
+		host := hostName(addr, p.Port, origin)
+		target, err := dnsmessage.NewName(host)
+		if err != nil {
+			continue
+		}
+
+		z.add(z.resource(origin, dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{p.String()}}))
+		z.add(z.resource("_"+proto+"._tcp."+origin, dnsmessage.TypeSRV, &dnsmessage.SRVResource{
+			Priority: 0,
+			Weight:   1,
+			Port:     uint16(port),
+			Target:   target,
+		}))
+		if addr.Is4() {
+			z.add(z.resource(host, dnsmessage.TypeA, &dnsmessage.AResource{A: addr.As4()}))
+		} else {
+			z.add(z.resource(host, dnsmessage.TypeAAAA, &dnsmessage.AAAAResource{AAAA: addr.As16()}))
+		}
+		z.add(z.resource(host, dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: attributes(p, proto)}))
+		z.Proxies++
+	}
+	return z, nil
+}
+
+// hostName 代理的主機名：p-<IP 以連字符分隔>-<端口>.<區域>
+func hostName(addr netip.Addr, port, origin string) string {
+	ip := strings.NewReplacer(".", "-", ":", "-").Replace(addr.String())
+	return "p-" + ip + "-" + port + "." + origin
+}
+
+// attributes 代理屬性 TXT 字符串（key=value）
+func attributes(p *pool.Proxy, proto string) []string {
+	attrs := []string{"protocol=" + proto}
+	if p.Country != "" {
+		attrs = append(attrs, "country="+p.Country)
+	}
+	if p.Anonymity != "" {
+		attrs = append(attrs, "anonymity="+p.Anonymity)
+	}
+	if len(p.Sites) > 0 {
+		attrs = append(attrs, "sites="+strings.Join(p.Sites, ","))
+	}
+	if len(p.Tags) > 0 {
+		attrs = append(attrs, "tags="+strings.Join(p.Tags, ","))
+	}
+	if p.SpeedKBps > 0 {
+		attrs = append(attrs, "speed_kbps="+strconv.FormatFloat(p.SpeedKBps, 'f', 0, 64))
+	}
+	attrs = append(attrs, "updated="+p.Updated.UTC().Format(time.RFC3339))
+	return attrs
+}
+
+// resource 創建區域內的一條記錄
+func (z *Zone) resource(name string, t dnsmessage.Type, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  t,
+			Class: dnsmessage.ClassINET,
+			TTL:   z.TTL,
+		},
+		Body: body,
+	}
+}
+
+// add 加入一條記錄
+func (z *Zone) add(rr dnsmessage.Resource) {
+	name := strings.ToLower(rr.Header.Name.String())
+	if _, ok := z.names[name]; !ok {
+		z.order = append(z.order, name)
+	}
+	z.names[name] = append(z.names[name], rr)
+}
+
+// contains 判斷名稱是否位於區域內
+func (z *Zone) contains(name string) bool {
+	return name == z.Origin || strings.HasSuffix(name, "."+z.Origin)
+}
+
+// lookup 返回名稱下指定類型的記錄，exists 表示名稱是否存在（用於區分 NXDOMAIN 與空應答）
+func (z *Zone) lookup(name string, t dnsmessage.Type) (rrs []dnsmessage.Resource, exists bool) {
+	all, exists := z.names[strings.ToLower(name)]
+	for _, rr := range all {
+		if rr.Header.Type == t || t == dnsmessage.TypeALL {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs, exists
+}
+
+// WriteTo 以 RFC 1035 區域文件格式輸出
+func (z *Zone) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	fmt.Fprintf(bw, "; dynamic-proxy pool, %d proxies, generated %s\n", z.Proxies, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(bw, "$ORIGIN %s\n$TTL %d\n", z.Origin, z.TTL)
+	for _, name := range z.order {
+		for _, rr := range z.names[name] {
+			fmt.Fprintf(bw, "%s\t%d\tIN\t%s\t%s\n", name, rr.Header.TTL, typeName(rr.Header.Type), formatBody(rr.Body))
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// typeName 記錄類型的區域文件寫法（TypeA -> A）
+func typeName(t dnsmessage.Type) string {
+	return strings.TrimPrefix(t.String(), "Type")
+}
+
+// formatBody 記錄數據的區域文件寫法
+func formatBody(body dnsmessage.ResourceBody) string {
+	switch b := body.(type) {
+	case *dnsmessage.AResource:
+		return netip.AddrFrom4(b.A).String()
+	case *dnsmessage.AAAAResource:
+		return netip.AddrFrom16(b.AAAA).String()
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", b.Priority, b.Weight, b.Port, b.Target.String())
+	case *dnsmessage.NSResource:
+		return b.NS.String()
+	case *dnsmessage.SOAResource:
+		return fmt.Sprintf("%s %s %d %d %d %d %d", b.NS.String(), b.MBox.String(), b.Serial, b.Refresh, b.Retry, b.Expire, b.MinTTL)
+	case *dnsmessage.TXTResource:
+		quoted := make([]string, len(b.TXT))
+		for i, s := range b.TXT {
+			quoted[i] = strconv.Quote(s)
+		}
+		return strings.Join(quoted, " ")
+	default:
+		return body.GoString()
+	}
+}
+
+// countingWriter 統計寫入的字節數
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
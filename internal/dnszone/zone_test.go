@@ -0,0 +1,173 @@
+package dnszone
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func testProxies(n int) []*pool.Proxy {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ps := []*pool.Proxy{
+		{IP: "2001:db8::1", Port: "1080", Protocol: "socks5", Updated: now},
+		{IP: "9.9.9.9", Port: "80", Protocol: "http"},                              // 未驗證
+		{IP: "8.8.8.8", Port: "80", Protocol: "http", Updated: now, Disable: true}, // 已禁用
+	}
+	for i := range n {
+		ps = append(ps, &pool.Proxy{IP: fmt.Sprintf("10.0.%d.%d", i/250, i%250+1), Port: "8080", Protocol: "http", Updated: now, Country: "US"})
+	}
+	return ps
+}
+
+func TestBuildZoneFile(t *testing.T) {
+	z, err := Build("Proxies.Internal", time.Minute, testProxies(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.Origin != "proxies.internal." || z.Proxies != 2 {
+		t.Fatalf("origin = %q, proxies = %d", z.Origin, z.Proxies)
+	}
+
+	var sb strings.Builder
+	if _, err := z.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	for _, want := range []string{
+		"$ORIGIN proxies.internal.\n$TTL 60\n",
+		"proxies.internal.\t60\tIN\tTXT\t\"http://10.0.0.1:8080\"\n",
+		"_http._tcp.proxies.internal.\t60\tIN\tSRV\t0 1 8080 p-10-0-0-1-8080.proxies.internal.\n",
+		"p-10-0-0-1-8080.proxies.internal.\t60\tIN\tA\t10.0.0.1\n",
+		"p-10-0-0-1-8080.proxies.internal.\t60\tIN\tTXT\t\"protocol=http\" \"country=US\" \"updated=2026-01-02T03:04:05Z\"\n",
+		"_socks5._tcp.proxies.internal.\t60\tIN\tSRV\t0 1 1080 p-2001-db8--1-1080.proxies.internal.\n",
+		"p-2001-db8--1-1080.proxies.internal.\t60\tIN\tAAAA\t2001:db8::1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("zone file missing %q\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "9.9.9.9") || strings.Contains(out, "8.8.8.8") {
+		t.Errorf("unvalidated or disabled proxy exported:\n%s", out)
+	}
+
+	if _, err := Build("bad..zone", time.Minute, nil); err == nil {
+		t.Error("expected error for invalid zone name")
+	}
+}
+
+// query 構造查詢報文
+func query(t *testing.T, name string, qt dnsmessage.Type, edns bool) []byte {
+	t.Helper()
+	m := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: qt, Class: dnsmessage.ClassINET}},
+	}
+	if edns {
+		rr := dnsmessage.Resource{Body: &dnsmessage.OPTResource{}}
+		rr.Header.Name = dnsmessage.MustNewName(".")
+		rr.Header.SetEDNS0(4096, dnsmessage.RCodeSuccess, false)
+		m.Additionals = append(m.Additionals, rr)
+	}
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func unpack(t *testing.T, b []byte) dnsmessage.Message {
+	t.Helper()
+	var m dnsmessage.Message
+	if err := m.Unpack(b); err != nil {
+		t.Fatalf("unpack response: %v", err)
+	}
+	return m
+}
+
+func TestHandle(t *testing.T) {
+	z, err := Build("proxies.internal.", time.Minute, testProxies(40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("", 5)
+	s.SetZone(z)
+
+	tests := []struct {
+		name      string
+		qname     string
+		qtype     dnsmessage.Type
+		udp, edns bool
+		rcode     dnsmessage.RCode
+		answers   int
+		truncated bool
+	}{
+		{name: "srv capped", qname: "_http._tcp.proxies.internal.", qtype: dnsmessage.TypeSRV, answers: 5},
+		{name: "host a", qname: "P-10-0-0-1-8080.proxies.internal.", qtype: dnsmessage.TypeA, udp: true, answers: 1},
+		{name: "no such type", qname: "p-10-0-0-1-8080.proxies.internal.", qtype: dnsmessage.TypeMX, udp: true},
+		{name: "nxdomain", qname: "nope.proxies.internal.", qtype: dnsmessage.TypeA, udp: true, rcode: dnsmessage.RCodeNameError},
+		{name: "outside zone", qname: "example.com.", qtype: dnsmessage.TypeA, udp: true, rcode: dnsmessage.RCodeRefused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := unpack(t, s.handle(query(t, tt.qname, tt.qtype, tt.edns), tt.udp))
+			if m.ID != 42 || !m.Response || m.RCode != tt.rcode || len(m.Answers) != tt.answers || m.Truncated != tt.truncated {
+				t.Errorf("id=%d rcode=%v answers=%d tc=%v", m.ID, m.RCode, len(m.Answers), m.Truncated)
+			}
+		})
+	}
+
+	// SRV 應答附帶目標地址
+	m := unpack(t, s.handle(query(t, "_http._tcp.proxies.internal.", dnsmessage.TypeSRV, false), false))
+	if len(m.Additionals) != 5 {
+		t.Errorf("glue records = %d, want 5", len(m.Additionals))
+	}
+
+	// 不限數量時 UDP 應答超過 512 字節被截斷，EDNS 可容納更多
+	s.MaxAnswers = 0
+	plain := unpack(t, s.handle(query(t, "proxies.internal.", dnsmessage.TypeTXT, false), true))
+	large := unpack(t, s.handle(query(t, "proxies.internal.", dnsmessage.TypeTXT, true), true))
+	if !plain.Truncated || len(plain.Answers) >= len(large.Answers) {
+		t.Errorf("plain udp: tc=%v answers=%d, edns answers=%d", plain.Truncated, len(plain.Answers), len(large.Answers))
+	}
+	if len(large.Answers) != 41 {
+		t.Errorf("edns answers = %d, want 41", len(large.Answers))
+	}
+}
+
+func TestServerUDP(t *testing.T) {
+	z, err := Build("proxies.internal.", time.Minute, testProxies(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("127.0.0.1:0", 10)
+	s.SetZone(z)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	conn, err := net.Dial("udp", s.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(query(t, "_socks5._tcp.proxies.internal.", dnsmessage.TypeSRV, false)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := unpack(t, buf[:n])
+	srv, ok := m.Answers[0].Body.(*dnsmessage.SRVResource)
+	if len(m.Answers) != 1 || !ok || srv.Port != 1080 {
+		t.Errorf("answers = %+v", m.Answers)
+	}
+}
@@ -0,0 +1,230 @@
+// Package eventlog 把代理池的變化（代理新增、禁用、恢復、刪除，採集開始與結束，配置重新加載）
+// 記錄到數據庫中的環形緩衝區，超出容量時刪除最舊的事件，供事後查明代理池為何變化
+package eventlog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/internal/logging"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+var log = logging.For("events")
+
+// 事件類型
+const (
+	ProxyAdded     = "proxy_added"     // 新代理入庫
+	ProxyDisabled  = "proxy_disabled"  // 代理由可用變為禁用
+	ProxyRecovered = "proxy_recovered" // 被禁用的代理重新通過驗證
+	ProxyDeleted   = "proxy_deleted"   // 代理被刪除
+	GatherStarted  = "gather_started"  // 一輪採集開始
+	GatherFinished = "gather_finished" // 一輪採集結束
+	ConfigReloaded = "config_reloaded" // 配置重新加載
+)
+
+const (
+	// eventPrefix 事件鍵前綴，位於元數據命名空間下；鍵後綴為定長序號，按寫入順序排序
+	eventPrefix = pool.MetaPrefix + "event:"
+	// seqKey 下一個事件序號
+	seqKey = pool.MetaPrefix + "event_seq"
+)
+
+// Event 一條事件
+type Event struct {
+	Seq    uint64         `json:"seq"`
+	Time   time.Time      `json:"time"`
+	Type   string         `json:"type"`
+	Proxy  string         `json:"proxy,omitempty"` // 代理鍵（ip:port）
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// Query 查詢條件，零值字段不限制
+type Query struct {
+	Types []string  // 事件類型
+	Proxy string    // 代理鍵
+	Since time.Time // 不早於此時間
+	Limit int       // 最多返回的條數（<= 0 表示全部）
+}
+
+// match 事件是否滿足查詢條件
+func (q Query) match(e Event) bool {
+	if len(q.Types) > 0 && !containsFold(q.Types, e.Type) {
+		return false
+	}
+	if q.Proxy != "" && e.Proxy != q.Proxy {
+		return false
+	}
+	return q.Since.IsZero() || !e.Time.Before(q.Since)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Log 持久化的事件環形緩衝區，可並發使用；nil 表示不記錄
+type Log struct {
+	db       *badger.DB
+	capacity uint64
+
+	mu   sync.Mutex
+	next uint64
+}
+
+// Open 打開事件記錄，capacity <= 0 時返回 nil（不記錄）；容量比已保存的事件少時刪除多出的舊事件
+func Open(db *badger.DB, capacity int) (*Log, error) {
+	if capacity <= 0 {
+		return nil, nil
+	}
+	l := &Log{db: db, capacity: uint64(capacity)}
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(seqKey))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			if len(v) != 8 {
+				return fmt.Errorf("invalid event sequence %x", v)
+			}
+			l.next = binary.BigEndian.Uint64(v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	if err := l.trim(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// eventKey 序號為 seq 的事件鍵
+func eventKey(seq uint64) []byte {
+	return fmt.Appendf(nil, "%s%020d", eventPrefix, seq)
+}
+
+// trim 刪除超出容量的舊事件
+func (l *Log) trim() error {
+	if l.next <= l.capacity {
+		return nil
+	}
+	end := string(eventKey(l.next - l.capacity))
+	var stale [][]byte
+	err := l.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(eventPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid() && string(it.Item().Key()) < end; it.Next() {
+			stale = append(stale, it.Item().KeyCopy(nil))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to trim event log: %w", err)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	wb := l.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, key := range stale {
+		if err := wb.Delete(key); err != nil {
+			return fmt.Errorf("failed to trim event log: %w", err)
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return fmt.Errorf("failed to trim event log: %w", err)
+	}
+	log.Infof("Trimmed %d events beyond capacity %d", len(stale), l.capacity)
+	return nil
+}
+
+// Record 追加一條事件，超出容量時刪除最舊的一條；寫入失敗只記錄日誌
+func (l *Log) Record(typ, proxy string, fields map[string]any) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := Event{Seq: l.next, Time: time.Now(), Type: typ, Proxy: proxy, Fields: fields}
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Warnf("failed to marshal %s event: %v", typ, err)
+		return
+	}
+	seq := binary.BigEndian.AppendUint64(nil, l.next+1)
+	err = l.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(eventKey(e.Seq), data); err != nil {
+			return err
+		}
+		if e.Seq >= l.capacity {
+			if err := txn.Delete(eventKey(e.Seq - l.capacity)); err != nil {
+				return err
+			}
+		}
+		return txn.Set([]byte(seqKey), seq)
+	})
+	if err != nil {
+		log.Warnf("failed to record %s event: %v", typ, err)
+		return
+	}
+	l.next++
+}
+
+// List 返回滿足條件的事件，最新的在前
+func (l *Log) List(q Query) ([]Event, error) {
+	if l == nil {
+		return nil, nil
+	}
+	var events []Event
+	err := l.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		opts.Prefix = []byte(eventPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// 反向遍歷從前綴範圍之後的第一個鍵開始
+		for it.Seek([]byte(eventPrefix + "~")); it.Valid(); it.Next() {
+			var e Event
+			if err := it.Item().Value(func(v []byte) error {
+				return json.Unmarshal(v, &e)
+			}); err != nil {
+				return fmt.Errorf("invalid event %s: %w", it.Item().Key(), err)
+			}
+			if !q.Since.IsZero() && e.Time.Before(q.Since) {
+				break
+			}
+			if !q.match(e) {
+				continue
+			}
+			events = append(events, e)
+			if q.Limit > 0 && len(events) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	return events, nil
+}
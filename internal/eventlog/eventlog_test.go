@@ -0,0 +1,102 @@
+package eventlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func openTestDB(t *testing.T) *badger.DB {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open badger: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func seqs(events []Event) []uint64 {
+	var out []uint64
+	for _, e := range events {
+		out = append(out, e.Seq)
+	}
+	return out
+}
+
+func equal(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLog(t *testing.T) {
+	db := openTestDB(t)
+	l, err := Open(db, 3)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	l.Record(GatherStarted, "", nil)
+	l.Record(ProxyAdded, "1.1.1.1:80", map[string]any{"source": "https://example.com/list"})
+	l.Record(ProxyAdded, "2.2.2.2:80", nil)
+	l.Record(ProxyDisabled, "1.1.1.1:80", nil)
+	l.Record(GatherFinished, "", map[string]any{"new": 2})
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []uint64
+	}{
+		{"all, oldest dropped", Query{}, []uint64{4, 3, 2}},
+		{"limit", Query{Limit: 2}, []uint64{4, 3}},
+		{"type", Query{Types: []string{ProxyAdded, ProxyDisabled}}, []uint64{3, 2}},
+		{"proxy", Query{Proxy: "1.1.1.1:80"}, []uint64{3}},
+		{"since", Query{Since: time.Now().Add(time.Hour)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := l.List(tt.query)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if got := seqs(events); !equal(got, tt.want) {
+				t.Errorf("seqs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 重新打開時從上次的序號繼續，容量縮小時刪除多出的舊事件
+	l, err = Open(db, 2)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	l.Record(ConfigReloaded, "", nil)
+	events, err := l.List(Query{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if got := seqs(events); !equal(got, []uint64{5, 4}) {
+		t.Errorf("seqs after reopen = %v, want [5 4]", got)
+	}
+	if events[0].Type != ConfigReloaded {
+		t.Errorf("latest event = %+v", events[0])
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	l, err := Open(openTestDB(t), 0)
+	if err != nil || l != nil {
+		t.Fatalf("Open(0) = %v, %v; want nil", l, err)
+	}
+	l.Record(ProxyAdded, "1.1.1.1:80", nil)
+	if events, err := l.List(Query{}); err != nil || len(events) != 0 {
+		t.Errorf("List on nil log = %v, %v", events, err)
+	}
+}
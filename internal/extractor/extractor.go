@@ -9,10 +9,12 @@ import (
 	"sync/atomic"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/e2u/dynamic-proxy/internal/proxy"
-	"github.com/sirupsen/logrus"
+	"github.com/e2u/dynamic-proxy/internal/logging"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
 )
 
+var log = logging.For("extractor")
+
 // ExtractorConfig 提取器配置
 type ExtractorConfig struct {
 	MaxGoroutines int  // 最大並發 goroutine 數量
@@ -170,14 +172,19 @@ var (
 	regexPort = regexp.MustCompile(`^(\d{2,5})$`)
 )
 
-// Extractor 主提取函數（自適應選擇提取策略）
-func Extractor(proxiesChan chan<- *proxy.Proxy, body []byte, url ...string) error {
-	logrus.Debugf("extractor called, body length: %d", len(body))
-
+// Extractor 通用提取函數（自適應選擇提取策略），按來源選擇解析器見 Extract
+func Extractor(proxiesChan chan<- *pool.Proxy, body []byte, url ...string) error {
 	targetURL := ""
 	if len(url) > 0 {
 		targetURL = url[0]
 	}
+	extractGeneric(proxiesChan, body, targetURL)
+	return nil
+}
+
+// extractGeneric 依次嘗試規則庫、JSON/HTML 自動探測和正則提取，返回找到的代理數
+func extractGeneric(proxiesChan chan<- *pool.Proxy, body []byte, targetURL string) int64 {
+	log.Debugf("extractor called, body length: %d", len(body))
 
 	// 1. 嘗試匹配預定義規則
 	for _, rule := range extractRules {
@@ -203,20 +210,20 @@ func Extractor(proxiesChan chan<- *proxy.Proxy, body []byte, url ...string) erro
 		}
 
 		if err == nil && count > 0 {
-			logrus.Infof("extractor succeeded with rule '%s', found %d proxies", rule.Name, count)
-			return nil
+			log.Infof("extractor succeeded with rule '%s', found %d proxies", rule.Name, count)
+			return count
 		}
 	}
 
 	// 2. 規則都失敗，使用 fallback 策略
-	logrus.Info("no rule matched, using fallback extractors")
+	log.Info("no rule matched, using fallback extractors")
 
 	// Fallback 1: JSON 自動探測
 	if isJSON(body) {
 		count, err := extractJSONAuto(proxiesChan, body)
 		if err == nil && count > 0 {
-			logrus.Infof("fallback JSON auto-extraction succeeded, found %d proxies", count)
-			return nil
+			log.Infof("fallback JSON auto-extraction succeeded, found %d proxies", count)
+			return count
 		}
 	}
 
@@ -224,20 +231,20 @@ func Extractor(proxiesChan chan<- *proxy.Proxy, body []byte, url ...string) erro
 	if isHTML(body) {
 		count, err := extractHTMLAuto(proxiesChan, body)
 		if err == nil && count > 0 {
-			logrus.Infof("fallback HTML auto-extraction succeeded, found %d proxies", count)
-			return nil
+			log.Infof("fallback HTML auto-extraction succeeded, found %d proxies", count)
+			return count
 		}
 	}
 
 	// Fallback 3: 正則提取
 	count, err := extractByRegex(proxiesChan, body)
 	if err == nil && count > 0 {
-		logrus.Infof("fallback regex extraction succeeded, found %d proxies", count)
-		return nil
+		log.Infof("fallback regex extraction succeeded, found %d proxies", count)
+		return count
 	}
 
-	logrus.Warn("all extraction methods failed")
-	return nil
+	log.Warn("all extraction methods failed")
+	return 0
 }
 
 // isJSON 檢測是否為 JSON 格式
@@ -254,8 +261,8 @@ func isHTML(body []byte) bool {
 }
 
 // extractFromJSONWithRule 使用規則從 JSON 提取
-func extractFromJSONWithRule(proxiesChan chan<- *proxy.Proxy, body []byte, rule ExtractRule) (int64, error) {
-	logrus.Debugf("extractFromJSONWithRule: rule=%s", rule.Name)
+func extractFromJSONWithRule(proxiesChan chan<- *pool.Proxy, body []byte, rule ExtractRule) (int64, error) {
+	log.Debugf("extractFromJSONWithRule: rule=%s", rule.Name)
 
 	var totalProxyCount int64
 	seen := make(map[string]bool)
@@ -263,7 +270,7 @@ func extractFromJSONWithRule(proxiesChan chan<- *proxy.Proxy, body []byte, rule
 	// 解析 JSON
 	var data any
 	if err := json.Unmarshal(body, &data); err != nil {
-		logrus.Errorf("failed to parse JSON: %v", err)
+		log.Errorf("failed to parse JSON: %v", err)
 		return 0, err
 	}
 
@@ -271,7 +278,7 @@ func extractFromJSONWithRule(proxiesChan chan<- *proxy.Proxy, body []byte, rule
 	if rule.ArrayPath != "" {
 		data = getJSONPath(data, rule.ArrayPath)
 		if data == nil {
-			logrus.Warnf("array path '%s' not found in JSON", rule.ArrayPath)
+			log.Warnf("array path '%s' not found in JSON", rule.ArrayPath)
 			return 0, nil
 		}
 	}
@@ -322,7 +329,7 @@ func getJSONPath(data any, path string) any {
 }
 
 // extractJSONArray 從 JSON 數組提取
-func extractJSONArray(proxiesChan chan<- *proxy.Proxy, data any, ipFields, portFields []string, seen map[string]bool, count *int64) {
+func extractJSONArray(proxiesChan chan<- *pool.Proxy, data any, ipFields, portFields []string, seen map[string]bool, count *int64) {
 	arr, ok := data.([]any)
 	if !ok {
 		// 嘗試當單個對象處理
@@ -353,7 +360,7 @@ func extractJSONArray(proxiesChan chan<- *proxy.Proxy, data any, ipFields, portF
 }
 
 // extractProxyFromObject 從單個 JSON 對象提取代理
-func extractProxyFromObject(proxiesChan chan<- *proxy.Proxy, obj any, ipFields, portFields []string, seen map[string]bool, count *int64) int64 {
+func extractProxyFromObject(proxiesChan chan<- *pool.Proxy, obj any, ipFields, portFields []string, seen map[string]bool, count *int64) int64 {
 	m, ok := obj.(map[string]any)
 	if !ok {
 		return 0
@@ -401,7 +408,7 @@ func extractProxyFromObject(proxiesChan chan<- *proxy.Proxy, obj any, ipFields,
 
 	// 驗證並發送
 	if isValidIP(ip) && isValidPort(port) {
-		p := &proxy.Proxy{
+		p := &pool.Proxy{
 			IP:       ip,
 			Port:     port,
 			Protocol: "http",
@@ -416,8 +423,8 @@ func extractProxyFromObject(proxiesChan chan<- *proxy.Proxy, obj any, ipFields,
 }
 
 // extractJSONAuto JSON 自動探測提取
-func extractJSONAuto(proxiesChan chan<- *proxy.Proxy, body []byte) (int64, error) {
-	logrus.Debug("extractJSONAuto: starting auto-detection")
+func extractJSONAuto(proxiesChan chan<- *pool.Proxy, body []byte) (int64, error) {
+	log.Debug("extractJSONAuto: starting auto-detection")
 
 	var totalProxyCount int64
 	seen := make(map[string]bool)
@@ -445,7 +452,7 @@ func extractJSONAuto(proxiesChan chan<- *proxy.Proxy, body []byte) (int64, error
 	for _, combo := range fieldCombos {
 		extractJSONArray(proxiesChan, data, combo.ipFields, combo.portFields, seen, &totalProxyCount)
 		if totalProxyCount > 0 {
-			logrus.Debugf("extractJSONAuto: matched with fields ip=%v, port=%v", combo.ipFields, combo.portFields)
+			log.Debugf("extractJSONAuto: matched with fields ip=%v, port=%v", combo.ipFields, combo.portFields)
 			break
 		}
 	}
@@ -459,7 +466,7 @@ func extractJSONAuto(proxiesChan chan<- *proxy.Proxy, body []byte) (int64, error
 }
 
 // searchJSONRecursive 遞歸搜尋 JSON 中嘅代理
-func searchJSONRecursive(data any, proxiesChan chan<- *proxy.Proxy, seen map[string]bool, count *int64) {
+func searchJSONRecursive(data any, proxiesChan chan<- *pool.Proxy, seen map[string]bool, count *int64) {
 	switch v := data.(type) {
 	case map[string]any:
 		// 嘗試從呢個對象提取
@@ -479,8 +486,8 @@ func searchJSONRecursive(data any, proxiesChan chan<- *proxy.Proxy, seen map[str
 }
 
 // extractFromHTMLWithRule 使用規則從 HTML 提取
-func extractFromHTMLWithRule(proxiesChan chan<- *proxy.Proxy, body []byte, rule ExtractRule) (int64, error) {
-	logrus.Debugf("extractFromHTMLWithRule: rule=%s", rule.Name)
+func extractFromHTMLWithRule(proxiesChan chan<- *pool.Proxy, body []byte, rule ExtractRule) (int64, error) {
+	log.Debugf("extractFromHTMLWithRule: rule=%s", rule.Name)
 
 	var totalProxyCount int64
 
@@ -492,6 +499,13 @@ func extractFromHTMLWithRule(proxiesChan chan<- *proxy.Proxy, body []byte, rule
 	// 清理無用標籤
 	doc.Find("script, style, noscript, iframe, head, meta, link, textarea, nav").Remove()
 
+	// 有可識別表頭時按列讀取，可同時得到協議、國家等信息
+	e := newEmitter(proxiesChan)
+	parseHTMLTables(e, doc)
+	if e.count > 0 {
+		return e.count, nil
+	}
+
 	selector := rule.TableSelector
 	if selector == "" {
 		selector = "tr"
@@ -523,7 +537,7 @@ func extractFromHTMLWithRule(proxiesChan chan<- *proxy.Proxy, body []byte, rule
 		if isValidIP(ip) && isValidPort(port) {
 			key := ip + ":" + port
 			if !seenProxy(key) {
-				p := &proxy.Proxy{
+				p := &pool.Proxy{
 					IP:       ip,
 					Port:     port,
 					Protocol: "http",
@@ -539,8 +553,8 @@ func extractFromHTMLWithRule(proxiesChan chan<- *proxy.Proxy, body []byte, rule
 }
 
 // extractHTMLAuto HTML 自動探測提取
-func extractHTMLAuto(proxiesChan chan<- *proxy.Proxy, body []byte) (int64, error) {
-	logrus.Debug("extractHTMLAuto: starting auto-detection")
+func extractHTMLAuto(proxiesChan chan<- *pool.Proxy, body []byte) (int64, error) {
+	log.Debug("extractHTMLAuto: starting auto-detection")
 
 	var totalProxyCount int64
 
@@ -583,7 +597,7 @@ func extractHTMLAuto(proxiesChan chan<- *proxy.Proxy, body []byte) (int64, error
 				key := ip + ":" + port
 				if !seen[key] {
 					seen[key] = true
-					p := &proxy.Proxy{
+					p := &pool.Proxy{
 						IP:       ip,
 						Port:     port,
 						Protocol: "http",
@@ -604,8 +618,8 @@ func extractHTMLAuto(proxiesChan chan<- *proxy.Proxy, body []byte) (int64, error
 }
 
 // extractByRegex 正則提取（最後防線）
-func extractByRegex(proxiesChan chan<- *proxy.Proxy, body []byte) (int64, error) {
-	logrus.Debug("extractByRegex: starting regex extraction")
+func extractByRegex(proxiesChan chan<- *pool.Proxy, body []byte) (int64, error) {
+	log.Debug("extractByRegex: starting regex extraction")
 
 	var totalProxyCount int64
 	seen := make(map[string]bool)
@@ -638,7 +652,7 @@ func extractByRegex(proxiesChan chan<- *proxy.Proxy, body []byte) (int64, error)
 			protocol = "http"
 		}
 
-		p := &proxy.Proxy{
+		p := &pool.Proxy{
 			IP:       result["ip"],
 			Port:     result["port"],
 			Protocol: protocol,
@@ -665,7 +679,7 @@ func extractByRegex(proxiesChan chan<- *proxy.Proxy, body []byte) (int64, error)
 		}
 		seen[key] = true
 
-		p := &proxy.Proxy{
+		p := &pool.Proxy{
 			IP:       m[1],
 			Port:     m[2],
 			Protocol: "http",
@@ -692,7 +706,7 @@ func extractByRegex(proxiesChan chan<- *proxy.Proxy, body []byte) (int64, error)
 		}
 		seen[key] = true
 
-		p := &proxy.Proxy{
+		p := &pool.Proxy{
 			IP:       m[1],
 			Port:     m[2],
 			Protocol: "http",
@@ -6,9 +6,9 @@ import (
 	"sync"
 	"testing"
 
-	"github.com/e2u/dynamic-proxy/internal/proxy"
+	"github.com/e2u/dynamic-proxy/internal/logging"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
 	"github.com/e2u/e2util/e2test"
-	"github.com/sirupsen/logrus"
 )
 
 func Helper_loadTestData(filename string) []byte {
@@ -27,7 +27,7 @@ func TestMain(m *testing.M) {
 }
 
 func TestExtractor(t *testing.T) {
-	logrus.SetLevel(logrus.InfoLevel)
+	logging.Setup(logging.Options{Level: "info"})
 
 	tests := []struct {
 		name     string
@@ -55,7 +55,7 @@ func TestExtractor(t *testing.T) {
 				t.Skipf("test data not found: %s", tt.filename)
 			}
 
-			proxiesChan := make(chan *proxy.Proxy, 500)
+			proxiesChan := make(chan *pool.Proxy, 500)
 			var extractedCount int64
 
 			var wg sync.WaitGroup
@@ -82,7 +82,7 @@ func TestExtractor(t *testing.T) {
 }
 
 func TestExtractorAutoDetect(t *testing.T) {
-	logrus.SetLevel(logrus.DebugLevel)
+	logging.Setup(logging.Options{Level: "debug"})
 
 	// 測試無 URL 情況下的自動探測
 	tests := []struct {
@@ -100,7 +100,7 @@ func TestExtractorAutoDetect(t *testing.T) {
 				t.Skipf("test data not found: %s", tt.filename)
 			}
 
-			proxiesChan := make(chan *proxy.Proxy, 500)
+			proxiesChan := make(chan *pool.Proxy, 500)
 			var extractedCount int64
 
 			var wg sync.WaitGroup
@@ -134,7 +134,7 @@ func TestExtractByRegex(t *testing.T) {
 		SOCKS5: socks5://192.168.100.1:1080
 	`)
 
-	proxiesChan := make(chan *proxy.Proxy, 10)
+	proxiesChan := make(chan *pool.Proxy, 10)
 	var extractedCount int64
 
 	var wg sync.WaitGroup
@@ -171,7 +171,7 @@ func TestExtractJSONAuto(t *testing.T) {
 		]
 	`)
 
-	proxiesChan := make(chan *proxy.Proxy, 10)
+	proxiesChan := make(chan *pool.Proxy, 10)
 	var extractedCount int64
 
 	var wg sync.WaitGroup
@@ -204,3 +204,137 @@ func TestLoadTestData(t *testing.T) {
 	}
 	t.Log("Loaded test data length:", len(data))
 }
+
+// collect 運行解析器並收集結果
+func collect(t *testing.T, parser string, body []byte) []*pool.Proxy {
+	t.Helper()
+	p, ok := Lookup(parser)
+	if !ok {
+		t.Fatalf("parser %s not registered", parser)
+	}
+	out := make(chan *pool.Proxy, 10000)
+	if _, err := p.Parse(out, body); err != nil {
+		t.Fatalf("%s: %v", parser, err)
+	}
+	close(out)
+	var proxies []*pool.Proxy
+	for p := range out {
+		proxies = append(proxies, p)
+	}
+	return proxies
+}
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		parser    string
+		filename  string
+		protocols map[string]bool // 允許的協議
+		metadata  bool            // 是否應帶有國家和匿名級別
+	}{
+		{"free-proxy-list", "free-proxy-list.net_en.html", map[string]bool{"http": true}, false},
+		{"free-proxy-list", "en_socks-proxy.html", map[string]bool{"socks4": true, "socks5": true}, false},
+		{"proxyscrape", "api.proxyscrape.com.json", map[string]bool{"http": true, "socks4": true, "socks5": true}, true},
+		{"geonode", "proxylist.geonode.com_01.json", map[string]bool{"http": true, "https": true, "socks4": true, "socks5": true}, true},
+		{"proxifly", "cdn.jsdelivr.net.json", map[string]bool{"http": true, "https": true, "socks4": true, "socks5": true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.parser+"/"+tt.filename, func(t *testing.T) {
+			body := Helper_loadTestData(tt.filename)
+			if body == nil {
+				t.Skipf("test data not found: %s", tt.filename)
+			}
+			proxies := collect(t, tt.parser, body)
+			if len(proxies) == 0 {
+				t.Fatal("no proxies extracted")
+			}
+			withMeta := 0
+			for _, p := range proxies {
+				if !tt.protocols[p.Protocol] {
+					t.Errorf("%s: unexpected protocol %q", p.Key(), p.Protocol)
+				}
+				if p.Country != "" && p.Anonymity != "" {
+					withMeta++
+				}
+			}
+			if tt.metadata && withMeta == 0 {
+				t.Errorf("expected country and anonymity from %s", tt.parser)
+			}
+		})
+	}
+}
+
+func TestParserForURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://free-proxy-list.net/en/socks-proxy.html", "free-proxy-list"},
+		{"https://api.proxyscrape.com/v4/free-proxy-list/get?request=get_proxies", "proxyscrape"},
+		{"https://proxylist.geonode.com/api/proxy-list?limit=500", "geonode"},
+		{"https://cdn.jsdelivr.net/gh/proxifly/free-proxy-list@main/proxies/all/data.json", "proxifly"},
+		{"https://example.com/proxies.txt", GenericParser},
+	}
+	for _, tt := range tests {
+		if got := ParserForURL(tt.url); got != tt.want {
+			t.Errorf("ParserForURL(%s) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestExtractFallback(t *testing.T) {
+	// 指定的解析器沒有結果時退回通用解析器
+	out := make(chan *pool.Proxy, 10)
+	n, err := Extract(out, []byte("1.2.3.4:8080\n"), "https://proxylist.geonode.com/", "")
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Extract returned %d, want 1", n)
+	}
+	close(out)
+	if n := len(out); n != 1 {
+		t.Errorf("extracted %d proxies, want 1", n)
+	}
+
+	if _, err := Extract(make(chan *pool.Proxy, 1), nil, "", "no-such-parser"); err == nil {
+		t.Error("expected error for unknown parser")
+	}
+}
+
+func TestHTMLTableColumns(t *testing.T) {
+	body := []byte(`<html><body><table>
+<thead><tr><th>IP Address</th><th>Port</th><th>Code</th><th>Country</th><th>Anonymity</th><th>Google</th><th>Https</th><th>Last Checked</th></tr></thead>
+<tbody>
+<tr><td>1.2.3.4</td><td>8080</td><td>DE</td><td>Germany</td><td>elite proxy</td><td>yes</td><td>yes</td><td>1 min ago</td></tr>
+<tr><td>5.6.7.8</td><td>3128</td><td>ZZ</td><td>Unknown</td><td>transparent</td><td>no</td><td>no</td><td>2 mins ago</td></tr>
+</tbody></table>
+<table><thead><tr><th>IP Address</th><th>Port</th><th>Version</th></tr></thead>
+<tbody><tr><td>9.9.9.9</td><td>1080</td><td>Socks5</td></tr></tbody></table>
+</body></html>`)
+
+	want := map[string]pool.Proxy{
+		"1.2.3.4:8080": {Protocol: "http", Country: "DE", Anonymity: "elite", Google: true, HTTPS: true},
+		"5.6.7.8:3128": {Protocol: "http", Anonymity: "transparent"},
+		"9.9.9.9:1080": {Protocol: "socks5"},
+	}
+
+	// 註冊的解析器與通用規則庫都應讀出各列
+	for _, parser := range []string{"free-proxy-list", GenericParser} {
+		proxies := collect(t, parser, body)
+		if len(proxies) != len(want) {
+			t.Fatalf("%s: extracted %d proxies, want %d", parser, len(proxies), len(want))
+		}
+		for _, p := range proxies {
+			w, ok := want[p.Key()]
+			if !ok {
+				t.Errorf("%s: unexpected proxy %s", parser, p.Key())
+				continue
+			}
+			if p.Protocol != w.Protocol || p.Country != w.Country || p.Anonymity != w.Anonymity ||
+				p.Google != w.Google || p.HTTPS != w.HTTPS {
+				t.Errorf("%s: %s = %+v, want %+v", parser, p.Key(), *p, w)
+			}
+		}
+	}
+}
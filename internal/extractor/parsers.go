@@ -0,0 +1,283 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// 內置解析器
+func init() {
+	Register(GenericParser, ParserFunc(func(out chan<- *pool.Proxy, body []byte) (int64, error) {
+		return extractGeneric(out, body, ""), nil
+	}))
+	Register("free-proxy-list", ParserFunc(parseFreeProxyList), "free-proxy-list.net", "us-proxy.org")
+	Register("proxyscrape", ParserFunc(parseProxyScrape), "proxyscrape.com")
+	Register("geonode", ParserFunc(parseGeonode), "proxylist.geonode.com")
+	Register("proxifly", ParserFunc(parseProxifly), "proxifly/free-proxy-list")
+	Register("text", ParserFunc(extractByRegex))
+}
+
+// emitter 發送代理並按 ip:port 去重
+type emitter struct {
+	out   chan<- *pool.Proxy
+	seen  map[string]bool
+	count int64
+}
+
+func newEmitter(out chan<- *pool.Proxy) *emitter {
+	return &emitter{out: out, seen: make(map[string]bool)}
+}
+
+// emit 校驗並發送代理，協議為空時按 http 處理
+func (e *emitter) emit(p *pool.Proxy) {
+	p.IP = strings.TrimSpace(p.IP)
+	p.Port = strings.TrimSpace(p.Port)
+	if !isValidIP(p.IP) || !isValidPort(p.Port) {
+		return
+	}
+	key := p.IP + ":" + p.Port
+	if e.seen[key] {
+		return
+	}
+	e.seen[key] = true
+
+	p.Protocol = strings.ToLower(strings.TrimSpace(p.Protocol))
+	if p.Protocol == "" {
+		p.Protocol = "http"
+	}
+	p.Addr = key
+	e.out <- p
+	e.count++
+}
+
+// flexString JSON 中可能是字符串也可能是數字的字段（如端口）
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var v string
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*s = flexString(v)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*s = flexString(n.String())
+	return nil
+}
+
+// normalizeAnonymity 統一各來源的匿名級別寫法
+func normalizeAnonymity(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case strings.HasPrefix(s, "elite"), strings.Contains(s, "high"):
+		return "elite"
+	case strings.HasPrefix(s, "anonymous"), s == "anm":
+		return "anonymous"
+	case strings.HasPrefix(s, "transparent"), s == "noa":
+		return "transparent"
+	}
+	return ""
+}
+
+// normalizeCountry 統一國家代碼，未知（如 ZZ）返回空
+func normalizeCountry(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) != 2 || s == "ZZ" || s == "XX" {
+		return ""
+	}
+	return s
+}
+
+// tableHeaders 表頭文字（小寫）到代理字段的映射
+var tableHeaders = map[string]string{
+	"ip address":      "ip",
+	"ip":              "ip",
+	"port":            "port",
+	"code":            "code",
+	"country code":    "code",
+	"country":         "country",
+	"anonymity":       "anonymity",
+	"anonymity level": "anonymity",
+	"google":          "google",
+	"https":           "https",
+	"version":         "protocol",
+	"protocol":        "protocol",
+}
+
+// tableColumns 按表頭返回字段到列序號的映射，同一字段取第一個匹配的列
+func tableColumns(table *goquery.Selection) map[string]int {
+	cols := make(map[string]int)
+	headers := table.Find("thead th")
+	if headers.Length() == 0 {
+		headers = table.Find("tr").First().Find("th")
+	}
+	headers.Each(func(i int, th *goquery.Selection) {
+		field, ok := tableHeaders[strings.ToLower(strings.TrimSpace(th.Text()))]
+		if _, seen := cols[field]; ok && !seen {
+			cols[field] = i
+		}
+	})
+	return cols
+}
+
+// parseHTMLTables 解析帶表頭的代理表格，沒有 IP 與端口列的表格會被跳過
+// 除 IP 和端口外還讀取協議（Version 列，如 Socks4/Socks5）、國家代碼、匿名級別及 Google / Https 標記
+func parseHTMLTables(e *emitter, doc *goquery.Document) {
+	doc.Find("table").Each(func(_ int, table *goquery.Selection) {
+		cols := tableColumns(table)
+		if _, ok := cols["ip"]; !ok {
+			return
+		}
+		if _, ok := cols["port"]; !ok {
+			return
+		}
+
+		table.Find("tr").Each(func(_ int, tr *goquery.Selection) {
+			tds := tr.Find("td")
+			if tds.Length() == 0 {
+				return
+			}
+			cell := func(field string) string {
+				i, ok := cols[field]
+				if !ok {
+					return ""
+				}
+				return strings.TrimSpace(tds.Eq(i).Text())
+			}
+			p := &pool.Proxy{
+				IP:        cell("ip"),
+				Port:      cell("port"),
+				Protocol:  cell("protocol"),
+				Country:   normalizeCountry(cell("code")),
+				Anonymity: normalizeAnonymity(cell("anonymity")),
+				Google:    isYes(cell("google")),
+				HTTPS:     isYes(cell("https")),
+			}
+			// Country 列通常是國家全名，只在沒有 Code 列時嘗試
+			if p.Country == "" {
+				p.Country = normalizeCountry(cell("country"))
+			}
+			e.emit(p)
+		})
+	})
+}
+
+// isYes 判斷表格中的是/否標記
+func isYes(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes", "true", "1", "+":
+		return true
+	}
+	return false
+}
+
+// parseFreeProxyList 解析 free-proxy-list.net 系列表格（按表頭定位列）
+func parseFreeProxyList(out chan<- *pool.Proxy, body []byte) (int64, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	e := newEmitter(out)
+	parseHTMLTables(e, doc)
+	return e.count, nil
+}
+
+// parseProxyScrape 解析 proxyscrape v4 JSON
+func parseProxyScrape(out chan<- *pool.Proxy, body []byte) (int64, error) {
+	var resp struct {
+		Proxies []struct {
+			IP        string     `json:"ip"`
+			Port      flexString `json:"port"`
+			Protocol  string     `json:"protocol"`
+			Anonymity string     `json:"anonymity"`
+			IPData    struct {
+				CountryCode string `json:"countryCode"`
+			} `json:"ip_data"`
+		} `json:"proxies"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0, err
+	}
+
+	e := newEmitter(out)
+	for _, r := range resp.Proxies {
+		e.emit(&pool.Proxy{
+			IP:        r.IP,
+			Port:      string(r.Port),
+			Protocol:  r.Protocol,
+			Country:   normalizeCountry(r.IPData.CountryCode),
+			Anonymity: normalizeAnonymity(r.Anonymity),
+		})
+	}
+	return e.count, nil
+}
+
+// parseGeonode 解析 proxylist.geonode.com JSON
+func parseGeonode(out chan<- *pool.Proxy, body []byte) (int64, error) {
+	var resp struct {
+		Data []struct {
+			IP             string     `json:"ip"`
+			Port           flexString `json:"port"`
+			Protocols      []string   `json:"protocols"`
+			Country        string     `json:"country"`
+			AnonymityLevel string     `json:"anonymityLevel"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0, err
+	}
+
+	e := newEmitter(out)
+	for _, r := range resp.Data {
+		p := &pool.Proxy{
+			IP:        r.IP,
+			Port:      string(r.Port),
+			Country:   normalizeCountry(r.Country),
+			Anonymity: normalizeAnonymity(r.AnonymityLevel),
+		}
+		if len(r.Protocols) > 0 {
+			p.Protocol = r.Protocols[0]
+		}
+		e.emit(p)
+	}
+	return e.count, nil
+}
+
+// parseProxifly 解析 proxifly/free-proxy-list 的 data.json
+func parseProxifly(out chan<- *pool.Proxy, body []byte) (int64, error) {
+	var list []struct {
+		IP          string     `json:"ip"`
+		Port        flexString `json:"port"`
+		Protocol    string     `json:"protocol"`
+		Anonymity   string     `json:"anonymity"`
+		Geolocation struct {
+			Country string `json:"country"`
+		} `json:"geolocation"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return 0, err
+	}
+
+	e := newEmitter(out)
+	for _, r := range list {
+		e.emit(&pool.Proxy{
+			IP:        r.IP,
+			Port:      string(r.Port),
+			Protocol:  r.Protocol,
+			Country:   normalizeCountry(r.Geolocation.Country),
+			Anonymity: normalizeAnonymity(r.Anonymity),
+		})
+	}
+	return e.count, nil
+}
@@ -0,0 +1,111 @@
+package extractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// GenericParser 通用解析器名稱（按規則庫、JSON/HTML 自動探測、正則依次嘗試）
+const GenericParser = "generic"
+
+// Parser 按來源格式解析代理列表，返回發送到 out 的代理數
+type Parser interface {
+	Parse(out chan<- *pool.Proxy, body []byte) (int64, error)
+}
+
+// ParserFunc 函數形式的 Parser
+type ParserFunc func(out chan<- *pool.Proxy, body []byte) (int64, error)
+
+// Parse 實現 Parser
+func (f ParserFunc) Parse(out chan<- *pool.Proxy, body []byte) (int64, error) {
+	return f(out, body)
+}
+
+// registration 已註冊的解析器及其自動匹配的 URL 關鍵字
+type registration struct {
+	parser    Parser
+	matchURLs []string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+// Register 註冊命名解析器，matchURLs 為未指定解析器時按 URL 自動選擇所用的關鍵字
+// 同名重複註冊時 panic（屬於程序錯誤）
+func Register(name string, p Parser, matchURLs ...string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("extractor: duplicate parser %s", name))
+	}
+	registry[name] = registration{parser: p, matchURLs: matchURLs}
+}
+
+// Lookup 按名稱查找解析器
+func Lookup(name string) (Parser, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[name]
+	return r.parser, ok
+}
+
+// Names 返回所有已註冊的解析器名稱（已排序）
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParserForURL 按 URL 關鍵字選擇解析器，沒有匹配時返回通用解析器
+func ParserForURL(url string) string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	// 多個解析器匹配時取最長關鍵字，結果與註冊順序無關
+	best, bestLen := GenericParser, 0
+	for name, r := range registry {
+		for _, m := range r.matchURLs {
+			if m != "" && strings.Contains(url, m) && len(m) > bestLen {
+				best, bestLen = name, len(m)
+			}
+		}
+	}
+	return best
+}
+
+// Extract 使用指定解析器（為空時按 URL 自動選擇）提取代理，返回提取到的代理數；專用解析器沒有結果時退回通用解析器
+func Extract(out chan<- *pool.Proxy, body []byte, url, parser string) (int64, error) {
+	if parser == "" {
+		parser = ParserForURL(url)
+	}
+	p, ok := Lookup(parser)
+	if !ok {
+		return 0, fmt.Errorf("unknown parser %q", parser)
+	}
+
+	count, err := p.Parse(out, body)
+	if err != nil {
+		log.WithField("url", url).Warnf("parser %s failed: %v", parser, err)
+	}
+	if count > 0 {
+		log.WithField("url", url).Infof("parser %s found %d proxies", parser, count)
+		return count, nil
+	}
+	if parser == GenericParser {
+		return 0, nil
+	}
+
+	log.WithField("url", url).Infof("parser %s found no proxies, falling back to %s", parser, GenericParser)
+	return extractGeneric(out, body, url), nil
+}
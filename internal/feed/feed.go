@@ -0,0 +1,120 @@
+// Package feed 把代理池的變化（代理通過驗證、被禁用、被刪除）實時推送給訂閱者，
+// 供外部程序維護自己的代理列表鏡像而不必輪詢
+package feed
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// 事件類型
+const (
+	ProxyValidated = "proxy_validated" // 代理通過驗證（首次驗證、重新驗證或恢復可用）
+	ProxyDisabled  = "proxy_disabled"  // 代理由可用變為禁用
+	ProxyDeleted   = "proxy_deleted"   // 代理被刪除
+)
+
+// Event 推送的事件
+type Event struct {
+	ID    uint64      `json:"id"`
+	Type  string      `json:"type"`
+	Time  time.Time   `json:"time"`
+	Key   string      `json:"key"`             // 代理鍵（ip:port）
+	Proxy *pool.Proxy `json:"proxy,omitempty"` // 事件發生時的代理記錄，刪除時記錄無法解析則為空
+}
+
+// Subscription 一個訂閱；訂閱者跟不上推送（緩衝區已滿）或 Hub 關閉時 C 被關閉，
+// 訂閱者應重新訂閱並全量同步一次
+type Subscription struct {
+	C <-chan Event
+
+	c     chan Event
+	types []string
+}
+
+// Hub 向訂閱者廣播事件，可並發使用
+type Hub struct {
+	mu     sync.Mutex
+	next   uint64
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub 創建 Hub
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe 訂閱事件，types 為空表示全部類型；buffer 為推送緩衝的事件數（至少 1）。Hub 已關閉時返回已關閉的訂閱
+func (h *Hub) Subscribe(buffer int, types ...string) *Subscription {
+	c := make(chan Event, max(buffer, 1))
+	s := &Subscription{C: c, c: c, types: types}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c)
+		return s
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe 取消訂閱並關閉 C，可重複調用
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s)
+}
+
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
+
+// Subscribers 當前訂閱者數
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Publish 向訂閱了該類型的訂閱者推送事件，不阻塞；緩衝區已滿的訂閱者被斷開
+func (h *Hub) Publish(typ, key string, p *pool.Proxy) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed || len(h.subs) == 0 {
+		return
+	}
+	h.next++
+	e := Event{ID: h.next, Type: typ, Time: time.Now(), Key: key}
+	if p != nil {
+		// 複製一份，避免調用方之後修改記錄
+		cp := *p
+		e.Proxy = &cp
+	}
+	for s := range h.subs {
+		if len(s.types) > 0 && !slices.Contains(s.types, typ) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Close 關閉全部訂閱，之後的推送被忽略
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subs {
+		h.remove(s)
+	}
+}
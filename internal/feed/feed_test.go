@@ -0,0 +1,55 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	all := h.Subscribe(8)
+	disabled := h.Subscribe(8, ProxyDisabled)
+	slow := h.Subscribe(1)
+
+	p := &pool.Proxy{IP: "1.2.3.4", Port: "8080", Protocol: "http"}
+	h.Publish(ProxyValidated, p.Key(), p)
+	p.Protocol = "socks5"
+	h.Publish(ProxyDisabled, p.Key(), p)
+
+	e := <-all.C
+	if e.ID != 1 || e.Type != ProxyValidated || e.Key != "1.2.3.4:8080" || e.Proxy.Protocol != "http" {
+		t.Errorf("first event = %+v, want validated http proxy", e)
+	}
+	if e := <-all.C; e.Type != ProxyDisabled || e.ID != 2 {
+		t.Errorf("second event = %+v, want disabled", e)
+	}
+	if e := <-disabled.C; e.Type != ProxyDisabled {
+		t.Errorf("filtered event = %+v, want disabled", e)
+	}
+	select {
+	case e := <-disabled.C:
+		t.Errorf("unexpected event for filtered subscriber: %+v", e)
+	default:
+	}
+
+	// 緩衝區已滿的訂閱者被斷開
+	<-slow.C
+	if _, ok := <-slow.C; ok {
+		t.Error("slow subscriber was not disconnected")
+	}
+	if n := h.Subscribers(); n != 2 {
+		t.Errorf("subscribers = %d, want 2", n)
+	}
+
+	h.Unsubscribe(disabled)
+	h.Unsubscribe(disabled)
+	h.Close()
+	if _, ok := <-all.C; ok {
+		t.Error("subscription still open after Close")
+	}
+	if _, ok := <-h.Subscribe(1).C; ok {
+		t.Error("subscription after Close is open")
+	}
+	h.Publish(ProxyDeleted, "1.2.3.4:8080", nil)
+}
@@ -0,0 +1,62 @@
+package fetcher
+
+import (
+	"maps"
+	"net/http"
+	"sync"
+)
+
+// Validator 響應的緩存校驗信息，用於條件請求
+type Validator struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// ConditionalCache 按 URL 記錄響應的 ETag / Last-Modified，再次請求時帶上 If-None-Match / If-Modified-Since，
+// 內容未變化的列表由服務器返回 304 而不重新下載；可並發使用
+type ConditionalCache struct {
+	mu      sync.Mutex
+	entries map[string]Validator
+}
+
+// NewConditionalCache 以已保存的校驗信息創建緩存
+func NewConditionalCache(entries map[string]Validator) *ConditionalCache {
+	c := &ConditionalCache{entries: make(map[string]Validator, len(entries))}
+	maps.Copy(c.entries, entries)
+	return c
+}
+
+// Apply 給請求 url 設置條件請求頭
+func (c *ConditionalCache) Apply(url string, h http.Header) {
+	c.mu.Lock()
+	v, ok := c.entries[url]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	if v.ETag != "" {
+		h.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		h.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// Store 記錄 url 的響應頭中的校驗信息，響應沒有校驗信息時刪除記錄
+func (c *ConditionalCache) Store(url string, h http.Header) {
+	v := Validator{ETag: h.Get("ETag"), LastModified: h.Get("Last-Modified")}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v == (Validator{}) {
+		delete(c.entries, url)
+		return
+	}
+	c.entries[url] = v
+}
+
+// Entries 返回所有校驗信息的副本，供持久化
+func (c *ConditionalCache) Entries() map[string]Validator {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.entries)
+}
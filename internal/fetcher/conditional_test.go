@@ -0,0 +1,28 @@
+package fetcher
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestConditionalCache(t *testing.T) {
+	c := NewConditionalCache(map[string]Validator{"https://a/list.txt": {ETag: `"v1"`}})
+
+	h := http.Header{}
+	c.Apply("https://a/list.txt", h)
+	if h.Get("If-None-Match") != `"v1"` || h.Get("If-Modified-Since") != "" {
+		t.Errorf("headers = %v", h)
+	}
+
+	c.Store("https://a/list.txt", http.Header{"Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"}})
+	h = http.Header{}
+	c.Apply("https://a/list.txt", h)
+	if h.Get("If-None-Match") != "" || h.Get("If-Modified-Since") != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("headers after store = %v", h)
+	}
+
+	c.Store("https://a/list.txt", http.Header{})
+	if len(c.Entries()) != 0 {
+		t.Errorf("entries = %v, want none after response without validators", c.Entries())
+	}
+}
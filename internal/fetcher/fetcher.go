@@ -2,44 +2,80 @@ package fetcher
 
 import (
 	"math/rand"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/e2u/dynamic-proxy/internal/logging"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/retry"
 	"github.com/gocolly/colly/v2"
-	"github.com/sirupsen/logrus"
 )
 
-// UserAgents 多個 UserAgent 用於輪換
+var log = logging.For("fetcher")
+
+// UserAgents 內置的 UserAgent 池（近期版本的常見瀏覽器），未配置 gather.user_agents 時從中輪換
 var UserAgents = []string{
-	// iOS Safari
-	"Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
-	// Android Chrome
-	"Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Mobile Safari/537.36",
 	// Windows Chrome
-	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36",
-	// macOS Safari
-	"Mozilla/5.0 (Macintosh; Intel Mac OS X 13_5_1) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Safari/605.1.15",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36",
+	// Windows Edge
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36 Edg/131.0.0.0",
 	// Windows Firefox
-	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:117.0) Gecko/20100101 Firefox/117.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:133.0) Gecko/20100101 Firefox/133.0",
 	// macOS Chrome
-	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+	// macOS Safari
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Safari/605.1.15",
+	// macOS Firefox
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:133.0) Gecko/20100101 Firefox/133.0",
+	// Linux Chrome
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+	// iOS Safari
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 18_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Mobile/15E148 Safari/604.1",
+	// Android Chrome
+	"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Mobile Safari/537.36",
 }
 
 // CollectorConfig 爬蟲配置
+//
+// Delay、RandomDelay、Parallelism 按域名分別生效：Hosts 中的每個主機各自計算間隔與並發，
+// 其餘主機（如重定向目標）共用一組限制。Domains 按順序匹配，覆蓋匹配主機的預設值
 type CollectorConfig struct {
-	UserAgent     string
-	Timeout       time.Duration
-	RandomDelay   time.Duration
-	Parallelism   int
-	MaxRetries    int
-	IgnoreRobots  bool
+	UserAgent    string   // 固定的 UserAgent，為空時從 UserAgents 中隨機選擇
+	UserAgents   []string // UserAgent 池，為空時使用內置的 UserAgents
+	Timeout      time.Duration
+	Delay        time.Duration // 同一域名相鄰請求的最小間隔
+	RandomDelay  time.Duration // 在 Delay 之上額外的隨機延遲（0 到 RandomDelay）
+	Parallelism  int           // 同一域名的最大並發請求數
+	Domains      []DomainLimit
+	Hosts        []string     // 預先知道的主機名（通常為各來源 URL 的主機）
+	Retry        retry.Policy // 請求的重試策略（限流 429、5xx 及網絡錯誤）
+	IgnoreRobots bool
+}
+
+// DomainLimit 按域名覆蓋的請求間隔與並發，Domain 為 path.Match 通配符（如 *.example.com）
+type DomainLimit struct {
+	Domain      string
+	Delay       time.Duration
+	RandomDelay time.Duration
+	Parallelism int
 }
 
 // DefaultConfig 預設配置
 var DefaultConfig = CollectorConfig{
-	Timeout:      30 * time.Second,
-	RandomDelay:  2 * time.Second,
-	Parallelism:  2,
-	MaxRetries:   3,
+	Timeout:     30 * time.Second,
+	Delay:       time.Second,
+	RandomDelay: 2 * time.Second,
+	Parallelism: 1,
+	Retry: retry.Policy{
+		MaxAttempts: 3,
+		RetryOn:     []string{retry.ErrorTimeout, retry.ErrorConnect, retry.ErrorReset},
+		RetryStatus: []int{429, 500, 502, 503, 504},
+		Backoff:     2 * time.Second,
+	},
 	IgnoreRobots: true,
 }
 
@@ -53,74 +89,84 @@ func NewCollyWithConfig(cfg CollectorConfig) *colly.Collector {
 	c := colly.NewCollector()
 	c.Init()
 
-	// 隨機選擇 UserAgent
-	if cfg.UserAgent == "" {
-		c.UserAgent = UserAgents[rand.Intn(len(UserAgents))]
-	} else {
-		c.UserAgent = cfg.UserAgent
+	// 未指定時從 UserAgent 池中隨機選擇，同一個 Collector 的請求（如分頁）使用同一個 UserAgent
+	c.UserAgent = cfg.UserAgent
+	if c.UserAgent == "" {
+		c.UserAgent = pickUserAgent(cfg.UserAgents)
 	}
 
 	c.IgnoreRobotsTxt = cfg.IgnoreRobots
 	c.Async = true
 
 	// 設置限制
-	err := c.Limits([]*colly.LimitRule{
-		{
-			DomainGlob:  "*",
-			Parallelism: cfg.Parallelism,
-			RandomDelay: cfg.RandomDelay,
-		},
-	})
-	if err != nil {
-		logrus.Errorf("set colly limits: %v", err)
+	if err := c.Limits(LimitRules(cfg)); err != nil {
+		log.Errorf("set colly limits: %v", err)
 	}
 
 	// 設置超時
 	c.SetRequestTimeout(cfg.Timeout)
 
-	// 重試機制
-	retryCount := make(map[string]int)
+	// 重試機制：在 Transport 層按策略重試，colly 只看到最終結果
+	c.WithTransport(&RetryTransport{Primary: http.DefaultTransport, Policy: cfg.Retry})
 	c.OnError(func(r *colly.Response, err error) {
 		if r == nil {
-			logrus.Debugf("request error: %v", err)
+			log.Debugf("request error: %v", err)
 			return
 		}
+		log.WithFields(logger.Fields{"url": r.Request.URL.String(), "status": r.StatusCode}).WithError(err).Debug("request failed")
+	})
 
-		key := r.Request.URL.String()
-		count := retryCount[key]
-
-		// 429 Too Many Requests - 等待後重試
-		if r.StatusCode == 429 {
-			if count < cfg.MaxRetries {
-				retryCount[key] = count + 1
-				waitTime := time.Duration(count+1) * 5 * time.Second
-				logrus.Debugf("rate limited, waiting %v before retry %d/%d", waitTime, count+1, cfg.MaxRetries)
-				time.Sleep(waitTime)
-				r.Request.Do()
-			} else {
-				logrus.Warnf("max retries reached for %s", key)
-			}
-			return
-		}
+	return c
+}
 
-		// 5xx 錯誤 - 服務器錯誤，嘗試重試
-		if r.StatusCode >= 500 && r.StatusCode < 600 {
-			if count < cfg.MaxRetries {
-				retryCount[key] = count + 1
-				logrus.Debugf("server error %d, retrying %d/%d", r.StatusCode, count+1, cfg.MaxRetries)
-				time.Sleep(time.Duration(count+1) * time.Second)
-				r.Request.Do()
+// LimitRules 按配置生成 colly 的限制規則
+//
+// colly 中匹配同一規則的所有域名共用間隔和並發，因此為每個已知主機（URL 中的 host[:port]）
+// 生成一條獨立規則，最後一條 "*" 規則兜底其餘主機
+func LimitRules(cfg CollectorConfig) []*colly.LimitRule {
+	fallback := DomainLimit{Domain: "*", Delay: cfg.Delay, RandomDelay: cfg.RandomDelay, Parallelism: cfg.Parallelism}
+	seen := make(map[string]bool)
+	var rules []*colly.LimitRule
+	for _, host := range cfg.Hosts {
+		host = strings.ToLower(host)
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		limit := fallback
+		for _, d := range cfg.Domains {
+			if ok, _ := path.Match(strings.ToLower(d.Domain), host); ok {
+				limit = d
+				break
 			}
-			return
 		}
+		rule := limitRule(limit)
+		rule.DomainRegexp = "^" + regexp.QuoteMeta(host) + "$"
+		rules = append(rules, rule)
+	}
+	rule := limitRule(fallback)
+	rule.DomainGlob = "*"
+	return append(rules, rule)
+}
 
-		logrus.Debugf("request failed for %s: %d - %v", key, r.StatusCode, err)
-	})
-
-	return c
+// limitRule 把 DomainLimit 轉換為 colly 規則（由調用方設置匹配條件），並發至少為 1
+func limitRule(d DomainLimit) *colly.LimitRule {
+	return &colly.LimitRule{
+		Delay:       d.Delay,
+		RandomDelay: d.RandomDelay,
+		Parallelism: max(d.Parallelism, 1),
+	}
 }
 
-// GetRandomUserAgent 獲取隨機 UserAgent
+// GetRandomUserAgent 從內置的 UserAgent 池中隨機選擇一個
 func GetRandomUserAgent() string {
-	return UserAgents[rand.Intn(len(UserAgents))]
+	return pickUserAgent(nil)
+}
+
+// pickUserAgent 從 pool 中隨機選擇一個 UserAgent，pool 為空時使用內置的 UserAgents
+func pickUserAgent(pool []string) string {
+	if len(pool) == 0 {
+		pool = UserAgents
+	}
+	return pool[rand.Intn(len(pool))]
 }
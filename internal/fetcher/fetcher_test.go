@@ -0,0 +1,96 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimitRules(t *testing.T) {
+	cfg := CollectorConfig{
+		Delay:       time.Second,
+		RandomDelay: 2 * time.Second,
+		Parallelism: 1,
+		Domains: []DomainLimit{
+			{Domain: "*.geonode.com", Delay: 5 * time.Second, Parallelism: 2},
+		},
+		Hosts: []string{"free-proxy-list.net", "proxylist.geonode.com", "Free-Proxy-List.net", ""},
+	}
+	rules := LimitRules(cfg)
+	if len(rules) != 3 {
+		t.Fatalf("got %d rules, want 2 hosts + fallback", len(rules))
+	}
+	for _, r := range rules {
+		if err := r.Init(); err != nil {
+			t.Fatalf("rule %+v: %v", r, err)
+		}
+	}
+
+	fpl, geo, fallback := rules[0], rules[1], rules[2]
+	if !fpl.Match("free-proxy-list.net") || fpl.Match("www.free-proxy-list.net") {
+		t.Errorf("host rule should match its host exactly")
+	}
+	if fpl.Delay != time.Second || fpl.RandomDelay != 2*time.Second || fpl.Parallelism != 1 {
+		t.Errorf("default host rule = %+v", fpl)
+	}
+	if geo.Delay != 5*time.Second || geo.RandomDelay != 0 || geo.Parallelism != 2 {
+		t.Errorf("overridden host rule = %+v", geo)
+	}
+	if fallback.DomainGlob != "*" || !fallback.Match("example.com") {
+		t.Errorf("last rule should match any host: %+v", fallback)
+	}
+}
+
+func TestCollectorDelaysPerDomain(t *testing.T) {
+	var mu sync.Mutex
+	var starts []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		starts = append(starts, time.Now())
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	const delay = 100 * time.Millisecond
+	c := NewCollyWithConfig(CollectorConfig{
+		Timeout:      5 * time.Second,
+		Delay:        delay,
+		Parallelism:  4,
+		Domains:      []DomainLimit{{Domain: u.Host, Delay: delay, Parallelism: 1}},
+		Hosts:        []string{u.Host},
+		IgnoreRobots: true,
+	})
+	for _, path := range []string{"/a", "/b", "/c"} {
+		if err := c.Visit(srv.URL + path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Wait()
+
+	if len(starts) != 3 {
+		t.Fatalf("server saw %d requests, want 3", len(starts))
+	}
+	if spread := starts[2].Sub(starts[0]); spread < 2*delay {
+		t.Errorf("requests to one host spread over %v, want at least %v", spread, 2*delay)
+	}
+}
+
+func TestCollectorUserAgent(t *testing.T) {
+	pool := []string{"UA-1", "UA-2"}
+	for range 20 {
+		if ua := NewCollyWithConfig(CollectorConfig{UserAgents: pool}).UserAgent; ua != "UA-1" && ua != "UA-2" {
+			t.Fatalf("user agent %q not from the configured pool", ua)
+		}
+	}
+	if ua := NewCollyWithConfig(CollectorConfig{UserAgent: "fixed", UserAgents: pool}).UserAgent; ua != "fixed" {
+		t.Errorf("fixed user agent = %q", ua)
+	}
+	if ua := NewCollyWithConfig(CollectorConfig{}).UserAgent; !slices.Contains(UserAgents, ua) {
+		t.Errorf("default user agent %q not from the built-in pool", ua)
+	}
+}
@@ -0,0 +1,162 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// GitHub 文件的下載地址
+const (
+	CDNGitHub   = "github"   // raw.githubusercontent.com，列出文件使用 GitHub API
+	CDNJSDelivr = "jsdelivr" // cdn.jsdelivr.net，列出文件使用 jsDelivr 數據 API
+)
+
+// 列出倉庫文件的 API 地址
+var (
+	GitHubAPI   = "https://api.github.com"
+	JSDelivrAPI = "https://data.jsdelivr.com/v1"
+)
+
+// GitHubRepo GitHub 倉庫中的一組純文本代理列表
+type GitHubRepo struct {
+	Repo  string   // owner/name
+	Ref   string   // 分支、標籤或提交，為空時為默認分支（jsDelivr 必須指定）
+	Paths []string // 文件路徑，可含 path.Match 通配符（* 不跨越 /）
+	CDN   string   // github（預設）或 jsdelivr
+	Token string   // GitHub API Token（可選，提高列出文件的速率限制）
+}
+
+// ref 下載和列出文件使用的引用
+func (g GitHubRepo) ref() string {
+	if g.Ref == "" {
+		return "HEAD"
+	}
+	return g.Ref
+}
+
+// RawURL 文件 file 的下載地址
+func (g GitHubRepo) RawURL(file string) string {
+	file = strings.TrimPrefix(file, "/")
+	if g.CDN == CDNJSDelivr {
+		return fmt.Sprintf("https://cdn.jsdelivr.net/gh/%s@%s/%s", g.Repo, g.ref(), file)
+	}
+	return fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s", g.Repo, g.ref(), file)
+}
+
+// hasGlob 路徑是否含通配符
+func hasGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// Files 返回匹配 Paths 的文件路徑（保持 Paths 的順序、去重）；沒有通配符時不請求 API
+func (g GitHubRepo) Files(ctx context.Context, client *http.Client) ([]string, error) {
+	var all []string
+	needList := false
+	for _, p := range g.Paths {
+		if hasGlob(p) {
+			needList = true
+			break
+		}
+	}
+	if needList {
+		var err error
+		if all, err = g.list(ctx, client); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range g.Paths {
+		pattern = strings.TrimPrefix(pattern, "/")
+		if !hasGlob(pattern) {
+			if !seen[pattern] {
+				seen[pattern] = true
+				files = append(files, pattern)
+			}
+			continue
+		}
+		for _, f := range all {
+			if ok, _ := path.Match(pattern, f); ok && !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
+}
+
+// list 列出倉庫中的所有文件
+func (g GitHubRepo) list(ctx context.Context, client *http.Client) ([]string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var target string
+	if g.CDN == CDNJSDelivr {
+		target = fmt.Sprintf("%s/packages/gh/%s@%s?structure=flat", JSDelivrAPI, g.Repo, g.ref())
+	} else {
+		target = fmt.Sprintf("%s/repos/%s/git/trees/%s?recursive=1", GitHubAPI, g.Repo, g.ref())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if g.CDN != CDNJSDelivr {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if g.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+g.Token)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", g.Repo, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", g.Repo, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list %s: status %d: %.200s", g.Repo, resp.StatusCode, body)
+	}
+
+	var files []string
+	if g.CDN == CDNJSDelivr {
+		var listing struct {
+			Files []struct {
+				Name string `json:"name"`
+			} `json:"files"`
+		}
+		if err := json.Unmarshal(body, &listing); err != nil {
+			return nil, fmt.Errorf("invalid file listing for %s: %w", g.Repo, err)
+		}
+		for _, f := range listing.Files {
+			files = append(files, strings.TrimPrefix(f.Name, "/"))
+		}
+		return files, nil
+	}
+	var tree struct {
+		Tree []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"tree"`
+		Truncated bool `json:"truncated"`
+	}
+	if err := json.Unmarshal(body, &tree); err != nil {
+		return nil, fmt.Errorf("invalid file listing for %s: %w", g.Repo, err)
+	}
+	if tree.Truncated {
+		log.Warnf("file listing for %s is truncated, some files may not match", g.Repo)
+	}
+	for _, e := range tree.Tree {
+		if e.Type == "blob" {
+			files = append(files, e.Path)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,56 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestGitHubRepoFiles(t *testing.T) {
+	var listed int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/lists/git/trees/HEAD" || r.Header.Get("Authorization") != "Bearer tok" {
+			http.NotFound(w, r)
+			return
+		}
+		listed++
+		fmt.Fprint(w, `{"tree":[
+			{"path":"README.md","type":"blob"},
+			{"path":"http.txt","type":"blob"},
+			{"path":"socks5.txt","type":"blob"},
+			{"path":"proxies","type":"tree"},
+			{"path":"proxies/all.txt","type":"blob"}
+		]}`)
+	}))
+	defer srv.Close()
+	defer func(api string) { GitHubAPI = api }(GitHubAPI)
+	GitHubAPI = srv.URL
+
+	g := GitHubRepo{Repo: "owner/lists", Paths: []string{"proxies/all.txt", "*.txt", "/http.txt"}, Token: "tok"}
+	files, err := g.Files(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Files: %v", err)
+	}
+	if want := []string{"proxies/all.txt", "http.txt", "socks5.txt"}; !slices.Equal(files, want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+
+	g.Paths = []string{"http.txt"}
+	if _, err := g.Files(context.Background(), nil); err != nil || listed != 1 {
+		t.Errorf("plain paths should not list the repository (listed %d times, err %v)", listed, err)
+	}
+}
+
+func TestGitHubRawURL(t *testing.T) {
+	g := GitHubRepo{Repo: "owner/lists"}
+	if got, want := g.RawURL("/http.txt"), "https://raw.githubusercontent.com/owner/lists/HEAD/http.txt"; got != want {
+		t.Errorf("RawURL = %q, want %q", got, want)
+	}
+	g = GitHubRepo{Repo: "owner/lists", Ref: "main", CDN: CDNJSDelivr}
+	if got, want := g.RawURL("a/b.txt"), "https://cdn.jsdelivr.net/gh/owner/lists@main/a/b.txt"; got != want {
+		t.Errorf("RawURL = %q, want %q", got, want)
+	}
+}
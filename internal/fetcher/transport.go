@@ -0,0 +1,83 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/retry"
+)
+
+// RetryTransport 經由 Primary 按策略發送請求（經由代理池時每次重試由 Primary 選擇新出口），
+// 全部失敗後若設置了 Fallback 則退回 Fallback（如本機直連）
+//
+// 網絡錯誤按 Policy.RetryOn 重試，狀態碼在 Policy.RetryStatus 中的響應同樣重試；
+// 只有網絡錯誤才會退回 Fallback，最後一次嘗試得到的 HTTP 響應直接交給調用方處理。
+type RetryTransport struct {
+	Primary  http.RoundTripper
+	Policy   retry.Policy      // 經由 Primary 的重試策略（零值表示只嘗試一次）
+	Fallback http.RoundTripper // 為 nil 時不退回，返回最後一次錯誤
+}
+
+// RoundTrip 實現 http.RoundTripper
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := t.Policy.Attempts()
+	resp, err := retry.DoHTTP(req.Context(), t.Policy, func(ctx context.Context, attempt int) (*http.Response, error) {
+		r, err := rewind(req, attempt-1)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.Primary.RoundTrip(r.WithContext(ctx))
+		if err != nil {
+			log.WithFields(logger.Fields{"url": req.URL.String(), "attempt": attempt}).WithError(err).Debug("request failed")
+		} else if t.Policy.RetryableStatus(resp.StatusCode) && attempt < attempts {
+			log.WithFields(logger.Fields{"url": req.URL.String(), "attempt": attempt, "status": resp.StatusCode}).Debug("retrying on status")
+		}
+		return resp, err
+	})
+	if err == nil || t.Fallback == nil || req.Context().Err() != nil {
+		return resp, err
+	}
+
+	r, rerr := rewind(req, attempts)
+	if rerr != nil {
+		return nil, rerr
+	}
+	log.WithField("url", req.URL.String()).WithError(err).Info("all attempts failed, falling back to direct")
+	return t.Fallback.RoundTrip(r)
+}
+
+// RetryAfter 解析響應的 Retry-After 頭（秒數或 HTTP 日期），返回距 now 還需等待的時長；沒有或無效時為 0
+func RetryAfter(h http.Header, now time.Time) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// rewind 為第 n 次（從 0 開始）發送準備請求，帶請求體的請求需要 GetBody 才能重發
+func rewind(req *http.Request, n int) (*http.Request, error) {
+	if n == 0 || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("cannot retry request with non-rewindable body")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
@@ -0,0 +1,137 @@
+package fetcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/retry"
+)
+
+// anyError 任何網絡錯誤都重試，最多 3 次
+var anyError = retry.Policy{MaxAttempts: 3, RetryOn: []string{retry.ErrorAny}}
+
+// roundTripFunc 以函數實現 http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRetryTransport(t *testing.T) {
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer direct.Close()
+
+	failing := func(calls *int) http.RoundTripper {
+		return roundTripFunc(func(*http.Request) (*http.Response, error) {
+			*calls++
+			return nil, errors.New("proxy refused")
+		})
+	}
+
+	tests := []struct {
+		name       string
+		fallback   http.RoundTripper
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "fallback to direct", fallback: http.DefaultTransport, wantStatus: http.StatusTeapot},
+		{name: "no fallback", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			rt := &RetryTransport{Primary: failing(&calls), Policy: anyError, Fallback: tt.fallback}
+
+			req, _ := http.NewRequest(http.MethodPost, direct.URL, strings.NewReader("body"))
+			resp, err := rt.RoundTrip(req)
+			if calls != 3 {
+				t.Errorf("primary called %d times, want 3", calls)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RoundTrip: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRetryTransportKeepsHTTPErrors(t *testing.T) {
+	calls := 0
+	rt := &RetryTransport{
+		Primary: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{StatusCode: http.StatusForbidden, Body: http.NoBody, Request: r}, nil
+		}),
+		Policy:   anyError,
+		Fallback: http.DefaultTransport,
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden || calls != 1 {
+		t.Errorf("status = %d, calls = %d; want 403 after a single attempt", resp.StatusCode, calls)
+	}
+}
+
+func TestRetryTransportRetryStatus(t *testing.T) {
+	calls := 0
+	rt := &RetryTransport{
+		Primary: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			status := http.StatusTooManyRequests
+			if calls == 2 {
+				status = http.StatusOK
+			}
+			return &http.Response{StatusCode: status, Body: http.NoBody, Request: r}, nil
+		}),
+		Policy: retry.Policy{MaxAttempts: 3, RetryStatus: []int{http.StatusTooManyRequests}},
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 2 {
+		t.Errorf("status = %d, calls = %d; want 200 after 2 attempts", resp.StatusCode, calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tt := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{now.Add(time.Hour).Format(http.TimeFormat), time.Hour},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	} {
+		h := http.Header{}
+		if tt.value != "" {
+			h.Set("Retry-After", tt.value)
+		}
+		if got := RetryAfter(h, now); got != tt.want {
+			t.Errorf("RetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
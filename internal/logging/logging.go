@@ -0,0 +1,243 @@
+// Package logging 命令行程序的日誌配置：基於 log/slog，支持 text/json 輸出和按組件（子系統）設置級別
+//
+// 組件級別可在運行時通過 SetLevel 修改（管理 API PUT /api/log/levels），
+// Setup 會把本包註冊為 pkg/logger 的後端，pkg 下各包的日誌因此使用相同的格式與級別。
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+)
+
+// 日誌輸出格式
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options 日誌配置
+type Options struct {
+	Level      string            // 全局日誌級別
+	Format     string            // 輸出格式：text, json
+	Components map[string]string // 按組件覆蓋的日誌級別（如 validator: trace）
+	Output     io.Writer         // 輸出目標（nil 表示 stderr）
+}
+
+// Levels 當前的全局級別與組件覆蓋級別
+type Levels struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+var (
+	mu        sync.RWMutex
+	level     = logger.LevelInfo
+	overrides = make(map[string]logger.Level)
+	output    = slog.New(newHandler(FormatText, os.Stderr))
+)
+
+func init() {
+	logger.SetBackend(Backend())
+}
+
+// newHandler 創建 slog 處理器，級別過濾由 Backend.Enabled 完成
+func newHandler(format string, out io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{
+		Level: logger.SlogTrace,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && a.Value.Any() == logger.SlogTrace {
+				a.Value = slog.StringValue("TRACE")
+			}
+			return a
+		},
+	}
+	if format == FormatJSON {
+		return slog.NewJSONHandler(out, opts)
+	}
+	return slog.NewTextHandler(out, opts)
+}
+
+// Setup 應用日誌配置（已創建的組件日誌器同時生效）
+func Setup(opts Options) error {
+	lvl := logger.LevelInfo
+	if opts.Level != "" {
+		var err error
+		if lvl, err = logger.ParseLevel(opts.Level); err != nil {
+			return fmt.Errorf("invalid log level %q", opts.Level)
+		}
+	}
+
+	comp := make(map[string]logger.Level, len(opts.Components))
+	for name, s := range opts.Components {
+		l, err := logger.ParseLevel(s)
+		if err != nil {
+			return fmt.Errorf("invalid log level %q for component %s", s, name)
+		}
+		comp[strings.ToLower(name)] = l
+	}
+
+	switch opts.Format {
+	case "", FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("invalid log format %q", opts.Format)
+	}
+
+	out := opts.Output
+	if out == nil {
+		out = os.Stderr
+	}
+
+	h := newHandler(opts.Format, out)
+	mu.Lock()
+	level, overrides, output = lvl, comp, slog.New(h)
+	mu.Unlock()
+
+	// 第三方庫直接使用 slog.Default() 的日誌採用相同格式和全局級別
+	slog.SetDefault(slog.New(globalHandler{h}))
+	logger.SetBackend(Backend())
+	return nil
+}
+
+// SetLevel 在運行時修改日誌級別：component 為空時修改全局級別，
+// lvl 為空時刪除該組件的覆蓋級別（改用全局級別）
+func SetLevel(component, lvl string) error {
+	component = strings.ToLower(strings.TrimSpace(component))
+	if lvl == "" {
+		if component == "" {
+			return fmt.Errorf("global log level must not be empty")
+		}
+		mu.Lock()
+		delete(overrides, component)
+		mu.Unlock()
+		return nil
+	}
+
+	l, err := logger.ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if component == "" {
+		level = l
+	} else {
+		overrides[component] = l
+	}
+	return nil
+}
+
+// CurrentLevels 返回當前的全局級別與組件覆蓋級別
+func CurrentLevels() Levels {
+	mu.RLock()
+	defer mu.RUnlock()
+	lv := Levels{Level: level.String(), Components: make(map[string]string, len(overrides))}
+	for name, l := range overrides {
+		lv.Components[name] = l.String()
+	}
+	return lv
+}
+
+// For 返回組件日誌器，可在包初始化時調用
+func For(component string) *logger.Entry {
+	return logger.For(strings.ToLower(component))
+}
+
+// Backend 返回按本包配置輸出的 pkg/logger 後端
+func Backend() logger.Backend {
+	return slogBackend{}
+}
+
+type slogBackend struct{}
+
+func (slogBackend) Enabled(component string, l logger.Level) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	if o, ok := overrides[strings.ToLower(component)]; ok {
+		return l >= o
+	}
+	return l >= level
+}
+
+func (slogBackend) Log(component string, l logger.Level, msg string, fields logger.Fields) {
+	mu.RLock()
+	out := output
+	mu.RUnlock()
+
+	attrs := make([]slog.Attr, 0, len(fields)+1)
+	attrs = append(attrs, slog.String("component", strings.ToLower(component)))
+	// 字段按名稱排序，保證文本輸出穩定
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := fields[k]
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		attrs = append(attrs, slog.Any(k, v))
+	}
+	out.LogAttrs(context.Background(), slogLevel(l), msg, attrs...)
+}
+
+// globalHandler 按全局級別過濾的處理器
+type globalHandler struct{ slog.Handler }
+
+func (h globalHandler) Enabled(_ context.Context, l slog.Level) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return l >= slogLevel(level)
+}
+
+func (h globalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return globalHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h globalHandler) WithGroup(name string) slog.Handler {
+	return globalHandler{h.Handler.WithGroup(name)}
+}
+
+// slogLevel 轉換為 slog 級別
+func slogLevel(l logger.Level) slog.Level {
+	switch l {
+	case logger.LevelTrace:
+		return logger.SlogTrace
+	case logger.LevelDebug:
+		return slog.LevelDebug
+	case logger.LevelWarn:
+		return slog.LevelWarn
+	case logger.LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// ParseComponentLevels 解析組件級別列表，格式為 validator=trace,server=debug
+func ParseComponentLevels(s string) (map[string]string, error) {
+	levels := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, lvl, ok := strings.Cut(item, "=")
+		name, lvl = strings.TrimSpace(name), strings.TrimSpace(lvl)
+		if !ok || name == "" || lvl == "" {
+			return nil, fmt.Errorf("invalid component level %q, expected component=level", item)
+		}
+		if _, err := logger.ParseLevel(lvl); err != nil {
+			return nil, fmt.Errorf("invalid log level %q for component %s", lvl, name)
+		}
+		levels[strings.ToLower(name)] = lvl
+	}
+	return levels, nil
+}
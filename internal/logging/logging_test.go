@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+)
+
+func TestParseComponentLevels(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{in: "", want: map[string]string{}},
+		{in: "validator=trace", want: map[string]string{"validator": "trace"}},
+		{in: " Validator = trace , server=debug ", want: map[string]string{"validator": "trace", "server": "debug"}},
+		{in: "validator", wantErr: true},
+		{in: "validator=loud", wantErr: true},
+		{in: "=debug", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseComponentLevels(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseComponentLevels(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseComponentLevels(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("ParseComponentLevels(%q)[%s] = %q, want %q", tt.in, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestComponentLevelsAndJSON(t *testing.T) {
+	var buf bytes.Buffer
+	// 先創建日誌器再應用配置，確認已創建的日誌器也會更新
+	validator := For("validator")
+	server := For("server")
+
+	if err := Setup(Options{
+		Level:      "info",
+		Format:     FormatJSON,
+		Components: map[string]string{"validator": "trace"},
+		Output:     &buf,
+	}); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	defer Setup(Options{})
+
+	validator.WithField("proxy", "1.2.3.4:8080").Trace("validator trace")
+	server.Debug("server debug")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d log lines, want 1: %q", len(lines), buf.String())
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if entry["component"] != "validator" || entry["proxy"] != "1.2.3.4:8080" || entry["msg"] != "validator trace" {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+}
+
+func TestSetupInvalid(t *testing.T) {
+	for _, opts := range []Options{
+		{Level: "loud"},
+		{Format: "xml"},
+		{Components: map[string]string{"server": "loud"}},
+	} {
+		if err := Setup(opts); err == nil {
+			t.Errorf("Setup(%+v) should fail", opts)
+		}
+	}
+}
+
+func TestBackend(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Setup(Options{
+		Level:      "info",
+		Format:     FormatJSON,
+		Components: map[string]string{"pool": "debug"},
+		Output:     &buf,
+	}); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	defer Setup(Options{})
+
+	b := Backend()
+	if !b.Enabled("pool", logger.LevelDebug) || b.Enabled("server", logger.LevelDebug) {
+		t.Fatal("backend should follow component levels")
+	}
+	b.Log("pool", logger.LevelDebug, "pool debug", logger.Fields{"proxy": "1.2.3.4:8080"})
+
+	var entry map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v (%q)", err, buf.String())
+	}
+	if entry["component"] != "pool" || entry["proxy"] != "1.2.3.4:8080" || entry["level"] != "DEBUG" {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Setup(Options{Level: "info", Components: map[string]string{"validator": "error"}, Output: &buf}); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	defer Setup(Options{})
+
+	gather := For("gather")
+	gather.Debug("before")
+	if err := SetLevel("gather", "debug"); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	gather.Debug("after")
+	if strings.Contains(buf.String(), "before") || !strings.Contains(buf.String(), "after") {
+		t.Errorf("component level not applied at runtime: %q", buf.String())
+	}
+
+	if err := SetLevel("", "warn"); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	if err := SetLevel("validator", ""); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	got := CurrentLevels()
+	if got.Level != "warn" || len(got.Components) != 1 || got.Components["gather"] != "debug" {
+		t.Errorf("CurrentLevels() = %+v", got)
+	}
+
+	for _, tt := range []struct{ component, level string }{
+		{"gather", "loud"},
+		{"", ""},
+	} {
+		if err := SetLevel(tt.component, tt.level); err == nil {
+			t.Errorf("SetLevel(%q, %q) should fail", tt.component, tt.level)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DurationBuckets 以秒為單位的耗時直方圖預設區間上界（10ms 至 1 小時）
+var DurationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600}
+
+// HistogramVec 帶標籤的直方圖
+type HistogramVec struct {
+	metricName string
+	help       string
+	labels     []string
+	bounds     []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue // 標籤值（\xff 分隔） -> 分佈
+}
+
+// histogramValue 一組標籤值的分佈：counts 為各區間（不累計）的計數，最後一個為超出最大上界的計數
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec 創建並在預設註冊表中註冊直方圖，bounds 為遞增的區間上界（如 DurationBuckets）
+func NewHistogramVec(name, help string, bounds []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(bounds) {
+		panic(fmt.Sprintf("metrics: %s bucket bounds must be sorted", name))
+	}
+	h := &HistogramVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		bounds:     bounds,
+		values:     make(map[string]*histogramValue),
+	}
+	Default.register(h)
+	return h
+}
+
+// Observe 記錄一個觀測值，labelValues 按創建時的標籤順序傳入
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", h.metricName, len(h.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	i := sort.SearchFloat64s(h.bounds, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv := h.values[key]
+	if hv == nil {
+		hv = &histogramValue{counts: make([]uint64, len(h.bounds)+1)}
+		h.values[key] = hv
+	}
+	hv.counts[i]++
+	hv.count++
+	hv.sum += v
+}
+
+func (h *HistogramVec) name() string { return h.metricName }
+
+func (h *HistogramVec) snapshot() Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	samples := make([]Sample, len(keys))
+	for i, k := range keys {
+		hv := h.values[k]
+		samples[i] = Sample{
+			LabelValues: splitLabelValues(k, h.labels),
+			Bounds:      h.bounds,
+			Counts:      append([]uint64(nil), hv.counts...),
+			Count:       hv.count,
+			Sum:         hv.sum,
+		}
+	}
+	return Family{Name: h.metricName, Help: h.help, Type: TypeHistogram, Labels: h.labels, Samples: samples}
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	f := h.snapshot()
+	writeHeader(w, h.metricName, h.help, TypeHistogram)
+	names := append(append([]string(nil), h.labels...), "le")
+	for _, s := range f.Samples {
+		values := append(append([]string(nil), s.LabelValues...), "")
+		var cumulative uint64
+		for i, bound := range s.Bounds {
+			cumulative += s.Counts[i]
+			values[len(values)-1] = formatValue(bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(names, values), cumulative)
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(names, values), s.Count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, formatLabels(h.labels, s.LabelValues), formatValue(s.Sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, formatLabels(h.labels, s.LabelValues), s.Count)
+	}
+}
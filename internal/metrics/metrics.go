@@ -0,0 +1,318 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// collector 可輸出 Prometheus 文本格式的指標
+type collector interface {
+	name() string
+	write(w io.Writer)
+	snapshot() Family
+}
+
+// 指標類型
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Family 一個指標在某一時刻的所有取值（用於導出到 OTLP 等其他系統）
+type Family struct {
+	Name    string
+	Help    string
+	Type    string // TypeCounter、TypeGauge 或 TypeHistogram
+	Labels  []string
+	Samples []Sample
+}
+
+// Sample 一組標籤值的取值；直方圖的 Counts 為各區間（不累計）的計數，最後一個為超出最大上界的計數
+type Sample struct {
+	LabelValues []string
+	Value       float64
+	Bounds      []float64
+	Counts      []uint64
+	Count       uint64
+	Sum         float64
+}
+
+// Registry 指標註冊表
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// Default 預設註冊表（管理 API 的 /metrics 輸出此註冊表）
+var Default = &Registry{}
+
+// register 註冊指標，同名指標重複註冊時 panic（屬於程序錯誤）
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic(fmt.Sprintf("metrics: duplicate metric %s", c.name()))
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// WritePrometheus 以 Prometheus 文本格式輸出所有指標（按名稱排序）
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.Lock()
+	list := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].name() < list[j].name() })
+	for _, c := range list {
+		c.write(w)
+	}
+}
+
+// Snapshot 返回所有指標的當前取值（按名稱排序）
+func (r *Registry) Snapshot() []Family {
+	r.mu.Lock()
+	list := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].name() < list[j].name() })
+	families := make([]Family, len(list))
+	for i, c := range list {
+		families[i] = c.snapshot()
+	}
+	return families
+}
+
+// Handler 返回輸出 Prometheus 文本格式的 HTTP 處理器
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+// CounterVec 帶標籤的計數器
+type CounterVec struct {
+	metricName string
+	help       string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // 標籤值（\xff 分隔） -> 計數
+}
+
+// NewCounterVec 創建並在預設註冊表中註冊計數器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		values:     make(map[string]float64),
+	}
+	Default.register(c)
+	return c
+}
+
+// Inc 計數加一，labelValues 按創建時的標籤順序傳入
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add 計數增加 v（v 必須非負）
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if len(labelValues) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", c.metricName, len(c.labels), len(labelValues)))
+	}
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.values[strings.Join(labelValues, "\xff")] += v
+	c.mu.Unlock()
+}
+
+// Value 返回指定標籤值的當前計數
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\xff")]
+}
+
+func (c *CounterVec) name() string { return c.metricName }
+
+func (c *CounterVec) snapshot() Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Family{Name: c.metricName, Help: c.help, Type: TypeCounter, Labels: c.labels, Samples: valueSamples(c.values, c.labels)}
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]float64, len(keys))
+	for i, k := range keys {
+		values[i] = c.values[k]
+	}
+	c.mu.Unlock()
+
+	writeHeader(w, c.metricName, c.help, "counter")
+	for i, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, formatLabels(c.labels, strings.Split(k, "\xff")), formatValue(values[i]))
+	}
+}
+
+// GaugeVec 帶標籤的儀表
+type GaugeVec struct {
+	metricName string
+	help       string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // 標籤值（\xff 分隔） -> 當前值
+}
+
+// NewGaugeVec 創建並在預設註冊表中註冊帶標籤的儀表
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		values:     make(map[string]float64),
+	}
+	Default.register(g)
+	return g
+}
+
+// Set 設置指定標籤值的當前值，labelValues 按創建時的標籤順序傳入
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	if len(labelValues) != len(g.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", g.metricName, len(g.labels), len(labelValues)))
+	}
+	g.mu.Lock()
+	g.values[strings.Join(labelValues, "\xff")] = v
+	g.mu.Unlock()
+}
+
+// Replace 以 samples 替換全部取值，不在其中的標籤值組合不再輸出（用於按當前狀態重新統計的儀表）
+func (g *GaugeVec) Replace(samples []Sample) {
+	values := make(map[string]float64, len(samples))
+	for _, s := range samples {
+		if len(s.LabelValues) != len(g.labels) {
+			panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", g.metricName, len(g.labels), len(s.LabelValues)))
+		}
+		values[strings.Join(s.LabelValues, "\xff")] = s.Value
+	}
+	g.mu.Lock()
+	g.values = values
+	g.mu.Unlock()
+}
+
+func (g *GaugeVec) name() string { return g.metricName }
+
+func (g *GaugeVec) snapshot() Family {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return Family{Name: g.metricName, Help: g.help, Type: TypeGauge, Labels: g.labels, Samples: valueSamples(g.values, g.labels)}
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	keys := make([]string, 0, len(g.values))
+	for k := range g.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]float64, len(keys))
+	for i, k := range keys {
+		values[i] = g.values[k]
+	}
+	g.mu.Unlock()
+
+	writeHeader(w, g.metricName, g.help, "gauge")
+	for i, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, formatLabels(g.labels, strings.Split(k, "\xff")), formatValue(values[i]))
+	}
+}
+
+// GaugeFunc 輸出時調用函數取值的儀表
+type GaugeFunc struct {
+	metricName string
+	help       string
+	fn         func() float64
+}
+
+// NewGaugeFunc 創建並在預設註冊表中註冊儀表
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, fn: fn}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metricName }
+
+func (g *GaugeFunc) snapshot() Family {
+	return Family{Name: g.metricName, Help: g.help, Type: TypeGauge, Samples: []Sample{{Value: g.fn()}}}
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatValue(g.fn()))
+}
+
+// valueSamples 把按標籤值（\xff 分隔）記錄的取值轉為按標籤值排序的樣本，調用方持有鎖
+func valueSamples(values map[string]float64, labels []string) []Sample {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	samples := make([]Sample, len(keys))
+	for i, k := range keys {
+		samples[i] = Sample{LabelValues: splitLabelValues(k, labels), Value: values[k]}
+	}
+	return samples
+}
+
+// splitLabelValues 拆分以 \xff 連接的標籤值（沒有標籤時為 nil）
+func splitLabelValues(key string, labels []string) []string {
+	if len(labels) == 0 {
+		return nil
+	}
+	return strings.Split(key, "\xff")
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// formatLabels 格式化標籤，如 {reason="pool_empty"}
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, n := range names {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		parts[i] = n + "=" + strconv.Quote(v)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
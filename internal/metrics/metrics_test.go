@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistryOutput(t *testing.T) {
+	reg := &Registry{}
+	c := &CounterVec{metricName: "test_errors_total", help: "Errors.", labels: []string{"reason"}, values: map[string]float64{}}
+	reg.register(c)
+	reg.register(&GaugeFunc{metricName: "test_pool_size", help: "Pool size.", fn: func() float64 { return 3 }})
+
+	c.Inc("pool_empty")
+	c.Inc("pool_empty")
+	c.Add(2.5, `quo"te`)
+
+	var buf bytes.Buffer
+	reg.WritePrometheus(&buf)
+	want := `# HELP test_errors_total Errors.
+# TYPE test_errors_total counter
+test_errors_total{reason="pool_empty"} 2
+test_errors_total{reason="quo\"te"} 2.5
+# HELP test_pool_size Pool size.
+# TYPE test_pool_size gauge
+test_pool_size 3
+`
+	if buf.String() != want {
+		t.Errorf("output mismatch:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if v := c.Value("pool_empty"); v != 2 {
+		t.Errorf("Value = %v, want 2", v)
+	}
+}
+
+func TestDuplicateRegistration(t *testing.T) {
+	reg := &Registry{}
+	reg.register(&GaugeFunc{metricName: "dup", fn: func() float64 { return 0 }})
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "duplicate") {
+			t.Errorf("expected duplicate panic, got %v", r)
+		}
+	}()
+	reg.register(&GaugeFunc{metricName: "dup", fn: func() float64 { return 0 }})
+}
+
+func TestGaugeVec(t *testing.T) {
+	reg := &Registry{}
+	g := &GaugeVec{metricName: "test_build_info", help: "Build info.", labels: []string{"version", "commit"}, values: map[string]float64{}}
+	reg.register(g)
+
+	g.Set(1, "v1.0.0", "abc123")
+	g.Set(0, "v0.9.0", "def456")
+	g.Set(1, "v0.9.0", "def456")
+
+	var buf bytes.Buffer
+	reg.WritePrometheus(&buf)
+	want := `# HELP test_build_info Build info.
+# TYPE test_build_info gauge
+test_build_info{version="v0.9.0",commit="def456"} 1
+test_build_info{version="v1.0.0",commit="abc123"} 1
+`
+	if buf.String() != want {
+		t.Errorf("output mismatch:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// Replace 刪除不再出現的標籤值組合
+	g.Replace([]Sample{{LabelValues: []string{"v1.1.0", "0a1b2c"}, Value: 1}})
+	buf.Reset()
+	reg.WritePrometheus(&buf)
+	want = `# HELP test_build_info Build info.
+# TYPE test_build_info gauge
+test_build_info{version="v1.1.0",commit="0a1b2c"} 1
+`
+	if buf.String() != want {
+		t.Errorf("output after Replace mismatch:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	reg := &Registry{}
+	h := &HistogramVec{metricName: "test_duration_seconds", help: "Duration.", labels: []string{"result"},
+		bounds: []float64{0.1, 1}, values: map[string]*histogramValue{}}
+	reg.register(h)
+
+	h.Observe(0.05, "ok")
+	h.Observe(0.1, "ok")
+	h.Observe(0.5, "ok")
+	h.Observe(3, "ok")
+
+	var buf bytes.Buffer
+	reg.WritePrometheus(&buf)
+	want := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{result="ok",le="0.1"} 2
+test_duration_seconds_bucket{result="ok",le="1"} 3
+test_duration_seconds_bucket{result="ok",le="+Inf"} 4
+test_duration_seconds_sum{result="ok"} 3.65
+test_duration_seconds_count{result="ok"} 4
+`
+	if buf.String() != want {
+		t.Errorf("output mismatch:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	families := reg.Snapshot()
+	if len(families) != 1 || families[0].Type != TypeHistogram || len(families[0].Samples) != 1 {
+		t.Fatalf("snapshot = %+v", families)
+	}
+	s := families[0].Samples[0]
+	if s.Count != 4 || len(s.Counts) != 3 || s.Counts[0] != 2 || s.Counts[2] != 1 || s.LabelValues[0] != "ok" {
+		t.Errorf("sample = %+v", s)
+	}
+}
@@ -0,0 +1,219 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/logging"
+)
+
+var log = logging.For("notify")
+
+// 事件類型
+const (
+	EventPoolLow         = "pool_low"         // 健康代理數低於閾值
+	EventPoolEmpty       = "pool_empty"       // 沒有健康代理
+	EventPoolRecovered   = "pool_recovered"   // 健康代理數恢復到閾值以上
+	EventGatherCompleted = "gather_completed" // 一輪代理收集完成
+)
+
+// Webhook 類型
+const (
+	KindGeneric  = "generic"  // POST 事件 JSON
+	KindSlack    = "slack"    // Slack Incoming Webhook
+	KindTelegram = "telegram" // Telegram Bot sendMessage
+)
+
+// telegramAPI Telegram Bot API 地址
+const telegramAPI = "https://api.telegram.org"
+
+// Event 通知事件
+type Event struct {
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	Healthy int       `json:"healthy"` // 健康代理數
+	Total   int       `json:"total"`   // 數據庫中的代理總數
+	Time    time.Time `json:"time"`
+}
+
+// Webhook 通知目標
+type Webhook struct {
+	Kind   string   // generic, slack, telegram
+	URL    string   // generic/slack 的 Webhook 地址；telegram 可選，覆蓋 Bot API 地址
+	Token  string   // telegram Bot Token
+	ChatID string   // telegram 會話 ID
+	Events []string // 訂閱的事件（空表示全部）
+}
+
+// wants 是否訂閱了該事件
+func (w Webhook) wants(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier 向配置的 Webhook 發送代理池事件
+type Notifier struct {
+	hooks        []Webhook
+	lowThreshold int
+	client       *http.Client
+
+	mu    sync.Mutex
+	state string // 上一次報告的池狀態，只在狀態變化時通知
+}
+
+// New 校驗 Webhook 配置並創建通知器，lowThreshold <= 0 時不發送 pool_low 事件
+func New(hooks []Webhook, lowThreshold int) (*Notifier, error) {
+	for i, h := range hooks {
+		switch h.Kind {
+		case KindGeneric, KindSlack:
+			if h.URL == "" {
+				return nil, fmt.Errorf("webhook %d: url is required for %s", i, h.Kind)
+			}
+		case KindTelegram:
+			if h.Token == "" || h.ChatID == "" {
+				return nil, fmt.Errorf("webhook %d: token and chat_id are required for telegram", i)
+			}
+		default:
+			return nil, fmt.Errorf("webhook %d: unknown type %q", i, h.Kind)
+		}
+		for _, e := range h.Events {
+			switch e {
+			case EventPoolLow, EventPoolEmpty, EventPoolRecovered, EventGatherCompleted:
+			default:
+				return nil, fmt.Errorf("webhook %d: unknown event %q", i, e)
+			}
+		}
+	}
+	return &Notifier{
+		hooks:        hooks,
+		lowThreshold: lowThreshold,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// ReportPoolHealth 報告當前健康代理數，池狀態變化時（變低、變空、恢復）發送通知
+func (n *Notifier) ReportPoolHealth(healthy, total int) {
+	if n == nil {
+		return
+	}
+
+	state := EventPoolRecovered
+	switch {
+	case healthy == 0:
+		state = EventPoolEmpty
+	case healthy < n.lowThreshold:
+		state = EventPoolLow
+	}
+
+	n.mu.Lock()
+	prev := n.state
+	n.state = state
+	n.mu.Unlock()
+
+	// 首次報告為正常狀態時不通知；狀態未變化時不重複通知
+	if state == prev || (prev == "" && state == EventPoolRecovered) {
+		return
+	}
+
+	var msg string
+	switch state {
+	case EventPoolEmpty:
+		msg = fmt.Sprintf("proxy pool is empty (0 healthy of %d)", total)
+	case EventPoolLow:
+		msg = fmt.Sprintf("healthy proxies dropped to %d (threshold %d, total %d)", healthy, n.lowThreshold, total)
+	default:
+		msg = fmt.Sprintf("healthy proxies recovered to %d (threshold %d, total %d)", healthy, n.lowThreshold, total)
+	}
+	n.Notify(Event{Type: state, Message: msg, Healthy: healthy, Total: total})
+}
+
+// Notify 向訂閱了該事件的所有 Webhook 發送通知（發送失敗只記錄日誌）
+func (n *Notifier) Notify(e Event) {
+	if n == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	for _, h := range n.hooks {
+		if !h.wants(e.Type) {
+			continue
+		}
+		if err := n.send(h, e); err != nil {
+			log.WithField("event", e.Type).WithError(err).Warnf("failed to send %s webhook", h.Kind)
+		}
+	}
+}
+
+// send 按 Webhook 類型構建並發送請求
+func (n *Notifier) send(h Webhook, e Event) error {
+	text := fmt.Sprintf("[dynamic-proxy] %s: %s", e.Type, e.Message)
+
+	target := h.URL
+	var payload any
+	switch h.Kind {
+	case KindSlack:
+		payload = map[string]string{"text": text}
+	case KindTelegram:
+		base := h.URL
+		if base == "" {
+			base = telegramAPI
+		}
+		target = strings.TrimSuffix(base, "/") + "/bot" + h.Token + "/sendMessage"
+		payload = map[string]string{"chat_id": h.ChatID, "text": text}
+	default:
+		payload = e
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// 錯誤信息可能包含 Telegram Token，不記錄完整 URL
+		return fmt.Errorf("request failed: %w", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// unwrapURLError 去掉 *url.Error 中的請求地址
+func unwrapURLError(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return ue.Err
+	}
+	return err
+}
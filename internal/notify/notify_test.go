@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// recorder 記錄收到的 Webhook 請求
+type recorder struct {
+	mu     sync.Mutex
+	paths  []string
+	bodies []map[string]any
+}
+
+func (rec *recorder) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		rec.mu.Lock()
+		rec.paths = append(rec.paths, r.URL.Path)
+		rec.bodies = append(rec.bodies, body)
+		rec.mu.Unlock()
+	})
+}
+
+func TestNewValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    Webhook
+		wantErr bool
+	}{
+		{name: "generic", hook: Webhook{Kind: KindGeneric, URL: "http://example.com/hook"}},
+		{name: "generic without url", hook: Webhook{Kind: KindGeneric}, wantErr: true},
+		{name: "telegram", hook: Webhook{Kind: KindTelegram, Token: "t", ChatID: "1"}},
+		{name: "telegram without chat", hook: Webhook{Kind: KindTelegram, Token: "t"}, wantErr: true},
+		{name: "unknown", hook: Webhook{Kind: "email", URL: "x"}, wantErr: true},
+		{name: "unknown event", hook: Webhook{Kind: KindSlack, URL: "x", Events: []string{"pool_full"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := New([]Webhook{tt.hook}, 5)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestReportPoolHealth(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	n, err := New([]Webhook{
+		{Kind: KindGeneric, URL: srv.URL + "/generic"},
+		{Kind: KindSlack, URL: srv.URL + "/slack", Events: []string{EventPoolEmpty}},
+		{Kind: KindTelegram, URL: srv.URL, Token: "TOKEN", ChatID: "42", Events: []string{EventPoolEmpty}},
+	}, 5)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	n.ReportPoolHealth(10, 20) // 首次報告為正常狀態，不通知
+	n.ReportPoolHealth(3, 20)  // 變低
+	n.ReportPoolHealth(2, 20)  // 仍然偏低，不重複通知
+	n.ReportPoolHealth(0, 20)  // 變空
+	n.ReportPoolHealth(8, 20)  // 恢復
+
+	wantPaths := []string{"/generic", "/generic", "/slack", "/botTOKEN/sendMessage", "/generic"}
+	if len(rec.paths) != len(wantPaths) {
+		t.Fatalf("got requests %v, want %v", rec.paths, wantPaths)
+	}
+	for i, p := range wantPaths {
+		if rec.paths[i] != p {
+			t.Errorf("request %d path = %q, want %q", i, rec.paths[i], p)
+		}
+	}
+
+	wantTypes := map[int]string{0: EventPoolLow, 1: EventPoolEmpty, 4: EventPoolRecovered}
+	for i, typ := range wantTypes {
+		if rec.bodies[i]["type"] != typ {
+			t.Errorf("generic event %d type = %v, want %s", i, rec.bodies[i]["type"], typ)
+		}
+	}
+	if rec.bodies[3]["chat_id"] != "42" || rec.bodies[2]["text"] == nil {
+		t.Errorf("unexpected slack/telegram payloads: %v, %v", rec.bodies[2], rec.bodies[3])
+	}
+}
+
+func TestNilNotifier(t *testing.T) {
+	var n *Notifier
+	n.ReportPoolHealth(0, 0)
+	n.Notify(Event{Type: EventGatherCompleted})
+}
@@ -0,0 +1,162 @@
+// Package paths 按平台約定確定配置文件、數據庫和日誌文件的預設位置
+//
+//	Linux 等  配置 $XDG_CONFIG_HOME/dynamic-proxy（~/.config）
+//	          數據 $XDG_DATA_HOME/dynamic-proxy（~/.local/share）
+//	          日誌 $XDG_STATE_HOME/dynamic-proxy（~/.local/state）
+//	Windows   配置 %APPDATA%\dynamic-proxy
+//	          數據 %LOCALAPPDATA%\dynamic-proxy
+//	          日誌 %LOCALAPPDATA%\dynamic-proxy\logs
+//	macOS     配置與數據 ~/Library/Application Support/dynamic-proxy
+//	          日誌 ~/Library/Logs/dynamic-proxy
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// AppName 各目錄下的應用子目錄名
+const AppName = "dynamic-proxy"
+
+// 文件名
+const (
+	ConfigFile   = "config.yaml"
+	DBDir        = "proxy_badger_db"
+	LogFile      = "dynamic-proxy.log"
+	MITMCAFile   = "mitm-ca.pem"
+	MITMKeyFile  = "mitm-ca-key.pem"
+	ACMECacheDir = "acme"
+	legacyDBPath = DBDir // 舊版本在工作目錄下創建的數據庫
+)
+
+// kind 目錄用途
+type kind int
+
+const (
+	configKind kind = iota
+	dataKind
+	logKind
+)
+
+// ConfigDir 配置文件目錄
+func ConfigDir() (string, error) {
+	return resolve(configKind, runtime.GOOS, os.Getenv, homeDir())
+}
+
+// DataDir 數據目錄（數據庫等）
+func DataDir() (string, error) {
+	return resolve(dataKind, runtime.GOOS, os.Getenv, homeDir())
+}
+
+// LogDir 日誌目錄
+func LogDir() (string, error) {
+	return resolve(logKind, runtime.GOOS, os.Getenv, homeDir())
+}
+
+// DefaultConfigFile 配置目錄下存在 config.yaml 時返回其路徑，否則返回空（使用內置預設配置）
+func DefaultConfigFile() string {
+	dir, err := ConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, ConfigFile)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// DefaultDBPath 預設數據庫目錄：工作目錄下已有舊版數據庫時繼續使用，否則位於數據目錄下
+func DefaultDBPath() string {
+	if fi, err := os.Stat(legacyDBPath); err == nil && fi.IsDir() {
+		return legacyDBPath
+	}
+	dir, err := DataDir()
+	if err != nil {
+		return legacyDBPath
+	}
+	return filepath.Join(dir, DBDir)
+}
+
+// DefaultMITMFiles MITM 模式 CA 證書和私鑰的預設路徑（數據目錄下，無法確定數據目錄時為工作目錄）
+func DefaultMITMFiles() (certFile, keyFile string) {
+	dir, err := DataDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, MITMCAFile), filepath.Join(dir, MITMKeyFile)
+}
+
+// DefaultACMECacheDir ACME 證書與賬戶密鑰的預設緩存目錄（數據目錄下，無法確定數據目錄時為工作目錄）
+func DefaultACMECacheDir() string {
+	dir, err := DataDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, ACMECacheDir)
+}
+
+// DefaultLogFile 預設日誌文件路徑（作為 Windows 服務運行且未配置 log.file 時使用）
+func DefaultLogFile() (string, error) {
+	dir, err := LogDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, LogFile), nil
+}
+
+func homeDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return home
+}
+
+// resolve 按平台和環境變量計算目錄
+func resolve(k kind, goos string, getenv func(string) string, home string) (string, error) {
+	switch goos {
+	case "windows":
+		env := "LOCALAPPDATA"
+		if k == configKind {
+			env = "APPDATA"
+		}
+		base := getenv(env)
+		if base == "" {
+			return "", fmt.Errorf("%%%s%% is not set", env)
+		}
+		if k == logKind {
+			return filepath.Join(base, AppName, "logs"), nil
+		}
+		return filepath.Join(base, AppName), nil
+
+	case "darwin", "ios":
+		if home == "" {
+			return "", errors.New("home directory is not known")
+		}
+		if k == logKind {
+			return filepath.Join(home, "Library", "Logs", AppName), nil
+		}
+		return filepath.Join(home, "Library", "Application Support", AppName), nil
+	}
+
+	env, fallback := "XDG_CONFIG_HOME", ".config"
+	switch k {
+	case dataKind:
+		env, fallback = "XDG_DATA_HOME", filepath.Join(".local", "share")
+	case logKind:
+		env, fallback = "XDG_STATE_HOME", filepath.Join(".local", "state")
+	}
+	// XDG 規範要求忽略相對路徑
+	base := getenv(env)
+	if base == "" || !filepath.IsAbs(base) {
+		if home == "" {
+			return "", fmt.Errorf("neither $%s nor $HOME is set", env)
+		}
+		base = filepath.Join(home, fallback)
+	}
+	return filepath.Join(base, AppName), nil
+}
@@ -0,0 +1,74 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(k string) string { return vars[k] }
+	}
+	xdg := env(map[string]string{
+		"XDG_CONFIG_HOME": "/etc/xdg-config",
+		"XDG_DATA_HOME":   "relative/data", // 相對路徑被忽略
+	})
+	win := env(map[string]string{
+		"APPDATA":      `C:\Users\u\AppData\Roaming`,
+		"LOCALAPPDATA": `C:\Users\u\AppData\Local`,
+	})
+
+	tests := []struct {
+		name string
+		k    kind
+		goos string
+		env  func(string) string
+		home string
+		want string
+	}{
+		{"linux config xdg", configKind, "linux", xdg, "/home/u", filepath.Join("/etc/xdg-config", AppName)},
+		{"linux data relative xdg", dataKind, "linux", xdg, "/home/u", filepath.Join("/home/u", ".local", "share", AppName)},
+		{"linux log", logKind, "linux", env(nil), "/home/u", filepath.Join("/home/u", ".local", "state", AppName)},
+		{"windows config", configKind, "windows", win, "", filepath.Join(`C:\Users\u\AppData\Roaming`, AppName)},
+		{"windows data", dataKind, "windows", win, "", filepath.Join(`C:\Users\u\AppData\Local`, AppName)},
+		{"windows log", logKind, "windows", win, "", filepath.Join(`C:\Users\u\AppData\Local`, AppName, "logs")},
+		{"darwin data", dataKind, "darwin", env(nil), "/Users/u", filepath.Join("/Users/u", "Library", "Application Support", AppName)},
+		{"darwin log", logKind, "darwin", env(nil), "/Users/u", filepath.Join("/Users/u", "Library", "Logs", AppName)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolve(tt.k, tt.goos, tt.env, tt.home)
+			if err != nil || got != tt.want {
+				t.Errorf("resolve = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := resolve(configKind, "windows", env(nil), ""); err == nil {
+		t.Error("expected error without %APPDATA%")
+	}
+	if _, err := resolve(dataKind, "linux", env(nil), ""); err == nil {
+		t.Error("expected error without $XDG_DATA_HOME and $HOME")
+	}
+}
+
+func TestDefaultDBPath(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("XDG directories only apply to Linux and other Unix systems")
+	}
+	t.Setenv("XDG_DATA_HOME", "/var/lib/test-data")
+	t.Chdir(t.TempDir())
+	if got, want := DefaultDBPath(), filepath.Join("/var/lib/test-data", AppName, DBDir); got != want {
+		t.Errorf("DefaultDBPath() = %q, want %q", got, want)
+	}
+
+	// 工作目錄下已有舊版數據庫時繼續使用
+	if err := os.Mkdir(legacyDBPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := DefaultDBPath(); got != legacyDBPath {
+		t.Errorf("DefaultDBPath() = %q, want legacy %q", got, legacyDBPath)
+	}
+}
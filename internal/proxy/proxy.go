@@ -1,621 +0,0 @@
-package proxy
-
-import (
-	"bufio"
-	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net"
-	"strings"
-	"sync"
-	"time"
-
-	"github.com/e2u/dynamic-proxy/internal/fetcher"
-	"github.com/gocolly/colly/v2"
-	"github.com/sirupsen/logrus"
-)
-
-var testURLs = []string{
-	"https://www.google.com/generate_204",
-	"http://www.gstatic.com/generate_204",
-	"https://connectivitycheck.gstatic.com/generate_204",
-	"http://edge-http.microsoft.com/captiveportal/generate_204",
-	"http://cp.cloudflare.com/generate_204",
-}
-
-func randomTestURL() string {
-	return testURLs[time.Now().UnixNano()%int64(len(testURLs))]
-}
-
-// collectorPool 健康檢查 Collector 池（重用避免重複創建）
-var collectorPool = sync.Pool{
-	New: func() any {
-		c := fetcher.NewColly()
-		c.SetRequestTimeout(10 * time.Second)
-		c.Limit(&colly.LimitRule{
-			RandomDelay: 1 * time.Second,
-		})
-		return c
-	},
-}
-
-// getHealthChecker 從池中獲取 Collector
-func getHealthChecker() *colly.Collector {
-	return collectorPool.Get().(*colly.Collector)
-}
-
-// putHealthChecker 將 Collector 歸還池中
-func putHealthChecker(c *colly.Collector) {
-	// 重置狀態
-	c.OnError(nil)
-	c.OnResponseHeaders(nil)
-	collectorPool.Put(c)
-}
-
-type Proxy struct {
-	IP       string    `json:"ip"`
-	Port     string    `json:"port"`
-	Protocol string    `json:"protocol"`
-	Disable  bool      `json:"disable"`
-	Updated  time.Time `json:"updated"`
-	Count    int64     `json:"count"`
-	Type     string    `json:"type"`
-	Addr     string    `json:"addr"`
-	User     string    `json:"user"`
-	Pass     string    `json:"pass"`
-}
-
-func (p *Proxy) Address() string {
-	return fmt.Sprintf("%s://%s:%s", p.Protocol, p.IP, p.Port)
-}
-
-func (p *Proxy) String() string {
-	return fmt.Sprintf("%s://%s:%s", p.Protocol, p.IP, p.Port)
-}
-
-func (p *Proxy) DumpJSON() []byte {
-	// 確保 Proxy 數據是乾淨的
-	if p.IP == "" {
-		p.IP = "0.0.0.0"
-	}
-	if p.Addr == "" {
-		p.Addr = p.IP + ":" + p.Port
-	}
-
-	data, err := json.Marshal(p)
-	if err != nil {
-		logrus.Errorf("failed to marshal proxy: %v", err)
-		return []byte("{}")
-	}
-	return data
-}
-
-func LoadFromJSON(data []byte) (*Proxy, error) {
-	// 清理數據：移除二進制字符和不可打印字符
-	// 這可以處理像是 \x01 這樣的損壞字符
-	cleaned := make([]byte, 0, len(data))
-	for _, b := range data {
-		// 只保留可打印 ASCII 字符和常見的控制字符
-		if (b >= 32 && b <= 126) || b == '\n' || b == '\r' || b == '\t' {
-			cleaned = append(cleaned, b)
-		}
-	}
-
-	// 如果清理後的數據为空，返回錯誤
-	if len(cleaned) == 0 {
-		return nil, fmt.Errorf("empty proxy data after cleaning")
-	}
-
-	var p Proxy
-	err := json.Unmarshal(cleaned, &p)
-	if err != nil {
-		// 詳細記錄錯誤數據
-		logrus.Errorf("LoadFromJSON error: original len=%d, cleaned len=%d, err=%v", len(data), len(cleaned), err)
-		// 顯示清理後數據的前幾個字節
-		if len(cleaned) > 0 {
-			logrus.Errorf("LoadFromJSON cleaned data (first 100 bytes): %q", string(cleaned[:min(100, len(cleaned))]))
-		}
-		return nil, err
-	}
-
-	// 驗證代理的基本有效性
-	if p.IP == "" || p.Port == "" {
-		return nil, fmt.Errorf("invalid proxy: missing IP or Port")
-	}
-
-	return &p, nil
-}
-
-// ProxyQuality 代理質量評分
-type ProxyQuality struct {
-	ResponseTime    time.Duration // 響應時間
-	AnonymityLevel  string        // 匿名級別（elite, anonymous, transparent）
-	LastChecked     time.Time     // 最後檢查時間
-	SuccessRate     float64       // 成功率（0-1）
-}
-
-// ValidProxy 驗證代理（使用 Collector Pool）
-func ValidProxy(p *Proxy) bool {
-	if p.IP == "" || p.IP == "0.0.0.0" || p.IP == "127.0.0.1" {
-		return false
-	}
-
-	pp, err := determineConnectionProtocol(p.IP, p.Port)
-	if err != nil {
-		p.Disable = true
-		return false
-	}
-
-	p.Protocol = pp
-	if p.Protocol == "" {
-		p.Disable = true
-		return false
-	}
-
-	// 設置 Addr 字段
-	if p.Addr == "" {
-		p.Addr = p.IP + ":" + p.Port
-	}
-
-	var valid bool
-	startTime := time.Now()
-
-	// 從池中獲取 Collector
-	c := getHealthChecker()
-	defer putHealthChecker(c)
-
-	c.SetProxy(p.String())
-	c.OnError(func(r *colly.Response, err error) {
-		if r != nil && r.StatusCode > 204 {
-			logrus.Debugf("proxy %s error: %v", p.String(), err)
-		}
-	})
-
-	c.OnResponseHeaders(func(r *colly.Response) {
-		if r.StatusCode == 204 {
-			logrus.Debugf("valid proxy found: %s", p.String())
-			valid = true
-		}
-	})
-
-	c.Visit(randomTestURL())
-	c.Wait()
-
-	if valid {
-		p.Updated = time.Now()
-		p.Disable = false
-		logrus.Infof("validated proxy: %s (took %v)", p.String(), time.Since(startTime))
-	} else {
-		p.Disable = true
-	}
-
-	return valid
-}
-
-// ValidProxyWithQuality 驗證代理並返回質量評分
-func ValidProxyWithQuality(p *Proxy) (*ProxyQuality, bool) {
-	if p.IP == "" || p.IP == "0.0.0.0" || p.IP == "127.0.0.1" {
-		return nil, false
-	}
-
-	pp, err := determineConnectionProtocol(p.IP, p.Port)
-	if err != nil {
-		p.Disable = true
-		return nil, false
-	}
-
-	p.Protocol = pp
-	if p.Protocol == "" {
-		p.Disable = true
-		return nil, false
-	}
-
-	if p.Addr == "" {
-		p.Addr = p.IP + ":" + p.Port
-	}
-
-	var valid bool
-	var responseTime time.Duration
-	startTime := time.Now()
-
-	c := getHealthChecker()
-	defer putHealthChecker(c)
-
-	c.SetProxy(p.String())
-	c.OnError(func(r *colly.Response, err error) {
-		if r != nil && r.StatusCode > 204 {
-			logrus.Debugf("proxy %s error: %v", p.String(), err)
-		}
-	})
-
-	c.OnResponseHeaders(func(r *colly.Response) {
-		responseTime = time.Since(startTime)
-		if r.StatusCode == 204 {
-			valid = true
-		}
-	})
-
-	c.Visit(randomTestURL())
-	c.Wait()
-
-	quality := &ProxyQuality{
-		ResponseTime:    responseTime,
-		AnonymityLevel:  detectAnonymity(p),
-		LastChecked:     time.Now(),
-		SuccessRate:     1.0,
-	}
-
-	if valid {
-		p.Updated = time.Now()
-		p.Disable = false
-		logrus.Infof("validated proxy: %s (took %v, anonymity: %s)", p.String(), responseTime, quality.AnonymityLevel)
-	} else {
-		p.Disable = true
-		quality.SuccessRate = 0
-	}
-
-	return quality, valid
-}
-
-// detectAnonymity 檢測代理匿名級別
-func detectAnonymity(p *Proxy) string {
-	// 簡化實現：根據響應頭判斷
-	// elite: 不發送 REMOTE_ADDR, HTTP_VIA, HTTP_X_FORWARDED_FOR
-	// anonymous: 發送 HTTP_VIA 但不發送真實 IP
-	// transparent: 發送真實 IP
-	// 由於需要實際測試，此處返回默認值
-	return "unknown"
-}
-
-func determineConnectionProtocol(ip, port string) (string, error) {
-	addr := net.JoinHostPort(ip, port)
-
-	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
-	if err != nil {
-		logrus.Tracef("TCP connection failed for %s: %v", addr, err)
-		return "", fmt.Errorf("connection failed: %w", err)
-	}
-	conn.Close()
-
-	overallTimeout := 20 * time.Second
-	dialTimeout := 8 * time.Second
-
-	type result struct {
-		protocol string
-		priority int
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), overallTimeout)
-	defer cancel()
-
-	resultChan := make(chan result, 3)
-	var wg sync.WaitGroup
-
-	checkers := []struct {
-		protocol string
-		priority int
-		check    func(context.Context, net.Conn) bool
-	}{
-		{"socks5", 1, checkSOCKS5},
-		{"http", 2, checkHTTP},
-		{"https", 3, checkHTTPS},
-	}
-
-	for _, checker := range checkers {
-		wg.Add(1)
-		go func(c struct {
-			protocol string
-			priority int
-			check    func(context.Context, net.Conn) bool
-		}) {
-			defer wg.Done()
-
-			select {
-			case <-ctx.Done():
-				return
-			default:
-			}
-
-			dialCtx, dialCancel := context.WithTimeout(ctx, dialTimeout)
-			defer dialCancel()
-
-			var d net.Dialer
-			conn, err := d.DialContext(dialCtx, "tcp", addr)
-			if err != nil {
-				logrus.Tracef("failed to connect to %s for %s check: %v", addr, c.protocol, err)
-				return
-			}
-			defer conn.Close()
-
-			if err := conn.SetDeadline(time.Now().Add(8 * time.Second)); err != nil {
-				return
-			}
-
-			if c.check(ctx, conn) {
-				select {
-				case resultChan <- result{c.protocol, c.priority}:
-					cancel()
-				case <-ctx.Done():
-				}
-			}
-		}(checker)
-	}
-
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	var bestResult *result
-	for r := range resultChan {
-		if bestResult == nil || r.priority < bestResult.priority {
-			bestResult = &r
-		}
-	}
-
-	if bestResult != nil {
-		return bestResult.protocol, nil
-	}
-
-	logrus.Tracef("protocol detection failed but TCP connected, defaulting to http for %s", addr)
-	return "http", nil
-}
-
-func checkSOCKS5(ctx context.Context, conn net.Conn) bool {
-	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
-		logrus.Tracef("[checkSOCKS5] failed to write greeting: %v", err)
-		return false
-	}
-
-	greetingBuf := make([]byte, 2)
-
-	type readResult struct {
-		success bool
-		err     error
-	}
-
-	greetingDone := make(chan readResult, 1)
-	go func() {
-		_, err := io.ReadFull(conn, greetingBuf)
-		greetingDone <- readResult{
-			success: err == nil && greetingBuf[0] == 5 && greetingBuf[1] == 0,
-			err:     err,
-		}
-	}()
-
-	select {
-	case result := <-greetingDone:
-		if !result.success {
-			if result.err != nil {
-				logrus.Tracef("[checkSOCKS5] greeting read failed: %v", result.err)
-			} else {
-				logrus.Tracef("[checkSOCKS5] invalid greeting response: [%d, %d]", greetingBuf[0], greetingBuf[1])
-			}
-			return false
-		}
-	case <-ctx.Done():
-		logrus.Tracef("[checkSOCKS5] context cancelled during greeting")
-		return false
-	case <-time.After(2 * time.Second):
-		logrus.Tracef("[checkSOCKS5] timeout waiting for greeting response")
-		return false
-	}
-
-	// SOCKS5 CONNECT: VER(1) CMD(1) RSV(1) ATYP(1) DST.ADDR(4) DST.PORT(2)
-	connectRequest := []byte{
-		5,          // VER: SOCKS5
-		1,          // CMD: CONNECT
-		0,          // RSV: Reserved
-		1,          // ATYP: IPv4
-		8, 8, 8, 8, // DST.ADDR: 8.8.8.8
-		0, 53, // DST.PORT: 53
-	}
-
-	if _, err := conn.Write(connectRequest); err != nil {
-		logrus.Tracef("[checkSOCKS5] failed to write CONNECT request: %v", err)
-		return false
-	}
-
-	connectHeaderBuf := make([]byte, 4)
-
-	connectDone := make(chan readResult, 1)
-	go func() {
-		_, err := io.ReadFull(conn, connectHeaderBuf)
-		if err != nil {
-			connectDone <- readResult{success: false, err: err}
-			return
-		}
-
-		if connectHeaderBuf[0] != 5 {
-			connectDone <- readResult{success: false, err: fmt.Errorf("invalid version: %d", connectHeaderBuf[0])}
-			return
-		}
-
-		if connectHeaderBuf[1] != 0 {
-			connectDone <- readResult{success: false, err: fmt.Errorf("connection failed, reply code: %d", connectHeaderBuf[1])}
-			return
-		}
-
-		atyp := connectHeaderBuf[3]
-		var remainingBytes int
-
-		switch atyp {
-		case 1: // IPv4
-			remainingBytes = 4 + 2 // 4 bytes addr + 2 bytes port
-		case 3: // Domain name
-			lenBuf := make([]byte, 1)
-			if _, err := io.ReadFull(conn, lenBuf); err != nil {
-				connectDone <- readResult{success: false, err: err}
-				return
-			}
-			remainingBytes = int(lenBuf[0]) + 2 // domain length + 2 bytes port
-		case 4: // IPv6
-			remainingBytes = 16 + 2 // 16 bytes addr + 2 bytes port
-		default:
-			connectDone <- readResult{success: false, err: fmt.Errorf("unknown address type: %d", atyp)}
-			return
-		}
-
-		remainingBuf := make([]byte, remainingBytes)
-		if _, err := io.ReadFull(conn, remainingBuf); err != nil {
-			connectDone <- readResult{success: false, err: err}
-			return
-		}
-
-		connectDone <- readResult{success: true, err: nil}
-	}()
-
-	select {
-	case result := <-connectDone:
-		if !result.success {
-			if result.err != nil {
-				logrus.Tracef("[checkSOCKS5] CONNECT failed: %v", result.err)
-			}
-			return false
-		}
-		logrus.Tracef("[checkSOCKS5] successfully validated SOCKS5 proxy")
-		return true
-	case <-ctx.Done():
-		logrus.Tracef("[checkSOCKS5] context cancelled during CONNECT")
-		return false
-	case <-time.After(2 * time.Second):
-		logrus.Tracef("[checkSOCKS5] timeout waiting for CONNECT response")
-		return false
-	}
-}
-
-func checkHTTPS(ctx context.Context, conn net.Conn) bool {
-	request := "CONNECT www.google.com:443 HTTP/1.1\r\n" +
-		"Host: www.google.com:443\r\n" +
-		"User-Agent: Mozilla/5.0\r\n" +
-		"Proxy-Connection: keep-alive\r\n" +
-		"\r\n"
-
-	if _, err := conn.Write([]byte(request)); err != nil {
-		logrus.Tracef("[checkHTTPS] failed to write CONNECT request: %v", err)
-		return false
-	}
-
-	reader := bufio.NewReader(conn)
-
-	type readResult struct {
-		line string
-		err  error
-	}
-
-	done := make(chan readResult, 1)
-	go func() {
-		line, err := reader.ReadString('\n')
-		done <- readResult{line: line, err: err}
-	}()
-
-	var result readResult
-	select {
-	case result = <-done:
-		if result.err != nil {
-			logrus.Tracef("[checkHTTPS] failed to read response: %v", result.err)
-			return false
-		}
-	case <-ctx.Done():
-		logrus.Tracef("[checkHTTPS] context cancelled")
-		return false
-	case <-time.After(3 * time.Second):
-		logrus.Tracef("[checkHTTPS] timeout waiting for response")
-		return false
-	}
-
-	line := strings.TrimSpace(result.line)
-	logrus.Tracef("[checkHTTPS] received: %s", line)
-
-	if !strings.HasPrefix(line, "HTTP/1.1 ") && !strings.HasPrefix(line, "HTTP/1.0 ") {
-		return false
-	}
-
-	parts := strings.Fields(line)
-	if len(parts) < 2 {
-		return false
-	}
-
-	statusCode := parts[1]
-
-	if statusCode != "200" {
-		logrus.Tracef("[checkHTTPS] non-200 status code: %s (full response: %s)", statusCode, line)
-		return false
-	}
-
-	return true
-}
-
-func checkHTTP(ctx context.Context, conn net.Conn) bool {
-	request := "GET http://www.gstatic.com/generate_204 HTTP/1.1\r\n" +
-		"Host: www.gstatic.com\r\n" +
-		"User-Agent: Mozilla/5.0\r\n" +
-		"Proxy-Connection: close\r\n" +
-		"\r\n"
-
-	if _, err := conn.Write([]byte(request)); err != nil {
-		logrus.Tracef("[checkHTTP] failed to write HTTP request: %v", err)
-		return false
-	}
-
-	reader := bufio.NewReader(conn)
-
-	type readResult struct {
-		line string
-		err  error
-	}
-
-	done := make(chan readResult, 1)
-	go func() {
-		line, err := reader.ReadString('\n')
-		done <- readResult{line: line, err: err}
-	}()
-
-	var result readResult
-	select {
-	case result = <-done:
-		if result.err != nil {
-			logrus.Tracef("[checkHTTP] failed to read response: %v", result.err)
-			return false
-		}
-	case <-ctx.Done():
-		logrus.Tracef("[checkHTTP] context cancelled")
-		return false
-	case <-time.After(3 * time.Second):
-		logrus.Tracef("[checkHTTP] timeout waiting for response")
-		return false
-	}
-
-	line := strings.TrimSpace(result.line)
-	logrus.Tracef("[checkHTTP] received: %s", line)
-
-	if !strings.HasPrefix(line, "HTTP/1.1 ") && !strings.HasPrefix(line, "HTTP/1.0 ") {
-		return false
-	}
-
-	parts := strings.Fields(line)
-	if len(parts) < 2 {
-		return false
-	}
-
-	statusCode := parts[1]
-
-	if len(statusCode) != 3 {
-		return false
-	}
-
-	for _, c := range statusCode {
-		if c < '0' || c > '9' {
-			return false
-		}
-	}
-
-	firstDigit := statusCode[0]
-	if firstDigit != '2' && firstDigit != '3' {
-		logrus.Tracef("[checkHTTP] received non-success status code: %s", statusCode)
-		return false
-	}
-
-	return true
-}
@@ -0,0 +1,65 @@
+package sourcestats
+
+import "time"
+
+// BackoffPolicy 來源返回 429 或 5xx 後的退避策略：連續第 n 輪出錯後 Initial × 2^(n-1)（不超過 Max）內
+// 不再採集該來源；響應帶 Retry-After 時至少等待到其指定的時間。Initial 為 0 時不退避
+type BackoffPolicy struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// delay 連續第 streak 輪出錯後的退避時長
+func (p BackoffPolicy) delay(streak int, retryAfter time.Duration) time.Duration {
+	d := p.Initial
+	for i := 1; i < streak && (p.Max <= 0 || d < p.Max); i++ {
+		d *= 2
+	}
+	if p.Max > 0 {
+		d = min(d, p.Max)
+	}
+	return max(d, retryAfter)
+}
+
+// SetBackoff 替換退避策略（配置重新加載時使用），正在退避的來源保留原結束時間
+func (t *Tracker) SetBackoff(policy BackoffPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.backoff = policy
+}
+
+// Backoff 判斷來源是否在退避中，是則計入 BackedOff 並返回退避結束時間
+func (t *Tracker) Backoff(url string, now time.Time) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(url)
+	if !now.Before(s.BackoffUntil) {
+		return time.Time{}, false
+	}
+	s.BackedOff++
+	return s.BackoffUntil, true
+}
+
+// RecordThrottled 記錄一輪採集中來源返回了 429 或 5xx（retryAfter 為響應的 Retry-After，沒有時為 0），
+// 返回退避結束時間；不退避時返回零值
+func (t *Tracker) RecordThrottled(url string, retryAfter time.Duration, now time.Time) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(url)
+	s.ErrorStreak++
+	if t.backoff.Initial <= 0 {
+		s.BackoffUntil = time.Time{}
+		return time.Time{}
+	}
+	s.BackoffUntil = now.Add(t.backoff.delay(s.ErrorStreak, retryAfter))
+	return s.BackoffUntil
+}
+
+// RecordRecovered 記錄一輪採集中來源正常響應，結束退避並清零連續出錯輪數
+func (t *Tracker) RecordRecovered(url string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(url)
+	s.ErrorStreak = 0
+	s.BackoffUntil = time.Time{}
+}
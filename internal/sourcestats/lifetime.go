@@ -0,0 +1,109 @@
+package sourcestats
+
+import (
+	"slices"
+	"time"
+)
+
+// LifetimeBuckets 存活時間分佈的分界，也是存活曲線的取樣點
+var LifetimeBuckets = []time.Duration{
+	time.Hour,
+	3 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+	48 * time.Hour,
+	72 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// SurvivalPoint 存活曲線上的一點：失效代理中存活時間達到 After 的比例
+type SurvivalPoint struct {
+	AfterSeconds float64 `json:"after_seconds"`
+	Fraction     float64 `json:"fraction"`
+}
+
+// Lifetime 失效代理的存活時間統計
+type Lifetime struct {
+	Dead                  int64           `json:"dead"`
+	MedianLifetimeSeconds float64         `json:"median_lifetime_seconds"` // 按分佈估算，沒有記錄時為 0
+	Survival              []SurvivalPoint `json:"survival,omitempty"`
+}
+
+// bucketIndex 存活時間所在的分佈區間：i 表示 [LifetimeBuckets[i-1], LifetimeBuckets[i])，最後一個區間沒有上限
+func bucketIndex(lifetime time.Duration) int {
+	i, _ := slices.BinarySearch(LifetimeBuckets, lifetime)
+	if i < len(LifetimeBuckets) && LifetimeBuckets[i] == lifetime {
+		i++
+	}
+	return i
+}
+
+// addLifetime 把一個存活時間計入分佈
+func addLifetime(hist []int64, lifetime time.Duration) []int64 {
+	if len(hist) != len(LifetimeBuckets)+1 {
+		// 舊版本的記錄沒有分佈，或分界有變化
+		hist = make([]int64, len(LifetimeBuckets)+1)
+	}
+	hist[bucketIndex(lifetime)]++
+	return hist
+}
+
+// lifetimeOf 根據分佈計算中位數和存活曲線；中位數在所在區間內線性插值，落在最後一個區間時取其下限
+func lifetimeOf(hist []int64) Lifetime {
+	var total int64
+	for _, n := range hist {
+		total += n
+	}
+	l := Lifetime{Dead: total}
+	if total == 0 {
+		return l
+	}
+
+	var below int64
+	median := -1.0
+	for i, n := range hist {
+		lower := time.Duration(0)
+		if i > 0 {
+			lower = LifetimeBuckets[i-1]
+		}
+		if median < 0 && float64(below+n) >= float64(total)/2 && n > 0 {
+			if i == len(LifetimeBuckets) {
+				median = lower.Seconds()
+			} else {
+				frac := (float64(total)/2 - float64(below)) / float64(n)
+				median = lower.Seconds() + frac*(LifetimeBuckets[i]-lower).Seconds()
+			}
+		}
+		below += n
+		if i < len(LifetimeBuckets) {
+			l.Survival = append(l.Survival, SurvivalPoint{
+				AfterSeconds: LifetimeBuckets[i].Seconds(),
+				Fraction:     float64(total-below) / float64(total),
+			})
+		}
+	}
+	l.MedianLifetimeSeconds = median
+	return l
+}
+
+// Lifetime 來源失效代理的存活時間統計（只包括記錄了分佈之後失效的代理）
+func (s *Stats) Lifetime() Lifetime {
+	return lifetimeOf(s.Lifetimes)
+}
+
+// PoolLifetime 所有來源合計的存活時間統計
+func (t *Tracker) PoolLifetime() Lifetime {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hist := make([]int64, len(LifetimeBuckets)+1)
+	for _, s := range t.stats {
+		if len(s.Lifetimes) != len(hist) {
+			continue
+		}
+		for i, n := range s.Lifetimes {
+			hist[i] += n
+		}
+	}
+	return lifetimeOf(hist)
+}
@@ -0,0 +1,258 @@
+// Package sourcestats 按代理列表來源統計採集與驗證結果，並據此為來源評分
+//
+// 評分 = 驗證通過率 × 存活係數：
+//   - 驗證通過率：首次通過驗證的代理數 / 新入庫的候選代理數
+//   - 存活係數：0.5 + 0.5 × min(平均存活時間 / 24h, 1)，尚無失效記錄時為 1
+//
+// 新候選數不足 MinSamples 時不評分（Score 返回 -1），避免剛加入的來源被誤判。
+// 返回 429 或 5xx 的來源按 BackoffPolicy 退避，退避狀態與統計一起持久化。
+package sourcestats
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ReferenceLifetime 存活係數達到 1 所需的平均存活時間
+const ReferenceLifetime = 24 * time.Hour
+
+// Stats 單個來源的累計統計
+type Stats struct {
+	URL       string `json:"url"`
+	Gathers   int64  `json:"gathers"`   // 實際請求的採集輪數
+	Skipped   int64  `json:"skipped"`   // 因評分過低跳過的採集輪數
+	Failures  int64  `json:"failures"`  // 請求失敗次數
+	Extracted int64  `json:"extracted"` // 提取到的候選代理總數（含已在庫中的）
+	New       int64  `json:"new"`       // 新入庫的候選代理數
+	Validated int64  `json:"validated"` // 首次通過驗證的代理數
+	Dead      int64  `json:"dead"`      // 通過過驗證、之後失效被刪除的代理數
+	// LifetimeSeconds 失效代理的存活時間總和（入庫到最後一次驗證通過）
+	LifetimeSeconds float64 `json:"lifetime_seconds"`
+	// Lifetimes 失效代理存活時間的分佈（區間見 LifetimeBuckets）
+	Lifetimes     []int64   `json:"lifetimes,omitempty"`
+	LastGather    time.Time `json:"last_gather,omitzero"`
+	LastExtracted int64     `json:"last_extracted"` // 最近一輪提取到的候選數
+	// ErrorStreak 連續返回 429 或 5xx 的採集輪數，正常響應後清零
+	ErrorStreak int `json:"error_streak,omitempty"`
+	// BackoffUntil 退避結束時間，之前不採集該來源（見 BackoffPolicy）
+	BackoffUntil time.Time `json:"backoff_until,omitzero"`
+	BackedOff    int64     `json:"backed_off"` // 因退避跳過的採集輪數
+	// skipStreak 連續跳過的輪數（不持久化，重啟後從頭計算）
+	skipStreak int
+}
+
+// AvgLifetime 失效代理的平均存活時間（沒有失效記錄時為 0）
+func (s *Stats) AvgLifetime() time.Duration {
+	if s.Dead == 0 {
+		return 0
+	}
+	return time.Duration(s.LifetimeSeconds / float64(s.Dead) * float64(time.Second))
+}
+
+// ValidationRate 新候選代理的驗證通過率
+func (s *Stats) ValidationRate() float64 {
+	if s.New == 0 {
+		return 0
+	}
+	return min(float64(s.Validated)/float64(s.New), 1)
+}
+
+// Score 來源評分（0–1），新候選數少於 minSamples 時返回 -1
+func (s *Stats) Score(minSamples int64) float64 {
+	if s.New == 0 || s.New < minSamples {
+		return -1
+	}
+	factor := 1.0
+	if s.Dead > 0 {
+		factor = 0.5 + 0.5*min(float64(s.AvgLifetime())/float64(ReferenceLifetime), 1)
+	}
+	return s.ValidationRate() * factor
+}
+
+// Report 帶評分的統計（API 與 -info 輸出）
+type Report struct {
+	Stats
+	ValidationRate     float64 `json:"validation_rate"`
+	AvgLifetimeSeconds float64 `json:"avg_lifetime_seconds"`
+	Score              float64 `json:"score"` // -1 表示樣本不足
+	Demoted            bool    `json:"demoted"`
+	// MedianLifetimeSeconds 與 Survival 按存活時間分佈估算，見 Lifetime
+	MedianLifetimeSeconds float64         `json:"median_lifetime_seconds"`
+	Survival              []SurvivalPoint `json:"survival,omitempty"`
+}
+
+// DemotePolicy 低分來源降頻策略
+type DemotePolicy struct {
+	Below      float64 // 評分低於此值的來源被降頻（0 表示不降頻）
+	Every      int     // 降頻來源每 Every 輪採集一次
+	MinSamples int64   // 評分所需的最少新候選數
+}
+
+// demoted 判斷來源是否被降頻
+func (p DemotePolicy) demoted(s *Stats) bool {
+	if p.Below <= 0 || p.Every <= 1 {
+		return false
+	}
+	score := s.Score(p.MinSamples)
+	return score >= 0 && score < p.Below
+}
+
+// Tracker 來源統計，可並發使用
+type Tracker struct {
+	mu      sync.Mutex
+	policy  DemotePolicy
+	backoff BackoffPolicy
+	stats   map[string]*Stats
+}
+
+// New 創建統計器
+func New(policy DemotePolicy) *Tracker {
+	return &Tracker{policy: policy, stats: make(map[string]*Stats)}
+}
+
+// SetPolicy 替換降頻策略（配置重新加載時使用），已有統計保留
+func (t *Tracker) SetPolicy(policy DemotePolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.policy = policy
+}
+
+// get 返回來源統計，不存在時創建（調用方需持有鎖）
+func (t *Tracker) get(url string) *Stats {
+	s, ok := t.stats[url]
+	if !ok {
+		s = &Stats{URL: url}
+		t.stats[url] = s
+	}
+	return s
+}
+
+// Restore 載入持久化的統計（覆蓋同名來源）
+func (t *Tracker) Restore(list []Stats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range list {
+		if s.URL == "" {
+			continue
+		}
+		s.skipStreak = 0
+		t.stats[s.URL] = &s
+	}
+}
+
+// Snapshot 返回所有來源統計的副本，按 URL 排序，用於持久化
+func (t *Tracker) Snapshot() []Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]Stats, 0, len(t.stats))
+	for _, s := range t.stats {
+		c := *s
+		c.Lifetimes = slices.Clone(s.Lifetimes)
+		list = append(list, c)
+	}
+	slices.SortFunc(list, func(a, b Stats) int { return cmp.Compare(a.URL, b.URL) })
+	return list
+}
+
+// Reports 返回帶評分的統計，按評分從高到低排序（樣本不足的排在最後）
+func (t *Tracker) Reports() []Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	reports := make([]Report, 0, len(t.stats))
+	for _, s := range t.stats {
+		lifetime := s.Lifetime()
+		c := *s
+		c.Lifetimes = slices.Clone(s.Lifetimes)
+		reports = append(reports, Report{
+			Stats:                 c,
+			ValidationRate:        s.ValidationRate(),
+			AvgLifetimeSeconds:    s.AvgLifetime().Seconds(),
+			Score:                 s.Score(t.policy.MinSamples),
+			Demoted:               t.policy.demoted(s),
+			MedianLifetimeSeconds: lifetime.MedianLifetimeSeconds,
+			Survival:              lifetime.Survival,
+		})
+	}
+	slices.SortFunc(reports, func(a, b Report) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.URL, b.URL)
+	})
+	return reports
+}
+
+// ShouldFetch 判斷本輪是否採集該來源：降頻來源每 Every 輪採集一次，跳過的輪次計入 Skipped
+func (t *Tracker) ShouldFetch(url string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(url)
+	if !t.policy.demoted(s) || s.skipStreak >= t.policy.Every-1 {
+		s.skipStreak = 0
+		return true
+	}
+	s.skipStreak++
+	s.Skipped++
+	return false
+}
+
+// RecordGather 記錄一輪採集開始
+func (t *Tracker) RecordGather(url string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(url)
+	s.Gathers++
+	s.LastGather = time.Now()
+	s.LastExtracted = 0
+}
+
+// RecordExtracted 記錄提取到的候選數（分頁來源每頁調用一次）
+func (t *Tracker) RecordExtracted(url string, n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(url)
+	s.Extracted += n
+	s.LastExtracted += n
+}
+
+// RecordFailure 記錄一次請求失敗
+func (t *Tracker) RecordFailure(url string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.get(url).Failures++
+}
+
+// RecordNew 記錄一個新入庫的候選代理
+func (t *Tracker) RecordNew(url string) {
+	if url == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.get(url).New++
+}
+
+// RecordValidated 記錄一個首次通過驗證的代理
+func (t *Tracker) RecordValidated(url string) {
+	if url == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.get(url).Validated++
+}
+
+// RecordDeath 記錄一個通過過驗證的代理失效被刪除及其存活時間
+func (t *Tracker) RecordDeath(url string, lifetime time.Duration) {
+	if url == "" || lifetime < 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(url)
+	s.Dead++
+	s.LifetimeSeconds += lifetime.Seconds()
+	s.Lifetimes = addLifetime(s.Lifetimes, lifetime)
+}
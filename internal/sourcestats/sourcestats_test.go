@@ -0,0 +1,175 @@
+package sourcestats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats Stats
+		want  float64
+	}{
+		{"no samples", Stats{}, -1},
+		{"too few samples", Stats{New: 5, Validated: 5}, -1},
+		{"no deaths yet", Stats{New: 100, Validated: 20}, 0.2},
+		{"long lived", Stats{New: 100, Validated: 50, Dead: 2, LifetimeSeconds: 2 * 48 * 3600}, 0.5},
+		{"short lived", Stats{New: 100, Validated: 50, Dead: 1, LifetimeSeconds: 0}, 0.25},
+		{"half reference", Stats{New: 10, Validated: 10, Dead: 1, LifetimeSeconds: 12 * 3600}, 0.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stats.Score(10); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Score = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackerRecord(t *testing.T) {
+	tr := New(DemotePolicy{})
+	const src = "https://example.com/list"
+	tr.RecordGather(src)
+	tr.RecordExtracted(src, 30)
+	tr.RecordExtracted(src, 20)
+	for range 10 {
+		tr.RecordNew(src)
+	}
+	tr.RecordValidated(src)
+	tr.RecordDeath(src, 2*time.Hour)
+	tr.RecordDeath(src, 4*time.Hour)
+	tr.RecordNew("") // 舊記錄沒有來源，忽略
+
+	list := tr.Snapshot()
+	if len(list) != 1 {
+		t.Fatalf("snapshot = %+v", list)
+	}
+	s := list[0]
+	if s.Extracted != 50 || s.LastExtracted != 50 || s.New != 10 || s.Validated != 1 || s.Dead != 2 || s.Gathers != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+	if s.AvgLifetime() != 3*time.Hour {
+		t.Errorf("AvgLifetime = %v, want 3h", s.AvgLifetime())
+	}
+
+	// 持久化後恢復
+	restored := New(DemotePolicy{})
+	restored.Restore(list)
+	if got := restored.Snapshot(); len(got) != 1 || got[0].New != 10 {
+		t.Errorf("restored = %+v", got)
+	}
+}
+
+func TestShouldFetch(t *testing.T) {
+	tr := New(DemotePolicy{Below: 0.1, Every: 3, MinSamples: 10})
+	const good, bad, fresh = "https://good.example/", "https://bad.example/", "https://fresh.example/"
+	tr.Restore([]Stats{
+		{URL: good, New: 100, Validated: 50},
+		{URL: bad, New: 100, Validated: 1},
+		{URL: fresh, New: 3},
+	})
+
+	var fetched = map[string]int{}
+	for range 6 {
+		for _, u := range []string{good, bad, fresh} {
+			if tr.ShouldFetch(u) {
+				fetched[u]++
+			}
+		}
+	}
+	if fetched[good] != 6 || fetched[fresh] != 6 {
+		t.Errorf("good/fresh sources should be fetched every run: %v", fetched)
+	}
+	if fetched[bad] != 2 {
+		t.Errorf("demoted source fetched %d times in 6 runs, want 2", fetched[bad])
+	}
+
+	reports := tr.Reports()
+	if reports[0].URL != good || !reports[1].Demoted || reports[2].Score != -1 {
+		t.Errorf("reports = %+v", reports)
+	}
+	if reports[1].Skipped != 4 {
+		t.Errorf("skipped = %d, want 4", reports[1].Skipped)
+	}
+}
+
+func TestLifetime(t *testing.T) {
+	tr := New(DemotePolicy{})
+	const a, b = "https://a.example/list", "https://b.example/list"
+	// a：2 個 30 分鐘、2 個 2 小時；b：1 個 10 天
+	for _, d := range []time.Duration{30 * time.Minute, 30 * time.Minute, 2 * time.Hour, 2 * time.Hour} {
+		tr.RecordDeath(a, d)
+	}
+	tr.RecordDeath(b, 10*24*time.Hour)
+
+	reports := tr.Reports()
+	byURL := make(map[string]Report)
+	for _, r := range reports {
+		byURL[r.URL] = r
+	}
+	ra := byURL[a]
+	if ra.MedianLifetimeSeconds != 3600 {
+		t.Errorf("median of a = %v, want 3600", ra.MedianLifetimeSeconds)
+	}
+	if len(ra.Survival) != len(LifetimeBuckets) || ra.Survival[0].Fraction != 0.5 || ra.Survival[1].Fraction != 0 {
+		t.Errorf("survival of a = %+v", ra.Survival)
+	}
+	if got := byURL[b].MedianLifetimeSeconds; got != (7 * 24 * time.Hour).Seconds() {
+		t.Errorf("median of b = %v, want the last bucket bound", got)
+	}
+
+	l := tr.PoolLifetime()
+	if l.Dead != 5 || l.Survival[0].Fraction != 0.6 || l.Survival[len(l.Survival)-1].Fraction != 0.2 {
+		t.Errorf("pool lifetime = %+v", l)
+	}
+
+	// 沒有分佈的舊記錄不計入
+	tr.Restore([]Stats{{URL: "https://old.example/list", Dead: 3, LifetimeSeconds: 300}})
+	if l := tr.PoolLifetime(); l.Dead != 5 {
+		t.Errorf("pool dead = %d, want 5 (legacy stats have no distribution)", l.Dead)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tr := New(DemotePolicy{})
+	tr.SetBackoff(BackoffPolicy{Initial: time.Hour, Max: 3 * time.Hour})
+	const u = "https://busy.example/list"
+	now := time.Now()
+
+	// 退避時長按連續出錯輪數翻倍，不超過 Max；Retry-After 更長時以其為準
+	for i, want := range []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour, 3 * time.Hour} {
+		if got := tr.RecordThrottled(u, 0, now); !got.Equal(now.Add(want)) {
+			t.Errorf("failure %d: backoff until +%s, want +%s", i+1, got.Sub(now), want)
+		}
+	}
+	if got := tr.RecordThrottled(u, 5*time.Hour, now); !got.Equal(now.Add(5 * time.Hour)) {
+		t.Errorf("Retry-After ignored: backoff until +%s", got.Sub(now))
+	}
+
+	if _, ok := tr.Backoff(u, now.Add(time.Hour)); !ok {
+		t.Error("source should be backing off")
+	}
+	if _, ok := tr.Backoff(u, now.Add(6*time.Hour)); ok {
+		t.Error("backoff should have ended")
+	}
+
+	// 退避狀態隨統計持久化，重啟後繼續生效
+	restored := New(DemotePolicy{})
+	restored.Restore(tr.Snapshot())
+	if until, ok := restored.Backoff(u, now); !ok || !until.Equal(now.Add(5*time.Hour)) {
+		t.Errorf("restored backoff = %v, %v", until, ok)
+	}
+	if s := restored.Snapshot()[0]; s.ErrorStreak != 5 || s.BackedOff != 2 {
+		t.Errorf("restored stats = %+v", s)
+	}
+
+	restored.RecordRecovered(u)
+	if _, ok := restored.Backoff(u, now); ok {
+		t.Error("recovered source should not back off")
+	}
+	if s := restored.Snapshot()[0]; s.ErrorStreak != 0 {
+		t.Errorf("error streak = %d after recovery", s.ErrorStreak)
+	}
+}
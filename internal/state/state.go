@@ -0,0 +1,130 @@
+// Package state 機器可讀的運行狀態文檔（GET /api/state），供 Ansible、Terraform 等部署工具斷言
+//
+// 文檔結構由 schema.json（JSON Schema）描述，以 schema_version 標識版本：
+//   - 新增字段不改變版本，使用方應忽略不認識的字段
+//   - 刪除、改名或改變字段含義時遞增 SchemaVersion
+package state
+
+import (
+	_ "embed"
+	"sync"
+	"time"
+)
+
+// SchemaVersion 狀態文檔的結構版本
+const SchemaVersion = 1
+
+// Schema 狀態文檔的 JSON Schema
+//
+//go:embed schema.json
+var Schema []byte
+
+// 任務狀態
+const (
+	JobIdle    = "idle"
+	JobRunning = "running"
+)
+
+// Document 狀態文檔
+type Document struct {
+	SchemaVersion int            `json:"schema_version"`
+	GeneratedAt   time.Time      `json:"generated_at"`
+	Version       string         `json:"version"`
+	Commit        string         `json:"commit"`
+	Mode          string         `json:"mode"` // serve 或 cron
+	StartedAt     time.Time      `json:"started_at"`
+	ConfigHash    string         `json:"config_hash"`
+	Pool          Pool           `json:"pool"`
+	Jobs          map[string]Job `json:"jobs"`
+	Listeners     Listeners      `json:"listeners"`
+}
+
+// Pool 代理池概況
+type Pool struct {
+	Total       int       `json:"total"`
+	Healthy     int       `json:"healthy"`
+	Pending     int       `json:"pending"`
+	LastGather  time.Time `json:"last_gather,omitzero"`
+	DBSizeBytes int64     `json:"db_size_bytes"`
+}
+
+// Listeners 監聽地址，未啟用的為空字符串
+type Listeners struct {
+	Proxy string `json:"proxy"`
+	Admin string `json:"admin"`
+	DNS   string `json:"dns"`
+}
+
+// Job 後台任務的運行狀態
+type Job struct {
+	State               string    `json:"state"` // idle 或 running
+	Runs                int64     `json:"runs"`
+	Failures            int64     `json:"failures"`
+	LastStarted         time.Time `json:"last_started,omitzero"`
+	LastFinished        time.Time `json:"last_finished,omitzero"`
+	LastDurationSeconds float64   `json:"last_duration_seconds"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+// Jobs 記錄後台任務的運行狀態，可並發使用
+type Jobs struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	running map[string]int
+}
+
+// NewJobs 創建任務記錄，names 中的任務即使從未運行也會出現在快照中
+func NewJobs(names ...string) *Jobs {
+	j := &Jobs{jobs: make(map[string]*Job), running: make(map[string]int)}
+	for _, name := range names {
+		j.jobs[name] = &Job{State: JobIdle}
+	}
+	return j
+}
+
+// Start 記錄任務開始，返回的函數在任務結束時以其錯誤（可為 nil）調用
+func (j *Jobs) Start(name string) func(error) {
+	started := time.Now()
+	j.mu.Lock()
+	job, ok := j.jobs[name]
+	if !ok {
+		job = &Job{}
+		j.jobs[name] = job
+	}
+	j.running[name]++
+	job.State = JobRunning
+	job.LastStarted = started
+	j.mu.Unlock()
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			finished := time.Now()
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			j.running[name]--
+			if j.running[name] == 0 {
+				job.State = JobIdle
+			}
+			job.Runs++
+			job.LastFinished = finished
+			job.LastDurationSeconds = finished.Sub(started).Seconds()
+			job.LastError = ""
+			if err != nil {
+				job.Failures++
+				job.LastError = err.Error()
+			}
+		})
+	}
+}
+
+// Snapshot 返回所有任務狀態的副本
+func (j *Jobs) Snapshot() map[string]Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make(map[string]Job, len(j.jobs))
+	for name, job := range j.jobs {
+		out[name] = *job
+	}
+	return out
+}
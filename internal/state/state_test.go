@@ -0,0 +1,103 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// schemaNode JSON Schema 中用到的部分
+type schemaNode struct {
+	Required             []string              `json:"required"`
+	Properties           map[string]schemaNode `json:"properties"`
+	AdditionalProperties *schemaNode           `json:"additionalProperties"`
+	Const                any                   `json:"const"`
+}
+
+// checkAgainst 檢查文檔的字段與 schema 一致：必填字段存在，且沒有未在 schema 中聲明的字段
+func checkAgainst(t *testing.T, path string, doc map[string]any, node schemaNode) {
+	t.Helper()
+	for _, key := range node.Required {
+		if _, ok := doc[key]; !ok {
+			t.Errorf("%s: required field %q missing from document", path, key)
+		}
+	}
+	for key, v := range doc {
+		child, ok := node.Properties[key]
+		if !ok && node.AdditionalProperties != nil {
+			child, ok = *node.AdditionalProperties, true
+		}
+		if !ok {
+			t.Errorf("%s: field %q not described by schema", path, key)
+			continue
+		}
+		if obj, isObj := v.(map[string]any); isObj {
+			checkAgainst(t, path+"."+key, obj, child)
+		}
+	}
+}
+
+func TestDocumentMatchesSchema(t *testing.T) {
+	var root schemaNode
+	if err := json.Unmarshal(Schema, &root); err != nil {
+		t.Fatalf("schema.json is not valid JSON: %v", err)
+	}
+	if root.Properties["schema_version"].Const != float64(SchemaVersion) {
+		t.Errorf("schema const schema_version = %v, want %d", root.Properties["schema_version"].Const, SchemaVersion)
+	}
+
+	jobs := NewJobs("gather")
+	jobs.Start("health")(errors.New("boom"))
+	doc := Document{
+		SchemaVersion: SchemaVersion,
+		GeneratedAt:   time.Now(),
+		Mode:          "serve",
+		StartedAt:     time.Now(),
+		Pool:          Pool{Total: 1, LastGather: time.Now()},
+		Jobs:          jobs.Snapshot(),
+		Listeners:     Listeners{Proxy: ":8080"},
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	checkAgainst(t, "$", m, root)
+}
+
+func TestJobs(t *testing.T) {
+	jobs := NewJobs("gather", "cleanup")
+
+	finish := jobs.Start("gather")
+	if s := jobs.Snapshot()["gather"]; s.State != JobRunning || s.LastStarted.IsZero() {
+		t.Errorf("running job = %+v", s)
+	}
+	finish(errors.New("timeout"))
+	finish(nil) // 重複調用無效
+
+	s := jobs.Snapshot()
+	if g := s["gather"]; g.State != JobIdle || g.Runs != 1 || g.Failures != 1 || g.LastError != "timeout" {
+		t.Errorf("finished job = %+v", g)
+	}
+	if c := s["cleanup"]; c.State != JobIdle || c.Runs != 0 {
+		t.Errorf("never-run job = %+v", c)
+	}
+
+	jobs.Start("gather")(nil)
+	if g := jobs.Snapshot()["gather"]; g.Runs != 2 || g.LastError != "" {
+		t.Errorf("successful run should clear last_error: %+v", g)
+	}
+	keys := make([]string, 0)
+	for k := range jobs.Snapshot() {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"cleanup", "gather"}) {
+		t.Errorf("jobs = %v", keys)
+	}
+}
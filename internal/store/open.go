@@ -0,0 +1,95 @@
+// Package store 打開 Badger 數據庫，非正常退出（崩潰、斷電、強制結束）後自動修復
+//
+// 修復步驟：
+//   - 目錄鎖衝突（另一個進程正在使用）：返回 ErrInUse，從不重試或搶佔。Badger 以 flock 鎖定目錄，
+//     進程退出後鎖即釋放，殘留的 LOCK 文件不會阻止打開
+//   - 其他錯誤重試一次：崩潰時剛創建的空 .vlog / .mem 文件會在第一次打開失敗時被 Badger 補全文件頭
+//   - 仍無法打開且恢復模式為 reset（需顯式設置）時，把數據庫目錄改名備份並使用空數據庫啟動（代理會重新採集）
+//
+// 值日誌尾部的不完整記錄由 Badger 打開時自行截斷；加密密鑰錯誤時數據完好，任何模式下都直接返回錯誤。
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/internal/logging"
+)
+
+var log = logging.For("store")
+
+// 恢復模式（配置 db.recovery）
+const (
+	RecoveryOff    = "off"    // 打開失敗直接返回錯誤
+	RecoveryRepair = "repair" // 重試一次
+	RecoveryReset  = "reset"  // repair 無效時備份數據庫目錄並以空數據庫啟動
+)
+
+// ErrInUse 數據庫被另一個仍在運行的進程使用
+var ErrInUse = errors.New("database is in use by another process")
+
+// Open 打開數據庫，失敗時按 recovery 模式嘗試恢復
+func Open(opts badger.Options, recovery string) (*badger.DB, error) {
+	db, err := badger.Open(opts)
+	if err == nil {
+		return db, nil
+	}
+	dir := opts.Dir
+	// 密鑰錯誤時數據本身完好，重試或重建只會丟失數據
+	if isKeyError(err) {
+		return nil, fmt.Errorf("failed to open database at %s: %w; check db.encryption_key or db.encryption_key_file "+
+			"(an existing database cannot be switched between encrypted and unencrypted)", dir, err)
+	}
+	// 鎖衝突說明另一個進程正在使用，任何情況下都不能移走其數據
+	if isLockError(err) {
+		return nil, fmt.Errorf("%w: %s; stop that process or use another db.path: %v", ErrInUse, dir, err)
+	}
+	if recovery == RecoveryOff {
+		return nil, guidance(dir, err)
+	}
+	log.Warnf("failed to open database at %s, retrying: %v", dir, err)
+	if db, err = badger.Open(opts); err == nil {
+		log.Infof("database at %s recovered", dir)
+		return db, nil
+	}
+	log.Warnf("database at %s still cannot be opened: %v", dir, err)
+	// 權限問題與數據損壞無關，重建也無法解決
+	if recovery != RecoveryReset || errors.Is(err, fs.ErrPermission) {
+		return nil, guidance(dir, err)
+	}
+
+	backup := fmt.Sprintf("%s.broken-%s", filepath.Clean(dir), time.Now().Format("20060102-150405"))
+	if mvErr := os.Rename(dir, backup); mvErr != nil {
+		return nil, fmt.Errorf("%w (moving it to %s also failed: %v)", guidance(dir, err), backup, mvErr)
+	}
+	log.Errorf("database at %s could not be repaired and was moved to %s, starting with an empty pool: %v", dir, backup, err)
+	return badger.Open(opts)
+}
+
+// guidance 返回附帶處理建議的打開錯誤
+func guidance(dir string, err error) error {
+	return fmt.Errorf("failed to open database at %s: %w; move the directory away (proxies are gathered again on start) "+
+		"or set db.recovery to reset to do this automatically", dir, err)
+}
+
+// isLockError 判斷是否為目錄鎖衝突
+func isLockError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Cannot acquire directory lock")
+}
+
+// isKeyError 判斷是否為加密密鑰錯誤（密鑰與數據庫不符或長度無效）
+func isKeyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	// Badger 打開時用 %+v 包裝錯誤，errors.Is 無法識別
+	msg := err.Error()
+	return strings.Contains(msg, badger.ErrEncryptionKeyMismatch.Error()) ||
+		strings.Contains(msg, badger.ErrInvalidEncryptionKey.Error())
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func testOptions(dir string) badger.Options {
+	return badger.DefaultOptions(dir).WithLogger(nil)
+}
+
+// newTestDB 創建包含一個鍵的數據庫並關閉
+func newTestDB(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "db")
+	db, err := badger.Open(testOptions(dir))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := db.Update(func(txn *badger.Txn) error { return txn.Set([]byte("k"), []byte("v")) }); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return dir
+}
+
+// hasKey 數據庫中是否仍有 newTestDB 寫入的鍵
+func hasKey(t *testing.T, db *badger.DB) bool {
+	t.Helper()
+	err := db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("k"))
+		return err
+	})
+	return err == nil
+}
+
+func TestOpenEmptyLogFiles(t *testing.T) {
+	for _, name := range []string{"000009.vlog", "00009.mem"} {
+		t.Run(name, func(t *testing.T) {
+			dir := newTestDB(t)
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			db, err := Open(testOptions(dir), RecoveryRepair)
+			if err != nil {
+				t.Fatalf("Open with repair: %v", err)
+			}
+			defer db.Close()
+			if !hasKey(t, db) {
+				t.Error("data lost after repair")
+			}
+		})
+	}
+
+	dir := newTestDB(t)
+	if err := os.WriteFile(filepath.Join(dir, "000009.vlog"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(testOptions(dir), RecoveryOff); err == nil {
+		t.Error("expected open to fail without recovery")
+	}
+}
+
+func TestOpenCorruptManifest(t *testing.T) {
+	dir := newTestDB(t)
+	if err := os.Truncate(filepath.Join(dir, "MANIFEST"), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Open(testOptions(dir), RecoveryRepair)
+	if err == nil || !strings.Contains(err.Error(), "db.recovery") {
+		t.Fatalf("repair mode should fail with guidance, got %v", err)
+	}
+
+	db, err := Open(testOptions(dir), RecoveryReset)
+	if err != nil {
+		t.Fatalf("Open with reset: %v", err)
+	}
+	defer db.Close()
+	if hasKey(t, db) {
+		t.Error("reset should start with an empty database")
+	}
+	backups, _ := filepath.Glob(dir + ".broken-*")
+	if len(backups) != 1 {
+		t.Errorf("backups = %v, want one moved-aside directory", backups)
+	}
+}
+
+func TestOpenLocked(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("lock conflicts are only recognized from the Unix flock error")
+	}
+	dir := newTestDB(t)
+	held, err := badger.Open(testOptions(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	// 另一個進程持有目錄鎖：返回 ErrInUse，不刪除鎖文件，也不移走數據
+	if _, err := Open(testOptions(dir), RecoveryReset); !errors.Is(err, ErrInUse) {
+		t.Fatalf("err = %v, want ErrInUse", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "LOCK")); err != nil {
+		t.Errorf("lock file of the running process removed: %v", err)
+	}
+	if backups, _ := filepath.Glob(dir + ".broken-*"); len(backups) != 0 {
+		t.Errorf("locked database moved aside: %v", backups)
+	}
+}
+
+func TestOpenLeftoverLockFile(t *testing.T) {
+	// 已退出的進程留下的 LOCK 文件不持有目錄鎖，無需恢復即可打開
+	dir := newTestDB(t)
+	if err := os.WriteFile(filepath.Join(dir, "LOCK"), []byte(strconv.Itoa(os.Getppid())+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(testOptions(dir), RecoveryOff)
+	if err != nil {
+		t.Fatalf("Open with a leftover lock file: %v", err)
+	}
+	defer db.Close()
+	if !hasKey(t, db) {
+		t.Error("data lost")
+	}
+}
+
+func TestOpenEncryptionKeyMismatch(t *testing.T) {
+	key := []byte(strings.Repeat("k", 32))
+	dir := filepath.Join(t.TempDir(), "db")
+	db, err := Open(testOptions(dir).WithEncryptionKey(key).WithIndexCacheSize(1<<20), RecoveryReset)
+	if err != nil {
+		t.Fatalf("open encrypted: %v", err)
+	}
+	if err := db.Update(func(txn *badger.Txn) error { return txn.Set([]byte("k"), []byte("v")) }); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// 錯誤的密鑰和缺少密鑰都不得觸發 reset 移走數據
+	for name, opts := range map[string]badger.Options{
+		"wrong key": testOptions(dir).WithEncryptionKey([]byte(strings.Repeat("x", 32))).WithIndexCacheSize(1 << 20),
+		"no key":    testOptions(dir),
+	} {
+		if _, err := Open(opts, RecoveryReset); err == nil || !isKeyError(err) {
+			t.Errorf("%s: err = %v, want encryption key error", name, err)
+		}
+	}
+	if backups, _ := filepath.Glob(dir + ".broken-*"); len(backups) != 0 {
+		t.Fatalf("encrypted database moved aside: %v", backups)
+	}
+
+	db, err = Open(testOptions(dir).WithEncryptionKey(key).WithIndexCacheSize(1<<20), RecoveryOff)
+	if err != nil {
+		t.Fatalf("reopen with the right key: %v", err)
+	}
+	defer db.Close()
+	if !hasKey(t, db) {
+		t.Error("data lost")
+	}
+}
@@ -0,0 +1,75 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// scope 導出指標的 instrumentation scope
+var scope = instrumentation.Scope{Name: "github.com/e2u/dynamic-proxy/internal/metrics"}
+
+// registryProducer 把 metrics 註冊表轉換為 OTLP 指標：計數器為累計的單調 Sum，儀表為 Gauge，直方圖為累計的 Histogram
+type registryProducer struct {
+	reg   *metrics.Registry
+	start time.Time // 累計值的起始時間（進程內指標從啟動時開始累計）
+}
+
+func newRegistryProducer(reg *metrics.Registry) *registryProducer {
+	return &registryProducer{reg: reg, start: time.Now()}
+}
+
+// Produce 實現 sdkmetric.Producer
+func (p *registryProducer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	now := time.Now()
+	families := p.reg.Snapshot()
+	sm := metricdata.ScopeMetrics{Scope: scope, Metrics: make([]metricdata.Metrics, 0, len(families))}
+	for _, f := range families {
+		m := metricdata.Metrics{Name: f.Name, Description: f.Help}
+		switch f.Type {
+		case metrics.TypeCounter:
+			points := make([]metricdata.DataPoint[float64], len(f.Samples))
+			for i, s := range f.Samples {
+				points[i] = metricdata.DataPoint[float64]{Attributes: attributes(f.Labels, s.LabelValues), StartTime: p.start, Time: now, Value: s.Value}
+			}
+			m.Data = metricdata.Sum[float64]{DataPoints: points, Temporality: metricdata.CumulativeTemporality, IsMonotonic: true}
+		case metrics.TypeGauge:
+			points := make([]metricdata.DataPoint[float64], len(f.Samples))
+			for i, s := range f.Samples {
+				points[i] = metricdata.DataPoint[float64]{Attributes: attributes(f.Labels, s.LabelValues), Time: now, Value: s.Value}
+			}
+			m.Data = metricdata.Gauge[float64]{DataPoints: points}
+		case metrics.TypeHistogram:
+			points := make([]metricdata.HistogramDataPoint[float64], len(f.Samples))
+			for i, s := range f.Samples {
+				points[i] = metricdata.HistogramDataPoint[float64]{
+					Attributes:   attributes(f.Labels, s.LabelValues),
+					StartTime:    p.start,
+					Time:         now,
+					Count:        s.Count,
+					Bounds:       s.Bounds,
+					BucketCounts: s.Counts,
+					Sum:          s.Sum,
+				}
+			}
+			m.Data = metricdata.Histogram[float64]{DataPoints: points, Temporality: metricdata.CumulativeTemporality}
+		default:
+			continue
+		}
+		sm.Metrics = append(sm.Metrics, m)
+	}
+	return []metricdata.ScopeMetrics{sm}, nil
+}
+
+// attributes 把標籤轉換為屬性集
+func attributes(labels, values []string) attribute.Set {
+	kvs := make([]attribute.KeyValue, len(labels))
+	for i, l := range labels {
+		kvs[i] = attribute.String(l, values[i])
+	}
+	return attribute.NewSet(kvs...)
+}
@@ -0,0 +1,56 @@
+package telemetry
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRegistryProducer(t *testing.T) {
+	counter := metrics.NewCounterVec("telemetry_test_requests_total", "Test counter.", "code")
+	counter.Add(3, "200")
+	hist := metrics.NewHistogramVec("telemetry_test_duration_seconds", "Test histogram.", []float64{1, 5}, "result")
+	hist.Observe(0.5, "ok")
+	hist.Observe(2, "ok")
+	hist.Observe(10, "ok")
+
+	scopes, err := newRegistryProducer(metrics.Default).Produce(context.Background())
+	if err != nil {
+		t.Fatalf("Produce: %v", err)
+	}
+	if len(scopes) != 1 {
+		t.Fatalf("scopes = %d, want 1", len(scopes))
+	}
+	find := func(name string) metricdata.Aggregation {
+		for _, m := range scopes[0].Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+		t.Fatalf("metric %s not produced", name)
+		return nil
+	}
+
+	sum, ok := find("telemetry_test_requests_total").(metricdata.Sum[float64])
+	if !ok || !sum.IsMonotonic || sum.Temporality != metricdata.CumulativeTemporality {
+		t.Fatalf("counter produced as %#v", sum)
+	}
+	if len(sum.DataPoints) != 1 || sum.DataPoints[0].Value != 3 {
+		t.Fatalf("counter points = %+v", sum.DataPoints)
+	}
+	if v, _ := sum.DataPoints[0].Attributes.Value("code"); v.AsString() != "200" {
+		t.Errorf("counter attribute code = %q", v.AsString())
+	}
+
+	h, ok := find("telemetry_test_duration_seconds").(metricdata.Histogram[float64])
+	if !ok || len(h.DataPoints) != 1 {
+		t.Fatalf("histogram produced as %#v", h)
+	}
+	p := h.DataPoints[0]
+	if p.Count != 3 || p.Sum != 12.5 || !slices.Equal(p.Bounds, []float64{1, 5}) || !slices.Equal(p.BucketCounts, []uint64{1, 1, 1}) {
+		t.Errorf("histogram point = %+v", p)
+	}
+}
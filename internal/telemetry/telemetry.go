@@ -0,0 +1,87 @@
+// Package telemetry 以 OTLP/HTTP 導出追蹤和指標：追蹤來自各組件通過 otel.Tracer 創建的 span，
+// 指標取自 metrics 註冊表（與管理端 /metrics 相同），按固定間隔推送到 Collector。
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+)
+
+// Options 導出設置
+type Options struct {
+	Endpoint       string            // OTLP/HTTP 地址（如 http://otel-collector:4318），追蹤發往 /v1/traces，指標發往 /v1/metrics
+	Headers        map[string]string // 隨導出請求發送的頭部
+	Traces         bool              // 導出追蹤
+	Metrics        bool              // 導出指標
+	SampleRatio    float64           // 新追蹤的採樣比例，客戶端已採樣的請求總是記錄
+	MetricInterval time.Duration     // 指標導出間隔
+	ServiceName    string
+	ServiceVersion string
+}
+
+// Start 按 o 啟動導出：設置全局的 TracerProvider 和傳播器（W3C Trace Context 與 Baggage），
+// 並按間隔導出 reg 中的指標。返回的 shutdown 導出剩餘數據後停止，應在進程退出前調用
+func Start(ctx context.Context, o Options, reg *metrics.Registry) (shutdown func(context.Context) error, err error) {
+	var shutdowns []func(context.Context) error
+	shutdown = func(ctx context.Context) error {
+		var errs []error
+		for _, fn := range shutdowns {
+			errs = append(errs, fn(ctx))
+		}
+		return errors.Join(errs...)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(o.ServiceName),
+		semconv.ServiceVersion(o.ServiceVersion),
+	))
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(o.Endpoint, "/")
+
+	if o.Traces {
+		exp, err := otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpointURL(base+"/v1/traces"),
+			otlptracehttp.WithHeaders(o.Headers))
+		if err != nil {
+			return nil, err
+		}
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exp),
+			sdktrace.WithResource(res),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.SampleRatio))),
+		)
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+		shutdowns = append(shutdowns, tp.Shutdown)
+	}
+
+	if o.Metrics {
+		exp, err := otlpmetrichttp.New(ctx,
+			otlpmetrichttp.WithEndpointURL(base+"/v1/metrics"),
+			otlpmetrichttp.WithHeaders(o.Headers))
+		if err != nil {
+			shutdown(ctx)
+			return nil, err
+		}
+		reader := sdkmetric.NewPeriodicReader(exp,
+			sdkmetric.WithInterval(o.MetricInterval),
+			sdkmetric.WithProducer(newRegistryProducer(reg)))
+		mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res))
+		shutdowns = append(shutdowns, mp.Shutdown)
+	}
+	return shutdown, nil
+}
@@ -0,0 +1,158 @@
+// Package tlsserve 為本程序對外提供的服務（代理端點、管理 API）創建 TLS 配置：使用證書文件，
+// 或經由 ACME（如 Let's Encrypt）自動申請並在到期前續期證書
+package tlsserve
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/e2u/dynamic-proxy/internal/logging"
+)
+
+var log = logging.For("tls")
+
+// Options 一個服務的證書來源：CertFile/KeyFile 與 ACMEDomains 二選一
+type Options struct {
+	CertFile string
+	KeyFile  string
+	// ACMEDomains 經由 ACME 申請證書的域名，需要同時設置 ACME
+	ACMEDomains []string
+	// ACME 申請證書使用的管理器（各服務共用同一個賬戶、緩存和 HTTP-01 驗證端口）
+	ACME *ACME
+}
+
+// Enabled 是否配置了證書來源
+func (o Options) Enabled() bool {
+	return o.CertFile != "" || len(o.ACMEDomains) > 0
+}
+
+// Config 按選項創建服務端 TLS 配置，未配置證書來源時返回 nil。
+// 只協商 HTTP/1.1（代理的 CONNECT 與協議升級需要接管連接）；使用 ACME 時把域名加入 o.ACME 允許申請的列表
+func Config(o Options) (*tls.Config, error) {
+	switch {
+	case !o.Enabled():
+		return nil, nil
+	case o.CertFile != "" && len(o.ACMEDomains) > 0:
+		return nil, errors.New("certificate files and ACME are mutually exclusive")
+	case o.CertFile != "":
+		if o.KeyFile == "" {
+			return nil, errors.New("key file is required with a certificate file")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load certificate: %w", err)
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"http/1.1"},
+			MinVersion:   tls.VersionTLS12,
+		}, nil
+	case o.ACME == nil:
+		return nil, errors.New("ACME domains require an ACME manager")
+	}
+	o.ACME.addDomains(o.ACMEDomains...)
+	return &tls.Config{
+		GetCertificate: o.ACME.m.GetCertificate,
+		NextProtos:     []string{"http/1.1", acme.ALPNProto},
+		MinVersion:     tls.VersionTLS12,
+	}, nil
+}
+
+// ACMEOptions ACME 賬戶與緩存設置
+type ACMEOptions struct {
+	// Email 賬戶聯繫郵箱（可為空），用於接收證書到期等通知
+	Email string
+	// CacheDir 證書與賬戶密鑰的緩存目錄（重啟後沿用，避免重複申請觸發頻率限制）
+	CacheDir string
+	// DirectoryURL ACME 服務目錄地址（空表示 Let's Encrypt 正式環境）
+	DirectoryURL string
+}
+
+// ACME 各服務共用的 ACME 證書管理器：只為加入的域名申請證書，證書在到期前 30 天內自動續期。
+// 預設以 TLS-ALPN-01 完成驗證（要求 CA 能在 443 端口訪問到服務），ServeHTTPChallenges 啟動後同時支持 HTTP-01
+type ACME struct {
+	m *autocert.Manager
+
+	mu      sync.RWMutex
+	domains []string
+}
+
+// NewACME 創建 ACME 證書管理器
+func NewACME(o ACMEOptions) (*ACME, error) {
+	if o.CacheDir == "" {
+		return nil, errors.New("ACME cache directory is required")
+	}
+	a := &ACME{}
+	a.m = &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: a.hostPolicy,
+		Cache:      autocert.DirCache(o.CacheDir),
+		Email:      o.Email,
+	}
+	if o.DirectoryURL != "" {
+		a.m.Client = &acme.Client{DirectoryURL: o.DirectoryURL}
+	}
+	return a, nil
+}
+
+// addDomains 把域名加入允許申請證書的列表
+func (a *ACME) addDomains(domains ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, d := range domains {
+		if !slices.Contains(a.domains, d) {
+			a.domains = append(a.domains, d)
+		}
+	}
+}
+
+// Domains 返回允許申請證書的域名
+func (a *ACME) Domains() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return slices.Clone(a.domains)
+}
+
+// hostPolicy 拒絕為列表之外的主機名申請證書（避免任意 SNI 觸發申請和 CA 頻率限制）
+func (a *ACME) hostPolicy(_ context.Context, host string) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if !slices.Contains(a.domains, host) {
+		return fmt.Errorf("acme: host %q not configured", host)
+	}
+	return nil
+}
+
+// ServeHTTPChallenges 在 addr 上處理 HTTP-01 驗證請求（/.well-known/acme-challenge/），
+// 其他請求重定向到 HTTPS；返回停止服務的函數
+func (a *ACME) ServeHTTPChallenges(addr string) (stop func(), err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen ACME HTTP challenges on %s: %w", addr, err)
+	}
+	srv := &http.Server{
+		Handler:           a.m.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Infof("ACME HTTP-01 challenges served on %s", ln.Addr())
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("ACME challenge server error: %v", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,149 @@
+package tlsserve
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// writeSelfSigned 生成自簽名證書和私鑰文件
+func writeSelfSigned(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "proxy.example.com"},
+		DNSNames:     []string{"proxy.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestConfigFiles(t *testing.T) {
+	certFile, keyFile := writeSelfSigned(t, t.TempDir())
+	tc, err := Config(Options{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	if len(tc.Certificates) != 1 || !slices.Equal(tc.NextProtos, []string{"http/1.1"}) {
+		t.Errorf("tls config = %+v", tc)
+	}
+
+	if tc, err := Config(Options{}); tc != nil || err != nil {
+		t.Errorf("Config without certificate source = %v, %v; want nil, nil", tc, err)
+	}
+	a, err := NewACME(ACMEOptions{CacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewACME: %v", err)
+	}
+	invalid := []Options{
+		{CertFile: certFile},
+		{CertFile: certFile, KeyFile: keyFile, ACMEDomains: []string{"proxy.example.com"}, ACME: a},
+		{CertFile: filepath.Join(t.TempDir(), "missing.pem"), KeyFile: keyFile},
+		{ACMEDomains: []string{"proxy.example.com"}},
+	}
+	for i, o := range invalid {
+		if _, err := Config(o); err == nil {
+			t.Errorf("options %d: expected error", i)
+		}
+	}
+}
+
+func TestConfigACME(t *testing.T) {
+	if _, err := NewACME(ACMEOptions{}); err == nil {
+		t.Error("ACME without a cache directory should be rejected")
+	}
+	a, err := NewACME(ACMEOptions{CacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewACME: %v", err)
+	}
+	proxyTLS, err := Config(Options{ACMEDomains: []string{"proxy.example.com"}, ACME: a})
+	if err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	if _, err := Config(Options{ACMEDomains: []string{"admin.example.com", "proxy.example.com"}, ACME: a}); err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	if proxyTLS.GetCertificate == nil || !slices.Contains(proxyTLS.NextProtos, acme.ALPNProto) {
+		t.Errorf("tls config = %+v, want GetCertificate and %s", proxyTLS, acme.ALPNProto)
+	}
+	// 各服務的域名合併到同一個管理器
+	if got := a.Domains(); !slices.Equal(got, []string{"proxy.example.com", "admin.example.com"}) {
+		t.Errorf("domains = %v", got)
+	}
+	// 不在域名列表中的主機名直接拒絕，不向 CA 申請
+	if _, err := proxyTLS.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"}); err == nil {
+		t.Error("certificate issued for a host outside the domain list")
+	}
+}
+
+func TestServeHTTPChallenges(t *testing.T) {
+	a, err := NewACME(ACMEOptions{CacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewACME: %v", err)
+	}
+	// 取一個空閒端口
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	stop, err := a.ServeHTTPChallenges(addr)
+	if err != nil {
+		t.Fatalf("ServeHTTPChallenges: %v", err)
+	}
+	defer stop()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	get := func(path string) int {
+		t.Helper()
+		resp, err := client.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// 域名列表之外的主機的驗證請求被拒絕，其他請求重定向到 HTTPS
+	if status := get("/.well-known/acme-challenge/token"); status != http.StatusForbidden {
+		t.Errorf("challenge for unknown host status = %d, want 403", status)
+	}
+	if status := get("/"); status != http.StatusFound {
+		t.Errorf("plain request status = %d, want 302", status)
+	}
+}
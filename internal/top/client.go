@@ -0,0 +1,97 @@
+package top
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/state"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// Entry GET /api/proxies 返回的代理記錄及其使用統計
+type Entry struct {
+	pool.Proxy
+	Usage        pool.Usage `json:"usage"`
+	CurrentScore float64    `json:"current_score"`
+}
+
+// Snapshot 某一時刻的代理池狀態
+type Snapshot struct {
+	At      time.Time
+	State   state.Document
+	Proxies []Entry
+}
+
+// Client 管理 API 客戶端
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// NewClient 創建訪問 base（如 http://127.0.0.1:9090）管理 API 的客戶端，token 非空時以 Bearer 令牌認證（admin.token）
+func NewClient(base, token string) *Client {
+	return &Client{base: strings.TrimRight(base, "/"), token: token, http: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Snapshot 讀取狀態文檔和全部代理記錄
+func (c *Client) Snapshot(ctx context.Context) (Snapshot, error) {
+	var s Snapshot
+	if err := c.do(ctx, http.MethodGet, "/api/state", nil, &s.State); err != nil {
+		return s, err
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/proxies", nil, &s.Proxies); err != nil {
+		return s, err
+	}
+	s.At = time.Now()
+	return s, nil
+}
+
+// SetDisabled 手動禁用或啟用代理（ip:port）
+func (c *Client) SetDisabled(ctx context.Context, key string, disabled bool) error {
+	body, _ := json.Marshal(map[string]bool{"disabled": disabled})
+	return c.do(ctx, http.MethodPut, "/api/proxies/"+url.PathEscape(key)+"/disabled", body, nil)
+}
+
+// do 發送請求並把響應解碼到 out（out 為 nil 時丟棄響應體）；非 2xx 響應返回管理 API 的錯誤信息
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(msg, &e) == nil && e.Error != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, e.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
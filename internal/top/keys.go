@@ -0,0 +1,82 @@
+package top
+
+import "bytes"
+
+// Key 界面處理的按鍵
+type Key int
+
+const (
+	KeyUnknown Key = iota
+	KeyQuit
+	KeyUp
+	KeyDown
+	KeyPageUp
+	KeyPageDown
+	KeyHome
+	KeyEnd
+	KeySort
+	KeyDisable
+	KeyEnable
+	KeyRefresh
+)
+
+// escapeKeys 方向鍵等按鍵的 ANSI 轉義序列
+var escapeKeys = []struct {
+	seq []byte
+	key Key
+}{
+	{[]byte("\x1b[A"), KeyUp},
+	{[]byte("\x1bOA"), KeyUp},
+	{[]byte("\x1b[B"), KeyDown},
+	{[]byte("\x1bOB"), KeyDown},
+	{[]byte("\x1b[5~"), KeyPageUp},
+	{[]byte("\x1b[6~"), KeyPageDown},
+	{[]byte("\x1b[H"), KeyHome},
+	{[]byte("\x1b[1~"), KeyHome},
+	{[]byte("\x1b[F"), KeyEnd},
+	{[]byte("\x1b[4~"), KeyEnd},
+}
+
+// runeKeys 單字節按鍵
+var runeKeys = map[byte]Key{
+	'q': KeyQuit, 3: KeyQuit, // Ctrl-C
+	'k': KeyUp, 'j': KeyDown,
+	'g': KeyHome, 'G': KeyEnd,
+	's': KeySort, 'd': KeyDisable, 'e': KeyEnable, 'r': KeyRefresh,
+}
+
+// ParseKeys 解析一次從終端讀取的輸入，不認識的轉義序列整體忽略
+func ParseKeys(b []byte) []Key {
+	var keys []Key
+	for len(b) > 0 {
+		if b[0] == 0x1b {
+			n := 1
+			key := KeyUnknown
+			for _, e := range escapeKeys {
+				if bytes.HasPrefix(b, e.seq) {
+					n, key = len(e.seq), e.key
+					break
+				}
+			}
+			if key == KeyUnknown {
+				// 跳過 CSI 序列的參數直到終止字節
+				if len(b) > 1 && b[1] == '[' {
+					n = 2
+					for n < len(b) && (b[n] < 0x40 || b[n] > 0x7e) {
+						n++
+					}
+					n = min(n+1, len(b))
+				}
+			} else {
+				keys = append(keys, key)
+			}
+			b = b[n:]
+			continue
+		}
+		if key, ok := runeKeys[b[0]]; ok {
+			keys = append(keys, key)
+		}
+		b = b[1:]
+	}
+	return keys
+}
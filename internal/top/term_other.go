@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd || windows)
+
+package top
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw 其他平台不支持終端界面
+func makeRaw(_, _ *os.File) (func(), error) {
+	return nil, errors.New("terminal UI is not supported on this platform")
+}
+
+// termSize 其他平台不支持終端界面
+func termSize(_ *os.File) (int, int, error) {
+	return 0, 0, errors.New("terminal UI is not supported on this platform")
+}
@@ -0,0 +1,43 @@
+//go:build windows
+
+package top
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// makeRaw 把控制台切換到原始模式並啟用虛擬終端序列（方向鍵以 ANSI 轉義序列輸入，輸出支持 ANSI 控制序列），
+// 返回恢復原模式的函數
+func makeRaw(in, out *os.File) (func(), error) {
+	inh, outh := windows.Handle(in.Fd()), windows.Handle(out.Fd())
+	var inMode, outMode uint32
+	if err := windows.GetConsoleMode(inh, &inMode); err != nil {
+		return nil, errNotTerminal
+	}
+	if err := windows.GetConsoleMode(outh, &outMode); err != nil {
+		return nil, errNotTerminal
+	}
+	raw := inMode&^(windows.ENABLE_ECHO_INPUT|windows.ENABLE_PROCESSED_INPUT|windows.ENABLE_LINE_INPUT) | windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(inh, raw); err != nil {
+		return nil, err
+	}
+	if err := windows.SetConsoleMode(outh, outMode|windows.ENABLE_PROCESSED_OUTPUT|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+		_ = windows.SetConsoleMode(inh, inMode)
+		return nil, err
+	}
+	return func() {
+		_ = windows.SetConsoleMode(inh, inMode)
+		_ = windows.SetConsoleMode(outh, outMode)
+	}, nil
+}
+
+// termSize 控制台窗口的列數和行數
+func termSize(out *os.File) (int, int, error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(out.Fd()), &info); err != nil {
+		return 0, 0, err
+	}
+	return int(info.Window.Right-info.Window.Left) + 1, int(info.Window.Bottom-info.Window.Top) + 1, nil
+}
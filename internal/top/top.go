@@ -0,0 +1,173 @@
+// Package top 終端界面（dynamic-proxy top）：經由管理 API 定時刷新代理池概況、轉發速率和按使用次數或失敗次數
+// 排序的代理列表，可手動禁用或啟用代理。只使用 ANSI 控制序列，SSH 會話中的任何終端都可使用
+package top
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// errNotTerminal 輸入或輸出不是終端
+var errNotTerminal = errors.New("top requires an interactive terminal")
+
+// requestTimeout 單次管理 API 請求的最長等待時間
+const requestTimeout = 10 * time.Second
+
+// Options 終端界面選項
+type Options struct {
+	Admin    string        // 管理 API 地址（如 http://127.0.0.1:9090）
+	Token    string        // 管理 API 令牌（admin.token），禁用或啟用代理時需要
+	Interval time.Duration // 刷新間隔
+	In, Out  *os.File      // 終端輸入輸出，預設為 os.Stdin 和 os.Stdout
+}
+
+// Run 運行終端界面直到按下 q 或 Ctrl-C、輸入關閉或 ctx 取消；首次讀取管理 API 失敗時不進入界面，直接返回錯誤
+func Run(ctx context.Context, o Options) error {
+	in, out := cmp.Or(o.In, os.Stdin), cmp.Or(o.Out, os.Stdout)
+	interval := cmp.Or(o.Interval, 2*time.Second)
+	client := NewClient(o.Admin, o.Token)
+
+	snap, err := snapshot(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to reach admin API at %s: %w", o.Admin, err)
+	}
+	restore, err := makeRaw(in, out)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	// 切換到備用屏幕並隱藏光標，退出時恢復原屏幕內容
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	v := NewView(o.Admin)
+	v.Update(snap)
+	keys := make(chan []Key)
+	go readKeys(in, keys)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, height := draw(out, v)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			refresh(ctx, client, v)
+		case ks, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range ks {
+				switch k {
+				case KeyQuit:
+					return nil
+				case KeyUp:
+					v.Move(-1)
+				case KeyDown:
+					v.Move(1)
+				case KeyPageUp:
+					v.Move(-max(height-chromeLines, 1))
+				case KeyPageDown:
+					v.Move(max(height-chromeLines, 1))
+				case KeyHome:
+					v.Move(-len(v.rows))
+				case KeyEnd:
+					v.Move(len(v.rows))
+				case KeySort:
+					v.ToggleSort()
+				case KeyDisable, KeyEnable:
+					setDisabled(ctx, client, v, k == KeyDisable)
+					refresh(ctx, client, v)
+				case KeyRefresh:
+					refresh(ctx, client, v)
+				}
+			}
+		}
+	}
+}
+
+// snapshot 在 requestTimeout 內讀取一次快照
+func snapshot(ctx context.Context, client *Client) (Snapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	return client.Snapshot(ctx)
+}
+
+// refresh 讀取新的快照，失敗時保留上一次的數據並在狀態行顯示錯誤
+func refresh(ctx context.Context, client *Client, v *View) {
+	s, err := snapshot(ctx, client)
+	if err != nil {
+		v.SetMessage("refresh failed: %v", err)
+		return
+	}
+	if strings.HasPrefix(v.message, "refresh failed") {
+		v.SetMessage("")
+	}
+	v.Update(s)
+}
+
+// setDisabled 手動禁用或啟用選中的代理，結果顯示在狀態行
+func setDisabled(ctx context.Context, client *Client, v *View, disabled bool) {
+	r, ok := v.SelectedRow()
+	if !ok {
+		return
+	}
+	action := "enable"
+	if disabled {
+		action = "disable"
+	}
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if err := client.SetDisabled(ctx, r.Key(), disabled); err != nil {
+		v.SetMessage("failed to %s %s: %v", action, r.Key(), err)
+		return
+	}
+	v.SetMessage("%sd %s", action, r.Key())
+}
+
+// draw 按當前終端尺寸重繪整個屏幕（無法讀取尺寸時按 80x24），返回使用的尺寸
+func draw(out io.Writer, v *View) (int, int) {
+	width, height := 80, 24
+	if f, ok := out.(*os.File); ok {
+		if w, h, err := termSize(f); err == nil && w > 0 && h > 0 {
+			width, height = w, h
+		}
+	}
+	bw := bufio.NewWriter(out)
+	bw.WriteString("\x1b[H")
+	for i, line := range v.Render(width, height) {
+		if i > 0 {
+			bw.WriteString("\r\n")
+		}
+		// 清除行尾殘留的舊內容
+		bw.WriteString(line + "\x1b[K")
+	}
+	bw.WriteString("\x1b[J")
+	bw.Flush()
+	return width, height
+}
+
+// readKeys 持續讀取終端輸入並解析為按鍵，輸入關閉時關閉 keys
+func readKeys(in io.Reader, keys chan<- []Key) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			if ks := ParseKeys(buf[:n]); len(ks) > 0 {
+				keys <- ks
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package top
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/state"
+)
+
+// 排序方式
+const (
+	SortUses     = "uses"
+	SortFailures = "failures"
+)
+
+// Row 列表中的一個代理
+type Row struct {
+	Entry
+	Rate float64 // 與上一次刷新之間的轉發速率（次/秒）
+}
+
+// View 界面狀態：最近兩次快照、排序方式與選中的代理，不涉及終端讀寫
+type View struct {
+	Admin string // 管理 API 地址，顯示在標題行
+
+	prev, cur *Snapshot
+	rows      []Row
+	sortBy    string
+	selected  string // 選中代理的鍵，刷新後保持選中同一個代理
+	cursor    int
+	offset    int
+	message   string
+}
+
+// NewView 創建按使用次數排序的界面
+func NewView(admin string) *View {
+	return &View{Admin: admin, sortBy: SortUses}
+}
+
+// Update 應用新的快照，計算速率並重新排序
+func (v *View) Update(s Snapshot) {
+	v.prev, v.cur = v.cur, &s
+	prevUses := make(map[string]uint64)
+	var elapsed float64
+	if v.prev != nil {
+		elapsed = s.At.Sub(v.prev.At).Seconds()
+		for _, e := range v.prev.Proxies {
+			prevUses[e.Key()] = e.Usage.Uses
+		}
+	}
+	v.rows = make([]Row, len(s.Proxies))
+	for i, e := range s.Proxies {
+		v.rows[i] = Row{Entry: e}
+		if n, ok := prevUses[e.Key()]; ok && elapsed > 0 && e.Usage.Uses >= n {
+			v.rows[i].Rate = float64(e.Usage.Uses-n) / elapsed
+		}
+	}
+	v.sort()
+}
+
+// ToggleSort 在按使用次數和按失敗次數排序之間切換
+func (v *View) ToggleSort() {
+	if v.sortBy == SortUses {
+		v.sortBy = SortFailures
+	} else {
+		v.sortBy = SortUses
+	}
+	v.sort()
+}
+
+// sort 按當前排序方式排列代理，選中的代理保持不變
+func (v *View) sort() {
+	slices.SortStableFunc(v.rows, func(a, b Row) int {
+		if v.sortBy == SortFailures {
+			if c := cmp.Compare(b.Usage.Failures, a.Usage.Failures); c != 0 {
+				return c
+			}
+		}
+		if c := cmp.Compare(b.Usage.Uses, a.Usage.Uses); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key(), b.Key())
+	})
+	v.cursor = 0
+	for i, r := range v.rows {
+		if r.Key() == v.selected {
+			v.cursor = i
+			break
+		}
+	}
+	v.selectRow(v.cursor)
+}
+
+// Move 上下移動選中的代理
+func (v *View) Move(delta int) {
+	v.selectRow(v.cursor + delta)
+}
+
+// selectRow 選中第 i 個代理（超出範圍時取最近的一個）
+func (v *View) selectRow(i int) {
+	v.cursor = max(min(i, len(v.rows)-1), 0)
+	v.selected = ""
+	if v.cursor < len(v.rows) {
+		v.selected = v.rows[v.cursor].Key()
+	}
+}
+
+// SelectedRow 選中的代理
+func (v *View) SelectedRow() (Row, bool) {
+	if v.cursor < len(v.rows) {
+		return v.rows[v.cursor], true
+	}
+	return Row{}, false
+}
+
+// SetMessage 設置狀態行顯示的消息（操作結果或錯誤）
+func (v *View) SetMessage(format string, args ...any) {
+	v.message = fmt.Sprintf(format, args...)
+}
+
+// Throughput 兩次刷新之間的總轉發速率（次/秒），只有一次快照時為 0
+func (v *View) Throughput() float64 {
+	var total float64
+	for _, r := range v.rows {
+		total += r.Rate
+	}
+	return total
+}
+
+// 列表之外佔用的行數：標題、概況、任務、空行、表頭，以及底部的狀態行和幫助行
+const chromeLines = 7
+
+// Render 按終端尺寸（列、行）生成每一行的內容，選中的行以反色顯示
+func (v *View) Render(width, height int) []string {
+	lines := make([]string, 0, height)
+	add := func(s string) { lines = append(lines, truncate(s, width)) }
+
+	at := "--:--:--"
+	var doc state.Document
+	if v.cur != nil {
+		at, doc = v.cur.At.Format(time.TimeOnly), v.cur.State
+	}
+	add(fmt.Sprintf("dynamic-proxy top  %s  %s %s  %s", v.Admin, doc.Version, doc.Mode, at))
+
+	disabled, manual := 0, 0
+	for _, r := range v.rows {
+		if r.Disable {
+			disabled++
+		}
+		if r.ManualDisable {
+			manual++
+		}
+	}
+	add(fmt.Sprintf("proxies: %d total, %d healthy, %d disabled (%d manual), %d pending   requests: %.1f/s",
+		doc.Pool.Total, doc.Pool.Healthy, disabled, manual, doc.Pool.Pending, v.Throughput()))
+
+	jobs := make([]string, 0, len(doc.Jobs))
+	for _, name := range slices.Sorted(maps.Keys(doc.Jobs)) {
+		j := doc.Jobs[name]
+		s := fmt.Sprintf("%s %s", name, j.State)
+		if j.LastError != "" {
+			s += " (failed)"
+		}
+		jobs = append(jobs, s)
+	}
+	add("jobs: " + strings.Join(jobs, ", "))
+	add("")
+	header := fmt.Sprintf("  %-21s %-6s %-2s %5s %6s %8s %6s %6s  %s",
+		"KEY", "PROTO", "CC", "SCORE", "HEALTH", "USES", "FAILS", "REQ/S", "STATE")
+	lines = append(lines, reverse(pad(truncate(header, width), width)))
+
+	// 列表滾動到能顯示選中的行
+	visible := max(height-chromeLines, 1)
+	if v.cursor < v.offset {
+		v.offset = v.cursor
+	}
+	if v.cursor >= v.offset+visible {
+		v.offset = v.cursor - visible + 1
+	}
+	v.offset = max(min(v.offset, len(v.rows)-visible), 0)
+	for i := v.offset; i < len(v.rows) && i < v.offset+visible; i++ {
+		r := v.rows[i]
+		marker := "  "
+		if i == v.cursor {
+			marker = "> "
+		}
+		line := truncate(fmt.Sprintf("%s%-21s %-6s %-2s %5.2f %6d %8d %6d %6.1f  %s", marker,
+			r.Key(), r.Protocol, r.Country, r.CurrentScore, r.Usage.Health, r.Usage.Uses, r.Usage.Failures, r.Rate, stateOf(r)), width)
+		if i == v.cursor {
+			line = reverse(pad(line, width))
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+
+	add(v.message)
+	add(fmt.Sprintf("↑/↓ select  s sort (%s)  d disable  e enable  r refresh  q quit", v.sortBy))
+	return lines
+}
+
+// stateOf 代理的狀態列，手動禁用的為 manual
+func stateOf(r Row) string {
+	switch {
+	case r.ManualDisable:
+		return "manual"
+	case r.Disable:
+		return "disabled"
+	case r.Updated.IsZero():
+		return "pending"
+	}
+	return "ok"
+}
+
+// truncate 按字符數截斷到 width
+func truncate(s string, width int) string {
+	if r := []rune(s); len(r) > width {
+		return string(r[:max(width, 0)])
+	}
+	return s
+}
+
+// pad 以空格補足到 width 個字符，使反色覆蓋整行
+func pad(s string, width int) string {
+	if n := len([]rune(s)); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// reverse 以反色顯示
+func reverse(s string) string {
+	return "\x1b[7m" + s + "\x1b[0m"
+}
@@ -0,0 +1,97 @@
+package top
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/state"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+func entry(ip string, uses, failures uint64) Entry {
+	return Entry{
+		Proxy: pool.Proxy{IP: ip, Port: "80", Protocol: "http", Updated: time.Now()},
+		Usage: pool.Usage{Uses: uses, Failures: failures, Health: pool.InitialHealth},
+	}
+}
+
+func keys(v *View) []string {
+	var out []string
+	for _, r := range v.rows {
+		out = append(out, r.Key())
+	}
+	return out
+}
+
+func TestViewSortAndRate(t *testing.T) {
+	now := time.Now()
+	v := NewView("http://127.0.0.1:9090")
+	v.Update(Snapshot{At: now, Proxies: []Entry{entry("1.1.1.1", 10, 5), entry("2.2.2.2", 20, 0)}})
+	if v.Throughput() != 0 {
+		t.Errorf("throughput with one snapshot = %v", v.Throughput())
+	}
+
+	v.Update(Snapshot{At: now.Add(2 * time.Second), Proxies: []Entry{entry("1.1.1.1", 14, 6), entry("2.2.2.2", 22, 0), entry("3.3.3.3", 0, 0)}})
+	if got, want := keys(v), []string{"2.2.2.2:80", "1.1.1.1:80", "3.3.3.3:80"}; !slices.Equal(got, want) {
+		t.Errorf("sorted by uses = %v, want %v", got, want)
+	}
+	if v.Throughput() != 3 {
+		t.Errorf("throughput = %v, want 3", v.Throughput())
+	}
+
+	// 選中的代理在重新排序後保持不變
+	v.Move(1)
+	v.ToggleSort()
+	if got, want := keys(v), []string{"1.1.1.1:80", "2.2.2.2:80", "3.3.3.3:80"}; !slices.Equal(got, want) {
+		t.Errorf("sorted by failures = %v, want %v", got, want)
+	}
+	if r, ok := v.SelectedRow(); !ok || r.Key() != "1.1.1.1:80" {
+		t.Errorf("selected = %v", r.Key())
+	}
+	v.Move(10)
+	if r, _ := v.SelectedRow(); r.Key() != "3.3.3.3:80" {
+		t.Errorf("selection past the end = %v", r.Key())
+	}
+}
+
+func TestViewRender(t *testing.T) {
+	manual := entry("2.2.2.2", 0, 0)
+	manual.Disable, manual.ManualDisable = true, true
+	proxies := []Entry{manual}
+	for i := range 20 {
+		proxies = append(proxies, entry("10.0.0."+string(rune('a'+i)), uint64(100-i), 0))
+	}
+	v := NewView("http://127.0.0.1:9090")
+	v.Update(Snapshot{At: time.Now(), State: state.Document{
+		Version: "v1.2.3", Pool: state.Pool{Total: 21, Healthy: 20},
+		Jobs: map[string]state.Job{"gather": {State: state.JobRunning}, "cleanup": {State: state.JobIdle}},
+	}, Proxies: proxies})
+	v.Move(20)
+
+	lines := v.Render(60, 12)
+	if len(lines) != 12 {
+		t.Fatalf("rendered %d lines, want 12", len(lines))
+	}
+	for i, l := range lines {
+		if n := len([]rune(strings.ReplaceAll(strings.ReplaceAll(l, "\x1b[7m", ""), "\x1b[0m", ""))); n > 60 {
+			t.Errorf("line %d is %d columns wide: %q", i, n, l)
+		}
+	}
+	if !strings.Contains(lines[1], "1 disabled (1 manual)") || !strings.Contains(lines[2], "cleanup idle, gather running") {
+		t.Errorf("summary = %q / %q", lines[1], lines[2])
+	}
+	// 列表滾動到選中的最後一行
+	if l := lines[len(lines)-3]; !strings.Contains(l, "2.2.2.2:80") || !strings.HasPrefix(l, "\x1b[7m> ") {
+		t.Errorf("selected row not visible: %q", l)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := ParseKeys([]byte("j\x1b[Ak\x1b[6~\x1b[1;5Cdq\x1b"))
+	want := []Key{KeyDown, KeyUp, KeyUp, KeyPageDown, KeyDisable, KeyQuit}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseKeys = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// judgeCommand judge 子命令：只運行自建判定服務（不讀取配置、不打開數據庫），供部署在自己的服務器上，
+// 把 validation.judge_url 指向 http://<地址>/get、test_urls 指向 http://<地址>/generate_204
+func judgeCommand(args []string) error {
+	fs := flag.NewFlagSet("judge", flag.ContinueOnError)
+	listen := fs.String("listen", ":8080", "Address to serve the judge endpoint on")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           pool.JudgeHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+	fmt.Printf("Judge server listening on %s (GET /get, /generate_204)\n", *listen)
+	return srv.ListenAndServe()
+}
@@ -1,176 +1,541 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/internal/admin"
+	"github.com/e2u/dynamic-proxy/internal/buildinfo"
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/internal/eventlog"
 	"github.com/e2u/dynamic-proxy/internal/extractor"
+	"github.com/e2u/dynamic-proxy/internal/feed"
 	"github.com/e2u/dynamic-proxy/internal/fetcher"
-	"github.com/e2u/dynamic-proxy/internal/proxy"
+	"github.com/e2u/dynamic-proxy/internal/logging"
+	"github.com/e2u/dynamic-proxy/internal/notify"
+	"github.com/e2u/dynamic-proxy/internal/paths"
+	"github.com/e2u/dynamic-proxy/internal/sourcestats"
+	"github.com/e2u/dynamic-proxy/internal/store"
+	"github.com/e2u/dynamic-proxy/internal/tlsserve"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+	"github.com/e2u/dynamic-proxy/pkg/rotator"
 	"github.com/gocolly/colly/v2"
 	"github.com/robfig/cron/v3"
-	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var proxyUrls = []string{
-	// group 1
-	"https://free-proxy-list.net/en/",
-	"https://free-proxy-list.net/en/socks-proxy.html",
-	"https://free-proxy-list.net/en/uk-proxy.html",
-	"https://free-proxy-list.net/en/ssl-proxy.html",
-	"https://free-proxy-list.net/en/anonymous-proxy.html",
-	"https://free-proxy-list.net/en/google-proxy.html",
-	// group 2
-	"https://api.proxyscrape.com/v4/free-proxy-list/get?request=get_proxies&proxy_format=protocolipport&format=json",
-	"https://proxylist.geonode.com/api/proxy-list?limit=500&page=1&sort_by=lastChecked&sort_type=desc",
-	"https://cdn.jsdelivr.net/gh/proxifly/free-proxy-list@main/proxies/all/data.json",
-}
+// proxySources 代理列表來源（取自配置 sources）
+var proxySources []config.SourceConfig
+
+// gatherCfg 採集配置
+var gatherCfg config.GatherConfig
+
+// cleanupPolicy 清理策略（取自配置 cleanup）
+var cleanupPolicy pool.CleanupPolicy
 
 var (
 	bdb *badger.DB
+	// 代理記錄的寫入入口，觸發生命週期回調（見 newProxyStore）
+	proxyStore *pool.Pool
 	// 用於防止定時任務並發執行的互斥鎖
 	cronMutex sync.Mutex
-	// 批量驗證通道
-	validateChan chan *proxy.Proxy
+	// 代理池事件通知（未配置 Webhook 時為 nil）
+	notifier *notify.Notifier
+	// 按來源的採集與驗證統計
+	sourceStats = sourcestats.New(sourcestats.DemotePolicy{})
+	// 代理池變化的事件記錄（events.capacity 為 0 時為 nil）
+	events *eventlog.Log
+	// 代理池變化的實時推送（GET /api/feed）
+	proxyFeed = feed.NewHub()
+)
+
+// 組件日誌器
+var (
+	log          = logging.For("main")
+	gatherLog    = logging.For("gather")
+	validatorLog = logging.For("validator")
+	storeLog     = logging.For("store")
+	healthLog    = logging.For("health")
+	replicaLog   = logging.For("replica")
+	clusterLog   = logging.For("cluster")
 )
 
 func gatherProxies() {
-	proxiesChan := make(chan *proxy.Proxy, 500)
+	defer jobs.Start(jobGather)(nil)
+	ctx, span := tracer.Start(context.Background(), "gather")
+	defer span.End()
+	start := time.Now()
+	events.Record(eventlog.GatherStarted, "", map[string]any{"sources": len(proxySources)})
+	proxiesChan := make(chan *pool.Proxy, 500)
 	var wg sync.WaitGroup
 	var newProxyCount, updateProxyCount int64
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for p := range proxiesChan {
-			// 確保代理數據是有效的
-			if p.IP == "" || p.Port == "" {
-				logrus.Warnf("invalid proxy skipped: IP=%s, Port=%s", p.IP, p.Port)
-				continue
+		// 寫入失敗已記錄日誌，採集照常完成
+		newProxyCount, updateProxyCount, _ = storeCandidates(proxiesChan)
+	}()
+
+	// 各域名的來源並行採集，每個來源有獨立的時限，某個來源掛起或失敗不影響其他來源
+	poolRT := sync.OnceValue(gatherTransport)
+	cache := fetcher.NewConditionalCache(loadHTTPCache())
+	sem := make(chan struct{}, max(gatherCfg.Concurrency, 1))
+	var fetchWG sync.WaitGroup
+	for _, group := range groupSourcesByHost(proxySources) {
+		fetchWG.Add(1)
+		go func() {
+			defer fetchWG.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			for _, src := range group {
+				for _, src := range expandSource(src) {
+					// 返回 429 或 5xx 的來源退避期間不採集
+					if until, ok := sourceStats.Backoff(src.URL, time.Now()); ok {
+						gatherLog.WithFields(logger.Fields{"url": src.URL, "until": until.Format(time.RFC3339)}).
+							Info("Skipping source backing off after errors")
+						continue
+					}
+					// 評分過低的來源降低採集頻率
+					if !sourceStats.ShouldFetch(src.URL) {
+						gatherLog.WithField("url", src.URL).Info("Skipping low-quality source this run")
+						continue
+					}
+					gatherSource(ctx, src, sourceTransport(src, poolRT), proxiesChan, cache)
+				}
 			}
+		}()
+	}
 
-			err := bdb.Update(func(txn *badger.Txn) error {
-				key := []byte(p.String())
-				val := p.DumpJSON()
+	fetchWG.Wait()
+	saveHTTPCache(cache)
+	close(proxiesChan)
+	wg.Wait()
+	gatherLog.Infof("All proxies have been processed, new: %d, updated: %d", newProxyCount, updateProxyCount)
 
-				// 檢查 val 是否有效
-				if val == nil || len(val) == 0 {
-					logrus.Errorf("empty JSON value for proxy %s", p.String())
-					return nil // 跳過這個代理
-				}
+	notifier.Notify(notify.Event{
+		Type:    notify.EventGatherCompleted,
+		Message: fmt.Sprintf("gather completed, new: %d, updated: %d", newProxyCount, updateProxyCount),
+	})
+	recordGather(newProxyCount, updateProxyCount)
+	gatheredProxies.Add(float64(newProxyCount), "new")
+	gatheredProxies.Add(float64(updateProxyCount), "updated")
+	gatherDuration.Observe(time.Since(start).Seconds(), "run")
+	span.SetAttributes(attribute.Int("gather.sources", len(proxySources)),
+		attribute.Int64("gather.new", newProxyCount), attribute.Int64("gather.updated", updateProxyCount))
+	events.Record(eventlog.GatherFinished, "", map[string]any{"new": newProxyCount, "updated": updateProxyCount})
+	saveSourceStats()
+	reportPoolHealth()
+}
 
-				_, err := txn.Get(key)
-				if err != nil {
-					if errors.Is(err, badger.ErrKeyNotFound) {
-						if err := txn.Set(key, val); err != nil {
-							logrus.Errorf("failed to set proxy in db: %v", err)
-							return err
-						}
-						logrus.Debugf("Added new proxy to db: %s", p.String())
-						newProxyCount++
-						return nil
-					}
-					return err
-				}
+// storeBatchSize 採集結果每批寫入數據庫的代理數，storeFlushInterval 未滿一批時的最長等待時間
+const (
+	storeBatchSize     = 500
+	storeFlushInterval = time.Second
+)
 
-				logrus.Debugf("Proxy already exists in db, updating: %s", p.String())
-				updateProxyCount++
-				return txn.Set(key, val)
-			})
+// storeCandidates 把 in 中的候選代理分批寫入數據庫直到 in 關閉，返回新增和更新的代理數；
+// 新候選代理進入待驗證狀態，由驗證隊列按速率驗證，同一 ip:port 已存在時合併記錄，
+// 最近首次驗證即失敗的代理跳過；某批寫入失敗時照常寫入其餘批次，返回第一個錯誤
+func storeCandidates(in <-chan *pool.Proxy) (added, updated int64, err error) {
+	var knownBad int64
+	defer func() {
+		if knownBad > 0 {
+			gatherLog.Infof("Skipped %d candidates that failed validation recently", knownBad)
+		}
+	}()
 
-			if err != nil {
-				logrus.Errorf("failed to update db for proxy %s: %v", p.String(), err)
+	batch := make([]*pool.Proxy, 0, storeBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		res, batchErr := proxyStore.AddBatch(batch)
+		if batchErr != nil {
+			gatherLog.Errorf("failed to store %d proxies: %v", len(batch), batchErr)
+			if err == nil {
+				err = batchErr
 			}
 		}
-	}()
+		gatherLog.Debugf("Stored batch of %d proxies, new: %d, updated: %d", len(batch), res.Added, res.Updated)
+		added += int64(res.Added)
+		updated += int64(res.Updated)
+		knownBad += int64(res.KnownBad)
+		batch = batch[:0]
+	}
 
-	c := fetcher.NewColly()
-	logrus.Debugf("Colly collector initialized with User-Agent: %s", c.UserAgent)
+	ticker := time.NewTicker(storeFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case p, ok := <-in:
+			if !ok {
+				flush()
+				return added, updated, err
+			}
+			// 確保代理數據是有效的
+			if p.IP == "" || p.Port == "" {
+				gatherLog.Warnf("invalid proxy skipped: IP=%s, Port=%s", p.IP, p.Port)
+				continue
+			}
+			if batch = append(batch, p); len(batch) >= storeBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
 
-	c.OnResponse(func(r *colly.Response) {
-		logrus.Debugf("Visited: %s", r.Request.URL)
-		logrus.Infof("%s Response Status Code: %d", r.Request.URL, r.StatusCode)
-		logrus.Debugf("Response Body Length: %d", len(r.Body))
+// groupSourcesByHost 按來源 URL 的主機分組（保持配置順序），同一主機的來源依次採集
+func groupSourcesByHost(sources []config.SourceConfig) [][]config.SourceConfig {
+	var groups [][]config.SourceConfig
+	index := make(map[string]int)
+	for _, src := range sources {
+		target := src.URL
+		if src.GitHub != nil {
+			target = githubRepo(src.GitHub).RawURL("")
+		}
+		host := target
+		if u, err := url.Parse(target); err == nil {
+			host = strings.ToLower(u.Host)
+		}
+		i, ok := index[host]
+		if !ok {
+			i = len(groups)
+			index[host] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], src)
+	}
+	return groups
+}
+
+// gatherSource 以獨立的 Collector 採集一個來源（含分頁），超過來源時限（sources[].timeout 或 gather.source_timeout）
+// 時取消未完成的請求；rt 非 nil 時經由 rt 發送請求。GitHub 來源的文件按 cache 發送條件請求，未變化時跳過
+func gatherSource(ctx context.Context, src config.SourceConfig, rt http.RoundTripper, out chan<- *pool.Proxy, cache *fetcher.ConditionalCache) {
+	ctx, span := tracer.Start(ctx, "gather.source", trace.WithAttributes(attribute.String("url.full", src.URL)))
+	defer span.End()
+	timeout := cmp.Or(src.Timeout, gatherCfg.SourceTimeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	fcfg := fetcher.DefaultConfig
+	fcfg.UserAgent = src.UserAgent
+	if u, err := url.Parse(src.URL); err == nil {
+		fcfg.Hosts = []string{u.Host}
+	}
+	c := fetcher.NewCollyWithConfig(fcfg)
+	c.Context = ctx
+	gatherLog.Debugf("Colly collector initialized with User-Agent: %s", c.UserAgent)
+	if rt != nil {
+		c.WithTransport(rt)
+	}
+	if len(src.Cookies) > 0 {
+		cookies := make([]*http.Cookie, 0, len(src.Cookies))
+		for name, value := range src.Cookies {
+			cookies = append(cookies, &http.Cookie{Name: name, Value: value})
+		}
+		if err := c.SetCookies(src.URL, cookies); err != nil {
+			gatherLog.WithField("url", src.URL).WithError(err).Warn("failed to set source cookies")
+		}
+	}
+
+	conditional := src.GitHub != nil
+	if conditional {
+		c.OnRequest(func(r *colly.Request) {
+			cache.Apply(r.URL.String(), *r.Headers)
+		})
+	}
 
-		err := extractor.Extractor(proxiesChan, r.Body, r.Request.URL.String())
+	var outcome fetchOutcome
+	c.OnResponse(func(r *colly.Response) {
+		outcome.succeeded()
+		gatherLog.WithField("url", r.Request.URL.String()).Debug("Visited")
+		gatherLog.WithFields(logger.Fields{"url": r.Request.URL.String(), "status": r.StatusCode}).Info("Response received")
+		gatherLog.Debugf("Response Body Length: %d", len(r.Body))
+
+		tagged, wait := tagSource(out, src)
+		count, err := extractor.Extract(tagged, r.Body, r.Request.URL.String(), r.Ctx.Get("parser"))
+		wait()
+		sourceStats.RecordExtracted(src.URL, count)
 		if err != nil {
-			logrus.Errorf("extractor error: %v", err)
+			gatherLog.Errorf("extractor error: %v", err)
 			return
 		}
+		if conditional {
+			cache.Store(r.Request.URL.String(), *r.Headers)
+		}
+		if ctx.Err() == nil {
+			visitNextPage(c, src, r.Ctx.GetAny("page").(int), count)
+		}
 	})
 
 	c.OnError(func(r *colly.Response, err error) {
-		logrus.Errorf("Request failed for %s: %v", r.Request.URL, err)
+		if conditional && r.StatusCode == http.StatusNotModified {
+			outcome.succeeded()
+			gatherLog.WithField("url", r.Request.URL.String()).Info("Source not modified since last gather, skipped")
+			return
+		}
+		outcome.failed(r)
+		sourceStats.RecordFailure(src.URL)
+		gatherLog.WithField("url", r.Request.URL.String()).WithError(err).Error("Request failed")
 	})
 
-	for _, url := range proxyUrls {
-		logrus.Infof("Visiting URL: %s", url)
-		err := c.Visit(url)
+	start := time.Now()
+	visitSource(c, src, 0)
+	c.Wait()
+	gatherDuration.Observe(time.Since(start).Seconds(), "source")
+	outcome.apply(src.URL)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		gatherLog.WithField("url", src.URL).Warnf("Source timed out after %s, abandoned", timeout)
+		span.SetStatus(codes.Error, "timed out")
+		return
+	}
+	gatherLog.WithField("url", src.URL).Debugf("Source finished in %s", time.Since(start).Round(time.Millisecond))
+}
+
+// fetchOutcome 一輪採集中來源的響應情況，採集結束後據此更新來源的退避狀態；colly 的回調可能並發調用
+type fetchOutcome struct {
+	mu         sync.Mutex
+	ok         bool          // 收到過正常響應（含 304）
+	status     int           // 最近一個 429 或 5xx 狀態碼
+	retryAfter time.Duration // 出錯響應中最長的 Retry-After
+}
+
+// succeeded 記錄一個正常響應
+func (o *fetchOutcome) succeeded() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ok = true
+}
+
+// failed 記錄一個失敗的請求，只有 429 和 5xx 觸發退避（網絡錯誤與其他狀態碼不退避）
+func (o *fetchOutcome) failed(r *colly.Response) {
+	if r.StatusCode != http.StatusTooManyRequests && r.StatusCode < 500 {
+		return
+	}
+	var retryAfter time.Duration
+	if r.Headers != nil {
+		retryAfter = fetcher.RetryAfter(*r.Headers, time.Now())
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.status = r.StatusCode
+	o.retryAfter = max(o.retryAfter, retryAfter)
+}
+
+// apply 更新來源的退避狀態：本輪收到 429 或 5xx 時開始或延長退避（即使其他分頁正常），否則正常響應結束退避
+func (o *fetchOutcome) apply(url string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch {
+	case o.status != 0:
+		if until := sourceStats.RecordThrottled(url, o.retryAfter, time.Now()); !until.IsZero() {
+			gatherLog.WithFields(logger.Fields{"url": url, "status": o.status, "until": until.Format(time.RFC3339)}).
+				Warn("Source returned an error status, backing off")
+		}
+	case o.ok:
+		sourceStats.RecordRecovered(url)
+	}
+}
+
+// githubRepo 把 GitHub 來源配置轉換為 fetcher.GitHubRepo
+func githubRepo(g *config.GitHubSourceConfig) fetcher.GitHubRepo {
+	return fetcher.GitHubRepo{Repo: g.Repo, Ref: g.Ref, Paths: g.Paths, CDN: g.CDN, Token: g.Token}
+}
+
+// expandSource 把 GitHub 來源展開為倉庫中匹配的各個文件（每個文件是一個 url 來源，沿用其餘設置），
+// 其他來源原樣返回；列出文件失敗時返回 nil
+func expandSource(src config.SourceConfig) []config.SourceConfig {
+	if src.GitHub == nil {
+		return []config.SourceConfig{src}
+	}
+	repo := githubRepo(src.GitHub)
+	ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(src.Timeout, gatherCfg.SourceTimeout))
+	defer cancel()
+	files, err := repo.Files(ctx, &http.Client{Timeout: fetcher.DefaultConfig.Timeout})
+	if err != nil {
+		gatherLog.WithField("source", src.Name()).WithError(err).Error("failed to list repository files")
+		return nil
+	}
+	if len(files) == 0 {
+		gatherLog.WithField("source", src.Name()).Warn("No repository files match the configured paths")
+	}
+	sources := make([]config.SourceConfig, 0, len(files))
+	for _, f := range files {
+		s := src
+		s.URL = repo.RawURL(f)
+		sources = append(sources, s)
+	}
+	return sources
+}
+
+// tagSource 返回一個通道，寫入的代理標記來源 URL、來源配置的標籤與入庫時間後轉發到 out；
+// 寫完後調用 wait 關閉通道並等待轉發完成
+func tagSource(out chan<- *pool.Proxy, src config.SourceConfig) (chan<- *pool.Proxy, func()) {
+	in := make(chan *pool.Proxy, 100)
+	done := make(chan struct{})
+	now := time.Now()
+	go func() {
+		defer close(done)
+		for p := range in {
+			p.Source = src.URL
+			p.Tags = pool.NormalizeTags(append(p.Tags, src.Tags...))
+			p.Added = now
+			out <- p
+		}
+	}()
+	return in, func() {
+		close(in)
+		<-done
+	}
+}
+
+// visitSource 請求來源的第 page 頁（從 0 開始計，未配置分頁時只有第 0 頁）
+func visitSource(c *colly.Collector, src config.SourceConfig, page int) {
+	target := src.URL
+	if src.Pagination != nil {
+		u, err := src.Pagination.PageURL(src.URL, page)
 		if err != nil {
-			logrus.Errorf("failed to visit %s: %v", url, err)
+			gatherLog.WithField("url", src.URL).WithError(err).Error("failed to build page url")
+			return
 		}
+		target = u
+	}
+	gatherLog.WithFields(logger.Fields{"url": target, "parser": src.Parser}).Info("Visiting URL")
+	if page == 0 {
+		sourceStats.RecordGather(src.URL)
 	}
 
-	c.Wait()
-	close(proxiesChan)
-	wg.Wait()
-	logrus.Infof("All proxies have been processed, new: %d, updated: %d", newProxyCount, updateProxyCount)
+	// 解析器名稱和頁碼隨請求上下文傳遞，重定向和重試後仍然有效
+	ctx := colly.NewContext()
+	ctx.Put("parser", src.Parser)
+	ctx.Put("page", page)
+	var body io.Reader
+	if src.Body != "" {
+		body = strings.NewReader(src.Body)
+	}
+	hdr := make(http.Header, len(src.Headers))
+	for name, value := range src.Headers {
+		hdr.Set(name, value)
+	}
+	if err := c.Request(cmp.Or(strings.ToUpper(src.Method), http.MethodGet), target, body, ctx, hdr); err != nil {
+		gatherLog.WithField("url", target).WithError(err).Error("failed to visit")
+	}
 }
 
-// startBatchValidator 啟動批量驗證器（異步驗證代理）
-func startBatchValidator() {
-	var wg sync.WaitGroup
-	validatorCount := 10 // 同時運行 10 個驗證器
+// visitNextPage 分頁來源在未達 max_pages 且（啟用 stop_on_empty 時）本頁有結果時請求下一頁
+func visitNextPage(c *colly.Collector, src config.SourceConfig, page int, count int64) {
+	pg := src.Pagination
+	if pg == nil || page+1 >= pg.MaxPages {
+		return
+	}
+	if count == 0 && pg.StopOnEmpty {
+		gatherLog.WithField("url", src.URL).Infof("Page %d returned no proxies, stopping pagination", pg.StartPage+page)
+		return
+	}
+	visitSource(c, src, page+1)
+}
 
-	// 初始化驗證通道
-	validateChan = make(chan *proxy.Proxy, 1000)
+// sourceTransport 來源 src 的採集 Transport：設置了 proxy 時經由該代理，否則按 via_pool（來源未設置時沿用 gather.via_pool）
+// 經由代理池（poolRT）；返回 nil 表示本機直連
+func sourceTransport(src config.SourceConfig, poolRT func() http.RoundTripper) http.RoundTripper {
+	if src.Proxy != "" {
+		u, err := url.Parse(src.Proxy)
+		if err != nil {
+			gatherLog.WithField("url", src.URL).WithError(err).Error("invalid source proxy, gathering directly")
+			return nil
+		}
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.Proxy = http.ProxyURL(u)
+		return &fetcher.RetryTransport{Primary: tr, Policy: fetcher.DefaultConfig.Retry}
+	}
+	viaPool := gatherCfg.ViaPool
+	if src.ViaPool != nil {
+		viaPool = *src.ViaPool
+	}
+	if !viaPool {
+		return nil
+	}
+	return poolRT()
+}
 
-	// 啟動驗證器 workers
-	for i := 0; i < validatorCount; i++ {
-		wg.Add(1)
-		go func(id int) {
-			defer wg.Done()
-			logrus.Debugf("validator worker %d started", id)
-
-			for p := range validateChan {
-				if proxy.ValidProxy(p) {
-					logrus.Infof("validator %d: proxy %s is healthy", id, p.String())
-
-					// 更新到數據庫
-					if bdb != nil {
-						key := []byte(p.String())
-						val := p.DumpJSON()
-						bdb.Update(func(txn *badger.Txn) error {
-							return txn.Set(key, val)
-						})
-					}
-				} else {
-					logrus.Debugf("validator %d: proxy %s is unhealthy", id, p.String())
-				}
-			}
-		}(i)
+// gatherTransport 可用代理足夠時，返回經由代理池採集的 Transport；否則返回 nil（本機直連）
+func gatherTransport() http.RoundTripper {
+	st, err := collectPoolStats()
+	if err != nil {
+		gatherLog.Warnf("failed to count healthy proxies, gathering directly: %v", err)
+		return nil
+	}
+	if st.Healthy < gatherCfg.MinHealthy {
+		gatherLog.Infof("Only %d healthy proxies (need %d), gathering directly", st.Healthy, gatherCfg.MinHealthy)
+		return nil
 	}
 
-	// 等待所有驗證器完成（實際上這個 channel 不會關閉，除非程序退出）
-	wg.Wait()
+	rt := &fetcher.RetryTransport{
+		Primary: pool.New(bdb).TransportWith(pool.TransportOptions{ResponseHeaderTimeout: fetcher.DefaultConfig.Timeout}),
+		Policy:  fetcher.DefaultConfig.Retry,
+	}
+	if gatherCfg.FallbackDirect {
+		rt.Fallback = http.DefaultTransport
+	}
+	gatherLog.Infof("Gathering through the proxy pool (%d healthy proxies)", st.Healthy)
+	return rt
+}
+
+// reportPoolHealth 統計數據庫中的代理：更新代理池規模指標，並按健康代理數通知池狀態變化
+func reportPoolHealth() {
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		storeLog.Errorf("listAllProxiesFromDB error: %v", err)
+		return
+	}
+	updatePoolMetrics(ps)
+	if notifier == nil {
+		return
+	}
+	// 與 /api/state 和選路條件一致，從未驗證過的候選代理不計入
+	healthy := 0
+	for _, p := range ps {
+		if p.Usable() {
+			healthy++
+		}
+	}
+	notifier.ReportPoolHealth(healthy, len(ps))
 }
 
-func cleanupProxiesFromDB() (int, error) {
+// migrateProxyKeys 將舊版 protocol://ip:port 鍵遷移為規範的 ip:port 鍵
+// 同一 ip:port 存在多個協議記錄時只保留最合適的一條。每個事務處理 cleanupBatchSize 個 ip:port，
+// 寫入規範記錄與刪除其舊版鍵在同一事務中，中途失敗時下次啟動繼續遷移剩餘的鍵
+func migrateProxyKeys() (int, error) {
 	if bdb == nil {
 		return 0, errors.New("database not initialized")
 	}
 
-	now := time.Now()
-	maxAge := 72 * time.Hour
-
-	// 第一步：使用 View 事務迭代並收集需要刪除的 key
-	var keysToDelete [][]byte
+	var legacyKeys, unparsable [][]byte
+	best := make(map[string]*pool.Proxy)
+	legacyOf := make(map[string][][]byte) // 規範鍵 -> 遷移到它的舊版鍵
 	err := bdb.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchSize = 100
@@ -179,78 +544,120 @@ func cleanupProxiesFromDB() (int, error) {
 
 		for it.Rewind(); it.Valid(); it.Next() {
 			item := it.Item()
+			if pool.IsMetaKey(item.Key()) {
+				continue
+			}
 			key := item.KeyCopy(nil)
+			if !pool.IsLegacyKey(key) {
+				// 規範鍵也參與比較，避免舊記錄覆蓋較新的規範記錄
+				if err := item.Value(func(val []byte) error {
+					if p, err := pool.LoadFromJSON(val); err == nil {
+						if cur, ok := best[p.Key()]; !ok || p.PreferOver(cur) {
+							best[p.Key()] = p
+						}
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				continue
+			}
 
+			legacyKeys = append(legacyKeys, key)
 			err := item.Value(func(val []byte) error {
-				p, err := proxy.LoadFromJSON(val)
+				p, err := pool.LoadFromJSON(val)
 				if err != nil {
-					logrus.Warnf("failed to parse proxy, will delete: %v", err)
-					keysToDelete = append(keysToDelete, key)
+					storeLog.Warnf("failed to parse legacy proxy %s, dropping: %v", string(key), err)
+					unparsable = append(unparsable, key)
 					return nil
 				}
-				shouldDelete := false
-				if p.Disable {
-					logrus.Debugf("Marking disabled proxy for deletion: %s", p.String())
-					shouldDelete = true
-				}
-				if p.Updated.IsZero() {
-					logrus.Debugf("Marking proxy with zero timestamp for deletion: %s", p.String())
-					shouldDelete = true
-				}
-
-				if !p.Updated.IsZero() && now.Sub(p.Updated) > maxAge {
-					logrus.Debugf("Marking stale proxy for deletion: %s (age: %v)", p.String(), now.Sub(p.Updated))
-					shouldDelete = true
-				}
-
-				if shouldDelete {
-					keysToDelete = append(keysToDelete, key)
+				legacyOf[p.Key()] = append(legacyOf[p.Key()], key)
+				if cur, ok := best[p.Key()]; !ok || p.PreferOver(cur) {
+					best[p.Key()] = p
 				}
-
 				return nil
 			})
-
 			if err != nil {
 				return err
 			}
 		}
 		return nil
 	})
-
 	if err != nil {
-		return 0, fmt.Errorf("failed to iterate proxies: %w", err)
+		return 0, fmt.Errorf("failed to scan legacy keys: %w", err)
 	}
 
-	// 第二步：使用 Update 事務刪除所有收集的 key
-	deletedCount := 0
-	if len(keysToDelete) > 0 {
+	if len(legacyKeys) == 0 {
+		return 0, nil
+	}
+
+	canonical := slices.Sorted(maps.Keys(legacyOf))
+	migrated := 0
+	for batch := range slices.Chunk(canonical, cleanupBatchSize) {
+		err = bdb.Update(func(txn *badger.Txn) error {
+			for _, key := range batch {
+				if err := txn.Set([]byte(key), best[key].DumpJSON()); err != nil {
+					return err
+				}
+				for _, legacy := range legacyOf[key] {
+					if err := txn.Delete(legacy); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return migrated, fmt.Errorf("failed to migrate legacy keys (%d migrated): %w", migrated, err)
+		}
+		for _, key := range batch {
+			migrated += len(legacyOf[key])
+		}
+	}
+	for batch := range slices.Chunk(unparsable, cleanupBatchSize) {
 		err = bdb.Update(func(txn *badger.Txn) error {
-			for _, key := range keysToDelete {
+			for _, key := range batch {
 				if err := txn.Delete(key); err != nil {
-					logrus.Errorf("failed to delete key: %v", err)
 					return err
 				}
-				deletedCount++
 			}
 			return nil
 		})
-
 		if err != nil {
-			return 0, fmt.Errorf("failed to delete proxies: %w", err)
+			return migrated, fmt.Errorf("failed to drop unparsable legacy keys: %w", err)
 		}
+		migrated += len(batch)
 	}
 
-	logrus.Infof("Cleanup completed: deleted %d proxies from database", deletedCount)
-	return deletedCount, nil
+	storeLog.Infof("Migrated %d legacy proxy keys into %d canonical records", len(legacyKeys), len(canonical))
+	return len(legacyKeys), nil
 }
 
-func listAllProxiesFromDB() ([]*proxy.Proxy, error) {
+// cleanupBatchSize 清理時每個刪除事務處理的代理數
+const cleanupBatchSize = 1000
+
+// cleanupCandidate 清理任務要刪除的一個代理及原因
+type cleanupCandidate struct {
+	key    string
+	proxy  *pool.Proxy // 記錄無法解析時為 nil
+	reason string      // CleanupPolicy.Expired 的原因、invalid record 或 max_proxies
+}
+
+// 清理策略之外的刪除原因
+const (
+	cleanupInvalid = "invalid record"
+	cleanupEvicted = "max_proxies"
+)
+
+// planCleanup 在只讀事務中按清理策略掃描全部代理，返回要刪除的代理（含超出 cleanup.max_proxies 而淘汰的）及掃描的代理數；
+// 不修改數據庫
+func planCleanup(now time.Time) (remove []cleanupCandidate, scanned int, err error) {
 	if bdb == nil {
-		return nil, errors.New("database not initialized")
+		return nil, 0, errors.New("database not initialized")
 	}
 
-	var proxies []*proxy.Proxy
-	err := bdb.View(func(txn *badger.Txn) error {
+	var kept []*pool.Proxy // 保留的代理，超出 cleanup.max_proxies 時從中淘汰
+	err = bdb.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchSize = 100
 		it := txn.NewIterator(opts)
@@ -258,234 +665,1253 @@ func listAllProxiesFromDB() ([]*proxy.Proxy, error) {
 
 		for it.Rewind(); it.Valid(); it.Next() {
 			item := it.Item()
+			if pool.IsMetaKey(item.Key()) {
+				continue
+			}
+			key := string(item.Key())
+
 			err := item.Value(func(val []byte) error {
-				p, err := proxy.LoadFromJSON(val)
+				p, err := pool.LoadFromJSON(val)
 				if err != nil {
-					logrus.Warnf("failed to parse proxy from db: %v", err)
+					storeLog.Warnf("failed to parse proxy, will delete: %v", err)
+					remove = append(remove, cleanupCandidate{key: key, reason: cleanupInvalid})
 					return nil
 				}
-				proxies = append(proxies, p)
+				pending := false
+				if p.Updated.IsZero() {
+					if pending, err = pool.Queued(txn, key); err != nil {
+						return err
+					}
+				}
+				if reason := cleanupPolicy.Expired(p, pending, now); reason != "" {
+					storeLog.Debugf("Marking proxy for deletion (%s): %s", reason, p.String())
+					remove = append(remove, cleanupCandidate{key: key, proxy: p, reason: reason})
+					return nil
+				}
+				kept = append(kept, p)
 				return nil
 			})
+
 			if err != nil {
 				return err
 			}
 		}
 		return nil
 	})
-	if err != nil {
-		return nil, err
-	}
 
-	logrus.Infof("Loaded %d proxies from database", len(proxies))
-	return proxies, nil
-}
-
-func checkAllProxiesHealth() error {
-	var wg sync.WaitGroup
-	ps, err := listAllProxiesFromDB()
 	if err != nil {
-		return err
-	}
-	for _, p := range ps {
-		wg.Add(1)
-		go func(_p *proxy.Proxy) {
-			defer wg.Done()
-			if proxy.ValidProxy(_p) {
-				logrus.Infof("Proxy is healthy: %s", _p.String())
-				return
-			}
-			// Mark proxy as disabled in DB
-			err := bdb.Update(func(txn *badger.Txn) error {
-				key := []byte(_p.String())
-				p.Disable = true
-				val := p.DumpJSON()
-				return txn.Set(key, val)
-			})
-			if err != nil {
-				logrus.Errorf("failed to mark proxy as disabled: %v", err)
-				return
-			} else {
-				logrus.Infof("Marked proxy as disabled: %s", _p.String())
-			}
-		}(p)
-
+		return nil, 0, fmt.Errorf("failed to iterate proxies: %w", err)
 	}
-	wg.Wait()
-	return nil
-}
-
-func main() {
-	// Command line flags
-	var (
-		runOnce       = flag.Bool("once", false, "Run proxy gathering once and exit")
-		listProxies   = flag.Bool("list", false, "List all proxies in database")
-		checkHealth   = flag.Bool("check", false, "Check health of all proxies")
-		cleanup       = flag.Bool("cleanup", false, "Clean up old/disabled proxies")
-		serveAddr     = flag.String("serve", "", "Start proxy server on address (e.g., :8080)")
-		logLevel      = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
-		help          = flag.Bool("help", false, "Show help")
-	)
 
-	flag.Parse()
+	scanned = len(kept) + len(remove)
+	storeLog.Debugf("Cleanup scanned %d proxies, %d to delete", scanned, len(remove))
 
-	if *help {
-		flag.Usage()
-		os.Exit(0)
+	if limit := cleanupPolicy.MaxProxies; limit > 0 && len(kept) > limit {
+		pool.EvictionOrder(kept)
+		evict := kept[:len(kept)-limit]
+		for _, p := range evict {
+			remove = append(remove, cleanupCandidate{key: p.Key(), proxy: p, reason: cleanupEvicted})
+		}
+		storeLog.Infof("Pool exceeds max_proxies (%d > %d), %d least recently seen proxies to evict", len(kept), limit, len(evict))
 	}
+	return remove, scanned, nil
+}
 
-	// Set log level
-	switch *logLevel {
-	case "debug":
-		logrus.SetLevel(logrus.DebugLevel)
-	case "info":
-		logrus.SetLevel(logrus.InfoLevel)
-	case "warn":
-		logrus.SetLevel(logrus.WarnLevel)
-	case "error":
-		logrus.SetLevel(logrus.ErrorLevel)
-	default:
-		logrus.SetLevel(logrus.InfoLevel)
-	}
+// cleanupProxiesFromDB 按清理策略刪除代理：先在只讀事務中掃描收集要刪除的 key，再分批刪除
+func cleanupProxiesFromDB() (deleted int, err error) {
+	finish := jobs.Start(jobCleanup)
+	defer func() { finish(err) }()
 
-	var err error
-	bdb, err = badger.Open(badger.DefaultOptions("proxy_badger_db"))
+	plan, _, err := planCleanup(time.Now())
 	if err != nil {
-		logrus.Fatalf("failed to open badger db: %v", err)
-		return
+		return 0, err
+	}
+	keysToDelete := make([]string, len(plan))
+	for i, c := range plan {
+		keysToDelete[i] = c.key
 	}
-	defer bdb.Close()
 
-	// Handle command line options
-	if *listProxies {
-		ps, err := listAllProxiesFromDB()
+	// 分批刪除（經由 proxyStore 觸發 OnProxyDeleted，計入來源存活時間），
+	// 每批一個事務，避免大型代理池超出事務大小限制
+	deletedCount := 0
+	for batch := range slices.Chunk(keysToDelete, cleanupBatchSize) {
+		n, err := proxyStore.Delete(batch...)
+		deletedCount += n
 		if err != nil {
-			logrus.Errorf("listAllProxiesFromDB error: %v", err)
-			os.Exit(1)
+			saveSourceStats()
+			return deletedCount, fmt.Errorf("failed to delete proxies (%d deleted): %w", deletedCount, err)
 		}
-
-		jb, err := json.MarshalIndent(ps, "", "\t")
-		if err != nil {
-			logrus.Fatalf("failed to marshal json: %v", err)
-			os.Exit(1)
+		if len(keysToDelete) > cleanupBatchSize {
+			storeLog.Infof("Cleanup progress: %d/%d proxies deleted", deletedCount, len(keysToDelete))
 		}
-		fmt.Printf("All Proxies in DB:\n%s\n", string(jb))
-		return
 	}
+	saveSourceStats()
 
-	if *checkHealth {
-		err := checkAllProxiesHealth()
-		if err != nil {
-			logrus.Errorf("checkAllProxiesHealth error: %v", err)
-			os.Exit(1)
-		}
-		logrus.Info("Health check completed")
-		return
-	}
+	storeLog.Infof("Cleanup completed: deleted %d proxies from database", deletedCount)
+	reportPoolHealth()
+	return deletedCount, nil
+}
 
-	if *cleanup {
-		count, err := cleanupProxiesFromDB()
+// newProxyStore 創建代理記錄的寫入入口，新增與刪除事件計入來源統計，代理狀態變化寫入事件記錄
+func newProxyStore(db *badger.DB) *pool.Pool {
+	return pool.New(db, pool.WithHooks(pool.Hooks{
+		OnProxyAdded: func(p *pool.Proxy) {
+			sourceStats.RecordNew(p.Source)
+			events.Record(eventlog.ProxyAdded, p.Key(), map[string]any{"source": p.Source})
+		},
+		OnProxyDisabled: func(p *pool.Proxy) {
+			events.Record(eventlog.ProxyDisabled, p.Key(), map[string]any{"last_healthy": p.Updated})
+			proxyFeed.Publish(feed.ProxyDisabled, p.Key(), p)
+		},
+		OnProxyRecovered: func(p *pool.Proxy) {
+			events.Record(eventlog.ProxyRecovered, p.Key(), map[string]any{"latency_ms": p.LatencyMs})
+		},
+		OnValidationResult: publishValidation,
+		OnProxyDeleted: func(key string, p *pool.Proxy) {
+			proxyFeed.Publish(feed.ProxyDeleted, key, p)
+			if p == nil {
+				events.Record(eventlog.ProxyDeleted, key, nil)
+				return
+			}
+			events.Record(eventlog.ProxyDeleted, key, map[string]any{"disabled": p.Disable, "added": p.Added, "last_healthy": p.Updated})
+			// 通過過驗證的被刪除代理計入來源存活時間
+			if !p.Updated.IsZero() && !p.Added.IsZero() {
+				sourceStats.RecordDeath(p.Source, p.Updated.Sub(p.Added))
+			}
+		},
+	}))
+}
+
+func listAllProxiesFromDB() ([]*pool.Proxy, error) {
+	if bdb == nil {
+		return nil, errors.New("database not initialized")
+	}
+
+	var proxies []*pool.Proxy
+	err := bdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 100
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if pool.IsMetaKey(item.Key()) {
+				continue
+			}
+			err := item.Value(func(val []byte) error {
+				p, err := pool.LoadFromJSON(val)
+				if err != nil {
+					storeLog.Warnf("failed to parse proxy from db: %v", err)
+					return nil
+				}
+				proxies = append(proxies, p)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	storeLog.Infof("Loaded %d proxies from database", len(proxies))
+	return proxies, nil
+}
+
+// proxyWithUsage 帶使用統計的代理記錄（-list 與 GET /api/proxies 的輸出）
+type proxyWithUsage struct {
+	*pool.Proxy
+	Usage pool.Usage `json:"usage"`
+	// CurrentScore 按時間衰減後的當前健康評分
+	CurrentScore float64 `json:"current_score"`
+}
+
+// listProxiesWithUsage 返回所有代理及其使用次數與健康度
+func listProxiesWithUsage() ([]proxyWithUsage, error) {
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		return nil, err
+	}
+	usage, err := proxyStore.UsageAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]proxyWithUsage, 0, len(ps))
+	for _, p := range ps {
+		u, ok := usage[p.Key()]
+		if !ok {
+			u = pool.Usage{Health: pool.InitialHealth}
+		}
+		p.Count = int64(u.Uses)
+		score := math.Round(p.CurrentScore()*1e4) / 1e4
+		out = append(out, proxyWithUsage{Proxy: p, Usage: u, CurrentScore: score})
+	}
+	return out, nil
+}
+
+// checkAllProxiesHealth 重新驗證到期（next_check 已過）的代理，force 為 true 時驗證全部；
+// 待驗證隊列中的候選代理由隊列處理，同時進行的驗證數不超過 validation.queue_workers；結果經 validationWrites 依次寫入
+func checkAllProxiesHealth(force bool) (err error) {
+	finish := jobs.Start(jobHealth)
+	defer func() { finish(err) }()
+	var wg sync.WaitGroup
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		return err
+	}
+	queued, err := pool.QueuedKeys(bdb, 0)
+	if err != nil {
+		return err
+	}
+	pending := make(map[string]bool, len(queued))
+	for _, key := range queued {
+		pending[key] = true
+	}
+	sem := make(chan struct{}, max(validationCfg.QueueWorkers, 1))
+	now := time.Now()
+	due := 0
+	for _, p := range ps {
+		if pending[p.Key()] || (!force && !p.Due(now)) {
+			continue
+		}
+		due++
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(_p *pool.Proxy) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			firstValidation := _p.Updated.IsZero()
+			r := pool.Validate(_p)
+			saved, err := validationWrites().save(r)
+			if errors.Is(err, pool.ErrProxyNotFound) {
+				healthLog.WithField("proxy", _p.Key()).Debug("proxy deleted during validation, result discarded")
+				return
+			}
+			if err != nil {
+				healthLog.Errorf("failed to save validation result for %s: %v", _p.String(), err)
+				return
+			}
+			if !r.Healthy {
+				healthLog.Infof("Marked proxy as disabled: %s", saved.String())
+				return
+			}
+			healthLog.Infof("Proxy is healthy: %s", saved.String())
+			// 首次通過驗證的代理計入來源統計
+			if firstValidation {
+				sourceStats.RecordValidated(saved.Source)
+			}
+		}(p)
+
+	}
+	wg.Wait()
+	healthLog.Infof("Health check completed: %d of %d proxies were due", due, len(ps))
+	saveSourceStats()
+	reportPoolHealth()
+	return nil
+}
+
+// applyEnvFlags 未在命令行給出的參數取自環境變量：參數名大寫、連字符換成下劃線並加上 config.EnvPrefix，
+// 如 -serve 對應 DYNAMIC_PROXY_SERVE、-log-level 對應 DYNAMIC_PROXY_LOG_LEVEL（-help 和 -version 除外）
+func applyEnvFlags() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || f.Name == "help" || f.Name == "version" {
+			return
+		}
+		key := config.EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := os.LookupEnv(key); ok {
+			if setErr := flag.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("invalid %s: %w", key, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// fatalf 輸出錯誤日誌並退出
+func fatalf(format string, args ...any) {
+	log.Errorf(format, args...)
+	os.Exit(1)
+}
+
+func main() {
+	// 子命令：dynamic-proxy service install|uninstall|start|stop（僅 Windows）
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		if err := serviceCommand(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// 子命令：dynamic-proxy judge [-listen :8080]
+	if len(os.Args) > 1 && os.Args[1] == "judge" {
+		if err := judgeCommand(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// 子命令：dynamic-proxy top [-admin http://127.0.0.1:9090] [-interval 2s]
+	if len(os.Args) > 1 && os.Args[1] == "top" {
+		if err := topCommand(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if runningAsService() {
+		if err := runService(run); err != nil {
+			fatalf("failed to run as service: %v", err)
+		}
+	} else {
+		run()
+	}
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// run 解析命令行參數並按模式運行，長駐模式在收到終止信號或服務停止請求後返回
+func run() {
+	// 子命令：dynamic-proxy config check [flags]
+	args := os.Args[1:]
+	configCheck := false
+	if len(args) > 0 && args[0] == "config" {
+		if len(args) < 2 || args[1] != "check" {
+			fmt.Fprintln(os.Stderr, "usage: dynamic-proxy config check [flags]")
+			os.Exit(2)
+		}
+		configCheck = true
+		args = args[2:]
+	}
+	// 子命令：dynamic-proxy db stats|compact [flags]
+	dbCommand := ""
+	if len(args) > 0 && args[0] == "db" {
+		if len(args) < 2 || (args[1] != "stats" && args[1] != "compact") {
+			fmt.Fprintln(os.Stderr, "usage: dynamic-proxy db stats|compact [flags]")
+			os.Exit(2)
+		}
+		dbCommand = args[1]
+		args = args[2:]
+	}
+
+	// Command line flags
+	var (
+		configPath     = flag.String("config", "", "Path to YAML config file (default: config.yaml in the platform config directory, if present)")
+		dbDir          = flag.String("db", "", "Path to the Badger database directory (default: platform data directory)")
+		runOnce        = flag.Bool("once", false, "Run proxy gathering once and exit")
+		listProxies    = flag.Bool("list", false, "List all proxies in database")
+		showInfo       = flag.Bool("info", false, "Show last run metadata and pool statistics")
+		checkHealth    = flag.Bool("check", false, "Check health of all proxies")
+		cleanup        = flag.Bool("cleanup", false, "Clean up old/disabled proxies")
+		dryRun         = flag.Bool("dry-run", false, "With -cleanup or -check, print which proxies would be deleted, disabled or recovered and why without changing the database")
+		serveAddr      = flag.String("serve", "", "Start proxy server on address (e.g., :8080)")
+		adminAddr      = flag.String("admin", "", "Start admin API on address (e.g., 127.0.0.1:9090), only with -serve")
+		dnsAddr        = flag.String("dns", "", "Start DNS server publishing the pool on address (e.g., 127.0.0.1:5353), only with -serve")
+		exportZonePath = flag.String("export-zone", "", "Write healthy proxies as a DNS zone file to this path (- for stdout) and exit")
+		exportHistory  = flag.String("export-history", "", "Write recorded pool statistics snapshots as CSV to this path (- for stdout) and exit")
+		schedHealth    = flag.String("schedule-health", "", "Cron expression for the health check job in cron mode (off = disabled)")
+		schedCleanup   = flag.String("schedule-cleanup", "", "Cron expression for the cleanup job in cron mode (off = disabled)")
+		schedGather    = flag.String("schedule-gather", "", "Cron expression for the gather job in cron mode (off = disabled)")
+		rotateInterval = flag.Duration("rotate-interval", 0, "Keep one upstream proxy for this interval before rotating (e.g., 5m, 0 = rotate per request)")
+		domainConc     = flag.Int("domain-concurrency", 0, "Max in-flight requests per target domain (0 = unlimited)")
+		strictHygiene  = flag.Bool("strict-hygiene", false, "Strip Via, Forwarded and X- headers from requests sent to targets")
+		mitm           = flag.Bool("mitm", false, "Decrypt CONNECT tunnels with a local CA so HTTPS requests get header rules and logging")
+		anonymous      = flag.Bool("anonymous", false, "Strip client-identifying headers (X-Forwarded-For, Via, Forwarded, ...) from requests sent to targets")
+		forwardedFor   = flag.String("forwarded-for", "", "X-Forwarded-For sent to targets: append, replace or omit")
+		dnsResolution  = flag.String("dns-resolution", "", "Resolve target hostnames: remote (by the upstream proxy) or local")
+		responseSLO    = flag.Duration("response-slo", 0, "Retry through another upstream if response headers don't arrive within this time (0 = disabled)")
+		logLevel       = flag.String("log-level", "info", "Log level (trace, debug, info, warn, error)")
+		logFormat      = flag.String("log-format", "text", "Log format (text, json)")
+		logComponents  = flag.String("log-components", "", "Per-component log levels (e.g., validator=trace,server=debug)")
+		showVersion    = flag.Bool("version", false, "Show version and build info")
+		help           = flag.Bool("help", false, "Show help")
+	)
+
+	flag.CommandLine.Parse(args)
+	if err := applyEnvFlags(); err != nil {
+		fatalf("%v", err)
+	}
+
+	if *help {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	if *showVersion {
+		fmt.Println(buildinfo.Get())
+		return
+	}
+	if *dryRun && !*cleanup && !*checkHealth {
+		fatalf("-dry-run requires -cleanup or -check")
+	}
+
+	// 加載配置文件，命令行參數優先於配置文件
+	if *configPath == "" {
+		*configPath = paths.DefaultConfigFile()
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		if configCheck {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		fatalf("failed to load config: %v", err)
+		return
+	}
+	// applyFlags 用命令行參數覆蓋配置（重新加載配置文件時同樣應用）
+	applyFlags := func(cfg *config.Config) {
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "db":
+				cfg.DB.Path = *dbDir
+			case "serve":
+				cfg.Server.Listen = *serveAddr
+			case "admin":
+				cfg.Admin.Listen = *adminAddr
+			case "dns":
+				cfg.DNS.Listen = *dnsAddr
+			case "schedule-health":
+				cfg.Schedule.Health = *schedHealth
+			case "schedule-cleanup":
+				cfg.Schedule.Cleanup = *schedCleanup
+			case "schedule-gather":
+				cfg.Schedule.Gather = *schedGather
+			case "rotate-interval":
+				cfg.Server.RotateInterval = *rotateInterval
+			case "domain-concurrency":
+				cfg.Server.DomainConcurrency = *domainConc
+			case "response-slo":
+				cfg.Server.ResponseSLO = *responseSLO
+			case "strict-hygiene":
+				cfg.Server.StrictHygiene = *strictHygiene
+			case "forwarded-for":
+				cfg.Server.ForwardedFor = *forwardedFor
+			case "dns-resolution":
+				cfg.Server.DNSResolution = *dnsResolution
+			case "anonymous":
+				cfg.Server.Anonymity.Enabled = *anonymous
+			case "mitm":
+				cfg.Server.MITM.Enabled = *mitm
+			case "log-level":
+				cfg.Log.Level = *logLevel
+			case "log-format":
+				cfg.Log.Format = *logFormat
+			case "log-components":
+				levels, err := logging.ParseComponentLevels(*logComponents)
+				if err != nil {
+					fatalf("invalid -log-components: %v", err)
+				}
+				// 命令行指定的組件級別與配置文件合併
+				if cfg.Log.Components == nil {
+					cfg.Log.Components = make(map[string]string)
+				}
+				for name, lvl := range levels {
+					cfg.Log.Components[name] = lvl
+				}
+			}
+		})
+	}
+	applyFlags(cfg)
+
+	if configCheck {
+		if err := runConfigCheck(cfg, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// 命令行參數覆蓋後重新校驗
+	if err := cfg.Validate(); err != nil {
+		fatalf("invalid config: %v", err)
+	}
+	if err := validateSourceParsers(cfg); err != nil {
+		fatalf("invalid config: %v", err)
+	}
+	validationCfg = cfg.Validation
+	clusterToken = cfg.Admin.Token
+	applySettings(cfg)
+	reloader = newConfigReloader(*configPath, cfg, applyFlags)
+
+	logOutput, err := openLogOutput(cfg.Log.File)
+	if err != nil {
+		fatalf("failed to open log file: %v", err)
+	}
+	if err := logging.Setup(logging.Options{
+		Level:      cfg.Log.Level,
+		Format:     cfg.Log.Format,
+		Components: cfg.Log.Components,
+		Output:     logOutput,
+	}); err != nil {
+		fatalf("invalid log config: %v", err)
+	}
+
+	headerRewriter, err := newHeaderRewriter(cfg)
+	if err != nil {
+		fatalf("invalid header rules: %v", err)
+		return
+	}
+	bans, err := newBanDetector(cfg)
+	if err != nil {
+		fatalf("invalid ban detection rules: %v", err)
+		return
+	}
+	mutators, err := newRequestMutators(cfg)
+	if err != nil {
+		fatalf("invalid request mutators: %v", err)
+		return
+	}
+
+	notifier, err = newNotifier(cfg)
+	if err != nil {
+		fatalf("invalid notify config: %v", err)
+		return
+	}
+
+	proxyTLS, err := upstreamProxyTLS(cfg.Server.UpstreamProxyTLS)
+	if err != nil {
+		fatalf("invalid config: server.upstream_proxy_tls: %v", err)
+		return
+	}
+	pool.SetProxyTLSConfig(proxyTLS)
+
+	dbPath = cfg.DB.Path
+	if dbPath == "" {
+		dbPath = paths.DefaultDBPath()
+	}
+	log.Debugf("Using database at %s", dbPath)
+	dbSize = dirSize(dbPath)
+	dbOpts, err := badgerOptions(dbPath, cfg.DB)
+	if err != nil {
+		fatalf("invalid config: db: %v", err)
+		return
+	}
+	bdb, err = store.Open(dbOpts, cfg.DB.Recovery)
+	if err != nil {
+		fatalf("failed to open badger db: %v", err)
+		return
+	}
+	defer bdb.Close()
+	if dbCommand != "" {
+		if err := runDBCommand(dbCommand, bdb, dbPath, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			exitCode = 1
+		}
+		return
+	}
+	stopTelemetry := startTelemetry(cfg.Telemetry)
+	defer stopTelemetry()
+	if events, err = eventlog.Open(bdb, cfg.Events.Capacity); err != nil {
+		log.Errorf("event log disabled: %v", err)
+	}
+	proxyStore = newProxyStore(bdb)
+	loadSourceStats()
+
+	// -dry-run 不修改數據庫，跳過數據遷移（舊版記錄按原樣參與模擬）
+	if !*dryRun {
+		// 將舊版 protocol://ip:port 鍵遷移為 ip:port 並去重
+		if _, err := migrateProxyKeys(); err != nil {
+			log.Errorf("migrateProxyKeys error: %v", err)
+		}
+		// 舊版記錄為 https 的明文 CONNECT 代理改為 http
+		if n, err := pool.MigrateHTTPSProtocol(bdb); err != nil {
+			log.Errorf("MigrateHTTPSProtocol error: %v", err)
+		} else if n > 0 {
+			storeLog.Infof("Migrated %d proxies recorded as https to http", n)
+		}
+		// 舊版 proxy_count_* / proxy_health_* 統計鍵移到元數據命名空間
+		if n, err := pool.MigrateLegacyStatsKeys(bdb); err != nil {
+			log.Errorf("MigrateLegacyStatsKeys error: %v", err)
+		} else if n > 0 {
+			storeLog.Infof("Migrated %d legacy usage stats keys", n)
+		}
+	}
+
+	// Handle command line options
+	if *listProxies {
+		ps, err := listProxiesWithUsage()
 		if err != nil {
-			logrus.Errorf("cleanupProxiesFromDB error: %v", err)
+			log.Errorf("listProxiesWithUsage error: %v", err)
+			os.Exit(1)
+		}
+
+		jb, err := json.MarshalIndent(ps, "", "\t")
+		if err != nil {
+			fatalf("failed to marshal json: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("All Proxies in DB:\n%s\n", string(jb))
+		return
+	}
+
+	if *showInfo {
+		if err := printInfo(); err != nil {
+			log.Errorf("printInfo error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *exportZonePath != "" {
+		if err := exportZone(cfg.DNS, *exportZonePath); err != nil {
+			log.Errorf("exportZone error: %v", err)
 			os.Exit(1)
 		}
-		logrus.Infof("Cleanup completed: deleted %d proxies", count)
+		return
+	}
+
+	if *exportHistory != "" {
+		if err := exportHistoryCSV(*exportHistory); err != nil {
+			log.Errorf("exportHistoryCSV error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *checkHealth && *dryRun {
+		if err := printRevalidationPlan(os.Stdout); err != nil {
+			log.Errorf("printRevalidationPlan error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *checkHealth {
+		err := checkAllProxiesHealth(true)
+		if err != nil {
+			log.Errorf("checkAllProxiesHealth error: %v", err)
+			os.Exit(1)
+		}
+		// 一次性驗證所有待驗證的候選代理，不限速
+		n, err := drainValidationQueue(nil, 0)
+		if err != nil {
+			log.Errorf("drainValidationQueue error: %v", err)
+			os.Exit(1)
+		}
+		saveSourceStats()
+		log.Infof("Health check completed (%d pending proxies validated)", n)
+		return
+	}
+
+	if *cleanup && *dryRun {
+		if err := printCleanupPlan(os.Stdout); err != nil {
+			log.Errorf("printCleanupPlan error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *cleanup {
+		count, err := cleanupProxiesFromDB()
+		if err != nil {
+			log.Errorf("cleanupProxiesFromDB error: %v", err)
+			os.Exit(1)
+		}
+		log.Infof("Cleanup completed: deleted %d proxies", count)
 		return
 	}
 
 	if *runOnce {
 		gatherProxies()
-		logrus.Info("Single run completed")
+		log.Info("Single run completed")
 		return
 	}
 
 	// Start proxy server if -serve is specified
 	if *serveAddr != "" {
-		startProxyServer(*serveAddr)
+		mitmCA, err := loadMITMCA(cfg)
+		if err != nil {
+			fatalf("failed to load MITM CA: %v", err)
+			return
+		}
+		svcTLS, err := newServiceTLS(cfg)
+		if err != nil {
+			fatalf("failed to set up TLS: %v", err)
+			return
+		}
+		recordRunMeta(cfg, "serve")
+		logStartupBanner(cfg)
+		startProxyServer(cfg, mitmCA, svcTLS, serverOptions(cfg, headerRewriter, bans, mutators, mitmCA)...)
 		return
 	}
 
 	// Default behavior - start cron scheduler
-	checkAllProxiesHealth()
-	cleanupProxiesFromDB()
-	gatherProxies()
+	if cfg.Replica.Primary != "" {
+		fatalf("replica.primary is only supported with -serve")
+		return
+	}
+	recordRunMeta(cfg, "cron")
+	logStartupBanner(cfg)
+	// 集群成員經由管理 API 拉取驗證結果和請求租約，定時任務模式下只提供這些接口
+	stopClusterAPI, err := startClusterAPI(cfg)
+	if err != nil {
+		fatalf("failed to start cluster API: %v", err)
+		return
+	}
+	// 先按順序運行一次各個啟用的任務，再交給 cron 定時運行
+	scheduled := []struct {
+		name, spec string
+		run        func()
+	}{
+		{jobHealth, cfg.Schedule.Health, leaderOnly(cfg.Cluster, jobHealth, func() { checkAllProxiesHealth(false) })},
+		{jobCleanup, cfg.Schedule.Cleanup, func() { cleanupProxiesFromDB() }},
+		{jobGather, cfg.Schedule.Gather, leaderOnly(cfg.Cluster, jobGather, gatherProxies)},
+	}
+	for _, job := range scheduled {
+		if job.spec != config.ScheduleOff {
+			job.run()
+		}
+	}
 
-	// 啟動批量驗證器
-	go startBatchValidator()
+	// 啟動待驗證隊列
+	stopQueue := make(chan struct{})
+	queueDone := startValidationQueue(stopQueue)
 
 	c := cron.New()
-	c.AddFunc("0 */1 * * *", func() {
-		cronMutex.Lock()
-		defer cronMutex.Unlock()
-		checkAllProxiesHealth()
+	entries := make(map[string]cron.EntryID)
+	schedule := func(name, spec string, run func()) error {
+		if spec == config.ScheduleOff {
+			log.Infof("Scheduled job %s is disabled", name)
+			return nil
+		}
+		id, err := c.AddFunc(spec, func() {
+			lockJobs()
+			defer unlockJobs()
+			run()
+		})
+		if err != nil {
+			return err
+		}
+		entries[name] = id
+		log.Infof("Scheduled job %s: %s", name, spec)
+		return nil
+	}
+	for _, job := range scheduled {
+		if err := schedule(job.name, job.spec, job.run); err != nil {
+			fatalf("invalid schedule for %s: %v", job.name, err)
+		}
+	}
+	c.Start()
+
+	// 重新加載配置時只重新註冊計劃有變化的任務
+	reloader.OnReload(func(cfg *config.Config) {
+		specs := map[string]string{
+			jobHealth:  cfg.Schedule.Health,
+			jobCleanup: cfg.Schedule.Cleanup,
+			jobGather:  cfg.Schedule.Gather,
+		}
+		for i := range scheduled {
+			job := &scheduled[i]
+			if specs[job.name] == job.spec {
+				continue
+			}
+			c.Remove(entries[job.name])
+			delete(entries, job.name)
+			job.spec = specs[job.name]
+			if err := schedule(job.name, job.spec, job.run); err != nil {
+				log.Errorf("invalid schedule for %s: %v", job.name, err)
+			}
+		}
 	})
+	stopReload := reloader.Watch()
+	stopDBWatch := watchDB()
+	stopHistory := watchHistory(cfg.History.Interval)
+	stopChat := watchChat(cfg.Chat.Interval)
+	stopCluster := watchCluster(cfg.Cluster)
+
+	waitForShutdown()
+	stopReload()
+	stopDBWatch()
+	stopHistory()
+	stopChat()
+	// 等待正在執行的定時任務和驗證結束後再關閉數據庫；任務結束後才釋放集群租約
+	close(stopQueue)
+	<-c.Stop().Done()
+	<-queueDone
+	stopCluster()
+	stopClusterAPI()
+}
+
+// serverOptions 按配置生成代理服務器選項（啟動及重新加載配置時使用）
+func serverOptions(cfg *config.Config, headerRewriter *rotator.HeaderRewriter, bans *rotator.BanDetector,
+	mutators []rotator.RequestMutator, mitmCA *rotator.CertAuthority) []rotator.Option {
+	return []rotator.Option{
+		rotator.WithAddr(cfg.Server.Listen),
+		rotator.WithTimeout(cfg.Server.Timeout),
+		rotator.WithTimeouts(rotator.Timeouts{
+			Dial:           cfg.Server.Timeouts.Dial,
+			TLSHandshake:   cfg.Server.Timeouts.TLSHandshake,
+			ResponseHeader: cfg.Server.Timeouts.ResponseHeader,
+			IdleTunnel:     cfg.Server.Timeouts.IdleTunnel,
+			TunnelLifetime: cfg.Server.Timeouts.TunnelLifetime,
+		}),
+		rotator.WithConnectionLimits(cfg.Server.MaxConnections, cfg.Server.MaxTunnels),
+		rotator.WithBandwidthLimits(cfg.Server.Bandwidth.GlobalBytesPerSecond, cfg.Server.Bandwidth.ClientBytesPerSecond),
+		rotator.WithClientAllowlist(cfg.Server.ClientAllow...),
+		rotator.WithRotateInterval(cfg.Server.RotateInterval),
+		rotator.WithDomainConcurrency(cfg.Server.DomainConcurrency),
+		rotator.WithResponseSLO(cfg.Server.ResponseSLO, cfg.Server.SLORetries),
+		rotator.WithRetryPolicy(cfg.ForwardRetry().Policy()),
+		rotator.WithHeaderRewriter(headerRewriter),
+		rotator.WithSelectionStrategy(cfg.Server.SelectionStrategy),
+		rotator.WithBodyBuffer(cfg.Server.BodyBufferBytes, cfg.Server.BodySpoolBytes, cfg.Server.BodySpoolDir),
+		rotator.WithClientStatsLogInterval(cfg.Server.ClientStatsLogInterval),
+		rotator.WithDiversity(cfg.Server.Diversity.Window, cfg.Server.Diversity.MinNetworks, cfg.Server.Diversity.Scope),
+		rotator.WithDomainMemory(cfg.Server.DomainMemory.TTL, cfg.Server.DomainMemory.Failures),
+		rotator.WithBanDetector(bans),
+		rotator.WithRequestMutators(mutators...),
+		rotator.WithStrictHygiene(cfg.Server.StrictHygiene, cfg.Server.HygieneAllowHeaders),
+		rotator.WithForwardedFor(cfg.Server.ForwardedFor),
+		rotator.WithDNSResolution(cfg.Server.DNSResolution),
+		rotator.WithTags(cfg.Server.Tags...),
+		rotator.WithTargetACL(cfg.Server.TargetACL.Allow, cfg.Server.TargetACL.Deny, cfg.Server.TargetACL.AllowPrivate),
+		rotator.WithAnonymity(cfg.Server.Anonymity.Enabled, cfg.Server.Anonymity.StripHeaders, cfg.Server.Anonymity.StripCookies),
+		rotator.WithMITM(mitmCA),
+		rotator.WithMirror(cfg.Server.Mirror.Rate, cfg.Server.Mirror.MaxBodyBytes),
+		rotator.WithVersionHeader(versionHeaderValue(cfg)),
+		rotator.WithRequestIDHeader(cfg.Server.RequestIDHeader),
+		rotator.WithTransportCache(cfg.Server.TransportCacheSize, cfg.Server.UpstreamIdleTimeout),
+	}
+}
 
-	c.AddFunc("30 */1 * * *", func() {
-		cronMutex.Lock()
-		defer cronMutex.Unlock()
-		cleanupProxiesFromDB()
+// applySettings 應用可在運行時修改的任務配置：來源、採集與清理策略、驗證策略及來源降頻與退避策略；
+// 重新加載時由調用方持有 cronMutex，避免與正在運行的任務交錯
+func applySettings(cfg *config.Config) {
+	proxySources = cfg.Sources
+	gatherCfg = cfg.Gather
+	cleanupPolicy = pool.CleanupPolicy(cfg.Cleanup)
+	sourceStats.SetPolicy(sourcestats.DemotePolicy{
+		Below:      cfg.Gather.DemoteBelow,
+		Every:      cfg.Gather.DemoteEvery,
+		MinSamples: cfg.Gather.DemoteMinSamples,
 	})
+	sourceStats.SetBackoff(sourcestats.BackoffPolicy{Initial: cfg.Gather.BackoffInitial, Max: cfg.Gather.BackoffMax})
 
-	c.AddFunc("0 */2 * * *", func() {
-		cronMutex.Lock()
-		defer cronMutex.Unlock()
-		gatherProxies()
+	probeTargets := make([]pool.ProbeTarget, 0, len(cfg.Validation.ProbeTargets))
+	for _, t := range cfg.Validation.ProbeTargets {
+		probeTargets = append(probeTargets, pool.ProbeTarget(t))
+	}
+	integrityChecks := make([]pool.IntegrityCheck, 0, len(cfg.Validation.Integrity))
+	for _, c := range cfg.Validation.Integrity {
+		integrityChecks = append(integrityChecks, pool.IntegrityCheck(c))
+	}
+	pool.SetValidationPolicy(pool.ValidationPolicy{
+		TestURLs:          cfg.Validation.TestURLs,
+		Timeout:           cfg.Validation.Timeout,
+		RequiredSuccesses: cfg.Validation.RequiredSuccesses,
+		RequireHTTPS:      cfg.Validation.RequireHTTPS,
+		Targets:           cfg.Validation.Targets,
+		ProbeTargets:      probeTargets,
+		SpeedTestURL:      cfg.Validation.SpeedTestURL,
+		IntegrityChecks:   integrityChecks,
+		Retry:             cfg.Retry.Validation.Policy(),
+		RecheckMin:        cfg.Validation.RecheckMin,
+		RecheckMax:        cfg.Validation.RecheckMax,
+		GoogleProbeURL:    cfg.Validation.GoogleProbeURL,
+		JudgeURL:          cfg.Validation.JudgeURL,
+		KnownBadTTL:       cfg.Validation.KnownBadTTL,
+		ProbeRate:         cfg.Validation.ProbeRate,
+		ProbeTargetRate:   cfg.Validation.ProbeTargetRate,
+		ProbeJitter:       cfg.Validation.ProbeJitter,
+		ScoreHalfLife:     cfg.Validation.ScoreHalfLife,
+		ScoreExclude:      cfg.Validation.ScoreExclude,
 	})
-	c.Start()
+	fetcher.DefaultConfig.Retry = cfg.Retry.Fetch.Policy()
+	fetcher.DefaultConfig.Delay = cfg.Gather.Delay
+	fetcher.DefaultConfig.RandomDelay = cfg.Gather.Jitter
+	fetcher.DefaultConfig.Parallelism = cfg.Gather.Parallelism
+	fetcher.DefaultConfig.UserAgents = cfg.Gather.UserAgents
+	fetcher.DefaultConfig.Domains = nil
+	for _, d := range cfg.Gather.Domains {
+		fetcher.DefaultConfig.Domains = append(fetcher.DefaultConfig.Domains, fetcher.DomainLimit{
+			Domain:      d.Domain,
+			Delay:       d.Delay,
+			RandomDelay: d.Jitter,
+			Parallelism: cmp.Or(d.Parallelism, cfg.Gather.Parallelism),
+		})
+	}
+}
 
-	ps, err := listAllProxiesFromDB()
-	if err != nil {
-		logrus.Errorf("listAllProxiesFromDB error: %v", err)
-		return
+// newHeaderRewriter 按配置創建頭部改寫器
+func newHeaderRewriter(cfg *config.Config) (*rotator.HeaderRewriter, error) {
+	rules := make([]rotator.HeaderRule, 0, len(cfg.HeaderRules))
+	for _, r := range cfg.HeaderRules {
+		rules = append(rules, rotator.HeaderRule(r))
+	}
+	return rotator.NewHeaderRewriter(rules)
+}
+
+// newBanDetector 按配置創建目標封禁響應識別（未配置規則時返回 nil）
+func newBanDetector(cfg *config.Config) (*rotator.BanDetector, error) {
+	b := cfg.Server.BanDetection
+	return rotator.NewBanDetector(rotator.BanRules{
+		Status:       b.Status,
+		BodyPatterns: b.BodyPatterns,
+		MaxBody:      b.MaxBodyBytes,
+		Retries:      b.Retries,
+	})
+}
+
+// newRequestMutators 按配置創建請求修改器：User-Agent 輪換，然後是頭部模板（模板中的 User-Agent 優先）
+func newRequestMutators(cfg *config.Config) ([]rotator.RequestMutator, error) {
+	var mutators []rotator.RequestMutator
+	if ua := cfg.Server.UserAgent; ua.Rotate != "" {
+		m, err := rotator.NewUserAgentRotator(ua.List, ua.Rotate)
+		if err != nil {
+			return nil, err
+		}
+		mutators = append(mutators, m)
 	}
+	if hp := cfg.Server.HeaderProfiles; len(hp.Profiles) > 0 {
+		profiles := make([]rotator.HeaderProfile, 0, len(hp.Profiles))
+		for _, p := range hp.Profiles {
+			fields := make([]rotator.HeaderField, 0, len(p.Headers))
+			for _, f := range p.Headers {
+				fields = append(fields, rotator.HeaderField(f))
+			}
+			profiles = append(profiles, rotator.HeaderProfile{Name: p.Name, Headers: fields})
+		}
+		m, err := rotator.NewHeaderProfiles(profiles, hp.Scope)
+		if err != nil {
+			return nil, fmt.Errorf("header profiles: %w", err)
+		}
+		mutators = append(mutators, m)
+	}
+	return mutators, nil
+}
 
-	jb, err := json.MarshalIndent(ps, "", "\t")
+// loadMITMCA MITM 模式啟用時加載（不存在時生成）CA，未啟用時返回 nil
+func loadMITMCA(cfg *config.Config) (*rotator.CertAuthority, error) {
+	if !cfg.Server.MITM.Enabled {
+		return nil, nil
+	}
+	certFile, keyFile := cfg.Server.MITM.CACert, cfg.Server.MITM.CAKey
+	if certFile == "" {
+		certFile, keyFile = paths.DefaultMITMFiles()
+	}
+	ca, created, err := rotator.LoadOrCreateCA(certFile, keyFile)
 	if err != nil {
-		logrus.Fatalf("failed to marshal json: %v", err)
-		return
+		return nil, err
+	}
+	if created {
+		log.Warnf("Generated MITM CA certificate %s; add it to the trust store of every client", certFile)
+	} else {
+		log.Infof("Loaded MITM CA certificate %s", certFile)
+	}
+	return ca, nil
+}
+
+// serviceTLS 代理端點與管理 API 的 TLS 配置（nil 表示明文），acme 為兩者共用的 ACME 證書管理器（未使用 ACME 時為 nil）
+type serviceTLS struct {
+	proxy *tls.Config
+	admin *tls.Config
+	acme  *tlsserve.ACME
+}
+
+// newServiceTLS 按 server.tls、admin.tls 與 acme 創建 TLS 配置
+func newServiceTLS(cfg *config.Config) (*serviceTLS, error) {
+	st := &serviceTLS{}
+	if len(cfg.Server.TLS.ACMEDomains) > 0 || len(cfg.Admin.TLS.ACMEDomains) > 0 {
+		cacheDir := cfg.ACME.CacheDir
+		if cacheDir == "" {
+			cacheDir = paths.DefaultACMECacheDir()
+		}
+		a, err := tlsserve.NewACME(tlsserve.ACMEOptions{
+			Email:        cfg.ACME.Email,
+			CacheDir:     cacheDir,
+			DirectoryURL: cfg.ACME.DirectoryURL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		st.acme = a
+	}
+	tlsOptions := func(t config.ListenerTLSConfig) tlsserve.Options {
+		return tlsserve.Options{CertFile: t.CertFile, KeyFile: t.KeyFile, ACMEDomains: t.ACMEDomains, ACME: st.acme}
+	}
+	var err error
+	if st.proxy, err = tlsserve.Config(tlsOptions(cfg.Server.TLS)); err != nil {
+		return nil, fmt.Errorf("server.tls: %w", err)
+	}
+	if cfg.Admin.Listen != "" {
+		if st.admin, err = tlsserve.Config(tlsOptions(cfg.Admin.TLS)); err != nil {
+			return nil, fmt.Errorf("admin.tls: %w", err)
+		}
+	}
+	if st.acme != nil {
+		log.Infof("ACME certificates for %s are obtained and renewed automatically", strings.Join(st.acme.Domains(), ", "))
+	}
+	if cfg.Server.TLS.CertFile != "" {
+		log.Infof("Proxy endpoint served over TLS with certificate %s", cfg.Server.TLS.CertFile)
+	}
+	return st, nil
+}
+
+// encryptedIndexCacheSize 啟用加密時的表索引緩存大小
+const encryptedIndexCacheSize = 64 << 20
+
+// badgerOptions 數據庫打開選項，配置了加密密鑰時啟用靜態加密
+func badgerOptions(dir string, c config.DBConfig) (badger.Options, error) {
+	opts := badger.DefaultOptions(dir)
+	key, err := c.Key()
+	if err != nil || key == nil {
+		return opts, err
+	}
+	// 加密後每次讀取表索引都要解密，Badger 建議為索引設置緩存
+	return opts.WithEncryptionKey(key).WithIndexCacheSize(encryptedIndexCacheSize), nil
+}
+
+// upstreamProxyTLS 按配置創建連接 https 上遊代理時的 TLS 配置，使用預設校驗時返回 nil
+func upstreamProxyTLS(c config.ProxyTLSConfig) (*tls.Config, error) {
+	if c == (config.ProxyTLSConfig{}) {
+		return nil, nil
+	}
+	tc := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upstream proxy CA: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in upstream proxy CA %s", c.CAFile)
+		}
+		tc.RootCAs = roots
+	}
+	if c.InsecureSkipVerify {
+		log.Warn("Certificates of https upstream proxies are not verified")
+	}
+	return tc, nil
+}
+
+// newNotifier 按配置創建事件通知器，未配置 Webhook 時返回 nil
+func newNotifier(cfg *config.Config) (*notify.Notifier, error) {
+	if len(cfg.Notify.Webhooks) == 0 {
+		return nil, nil
+	}
+	hooks := make([]notify.Webhook, 0, len(cfg.Notify.Webhooks))
+	for _, h := range cfg.Notify.Webhooks {
+		hooks = append(hooks, notify.Webhook{Kind: h.Type, URL: h.URL, Token: h.Token, ChatID: h.ChatID, Events: h.Events})
+	}
+	return notify.New(hooks, cfg.Notify.PoolLowThreshold)
+}
+
+// startNamedPools 為每個命名代理池在其監聽地址上啟動輪換服務，除篩選條件外與主服務使用相同選項；返回按池名稱索引的服務器
+func startNamedPools(pools []config.PoolConfig, opts []rotator.Option) map[string]*rotator.ProxyServer {
+	servers := make(map[string]*rotator.ProxyServer, len(pools))
+	for _, pc := range pools {
+		server := rotator.NewProxyServer(nil, bdb, poolOptions(pc, opts)...)
+		if err := server.Start(); err != nil {
+			fatalf("failed to start pool %s: %v", pc.Name, err)
+		}
+		log.WithField("pool", pc.Name).Infof("Pool server started on %s", pc.Listen)
+		servers[pc.Name] = server
 	}
-	logrus.Infof("All Proxies in DB:\n%s", string(jb))
-	select {}
+	return servers
+}
+
+// poolOptions 在主服務選項的基礎上設置命名代理池的監聽地址和篩選條件
+func poolOptions(pc config.PoolConfig, opts []rotator.Option) []rotator.Option {
+	criteria := pool.NewCriteria(pc.Sites...)
+	criteria.Tags = pool.NormalizeTags(pc.Tags)
+	criteria.Countries = pc.Countries
+	criteria.Anonymity = pc.Anonymity
+	criteria.Protocols = pc.Protocols
+	criteria.Google = pc.Google
+	// 池的標籤是固定條件，不使用 server.tags 作為預設標籤
+	return append(slices.Clone(opts), rotator.WithAddr(pc.Listen), rotator.WithTags(), rotator.WithCriteria(criteria))
 }
 
 // startProxyServer 啟動代理服務器
-func startProxyServer(listenAddr string) {
+func startProxyServer(cfg *config.Config, mitmCA *rotator.CertAuthority, svcTLS *serviceTLS, opts ...rotator.Option) {
+	listenAddr := cfg.Server.Listen
+	// TLS 只在啟動時設置，修改需要重啟
+	opts = append(opts, rotator.WithTLS(svcTLS.proxy))
 	// 從數據庫加載代理
 	proxies, err := listAllProxiesFromDB()
 	if err != nil {
-		logrus.Errorf("failed to load proxies from DB: %v", err)
+		log.Errorf("failed to load proxies from DB: %v", err)
 		proxies = nil
 	}
 
 	if len(proxies) == 0 {
-		logrus.Warn("no proxies available in database, server will start but requests will fail")
+		log.Warn("no proxies available in database, server will start but requests will fail")
 	} else {
-		logrus.Infof("Loaded %d proxies from database", len(proxies))
+		log.Infof("Loaded %d proxies from database", len(proxies))
 	}
 
 	// 創建代理服務器
-	server := proxy.NewProxyServer(proxies, bdb, proxy.WithAddr(listenAddr))
+	server := rotator.NewProxyServer(proxies, bdb, opts...)
 
 	// 啟動服務器
 	err = server.Start()
 	if err != nil {
-		logrus.Fatalf("failed to start proxy server: %v", err)
+		fatalf("failed to start proxy server: %v", err)
 	}
 
-	logrus.Infof("Proxy server started on %s", listenAddr)
-	logrus.Infof("HTTP proxies available: %d", len(proxies))
+	log.Infof("Proxy server started on %s", listenAddr)
+	log.Infof("HTTP proxies available: %d", len(proxies))
+	if server.RotateInterval > 0 {
+		log.Infof("Rotation interval mode enabled: upstream rotates every %v", server.RotateInterval)
+	}
+	if server.DomainConcurrency > 0 {
+		log.Infof("Per-domain concurrency limit: %d", server.DomainConcurrency)
+	}
+	if server.ResponseSLO > 0 {
+		log.Infof("Upstream response SLO: %v (up to %d retries)", server.ResponseSLO, server.SLORetries)
+	}
+	if cfg.Server.StrictHygiene {
+		log.Info("Strict outbound hygiene enabled: fingerprinting headers are stripped")
+	}
+	if cfg.Server.Anonymity.Enabled {
+		log.Info("Anonymity mode enabled: client-identifying headers are stripped")
+	}
+	if cfg.Server.MITM.Enabled {
+		log.Info("MITM mode enabled: CONNECT tunnels are decrypted with the local CA")
+	}
+	if cfg.Server.Mirror.Rate > 0 {
+		log.Infof("Request mirroring enabled: %.1f%% of GET requests are compared across proxies", cfg.Server.Mirror.Rate*100)
+	}
+	if cfg.Server.TargetACL.AllowPrivate {
+		log.Warn("Private, loopback and link-local targets are allowed: the proxy can reach the local network")
+	}
+	if d := cfg.Server.Diversity; d.Window > 1 && d.MinNetworks > 1 {
+		log.Infof("Exit diversity: at least %d distinct /16 networks per %d requests (%s)", d.MinNetworks, d.Window, d.Scope)
+	}
+	if dm := cfg.Server.DomainMemory; dm.TTL > 0 {
+		log.Infof("Domain memory: proxies failing %d times in a row for a domain are avoided there for %s", dm.Failures, dm.TTL)
+	}
+	if ua := cfg.Server.UserAgent; ua.Rotate != "" {
+		log.Infof("User-Agent rotation enabled: one per %s from %d candidates (0 = generated)", ua.Rotate, len(ua.List))
+	}
+	if hp := cfg.Server.HeaderProfiles; len(hp.Profiles) > 0 {
+		log.Infof("Header profiles enabled: %d profiles, one per %s", len(hp.Profiles), hp.Scope)
+	}
+	if b := cfg.Server.BanDetection; b.Enabled() {
+		log.Infof("Ban detection enabled: %d status codes, %d body patterns, %d retries", len(b.Status), len(b.BodyPatterns), b.Retries)
+	}
+	poolServers := startNamedPools(cfg.Pools, opts)
 
-	// 啟動批量驗證器
-	go startBatchValidator()
+	// 重新加載配置時重建各服務的請求處理器，已建立的隧道不受影響
+	reloader.OnReload(func(cfg *config.Config) {
+		headerRewriter, err := newHeaderRewriter(cfg)
+		if err != nil {
+			log.Errorf("invalid header rules: %v", err)
+			return
+		}
+		bans, err := newBanDetector(cfg)
+		if err != nil {
+			log.Errorf("invalid ban detection rules: %v", err)
+			return
+		}
+		mutators, err := newRequestMutators(cfg)
+		if err != nil {
+			log.Errorf("invalid request mutators: %v", err)
+			return
+		}
+		opts := serverOptions(cfg, headerRewriter, bans, mutators, mitmCA)
+		server.Reload(opts...)
+		for _, pc := range cfg.Pools {
+			if ps, ok := poolServers[pc.Name]; ok {
+				ps.Reload(poolOptions(pc, opts)...)
+			}
+		}
+	})
+	stopReload := reloader.Watch()
+	stopDBWatch := watchDB()
+	stopHistory := watchHistory(cfg.History.Interval)
+	stopChat := watchChat(cfg.Chat.Interval)
+
+	// 啟動管理 API
+	var adminServer *admin.Server
+	if cfg.Admin.Listen != "" {
+		adminServer = admin.New(cfg.Admin.Listen)
+		adminServer.TLSConfig = svcTLS.admin
+		adminServer.Token = cfg.Admin.Token
+		registerAdminRoutes(adminServer, server, cfg)
+		if err := adminServer.Start(); err != nil {
+			fatalf("failed to start admin API: %v", err)
+		}
+	}
 
-	// 開始定期收集代理
-	go func() {
-		logrus.Info("Starting proxy gathering...")
-		cronMutex.Lock()
-		defer cronMutex.Unlock()
-		gatherProxies()
-	}()
+	// 在側端口上處理 ACME HTTP-01 驗證
+	stopACME := func() {}
+	if svcTLS.acme != nil && cfg.ACME.HTTPListen != "" {
+		stop, err := svcTLS.acme.ServeHTTPChallenges(cfg.ACME.HTTPListen)
+		if err != nil {
+			fatalf("failed to start ACME challenge server: %v", err)
+		}
+		stopACME = stop
+	}
+
+	// 啟動 DNS 導出
+	stopDNS := func() {}
+	if cfg.DNS.Listen != "" {
+		stop, err := startDNSServer(cfg.DNS)
+		if err != nil {
+			fatalf("failed to start DNS server: %v", err)
+		}
+		stopDNS = stop
+	}
+
+	// 只讀副本從主實例同步代理池，主實例負責採集、驗證和清理；其他實例與集群成員交換驗證結果
+	stopQueue := make(chan struct{})
+	var queueDone <-chan struct{}
+	var stopSync func()
+	if cfg.Replica.Primary != "" {
+		log.Infof("Running as a read-only replica of %s (sync every %v)", cfg.Replica.Primary, cfg.Replica.Interval)
+		stopSync = watchReplica(cfg.Replica)
+	} else {
+		stopSync = watchCluster(cfg.Cluster)
+		// 啟動待驗證隊列
+		queueDone = startValidationQueue(stopQueue)
+
+		// 開始定期收集代理
+		gather := leaderOnly(cfg.Cluster, jobGather, gatherProxies)
+		go func() {
+			log.Info("Starting proxy gathering...")
+			lockJobs()
+			defer unlockJobs()
+			gather()
+		}()
+	}
 
-	// 保持運行
-	select {}
+	// 運行直到收到終止信號
+	waitForShutdown()
+	stopSync()
+	stopReload()
+	stopDBWatch()
+	stopHistory()
+	stopChat()
+	if adminServer != nil {
+		// 先斷開實時推送的長連接，否則關閉管理 API 要等待它們超時
+		proxyFeed.Close()
+		if err := adminServer.Stop(); err != nil {
+			log.Warnf("failed to stop admin API: %v", err)
+		}
+	}
+	stopDNS()
+	stopACME()
+	for name, ps := range poolServers {
+		if err := ps.Stop(); err != nil {
+			log.Warnf("failed to stop pool %s: %v", name, err)
+		}
+	}
+	if err := server.Stop(); err != nil {
+		log.Warnf("failed to stop proxy server: %v", err)
+	}
+	close(stopQueue)
+	if queueDone != nil {
+		<-queueDone
+	}
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// loadProxy 讀取鍵 key 的代理記錄，不存在時返回 nil
+func loadProxy(t *testing.T, db *badger.DB, key string) *pool.Proxy {
+	t.Helper()
+	var p *pool.Proxy
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			p, err = pool.LoadFromJSON(v)
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestMigrateProxyKeys(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now().Truncate(time.Second)
+	proxy := func(ip, protocol string, updated time.Time, disabled bool) *pool.Proxy {
+		return &pool.Proxy{IP: ip, Port: "80", Protocol: protocol, Updated: updated, Disable: disabled}
+	}
+	seedProxies(t, db, map[string]any{
+		// 同一 ip:port 的多個協議記錄：可用的優先於較新但禁用的
+		"http://1.1.1.1:80":   proxy("1.1.1.1", "http", now.Add(-time.Hour), false),
+		"socks5://1.1.1.1:80": proxy("1.1.1.1", "socks5", now, true),
+		// 已有較新的規範記錄時不被舊記錄覆蓋
+		"2.2.2.2:80":         proxy("2.2.2.2", "socks5", now, false),
+		"http://2.2.2.2:80":  proxy("2.2.2.2", "http", now.Add(-time.Hour), false),
+		"https://3.3.3.3:80": proxy("3.3.3.3", "https", now, false),
+		"http://4.4.4.4:80":  "not json",
+	})
+
+	n, err := migrateProxyKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("migrated %d legacy keys, want 5", n)
+	}
+	for key, want := range map[string]string{"1.1.1.1:80": "http", "2.2.2.2:80": "socks5", "3.3.3.3:80": "https"} {
+		if p := loadProxy(t, db, key); p == nil || p.Protocol != want {
+			t.Errorf("%s = %+v, want the %s record", key, p, want)
+		}
+	}
+	for _, key := range []string{"http://1.1.1.1:80", "socks5://1.1.1.1:80", "http://2.2.2.2:80", "https://3.3.3.3:80", "http://4.4.4.4:80"} {
+		if p := loadProxy(t, db, key); p != nil {
+			t.Errorf("legacy key %s not removed", key)
+		}
+	}
+	if n, err := migrateProxyKeys(); n != 0 || err != nil {
+		t.Errorf("second migration = %d, %v; want nothing to do", n, err)
+	}
+}
+
+func TestMigrateProxyKeysBatches(t *testing.T) {
+	// 小的 memtable 使單個事務放不下全部舊版鍵的遷移
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil).WithMemTableSize(4 << 20).WithValueThreshold(1 << 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	prev := bdb
+	bdb = db
+	t.Cleanup(func() { bdb = prev })
+
+	n := 3 * cleanupBatchSize
+	records := make(map[string]any, n)
+	for i := range n {
+		p := validated(fmt.Sprintf("10.%d.%d.1", i/256, i%256), time.Hour)
+		p.Source = fmt.Sprintf("https://example.com/list/%d/with/a/long/enough/path/to/fill/the/transaction.txt", i)
+		records["http://"+p.Key()] = p
+	}
+	for _, batch := range chunkMap(records, cleanupBatchSize) {
+		seedProxies(t, db, batch)
+	}
+	// 舊的實現在一個事務中遷移全部鍵
+	err = db.Update(func(txn *badger.Txn) error {
+		for key, p := range records {
+			if err := txn.Set([]byte(p.(*pool.Proxy).Key()), p.(*pool.Proxy).DumpJSON()); err != nil {
+				return err
+			}
+			if err := txn.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if !errors.Is(err, badger.ErrTxnTooBig) {
+		t.Fatalf("single-transaction migration err = %v, want ErrTxnTooBig (test database too large)", err)
+	}
+
+	migrated, err := migrateProxyKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != n {
+		t.Errorf("migrated %d legacy keys, want %d", migrated, n)
+	}
+	if ps, err := listAllProxiesFromDB(); err != nil || len(ps) != n {
+		t.Errorf("%d canonical records after migration (%v), want %d", len(ps), err, n)
+	}
+}
+
+// chunkMap 把 m 分成每份最多 size 個鍵
+func chunkMap(m map[string]any, size int) []map[string]any {
+	var out []map[string]any
+	cur := make(map[string]any, size)
+	for k, v := range m {
+		cur[k] = v
+		if len(cur) == size {
+			out = append(out, cur)
+			cur = make(map[string]any, size)
+		}
+	}
+	if len(cur) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
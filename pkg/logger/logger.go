@@ -0,0 +1,218 @@
+// Package logger pkg 下各包使用的日誌門面，後端可替換（slog、zap、logrus 等）
+//
+// 預設輸出到 slog.Default()。嵌入方可實現 Backend 並調用 SetBackend 接入自己的日誌庫：
+//
+//	logger.SetBackend(logger.NewSlogBackend(slog.New(slog.NewJSONHandler(os.Stderr, nil))))
+//
+// 日誌級別未啟用時 Entry 不會格式化消息；熱路徑上構造字段前可先用 Enabled 判斷。
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// Level 日誌級別
+type Level int
+
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String 級別名稱
+func (l Level) String() string {
+	switch l {
+	case LevelTrace:
+		return "trace"
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel 解析級別名稱（trace, debug, info, warn/warning, error，不區分大小寫）
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// ErrorKey WithError 使用的字段名
+const ErrorKey = "error"
+
+// Fields 結構化字段
+type Fields map[string]any
+
+// Backend 日誌後端，component 為組件名（如 pool, server），可用於按組件設置級別
+type Backend interface {
+	Enabled(component string, level Level) bool
+	Log(component string, level Level, msg string, fields Fields)
+}
+
+// backendHolder 使 atomic.Value 始終存儲同一具體類型
+type backendHolder struct{ Backend }
+
+var current atomic.Value
+
+func init() {
+	current.Store(backendHolder{NewSlogBackend(nil)})
+}
+
+// SetBackend 替換日誌後端，對已創建的 Entry 同樣生效；b 為 nil 時丟棄所有日誌
+func SetBackend(b Backend) {
+	if b == nil {
+		b = Nop
+	}
+	current.Store(backendHolder{b})
+}
+
+func backend() Backend {
+	return current.Load().(backendHolder).Backend
+}
+
+// Entry 帶組件名和字段的日誌記錄器，可在包初始化時創建
+type Entry struct {
+	component string
+	fields    Fields
+}
+
+// For 返回組件日誌記錄器
+func For(component string) *Entry {
+	return &Entry{component: component}
+}
+
+// WithField 返回附加一個字段的新 Entry
+func (e *Entry) WithField(key string, value any) *Entry {
+	return e.WithFields(Fields{key: value})
+}
+
+// WithFields 返回附加多個字段的新 Entry
+func (e *Entry) WithFields(fields Fields) *Entry {
+	merged := make(Fields, len(e.fields)+len(fields))
+	for k, v := range e.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Entry{component: e.component, fields: merged}
+}
+
+// WithError 返回附加 error 字段的新 Entry
+func (e *Entry) WithError(err error) *Entry {
+	return e.WithField(ErrorKey, err)
+}
+
+// Enabled 判斷級別是否啟用，用於跳過昂貴的字段計算
+func (e *Entry) Enabled(level Level) bool {
+	return backend().Enabled(e.component, level)
+}
+
+func (e *Entry) log(level Level, args []any) {
+	b := backend()
+	if !b.Enabled(e.component, level) {
+		return
+	}
+	b.Log(e.component, level, fmt.Sprint(args...), e.fields)
+}
+
+func (e *Entry) logf(level Level, format string, args []any) {
+	b := backend()
+	if !b.Enabled(e.component, level) {
+		return
+	}
+	b.Log(e.component, level, fmt.Sprintf(format, args...), e.fields)
+}
+
+func (e *Entry) Trace(args ...any)                 { e.log(LevelTrace, args) }
+func (e *Entry) Debug(args ...any)                 { e.log(LevelDebug, args) }
+func (e *Entry) Info(args ...any)                  { e.log(LevelInfo, args) }
+func (e *Entry) Warn(args ...any)                  { e.log(LevelWarn, args) }
+func (e *Entry) Error(args ...any)                 { e.log(LevelError, args) }
+func (e *Entry) Tracef(format string, args ...any) { e.logf(LevelTrace, format, args) }
+func (e *Entry) Debugf(format string, args ...any) { e.logf(LevelDebug, format, args) }
+func (e *Entry) Infof(format string, args ...any)  { e.logf(LevelInfo, format, args) }
+func (e *Entry) Warnf(format string, args ...any)  { e.logf(LevelWarn, format, args) }
+func (e *Entry) Errorf(format string, args ...any) { e.logf(LevelError, format, args) }
+
+// Nop 丟棄所有日誌的後端
+var Nop Backend = nopBackend{}
+
+type nopBackend struct{}
+
+func (nopBackend) Enabled(string, Level) bool        { return false }
+func (nopBackend) Log(string, Level, string, Fields) {}
+
+// SlogTrace slog 中對應 trace 的級別
+const SlogTrace = slog.LevelDebug - 4
+
+// slogBackend 輸出到 slog.Logger 的後端
+type slogBackend struct {
+	logger *slog.Logger // nil 表示每次使用 slog.Default()
+}
+
+// NewSlogBackend 創建輸出到 l 的後端（l 為 nil 時使用 slog.Default()），組件名記錄在 component 屬性中
+func NewSlogBackend(l *slog.Logger) Backend {
+	return slogBackend{logger: l}
+}
+
+func (b slogBackend) slogger() *slog.Logger {
+	if b.logger != nil {
+		return b.logger
+	}
+	return slog.Default()
+}
+
+func (b slogBackend) Enabled(_ string, level Level) bool {
+	return b.slogger().Enabled(context.Background(), slogLevel(level))
+}
+
+func (b slogBackend) Log(component string, level Level, msg string, fields Fields) {
+	attrs := make([]slog.Attr, 0, len(fields)+1)
+	attrs = append(attrs, slog.String("component", component))
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		attrs = append(attrs, slog.Any(k, v))
+	}
+	b.slogger().LogAttrs(context.Background(), slogLevel(level), msg, attrs...)
+}
+
+// slogLevel 轉換為 slog 級別
+func slogLevel(l Level) slog.Level {
+	switch l {
+	case LevelTrace:
+		return SlogTrace
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+// recordBackend 記錄日誌並按最低級別過濾
+type recordBackend struct {
+	min     Level
+	entries []recorded
+}
+
+type recorded struct {
+	component string
+	level     Level
+	msg       string
+	fields    Fields
+}
+
+func (b *recordBackend) Enabled(_ string, level Level) bool { return level >= b.min }
+
+func (b *recordBackend) Log(component string, level Level, msg string, fields Fields) {
+	b.entries = append(b.entries, recorded{component, level, msg, fields})
+}
+
+// lazyString 記錄是否被格式化
+type lazyString struct{ formatted *bool }
+
+func (s lazyString) String() string {
+	*s.formatted = true
+	return "lazy"
+}
+
+func TestEntry(t *testing.T) {
+	rec := &recordBackend{min: LevelInfo}
+	SetBackend(rec)
+	defer SetBackend(NewSlogBackend(nil))
+
+	log := For("pool")
+	var formatted bool
+	log.Debugf("skipped %s", lazyString{&formatted})
+	if formatted || len(rec.entries) != 0 {
+		t.Fatal("disabled level should not be formatted or logged")
+	}
+	if log.Enabled(LevelDebug) || !log.Enabled(LevelWarn) {
+		t.Error("Enabled should follow the backend")
+	}
+
+	base := log.WithField("proxy", "1.2.3.4:8080")
+	base.WithError(errors.New("boom")).Warnf("check %d failed", 2)
+	base.Info("ok")
+
+	if len(rec.entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(rec.entries))
+	}
+	e := rec.entries[0]
+	if e.component != "pool" || e.level != LevelWarn || e.msg != "check 2 failed" {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	if e.fields["proxy"] != "1.2.3.4:8080" || e.fields[ErrorKey] == nil {
+		t.Errorf("unexpected fields: %v", e.fields)
+	}
+	// WithError 不應修改父 Entry 的字段
+	if _, ok := rec.entries[1].fields[ErrorKey]; ok {
+		t.Errorf("parent entry fields modified: %v", rec.entries[1].fields)
+	}
+}
+
+func TestSetBackendNil(t *testing.T) {
+	SetBackend(nil)
+	defer SetBackend(NewSlogBackend(nil))
+	if For("server").Enabled(LevelError) {
+		t.Error("nil backend should discard all logs")
+	}
+}
+
+func TestSlogBackend(t *testing.T) {
+	var buf bytes.Buffer
+	SetBackend(NewSlogBackend(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: SlogTrace}))))
+	defer SetBackend(NewSlogBackend(nil))
+
+	For("validator").WithError(errors.New("timeout")).Trace("probe failed")
+
+	var entry map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v (%q)", err, buf.String())
+	}
+	if entry["component"] != "validator" || entry["msg"] != "probe failed" || entry["error"] != "timeout" {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+}
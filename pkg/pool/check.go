@@ -0,0 +1,70 @@
+package pool
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// CheckResult 按需驗證一個代理的結果
+type CheckResult struct {
+	Proxy     string `json:"proxy"`
+	Valid     bool   `json:"valid"`
+	Protocol  string `json:"protocol,omitempty"`
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+	Anonymity string `json:"anonymity,omitempty"`
+	ExitIP    string `json:"exit_ip,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ParseCandidate 解析 host:port 或 scheme://[user:pass@]host:port 格式的代理地址；協議在驗證時重新探測
+func ParseCandidate(s string) (*Proxy, error) {
+	s = strings.TrimSpace(s)
+	raw := s
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", s, err)
+	}
+	host, port := u.Hostname(), u.Port()
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("invalid proxy %q: want host:port", s)
+	}
+	p := &Proxy{IP: host, Port: port, Protocol: u.Scheme, Addr: net.JoinHostPort(host, port)}
+	if u.User != nil {
+		p.User = u.User.Username()
+		p.Pass, _ = u.User.Password()
+	}
+	return p, nil
+}
+
+// Check 按當前驗證策略驗證代理，並經由判定服務檢測出口地址和匿名級別；不修改 p，結果不寫入數據庫
+func Check(p *Proxy) CheckResult {
+	res := CheckResult{Proxy: p.Key()}
+	r := Validate(p)
+	if !r.Healthy {
+		res.Error = "validation failed"
+		return res
+	}
+	res.Valid = true
+	res.Protocol = r.Protocol
+	res.LatencyMs = r.Latency.Milliseconds()
+
+	policy := CurrentValidationPolicy()
+	if policy.JudgeURL == "" {
+		return res
+	}
+	// 判定使用帶上探測到的協議的副本
+	checked := *p
+	r.ApplyTo(&checked)
+	j, err := Judge(&checked, policy)
+	if err != nil {
+		res.Error = fmt.Sprintf("judge: %v", err)
+		return res
+	}
+	res.Anonymity, res.ExitIP = j.Anonymity, j.ExitIP
+	return res
+}
@@ -0,0 +1,65 @@
+package pool
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// CleanupPolicy 清理策略
+type CleanupPolicy struct {
+	// MaxAge 最後一次通過驗證（從未驗證的代理為入庫時間）超過此時長的代理被刪除
+	MaxAge time.Duration
+	// Quarantine 被禁用的代理保留此時長，期間照常重新驗證，恢復可用即不再刪除；0 表示立即刪除
+	Quarantine time.Duration
+	// MaxProxies 代理總數上限，超出時按 EvictionOrder 淘汰；0 表示不限制
+	MaxProxies int
+	// MinScore 當前健康評分（見 Proxy.ScoreAt）低於此值的已驗證代理被刪除，不等待隔離期；0 表示不按評分刪除
+	MinScore float64
+}
+
+// Expired 判斷代理是否應被刪除，pending 表示代理仍在待驗證隊列中；返回刪除原因，空字符串表示保留
+func (c CleanupPolicy) Expired(p *Proxy, pending bool, now time.Time) string {
+	if p.Updated.IsZero() {
+		// 待驗證的候選代理保留到驗證隊列處理，超過 MaxAge 仍未驗證的才刪除
+		if !pending || now.Sub(p.Added) > c.MaxAge {
+			return "never validated"
+		}
+		return ""
+	}
+	if now.Sub(p.Updated) > c.MaxAge {
+		return "stale"
+	}
+	if c.MinScore > 0 && p.ScoreAt(now, CurrentValidationPolicy().ScoreHalfLife) < c.MinScore {
+		return "low score"
+	}
+	if p.Disable && !p.ManualDisable {
+		// 手動禁用的代理保留到手動啟用；舊版本禁用的代理沒有 DisabledAt，以最後一次通過驗證的時間代替
+		since := cmp.Or(p.DisabledAt, p.Updated)
+		if c.Quarantine <= 0 || now.Sub(since) > c.Quarantine {
+			return "disabled"
+		}
+	}
+	return ""
+}
+
+// lastSeen 代理最近一次被確認的時間：最後一次通過驗證的時間，從未驗證的代理為入庫時間
+func (p *Proxy) lastSeen() time.Time {
+	if p.Updated.After(p.Added) {
+		return p.Updated
+	}
+	return p.Added
+}
+
+// EvictionOrder 按淘汰優先級原地排序：禁用的代理在前，其餘按最近一次被確認的時間從舊到新
+func EvictionOrder(ps []*Proxy) {
+	slices.SortStableFunc(ps, func(a, b *Proxy) int {
+		if a.Disable != b.Disable {
+			if a.Disable {
+				return -1
+			}
+			return 1
+		}
+		return a.lastSeen().Compare(b.lastSeen())
+	})
+}
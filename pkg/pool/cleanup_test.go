@@ -0,0 +1,72 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanupExpired(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	policy := CleanupPolicy{MaxAge: 72 * time.Hour, Quarantine: 6 * time.Hour}
+
+	tests := []struct {
+		name    string
+		p       Proxy
+		pending bool
+		want    string
+	}{
+		{"healthy", Proxy{Updated: ago(time.Hour)}, false, ""},
+		{"stale", Proxy{Updated: ago(73 * time.Hour)}, false, "stale"},
+		{"pending candidate", Proxy{Added: ago(time.Hour)}, true, ""},
+		{"old pending candidate", Proxy{Added: ago(73 * time.Hour)}, true, "never validated"},
+		{"failed first validation", Proxy{Added: ago(time.Hour), Disable: true}, false, "never validated"},
+		{"quarantined", Proxy{Updated: ago(2 * time.Hour), Disable: true, DisabledAt: ago(time.Hour)}, false, ""},
+		{"quarantine over", Proxy{Updated: ago(8 * time.Hour), Disable: true, DisabledAt: ago(7 * time.Hour)}, false, "disabled"},
+		{"legacy disabled", Proxy{Updated: ago(7 * time.Hour), Disable: true}, false, "disabled"},
+		{"manually disabled", Proxy{Updated: ago(8 * time.Hour), Disable: true, ManualDisable: true, DisabledAt: ago(7 * time.Hour)}, false, ""},
+	}
+	for _, tt := range tests {
+		if got := policy.Expired(&tt.p, tt.pending, now); got != tt.want {
+			t.Errorf("%s: Expired = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// 評分過低的代理不等待隔離期
+	policy.MinScore = 0.1
+	low := &Proxy{Updated: ago(2 * time.Hour), Disable: true, DisabledAt: ago(time.Hour), Score: 0.09, ScoredAt: ago(time.Hour)}
+	if got := policy.Expired(low, false, now); got != "low score" {
+		t.Errorf("low score proxy: Expired = %q, want low score", got)
+	}
+	if got := policy.Expired(&Proxy{Updated: ago(2 * time.Hour), Disable: true, DisabledAt: ago(time.Hour)}, false, now); got != "" {
+		t.Errorf("legacy quarantined proxy: Expired = %q, want kept", got)
+	}
+	policy.MinScore = 0
+
+	policy.Quarantine = 0
+	p := &Proxy{Updated: ago(time.Hour), Disable: true, DisabledAt: now}
+	if got := policy.Expired(p, false, now); got != "disabled" {
+		t.Errorf("without quarantine disabled proxy should be deleted, got %q", got)
+	}
+}
+
+func TestEvictionOrder(t *testing.T) {
+	now := time.Now()
+	ps := []*Proxy{
+		{IP: "1.1.1.1", Updated: now},
+		{IP: "2.2.2.2", Updated: now.Add(-time.Hour), Disable: true},
+		{IP: "3.3.3.3", Updated: now.Add(-2 * time.Hour)},
+		{IP: "4.4.4.4", Added: now.Add(-time.Minute)},
+	}
+	EvictionOrder(ps)
+	var got []string
+	for _, p := range ps {
+		got = append(got, p.IP)
+	}
+	want := []string{"2.2.2.2", "3.3.3.3", "4.4.4.4", "1.1.1.1"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("EvictionOrder = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package pool
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// 代理選擇策略
+const (
+	StrategyRandom     = "random"     // 均勻隨機
+	StrategyThroughput = "throughput" // 按測速吞吐量與健康評分加權隨機，偏好高吞吐出口
+	StrategyScore      = "score"      // 按健康評分加權隨機，偏好長期穩定的出口
+)
+
+// Criteria 代理篩選條件
+type Criteria struct {
+	Sites           []string        // 代理必須通過探測的站點標籤
+	Tags            []string        // 代理必須帶有的自定義標籤（見 NormalizeTags）
+	Countries       []string        // 代理所在國家代碼之一（大寫，如 US），空表示不限
+	Anonymity       []string        // 代理匿名級別之一（transparent, anonymous, elite），空表示不限
+	Protocols       []string        // 代理協議之一（http, https, socks4, socks5），空表示不限
+	Google          bool            // 代理必須能訪問 Google 搜索（見 Proxy.GoogleCapable）
+	ExcludeNetworks map[string]bool // 需要避開的網段（見 NetworkOf）
+	Exclude         map[string]bool // 需要避開的代理（見 Proxy.Key）
+	AllowTampering  bool            // 是否允許選擇篡改內容的代理（見 Proxy.Tampering）
+}
+
+// NewCriteria 創建按站點篩選的條件（站點標籤不區分大小寫）
+func NewCriteria(sites ...string) Criteria {
+	var c Criteria
+	for _, site := range sites {
+		site = strings.ToLower(strings.TrimSpace(site))
+		if site != "" {
+			c.Sites = append(c.Sites, site)
+		}
+	}
+	sort.Strings(c.Sites)
+	return c
+}
+
+// Key 篩選條件的唯一標識（不包含網段和代理排除）
+func (c Criteria) Key() string {
+	key := "sites=" + strings.Join(c.Sites, ",")
+	if len(c.Tags) > 0 {
+		key += ";tags=" + strings.Join(c.Tags, ",")
+	}
+	if len(c.Countries) > 0 {
+		key += ";countries=" + strings.Join(c.Countries, ",")
+	}
+	if len(c.Anonymity) > 0 {
+		key += ";anonymity=" + strings.Join(c.Anonymity, ",")
+	}
+	if len(c.Protocols) > 0 {
+		key += ";protocols=" + strings.Join(c.Protocols, ",")
+	}
+	if c.Google {
+		key += ";google"
+	}
+	return key
+}
+
+// Match 判斷代理是否滿足篩選條件
+func (c Criteria) Match(p *Proxy) bool {
+	if p.Tampering && !c.AllowTampering {
+		return false
+	}
+	if len(c.ExcludeNetworks) > 0 && c.ExcludeNetworks[NetworkOf(p.IP)] {
+		return false
+	}
+	if len(c.Exclude) > 0 && c.Exclude[p.Key()] {
+		return false
+	}
+	if !oneOf(c.Countries, p.Country) || !oneOf(c.Anonymity, p.Anonymity) || !oneOf(c.Protocols, p.Protocol) {
+		return false
+	}
+	if c.Google && !p.GoogleCapable() {
+		return false
+	}
+	return p.HasSites(c.Sites) && p.HasTags(c.Tags)
+}
+
+// oneOf 值是否在列表中（忽略大小寫），列表為空時總是滿足
+func oneOf(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkOf 返回 IP 所屬網段（IPv4 /16，IPv6 /32），無法解析時返回原值
+func NetworkOf(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(16, 32)).String() + "/16"
+	}
+	return parsed.Mask(net.CIDRMask(32, 128)).String() + "/32"
+}
@@ -0,0 +1,20 @@
+package pool
+
+import "testing"
+
+func TestNetworkOf(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"1.2.3.4", "1.2.0.0/16"},
+		{"1.2.200.9", "1.2.0.0/16"},
+		{"2001:db8:1::1", "2001:db8::/32"},
+		{"not-an-ip", "not-an-ip"},
+	}
+	for _, tt := range tests {
+		if got := NetworkOf(tt.ip); got != tt.want {
+			t.Errorf("NetworkOf(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
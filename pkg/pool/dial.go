@@ -0,0 +1,282 @@
+package pool
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Dial 經由代理連接到目標地址（http 使用 CONNECT 隧道，https 在與代理的 TLS 連接中使用 CONNECT 隧道，
+// socks5 使用 SOCKS5，其他協議直連）；
+// addr 中的主機名不在本機解析，原樣交給代理（需要本機解析時見 TransportOptions.Resolve）
+func Dial(ctx context.Context, dialer *net.Dialer, proxy *Proxy, network, addr string) (net.Conn, error) {
+	switch proxy.Protocol {
+	case "http":
+		return dialHTTP(ctx, dialer, proxy, addr)
+	case "https":
+		return dialHTTPS(ctx, dialer, proxy, addr)
+	case "socks5":
+		return dialSOCKS5(ctx, dialer, proxy, addr)
+	default:
+		// Direct connection
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// URL 返回代理地址，可用作 http.Transport.Proxy 的返回值
+// 與 Dial 一致，只有 http、https 與 socks5 經由代理，其他協議返回 nil（直連）；
+// 用於 https 代理時 http.Transport 以 TLSClientConfig 校驗代理證書，需要 SetProxyTLSConfig 的配置時見 Transport
+func (p *Proxy) URL() *url.URL {
+	switch p.Protocol {
+	case "http", "https", "socks5":
+	default:
+		return nil
+	}
+	u := &url.URL{Scheme: p.Protocol, Host: net.JoinHostPort(p.IP, p.Port)}
+	if p.User != "" && p.Pass != "" {
+		u.User = url.UserPassword(p.User, p.Pass)
+	}
+	return u
+}
+
+// dialHTTP 使用 HTTP 代理連接（CONNECT 隧道）
+func dialHTTP(ctx context.Context, dialer *net.Dialer, proxy *Proxy, addr string) (net.Conn, error) {
+	proxyAddr := strings.TrimPrefix(proxy.Addr, "http://")
+	// 如果 Addr 為空，從 IP 和 Port 構建
+	if proxyAddr == "" {
+		proxyAddr = net.JoinHostPort(proxy.IP, proxy.Port)
+	}
+
+	poolLog.Debugf("dialHTTP: proxy=%s, target=%s", proxyAddr, addr)
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy %s: %w", proxyAddr, err)
+	}
+	tunnel, err := connectTunnel(ctx, conn, proxy, addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// handshakeDeadline 使代理握手受 ctx 約束：到達 ctx 的截止時間或 ctx 被取消（如重試策略的單次嘗試超時）時中斷讀寫，
+// 返回握手完成後清除時限的函數
+func handshakeDeadline(ctx context.Context, conn net.Conn) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	return func() {
+		stop()
+		conn.SetDeadline(time.Time{})
+	}
+}
+
+// bufferedConn 包裝 net.Conn 以支持 bufio.Reader
+type bufferedConn struct {
+	net.Conn
+	Reader *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(b []byte) (int, error) {
+	return bc.Reader.Read(b)
+}
+
+// dialSOCKS5 使用 SOCKS5 代理連接
+func dialSOCKS5(ctx context.Context, dialer *net.Dialer, proxy *Proxy, addr string) (net.Conn, error) {
+	// 解析 SOCKS5 代理地址
+	proxyHost := proxy.IP
+	proxyPort := proxy.Port
+
+	// 連接到 SOCKS5 代理伺服器
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(proxyHost, proxyPort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SOCKS5 proxy: %w", err)
+	}
+	defer handshakeDeadline(ctx, conn)()
+
+	if err := socks5Greet(conn, proxy); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// 發送 CONNECT 請求
+	err = socks5SendConnect(conn, addr)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS5 CONNECT failed: %w", err)
+	}
+
+	// 讀取 CONNECT 響應
+	err = socks5ReadConnectResponse(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS5 CONNECT response failed: %w", err)
+	}
+
+	poolLog.Debugf("SOCKS5 proxy %s:%s connected to %s", proxyHost, proxyPort, addr)
+	return conn, nil
+}
+
+// socks5Greet 完成 SOCKS5 握手（代理設置了用戶名密碼時進行驗證）
+func socks5Greet(conn net.Conn, proxy *Proxy) error {
+	// SOCKS5 握手
+	authMethod := byte(0x00) // 無驗證
+	if proxy.User != "" && proxy.Pass != "" {
+		authMethod = byte(0x02) // 使用用戶名密碼驗證
+	}
+
+	// 發送握手請求
+	_, err := conn.Write([]byte{0x05, 0x01, authMethod})
+	if err != nil {
+		return fmt.Errorf("failed to send SOCKS5 greeting: %w", err)
+	}
+
+	// 讀取握手響應
+	buf := make([]byte, 2)
+	_, err = conn.Read(buf)
+	if err != nil {
+		return fmt.Errorf("failed to read SOCKS5 greeting response: %w", err)
+	}
+
+	if buf[0] != 0x05 {
+		return fmt.Errorf("SOCKS5 server version error")
+	}
+
+	if buf[1] == 0xff {
+		return fmt.Errorf("SOCKS5 authentication required but not supported")
+	}
+
+	// 如果需要用戶名密碼驗證
+	if authMethod == 0x02 {
+		err = socks5AuthUsernamePassword(conn, proxy.User, proxy.Pass)
+		if err != nil {
+			return fmt.Errorf("SOCKS5 username/password auth failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// socks5AuthUsernamePassword 使用用戶名密碼驗證
+func socks5AuthUsernamePassword(conn net.Conn, user, pass string) error {
+	// 報文格式: VER(1) ULEN(1) USER(LEN) PLEN(1) PASS(LEN)
+	authReq := make([]byte, 1+1+len(user)+1+len(pass))
+	authReq[0] = 0x01 // VER
+	authReq[1] = byte(len(user))
+	copy(authReq[2:], user)
+	authReq[2+len(user)] = byte(len(pass))
+	copy(authReq[3+len(user):], pass)
+
+	_, err := conn.Write(authReq)
+	if err != nil {
+		return err
+	}
+
+	// 讀取響應
+	buf := make([]byte, 2)
+	_, err = conn.Read(buf)
+	if err != nil {
+		return err
+	}
+
+	if buf[0] != 0x01 || buf[1] != 0x00 {
+		return fmt.Errorf("SOCKS5 username/password auth failed")
+	}
+
+	return nil
+}
+
+// socks5SendConnect 發送 CONNECT 請求
+func socks5SendConnect(conn net.Conn, addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	// 構建 CONNECT 請求
+	req := make([]byte, 0)
+	req = append(req, 0x05) // VER
+	req = append(req, 0x01) // CMD: CONNECT
+	req = append(req, 0x00) // RSV
+
+	// 檢查是 IP 還是域名
+	ip := net.ParseIP(host)
+	if ip != nil {
+		req = append(req, 0x01) // ATYP: IPv4
+		if len(ip) == 16 {
+			req[3] = 0x04 // ATYP: IPv6
+			req = append(req, ip...)
+		} else {
+			req[3] = 0x01
+			req = append(req, ip.To4()...)
+		}
+	} else {
+		req = append(req, 0x03) // ATYP: DOMAINNAME
+		req = append(req, byte(len(host)))
+		req = append(req, host...)
+	}
+
+	// 添加端口
+	portNum, err := net.LookupPort("tcp", port)
+	if err != nil {
+		return err
+	}
+	req = append(req, byte(portNum>>8), byte(portNum))
+
+	_, err = conn.Write(req)
+	return err
+}
+
+// socks5ReadConnectResponse 讀取 CONNECT 響應
+func socks5ReadConnectResponse(conn net.Conn) error {
+	// 讀取響應頭 (5 bytes)
+	header := make([]byte, 5)
+	_, err := conn.Read(header)
+	if err != nil {
+		return err
+	}
+
+	if header[0] != 0x05 {
+		return fmt.Errorf("invalid SOCKS5 version in response")
+	}
+
+	if header[1] != 0x00 {
+		return fmt.Errorf("SOCKS5 CONNECT failed, status: %d", header[1])
+	}
+
+	// 讀取地址部分 (變長)
+	// ATYP (1 byte) + ADDR (變長) + PORT (2 bytes)
+	atyp := header[3]
+	var addrLen int
+	switch atyp {
+	case 0x01: // IPv4
+		addrLen = 4
+	case 0x03: // DOMAINNAME
+		// 需要先讀取域名長度
+		lenByte := make([]byte, 1)
+		_, err := conn.Read(lenByte)
+		if err != nil {
+			return err
+		}
+		addrLen = int(lenByte[0])
+	case 0x04: // IPv6
+		addrLen = 16
+	default:
+		return fmt.Errorf("unknown address type: %d", atyp)
+	}
+
+	// 讀取剩餘的地址和端口
+	remaining := make([]byte, addrLen+2)
+	_, err = conn.Read(remaining)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+// Package pool 基於 badger 數據庫的代理池：代理數據結構、驗證、按條件選擇及經由代理撥號
+//
+// 數據庫中的鍵為 ip:port，值為 Proxy 的 JSON。其他 Go 程序可以直接嵌入代理池：
+//
+//	db, _ := badger.Open(badger.DefaultOptions("proxy_badger_db"))
+//	client := &http.Client{Transport: pool.New(db).GetTransport()}
+//	resp, err := client.Get("https://example.com/")
+//
+// 寫入代理記錄使用 Add、SaveValidation（或 ApplyValidation 應用 Validate 的結果）、Delete，可通過 WithHooks 註冊生命週期回調：
+//
+//	pl := pool.New(db, pool.WithHooks(pool.Hooks{
+//		OnProxyDeleted: func(key string, p *pool.Proxy) { mirror.Delete(key) },
+//	}))
+package pool
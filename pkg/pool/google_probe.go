@@ -0,0 +1,80 @@
+package pool
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/e2u/dynamic-proxy/internal/fetcher"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+)
+
+// Google 搜索探測結果（見 Proxy.GoogleProbe）
+const (
+	GooglePassed  = "passed"  // 正常返回搜索結果
+	GoogleCaptcha = "captcha" // 被重定向到驗證碼頁（/sorry/）或頁面要求人機驗證
+	GoogleBlocked = "blocked" // 返回 403、429 等錯誤狀態碼
+)
+
+// googleCaptchaMarkers 驗證碼頁面的特徵
+var googleCaptchaMarkers = []string{
+	"/sorry/",
+	"unusual traffic",
+	"g-recaptcha",
+	"captcha-form",
+}
+
+// classifyGoogleResponse 根據 Google 搜索的響應判斷探測結果
+func classifyGoogleResponse(status int, location string, body []byte) string {
+	if status >= 300 && status < 400 {
+		if strings.Contains(location, "/sorry/") {
+			return GoogleCaptcha
+		}
+		// 跳轉到同意頁等地區性頁面不算被攔截
+		return GooglePassed
+	}
+	if status == http.StatusTooManyRequests && strings.Contains(string(body), "/sorry/") {
+		return GoogleCaptcha
+	}
+	if status >= http.StatusBadRequest {
+		return GoogleBlocked
+	}
+	text := strings.ToLower(string(body))
+	for _, marker := range googleCaptchaMarkers {
+		if strings.Contains(text, marker) {
+			return GoogleCaptcha
+		}
+	}
+	return GooglePassed
+}
+
+// probeGoogle 經由代理請求 Google 搜索（policy.GoogleProbeURL），返回探測結果；
+// 請求失敗時返回空字符串（保留上次結果）
+func probeGoogle(p *Proxy, policy ValidationPolicy) string {
+	client := newProbeClient(p, policy.Timeout)
+	req, err := http.NewRequest(http.MethodGet, policy.GoogleProbeURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("User-Agent", fetcher.GetRandomUserAgent())
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	resp, err := client.Do(req)
+	if err != nil {
+		validatorLog.WithField("proxy", p.String()).WithError(err).Debug("Google probe failed")
+		return ""
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 256<<10))
+
+	result := classifyGoogleResponse(resp.StatusCode, resp.Header.Get("Location"), body)
+	validatorLog.WithFields(logger.Fields{"proxy": p.String(), "status": resp.StatusCode, "result": result}).Debug("Google probe")
+	return result
+}
+
+// GoogleCapable 代理能否訪問 Google 搜索：經過探測時以探測結果為準，否則按來源的 Google 標記
+func (p *Proxy) GoogleCapable() bool {
+	if p.GoogleProbe != "" {
+		return p.GoogleProbe == GooglePassed
+	}
+	return p.Google
+}
@@ -0,0 +1,43 @@
+package pool
+
+import "testing"
+
+func TestClassifyGoogleResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		location string
+		body     string
+		want     string
+	}{
+		{name: "results", status: 200, body: `<div id="search">weather</div>`, want: GooglePassed},
+		{name: "consent redirect", status: 302, location: "https://consent.google.com/ml?continue=x", want: GooglePassed},
+		{name: "sorry redirect", status: 302, location: "https://www.google.com/sorry/index?continue=x", want: GoogleCaptcha},
+		{name: "sorry page", status: 429, body: `<form action="/sorry/index">`, want: GoogleCaptcha},
+		{name: "captcha body", status: 200, body: "Our systems have detected Unusual Traffic from your computer", want: GoogleCaptcha},
+		{name: "forbidden", status: 403, want: GoogleBlocked},
+		{name: "rate limited", status: 429, want: GoogleBlocked},
+	}
+	for _, tt := range tests {
+		if got := classifyGoogleResponse(tt.status, tt.location, []byte(tt.body)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGoogleCapable(t *testing.T) {
+	tests := []struct {
+		proxy Proxy
+		want  bool
+	}{
+		{Proxy{}, false},
+		{Proxy{Google: true}, true},
+		{Proxy{Google: true, GoogleProbe: GoogleCaptcha}, false},
+		{Proxy{GoogleProbe: GooglePassed}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.proxy.GoogleCapable(); got != tt.want {
+			t.Errorf("GoogleCapable(google=%v, probe=%q) = %v, want %v", tt.proxy.Google, tt.proxy.GoogleProbe, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// historyPrefix 代理池統計快照鍵前綴，位於元數據命名空間下；鍵後綴為定長的納秒時間戳，按時間排序
+const historyPrefix = MetaPrefix + "history:"
+
+// unknownCountry 來源未提供國家的代理在快照中的國家代碼
+const unknownCountry = "unknown"
+
+// Snapshot 某一時刻的代理池統計
+type Snapshot struct {
+	Time    time.Time `json:"time"`
+	Total   int       `json:"total"`
+	Healthy int       `json:"healthy"`
+	Pending int       `json:"pending"` // 待驗證隊列中的候選代理數
+	// AvgLatencyMs 可用代理驗證響應時間的平均值（毫秒，沒有記錄時為 0）
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	// Countries 可用代理按國家的數量
+	Countries map[string]int `json:"countries,omitempty"`
+}
+
+// TakeSnapshot 統計代理列表；可用代理與選擇條件一致（見 Proxy.Usable）
+func TakeSnapshot(ps []*Proxy, pending int, now time.Time) Snapshot {
+	s := Snapshot{Time: now, Total: len(ps), Pending: pending, Countries: make(map[string]int)}
+	var latencySum, latencyCount int64
+	for _, p := range ps {
+		if !p.Usable() {
+			continue
+		}
+		s.Healthy++
+		country := p.Country
+		if country == "" {
+			country = unknownCountry
+		}
+		s.Countries[country]++
+		if p.LatencyMs > 0 {
+			latencySum += p.LatencyMs
+			latencyCount++
+		}
+	}
+	if latencyCount > 0 {
+		s.AvgLatencyMs = float64(latencySum) / float64(latencyCount)
+	}
+	return s
+}
+
+// historyKey 快照的鍵
+func historyKey(t time.Time) []byte {
+	return fmt.Appendf(nil, "%s%020d", historyPrefix, t.UnixNano())
+}
+
+// SaveSnapshot 保存快照，retention 之後由數據庫自動刪除（0 表示一直保留）
+func SaveSnapshot(db *badger.DB, s Snapshot, retention time.Duration) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	entry := badger.NewEntry(historyKey(s.Time), data)
+	if retention > 0 {
+		entry = entry.WithTTL(retention)
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(entry)
+	})
+}
+
+// LoadSnapshots 返回 since 起（含）到 until 前的快照，按時間先後排列；零值表示不限制
+func LoadSnapshots(db *badger.DB, since, until time.Time) ([]Snapshot, error) {
+	var list []Snapshot
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(historyPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		start, end := []byte(historyPrefix), []byte(nil)
+		if !since.IsZero() {
+			start = historyKey(since)
+		}
+		if !until.IsZero() {
+			end = historyKey(until)
+		}
+		for it.Seek(start); it.Valid(); it.Next() {
+			item := it.Item()
+			if end != nil && string(item.Key()) >= string(end) {
+				break
+			}
+			var s Snapshot
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &s)
+			}); err != nil {
+				return fmt.Errorf("invalid snapshot %s: %w", item.Key(), err)
+			}
+			list = append(list, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshots: %w", err)
+	}
+	return list, nil
+}
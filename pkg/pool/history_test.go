@@ -0,0 +1,73 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTakeSnapshot(t *testing.T) {
+	now := time.Now()
+	ps := []*Proxy{
+		{IP: "1.1.1.1", Port: "80", Updated: now, Country: "DE", LatencyMs: 100},
+		{IP: "1.1.1.2", Port: "80", Updated: now, Country: "DE", LatencyMs: 300},
+		{IP: "1.1.1.3", Port: "80", Updated: now},
+		{IP: "1.1.1.4", Port: "80", Updated: now, Country: "US", Disable: true, LatencyMs: 50},
+		{IP: "1.1.1.5", Port: "80", Country: "US"},
+	}
+	s := TakeSnapshot(ps, 7, now)
+	if s.Total != 5 || s.Healthy != 3 || s.Pending != 7 {
+		t.Errorf("total/healthy/pending = %d/%d/%d, want 5/3/7", s.Total, s.Healthy, s.Pending)
+	}
+	if s.AvgLatencyMs != 200 {
+		t.Errorf("avg latency = %v, want 200", s.AvgLatencyMs)
+	}
+	if len(s.Countries) != 2 || s.Countries["DE"] != 2 || s.Countries[unknownCountry] != 1 {
+		t.Errorf("countries = %v, want DE=2 unknown=1", s.Countries)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	db := newTestDB(t, &Proxy{IP: "1.1.1.1", Port: "80"})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		s := Snapshot{Time: base.Add(time.Duration(i) * time.Hour), Total: i}
+		if err := SaveSnapshot(db, s, 0); err != nil {
+			t.Fatalf("SaveSnapshot: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		since, until time.Time
+		want         []int
+	}{
+		{"all", time.Time{}, time.Time{}, []int{0, 1, 2, 3, 4}},
+		{"since", base.Add(3 * time.Hour), time.Time{}, []int{3, 4}},
+		{"range", base.Add(time.Hour), base.Add(3 * time.Hour), []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := LoadSnapshots(db, tt.since, tt.until)
+			if err != nil {
+				t.Fatalf("LoadSnapshots: %v", err)
+			}
+			var got []int
+			for _, s := range list {
+				got = append(got, s.Total)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("totals = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("totals = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// 快照鍵位於元數據命名空間，不會被當作代理記錄
+	if !IsMetaKey(historyKey(base)) {
+		t.Error("snapshot key should be a meta key")
+	}
+}
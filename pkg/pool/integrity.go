@@ -0,0 +1,80 @@
+package pool
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/e2u/dynamic-proxy/internal/fetcher"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+)
+
+// maxIntegrityBytes 完整性檢測下載的最大字節數，超出部分不計入校驗和（結果必然不一致）
+const maxIntegrityBytes = 10 << 20
+
+// checkIntegrity 經由代理下載完整性檢測資源，判斷代理是否篡改內容（注入頭部或廣告、TLS 剝離、替換證書）；
+// 未配置檢測或檢測無法完成（網絡錯誤、非 200 響應）時 ok 為 false，此時不應改變代理原有的標記
+func checkIntegrity(p *Proxy, policy ValidationPolicy) (tampering, ok bool) {
+	if len(policy.IntegrityChecks) == 0 {
+		return false, false
+	}
+
+	client := newProbeClient(p, policy.Timeout)
+	for _, check := range policy.IntegrityChecks {
+		reason, err := verifyIntegrity(client, check)
+		log := validatorLog.WithFields(logger.Fields{"proxy": p.String(), "url": check.URL})
+		if err != nil {
+			log.WithError(err).Debug("integrity check inconclusive")
+			return false, false
+		}
+		if reason != "" {
+			log.WithField("reason", reason).Warn("proxy tampers with content")
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// verifyIntegrity 經由 client 下載檢測資源，返回篡改原因（空表示內容未被修改）
+func verifyIntegrity(client *http.Client, check IntegrityCheck) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, check.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", fetcher.GetRandomUserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// 代理用自己的證書攔截 HTTPS
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) {
+			return "certificate replaced", nil
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 && strings.HasPrefix(strings.ToLower(check.URL), "https://") {
+		// 代理把 HTTPS 請求降級到明文地址
+		if loc, err := resp.Location(); err == nil && strings.EqualFold(loc.Scheme, "http") {
+			return "redirected to plain HTTP", nil
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, io.LimitReader(resp.Body, maxIntegrityBytes+1)); err != nil {
+		return "", err
+	}
+	if got := hex.EncodeToString(sum.Sum(nil)); !strings.EqualFold(got, check.SHA256) {
+		return "checksum mismatch", nil
+	}
+	return "", nil
+}
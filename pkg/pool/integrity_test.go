@@ -0,0 +1,60 @@
+package pool
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifyIntegrity(t *testing.T) {
+	const content = "console.log('known');"
+	sum := sha256.Sum256([]byte(content))
+	checksum := hex.EncodeToString(sum[:])
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/injected":
+			io.WriteString(w, content+"<script src=\"http://ads.example/a.js\"></script>")
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			io.WriteString(w, content)
+		}
+	}))
+	defer origin.Close()
+	stripped := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, origin.URL+"/known.js", http.StatusFound)
+	}))
+	defer stripped.Close()
+
+	noRedirect := func(client *http.Client) *http.Client {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		return client
+	}
+	tests := []struct {
+		name       string
+		client     *http.Client
+		url        string
+		wantReason string
+		wantErr    bool
+	}{
+		{name: "unmodified", client: noRedirect(&http.Client{}), url: origin.URL + "/known.js"},
+		{name: "injected", client: noRedirect(&http.Client{}), url: origin.URL + "/injected", wantReason: "checksum mismatch"},
+		{name: "not found", client: noRedirect(&http.Client{}), url: origin.URL + "/missing", wantErr: true},
+		{name: "tls stripped", client: noRedirect(stripped.Client()), url: stripped.URL + "/known.js", wantReason: "redirected to plain HTTP"},
+		{name: "certificate replaced", client: noRedirect(&http.Client{}), url: stripped.URL + "/known.js", wantReason: "certificate replaced"},
+	}
+
+	for _, tt := range tests {
+		reason, err := verifyIntegrity(tt.client, IntegrityCheck{URL: tt.url, SHA256: checksum})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if reason != tt.wantReason {
+			t.Errorf("%s: reason = %q, want %q", tt.name, reason, tt.wantReason)
+		}
+	}
+}
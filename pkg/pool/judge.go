@@ -0,0 +1,164 @@
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/fetcher"
+)
+
+// 匿名級別
+const (
+	AnonymityElite       = "elite"       // 目標看不到真實地址，也看不到經過了代理
+	AnonymityAnonymous   = "anonymous"   // 目標看不到真實地址，但能從頭部看出經過了代理
+	AnonymityTransparent = "transparent" // 目標能看到真實地址
+)
+
+// proxyHeaders 代理常添加的、暴露經過了代理的請求頭
+var proxyHeaders = []string{
+	"Via",
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Real-Ip",
+	"X-Client-Ip",
+	"Client-Ip",
+	"X-Proxy-Id",
+	"Proxy-Connection",
+	"X-Bluecoat-Via",
+}
+
+// judgeResponse 判定服務的響應：請求來源地址和收到的請求頭（與 httpbin.org/get 的格式兼容）
+type judgeResponse struct {
+	Origin  string            `json:"origin"` // 來源地址，經過轉發時為逗號分隔的地址鏈
+	Headers map[string]string `json:"headers"`
+}
+
+// Judgement 經由判定服務得到的代理出口地址和匿名級別
+type Judgement struct {
+	ExitIP    string
+	Anonymity string
+}
+
+// localOriginTTL 直連判定服務得到的本機出口地址的緩存時長
+const localOriginTTL = 10 * time.Minute
+
+var (
+	localOriginMu sync.Mutex
+	localOrigin   = make(map[string]localOriginEntry) // 判定服務 URL -> 本機出口地址
+)
+
+type localOriginEntry struct {
+	ips     []string
+	fetched time.Time
+}
+
+// fetchJudge 經由 client 請求判定服務
+func fetchJudge(client *http.Client, judgeURL string) (judgeResponse, error) {
+	var jr judgeResponse
+	req, err := http.NewRequest(http.MethodGet, judgeURL, nil)
+	if err != nil {
+		return jr, err
+	}
+	req.Header.Set("User-Agent", fetcher.GetRandomUserAgent())
+	resp, err := client.Do(req)
+	if err != nil {
+		return jr, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return jr, fmt.Errorf("judge returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&jr); err != nil {
+		return jr, fmt.Errorf("invalid judge response: %w", err)
+	}
+	return jr, nil
+}
+
+// localOriginIPs 直連判定服務得到的本機出口地址（按判定服務緩存），失敗時返回 nil
+func localOriginIPs(judgeURL string, timeout time.Duration) []string {
+	localOriginMu.Lock()
+	defer localOriginMu.Unlock()
+	if e, ok := localOrigin[judgeURL]; ok && time.Since(e.fetched) < localOriginTTL {
+		return e.ips
+	}
+	jr, err := fetchJudge(&http.Client{Timeout: timeout}, judgeURL)
+	if err != nil {
+		validatorLog.WithError(err).Warnf("failed to determine local address from judge %s", judgeURL)
+		return nil
+	}
+	ips := splitOrigin(jr.Origin)
+	localOrigin[judgeURL] = localOriginEntry{ips: ips, fetched: time.Now()}
+	return ips
+}
+
+// splitOrigin 拆分逗號分隔的來源地址鏈
+func splitOrigin(origin string) []string {
+	var ips []string
+	for _, ip := range strings.Split(origin, ",") {
+		if ip = strings.TrimSpace(ip); net.ParseIP(ip) != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// classifyAnonymity 根據判定服務收到的請求判斷出口地址和匿名級別：
+// 來源地址或任一請求頭含本機地址為 transparent，含暴露代理的請求頭為 anonymous，否則為 elite
+func classifyAnonymity(jr judgeResponse, localIPs []string) Judgement {
+	chain := splitOrigin(jr.Origin)
+	var j Judgement
+	if len(chain) > 0 {
+		// 轉發鏈的最後一個地址是實際連接判定服務的地址
+		j.ExitIP = chain[len(chain)-1]
+	}
+
+	for _, local := range localIPs {
+		if local == j.ExitIP {
+			// 出口地址就是本機，代理沒有生效（或在本機上）
+			continue
+		}
+		if strings.Contains(jr.Origin, local) {
+			j.Anonymity = AnonymityTransparent
+			return j
+		}
+		for _, v := range jr.Headers {
+			if strings.Contains(v, local) {
+				j.Anonymity = AnonymityTransparent
+				return j
+			}
+		}
+	}
+	for name := range jr.Headers {
+		for _, h := range proxyHeaders {
+			if strings.EqualFold(name, h) {
+				j.Anonymity = AnonymityAnonymous
+				return j
+			}
+		}
+	}
+	if len(chain) > 1 {
+		j.Anonymity = AnonymityAnonymous
+		return j
+	}
+	j.Anonymity = AnonymityElite
+	return j
+}
+
+// Judge 經由代理請求判定服務（policy.JudgeURL），返回代理的出口地址和匿名級別
+func Judge(p *Proxy, policy ValidationPolicy) (Judgement, error) {
+	if policy.JudgeURL == "" {
+		return Judgement{}, fmt.Errorf("no judge URL configured")
+	}
+	jr, err := fetchJudge(newProbeClient(p, policy.Timeout), policy.JudgeURL)
+	if err != nil {
+		return Judgement{}, err
+	}
+	return classifyAnonymity(jr, localOriginIPs(policy.JudgeURL, policy.Timeout)), nil
+}
@@ -0,0 +1,37 @@
+package pool
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+)
+
+// JudgeHandler 自建判定服務：/generate_204 返回 204，可作為通用檢測 URL（ValidationPolicy.TestURLs）；
+// 其他路徑返回請求來源地址和收到的請求頭（與 httpbin.org/get 格式兼容），可作為 ValidationPolicy.JudgeURL。
+// 來源地址取自 TCP 連接，不信任任何轉發頭部，轉發頭部原樣出現在 headers 中供判斷匿名級別
+func JudgeHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/generate_204", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		jr := judgeResponse{Origin: r.RemoteAddr, Headers: make(map[string]string, len(r.Header)+1)}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			jr.Origin = host
+		}
+		for name, values := range r.Header {
+			if len(values) > 0 {
+				jr.Headers[name] = values[0]
+			}
+		}
+		jr.Headers["Host"] = r.Host
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(jr)
+	})
+	return mux
+}
@@ -0,0 +1,53 @@
+package pool
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJudgeHandler(t *testing.T) {
+	srv := httptest.NewServer(JudgeHandler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/generate_204")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("/generate_204 status = %d, want 204", resp.StatusCode)
+	}
+
+	jr, err := fetchJudge(srv.Client(), srv.URL+"/get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jr.Origin != "127.0.0.1" {
+		t.Errorf("origin = %q, want 127.0.0.1", jr.Origin)
+	}
+	if jr.Headers["User-Agent"] == "" || jr.Headers["Host"] == "" {
+		t.Errorf("headers = %v, want User-Agent and Host", jr.Headers)
+	}
+	if j := classifyAnonymity(jr, []string{"192.0.2.1"}); j.ExitIP != "127.0.0.1" || j.Anonymity != AnonymityElite {
+		t.Errorf("judgement = %+v, want elite via 127.0.0.1", j)
+	}
+
+	// 代理添加的轉發頭部原樣返回
+	jr, err = fetchJudge(&http.Client{Transport: headerTransport{"X-Forwarded-For", "192.0.2.1"}}, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j := classifyAnonymity(jr, []string{"192.0.2.1"}); j.Anonymity != AnonymityTransparent {
+		t.Errorf("anonymity = %q, want transparent", j.Anonymity)
+	}
+}
+
+// headerTransport 給每個請求添加一個請求頭，模擬透明代理
+type headerTransport [2]string
+
+func (h headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(h[0], h[1])
+	return http.DefaultTransport.RoundTrip(req)
+}
@@ -0,0 +1,77 @@
+package pool
+
+import "testing"
+
+func TestClassifyAnonymity(t *testing.T) {
+	local := []string{"203.0.113.7"}
+	tests := []struct {
+		name          string
+		resp          judgeResponse
+		wantExit      string
+		wantAnonymity string
+	}{
+		{
+			name:          "elite",
+			resp:          judgeResponse{Origin: "198.51.100.1", Headers: map[string]string{"Host": "judge", "User-Agent": "x"}},
+			wantExit:      "198.51.100.1",
+			wantAnonymity: AnonymityElite,
+		},
+		{
+			name:          "via header",
+			resp:          judgeResponse{Origin: "198.51.100.1", Headers: map[string]string{"Via": "1.1 squid"}},
+			wantExit:      "198.51.100.1",
+			wantAnonymity: AnonymityAnonymous,
+		},
+		{
+			name:          "forwarded for another address",
+			resp:          judgeResponse{Origin: "10.0.0.1, 198.51.100.1", Headers: map[string]string{}},
+			wantExit:      "198.51.100.1",
+			wantAnonymity: AnonymityAnonymous,
+		},
+		{
+			name:          "real address in origin",
+			resp:          judgeResponse{Origin: "203.0.113.7, 198.51.100.1", Headers: map[string]string{"X-Forwarded-For": "203.0.113.7"}},
+			wantExit:      "198.51.100.1",
+			wantAnonymity: AnonymityTransparent,
+		},
+		{
+			name:          "real address in custom header",
+			resp:          judgeResponse{Origin: "198.51.100.1", Headers: map[string]string{"X-Origin": "203.0.113.7"}},
+			wantExit:      "198.51.100.1",
+			wantAnonymity: AnonymityTransparent,
+		},
+	}
+	for _, tt := range tests {
+		j := classifyAnonymity(tt.resp, local)
+		if j.ExitIP != tt.wantExit || j.Anonymity != tt.wantAnonymity {
+			t.Errorf("%s: got %+v, want exit %s anonymity %s", tt.name, j, tt.wantExit, tt.wantAnonymity)
+		}
+	}
+}
+
+func TestParseCandidate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Proxy
+		wantErr bool
+	}{
+		{in: "1.2.3.4:8080", want: Proxy{IP: "1.2.3.4", Port: "8080", Protocol: "http"}},
+		{in: " socks5://u:p@1.2.3.4:1080 ", want: Proxy{IP: "1.2.3.4", Port: "1080", Protocol: "socks5", User: "u", Pass: "p"}},
+		{in: "[2001:db8::1]:3128", want: Proxy{IP: "2001:db8::1", Port: "3128", Protocol: "http"}},
+		{in: "1.2.3.4", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		p, err := ParseCandidate(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCandidate(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if p.IP != tt.want.IP || p.Port != tt.want.Port || p.Protocol != tt.want.Protocol || p.User != tt.want.User || p.Pass != tt.want.Pass {
+			t.Errorf("ParseCandidate(%q) = %+v, want %+v", tt.in, *p, tt.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package pool
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// knownBadPrefix 最近首次驗證即失敗的候選代理（鍵後綴為 ip:port），記錄按 ValidationPolicy.KnownBadTTL 自動過期
+const knownBadPrefix = MetaPrefix + "bad:"
+
+// ErrKnownBad 候選代理最近首次驗證即失敗，在 ValidationPolicy.KnownBadTTL 內再次採集到時不再寫入
+var ErrKnownBad = errors.New("proxy failed validation recently")
+
+func knownBadKey(key string) []byte {
+	return []byte(knownBadPrefix + key)
+}
+
+// markKnownBad 記錄代理 key 首次驗證失敗，ttl 後自動過期
+func markKnownBad(txn *badger.Txn, key string, ttl time.Duration) error {
+	v, _ := time.Now().MarshalBinary()
+	return txn.SetEntry(badger.NewEntry(knownBadKey(key), v).WithTTL(ttl))
+}
+
+// isKnownBad 代理 key 是否在已知失敗記錄中（未過期）
+func isKnownBad(txn *badger.Txn, key string) (bool, error) {
+	_, err := txn.Get(knownBadKey(key))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// KnownBadCount 統計未過期的已知失敗記錄數
+func KnownBadCount(db *badger.DB) (int, error) {
+	n := 0
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(knownBadPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
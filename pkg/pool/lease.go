@@ -0,0 +1,64 @@
+package pool
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// leasePrefix 租約記錄（鍵後綴為租約名稱），值為持有者，按授予時的 ttl 自動過期
+const leasePrefix = MetaPrefix + "lease:"
+
+func leaseKey(name string) []byte {
+	return []byte(leasePrefix + name)
+}
+
+// GrantLease 把名為 name 的租約授予 holder，ttl 後自動過期：租約空閒、已過期或已由 holder 持有時授予並重新計時（續約），
+// 由其他持有者持有時不授予。返回是否授予及當前的持有者
+func GrantLease(db *badger.DB, name, holder string, ttl time.Duration) (granted bool, current string, err error) {
+	err = db.Update(func(txn *badger.Txn) error {
+		granted, current = false, ""
+		item, err := txn.Get(leaseKey(name))
+		switch {
+		case errors.Is(err, badger.ErrKeyNotFound):
+		case err != nil:
+			return err
+		default:
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if current = string(v); current != holder {
+				return nil
+			}
+		}
+		granted, current = true, holder
+		return txn.SetEntry(badger.NewEntry(leaseKey(name), []byte(holder)).WithTTL(ttl))
+	})
+	if err != nil {
+		return false, "", err
+	}
+	return granted, current, nil
+}
+
+// ReleaseLease 由 holder 持有時釋放名為 name 的租約，其他成員無需等待過期即可獲得；返回是否釋放
+func ReleaseLease(db *badger.DB, name, holder string) (bool, error) {
+	released := false
+	err := db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(leaseKey(name))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		v, err := item.ValueCopy(nil)
+		if err != nil || string(v) != holder {
+			return err
+		}
+		released = true
+		return txn.Delete(leaseKey(name))
+	})
+	return released, err
+}
@@ -0,0 +1,44 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGrantLease(t *testing.T) {
+	db := newTestDB(t)
+	grant := func(holder string, ttl time.Duration) (bool, string) {
+		t.Helper()
+		granted, current, err := GrantLease(db, "jobs", holder, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return granted, current
+	}
+
+	if granted, current := grant("a", time.Minute); !granted || current != "a" {
+		t.Fatalf("free lease: granted %v to %q", granted, current)
+	}
+	if granted, current := grant("b", time.Minute); granted || current != "a" {
+		t.Errorf("held lease: granted %v, holder %q; want a to keep it", granted, current)
+	}
+	if granted, _ := grant("a", time.Second); !granted {
+		t.Error("holder should be able to renew")
+	}
+
+	// 續約後按新的 ttl 過期，其他成員隨即可以獲得
+	time.Sleep(1100 * time.Millisecond)
+	if granted, _ := grant("b", time.Minute); !granted {
+		t.Error("expired lease should be granted to another holder")
+	}
+
+	if released, err := ReleaseLease(db, "jobs", "a"); err != nil || released {
+		t.Errorf("release by non-holder = %v, %v; want false", released, err)
+	}
+	if released, err := ReleaseLease(db, "jobs", "b"); err != nil || !released {
+		t.Errorf("release by holder = %v, %v; want true", released, err)
+	}
+	if granted, _ := grant("a", time.Minute); !granted {
+		t.Error("released lease should be granted")
+	}
+}
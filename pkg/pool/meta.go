@@ -0,0 +1,49 @@
+package pool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// MetaPrefix 運行元數據鍵前綴，與代理記錄共用同一數據庫
+const MetaPrefix = "_meta:"
+
+// IsMetaKey 判斷是否為元數據鍵（含尚未遷移的舊版統計鍵），遍歷代理記錄時應跳過
+func IsMetaKey(key []byte) bool {
+	return strings.HasPrefix(string(key), MetaPrefix) || isLegacyStatsKey(key)
+}
+
+// SaveMeta 以 JSON 形式保存一條元數據
+func SaveMeta(db *badger.DB, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal meta %s: %w", name, err)
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(MetaPrefix+name), data)
+	})
+}
+
+// LoadMeta 讀取一條元數據到 v，不存在時返回 false
+func LoadMeta(db *badger.DB, name string, v any) (bool, error) {
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(MetaPrefix + name))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, v)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load meta %s: %w", name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,167 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// 使用 sync.Pool 為每個 goroutine 提供獨立的 rand.Rand 實例
+var randPool = sync.Pool{
+	New: func() any {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	},
+}
+
+func getRand() *rand.Rand {
+	return randPool.Get().(*rand.Rand)
+}
+
+func putRand(r *rand.Rand) {
+	randPool.Put(r)
+}
+
+// ErrNoProxies 數據庫中沒有滿足條件的可用代理
+var ErrNoProxies = errors.New("no available proxies in database")
+
+// ErrProxyNotFound 指定的代理不存在
+var ErrProxyNotFound = errors.New("proxy not found")
+
+// Pool 基於 badger 數據庫的代理池
+type Pool struct {
+	db       *badger.DB
+	strategy string
+	hooks    Hooks
+}
+
+// Options 代理池選項
+type Options struct {
+	Strategy string // 代理選擇策略（random, throughput, score）
+	Hooks    Hooks  // 代理生命週期回調
+}
+
+type Option func(options *Options)
+
+// WithStrategy 設置代理選擇策略（random, throughput, score）
+func WithStrategy(strategy string) Option {
+	return func(options *Options) {
+		options.Strategy = strategy
+	}
+}
+
+// New 創建代理池，db 中的鍵為 ip:port，值為 Proxy 的 JSON
+func New(db *badger.DB, opts ...Option) *Pool {
+	cfg := &Options{Strategy: StrategyRandom}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return &Pool{db: db, strategy: cfg.Strategy, hooks: cfg.Hooks}
+}
+
+// DB 返回底層數據庫
+func (pl *Pool) DB() *badger.DB {
+	return pl.db
+}
+
+// Select 從數據庫中隨機選擇一個滿足條件的代理（使用蓄水池抽樣，不加载所有代理到内存）
+func (pl *Pool) Select(criteria Criteria) (*Proxy, error) {
+	start := time.Now()
+	p, err := pl.selectFromDB(criteria)
+	selectionDuration.Observe(time.Since(start).Seconds(), selectionResult(err))
+	return p, err
+}
+
+// selectFromDB 按選擇策略遍歷數據庫選擇代理
+func (pl *Pool) selectFromDB(criteria Criteria) (*Proxy, error) {
+	poolLog.Debugf("Select: start")
+	if pl.db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var selectedProxy *Proxy
+	count := 0
+	bestWeight := -1.0
+
+	r := getRand()
+	defer putRand(r)
+	now := time.Now()
+	halfLife := CurrentValidationPolicy().ScoreHalfLife
+
+	err := pl.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 100
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if IsMetaKey(item.Key()) {
+				continue
+			}
+			err := item.Value(func(val []byte) error {
+				p, err := LoadFromJSON(val)
+				if err != nil {
+					storeLog.Warnf("failed to parse proxy from DB: %v", err)
+					return nil // 跳過損壞的條目
+				}
+				// 只選擇未禁用、已更新且滿足篩選條件的代理
+				if p.Usable() && criteria.Match(p) {
+					count++
+					switch pl.strategy {
+					case StrategyThroughput:
+						// 加權蓄水池抽樣（A-Res）：吞吐量和健康評分越高被選中概率越大
+						weight := math.Max(p.SpeedKBps, 1) * math.Max(p.ScoreAt(now, halfLife), minWeight)
+						if w := weightedKey(r.Float64(), weight); w > bestWeight {
+							bestWeight = w
+							selectedProxy = p
+						}
+					case StrategyScore:
+						if w := weightedKey(r.Float64(), math.Max(p.ScoreAt(now, halfLife), minWeight)); w > bestWeight {
+							bestWeight = w
+							selectedProxy = p
+						}
+					default:
+						// 蓄水池抽樣：以 1/count 的概率選擇當前代理
+						if r.Intn(count) == 0 {
+							selectedProxy = p
+						}
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				poolLog.Errorf("Select: value iteration error: %v", err)
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	poolLog.Debugf("Select: found %d proxies", count)
+
+	if count == 0 {
+		if len(criteria.Sites) > 0 {
+			return nil, fmt.Errorf("%w for sites %v", ErrNoProxies, criteria.Sites)
+		}
+		return nil, ErrNoProxies
+	}
+
+	return selectedProxy, nil
+}
+
+// minWeight 加權選擇時健康評分的下限，評分接近 0 的代理仍有被選中的機會
+const minWeight = 0.01
+
+// weightedKey 加權蓄水池抽樣的排序鍵 u^(1/w)
+func weightedKey(u, weight float64) float64 {
+	return math.Pow(u, 1/weight)
+}
@@ -0,0 +1,258 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// newTestDB 創建內存數據庫並寫入代理
+func newTestDB(t *testing.T, proxies ...*Proxy) *badger.DB {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open badger: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, p := range proxies {
+		if err := db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte(p.Key()), p.DumpJSON())
+		}); err != nil {
+			t.Fatalf("seed proxy: %v", err)
+		}
+	}
+	return db
+}
+
+func TestSelect(t *testing.T) {
+	now := time.Now()
+	db := newTestDB(t,
+		&Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: now, Sites: []string{"google"}, Country: "US", Anonymity: "elite"},
+		&Proxy{IP: "2.2.2.2", Port: "80", Protocol: "http", Updated: now, Disable: true, Sites: []string{"amazon"}},
+		&Proxy{IP: "3.3.3.3", Port: "80", Protocol: "http"},
+		&Proxy{IP: "4.4.4.4", Port: "80", Protocol: "http", Updated: now, Tampering: true},
+		&Proxy{IP: "5.5.5.5", Port: "80", Protocol: "http", Updated: now, Disable: true, Tags: []string{"paid"}},
+	)
+	pl := New(db)
+
+	tests := []struct {
+		name     string
+		criteria Criteria
+		wantIP   string
+		wantErr  error
+	}{
+		{name: "any", criteria: NewCriteria(), wantIP: "1.1.1.1"},
+		{name: "site", criteria: NewCriteria(" Google "), wantIP: "1.1.1.1"},
+		{name: "disabled only", criteria: NewCriteria("amazon"), wantErr: ErrNoProxies},
+		{name: "excluded network", criteria: Criteria{ExcludeNetworks: map[string]bool{"1.1.0.0/16": true}}, wantErr: ErrNoProxies},
+		{name: "excluded proxy", criteria: Criteria{Exclude: map[string]bool{"1.1.1.1:80": true}}, wantErr: ErrNoProxies},
+		{name: "country and anonymity", criteria: Criteria{Countries: []string{"us", "CA"}, Anonymity: []string{"elite"}}, wantIP: "1.1.1.1"},
+		{name: "other country", criteria: Criteria{Countries: []string{"DE"}}, wantErr: ErrNoProxies},
+		{name: "protocol", criteria: Criteria{Protocols: []string{"socks5"}}, wantErr: ErrNoProxies},
+		{name: "tag", criteria: Criteria{Tags: []string{"paid"}}, wantErr: ErrNoProxies},
+		{name: "google", criteria: Criteria{Google: true}, wantErr: ErrNoProxies},
+		{name: "allow tampering", criteria: Criteria{Exclude: map[string]bool{"1.1.1.1:80": true}, AllowTampering: true}, wantIP: "4.4.4.4"},
+	}
+
+	for _, tt := range tests {
+		p, err := pl.Select(tt.criteria)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if p.IP != tt.wantIP {
+			t.Errorf("%s: selected %s, want %s", tt.name, p.IP, tt.wantIP)
+		}
+	}
+}
+
+func TestUsable(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		p    Proxy
+		want bool
+	}{
+		{"validated", Proxy{Updated: now}, true},
+		{"never validated", Proxy{}, false},
+		{"disabled", Proxy{Updated: now, Disable: true}, false},
+		{"disabled before validation", Proxy{Disable: true}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Usable(); got != tt.want {
+			t.Errorf("%s: Usable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsLegacyKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"1.2.3.4:8080":          false,
+		"[2001:db8::1]:1080":    false,
+		"http://1.2.3.4:8080":   true,
+		"socks5://1.2.3.4:1080": true,
+		"_meta:run":             false,
+	} {
+		if got := IsLegacyKey([]byte(key)); got != want {
+			t.Errorf("IsLegacyKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestPreferOver(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		p, o Proxy
+		want bool
+	}{
+		{"enabled over disabled", Proxy{Updated: now.Add(-time.Hour)}, Proxy{Updated: now, Disable: true}, true},
+		{"disabled under enabled", Proxy{Updated: now, Disable: true}, Proxy{Updated: now.Add(-time.Hour)}, false},
+		{"newer validation", Proxy{Updated: now}, Proxy{Updated: now.Add(-time.Hour)}, true},
+		{"older validation", Proxy{Updated: now.Add(-time.Hour)}, Proxy{Updated: now}, false},
+		{"same validation time", Proxy{Updated: now}, Proxy{Updated: now}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.p.PreferOver(&tt.o); got != tt.want {
+			t.Errorf("%s: PreferOver = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSelectByScore(t *testing.T) {
+	now := time.Now()
+	db := newTestDB(t,
+		&Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: now, Score: 0.95, ScoredAt: now},
+		&Proxy{IP: "2.2.2.2", Port: "80", Protocol: "http", Updated: now, Score: 0.01, ScoredAt: now},
+	)
+	pl := New(db, WithStrategy(StrategyScore))
+
+	picked := 0
+	for range 200 {
+		p, err := pl.Select(NewCriteria())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.IP == "1.1.1.1" {
+			picked++
+		}
+	}
+	if picked < 180 {
+		t.Errorf("high score proxy selected %d/200 times, want most", picked)
+	}
+}
+
+func TestSelectByThroughput(t *testing.T) {
+	now := time.Now()
+	db := newTestDB(t,
+		&Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: now, Score: 0.9, ScoredAt: now, SpeedKBps: 2000},
+		&Proxy{IP: "2.2.2.2", Port: "80", Protocol: "http", Updated: now, Score: 0.9, ScoredAt: now, SpeedKBps: 20},
+	)
+	pickFast := func(strategy string) int {
+		pl := New(db, WithStrategy(strategy))
+		picked := 0
+		for range 200 {
+			p, err := pl.Select(NewCriteria())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.IP == "1.1.1.1" {
+				picked++
+			}
+		}
+		return picked
+	}
+
+	// 評分相同時按吞吐量加權，快的代理被選中的概率約為 100:1
+	if picked := pickFast(StrategyThroughput); picked < 180 {
+		t.Errorf("fast proxy selected %d/200 times with throughput strategy, want most", picked)
+	}
+	if picked := pickFast(StrategyRandom); picked > 150 {
+		t.Errorf("fast proxy selected %d/200 times with random strategy, want about half", picked)
+	}
+}
+
+func TestGetTransport(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+
+	// direct 協議的代理直接連接目標，用於驗證 Transport 的選擇和撥號流程
+	db := newTestDB(t, &Proxy{IP: "127.0.0.1", Port: "1", Protocol: "direct", Updated: time.Now()})
+	client := &http.Client{Transport: New(db).GetTransport()}
+
+	resp, err := client.Get(target.URL)
+	if err != nil {
+		t.Fatalf("request through pool transport: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "ok" {
+		t.Errorf("body = %q, want ok", body)
+	}
+
+	empty := &http.Client{Transport: New(newTestDB(t)).GetTransport()}
+	if _, err := empty.Get(target.URL); !errors.Is(err, ErrNoProxies) {
+		t.Errorf("empty pool err = %v, want ErrNoProxies", err)
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	ctx := context.Background()
+	if got, err := resolveTarget(ctx, ResolveRemote, "localhost:443"); err != nil || got != "localhost:443" {
+		t.Errorf("remote: got %q, %v; want the hostname unchanged", got, err)
+	}
+	if got, err := resolveTarget(ctx, ResolveLocal, "192.0.2.1:80"); err != nil || got != "192.0.2.1:80" {
+		t.Errorf("local IP: got %q, %v", got, err)
+	}
+	got, err := resolveTarget(ctx, ResolveLocal, "localhost:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(got)
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() || port != "443" {
+		t.Errorf("local: got %q, want a loopback address", got)
+	}
+}
+
+func TestMeta(t *testing.T) {
+	p := &Proxy{IP: "127.0.0.1", Port: "8080", Protocol: "direct", Updated: time.Now()}
+	db := newTestDB(t, p)
+
+	var got struct{ Version string }
+	if ok, err := LoadMeta(db, "run", &got); err != nil || ok {
+		t.Fatalf("LoadMeta on empty db = %v, %v; want false, nil", ok, err)
+	}
+	if err := SaveMeta(db, "run", struct{ Version string }{"v1.2.3"}); err != nil {
+		t.Fatalf("SaveMeta: %v", err)
+	}
+	if ok, err := LoadMeta(db, "run", &got); err != nil || !ok || got.Version != "v1.2.3" {
+		t.Fatalf("LoadMeta = %v, %v, %+v", ok, err, got)
+	}
+
+	// 元數據鍵不應被當作代理選中
+	for range 20 {
+		sel, err := New(db).Select(Criteria{})
+		if err != nil {
+			t.Fatalf("Select: %v", err)
+		}
+		if sel.Key() != p.Key() {
+			t.Fatalf("Select returned %s, want %s", sel.Key(), p.Key())
+		}
+	}
+}
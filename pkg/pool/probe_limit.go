@@ -0,0 +1,174 @@
+package pool
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// targetGroupTTL 檢測目標主機解析到的網段的緩存時長
+const targetGroupTTL = 10 * time.Minute
+
+// probeLimiter 限制驗證探測的發出速率：全局速率（ValidationPolicy.ProbeRate）和每個檢測目標網段的速率
+// （ValidationPolicy.ProbeTargetRate，同一 IPv4 /24 或 IPv6 /48 內的主機共用配額），以及每次探測前的隨機延遲；
+// 避免大量驗證同時請求同一批檢測地址觸發限速而誤判代理失效
+type probeLimiter struct {
+	mu      sync.Mutex
+	global  time.Time            // 全局下一個可用時刻
+	targets map[string]time.Time // 每個目標網段下一個可用時刻
+	groups  map[string]targetGroup
+}
+
+// targetGroup 主機所屬網段的緩存
+type targetGroup struct {
+	network string
+	expires time.Time
+}
+
+var probeLimits = newProbeLimiter()
+
+func newProbeLimiter() *probeLimiter {
+	return &probeLimiter{
+		targets: make(map[string]time.Time),
+		groups:  make(map[string]targetGroup),
+	}
+}
+
+// network24 返回 IP 所在的 /24 網段（IPv6 為 /48），不是 IP 時原樣返回
+func network24(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// group 返回檢測地址的主機所在網段（主機名按解析結果的第一個地址，解析失敗時為主機名本身）
+func (l *probeLimiter) group(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) != nil {
+		return network24(host)
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	g, ok := l.groups[host]
+	l.mu.Unlock()
+	if ok && now.Before(g.expires) {
+		return g.network
+	}
+
+	network := host
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host); err == nil && len(addrs) > 0 {
+		network = network24(addrs[0].IP.String())
+	}
+	l.mu.Lock()
+	l.groups[host] = targetGroup{network: network, expires: now.Add(targetGroupTTL)}
+	l.mu.Unlock()
+	return network
+}
+
+// wait 按策略等待隨機延遲和速率配額後返回，ctx 結束時提前返回其錯誤
+func (l *probeLimiter) wait(ctx context.Context, target string, policy ValidationPolicy) error {
+	var delay time.Duration
+	if policy.ProbeJitter > 0 {
+		r := getRand()
+		delay = time.Duration(r.Int63n(int64(policy.ProbeJitter) + 1))
+		putRand(r)
+	}
+
+	if policy.ProbeRate > 0 || policy.ProbeTargetRate > 0 {
+		var network string
+		if policy.ProbeTargetRate > 0 {
+			network = l.group(target)
+		}
+
+		l.mu.Lock()
+		slot := time.Now().Add(delay)
+		if policy.ProbeRate > 0 && l.global.After(slot) {
+			slot = l.global
+		}
+		if policy.ProbeTargetRate > 0 {
+			if next := l.targets[network]; next.After(slot) {
+				slot = next
+			}
+			l.targets[network] = slot.Add(rateInterval(policy.ProbeTargetRate))
+		}
+		if policy.ProbeRate > 0 {
+			l.global = slot.Add(rateInterval(policy.ProbeRate))
+		}
+		l.mu.Unlock()
+		delay = time.Until(slot)
+	}
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pickURL 從列表中選擇一個檢測 URL（onlyHTTPS 為 true 時只選擇 https URL）：
+// 未限制每個目標的速率時隨機選擇，否則在當前仍有配額的目標網段中隨機選擇，都沒有配額時選擇最早恢復配額的
+func (l *probeLimiter) pickURL(urls []string, onlyHTTPS bool, policy ValidationPolicy) string {
+	if policy.ProbeTargetRate <= 0 {
+		return randomURL(urls, onlyHTTPS)
+	}
+
+	var candidates []string
+	for _, u := range urls {
+		if !onlyHTTPS || strings.HasPrefix(strings.ToLower(u), "https://") {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	networks := make([]string, len(candidates))
+	for i, u := range candidates {
+		networks[i] = l.group(u)
+	}
+
+	now := time.Now()
+	var ready []string
+	earliest := ""
+	var earliestAt time.Time
+	l.mu.Lock()
+	for i, u := range candidates {
+		next := l.targets[networks[i]]
+		if !next.After(now) {
+			ready = append(ready, u)
+		} else if earliest == "" || next.Before(earliestAt) {
+			earliest, earliestAt = u, next
+		}
+	}
+	l.mu.Unlock()
+
+	if len(ready) > 0 {
+		return randomURL(ready, false)
+	}
+	return earliest
+}
+
+// rateInterval 每秒 rate 次對應的間隔
+func rateInterval(rate float64) time.Duration {
+	return time.Duration(float64(time.Second) / rate)
+}
@@ -0,0 +1,79 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNetwork24(t *testing.T) {
+	tests := map[string]string{
+		"1.2.3.4":         "1.2.3.0/24",
+		"2001:db8:1:2::1": "2001:db8:1::/48",
+		"www.gstatic.com": "www.gstatic.com",
+		"203.0.113.255":   "203.0.113.0/24",
+	}
+	for ip, want := range tests {
+		if got := network24(ip); got != want {
+			t.Errorf("network24(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestProbeLimiterTargetRate(t *testing.T) {
+	l := newProbeLimiter()
+	policy := ValidationPolicy{ProbeTargetRate: 20}
+
+	// 同一 /24 的兩個地址共用配額：4 次請求至少間隔 3 個 50ms
+	start := time.Now()
+	for _, target := range []string{"http://192.0.2.1/", "http://192.0.2.2/", "http://192.0.2.1/", "http://192.0.2.2/"} {
+		if err := l.wait(context.Background(), target, policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("4 probes to one /24 took %v, want >= 150ms", elapsed)
+	}
+
+	// 另一網段不受影響
+	start = time.Now()
+	if err := l.wait(context.Background(), "http://198.51.100.1/", policy); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("probe to another /24 waited %v", elapsed)
+	}
+}
+
+func TestProbeLimiterPickURL(t *testing.T) {
+	l := newProbeLimiter()
+	policy := ValidationPolicy{ProbeTargetRate: 1}
+	urls := []string{"http://192.0.2.1/generate_204", "https://198.51.100.1/generate_204"}
+
+	first := l.pickURL(urls, false, policy)
+	if err := l.wait(context.Background(), first, policy); err != nil {
+		t.Fatal(err)
+	}
+	// 用完配額的目標網段暫不選擇
+	for range 10 {
+		if got := l.pickURL(urls, false, policy); got == first {
+			t.Fatalf("pickURL returned %s without quota", got)
+		}
+	}
+	if got := l.pickURL(urls[:1], true, policy); got != "" {
+		t.Errorf("pickURL(onlyHTTPS) = %q, want empty", got)
+	}
+}
+
+func TestProbeLimiterContext(t *testing.T) {
+	l := newProbeLimiter()
+	policy := ValidationPolicy{ProbeRate: 0.1}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx, "http://192.0.2.1/", policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.wait(ctx, "http://192.0.2.1/", policy); err == nil {
+		t.Error("wait should stop when the context is done")
+	}
+}
@@ -0,0 +1,659 @@
+package pool
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+)
+
+type Proxy struct {
+	IP       string    `json:"ip"`
+	Port     string    `json:"port"`
+	Protocol string    `json:"protocol"`
+	Disable  bool      `json:"disable"` // 健康評分低於 ValidationPolicy.ScoreExclude，不參與選擇
+	Updated  time.Time `json:"updated"`
+	Count    int64     `json:"count"`
+	Type     string    `json:"type"`
+	Addr     string    `json:"addr"`
+	User     string    `json:"user"`
+	Pass     string    `json:"pass"`
+	// Sites 通過探測的目標站點標籤（如 google, amazon）
+	Sites []string `json:"sites,omitempty"`
+	// SpeedKBps 測速得到的下載吞吐量（KB/s，0 表示未測速）
+	SpeedKBps float64 `json:"speed_kbps,omitempty"`
+	// LatencyMs 最近一次通過驗證時首個檢測請求的響應時間（毫秒）
+	LatencyMs int64 `json:"latency_ms,omitempty"`
+	// Country 來源提供的國家代碼（ISO 3166-1 alpha-2，如 US）
+	Country string `json:"country,omitempty"`
+	// Anonymity 來源提供的匿名級別：transparent, anonymous, elite
+	Anonymity string `json:"anonymity,omitempty"`
+	// Google 來源標明可訪問 Google（未經本地探測）
+	Google bool `json:"google,omitempty"`
+	// GoogleProbe 經由代理請求 Google 搜索的探測結果：passed, captcha, blocked（空表示未探測）
+	GoogleProbe string `json:"google_probe,omitempty"`
+	// HTTPS 來源標明支持 HTTPS 目標（CONNECT，未經本地探測）
+	HTTPS bool `json:"https,omitempty"`
+	// Source 最先提供該代理的來源 URL
+	Source string `json:"source,omitempty"`
+	// Added 首次入庫時間
+	Added time.Time `json:"added,omitzero"`
+	// Streak 連續通過驗證的次數，失敗時歸零
+	Streak int `json:"streak,omitempty"`
+	// NextCheck 下次重新驗證的時間（零值表示立即）
+	NextCheck time.Time `json:"next_check,omitzero"`
+	// Score 最近一次驗證後的健康評分（0–1），當前評分按時間衰減，見 ScoreAt
+	Score float64 `json:"score"`
+	// ScoredAt 最近一次更新健康評分的時間
+	ScoredAt time.Time `json:"scored_at,omitzero"`
+	// DisabledAt 因驗證失敗被禁用的時間，恢復可用時清零
+	DisabledAt time.Time `json:"disabled_at,omitzero"`
+	// ManualDisable 經由管理 API 手動禁用：驗證通過也不恢復可用，清理時不按隔離期刪除，直到手動啟用
+	ManualDisable bool `json:"manual_disable,omitempty"`
+	// TLS 經由代理與 HTTPS 目標完成了 TLS 握手（端到端可用，而不只是接受 CONNECT）
+	TLS bool `json:"tls,omitempty"`
+	// TLSVersion 探測時協商的 TLS 版本（如 TLS 1.3）
+	TLSVersion string `json:"tls_version,omitempty"`
+	// TLSHandshakeMs 探測時 TLS 握手耗時（毫秒，不含建立隧道）
+	TLSHandshakeMs int64 `json:"tls_handshake_ms,omitempty"`
+	// UDP SOCKS5 代理支持 UDP ASSOCIATE（經由中繼完成了一次 DNS 查詢）
+	UDP bool `json:"udp,omitempty"`
+	// Tags 自定義標籤（如 datacenter、residential、paid），經由管理 API 或來源配置設置，選擇時可按標籤篩選
+	Tags []string `json:"tags,omitempty"`
+	// Tampering 代理篡改響應內容（完整性檢測或請求鏡像發現），預設不參與選擇
+	Tampering bool `json:"tampering,omitempty"`
+}
+
+func (p *Proxy) Address() string {
+	return fmt.Sprintf("%s://%s:%s", p.Protocol, p.IP, p.Port)
+}
+
+func (p *Proxy) String() string {
+	return fmt.Sprintf("%s://%s:%s", p.Protocol, p.IP, p.Port)
+}
+
+// Usable 代理是否可用（參與選擇）：未禁用且已通過驗證，從未驗證過的候選代理不算可用
+func (p *Proxy) Usable() bool {
+	return !p.Disable && !p.Updated.IsZero()
+}
+
+// Key 返回代理在數據庫中的規範鍵（ip:port），協議只作為值屬性保存
+// 這樣同一個 ip:port 不會因協議重新探測而出現多條記錄
+func (p *Proxy) Key() string {
+	return KeyOf(p.IP, p.Port)
+}
+
+// KeyOf 由 IP 和端口構建規範鍵
+func KeyOf(ip, port string) string {
+	return net.JoinHostPort(ip, port)
+}
+
+// IsLegacyKey 判斷是否為舊版 protocol://ip:port 格式的鍵
+func IsLegacyKey(key []byte) bool {
+	return strings.Contains(string(key), "://")
+}
+
+// MergeFrom 合併重新爬取到的同一 ip:port 記錄
+// 已驗證過的記錄保留其協議與健康狀態，未驗證的記錄採用新數據
+func (p *Proxy) MergeFrom(incoming *Proxy) {
+	if p.Updated.IsZero() && incoming.Protocol != "" {
+		p.Protocol = incoming.Protocol
+	}
+	if p.Type == "" {
+		p.Type = incoming.Type
+	}
+	if p.User == "" && p.Pass == "" {
+		p.User = incoming.User
+		p.Pass = incoming.Pass
+	}
+	if p.Addr == "" {
+		p.Addr = incoming.Addr
+	}
+	// 來源統計歸屬最先提供該代理的來源
+	if p.Source == "" {
+		p.Source = incoming.Source
+	}
+	if p.Added.IsZero() {
+		p.Added = incoming.Added
+	}
+	// 來源元數據以最近一次爬取為準
+	if incoming.Country != "" {
+		p.Country = incoming.Country
+	}
+	if incoming.Anonymity != "" {
+		p.Anonymity = incoming.Anonymity
+	}
+	// 布爾標記只在來源標明時設置，不因其他來源缺少該列而清除
+	p.Google = p.Google || incoming.Google
+	p.HTTPS = p.HTTPS || incoming.HTTPS
+	// 標籤取並集，來源配置的標籤不會覆蓋經由管理 API 設置的標籤
+	p.Tags = NormalizeTags(append(p.Tags, incoming.Tags...))
+}
+
+// HasSites 判斷代理是否已通過所有指定站點的探測
+func (p *Proxy) HasSites(sites []string) bool {
+	for _, want := range sites {
+		found := false
+		for _, s := range p.Sites {
+			if s == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// HasTags 判斷代理是否帶有所有指定標籤
+func (p *Proxy) HasTags(tags []string) bool {
+	for _, want := range tags {
+		if !slices.Contains(p.Tags, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeTags 返回小寫、去重並排序的標籤（忽略空標籤），沒有標籤時返回 nil
+func NormalizeTags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// PreferOver 判斷 p 是否比 other 更適合作為同一 ip:port 的保留記錄
+// 優先未禁用的，其次最近驗證過的
+func (p *Proxy) PreferOver(other *Proxy) bool {
+	if p.Disable != other.Disable {
+		return !p.Disable
+	}
+	return p.Updated.After(other.Updated)
+}
+
+func (p *Proxy) DumpJSON() []byte {
+	// 確保 Proxy 數據是乾淨的
+	if p.IP == "" {
+		p.IP = "0.0.0.0"
+	}
+	if p.Addr == "" {
+		p.Addr = p.IP + ":" + p.Port
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		storeLog.Errorf("failed to marshal proxy: %v", err)
+		return []byte("{}")
+	}
+	return data
+}
+
+func LoadFromJSON(data []byte) (*Proxy, error) {
+	// 清理數據：移除二進制字符和不可打印字符
+	// 這可以處理像是 \x01 這樣的損壞字符
+	cleaned := make([]byte, 0, len(data))
+	for _, b := range data {
+		// 只保留可打印 ASCII 字符和常見的控制字符
+		if (b >= 32 && b <= 126) || b == '\n' || b == '\r' || b == '\t' {
+			cleaned = append(cleaned, b)
+		}
+	}
+
+	// 如果清理後的數據为空，返回錯誤
+	if len(cleaned) == 0 {
+		return nil, fmt.Errorf("empty proxy data after cleaning")
+	}
+
+	var p Proxy
+	err := json.Unmarshal(cleaned, &p)
+	if err != nil {
+		// 詳細記錄錯誤數據
+		storeLog.Errorf("LoadFromJSON error: original len=%d, cleaned len=%d, err=%v", len(data), len(cleaned), err)
+		// 顯示清理後數據的前幾個字節
+		if len(cleaned) > 0 {
+			storeLog.Errorf("LoadFromJSON cleaned data (first 100 bytes): %q", string(cleaned[:min(100, len(cleaned))]))
+		}
+		return nil, err
+	}
+
+	// 驗證代理的基本有效性
+	if p.IP == "" || p.Port == "" {
+		return nil, fmt.Errorf("invalid proxy: missing IP or Port")
+	}
+
+	return &p, nil
+}
+
+// ProxyQuality 代理質量評分
+type ProxyQuality struct {
+	ResponseTime   time.Duration // 響應時間
+	AnonymityLevel string        // 匿名級別（elite, anonymous, transparent）
+	LastChecked    time.Time     // 最後檢查時間
+	SuccessRate    float64       // 成功率（0-1）
+}
+
+// ValidProxy 驗證代理（按當前驗證策略檢測）並把結果寫入 p，供嵌入方驗證自己持有的代理；
+// p 不能同時被其他 goroutine 使用，並發驗證共享的代理時使用 Validate，由單一寫入方應用結果
+// （見 Pool.ApplyValidation）
+func ValidProxy(p *Proxy) bool {
+	r := Validate(p)
+	r.ApplyTo(p)
+	return r.Healthy
+}
+
+// ValidProxyWithQuality 驗證代理並返回質量評分
+func ValidProxyWithQuality(p *Proxy) (*ProxyQuality, bool) {
+	r := Validate(p)
+	if !r.Tested {
+		return nil, false
+	}
+	r.ApplyTo(p)
+	if r.Protocol == "" {
+		return nil, false
+	}
+
+	quality := &ProxyQuality{
+		ResponseTime:   r.Latency,
+		AnonymityLevel: "unknown",
+		LastChecked:    r.CheckedAt,
+		SuccessRate:    1.0,
+	}
+	if !r.Healthy {
+		quality.SuccessRate = 0
+		return quality, false
+	}
+	quality.AnonymityLevel = detectAnonymity(p)
+	validatorLog.WithFields(logger.Fields{"proxy": p.String(), "anonymity": quality.AnonymityLevel}).Debug("detected anonymity")
+	return quality, true
+}
+
+// detectAnonymity 經由判定服務檢測代理匿名級別，未配置判定服務或檢測失敗時返回 unknown
+func detectAnonymity(p *Proxy) string {
+	j, err := Judge(p, CurrentValidationPolicy())
+	if err != nil {
+		return "unknown"
+	}
+	return j.Anonymity
+}
+
+func determineConnectionProtocol(ip, port string) (string, error) {
+	addr := net.JoinHostPort(ip, port)
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		validatorLog.Tracef("TCP connection failed for %s: %v", addr, err)
+		return "", fmt.Errorf("connection failed: %w", err)
+	}
+	conn.Close()
+
+	overallTimeout := 20 * time.Second
+	dialTimeout := 8 * time.Second
+
+	type result struct {
+		protocol string
+		priority int
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), overallTimeout)
+	defer cancel()
+
+	resultChan := make(chan result, 4)
+	var wg sync.WaitGroup
+
+	checkers := []struct {
+		protocol string
+		priority int
+		check    func(context.Context, net.Conn) bool
+	}{
+		{"socks5", 1, checkSOCKS5},
+		{"http", 2, checkHTTP},
+		// 只接受 CONNECT 的明文代理也是 http 代理
+		{"http", 3, checkCONNECT},
+		{"https", 4, checkTLSProxy},
+	}
+
+	for _, checker := range checkers {
+		wg.Add(1)
+		go func(c struct {
+			protocol string
+			priority int
+			check    func(context.Context, net.Conn) bool
+		}) {
+			defer wg.Done()
+
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			dialCtx, dialCancel := context.WithTimeout(ctx, dialTimeout)
+			defer dialCancel()
+
+			var d net.Dialer
+			conn, err := d.DialContext(dialCtx, "tcp", addr)
+			if err != nil {
+				validatorLog.Tracef("failed to connect to %s for %s check: %v", addr, c.protocol, err)
+				return
+			}
+			defer conn.Close()
+
+			if err := conn.SetDeadline(time.Now().Add(8 * time.Second)); err != nil {
+				return
+			}
+
+			if c.check(ctx, conn) {
+				select {
+				case resultChan <- result{c.protocol, c.priority}:
+					cancel()
+				case <-ctx.Done():
+				}
+			}
+		}(checker)
+	}
+
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	var bestResult *result
+	for r := range resultChan {
+		if bestResult == nil || r.priority < bestResult.priority {
+			bestResult = &r
+		}
+	}
+
+	if bestResult != nil {
+		return bestResult.protocol, nil
+	}
+
+	validatorLog.Tracef("protocol detection failed but TCP connected, defaulting to http for %s", addr)
+	return "http", nil
+}
+
+func checkSOCKS5(ctx context.Context, conn net.Conn) bool {
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		validatorLog.Tracef("[checkSOCKS5] failed to write greeting: %v", err)
+		return false
+	}
+
+	greetingBuf := make([]byte, 2)
+
+	type readResult struct {
+		success bool
+		err     error
+	}
+
+	greetingDone := make(chan readResult, 1)
+	go func() {
+		_, err := io.ReadFull(conn, greetingBuf)
+		greetingDone <- readResult{
+			success: err == nil && greetingBuf[0] == 5 && greetingBuf[1] == 0,
+			err:     err,
+		}
+	}()
+
+	select {
+	case result := <-greetingDone:
+		if !result.success {
+			if result.err != nil {
+				validatorLog.Tracef("[checkSOCKS5] greeting read failed: %v", result.err)
+			} else {
+				validatorLog.Tracef("[checkSOCKS5] invalid greeting response: [%d, %d]", greetingBuf[0], greetingBuf[1])
+			}
+			return false
+		}
+	case <-ctx.Done():
+		validatorLog.Tracef("[checkSOCKS5] context cancelled during greeting")
+		return false
+	case <-time.After(2 * time.Second):
+		validatorLog.Tracef("[checkSOCKS5] timeout waiting for greeting response")
+		return false
+	}
+
+	// SOCKS5 CONNECT: VER(1) CMD(1) RSV(1) ATYP(1) DST.ADDR(4) DST.PORT(2)
+	connectRequest := []byte{
+		5,          // VER: SOCKS5
+		1,          // CMD: CONNECT
+		0,          // RSV: Reserved
+		1,          // ATYP: IPv4
+		8, 8, 8, 8, // DST.ADDR: 8.8.8.8
+		0, 53, // DST.PORT: 53
+	}
+
+	if _, err := conn.Write(connectRequest); err != nil {
+		validatorLog.Tracef("[checkSOCKS5] failed to write CONNECT request: %v", err)
+		return false
+	}
+
+	connectHeaderBuf := make([]byte, 4)
+
+	connectDone := make(chan readResult, 1)
+	go func() {
+		_, err := io.ReadFull(conn, connectHeaderBuf)
+		if err != nil {
+			connectDone <- readResult{success: false, err: err}
+			return
+		}
+
+		if connectHeaderBuf[0] != 5 {
+			connectDone <- readResult{success: false, err: fmt.Errorf("invalid version: %d", connectHeaderBuf[0])}
+			return
+		}
+
+		if connectHeaderBuf[1] != 0 {
+			connectDone <- readResult{success: false, err: fmt.Errorf("connection failed, reply code: %d", connectHeaderBuf[1])}
+			return
+		}
+
+		atyp := connectHeaderBuf[3]
+		var remainingBytes int
+
+		switch atyp {
+		case 1: // IPv4
+			remainingBytes = 4 + 2 // 4 bytes addr + 2 bytes port
+		case 3: // Domain name
+			lenBuf := make([]byte, 1)
+			if _, err := io.ReadFull(conn, lenBuf); err != nil {
+				connectDone <- readResult{success: false, err: err}
+				return
+			}
+			remainingBytes = int(lenBuf[0]) + 2 // domain length + 2 bytes port
+		case 4: // IPv6
+			remainingBytes = 16 + 2 // 16 bytes addr + 2 bytes port
+		default:
+			connectDone <- readResult{success: false, err: fmt.Errorf("unknown address type: %d", atyp)}
+			return
+		}
+
+		remainingBuf := make([]byte, remainingBytes)
+		if _, err := io.ReadFull(conn, remainingBuf); err != nil {
+			connectDone <- readResult{success: false, err: err}
+			return
+		}
+
+		connectDone <- readResult{success: true, err: nil}
+	}()
+
+	select {
+	case result := <-connectDone:
+		if !result.success {
+			if result.err != nil {
+				validatorLog.Tracef("[checkSOCKS5] CONNECT failed: %v", result.err)
+			}
+			return false
+		}
+		validatorLog.Tracef("[checkSOCKS5] successfully validated SOCKS5 proxy")
+		return true
+	case <-ctx.Done():
+		validatorLog.Tracef("[checkSOCKS5] context cancelled during CONNECT")
+		return false
+	case <-time.After(2 * time.Second):
+		validatorLog.Tracef("[checkSOCKS5] timeout waiting for CONNECT response")
+		return false
+	}
+}
+
+// checkTLSProxy 與代理完成 TLS 握手後在其中檢測 CONNECT（https 代理）
+func checkTLSProxy(ctx context.Context, conn net.Conn) bool {
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	tlsConn := tls.Client(conn, proxyTLSClientConfig(&Proxy{IP: host}))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		validatorLog.Tracef("[checkTLSProxy] TLS handshake failed: %v", err)
+		return false
+	}
+	return checkCONNECT(ctx, tlsConn)
+}
+
+func checkCONNECT(ctx context.Context, conn net.Conn) bool {
+	request := "CONNECT www.google.com:443 HTTP/1.1\r\n" +
+		"Host: www.google.com:443\r\n" +
+		"User-Agent: Mozilla/5.0\r\n" +
+		"Proxy-Connection: keep-alive\r\n" +
+		"\r\n"
+
+	if _, err := conn.Write([]byte(request)); err != nil {
+		validatorLog.Tracef("[checkCONNECT] failed to write CONNECT request: %v", err)
+		return false
+	}
+
+	reader := bufio.NewReader(conn)
+
+	type readResult struct {
+		line string
+		err  error
+	}
+
+	done := make(chan readResult, 1)
+	go func() {
+		line, err := reader.ReadString('\n')
+		done <- readResult{line: line, err: err}
+	}()
+
+	var result readResult
+	select {
+	case result = <-done:
+		if result.err != nil {
+			validatorLog.Tracef("[checkCONNECT] failed to read response: %v", result.err)
+			return false
+		}
+	case <-ctx.Done():
+		validatorLog.Tracef("[checkCONNECT] context cancelled")
+		return false
+	case <-time.After(3 * time.Second):
+		validatorLog.Tracef("[checkCONNECT] timeout waiting for response")
+		return false
+	}
+
+	line := strings.TrimSpace(result.line)
+	validatorLog.Tracef("[checkCONNECT] received: %s", line)
+
+	if !strings.HasPrefix(line, "HTTP/1.1 ") && !strings.HasPrefix(line, "HTTP/1.0 ") {
+		return false
+	}
+
+	parts := strings.Fields(line)
+	if len(parts) < 2 {
+		return false
+	}
+
+	statusCode := parts[1]
+
+	if statusCode != "200" {
+		validatorLog.Tracef("[checkCONNECT] non-200 status code: %s (full response: %s)", statusCode, line)
+		return false
+	}
+
+	return true
+}
+
+func checkHTTP(ctx context.Context, conn net.Conn) bool {
+	request := "GET http://www.gstatic.com/generate_204 HTTP/1.1\r\n" +
+		"Host: www.gstatic.com\r\n" +
+		"User-Agent: Mozilla/5.0\r\n" +
+		"Proxy-Connection: close\r\n" +
+		"\r\n"
+
+	if _, err := conn.Write([]byte(request)); err != nil {
+		validatorLog.Tracef("[checkHTTP] failed to write HTTP request: %v", err)
+		return false
+	}
+
+	reader := bufio.NewReader(conn)
+
+	type readResult struct {
+		line string
+		err  error
+	}
+
+	done := make(chan readResult, 1)
+	go func() {
+		line, err := reader.ReadString('\n')
+		done <- readResult{line: line, err: err}
+	}()
+
+	var result readResult
+	select {
+	case result = <-done:
+		if result.err != nil {
+			validatorLog.Tracef("[checkHTTP] failed to read response: %v", result.err)
+			return false
+		}
+	case <-ctx.Done():
+		validatorLog.Tracef("[checkHTTP] context cancelled")
+		return false
+	case <-time.After(3 * time.Second):
+		validatorLog.Tracef("[checkHTTP] timeout waiting for response")
+		return false
+	}
+
+	line := strings.TrimSpace(result.line)
+	validatorLog.Tracef("[checkHTTP] received: %s", line)
+
+	if !strings.HasPrefix(line, "HTTP/1.1 ") && !strings.HasPrefix(line, "HTTP/1.0 ") {
+		return false
+	}
+
+	parts := strings.Fields(line)
+	if len(parts) < 2 {
+		return false
+	}
+
+	statusCode := parts[1]
+
+	if len(statusCode) != 3 {
+		return false
+	}
+
+	for _, c := range statusCode {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	firstDigit := statusCode[0]
+	if firstDigit != '2' && firstDigit != '3' {
+		validatorLog.Tracef("[checkHTTP] received non-success status code: %s", statusCode)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,61 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// queuePrefix 待驗證隊列鍵前綴，位於元數據命名空間下，遍歷代理記錄時會被跳過
+const queuePrefix = MetaPrefix + "queue:"
+
+// Enqueue 在事務中把代理加入待驗證隊列（重複加入無副作用）
+func Enqueue(txn *badger.Txn, key string) error {
+	return txn.Set([]byte(queuePrefix+key), nil)
+}
+
+// Dequeue 在事務中把代理移出待驗證隊列
+func Dequeue(txn *badger.Txn, key string) error {
+	return txn.Delete([]byte(queuePrefix + key))
+}
+
+// Queued 判斷代理是否仍在待驗證隊列中
+func Queued(txn *badger.Txn, key string) (bool, error) {
+	_, err := txn.Get([]byte(queuePrefix + key))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// QueuedKeys 返回隊列中最多 n 個代理鍵（n <= 0 表示全部）
+func QueuedKeys(db *badger.DB, n int) ([]string, error) {
+	var keys []string
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(queuePrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, strings.TrimPrefix(string(it.Item().Key()), queuePrefix))
+			if n > 0 && len(keys) >= n {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read validation queue: %w", err)
+	}
+	return keys, nil
+}
+
+// QueueLen 返回待驗證隊列的長度
+func QueueLen(db *badger.DB) (int, error) {
+	keys, err := QueuedKeys(db, 0)
+	return len(keys), err
+}
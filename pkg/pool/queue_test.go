@@ -0,0 +1,62 @@
+package pool
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestValidationQueue(t *testing.T) {
+	p := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http"}
+	db := newTestDB(t, p)
+
+	if err := db.Update(func(txn *badger.Txn) error {
+		for _, key := range []string{p.Key(), "2.2.2.2:80", p.Key()} {
+			if err := Enqueue(txn, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	if n, err := QueueLen(db); err != nil || n != 2 {
+		t.Fatalf("QueueLen = %d, %v; want 2", n, err)
+	}
+	keys, err := QueuedKeys(db, 1)
+	if err != nil || len(keys) != 1 || keys[0] != p.Key() {
+		t.Fatalf("QueuedKeys(1) = %v, %v", keys, err)
+	}
+
+	// 隊列鍵不會被當作代理記錄
+	n := 0
+	if err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if !IsMetaKey(it.Item().Key()) {
+				n++
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("proxy records = %d, want 1", n)
+	}
+
+	if err := db.Update(func(txn *badger.Txn) error { return Dequeue(txn, p.Key()) }); err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+	db.View(func(txn *badger.Txn) error {
+		if ok, err := Queued(txn, p.Key()); err != nil || ok {
+			t.Errorf("Queued after Dequeue = %v, %v", ok, err)
+		}
+		if ok, err := Queued(txn, "2.2.2.2:80"); err != nil || !ok {
+			t.Errorf("Queued = %v, %v; want true", ok, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,36 @@
+package pool
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// recheckJitter 下次驗證時間的隨機抖動比例，避免同一批入庫的代理同時到期
+const recheckJitter = 0.1
+
+// RecheckInterval 連續通過 streak 次驗證後的重新驗證間隔：從 minInterval 起每次翻倍，不超過 maxInterval
+func RecheckInterval(streak int, minInterval, maxInterval time.Duration) time.Duration {
+	d := minInterval
+	for i := 1; i < streak && d < maxInterval; i++ {
+		d *= 2
+	}
+	return min(d, maxInterval)
+}
+
+// scheduleRecheck 記錄一次驗證結果並安排下次驗證：新代理和不穩定的代理很快再驗證，
+// 長期穩定的代理間隔逐步拉長
+func (p *Proxy) scheduleRecheck(valid bool, now time.Time, policy ValidationPolicy) {
+	if valid {
+		p.Streak++
+	} else {
+		p.Streak = 0
+	}
+	d := RecheckInterval(p.Streak, policy.RecheckMin, policy.RecheckMax)
+	jitter := time.Duration((rand.Float64()*2 - 1) * recheckJitter * float64(d))
+	p.NextCheck = now.Add(d + jitter)
+}
+
+// Due 判斷代理是否已到重新驗證時間
+func (p *Proxy) Due(now time.Time) bool {
+	return !now.Before(p.NextCheck)
+}
@@ -0,0 +1,54 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecheckInterval(t *testing.T) {
+	const lo, hi = 15 * time.Minute, 12 * time.Hour
+	tests := []struct {
+		streak int
+		want   time.Duration
+	}{
+		{0, lo},
+		{1, lo},
+		{2, 30 * time.Minute},
+		{4, 2 * time.Hour},
+		{7, hi},
+		{100, hi},
+	}
+	for _, tt := range tests {
+		if got := RecheckInterval(tt.streak, lo, hi); got != tt.want {
+			t.Errorf("RecheckInterval(%d) = %v, want %v", tt.streak, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleRecheck(t *testing.T) {
+	policy := ValidationPolicy{RecheckMin: time.Hour, RecheckMax: 8 * time.Hour}
+	now := time.Now()
+	p := &Proxy{}
+	if !p.Due(now) {
+		t.Error("never-checked proxy should be due")
+	}
+
+	within := func(d time.Duration) bool {
+		got := p.NextCheck.Sub(now)
+		return got >= d-d/10 && got <= d+d/10
+	}
+	for range 3 {
+		p.scheduleRecheck(true, now, policy)
+	}
+	if p.Streak != 3 || !within(4*time.Hour) {
+		t.Errorf("after 3 passes: streak=%d next in %v", p.Streak, p.NextCheck.Sub(now))
+	}
+	if p.Due(now.Add(time.Hour)) {
+		t.Error("stable proxy should not be due after 1h")
+	}
+
+	p.scheduleRecheck(false, now, policy)
+	if p.Streak != 0 || !within(time.Hour) {
+		t.Errorf("after failure: streak=%d next in %v", p.Streak, p.NextCheck.Sub(now))
+	}
+}
@@ -0,0 +1,55 @@
+package pool
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// initialScore 從未驗證的代理的健康評分
+	initialScore = 0.5
+	// scoreStep 每次驗證結果把評分向 1（通過）或 0（失敗）移動的比例
+	scoreStep = 0.5
+)
+
+// ScoreAt 代理在 now 時的健康評分（0–1）：每次驗證通過向 1 移動、失敗向 0 移動，
+// 之後按 halfLife 指數衰減（halfLife 為 0 時不衰減）。舊版本保存的代理沒有評分，按禁用狀態估計
+func (p *Proxy) ScoreAt(now time.Time, halfLife time.Duration) float64 {
+	s, at := p.Score, p.ScoredAt
+	if at.IsZero() {
+		if p.Updated.IsZero() {
+			return initialScore
+		}
+		s, at = 1, p.Updated
+		if p.Disable {
+			s = initialScore * (1 - scoreStep)
+		}
+	}
+	if halfLife > 0 && now.After(at) {
+		s *= math.Exp2(-float64(now.Sub(at)) / float64(halfLife))
+	}
+	return s
+}
+
+// CurrentScore 代理當前的健康評分（按當前驗證策略的 ScoreHalfLife 衰減）
+func (p *Proxy) CurrentScore() float64 {
+	return p.ScoreAt(time.Now(), CurrentValidationPolicy().ScoreHalfLife)
+}
+
+// recordResult 按驗證結果更新健康評分，評分低於 policy.ScoreExclude 或被手動禁用的代理標記為禁用（不參與選擇）
+func (p *Proxy) recordResult(healthy bool, now time.Time, policy ValidationPolicy) {
+	s := p.ScoreAt(now, policy.ScoreHalfLife)
+	if healthy {
+		s += (1 - s) * scoreStep
+	} else {
+		s -= s * scoreStep
+	}
+	p.Score = math.Round(s*1e4) / 1e4
+	p.ScoredAt = now
+	p.Disable = p.ManualDisable || p.Score < policy.ScoreExclude
+}
+
+// RecordResult 按驗證結果（如外部健康檢查）更新代理的健康評分和禁用狀態
+func (p *Proxy) RecordResult(healthy bool) {
+	p.recordResult(healthy, time.Now(), CurrentValidationPolicy())
+}
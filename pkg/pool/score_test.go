@@ -0,0 +1,63 @@
+package pool
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScoreAt(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		p    Proxy
+		want float64
+	}{
+		{"never validated", Proxy{}, initialScore},
+		{"legacy healthy", Proxy{Updated: now}, 1},
+		{"legacy disabled", Proxy{Updated: now, Disable: true}, 0.25},
+		{"one half-life", Proxy{Score: 0.8, ScoredAt: now.Add(-24 * time.Hour)}, 0.4},
+		{"two half-lives", Proxy{Score: 0.8, ScoredAt: now.Add(-48 * time.Hour)}, 0.2},
+	}
+	for _, tt := range tests {
+		if got := tt.p.ScoreAt(now, 24*time.Hour); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: ScoreAt = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	p := Proxy{Score: 0.8, ScoredAt: now.Add(-48 * time.Hour)}
+	if got := p.ScoreAt(now, 0); got != 0.8 {
+		t.Errorf("without half-life ScoreAt = %v, want 0.8", got)
+	}
+}
+
+func TestRecordResult(t *testing.T) {
+	now := time.Now()
+	policy := ValidationPolicy{ScoreHalfLife: 24 * time.Hour, ScoreExclude: 0.4}
+	p := &Proxy{}
+
+	steps := []struct {
+		healthy bool
+		score   float64
+		disable bool
+	}{
+		{true, 0.75, false},
+		{true, 0.875, false},
+		{false, 0.4375, false}, // 一次失敗不足以排除穩定的代理
+		{false, 0.2188, true},
+		{true, 0.6094, false},
+	}
+	for i, st := range steps {
+		p.recordResult(st.healthy, now, policy)
+		if p.Score != st.score || p.Disable != st.disable {
+			t.Errorf("step %d: score = %v, disable = %v, want %v, %v", i, p.Score, p.Disable, st.score, st.disable)
+		}
+	}
+
+	// 長時間未確認的評分先衰減再更新
+	p = &Proxy{Score: 0.8, ScoredAt: now.Add(-24 * time.Hour)}
+	p.recordResult(false, now, policy)
+	if p.Score != 0.2 || !p.Disable || !p.ScoredAt.Equal(now) {
+		t.Errorf("decayed failure: score = %v, disable = %v", p.Score, p.Disable)
+	}
+}
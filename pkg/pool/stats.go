@@ -0,0 +1,263 @@
+package pool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// 代理使用統計鍵前綴，位於元數據命名空間下，鍵的其餘部分為代理的規範鍵（ip:port）
+const (
+	countPrefix  = MetaPrefix + "count:"
+	healthPrefix = MetaPrefix + "health:"
+	failPrefix   = MetaPrefix + "fail:"
+)
+
+// 舊版統計鍵前綴，與代理記錄混在一起，遍歷時會被當作損壞的代理記錄刪除
+const (
+	legacyCountPrefix  = "proxy_count_"
+	legacyHealthPrefix = "proxy_health_"
+)
+
+// 健康度分數：新記錄從 InitialHealth 開始，每次成功 +1（不超過 MaxHealth），每次失敗 -10（不低於 0）
+const (
+	InitialHealth = 100
+	MaxHealth     = 100
+	healthPenalty = 10
+)
+
+// Usage 代理的使用統計
+type Usage struct {
+	Uses     uint64 `json:"uses"`     // 經由代理服務器轉發的次數
+	Failures uint64 `json:"failures"` // 轉發失敗的次數
+	Health   int    `json:"health"`   // 健康度分數（0–100），尚無記錄時為 InitialHealth
+}
+
+// countKey 代理使用次數的鍵
+func countKey(key string) []byte {
+	return []byte(countPrefix + key)
+}
+
+// healthKey 代理健康度的鍵
+func healthKey(key string) []byte {
+	return []byte(healthPrefix + key)
+}
+
+// failKey 代理轉發失敗次數的鍵
+func failKey(key string) []byte {
+	return []byte(failPrefix + key)
+}
+
+// isLegacyStatsKey 判斷是否為舊版統計鍵
+func isLegacyStatsKey(key []byte) bool {
+	return strings.HasPrefix(string(key), legacyCountPrefix) || strings.HasPrefix(string(key), legacyHealthPrefix)
+}
+
+// deleteStats 在事務中刪除代理的使用統計
+func deleteStats(txn *badger.Txn, key string) error {
+	for _, k := range [][]byte{countKey(key), healthKey(key)} {
+		if err := txn.Delete(k); err != nil {
+			return err
+		}
+	}
+	return txn.Delete(failKey(key))
+}
+
+// migrateStatsBatch MigrateLegacyStatsKeys 每個事務遷移的鍵數
+const migrateStatsBatch = 500
+
+// MigrateLegacyStatsKeys 把舊版 proxy_count_* / proxy_health_* 鍵移到元數據命名空間，返回遷移的鍵數；
+// 每個事務遷移 migrateStatsBatch 個鍵，大型數據庫不會超出事務大小限制，中途失敗時下次繼續遷移剩餘的鍵
+func MigrateLegacyStatsKeys(db *badger.DB) (int, error) {
+	moved := 0
+	for _, m := range []struct{ from, to string }{
+		{legacyCountPrefix, countPrefix},
+		{legacyHealthPrefix, healthPrefix},
+	} {
+		for {
+			n := 0
+			err := db.Update(func(txn *badger.Txn) error {
+				n = 0
+				opts := badger.DefaultIteratorOptions
+				opts.Prefix = []byte(m.from)
+				it := txn.NewIterator(opts)
+				var keys [][]byte
+				var vals [][]byte
+				for it.Rewind(); it.Valid() && len(keys) < migrateStatsBatch; it.Next() {
+					val, err := it.Item().ValueCopy(nil)
+					if err != nil {
+						it.Close()
+						return err
+					}
+					keys = append(keys, it.Item().KeyCopy(nil))
+					vals = append(vals, val)
+				}
+				it.Close()
+
+				for i, key := range keys {
+					to := m.to + strings.TrimPrefix(string(key), m.from)
+					if err := txn.Set([]byte(to), vals[i]); err != nil {
+						return err
+					}
+					if err := txn.Delete(key); err != nil {
+						return err
+					}
+				}
+				n = len(keys)
+				return nil
+			})
+			if err != nil {
+				return moved, fmt.Errorf("failed to migrate legacy stats keys (%d migrated): %w", moved, err)
+			}
+			if n == 0 {
+				break
+			}
+			moved += n
+		}
+	}
+	return moved, nil
+}
+
+// decodeCounter 解碼計數值：varint 編碼，兼容舊版的單字節值
+func decodeCounter(v []byte) (uint64, error) {
+	if len(v) == 1 {
+		return uint64(v[0]), nil
+	}
+	n, size := binary.Uvarint(v)
+	if size <= 0 {
+		return 0, fmt.Errorf("invalid counter value %x", v)
+	}
+	return n, nil
+}
+
+// updateCounter 在一個事務中讀取計數（不存在時為 initial）、經 fn 更新並寫回，返回新值
+func updateCounter(db *badger.DB, key []byte, initial uint64, fn func(uint64) uint64) (uint64, error) {
+	var n uint64
+	err := db.Update(func(txn *badger.Txn) error {
+		n = initial
+		item, err := txn.Get(key)
+		switch {
+		case errors.Is(err, badger.ErrKeyNotFound):
+		case err != nil:
+			return err
+		default:
+			if err := item.Value(func(v []byte) error {
+				n, err = decodeCounter(v)
+				return err
+			}); err != nil {
+				return err
+			}
+		}
+		n = fn(n)
+		return txn.Set(key, binary.AppendUvarint(nil, n))
+	})
+	return n, err
+}
+
+// RecordUse 更新代理的使用次數，proxy.Count 同步為累計值
+func (pl *Pool) RecordUse(proxy *Proxy) {
+	proxy.Count++
+	if pl.db == nil {
+		return
+	}
+	n, err := updateCounter(pl.db, countKey(proxy.Key()), 0, func(n uint64) uint64 { return n + 1 })
+	if err != nil {
+		storeLog.Errorf("Failed to update proxy count for %s: %v", proxy.Key(), err)
+		return
+	}
+	proxy.Count = int64(n)
+}
+
+// RecordHealth 更新代理健康度：成功 +1，失敗 -10 並累計失敗次數；尚無記錄時從 InitialHealth 開始
+func (pl *Pool) RecordHealth(proxy *Proxy, successful bool) {
+	if pl.db == nil {
+		return
+	}
+	_, err := updateCounter(pl.db, healthKey(proxy.Key()), InitialHealth, func(h uint64) uint64 {
+		if successful {
+			return min(h+1, MaxHealth)
+		}
+		return h - min(h, healthPenalty)
+	})
+	if err != nil {
+		storeLog.Errorf("Failed to update proxy health for %s: %v", proxy.Key(), err)
+	}
+	if successful {
+		return
+	}
+	if _, err := updateCounter(pl.db, failKey(proxy.Key()), 0, func(n uint64) uint64 { return n + 1 }); err != nil {
+		storeLog.Errorf("Failed to update proxy failures for %s: %v", proxy.Key(), err)
+	}
+}
+
+// Usage 返回代理的使用統計
+func (pl *Pool) Usage(key string) (Usage, error) {
+	all, err := loadUsage(pl.db, key)
+	if err != nil {
+		return Usage{}, err
+	}
+	if u, ok := all[key]; ok {
+		return u, nil
+	}
+	return Usage{Health: InitialHealth}, nil
+}
+
+// UsageAll 返回所有有統計記錄的代理的使用統計，鍵為代理的規範鍵；
+// 沒有記錄的代理不在結果中，其統計為 Usage{Health: InitialHealth}
+func (pl *Pool) UsageAll() (map[string]Usage, error) {
+	return loadUsage(pl.db, "")
+}
+
+// loadUsage 讀取使用統計，key 非空時只讀取該代理
+func loadUsage(db *badger.DB, key string) (map[string]Usage, error) {
+	if db == nil {
+		return nil, errors.New("database not initialized")
+	}
+	out := make(map[string]Usage)
+	err := db.View(func(txn *badger.Txn) error {
+		for _, prefix := range []string{countPrefix, healthPrefix, failPrefix} {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = []byte(prefix + key)
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid(); it.Next() {
+				item := it.Item()
+				k := strings.TrimPrefix(string(item.Key()), prefix)
+				if key != "" && k != key {
+					continue
+				}
+				var n uint64
+				err := item.Value(func(v []byte) error {
+					var err error
+					n, err = decodeCounter(v)
+					return err
+				})
+				if err != nil {
+					storeLog.Warnf("skipping invalid usage record %s: %v", item.Key(), err)
+					continue
+				}
+				u, ok := out[k]
+				if !ok {
+					u.Health = InitialHealth
+				}
+				switch prefix {
+				case countPrefix:
+					u.Uses = n
+				case healthPrefix:
+					u.Health = int(n)
+				default:
+					u.Failures = n
+				}
+				out[k] = u
+			}
+			it.Close()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load usage stats: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,180 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestMigrateLegacyStatsKeys(t *testing.T) {
+	p := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http"}
+	db := newTestDB(t, p)
+	if err := db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set([]byte("proxy_count_1.1.1.1:80"), []byte{7}); err != nil {
+			return err
+		}
+		return txn.Set([]byte("proxy_health_1.1.1.1:80"), []byte{90})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !IsMetaKey([]byte("proxy_count_1.1.1.1:80")) {
+		t.Error("legacy stats keys should be skipped when iterating proxies")
+	}
+
+	n, err := MigrateLegacyStatsKeys(db)
+	if err != nil || n != 2 {
+		t.Fatalf("MigrateLegacyStatsKeys = %d, %v; want 2", n, err)
+	}
+	if err := db.View(func(txn *badger.Txn) error {
+		for key, want := range map[string]byte{"_meta:count:1.1.1.1:80": 7, "_meta:health:1.1.1.1:80": 90} {
+			item, err := txn.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			if v, _ := item.ValueCopy(nil); len(v) != 1 || v[0] != want {
+				t.Errorf("%s = %v, want [%d]", key, v, want)
+			}
+		}
+		if _, err := txn.Get([]byte("proxy_count_1.1.1.1:80")); !errors.Is(err, badger.ErrKeyNotFound) {
+			t.Errorf("legacy key should be removed, got %v", err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 刪除代理時一併刪除其統計
+	if _, err := New(db).Delete(p.Key()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get(countKey(p.Key())); !errors.Is(err, badger.ErrKeyNotFound) {
+			t.Errorf("count key after Delete: %v", err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUsageCounters(t *testing.T) {
+	p := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http"}
+	db := newTestDB(t, p)
+	pl := New(db)
+
+	// 尚無記錄時健康度為初始值
+	if u, err := pl.Usage(p.Key()); err != nil || u != (Usage{Health: InitialHealth}) {
+		t.Fatalf("Usage before any record = %+v, %v", u, err)
+	}
+
+	// 計數超過單字節範圍不回繞
+	for range 300 {
+		pl.RecordUse(p)
+	}
+	if p.Count != 300 {
+		t.Errorf("proxy.Count = %d, want 300", p.Count)
+	}
+
+	// 缺少健康記錄時從初始值開始扣分
+	pl.RecordHealth(p, false)
+	pl.RecordHealth(p, false)
+	pl.RecordHealth(p, true)
+	u, err := pl.Usage(p.Key())
+	if err != nil || u.Uses != 300 || u.Health != InitialHealth-2*healthPenalty+1 {
+		t.Errorf("Usage = %+v, %v; want 300 uses, health %d", u, err, InitialHealth-2*healthPenalty+1)
+	}
+	for range 20 {
+		pl.RecordHealth(p, false)
+	}
+	if u, _ := pl.Usage(p.Key()); u.Health != 0 || u.Failures != 22 {
+		t.Errorf("health should floor at 0 with 22 failures, got %+v", u)
+	}
+
+	all, err := pl.UsageAll()
+	if err != nil || len(all) != 1 || all[p.Key()].Uses != 300 {
+		t.Errorf("UsageAll = %+v, %v", all, err)
+	}
+}
+
+func TestMigrateLegacyStatsKeysBatches(t *testing.T) {
+	// 小的 memtable 使單個事務放不下全部鍵的遷移
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil).
+		WithMemTableSize(1 << 20).WithValueThreshold(1 << 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	const n = 3000
+	wb := db.NewWriteBatch()
+	for i := range n {
+		key := fmt.Sprintf("10.%d.%d.1:80", i/256, i%256)
+		if err := wb.Set([]byte(legacyCountPrefix+key), []byte{7}); err != nil {
+			t.Fatal(err)
+		}
+		if err := wb.Set([]byte(legacyHealthPrefix+key), []byte{90}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 在一個事務中遷移全部鍵超出事務大小限制
+	err = db.Update(func(txn *badger.Txn) error {
+		for i := range 2 * n {
+			if err := txn.Set([]byte(fmt.Sprintf("%s10.0.0.%d:80", countPrefix, i)), []byte{7}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if !errors.Is(err, badger.ErrTxnTooBig) {
+		t.Fatalf("single-transaction migration err = %v, want ErrTxnTooBig (test database too large)", err)
+	}
+
+	moved, err := MigrateLegacyStatsKeys(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 2*n {
+		t.Errorf("migrated %d keys, want %d", moved, 2*n)
+	}
+	counts := map[string]int{}
+	if err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			counts[keyPrefix(string(it.Item().Key()))]++
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{countPrefix: n, healthPrefix: n}; !maps.Equal(counts, want) {
+		t.Errorf("keys by prefix = %v, want %v", counts, want)
+	}
+}
+
+// keyPrefix 統計鍵所屬的前綴（新版或舊版）
+func keyPrefix(key string) string {
+	for _, prefix := range []string{countPrefix, healthPrefix, legacyCountPrefix, legacyHealthPrefix} {
+		if strings.HasPrefix(key, prefix) {
+			return prefix
+		}
+	}
+	return key
+}
+
+func TestDecodeLegacyCounter(t *testing.T) {
+	// 舊版以單字節保存，大於 127 的值不是合法的 varint
+	if n, err := decodeCounter([]byte{200}); err != nil || n != 200 {
+		t.Errorf("decodeCounter(200) = %d, %v", n, err)
+	}
+	if _, err := decodeCounter([]byte{0xff, 0xff}); err == nil {
+		t.Error("truncated varint should fail")
+	}
+}
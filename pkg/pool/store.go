@@ -0,0 +1,666 @@
+package pool
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Hooks 代理生命週期回調，供嵌入方接入自定義副作用（通知、同步到自有數據庫等）
+//
+// 回調在事務提交後於調用方 goroutine 中同步執行，可能被並發調用，應盡快返回；
+// 傳入的 Proxy 不應被修改。未設置的回調被忽略
+type Hooks struct {
+	OnProxyAdded       func(p *Proxy)               // 新代理寫入數據庫
+	OnProxyDisabled    func(p *Proxy)               // 代理因驗證失敗由可用變為禁用
+	OnProxyRecovered   func(p *Proxy)               // 被禁用的代理重新通過驗證
+	OnProxyDeleted     func(key string, p *Proxy)   // 代理從數據庫刪除，記錄無法解析時 p 為 nil
+	OnValidationResult func(p *Proxy, healthy bool) // 驗證結果已保存（首次驗證及重新驗證）
+}
+
+// WithHooks 設置代理生命週期回調，僅經由 Pool 的寫入方法（Add、AddBatch、SaveValidation、ApplyValidation、SetDisabled、MarkTampering、Delete）觸發
+func WithHooks(hooks Hooks) Option {
+	return func(options *Options) {
+		options.Hooks = hooks
+	}
+}
+
+// Add 寫入採集到的代理：新代理加入待驗證隊列並觸發 OnProxyAdded；
+// 已存在的代理與新記錄合併，保留已驗證的協議和健康狀態。返回是否為新代理；
+// 最近首次驗證即失敗的代理（見 ValidationPolicy.KnownBadTTL）已被刪除時不再寫入，返回 ErrKnownBad
+func (pl *Pool) Add(p *Proxy) (added bool, err error) {
+	if pl.db == nil {
+		return false, errors.New("database not initialized")
+	}
+	checkBad := CurrentValidationPolicy().KnownBadTTL > 0
+	err = pl.db.Update(func(txn *badger.Txn) error {
+		added, err = addTxn(txn, p, checkBad)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if added && pl.hooks.OnProxyAdded != nil {
+		pl.hooks.OnProxyAdded(p)
+	}
+	return added, nil
+}
+
+// AddResult 批量寫入的統計
+type AddResult struct {
+	Added    int // 新代理數
+	Updated  int // 與已有記錄合併的代理數
+	KnownBad int // 最近首次驗證即失敗而跳過的代理數
+}
+
+// addBatchAttempts 批量寫入因並發事務（驗證結果、使用統計等）衝突而失敗時的最多嘗試次數
+const addBatchAttempts = 3
+
+// testHookAddBatch 測試用：批量寫入的事務中每寫入一個代理後調用
+var testHookAddBatch func(i int)
+
+// AddBatch 在同一事務中寫入一批採集到的代理（規則同 Add）。與其他寫入衝突（badger.ErrConflict）時整批重試，
+// 多次衝突或事務超出大小限制時拆成兩半分別寫入；提交後對新代理觸發 OnProxyAdded。
+// 返回出錯時已提交的部分不回滾，統計只包含已提交的部分
+func (pl *Pool) AddBatch(ps []*Proxy) (AddResult, error) {
+	var res AddResult
+	if pl.db == nil {
+		return res, errors.New("database not initialized")
+	}
+	if len(ps) == 0 {
+		return res, nil
+	}
+	checkBad := CurrentValidationPolicy().KnownBadTTL > 0
+
+	var added []*Proxy
+	var err error
+	for range addBatchAttempts {
+		res, added, err = pl.addBatchTxn(ps, checkBad)
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+	}
+	if (errors.Is(err, badger.ErrTxnTooBig) || errors.Is(err, badger.ErrConflict)) && len(ps) > 1 {
+		half := len(ps) / 2
+		first, err := pl.AddBatch(ps[:half])
+		if err != nil {
+			return first, err
+		}
+		second, err := pl.AddBatch(ps[half:])
+		return AddResult{
+			Added:    first.Added + second.Added,
+			Updated:  first.Updated + second.Updated,
+			KnownBad: first.KnownBad + second.KnownBad,
+		}, err
+	}
+	if err != nil {
+		return AddResult{}, err
+	}
+
+	if pl.hooks.OnProxyAdded != nil {
+		for _, p := range added {
+			pl.hooks.OnProxyAdded(p)
+		}
+	}
+	return res, nil
+}
+
+// addBatchTxn 在一個事務中寫入 ps，返回統計和新代理
+func (pl *Pool) addBatchTxn(ps []*Proxy, checkBad bool) (res AddResult, added []*Proxy, err error) {
+	err = pl.db.Update(func(txn *badger.Txn) error {
+		for i, p := range ps {
+			isNew, err := addTxn(txn, p, checkBad)
+			switch {
+			case errors.Is(err, ErrKnownBad):
+				res.KnownBad++
+			case err != nil:
+				return err
+			case isNew:
+				res.Added++
+				added = append(added, p)
+			default:
+				res.Updated++
+			}
+			if testHookAddBatch != nil {
+				testHookAddBatch(i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return AddResult{}, nil, err
+	}
+	return res, added, nil
+}
+
+// addTxn 在事務中寫入一個採集到的代理，返回是否為新代理，checkBad 為 true 時跳過已知失敗的代理
+func addTxn(txn *badger.Txn, p *Proxy, checkBad bool) (bool, error) {
+	val := p.DumpJSON()
+	if len(val) == 0 {
+		return false, fmt.Errorf("empty JSON value for proxy %s", p.String())
+	}
+
+	key := []byte(p.Key())
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		if checkBad {
+			if bad, err := isKnownBad(txn, p.Key()); err != nil || bad {
+				return false, cmp.Or(err, ErrKnownBad)
+			}
+		}
+		if err := txn.Set(key, val); err != nil {
+			return false, err
+		}
+		return true, Enqueue(txn, p.Key())
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var existing *Proxy
+	if err := item.Value(func(v []byte) error {
+		existing, err = LoadFromJSON(v)
+		return err
+	}); err != nil {
+		storeLog.Warnf("failed to parse existing proxy %s, replacing: %v", p.Key(), err)
+		existing = p
+	} else {
+		existing.MergeFrom(p)
+	}
+	// 從未驗證過的代理重新放回隊列（例如隊列記錄丟失），最近首次驗證即失敗的除外
+	if existing.Updated.IsZero() {
+		bad := false
+		if checkBad {
+			if bad, err = isKnownBad(txn, existing.Key()); err != nil {
+				return false, err
+			}
+		}
+		if !bad {
+			if err := Enqueue(txn, existing.Key()); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, txn.Set(key, existing.DumpJSON())
+}
+
+// SaveValidation 保存驗證後的代理並移出待驗證隊列（同時記錄或清除禁用時間），觸發 OnValidationResult；
+// 代理由可用變為禁用時另外觸發 OnProxyDisabled，由禁用恢復為可用時觸發 OnProxyRecovered。
+// 從未通過驗證的代理驗證失敗時記入已知失敗記錄（ValidationPolicy.KnownBadTTL 為 0 時不記錄）
+func (pl *Pool) SaveValidation(p *Proxy, healthy bool) error {
+	if pl.db == nil {
+		return errors.New("database not initialized")
+	}
+
+	badTTL := CurrentValidationPolicy().KnownBadTTL
+	wasDisabled := false
+	err := pl.db.Update(func(txn *badger.Txn) error {
+		key := []byte(p.Key())
+		if item, err := txn.Get(key); err == nil {
+			_ = item.Value(func(v []byte) error {
+				if prev, err := LoadFromJSON(v); err == nil {
+					wasDisabled = prev.Disable
+					// 標籤只由 SetTags 和採集合併修改，手動禁用只由 SetDisabled 修改，不被驗證期間持有的舊副本覆蓋
+					p.Tags = prev.Tags
+					p.ManualDisable = prev.ManualDisable
+					p.Disable = p.Disable || p.ManualDisable
+				}
+				return nil
+			})
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+		markDisabled(p)
+		return writeValidation(txn, p, healthy, badTTL)
+	})
+	if err != nil {
+		return err
+	}
+	pl.validationHooks(p, healthy, wasDisabled)
+	return nil
+}
+
+// applyValidationAttempts 應用驗證結果因並發寫入（採集、標籤、手動禁用等）衝突而失敗時的最多嘗試次數
+const applyValidationAttempts = 3
+
+// testHookApplyValidation 測試用：應用驗證結果的事務讀取代理記錄後調用
+var testHookApplyValidation func()
+
+// ApplyValidation 把 Validate 的結果應用到數據庫中代理的當前記錄（而不是驗證開始時讀取的副本，
+// 驗證期間其他寫入的字段不會被覆蓋）並移出待驗證隊列，返回更新後的記錄；回調與已知失敗記錄同 SaveValidation。
+// 與其他寫入衝突（badger.ErrConflict）時重新讀取記錄後重試。代理在驗證期間已被刪除時只移出隊列，返回 ErrProxyNotFound
+func (pl *Pool) ApplyValidation(r ValidationResult) (*Proxy, error) {
+	if pl.db == nil {
+		return nil, errors.New("database not initialized")
+	}
+
+	badTTL := CurrentValidationPolicy().KnownBadTTL
+	var p *Proxy
+	wasDisabled := false
+	var err error
+	for range applyValidationAttempts {
+		err = pl.db.Update(func(txn *badger.Txn) error {
+			p, wasDisabled = nil, false
+			item, err := txn.Get([]byte(r.Key))
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return Dequeue(txn, r.Key)
+			}
+			if err != nil {
+				return err
+			}
+			if err := item.Value(func(v []byte) error {
+				p, err = LoadFromJSON(v)
+				return err
+			}); err != nil {
+				return err
+			}
+			if testHookApplyValidation != nil {
+				testHookApplyValidation()
+			}
+			wasDisabled = p.Disable
+			r.ApplyTo(p)
+			markDisabled(p)
+			return writeValidation(txn, p, r.Healthy, badTTL)
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrProxyNotFound
+	}
+	pl.validationHooks(p, r.Healthy, wasDisabled)
+	return p, nil
+}
+
+// markDisabled 記錄代理被禁用的時間，恢復可用時清零
+func markDisabled(p *Proxy) {
+	switch {
+	case !p.Disable:
+		p.DisabledAt = time.Time{}
+	case p.DisabledAt.IsZero():
+		p.DisabledAt = time.Now()
+	}
+}
+
+// writeValidation 在事務中寫入驗證後的代理、更新已知失敗記錄並移出待驗證隊列
+func writeValidation(txn *badger.Txn, p *Proxy, healthy bool, badTTL time.Duration) error {
+	if err := txn.Set([]byte(p.Key()), p.DumpJSON()); err != nil {
+		return err
+	}
+	switch {
+	case healthy:
+		if err := txn.Delete(knownBadKey(p.Key())); err != nil {
+			return err
+		}
+	case p.Updated.IsZero() && badTTL > 0:
+		if err := markKnownBad(txn, p.Key(), badTTL); err != nil {
+			return err
+		}
+	}
+	return Dequeue(txn, p.Key())
+}
+
+// validationHooks 觸發驗證結果的回調
+func (pl *Pool) validationHooks(p *Proxy, healthy, wasDisabled bool) {
+	if pl.hooks.OnValidationResult != nil {
+		pl.hooks.OnValidationResult(p, healthy)
+	}
+	if p.Disable && !wasDisabled && pl.hooks.OnProxyDisabled != nil {
+		pl.hooks.OnProxyDisabled(p)
+	}
+	if !p.Disable && wasDisabled && pl.hooks.OnProxyRecovered != nil {
+		pl.hooks.OnProxyRecovered(p)
+	}
+}
+
+// SetTags 替換代理（ip:port）的標籤並返回更新後的記錄，代理不存在時返回 ErrProxyNotFound
+func (pl *Pool) SetTags(key string, tags []string) (*Proxy, error) {
+	if pl.db == nil {
+		return nil, errors.New("database not initialized")
+	}
+
+	var p *Proxy
+	err := pl.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrProxyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := item.Value(func(v []byte) error {
+			p, err = LoadFromJSON(v)
+			return err
+		}); err != nil {
+			return err
+		}
+		p.Tags = NormalizeTags(tags)
+		return txn.Set([]byte(key), p.DumpJSON())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetDisabled 手動禁用或啟用代理（ip:port）並返回更新後的記錄，代理不存在時返回 ErrProxyNotFound。
+// 手動禁用的代理驗證通過也不恢復可用；啟用清除手動禁用並立即恢復可用，之後由驗證結果決定禁用狀態。
+// 狀態變化時觸發 OnProxyDisabled 或 OnProxyRecovered
+func (pl *Pool) SetDisabled(key string, disabled bool) (*Proxy, error) {
+	if pl.db == nil {
+		return nil, errors.New("database not initialized")
+	}
+
+	var p *Proxy
+	wasDisabled := false
+	err := pl.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrProxyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := item.Value(func(v []byte) error {
+			p, err = LoadFromJSON(v)
+			return err
+		}); err != nil {
+			return err
+		}
+		wasDisabled = p.Disable
+		p.ManualDisable, p.Disable = disabled, disabled
+		markDisabled(p)
+		return txn.Set([]byte(key), p.DumpJSON())
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p.Disable && !wasDisabled && pl.hooks.OnProxyDisabled != nil {
+		pl.hooks.OnProxyDisabled(p)
+	}
+	if !p.Disable && wasDisabled && pl.hooks.OnProxyRecovered != nil {
+		pl.hooks.OnProxyRecovered(p)
+	}
+	return p, nil
+}
+
+// MarkTampering 把數據庫中的代理（ip:port）標記為篡改響應內容並禁用，返回更新後的記錄；
+// 修改的是當前記錄而不是調用方持有的副本，並發的驗證結果不會被覆蓋。回調同 SaveValidation（驗證失敗），
+// 代理不存在時返回 ErrProxyNotFound
+func (pl *Pool) MarkTampering(key string) (*Proxy, error) {
+	if pl.db == nil {
+		return nil, errors.New("database not initialized")
+	}
+
+	badTTL := CurrentValidationPolicy().KnownBadTTL
+	var p *Proxy
+	wasDisabled := false
+	err := pl.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrProxyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := item.Value(func(v []byte) error {
+			p, err = LoadFromJSON(v)
+			return err
+		}); err != nil {
+			return err
+		}
+		wasDisabled = p.Disable
+		p.Disable, p.Tampering = true, true
+		markDisabled(p)
+		return writeValidation(txn, p, false, badTTL)
+	})
+	if err != nil {
+		return nil, err
+	}
+	pl.validationHooks(p, false, wasDisabled)
+	return p, nil
+}
+
+// Delete 在一個事務中刪除代理記錄及其使用統計並移出待驗證隊列，每個被刪除的代理觸發 OnProxyDeleted；
+// 返回實際刪除的數量
+func (pl *Pool) Delete(keys ...string) (int, error) {
+	if pl.db == nil {
+		return 0, errors.New("database not initialized")
+	}
+
+	type deleted struct {
+		key   string
+		proxy *Proxy
+	}
+	var removed []deleted
+	err := pl.db.Update(func(txn *badger.Txn) error {
+		for _, key := range keys {
+			item, err := txn.Get([]byte(key))
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				if err := Dequeue(txn, key); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			var p *Proxy
+			if pl.hooks.OnProxyDeleted != nil {
+				_ = item.Value(func(v []byte) error {
+					p, _ = LoadFromJSON(v)
+					return nil
+				})
+			}
+			if err := txn.Delete([]byte(key)); err != nil {
+				return err
+			}
+			if err := Dequeue(txn, key); err != nil {
+				return err
+			}
+			if err := deleteStats(txn, key); err != nil {
+				return err
+			}
+			removed = append(removed, deleted{key, p})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if pl.hooks.OnProxyDeleted != nil {
+		for _, d := range removed {
+			pl.hooks.OnProxyDeleted(d.key, d.proxy)
+		}
+	}
+	return len(removed), nil
+}
+
+// replaceDeleteBatch Replace 刪除多餘代理時每個事務處理的代理數
+const replaceDeleteBatch = 1000
+
+// ReplaceResult 同步代理記錄的統計
+type ReplaceResult struct {
+	Written   int // 新增或內容有變化而覆蓋的代理數
+	Unchanged int // 內容相同而跳過的代理數
+	Deleted   int // 不在同步列表中而被刪除的代理數
+}
+
+// Replace 使代理記錄與 ps 一致：新代理和內容有變化的代理原樣寫入（不合併、不進入待驗證隊列），
+// 不在 ps 中的代理經由 Delete 分批刪除；用於只讀副本從主實例同步代理池
+func (pl *Pool) Replace(ps []*Proxy) (ReplaceResult, error) {
+	var res ReplaceResult
+	if pl.db == nil {
+		return res, errors.New("database not initialized")
+	}
+
+	existing := make(map[string][]byte)
+	err := pl.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if IsMetaKey(item.Key()) {
+				continue
+			}
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			existing[string(item.Key())] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+
+	wb := pl.db.NewWriteBatch()
+	defer wb.Cancel()
+	keep := make(map[string]bool, len(ps))
+	for _, p := range ps {
+		key := p.Key()
+		keep[key] = true
+		val := p.DumpJSON()
+		if bytes.Equal(existing[key], val) {
+			res.Unchanged++
+			continue
+		}
+		if err := wb.Set([]byte(key), val); err != nil {
+			return res, err
+		}
+		res.Written++
+	}
+	if err := wb.Flush(); err != nil {
+		return res, err
+	}
+
+	var stale []string
+	for key := range existing {
+		if !keep[key] {
+			stale = append(stale, key)
+		}
+	}
+	for batch := range slices.Chunk(stale, replaceDeleteBatch) {
+		n, err := pl.Delete(batch...)
+		res.Deleted += n
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// mergeBatch Merge 每個事務處理的代理數
+const mergeBatch = 500
+
+// MergeResult 合併其他實例驗證結果的統計
+type MergeResult struct {
+	Added   int // 本地沒有而寫入的代理數
+	Updated int // 對方驗證時間較新、採用對方驗證狀態的代理數
+	Skipped int // 本地驗證結果不比對方舊而跳過的代理數
+}
+
+// Merge 合併其他實例（集群成員）驗證過的代理記錄，按健康評分時間（ScoredAt）較新者為準：
+// 本地沒有且對方驗證可用的代理原樣寫入並觸發 OnProxyAdded；對方較新時採用對方的驗證狀態，保留本地的標籤、來源、
+// 入庫時間、使用次數和手動禁用。合併的代理移出待驗證隊列；未驗證過的記錄被忽略
+func (pl *Pool) Merge(ps []*Proxy) (MergeResult, error) {
+	var res MergeResult
+	if pl.db == nil {
+		return res, errors.New("database not initialized")
+	}
+
+	for batch := range slices.Chunk(ps, mergeBatch) {
+		var added []*Proxy
+		var batchRes MergeResult
+		err := pl.db.Update(func(txn *badger.Txn) error {
+			added, batchRes = nil, MergeResult{}
+			for _, p := range batch {
+				if p.ScoredAt.IsZero() {
+					continue
+				}
+				merged, isNew, err := mergeTxn(txn, p)
+				if err != nil {
+					return err
+				}
+				switch {
+				case isNew:
+					added = append(added, p)
+					batchRes.Added++
+				case merged:
+					batchRes.Updated++
+				default:
+					batchRes.Skipped++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return res, err
+		}
+		res.Added += batchRes.Added
+		res.Updated += batchRes.Updated
+		res.Skipped += batchRes.Skipped
+		if pl.hooks.OnProxyAdded != nil {
+			for _, p := range added {
+				pl.hooks.OnProxyAdded(p)
+			}
+		}
+	}
+	return res, nil
+}
+
+// mergeTxn 在事務中合併一個其他實例驗證過的代理，返回是否寫入及是否為新代理
+func mergeTxn(txn *badger.Txn, p *Proxy) (merged, isNew bool, err error) {
+	key := []byte(p.Key())
+	var local *Proxy
+	item, err := txn.Get(key)
+	switch {
+	case errors.Is(err, badger.ErrKeyNotFound):
+		isNew = true
+	case err != nil:
+		return false, false, err
+	default:
+		if err := item.Value(func(v []byte) error {
+			local, err = LoadFromJSON(v)
+			return err
+		}); err != nil {
+			storeLog.Warnf("failed to parse existing proxy %s, replacing: %v", p.Key(), err)
+			local = nil
+		}
+	}
+
+	// 本地沒有的代理只接收對方驗證可用的
+	if isNew && p.Disable {
+		return false, false, nil
+	}
+	rec := *p
+	if local != nil {
+		if !local.ScoredAt.Before(p.ScoredAt) {
+			return false, false, nil
+		}
+		rec.Tags, rec.Source, rec.Added, rec.Count = local.Tags, local.Source, local.Added, local.Count
+		// 手動禁用只由本地的 SetDisabled 修改，對方的驗證結果不會重新啟用
+		rec.ManualDisable = local.ManualDisable
+		if rec.ManualDisable {
+			rec.Disable, rec.DisabledAt = true, local.DisabledAt
+		}
+	} else {
+		rec.ManualDisable = false
+	}
+	markDisabled(&rec)
+	if err := txn.Set(key, rec.DumpJSON()); err != nil {
+		return false, false, err
+	}
+	return true, isNew, Dequeue(txn, p.Key())
+}
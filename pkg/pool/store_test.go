@@ -0,0 +1,522 @@
+package pool
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// hookLog 記錄回調觸發情況
+type hookLog struct {
+	added, disabled, recovered, deleted []string
+	results                             map[string]bool
+}
+
+func (h *hookLog) hooks() Hooks {
+	h.results = make(map[string]bool)
+	return Hooks{
+		OnProxyAdded:       func(p *Proxy) { h.added = append(h.added, p.Key()) },
+		OnProxyDisabled:    func(p *Proxy) { h.disabled = append(h.disabled, p.Key()) },
+		OnProxyRecovered:   func(p *Proxy) { h.recovered = append(h.recovered, p.Key()) },
+		OnProxyDeleted:     func(key string, p *Proxy) { h.deleted = append(h.deleted, key) },
+		OnValidationResult: func(p *Proxy, healthy bool) { h.results[p.Key()] = healthy },
+	}
+}
+
+func TestAddHooks(t *testing.T) {
+	var h hookLog
+	db := newTestDB(t, &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: time.Now()})
+	pl := New(db, WithHooks(h.hooks()))
+
+	added, err := pl.Add(&Proxy{IP: "2.2.2.2", Port: "80", Protocol: "http", Source: "a"})
+	if err != nil || !added {
+		t.Fatalf("Add(new) = %v, %v; want true", added, err)
+	}
+	added, err = pl.Add(&Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Source: "b"})
+	if err != nil || added {
+		t.Fatalf("Add(existing) = %v, %v; want false", added, err)
+	}
+	if len(h.added) != 1 || h.added[0] != "2.2.2.2:80" {
+		t.Errorf("OnProxyAdded = %v, want [2.2.2.2:80]", h.added)
+	}
+
+	// 新代理進入待驗證隊列，已驗證過的代理不進入
+	if err := db.View(func(txn *badger.Txn) error {
+		for key, want := range map[string]bool{"2.2.2.2:80": true, "1.1.1.1:80": false} {
+			if got, err := Queued(txn, key); err != nil || got != want {
+				t.Errorf("Queued(%s) = %v, %v; want %v", key, got, err, want)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddBatch(t *testing.T) {
+	var h hookLog
+	db := newTestDB(t, &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: time.Now()})
+	pl := New(db, WithHooks(h.hooks()))
+
+	// 先讓 3.3.3.3 成為已知失敗記錄
+	bad := &Proxy{IP: "3.3.3.3", Port: "80", Protocol: "http", Disable: true}
+	if err := pl.SaveValidation(bad, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pl.Delete(bad.Key()); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := pl.AddBatch([]*Proxy{
+		{IP: "1.1.1.1", Port: "80", Protocol: "http", Source: "a"},
+		{IP: "2.2.2.2", Port: "80", Protocol: "http", Source: "a"},
+		{IP: "2.2.2.2", Port: "80", Protocol: "socks5", Source: "b"}, // 同一批次中重複
+		{IP: "3.3.3.3", Port: "80", Protocol: "http"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (AddResult{Added: 1, Updated: 2, KnownBad: 1}); res != want {
+		t.Errorf("AddBatch = %+v, want %+v", res, want)
+	}
+	if !slices.Equal(h.added, []string{"2.2.2.2:80"}) {
+		t.Errorf("OnProxyAdded = %v, want [2.2.2.2:80]", h.added)
+	}
+	if err := db.View(func(txn *badger.Txn) error {
+		if queued, err := Queued(txn, "2.2.2.2:80"); err != nil || !queued {
+			t.Errorf("Queued(2.2.2.2:80) = %v, %v; want true", queued, err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddBatchConflict(t *testing.T) {
+	var h hookLog
+	db := newTestDB(t, &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: time.Now()})
+	pl := New(db, WithHooks(h.hooks()))
+
+	// 第一次嘗試讀取 1.1.1.1 後，另一個事務提交了對它的修改
+	calls := 0
+	testHookAddBatch = func(i int) {
+		if calls++; calls == 1 {
+			if _, err := pl.SetTags("1.1.1.1:80", []string{"paid"}); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	defer func() { testHookAddBatch = nil }()
+
+	res, err := pl.AddBatch([]*Proxy{
+		{IP: "1.1.1.1", Port: "80", Protocol: "http", Source: "a"},
+		{IP: "2.2.2.2", Port: "80", Protocol: "http", Source: "a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (AddResult{Added: 1, Updated: 1}); res != want {
+		t.Errorf("AddBatch = %+v, want %+v", res, want)
+	}
+	if !slices.Equal(h.added, []string{"2.2.2.2:80"}) {
+		t.Errorf("OnProxyAdded = %v, want [2.2.2.2:80]", h.added)
+	}
+	if err := db.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get([]byte("2.2.2.2:80")); err != nil {
+			t.Errorf("2.2.2.2:80 not stored: %v", err)
+		}
+		item, err := txn.Get([]byte("1.1.1.1:80"))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			p, err := LoadFromJSON(v)
+			if err == nil && (p.Source != "a" || !slices.Equal(p.Tags, []string{"paid"})) {
+				t.Errorf("1.1.1.1:80 = source %q, tags %v; want both writes kept", p.Source, p.Tags)
+			}
+			return err
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if calls <= 2 {
+		t.Errorf("batch written in %d steps, want a retry after the conflict", calls)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	var h hookLog
+	now := time.Now().Truncate(time.Second)
+	same := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: now}
+	db := newTestDB(t,
+		same,
+		&Proxy{IP: "2.2.2.2", Port: "80", Protocol: "http", Updated: now},
+		&Proxy{IP: "3.3.3.3", Port: "80", Protocol: "http", Updated: now},
+	)
+	if err := SaveMeta(db, "run", map[string]string{"mode": "serve"}); err != nil {
+		t.Fatal(err)
+	}
+	pl := New(db, WithHooks(h.hooks()))
+
+	res, err := pl.Replace([]*Proxy{
+		same,
+		{IP: "2.2.2.2", Port: "80", Protocol: "socks5", Updated: now, Disable: true},
+		{IP: "4.4.4.4", Port: "80", Protocol: "http", Updated: now},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ReplaceResult{Written: 2, Unchanged: 1, Deleted: 1}); res != want {
+		t.Errorf("Replace = %+v, want %+v", res, want)
+	}
+	if !slices.Equal(h.deleted, []string{"3.3.3.3:80"}) {
+		t.Errorf("OnProxyDeleted = %v, want [3.3.3.3:80]", h.deleted)
+	}
+	if len(h.added) != 0 {
+		t.Errorf("OnProxyAdded = %v, want none", h.added)
+	}
+
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("2.2.2.2:80"))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			p, err := LoadFromJSON(v)
+			if err == nil && (p.Protocol != "socks5" || !p.Disable) {
+				t.Errorf("2.2.2.2:80 = %+v, want the replaced record", p)
+			}
+			// 同步寫入的代理不進入待驗證隊列
+			if queued, _ := Queued(txn, "4.4.4.4:80"); queued {
+				t.Error("replaced proxy queued for validation")
+			}
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta map[string]string
+	if ok, err := LoadMeta(db, "run", &meta); !ok || err != nil {
+		t.Errorf("metadata removed by Replace: %v, %v", ok, err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var h hookLog
+	now := time.Now().Truncate(time.Second)
+	db := newTestDB(t,
+		&Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: now, ScoredAt: now, Score: 0.9, Tags: []string{"paid"}, Source: "a"},
+		&Proxy{IP: "2.2.2.2", Port: "80", Protocol: "http", Updated: now, ScoredAt: now, Score: 0.9},
+	)
+	pl := New(db, WithHooks(h.hooks()))
+
+	later := now.Add(time.Minute)
+	res, err := pl.Merge([]*Proxy{
+		{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: now, ScoredAt: later, Score: 0.3, Disable: true, Source: "b"}, // 對方較新
+		{IP: "2.2.2.2", Port: "80", Protocol: "http", Updated: now, ScoredAt: now.Add(-time.Minute), Score: 0.1},             // 本地較新
+		{IP: "3.3.3.3", Port: "80", Protocol: "http", Updated: later, ScoredAt: later, Score: 0.75},                          // 新代理
+		{IP: "4.4.4.4", Port: "80", Protocol: "http", ScoredAt: later, Score: 0.25, Disable: true},                           // 本地沒有且不可用
+		{IP: "5.5.5.5", Port: "80", Protocol: "http"},                                                                        // 未驗證
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MergeResult{Added: 1, Updated: 1, Skipped: 2}); res != want {
+		t.Errorf("Merge = %+v, want %+v", res, want)
+	}
+	if !slices.Equal(h.added, []string{"3.3.3.3:80"}) {
+		t.Errorf("OnProxyAdded = %v, want [3.3.3.3:80]", h.added)
+	}
+
+	got := make(map[string]*Proxy)
+	err = db.View(func(txn *badger.Txn) error {
+		for _, key := range []string{"1.1.1.1:80", "2.2.2.2:80", "3.3.3.3:80", "4.4.4.4:80"} {
+			item, err := txn.Get([]byte(key))
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := item.Value(func(v []byte) error {
+				got[key], err = LoadFromJSON(v)
+				return err
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := got["1.1.1.1:80"]; !p.Disable || p.Score != 0.3 || p.Source != "a" || !slices.Equal(p.Tags, []string{"paid"}) {
+		t.Errorf("1.1.1.1:80 = %+v, want the peer's verdict with local tags and source", p)
+	}
+	if p := got["2.2.2.2:80"]; p.Score != 0.9 {
+		t.Errorf("2.2.2.2:80 score = %v, want the newer local 0.9", p.Score)
+	}
+	if _, ok := got["4.4.4.4:80"]; ok {
+		t.Error("unhealthy proxy unknown locally was merged")
+	}
+}
+
+func TestMergeKeepsManualDisable(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	db := newTestDB(t, &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: now, ScoredAt: now, Score: 0.9})
+	pl := New(db)
+	if _, err := pl.SetDisabled("1.1.1.1:80", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// 對方較新的驗證結果為可用，手動禁用仍然保留
+	later := now.Add(time.Minute)
+	res, err := pl.Merge([]*Proxy{{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: later, ScoredAt: later, Score: 0.95}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Updated != 1 {
+		t.Fatalf("Merge = %+v, want the newer verdict merged", res)
+	}
+	var got *Proxy
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("1.1.1.1:80"))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			got, err = LoadFromJSON(v)
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Disable || !got.ManualDisable || got.DisabledAt.IsZero() || got.Score != 0.95 {
+		t.Errorf("after Merge: disable %v, manual %v, disabled_at %v, score %v; want the peer's score with the manual disable kept",
+			got.Disable, got.ManualDisable, got.DisabledAt, got.Score)
+	}
+}
+
+func TestSaveValidationHooks(t *testing.T) {
+	var h hookLog
+	healthy := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: time.Now()}
+	disabled := &Proxy{IP: "2.2.2.2", Port: "80", Protocol: "http", Updated: time.Now(), Disable: true}
+	db := newTestDB(t, healthy, disabled)
+	pl := New(db, WithHooks(h.hooks()))
+
+	// 可用 -> 禁用觸發 OnProxyDisabled
+	healthy.Disable = true
+	if err := pl.SaveValidation(healthy, false); err != nil {
+		t.Fatal(err)
+	}
+	// 已禁用的代理再次驗證失敗不重複觸發
+	if err := pl.SaveValidation(disabled, false); err != nil {
+		t.Fatal(err)
+	}
+	if healthy.DisabledAt.IsZero() {
+		t.Error("SaveValidation should record when the proxy was disabled")
+	}
+	if len(h.disabled) != 1 || h.disabled[0] != "1.1.1.1:80" {
+		t.Errorf("OnProxyDisabled = %v, want [1.1.1.1:80]", h.disabled)
+	}
+	if len(h.results) != 2 || h.results["1.1.1.1:80"] || h.results["2.2.2.2:80"] {
+		t.Errorf("OnValidationResult = %v", h.results)
+	}
+
+	// 禁用 -> 可用觸發 OnProxyRecovered
+	disabled.Disable = false
+	if err := pl.SaveValidation(disabled, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.recovered) != 1 || h.recovered[0] != "2.2.2.2:80" {
+		t.Errorf("OnProxyRecovered = %v, want [2.2.2.2:80]", h.recovered)
+	}
+}
+
+func TestDeleteHooks(t *testing.T) {
+	var h hookLog
+	db := newTestDB(t,
+		&Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http"},
+		&Proxy{IP: "2.2.2.2", Port: "80", Protocol: "http"},
+	)
+	if err := db.Update(func(txn *badger.Txn) error { return Enqueue(txn, "1.1.1.1:80") }); err != nil {
+		t.Fatal(err)
+	}
+	pl := New(db, WithHooks(h.hooks()))
+
+	n, err := pl.Delete("1.1.1.1:80", "9.9.9.9:80")
+	if err != nil || n != 1 {
+		t.Fatalf("Delete = %d, %v; want 1", n, err)
+	}
+	if len(h.deleted) != 1 || h.deleted[0] != "1.1.1.1:80" {
+		t.Errorf("OnProxyDeleted = %v, want [1.1.1.1:80]", h.deleted)
+	}
+	if l, err := QueueLen(db); err != nil || l != 0 {
+		t.Errorf("QueueLen after delete = %d, %v; want 0", l, err)
+	}
+	if err := db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("2.2.2.2:80"))
+		return err
+	}); err != nil {
+		t.Errorf("undeleted proxy missing: %v", err)
+	}
+}
+
+func TestSetTags(t *testing.T) {
+	p := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: time.Now()}
+	db := newTestDB(t, p)
+	pl := New(db)
+
+	got, err := pl.SetTags(p.Key(), []string{" Paid", "residential", "paid", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"paid", "residential"}; !slices.Equal(got.Tags, want) {
+		t.Errorf("tags = %v, want %v", got.Tags, want)
+	}
+	if _, err := pl.SetTags("9.9.9.9:80", []string{"paid"}); !errors.Is(err, ErrProxyNotFound) {
+		t.Errorf("SetTags(missing) err = %v, want ErrProxyNotFound", err)
+	}
+
+	// 驗證結果使用設置標籤前讀取的副本，保存時不應覆蓋標籤；採集合併時取並集
+	if err := pl.SaveValidation(p, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pl.Add(&Proxy{IP: "1.1.1.1", Port: "80", Tags: []string{"datacenter"}}); err != nil {
+		t.Fatal(err)
+	}
+	selected, err := pl.Select(Criteria{Tags: []string{"datacenter", "paid", "residential"}})
+	if err != nil {
+		t.Fatalf("select by tags: %v", err)
+	}
+	if selected.Key() != p.Key() {
+		t.Errorf("selected %s", selected.Key())
+	}
+}
+
+func TestSetDisabled(t *testing.T) {
+	var h hookLog
+	p := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: time.Now(), Score: 1, ScoredAt: time.Now()}
+	db := newTestDB(t, p)
+	pl := New(db, WithHooks(h.hooks()))
+
+	got, err := pl.SetDisabled(p.Key(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Disable || !got.ManualDisable || got.DisabledAt.IsZero() {
+		t.Errorf("after disable: %+v", got)
+	}
+	if !slices.Equal(h.disabled, []string{p.Key()}) {
+		t.Errorf("OnProxyDisabled = %v", h.disabled)
+	}
+	if _, err := pl.SetDisabled("9.9.9.9:80", true); !errors.Is(err, ErrProxyNotFound) {
+		t.Errorf("SetDisabled(missing) err = %v, want ErrProxyNotFound", err)
+	}
+
+	// 驗證通過不恢復手動禁用的代理，驗證期間持有的舊副本也不清除手動禁用
+	saved, err := pl.ApplyValidation(ValidationResult{Key: p.Key(), Tested: true, Healthy: true, Protocol: "http", CheckedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.Disable {
+		t.Error("validation recovered a manually disabled proxy")
+	}
+	p.RecordResult(true)
+	if err := pl.SaveValidation(p, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pl.Select(Criteria{}); !errors.Is(err, ErrNoProxies) {
+		t.Errorf("Select with the only proxy disabled = %v, want ErrNoProxies", err)
+	}
+
+	got, err = pl.SetDisabled(p.Key(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Disable || got.ManualDisable || !got.DisabledAt.IsZero() {
+		t.Errorf("after enable: %+v", got)
+	}
+	if !slices.Equal(h.recovered, []string{p.Key()}) {
+		t.Errorf("OnProxyRecovered = %v", h.recovered)
+	}
+}
+
+func TestMarkTampering(t *testing.T) {
+	var h hookLog
+	p := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: time.Now()}
+	db := newTestDB(t, p)
+	pl := New(db, WithHooks(h.hooks()))
+
+	// 調用方持有的副本不變，並發寫入的字段保留
+	if _, err := pl.SetTags(p.Key(), []string{"paid"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := pl.MarkTampering(p.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Disable || !got.Tampering || got.DisabledAt.IsZero() || !slices.Equal(got.Tags, []string{"paid"}) {
+		t.Errorf("after MarkTampering: %+v", got)
+	}
+	if p.Disable || p.Tampering {
+		t.Error("MarkTampering modified the caller's proxy")
+	}
+	if !slices.Equal(h.disabled, []string{p.Key()}) || h.results[p.Key()] {
+		t.Errorf("hooks: disabled %v, results %v", h.disabled, h.results)
+	}
+	if _, err := pl.MarkTampering("9.9.9.9:80"); !errors.Is(err, ErrProxyNotFound) {
+		t.Errorf("MarkTampering(missing) err = %v, want ErrProxyNotFound", err)
+	}
+}
+
+func TestKnownBad(t *testing.T) {
+	db := newTestDB(t)
+	pl := New(db)
+	p := &Proxy{IP: "3.3.3.3", Port: "80", Protocol: "http"}
+	if _, err := pl.Add(p); err != nil {
+		t.Fatal(err)
+	}
+
+	// 首次驗證即失敗：記入已知失敗，再次採集到時不重新進入隊列
+	p.Disable = true
+	if err := pl.SaveValidation(p, false); err != nil {
+		t.Fatal(err)
+	}
+	if added, err := pl.Add(&Proxy{IP: "3.3.3.3", Port: "80", Protocol: "http"}); err != nil || added {
+		t.Fatalf("Add(existing known bad) = %v, %v; want false, nil", added, err)
+	}
+	if err := db.View(func(txn *badger.Txn) error {
+		if queued, err := Queued(txn, p.Key()); err != nil || queued {
+			t.Errorf("Queued(%s) = %v, %v; want false", p.Key(), queued, err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 記錄被清理後再次採集到時跳過
+	if _, err := pl.Delete(p.Key()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pl.Add(&Proxy{IP: "3.3.3.3", Port: "80", Protocol: "http"}); !errors.Is(err, ErrKnownBad) {
+		t.Fatalf("Add(deleted known bad) err = %v, want ErrKnownBad", err)
+	}
+	if n, err := KnownBadCount(db); err != nil || n != 1 {
+		t.Errorf("KnownBadCount = %d, %v; want 1", n, err)
+	}
+
+	// 曾經通過驗證的代理失敗不記錄
+	ok := &Proxy{IP: "4.4.4.4", Port: "80", Protocol: "http", Updated: time.Now(), Disable: true}
+	if err := pl.SaveValidation(ok, false); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := KnownBadCount(db); n != 1 {
+		t.Errorf("KnownBadCount = %d after failing a validated proxy, want 1", n)
+	}
+}
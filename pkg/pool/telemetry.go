@@ -0,0 +1,35 @@
+package pool
+
+import (
+	"errors"
+
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+	"go.opentelemetry.io/otel"
+)
+
+// tracer 代理選擇、撥號與驗證的追蹤器：未配置 OpenTelemetry SDK 時為空操作
+var tracer = otel.Tracer("github.com/e2u/dynamic-proxy/pkg/pool")
+
+// 驗證結果
+const (
+	validationValid   = "valid"
+	validationInvalid = "invalid"
+)
+
+var (
+	selectionDuration = metrics.NewHistogramVec("dynamic_proxy_selection_duration_seconds",
+		"Time to select an upstream proxy from the pool, by result.", []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}, "result")
+	validationDuration = metrics.NewHistogramVec("dynamic_proxy_validation_duration_seconds",
+		"Time to validate a proxy, by result.", metrics.DurationBuckets, "result")
+)
+
+// selectionResult 選擇結果的指標標籤：selected、empty（沒有滿足條件的代理）或 error
+func selectionResult(err error) string {
+	switch {
+	case err == nil:
+		return "selected"
+	case errors.Is(err, ErrNoProxies):
+		return "empty"
+	}
+	return "error"
+}
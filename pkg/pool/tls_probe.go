@@ -0,0 +1,64 @@
+package pool
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+)
+
+// probeTLS 經由代理與 HTTPS 檢測目標完成一次 TLS 握手，返回協商的 TLS 版本（握手失敗時為空）和握手耗時，
+// 用於記錄 HTTPS 是否端到端可用；不少代理接受 CONNECT 後立即斷開隧道，只檢查 CONNECT 響應無法發現。
+// 沒有 https 檢測目標時不探測，probed 為 false
+func probeTLS(p *Proxy, policy ValidationPolicy) (version string, handshake time.Duration, probed bool) {
+	target := randomURL(append(slices.Clone(policy.TestURLs), policy.Targets...), true)
+	if target == "" {
+		return "", 0, false
+	}
+
+	v, elapsed, err := handshakeVia(p, target, policy.Timeout, nil)
+	if err != nil {
+		validatorLog.WithFields(logger.Fields{"proxy": p.String(), "url": target}).WithError(err).Debug("TLS handshake through proxy failed")
+		return "", 0, true
+	}
+	return tls.VersionName(v), elapsed, true
+}
+
+// handshakeVia 經由代理連接 target 的主機並完成 TLS 握手，返回協商的 TLS 版本和握手耗時（不含建立隧道）；
+// config 為 nil 時使用系統根證書
+func handshakeVia(p *Proxy, target string, timeout time.Duration, config *tls.Config) (uint16, time.Duration, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return 0, 0, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := Dial(ctx, &net.Dialer{}, p, "tcp", addr)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+
+	cfg := config.Clone()
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg.ServerName = u.Hostname()
+
+	start := time.Now()
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return 0, 0, err
+	}
+	return tlsConn.ConnectionState().Version, time.Since(start), nil
+}
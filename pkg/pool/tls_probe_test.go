@@ -0,0 +1,74 @@
+package pool
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newConnectProxy 啟動測試用 CONNECT 代理；kill 為 true 時返回 200 後立即斷開隧道
+func newConnectProxy(t *testing.T, kill bool) *Proxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	serveConnect(ln, kill)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	return &Proxy{IP: host, Port: port, Protocol: "http"}
+}
+
+// serveConnect 在 ln 上提供 CONNECT 代理
+func serveConnect(ln net.Listener, kill bool) {
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				if kill {
+					return
+				}
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+}
+
+func TestHandshakeVia(t *testing.T) {
+	origin := httptest.NewTLSServer(http.NotFoundHandler())
+	defer origin.Close()
+	config := origin.Client().Transport.(*http.Transport).TLSClientConfig
+
+	version, _, err := handshakeVia(newConnectProxy(t, false), origin.URL, 5*time.Second, config)
+	if err != nil {
+		t.Fatalf("handshake through tunnel: %v", err)
+	}
+	if version < tls.VersionTLS12 {
+		t.Errorf("negotiated %s", tls.VersionName(version))
+	}
+
+	if _, _, err := handshakeVia(newConnectProxy(t, true), origin.URL, 5*time.Second, config); err == nil {
+		t.Error("handshake should fail when the proxy kills the tunnel")
+	}
+}
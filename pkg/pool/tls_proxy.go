@@ -0,0 +1,152 @@
+package pool
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	proxyTLSMu     sync.RWMutex
+	proxyTLSConfig *tls.Config
+)
+
+// SetProxyTLSConfig 設置連接 https 上遊代理（與代理之間使用 TLS）時的 TLS 配置，
+// nil 表示使用系統根證書校驗代理證書；未設置 ServerName 時按代理地址校驗
+func SetProxyTLSConfig(cfg *tls.Config) {
+	proxyTLSMu.Lock()
+	proxyTLSConfig = cfg
+	proxyTLSMu.Unlock()
+}
+
+// proxyTLSClientConfig 連接代理 p 時使用的 TLS 配置
+func proxyTLSClientConfig(p *Proxy) *tls.Config {
+	proxyTLSMu.RLock()
+	cfg := proxyTLSConfig.Clone()
+	proxyTLSMu.RUnlock()
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = p.IP
+	}
+	// 隧道內還要再協商目標的協議，與代理之間只使用 HTTP/1.1
+	cfg.NextProtos = []string{"http/1.1"}
+	return cfg
+}
+
+// dialProxyTLS 連接 https 代理並完成 TLS 握手
+func dialProxyTLS(ctx context.Context, dialer *net.Dialer, proxy *Proxy) (net.Conn, error) {
+	addr := net.JoinHostPort(proxy.IP, proxy.Port)
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy %s: %w", addr, err)
+	}
+	tlsConn := tls.Client(conn, proxyTLSClientConfig(proxy))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with proxy %s failed: %w", addr, err)
+	}
+	return tlsConn, nil
+}
+
+// dialHTTPS 經由 https 代理連接：先與代理完成 TLS 握手，再在其中發送 CONNECT 建立隧道
+func dialHTTPS(ctx context.Context, dialer *net.Dialer, proxy *Proxy, addr string) (net.Conn, error) {
+	conn, err := dialProxyTLS(ctx, dialer, proxy)
+	if err != nil {
+		return nil, err
+	}
+	tunnel, err := connectTunnel(ctx, conn, proxy, addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// connectTunnel 在已連接代理的 conn 上發送 CONNECT（代理設置了用戶名密碼時帶 Proxy-Authorization），
+// 返回建立好的隧道；失敗時由調用方關閉 conn
+func connectTunnel(ctx context.Context, conn net.Conn, proxy *Proxy, addr string) (net.Conn, error) {
+	var req strings.Builder
+	fmt.Fprintf(&req, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
+	if proxy.User != "" && proxy.Pass != "" {
+		cred := base64.StdEncoding.EncodeToString([]byte(proxy.User + ":" + proxy.Pass))
+		fmt.Fprintf(&req, "Proxy-Authorization: Basic %s\r\n", cred)
+	}
+	req.WriteString("\r\n")
+
+	defer handshakeDeadline(ctx, conn)()
+	if _, err := conn.Write([]byte(req.String())); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	// 不讀取響應體：HTTP/1.0 的 CONNECT 響應沒有長度，讀取會一直等到隧道關閉
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proxy response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("proxy %s failed to establish connection: %s", proxy.Key(), resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, Reader: br}, nil
+	}
+	return conn, nil
+}
+
+// metaHTTPSMigrated 標記舊版 https 協議記錄已遷移
+const metaHTTPSMigrated = "https_protocol_migrated"
+
+// MigrateHTTPSProtocol 舊版把只支持 CONNECT 的明文 HTTP 代理記錄為 https，現在 https 表示與代理之間使用 TLS；
+// 把這些記錄改為 http（只執行一次），返回修改的記錄數
+func MigrateHTTPSProtocol(db *badger.DB) (int, error) {
+	var done bool
+	if _, err := LoadMeta(db, metaHTTPSMigrated, &done); err != nil || done {
+		return 0, err
+	}
+	changed := 0
+	err := db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		var keys, vals [][]byte
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if IsMetaKey(item.Key()) {
+				continue
+			}
+			var p *Proxy
+			if err := item.Value(func(v []byte) error {
+				p, _ = LoadFromJSON(v)
+				return nil
+			}); err != nil {
+				it.Close()
+				return err
+			}
+			if p == nil || p.Protocol != "https" {
+				continue
+			}
+			p.Protocol = "http"
+			keys = append(keys, item.KeyCopy(nil))
+			vals = append(vals, p.DumpJSON())
+		}
+		it.Close()
+		for i, key := range keys {
+			if err := txn.Set(key, vals[i]); err != nil {
+				return err
+			}
+		}
+		changed = len(keys)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate https proxies: %w", err)
+	}
+	return changed, SaveMeta(db, metaHTTPSMigrated, true)
+}
@@ -0,0 +1,59 @@
+package pool
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDialHTTPS(t *testing.T) {
+	// 借用 httptest 的證書（對 127.0.0.1 有效）作為代理證書
+	certSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certSrv.Close()
+	roots := certSrv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	serveConnect(tls.NewListener(ln, &tls.Config{Certificates: certSrv.TLS.Certificates}), false)
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	proxy := &Proxy{IP: host, Port: port, Protocol: "https"}
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer origin.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 不信任代理證書時握手失敗，不會退回明文或直連
+	SetProxyTLSConfig(nil)
+	if conn, err := Dial(ctx, &net.Dialer{}, proxy, "tcp", origin.Listener.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("dial through proxy with untrusted certificate succeeded")
+	}
+
+	SetProxyTLSConfig(&tls.Config{RootCAs: roots})
+	defer SetProxyTLSConfig(nil)
+	client := &http.Client{Transport: Transport(proxy, TransportOptions{}), Timeout: 5 * time.Second}
+	resp, err := client.Get(origin.URL)
+	if err != nil {
+		t.Fatalf("request through https proxy: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("body = %q, want ok", body)
+	}
+
+	if got, err := determineConnectionProtocol(host, port); err != nil || got != "https" {
+		t.Errorf("detected protocol = %q, %v, want https", got, err)
+	}
+}
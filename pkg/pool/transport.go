@@ -0,0 +1,169 @@
+package pool
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TransportOptions 代理 Transport 選項
+type TransportOptions struct {
+	Criteria              Criteria      // 代理篩選條件
+	ResponseHeaderTimeout time.Duration // 響應頭到達時限（0 表示不限制）
+	DialTimeout           time.Duration // 連接代理並完成代理握手的時限（0 表示 DefaultDialTimeout）
+	TLSHandshakeTimeout   time.Duration // 與 HTTPS 目標 TLS 握手的時限（0 表示 DefaultTLSHandshakeTimeout）
+	// OnDialError 經由代理連接失敗時回調（如通知輪換器換代理）
+	OnDialError func(p *Proxy, err error)
+	// TLSClientConfig 訪問 HTTPS 目標時的 TLS 配置（nil 表示使用系統根證書）
+	TLSClientConfig *tls.Config
+	// Resolve 目標主機名的解析方式：ResolveRemote（預設）或 ResolveLocal
+	Resolve string
+}
+
+// 連接上遊代理與 TLS 握手的預設時限
+const (
+	DefaultDialTimeout         = 30 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// 目標主機名的解析方式
+const (
+	// ResolveRemote 主機名原樣交給上遊代理解析（http 在 CONNECT 中發送主機名，socks5 使用域名地址類型），本機不發出 DNS 查詢
+	ResolveRemote = "remote"
+	// ResolveLocal 在本機解析主機名後以 IP 連接目標（上遊代理的 DNS 不可靠或被污染時使用，會向本機 DNS 暴露訪問的域名）
+	ResolveLocal = "local"
+)
+
+// resolveTarget 按解析方式處理目標地址：ResolveLocal 時在本機解析主機名並返回 ip:port，否則原樣返回
+func resolveTarget(ctx context.Context, mode, addr string) (string, error) {
+	if mode != ResolveLocal {
+		return addr, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return addr, nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", host, err)
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("resolve %s: no addresses", host)
+	}
+	return net.JoinHostPort(ips[0].Unmap().String(), port), nil
+}
+
+// newDialer 創建連接代理用的 Dialer
+func newDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
+}
+
+// dialTimeout 連接代理的時限
+func (o TransportOptions) dialTimeout() time.Duration {
+	if o.DialTimeout > 0 {
+		return o.DialTimeout
+	}
+	return DefaultDialTimeout
+}
+
+// dial 在時限內經由代理連接目標（時限同時覆蓋 CONNECT、SOCKS5 等代理握手）
+func (o TransportOptions) dial(ctx context.Context, p *Proxy, network, addr string) (net.Conn, error) {
+	ctx, span := tracer.Start(ctx, "proxy.dial", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("proxy.upstream", p.String()),
+		attribute.String("server.address", addr),
+	))
+	defer span.End()
+
+	timeout := o.dialTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := Dial(ctx, newDialer(timeout), p, network, addr)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return conn, err
+}
+
+// Transport 創建固定經由指定代理的 Transport
+func Transport(p *Proxy, opts TransportOptions) *http.Transport {
+	return newTransport(opts, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		addr, err := resolveTarget(ctx, opts.Resolve, addr)
+		if err != nil {
+			return nil, err
+		}
+		return opts.dial(ctx, p, network, addr)
+	})
+}
+
+// GetTransport 返回每個新連接都從池中隨機選擇代理的 RoundTripper，可直接用作 http.Client.Transport
+func (pl *Pool) GetTransport() http.RoundTripper {
+	return pl.TransportWith(TransportOptions{})
+}
+
+// TransportWith 按選項創建每個新連接都從池中選擇代理的 Transport
+func (pl *Pool) TransportWith(opts TransportOptions) *http.Transport {
+	return pl.TransportFunc(opts, func() (*Proxy, error) {
+		return pl.Select(opts.Criteria)
+	})
+}
+
+// TransportFunc 創建每個新連接都調用 pick 選擇代理的 Transport（用於自定義選擇邏輯，如按時間輪換）
+func (pl *Pool) TransportFunc(opts TransportOptions, pick func() (*Proxy, error)) *http.Transport {
+	return newTransport(opts, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// 解析失敗與代理無關，在選擇代理前處理
+		addr, err := resolveTarget(ctx, opts.Resolve, addr)
+		if err != nil {
+			return nil, err
+		}
+		_, span := tracer.Start(ctx, "proxy.select")
+		p, err := pick()
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+			return nil, fmt.Errorf("failed to select proxy from DB: %w", err)
+		}
+		span.SetAttributes(attribute.String("proxy.upstream", p.String()))
+		span.End()
+		poolLog.WithFields(logger.Fields{"proxy": p.String(), "url": addr}).Info("Selected upstream proxy")
+
+		conn, err := opts.dial(ctx, p, network, addr)
+		if err != nil && opts.OnDialError != nil {
+			opts.OnDialError(p, err)
+		}
+		return conn, err
+	})
+}
+
+// newTransport 創建不復用連接的 Transport，使每個請求都可以更換代理（需要復用連接時見 TransportCache）
+func newTransport(opts TransportOptions, dial func(ctx context.Context, network, addr string) (net.Conn, error)) *http.Transport {
+	tlsTimeout := opts.TLSHandshakeTimeout
+	if tlsTimeout <= 0 {
+		tlsTimeout = DefaultTLSHandshakeTimeout
+	}
+	return &http.Transport{
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		TLSClientConfig:       opts.TLSClientConfig,
+		DialContext:           dial,
+		// 每個請求都使用新的連接，這樣可以實現請求級別的代理更換
+		MaxIdleConns:        0,
+		IdleConnTimeout:     0 * time.Second,
+		TLSHandshakeTimeout: tlsTimeout,
+		DisableKeepAlives:   true,
+	}
+}
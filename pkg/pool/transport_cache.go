@@ -0,0 +1,124 @@
+package pool
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TransportCache 按上遊代理緩存的 Transport（LRU），經由同一代理的請求復用已建立的連接，
+// 省去每次的 TCP 與代理握手；每個請求仍可選擇不同的代理。可並發使用
+type TransportCache struct {
+	mu          sync.Mutex
+	size        int
+	idleTimeout time.Duration
+	opts        TransportOptions
+	order       *list.List // 最近使用的在前
+	items       map[string]*list.Element
+}
+
+// transportEntry 緩存項
+type transportEntry struct {
+	key       string
+	transport *http.Transport
+}
+
+// 連接復用的預設值
+const (
+	DefaultTransportCacheSize  = 64
+	DefaultUpstreamIdleTimeout = 90 * time.Second
+	// maxIdleConnsPerUpstream 每個上遊代理每個目標主機保留的空閒連接數
+	maxIdleConnsPerUpstream = 4
+)
+
+// NewTransportCache 創建最多緩存 size 個 Transport 的緩存，空閒連接在 idleTimeout 後關閉（0 表示使用預設值）
+func NewTransportCache(size int, idleTimeout time.Duration, opts TransportOptions) *TransportCache {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultUpstreamIdleTimeout
+	}
+	return &TransportCache{
+		size:        max(size, 1),
+		idleTimeout: idleTimeout,
+		opts:        opts,
+		order:       list.New(),
+		items:       make(map[string]*list.Element),
+	}
+}
+
+// transportKey 緩存鍵：同一 ip:port 的協議或憑據不同時使用不同的 Transport
+func transportKey(p *Proxy) string {
+	return p.Protocol + "://" + p.User + "@" + p.Key()
+}
+
+// Get 返回經由 p 的 Transport，不存在時創建；超出容量時淘汰最久未使用的並關閉其空閒連接
+func (c *TransportCache) Get(p *Proxy) *http.Transport {
+	key := transportKey(p)
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*transportEntry).transport
+	}
+
+	t := Transport(p, c.opts)
+	t.DisableKeepAlives = false
+	t.MaxIdleConns = 0 // 由 MaxIdleConnsPerHost 限制
+	t.MaxIdleConnsPerHost = maxIdleConnsPerUpstream
+	t.IdleConnTimeout = c.idleTimeout
+	// 自定義 DialContext 時 Go 預設不嘗試 HTTP/2；經由代理隧道訪問 HTTPS 目標時由 ALPN 協商 h2，多路復用同一連接
+	t.ForceAttemptHTTP2 = true
+	c.items[key] = c.order.PushFront(&transportEntry{key: key, transport: t})
+
+	var evicted []*http.Transport
+	for c.order.Len() > c.size {
+		el := c.order.Back()
+		entry := c.order.Remove(el).(*transportEntry)
+		delete(c.items, entry.key)
+		evicted = append(evicted, entry.transport)
+	}
+	c.mu.Unlock()
+
+	// 進行中的請求不受影響，只關閉空閒連接
+	for _, t := range evicted {
+		t.CloseIdleConnections()
+	}
+	return t
+}
+
+// Evict 移除經由 p 的 Transport 並關閉其空閒連接（如代理失敗後避免復用可能已斷開的連接）
+func (c *TransportCache) Evict(p *Proxy) {
+	key := transportKey(p)
+	c.mu.Lock()
+	el, ok := c.items[key]
+	if ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+	c.mu.Unlock()
+	if ok {
+		el.Value.(*transportEntry).transport.CloseIdleConnections()
+	}
+}
+
+// Len 返回緩存的 Transport 數
+func (c *TransportCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// CloseIdleConnections 關閉所有緩存 Transport 的空閒連接並清空緩存
+func (c *TransportCache) CloseIdleConnections() {
+	c.mu.Lock()
+	var all []*http.Transport
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		all = append(all, el.Value.(*transportEntry).transport)
+	}
+	c.order.Init()
+	clear(c.items)
+	c.mu.Unlock()
+	for _, t := range all {
+		t.CloseIdleConnections()
+	}
+}
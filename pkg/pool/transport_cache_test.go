@@ -0,0 +1,109 @@
+package pool
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTransportCacheLRU(t *testing.T) {
+	a := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http"}
+	b := &Proxy{IP: "2.2.2.2", Port: "80", Protocol: "http"}
+	c := &Proxy{IP: "3.3.3.3", Port: "80", Protocol: "http"}
+	cache := NewTransportCache(2, 0, TransportOptions{})
+
+	ta := cache.Get(a)
+	if cache.Get(a) != ta {
+		t.Fatal("same proxy should reuse its transport")
+	}
+	if ta.DisableKeepAlives || ta.IdleConnTimeout != DefaultUpstreamIdleTimeout {
+		t.Errorf("cached transport should keep connections alive: %+v", ta)
+	}
+	// 協議不同視為不同的上遊
+	if cache.Get(&Proxy{IP: "1.1.1.1", Port: "80", Protocol: "socks5"}) == ta {
+		t.Error("different protocol should not share a transport")
+	}
+
+	cache = NewTransportCache(2, 0, TransportOptions{})
+	ta = cache.Get(a)
+	cache.Get(b)
+	cache.Get(a) // a 變為最近使用
+	cache.Get(c) // 淘汰 b
+	if cache.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", cache.Len())
+	}
+	if cache.Get(a) != ta {
+		t.Error("recently used transport should survive eviction")
+	}
+
+	cache.Evict(a)
+	if cache.Get(a) == ta {
+		t.Error("evicted proxy should get a new transport")
+	}
+}
+
+func TestTransportCacheReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	direct := &Proxy{IP: "127.0.0.1", Port: "1"} // 未知協議直連
+	get := func(rt http.RoundTripper) {
+		resp, err := (&http.Client{Transport: rt}).Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	cache := NewTransportCache(4, 0, TransportOptions{})
+	for range 3 {
+		get(cache.Get(direct))
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("cached transport opened %d connections for 3 requests, want 1", n)
+	}
+
+	conns.Store(0)
+	for range 3 {
+		get(Transport(direct, TransportOptions{}))
+	}
+	if n := conns.Load(); n != 3 {
+		t.Errorf("uncached transport opened %d connections, want 3", n)
+	}
+	cache.CloseIdleConnections()
+}
+
+func TestTransportCacheNegotiatesHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr := NewTransportCache(1, 0, TransportOptions{}).Get(&Proxy{IP: "127.0.0.1", Port: "1"})
+	tr.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	defer tr.CloseIdleConnections()
+
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("cached transport used %s, want HTTP/2", resp.Proto)
+	}
+}
@@ -0,0 +1,190 @@
+package pool
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// udpProbeResolver UDP 探測經由代理查詢的 DNS 服務器（與 SOCKS5 協議檢測的目標一致）
+const udpProbeResolver = "8.8.8.8:53"
+
+// probeUDP 檢測 SOCKS5 代理是否支持 UDP ASSOCIATE；其他協議的代理返回 false
+func probeUDP(p *Proxy, timeout time.Duration) bool {
+	if p.Protocol != "socks5" {
+		return false
+	}
+	if err := associateUDP(p, udpProbeResolver, timeout); err != nil {
+		validatorLog.WithField("proxy", p.String()).WithError(err).Debug("UDP ASSOCIATE probe failed")
+		return false
+	}
+	return true
+}
+
+// associateUDP 建立 UDP 關聯後經由代理的中繼地址向 resolver 發送一個 DNS 查詢並等待應答
+// （有的代理接受 UDP ASSOCIATE 但不轉發數據報，只檢查回覆碼無法發現）
+func associateUDP(p *Proxy, resolver string, timeout time.Duration) error {
+	target, err := netip.ParseAddrPort(resolver)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.Key())
+	if err != nil {
+		return err
+	}
+	// UDP 關聯在控制連接關閉時結束
+	defer conn.Close()
+	deadline := time.Now().Add(timeout)
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	if err := socks5Greet(conn, p); err != nil {
+		return err
+	}
+	// UDP ASSOCIATE：客戶端發送數據報的地址事先未知，填 0.0.0.0:0
+	if _, err := conn.Write([]byte{0x05, 0x03, 0x00, 0x01, 0, 0, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+	relay, err := socks5ReadReply(conn)
+	if err != nil {
+		return fmt.Errorf("UDP ASSOCIATE: %w", err)
+	}
+	// 中繼地址為未指定地址時與代理同一主機
+	if relay.Addr().IsUnspecified() {
+		proxyAddr, err := netip.ParseAddr(p.IP)
+		if err != nil {
+			return err
+		}
+		relay = netip.AddrPortFrom(proxyAddr, relay.Port())
+	}
+
+	udpConn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(relay))
+	if err != nil {
+		return err
+	}
+	defer udpConn.Close()
+	if err := udpConn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	id := uint16(time.Now().UnixNano())
+	query, err := dnsQuery(id)
+	if err != nil {
+		return err
+	}
+	if _, err := udpConn.Write(append(socks5UDPHeader(target), query...)); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	n, err := udpConn.Read(buf)
+	if err != nil {
+		return err
+	}
+	payload, err := stripSOCKS5UDPHeader(buf[:n])
+	if err != nil {
+		return err
+	}
+	var parser dnsmessage.Parser
+	header, err := parser.Start(payload)
+	if err != nil {
+		return fmt.Errorf("parse DNS answer: %w", err)
+	}
+	if !header.Response || header.ID != id {
+		return errors.New("unexpected DNS answer")
+	}
+	return nil
+}
+
+// socks5ReadReply 讀取 SOCKS5 命令的回覆，返回綁定地址（域名類型的綁定地址不支持）
+func socks5ReadReply(r io.Reader) (netip.AddrPort, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return netip.AddrPort{}, err
+	}
+	if header[0] != 0x05 {
+		return netip.AddrPort{}, fmt.Errorf("invalid SOCKS5 version in response")
+	}
+	if header[1] != 0x00 {
+		return netip.AddrPort{}, fmt.Errorf("command failed, status: %d", header[1])
+	}
+
+	var addrLen int
+	switch header[3] {
+	case 0x01:
+		addrLen = 4
+	case 0x04:
+		addrLen = 16
+	default:
+		return netip.AddrPort{}, fmt.Errorf("unsupported bind address type: %d", header[3])
+	}
+	buf := make([]byte, addrLen+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return netip.AddrPort{}, err
+	}
+	addr, _ := netip.AddrFromSlice(buf[:addrLen])
+	return netip.AddrPortFrom(addr.Unmap(), binary.BigEndian.Uint16(buf[addrLen:])), nil
+}
+
+// socks5UDPHeader 構建 SOCKS5 UDP 數據報頭：RSV(2) FRAG(1) ATYP(1) DST.ADDR DST.PORT
+func socks5UDPHeader(dst netip.AddrPort) []byte {
+	header := []byte{0, 0, 0}
+	if dst.Addr().Is4() {
+		header = append(header, 0x01)
+	} else {
+		header = append(header, 0x04)
+	}
+	header = append(header, dst.Addr().AsSlice()...)
+	return binary.BigEndian.AppendUint16(header, dst.Port())
+}
+
+// stripSOCKS5UDPHeader 去掉中繼返回的 SOCKS5 UDP 數據報頭，返回數據部分（不支持分片）
+func stripSOCKS5UDPHeader(packet []byte) ([]byte, error) {
+	if len(packet) < 4 || packet[2] != 0 {
+		return nil, errors.New("invalid SOCKS5 UDP datagram")
+	}
+	n := 4
+	switch packet[3] {
+	case 0x01:
+		n += 4
+	case 0x04:
+		n += 16
+	case 0x03:
+		if len(packet) < 5 {
+			return nil, errors.New("invalid SOCKS5 UDP datagram")
+		}
+		n += 1 + int(packet[4])
+	default:
+		return nil, fmt.Errorf("unknown address type: %d", packet[3])
+	}
+	n += 2
+	if len(packet) < n {
+		return nil, errors.New("invalid SOCKS5 UDP datagram")
+	}
+	return packet[n:], nil
+}
+
+// dnsQuery 構建查詢 example.com A 記錄的 DNS 請求
+func dnsQuery(id uint16) ([]byte, error) {
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName("example.com."),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return msg.Pack()
+}
@@ -0,0 +1,122 @@
+package pool
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newUDPResolver 啟動只返回空應答的測試 DNS 服務器
+func newUDPResolver(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if msg.Unpack(buf[:n]) != nil {
+				continue
+			}
+			msg.Header.Response = true
+			answer, _ := msg.Pack()
+			conn.WriteToUDP(answer, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// newSOCKS5UDPProxy 啟動測試 SOCKS5 代理：associate 為 true 時支持 UDP ASSOCIATE 並轉發數據報，否則拒絕該命令
+func newSOCKS5UDPProxy(t *testing.T, associate bool) *Proxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				greeting := make([]byte, 3)
+				if _, err := io.ReadFull(conn, greeting); err != nil {
+					return
+				}
+				conn.Write([]byte{0x05, 0x00})
+				request := make([]byte, 10)
+				if _, err := io.ReadFull(conn, request); err != nil || request[1] != 0x03 {
+					return
+				}
+				if !associate {
+					conn.Write([]byte{0x05, 0x07, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+					return
+				}
+
+				relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+				if err != nil {
+					return
+				}
+				defer relay.Close()
+				// 綁定地址返回 0.0.0.0，客戶端應改用代理的地址
+				port := relay.LocalAddr().(*net.UDPAddr).Port
+				conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, byte(port >> 8), byte(port)})
+
+				go func() {
+					buf := make([]byte, 1500)
+					n, client, err := relay.ReadFromUDP(buf)
+					if err != nil {
+						return
+					}
+					dst := netip.AddrPortFrom(netip.AddrFrom4([4]byte(buf[4:8])), uint16(buf[8])<<8|uint16(buf[9]))
+					upstream, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(dst))
+					if err != nil {
+						return
+					}
+					defer upstream.Close()
+					upstream.Write(buf[10:n])
+					upstream.SetReadDeadline(time.Now().Add(time.Second))
+					m, err := upstream.Read(buf[10:])
+					if err != nil {
+						return
+					}
+					relay.WriteToUDP(buf[:10+m], client)
+				}()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	return &Proxy{IP: host, Port: port, Protocol: "socks5"}
+}
+
+func TestAssociateUDP(t *testing.T) {
+	resolver := newUDPResolver(t)
+
+	if err := associateUDP(newSOCKS5UDPProxy(t, true), resolver, 2*time.Second); err != nil {
+		t.Errorf("UDP relay should work: %v", err)
+	}
+	if err := associateUDP(newSOCKS5UDPProxy(t, false), resolver, 2*time.Second); err == nil {
+		t.Error("rejected UDP ASSOCIATE should fail")
+	}
+	if probeUDP(&Proxy{IP: "127.0.0.1", Port: "1", Protocol: "http"}, time.Second) {
+		t.Error("only SOCKS5 proxies can relay UDP")
+	}
+}
@@ -0,0 +1,324 @@
+package pool
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/fetcher"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/retry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ValidationPolicy 代理驗證策略
+type ValidationPolicy struct {
+	TestURLs          []string         // 通用檢測 URL（期望返回 204）
+	Timeout           time.Duration    // 單次檢測超時
+	RequiredSuccesses int              // 需要成功的通用檢測次數
+	RequireHTTPS      bool             // 是否要求能經由代理訪問 HTTPS 目標
+	Targets           []string         // 用戶指定目標（代理必須能訪問，狀態碼 < 400）
+	ProbeTargets      []ProbeTarget    // 站點探測目標（通過的站點記錄為代理標籤，不影響有效性）
+	SpeedTestURL      string           // 測速下載地址（空表示不測速）
+	IntegrityChecks   []IntegrityCheck // 內容完整性檢測（經由代理下載已知校驗和的靜態資源）
+	Retry             retry.Policy     // 單次檢測的重試策略（零值表示不重試）
+	RecheckMin        time.Duration    // 新代理或剛恢復的代理的重新驗證間隔
+	RecheckMax        time.Duration    // 長期穩定代理的重新驗證間隔上限
+	GoogleProbeURL    string           // Google 搜索探測地址，結果記錄在 Proxy.GoogleProbe（空表示不探測）
+	JudgeURL          string           // 判定服務地址，返回請求來源地址和請求頭，用於檢測出口地址和匿名級別（空表示不檢測）
+	KnownBadTTL       time.Duration    // 首次驗證即失敗的候選代理在此時長內再次採集到時不再驗證（0 表示不記錄）
+	ProbeRate         float64          // 所有驗證每秒最多發出的檢測請求數（0 表示不限制）
+	ProbeTargetRate   float64          // 每個檢測目標網段（IPv4 /24、IPv6 /48）每秒最多接收的檢測請求數，通用檢測優先選擇仍有配額的 URL（0 表示不限制）
+	ProbeJitter       time.Duration    // 每次檢測前的隨機延遲上限，打散同時開始的驗證（0 表示不延遲）
+	ScoreHalfLife     time.Duration    // 健康評分的衰減半衰期（0 表示不衰減）
+	ScoreExclude      float64          // 驗證後健康評分低於此值的代理標記為禁用，不參與選擇
+}
+
+// ProbeTarget 站點探測目標
+type ProbeTarget struct {
+	Name         string // 站點標籤（如 google）
+	URL          string // 探測 URL
+	ExpectStatus int    // 期望狀態碼（0 表示 < 400 即可）
+}
+
+// IntegrityCheck 內容完整性檢測目標：經由代理下載的響應體 SHA-256 必須與 SHA256 一致
+type IntegrityCheck struct {
+	URL    string // 靜態資源地址（https 地址同時檢測 TLS 剝離和證書替換）
+	SHA256 string // 期望的響應體 SHA-256（十六進制）
+}
+
+// DefaultValidationPolicy 預設驗證策略
+var DefaultValidationPolicy = ValidationPolicy{
+	TestURLs: []string{
+		"https://www.google.com/generate_204",
+		"http://www.gstatic.com/generate_204",
+		"https://connectivitycheck.gstatic.com/generate_204",
+		"http://edge-http.microsoft.com/captiveportal/generate_204",
+		"http://cp.cloudflare.com/generate_204",
+	},
+	Timeout:           10 * time.Second,
+	RequiredSuccesses: 1,
+	RecheckMin:        15 * time.Minute,
+	RecheckMax:        12 * time.Hour,
+	GoogleProbeURL:    "https://www.google.com/search?q=weather",
+	JudgeURL:          "http://httpbin.org/get",
+	KnownBadTTL:       6 * time.Hour,
+	ProbeTargetRate:   10,
+	ProbeJitter:       500 * time.Millisecond,
+	ScoreHalfLife:     24 * time.Hour,
+	ScoreExclude:      0.4,
+}
+
+var (
+	policyMu      sync.RWMutex
+	currentPolicy = DefaultValidationPolicy
+)
+
+// SetValidationPolicy 設置全局驗證策略
+func SetValidationPolicy(policy ValidationPolicy) {
+	if policy.Timeout <= 0 {
+		policy.Timeout = DefaultValidationPolicy.Timeout
+	}
+	if policy.RequiredSuccesses < 1 {
+		policy.RequiredSuccesses = 1
+	}
+	if len(policy.TestURLs) == 0 && len(policy.Targets) == 0 {
+		policy.TestURLs = DefaultValidationPolicy.TestURLs
+	}
+	if policy.RecheckMin <= 0 {
+		policy.RecheckMin = DefaultValidationPolicy.RecheckMin
+	}
+	if policy.RecheckMax < policy.RecheckMin {
+		policy.RecheckMax = max(DefaultValidationPolicy.RecheckMax, policy.RecheckMin)
+	}
+
+	policyMu.Lock()
+	currentPolicy = policy
+	policyMu.Unlock()
+}
+
+// CurrentValidationPolicy 獲取當前驗證策略
+func CurrentValidationPolicy() ValidationPolicy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return currentPolicy
+}
+
+// randomURL 從列表中隨機選擇一個 URL，onlyHTTPS 為 true 時只選擇 https URL
+func randomURL(urls []string, onlyHTTPS bool) string {
+	candidates := urls
+	if onlyHTTPS {
+		candidates = nil
+		for _, u := range urls {
+			if strings.HasPrefix(strings.ToLower(u), "https://") {
+				candidates = append(candidates, u)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	r := getRand()
+	defer putRand(r)
+	return candidates[r.Intn(len(candidates))]
+}
+
+// newProbeClient 創建經由代理訪問的 HTTP 客戶端
+func newProbeClient(p *Proxy, timeout time.Duration) *http.Client {
+	proxyURL := &url.URL{Scheme: p.Protocol, Host: p.Key()}
+	if p.User != "" && p.Pass != "" {
+		proxyURL.User = url.UserPassword(p.User, p.Pass)
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyURL(proxyURL),
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		DisableKeepAlives:     true,
+	}
+	if p.Protocol == "https" {
+		// 與代理之間的 TLS 使用 SetProxyTLSConfig 的配置，TLSClientConfig 只用於 HTTPS 目標
+		transport.DialTLSContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialProxyTLS(ctx, &net.Dialer{}, p)
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		// 不跟隨重定向，避免把目標站的跳轉當成代理的響應
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// probe 經由代理請求目標 URL，返回狀態碼和耗時（按策略重試時耗時包括重試）；
+// 請求前按策略等待隨機延遲和速率配額，等待時間不計入耗時
+func probe(client *http.Client, target string, policy ValidationPolicy) (int, time.Duration, error) {
+	if err := probeLimits.wait(context.Background(), target, policy); err != nil {
+		return 0, 0, err
+	}
+	start := time.Now()
+	resp, err := retry.DoHTTP(context.Background(), policy.Retry, func(ctx context.Context, _ int) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", fetcher.GetRandomUserAgent())
+		return client.Do(req)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	elapsed := time.Since(start)
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	return resp.StatusCode, elapsed, nil
+}
+
+// runValidation 按策略驗證代理，返回首次成功檢測的響應時間及是否通過；耗時記錄在指標和 pool.validate span 中
+func runValidation(p *Proxy, policy ValidationPolicy) (time.Duration, bool) {
+	_, span := tracer.Start(context.Background(), "pool.validate", trace.WithAttributes(
+		attribute.String("proxy.upstream", p.String()),
+		attribute.String("proxy.protocol", p.Protocol),
+	))
+	start := time.Now()
+	responseTime, valid := checkValidation(p, policy)
+	result := validationInvalid
+	if valid {
+		result = validationValid
+	}
+	validationDuration.Observe(time.Since(start).Seconds(), result)
+	span.SetAttributes(attribute.Bool("proxy.valid", valid))
+	span.End()
+	return responseTime, valid
+}
+
+// checkValidation 依次進行通用檢測、用戶指定目標和 HTTPS 能力檢測
+func checkValidation(p *Proxy, policy ValidationPolicy) (time.Duration, bool) {
+	client := newProbeClient(p, policy.Timeout)
+	var responseTime time.Duration
+	httpsVerified := false
+
+	record := func(elapsed time.Duration, target string) {
+		if responseTime == 0 {
+			responseTime = elapsed
+		}
+		if strings.HasPrefix(strings.ToLower(target), "https://") {
+			httpsVerified = true
+		}
+	}
+
+	// 通用檢測：需要 RequiredSuccesses 次返回 204
+	if len(policy.TestURLs) > 0 {
+		for i := 0; i < policy.RequiredSuccesses; i++ {
+			target := probeLimits.pickURL(policy.TestURLs, false, policy)
+			status, elapsed, err := probe(client, target, policy)
+			if err != nil || status != http.StatusNoContent {
+				validatorLog.WithFields(logger.Fields{"proxy": p.String(), "url": target, "status": status}).WithError(err).
+					Debugf("test failed (%d/%d)", i+1, policy.RequiredSuccesses)
+				return responseTime, false
+			}
+			record(elapsed, target)
+		}
+	}
+
+	// 用戶指定目標：每個目標都必須可訪問
+	for _, target := range policy.Targets {
+		status, elapsed, err := probe(client, target, policy)
+		if err != nil || status >= http.StatusBadRequest {
+			validatorLog.WithFields(logger.Fields{"proxy": p.String(), "url": target, "status": status}).WithError(err).
+				Debug("target unreachable")
+			return responseTime, false
+		}
+		record(elapsed, target)
+	}
+
+	// HTTPS 能力：如果前面的檢測未覆蓋 HTTPS，額外檢測一次
+	if policy.RequireHTTPS && !httpsVerified {
+		target := probeLimits.pickURL(policy.TestURLs, true, policy)
+		if target == "" {
+			validatorLog.Warnf("validation requires HTTPS but no https test URL is configured")
+			return responseTime, false
+		}
+		status, elapsed, err := probe(client, target, policy)
+		if err != nil || status != http.StatusNoContent {
+			validatorLog.WithFields(logger.Fields{"proxy": p.String(), "url": target, "status": status}).WithError(err).
+				Debug("HTTPS test failed")
+			return responseTime, false
+		}
+		record(elapsed, target)
+	}
+
+	return responseTime, true
+}
+
+// probeSites 探測代理能訪問哪些站點，返回通過探測的站點標籤
+func probeSites(p *Proxy, policy ValidationPolicy) []string {
+	if len(policy.ProbeTargets) == 0 {
+		return nil
+	}
+
+	client := newProbeClient(p, policy.Timeout)
+	var sites []string
+	for _, target := range policy.ProbeTargets {
+		status, _, err := probe(client, target.URL, policy)
+		ok := err == nil && status < http.StatusBadRequest
+		if target.ExpectStatus != 0 {
+			ok = err == nil && status == target.ExpectStatus
+		}
+		if !ok {
+			validatorLog.WithFields(logger.Fields{"proxy": p.String(), "site": target.Name, "url": target.URL, "status": status}).WithError(err).
+				Debug("site probe failed")
+			continue
+		}
+		sites = append(sites, strings.ToLower(target.Name))
+	}
+	return sites
+}
+
+// maxSpeedTestBytes 測速下載的最大字節數，避免配置了過大的文件
+const maxSpeedTestBytes = 10 << 20
+
+// measureThroughput 經由代理下載測速文件，返回吞吐量（KB/s），失敗返回 0
+func measureThroughput(p *Proxy, policy ValidationPolicy) float64 {
+	client := newProbeClient(p, policy.Timeout)
+
+	req, err := http.NewRequest(http.MethodGet, policy.SpeedTestURL, nil)
+	if err != nil {
+		return 0
+	}
+	req.Header.Set("User-Agent", fetcher.GetRandomUserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		validatorLog.WithField("proxy", p.String()).WithError(err).Debug("speed test failed")
+		return 0
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		validatorLog.WithFields(logger.Fields{"proxy": p.String(), "status": resp.StatusCode}).Debug("speed test failed")
+		return 0
+	}
+
+	// 從收到響應頭開始計時，排除連接建立的延遲
+	start := time.Now()
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxSpeedTestBytes))
+	elapsed := time.Since(start)
+	if err != nil || n == 0 || elapsed <= 0 {
+		validatorLog.WithFields(logger.Fields{"proxy": p.String(), "bytes": n, "duration": elapsed.String()}).WithError(err).
+			Debug("speed test read failed")
+		return 0
+	}
+
+	return float64(n) / 1024 / elapsed.Seconds()
+}
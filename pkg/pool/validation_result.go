@@ -0,0 +1,128 @@
+package pool
+
+import (
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+)
+
+// ValidationResult 一次驗證的結果。Validate 只讀取傳入的代理，不修改它；結果由單一寫入方
+// 經 ApplyTo 或 Pool.ApplyValidation 應用到代理記錄，並發驗證之間因此不共享可變的 Proxy
+type ValidationResult struct {
+	Key       string    // 代理的 ip:port
+	Tested    bool      // 是否進行了檢測（地址無效時為 false，不更新代理記錄）
+	Healthy   bool      // 是否通過驗證
+	Protocol  string    // 探測到的協議，無法連接時為空
+	CheckedAt time.Time // 檢測完成的時間
+
+	// 以下只在通過驗證時有效
+	Latency          time.Duration // 首個檢測請求的響應時間
+	Sites            []string      // 通過探測的站點標籤
+	GoogleProbe      string        // Google 搜索探測結果（空表示未探測或探測失敗）
+	TLSProbed        bool          // 是否進行了 TLS 握手探測
+	TLS              bool
+	TLSVersion       string
+	TLSHandshakeMs   int64
+	UDP              bool
+	SpeedTested      bool // 是否進行了測速
+	SpeedKBps        float64
+	IntegrityChecked bool // 完整性檢測是否得到了結論
+	Tampering        bool
+}
+
+// Validate 按當前驗證策略驗證代理並返回結果，不修改 p
+func Validate(p *Proxy) ValidationResult {
+	r := ValidationResult{Key: p.Key()}
+	if p.IP == "" || p.IP == "0.0.0.0" || p.IP == "127.0.0.1" {
+		return r
+	}
+	r.Tested = true
+
+	pp, err := determineConnectionProtocol(p.IP, p.Port)
+	if err != nil || pp == "" {
+		r.CheckedAt = time.Now()
+		return r
+	}
+	r.Protocol = pp
+
+	// 檢測使用副本，帶上探測到的協議
+	probe := *p
+	probe.Protocol = pp
+	if probe.Addr == "" {
+		probe.Addr = p.IP + ":" + p.Port
+	}
+
+	// 按驗證策略檢測代理
+	policy := CurrentValidationPolicy()
+	responseTime, valid := runValidation(&probe, policy)
+	r.CheckedAt = time.Now()
+	r.Healthy = valid
+	if !valid {
+		return r
+	}
+
+	r.Latency = responseTime
+	r.Sites = probeSites(&probe, policy)
+	if policy.GoogleProbeURL != "" {
+		r.GoogleProbe = probeGoogle(&probe, policy)
+	}
+	var handshake time.Duration
+	r.TLSVersion, handshake, r.TLSProbed = probeTLS(&probe, policy)
+	r.TLS, r.TLSHandshakeMs = r.TLSVersion != "", handshake.Milliseconds()
+	r.UDP = probeUDP(&probe, policy.Timeout)
+	if policy.SpeedTestURL != "" {
+		r.SpeedTested = true
+		r.SpeedKBps = measureThroughput(&probe, policy)
+	}
+	r.Tampering, r.IntegrityChecked = checkIntegrity(&probe, policy)
+	validatorLog.WithFields(logger.Fields{
+		"proxy":      probe.String(),
+		"duration":   responseTime.String(),
+		"sites":      r.Sites,
+		"google":     r.GoogleProbe,
+		"tls":        r.TLSVersion,
+		"udp":        r.UDP,
+		"speed_kbps": r.SpeedKBps,
+		"tampering":  r.Tampering,
+	}).Info("validated proxy")
+	return r
+}
+
+// ApplyTo 把驗證結果寫入代理記錄：更新協議、健康評分、禁用狀態及下次驗證時間，
+// 通過驗證時更新延遲和各項探測結果（未進行的探測保留原值）
+func (r ValidationResult) ApplyTo(p *Proxy) {
+	if !r.Tested {
+		return
+	}
+	policy := CurrentValidationPolicy()
+	if r.Protocol == "" {
+		p.recordResult(false, r.CheckedAt, policy)
+		return
+	}
+	p.Protocol = r.Protocol
+	if p.Addr == "" {
+		p.Addr = p.IP + ":" + p.Port
+	}
+	p.scheduleRecheck(r.Healthy, r.CheckedAt, policy)
+	p.recordResult(r.Healthy, r.CheckedAt, policy)
+	if !r.Healthy {
+		return
+	}
+
+	p.Updated = r.CheckedAt
+	p.LatencyMs = r.Latency.Milliseconds()
+	p.Sites = r.Sites
+	if r.GoogleProbe != "" {
+		p.GoogleProbe = r.GoogleProbe
+	}
+	if r.TLSProbed {
+		p.TLS, p.TLSVersion, p.TLSHandshakeMs = r.TLS, r.TLSVersion, r.TLSHandshakeMs
+	}
+	p.UDP = r.UDP
+	if r.SpeedTested {
+		p.SpeedKBps = r.SpeedKBps
+	}
+	if r.IntegrityChecked {
+		p.Tampering = r.Tampering
+	}
+}
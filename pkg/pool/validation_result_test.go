@@ -0,0 +1,148 @@
+package pool
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestApplyValidation(t *testing.T) {
+	var h hookLog
+	p := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Source: "a"}
+	db := newTestDB(t, p)
+	if err := db.Update(func(txn *badger.Txn) error { return Enqueue(txn, p.Key()) }); err != nil {
+		t.Fatal(err)
+	}
+	pl := New(db, WithHooks(h.hooks()))
+
+	// 驗證期間記錄被其他寫入修改，應用結果時不被覆蓋
+	if _, err := pl.SetTags(p.Key(), []string{"paid"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r := ValidationResult{
+		Key: p.Key(), Tested: true, Healthy: true, Protocol: "socks5", CheckedAt: now,
+		Latency: 120 * time.Millisecond, Sites: []string{"google"}, TLSProbed: true, TLS: true, TLSVersion: "TLS 1.3",
+	}
+	saved, err := pl.ApplyValidation(r)
+	if err != nil {
+		t.Fatalf("ApplyValidation: %v", err)
+	}
+	if saved.Protocol != "socks5" || saved.LatencyMs != 120 || !saved.Updated.Equal(now) || !saved.TLS || saved.Streak != 1 {
+		t.Errorf("result not applied: %+v", saved)
+	}
+	if !slices.Equal(saved.Tags, []string{"paid"}) || saved.Source != "a" {
+		t.Errorf("concurrent changes overwritten: tags = %v, source = %q", saved.Tags, saved.Source)
+	}
+	if !h.results[p.Key()] {
+		t.Errorf("OnValidationResult = %v", h.results)
+	}
+	if err := db.View(func(txn *badger.Txn) error {
+		if queued, err := Queued(txn, p.Key()); err != nil || queued {
+			t.Errorf("Queued = %v, %v; want dequeued", queued, err)
+		}
+		item, err := txn.Get([]byte(p.Key()))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			stored, err := LoadFromJSON(v)
+			if err == nil && stored.Protocol != "socks5" {
+				t.Errorf("stored protocol = %q", stored.Protocol)
+			}
+			return err
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 調用方持有的副本不被修改
+	if p.Protocol != "http" || !p.Updated.IsZero() {
+		t.Errorf("caller's proxy modified: %+v", p)
+	}
+}
+
+func TestApplyValidationDeleted(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Update(func(txn *badger.Txn) error { return Enqueue(txn, "2.2.2.2:80") }); err != nil {
+		t.Fatal(err)
+	}
+	pl := New(db)
+	_, err := pl.ApplyValidation(ValidationResult{Key: "2.2.2.2:80", Tested: true, CheckedAt: time.Now()})
+	if !errors.Is(err, ErrProxyNotFound) {
+		t.Fatalf("ApplyValidation(deleted) = %v, want ErrProxyNotFound", err)
+	}
+	if keys, err := QueuedKeys(db, 0); err != nil || len(keys) != 0 {
+		t.Errorf("QueuedKeys = %v, %v; want empty", keys, err)
+	}
+}
+
+func TestApplyValidationConflict(t *testing.T) {
+	p := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Updated: time.Now()}
+	db := newTestDB(t, p)
+	pl := New(db)
+
+	// 第一次嘗試讀取記錄後，管理接口手動禁用了該代理
+	calls := 0
+	testHookApplyValidation = func() {
+		if calls++; calls == 1 {
+			if _, err := pl.SetDisabled(p.Key(), true); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	defer func() { testHookApplyValidation = nil }()
+
+	saved, err := pl.ApplyValidation(ValidationResult{Key: p.Key(), Tested: true, Healthy: true, Protocol: "socks5", CheckedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("ApplyValidation: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("transaction ran %d times, want a retry after the conflict", calls)
+	}
+	if saved.Protocol != "socks5" || !saved.ManualDisable || !saved.Disable {
+		t.Errorf("saved = protocol %q, manual %v, disabled %v; want the verdict applied and the manual disable kept",
+			saved.Protocol, saved.ManualDisable, saved.Disable)
+	}
+	if err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(p.Key()))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			stored, err := LoadFromJSON(v)
+			if err == nil && (stored.Protocol != "socks5" || !stored.ManualDisable) {
+				t.Errorf("stored = protocol %q, manual %v", stored.Protocol, stored.ManualDisable)
+			}
+			return err
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidationResultApplyTo(t *testing.T) {
+	p := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Score: 0.9, ScoredAt: time.Now(), GoogleProbe: GooglePassed, SpeedKBps: 50}
+
+	// 未檢測（地址無效）時不修改
+	before := *p
+	ValidationResult{Key: p.Key()}.ApplyTo(p)
+	if p.Score != before.Score || p.Protocol != before.Protocol {
+		t.Errorf("untested result modified proxy: %+v", p)
+	}
+
+	// 無法連接只降低評分，保留協議
+	ValidationResult{Key: p.Key(), Tested: true, CheckedAt: time.Now()}.ApplyTo(p)
+	if p.Score >= before.Score || p.Protocol != "http" {
+		t.Errorf("unreachable result: score = %v, protocol = %q", p.Score, p.Protocol)
+	}
+
+	// 未進行的探測保留原值
+	ValidationResult{Key: p.Key(), Tested: true, Healthy: true, Protocol: "http", CheckedAt: time.Now()}.ApplyTo(p)
+	if p.GoogleProbe != GooglePassed || p.SpeedKBps != 50 {
+		t.Errorf("probes not run were reset: google = %q, speed = %v", p.GoogleProbe, p.SpeedKBps)
+	}
+}
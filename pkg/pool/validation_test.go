@@ -0,0 +1,115 @@
+package pool
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newForwardProxy 啟動轉發普通 HTTP 請求的測試代理
+func newForwardProxy(t *testing.T) *Proxy {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(srv.Close)
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	return &Proxy{IP: host, Port: port, Protocol: "http", Addr: srv.Listener.Addr().String()}
+}
+
+func TestProbeSites(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/teapot":
+			w.WriteHeader(http.StatusTeapot)
+		default:
+			io.WriteString(w, "ok")
+		}
+	}))
+	defer origin.Close()
+	p := newForwardProxy(t)
+
+	policy := ValidationPolicy{Timeout: 2 * time.Second, ProbeTargets: []ProbeTarget{
+		{Name: "Google", URL: origin.URL + "/"},
+		{Name: "amazon", URL: origin.URL + "/forbidden"},
+		{Name: "teapot", URL: origin.URL + "/teapot", ExpectStatus: http.StatusTeapot},
+		{Name: "strict", URL: origin.URL + "/", ExpectStatus: http.StatusNoContent},
+		{Name: "down", URL: "http://127.0.0.1:1/"},
+	}}
+	sites := probeSites(p, policy)
+	if want := []string{"google", "teapot"}; !slices.Equal(sites, want) {
+		t.Fatalf("probeSites = %v, want %v", sites, want)
+	}
+
+	// 探測結果寫入代理記錄，篩選條件據此匹配；再次驗證時以新結果替換
+	rec := &Proxy{IP: "1.1.1.1", Port: "80", Protocol: "http", Sites: []string{"amazon"}}
+	ValidationResult{Key: rec.Key(), Tested: true, Healthy: true, Protocol: "http", CheckedAt: time.Now(), Sites: sites}.ApplyTo(rec)
+	if !slices.Equal(rec.Sites, sites) {
+		t.Errorf("stored sites = %v, want %v", rec.Sites, sites)
+	}
+	if !rec.HasSites([]string{"google", "teapot"}) || rec.HasSites([]string{"amazon"}) {
+		t.Errorf("HasSites does not match the probed sites %v", rec.Sites)
+	}
+
+	if sites := probeSites(p, ValidationPolicy{Timeout: time.Second}); sites != nil {
+		t.Errorf("probeSites without targets = %v, want nil", sites)
+	}
+}
+
+func TestMeasureThroughput(t *testing.T) {
+	stop := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/endless":
+			// 寫滿測速上限後不再結束響應，測速應在讀到上限時停止而不是等到超時
+			w.Write(make([]byte, maxSpeedTestBytes))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-stop:
+			}
+		default:
+			w.Write(make([]byte, 256<<10))
+		}
+	}))
+	t.Cleanup(origin.Close)
+	p := newForwardProxy(t)
+	t.Cleanup(func() { close(stop) })
+
+	policy := ValidationPolicy{Timeout: 5 * time.Second}
+	tests := []struct {
+		path     string
+		wantZero bool
+	}{
+		{"/", false},
+		{"/endless", false},
+		{"/missing", true},
+	}
+	for _, tt := range tests {
+		policy.SpeedTestURL = origin.URL + tt.path
+		if kbps := measureThroughput(p, policy); (kbps == 0) != tt.wantZero {
+			t.Errorf("%s: measureThroughput = %.1f KB/s, want zero %v", tt.path, kbps, tt.wantZero)
+		}
+	}
+
+	policy.SpeedTestURL = "http://127.0.0.1:1/"
+	if kbps := measureThroughput(p, policy); kbps != 0 {
+		t.Errorf("unreachable: measureThroughput = %.1f KB/s, want 0", kbps)
+	}
+}
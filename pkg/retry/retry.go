@@ -0,0 +1,287 @@
+// Package retry 統一的重試與對沖（hedging）策略，代理轉發、代理驗證和來源採集共用
+//
+//	p := retry.Policy{MaxAttempts: 3, RetryOn: []string{retry.ErrorTimeout}, RetryStatus: []int{502, 503}}
+//	resp, err := retry.DoHTTP(ctx, p, func(ctx context.Context, attempt int) (*http.Response, error) {
+//		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+//		return client.Do(req)
+//	})
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 可重試的錯誤類別（Policy.RetryOn）
+const (
+	ErrorTimeout = "timeout" // 超時（包括單次嘗試超時、響應頭超時）
+	ErrorConnect = "connect" // 建立連接失敗（拒絕連接、DNS 解析失敗、撥號失敗）
+	ErrorReset   = "reset"   // 連接被重置或提前關閉
+	ErrorAny     = "any"     // 任何錯誤（調用方取消除外）
+)
+
+// ErrAttemptTimeout 單次嘗試超過 AttemptTimeout
+var ErrAttemptTimeout = errors.New("attempt timed out")
+
+// Policy 重試策略，零值表示只嘗試一次
+type Policy struct {
+	MaxAttempts    int           // 最多嘗試次數（含首次，小於 1 按 1 處理）
+	AttemptTimeout time.Duration // 單次嘗試的時限（0 表示不單獨限制）
+	RetryOn        []string      // 可重試的錯誤類別
+	RetryStatus    []int         // 可重試的響應狀態碼
+	HedgeDelay     time.Duration // 當前嘗試超過此時間未返回即並行發起下一次嘗試（0 表示不對沖）
+	Backoff        time.Duration // 失敗後重試前的等待，按已失敗次數線性增加（0 表示立即重試）
+}
+
+// Attempts 最多嘗試次數
+func (p Policy) Attempts() int {
+	return max(p.MaxAttempts, 1)
+}
+
+// Validate 檢查策略
+func (p Policy) Validate() error {
+	if p.MaxAttempts < 1 {
+		return errors.New("max_attempts must be at least 1")
+	}
+	if p.AttemptTimeout < 0 || p.HedgeDelay < 0 || p.Backoff < 0 {
+		return errors.New("attempt_timeout, hedge_delay and backoff must not be negative")
+	}
+	for _, c := range p.RetryOn {
+		switch c {
+		case ErrorTimeout, ErrorConnect, ErrorReset, ErrorAny:
+		default:
+			return fmt.Errorf("unknown error class %q (want %s, %s, %s or %s)", c, ErrorTimeout, ErrorConnect, ErrorReset, ErrorAny)
+		}
+	}
+	for _, code := range p.RetryStatus {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid retry status %d", code)
+		}
+	}
+	return nil
+}
+
+// RetryableStatus 判斷響應狀態碼是否可重試
+func (p Policy) RetryableStatus(code int) bool {
+	return slices.Contains(p.RetryStatus, code)
+}
+
+// RetryableError 判斷錯誤是否可重試
+func (p Policy) RetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) && !errors.Is(err, ErrAttemptTimeout) {
+		return false
+	}
+	if slices.Contains(p.RetryOn, ErrorAny) {
+		return true
+	}
+	c := Classify(err)
+	return c != "" && slices.Contains(p.RetryOn, c)
+}
+
+// Classify 返回錯誤所屬的類別，無法歸類時返回空字符串
+func Classify(err error) string {
+	if err == nil {
+		return ""
+	}
+	var ne net.Error
+	if errors.Is(err, ErrAttemptTimeout) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &ne) && ne.Timeout() || strings.Contains(err.Error(), "timeout awaiting response headers") {
+		return ErrorTimeout
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorReset
+	}
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.As(err, &dnsErr) ||
+		errors.As(err, &opErr) && opErr.Op == "dial" {
+		return ErrorConnect
+	}
+	return ""
+}
+
+// result 單次嘗試的結果
+type result[T any] struct {
+	attempt int
+	value   T
+	err     error
+	cancel  context.CancelFunc
+}
+
+// Do 按策略執行 fn，直到得到可用結果或不再重試；fn 每次收到獨立的 context 和從 1 開始的嘗試序號
+//
+// retryable 判斷成功返回的結果是否仍需重試（如狀態碼，可為 nil）；最後一次嘗試的此類結果照常返回。
+// discard 釋放未被採用的結果（如關閉響應體或連接，可為 nil）。
+// 設置了 HedgeDelay 時，當前嘗試在該時間內未返回即並行發起下一次嘗試，採用最先可用的結果並取消其餘嘗試。
+// 返回的 release 須在結果用完後調用，以釋放勝出嘗試的 context。
+func Do[T any](ctx context.Context, p Policy, fn func(ctx context.Context, attempt int) (T, error),
+	retryable func(T) bool, discard func(T)) (value T, release func(), err error) {
+	attempts := p.Attempts()
+	results := make(chan result[T], attempts)
+	started, pending, failures := 0, 0, 0
+	cancels := make(map[int]context.CancelCauseFunc, attempts) // 進行中的嘗試
+
+	launch := func() {
+		started++
+		pending++
+		attempt := started
+		actx, cancel := context.WithCancelCause(ctx)
+		cancels[attempt] = cancel
+		var timer *time.Timer
+		if p.AttemptTimeout > 0 {
+			timer = time.AfterFunc(p.AttemptTimeout, func() { cancel(ErrAttemptTimeout) })
+		}
+		go func() {
+			v, err := fn(actx, attempt)
+			if timer != nil && !timer.Stop() && err == nil {
+				// 返回時恰好超時，context 已取消，結果不可用
+				if discard != nil {
+					discard(v)
+				}
+				var zero T
+				v, err = zero, ErrAttemptTimeout
+			}
+			if err != nil && !errors.Is(err, ErrAttemptTimeout) && errors.Is(context.Cause(actx), ErrAttemptTimeout) {
+				err = fmt.Errorf("%w: %w", ErrAttemptTimeout, err)
+			}
+			results <- result[T]{attempt: attempt, value: v, err: err, cancel: func() { cancel(nil) }}
+		}()
+	}
+
+	// abandon 取消並釋放仍在進行中的嘗試
+	abandon := func(n int) {
+		for _, cancel := range cancels {
+			cancel(context.Canceled)
+		}
+		go func() {
+			for range n {
+				r := <-results
+				if r.err == nil && discard != nil {
+					discard(r.value)
+				}
+				r.cancel()
+			}
+		}()
+	}
+
+	var hedge *time.Timer
+	hedgeC := func() <-chan time.Time {
+		if hedge == nil {
+			return nil
+		}
+		return hedge.C
+	}
+	armHedge := func() {
+		if hedge != nil {
+			hedge.Stop()
+			hedge = nil
+		}
+		if p.HedgeDelay > 0 && started < attempts {
+			hedge = time.NewTimer(p.HedgeDelay)
+		}
+	}
+	defer func() {
+		if hedge != nil {
+			hedge.Stop()
+		}
+	}()
+
+	launch()
+	armHedge()
+
+	var last result[T]
+	haveLast := false
+	for pending > 0 {
+		select {
+		case <-hedgeC():
+			hedge = nil
+			launch()
+			armHedge()
+			continue
+		case r := <-results:
+			pending--
+			delete(cancels, r.attempt)
+			if r.err == nil && (retryable == nil || !retryable(r.value)) {
+				if haveLast {
+					if last.err == nil && discard != nil {
+						discard(last.value)
+					}
+					last.cancel()
+				}
+				abandon(pending)
+				return r.value, r.cancel, nil
+			}
+
+			// 保留最近一次結果，所有嘗試都失敗時返回
+			if haveLast {
+				if last.err == nil && discard != nil {
+					discard(last.value)
+				}
+				last.cancel()
+			}
+			last, haveLast = r, true
+			failures++
+
+			again := r.err == nil || p.RetryableError(r.err)
+			if !again || started >= attempts || ctx.Err() != nil {
+				continue
+			}
+			if pending == 0 && p.Backoff > 0 {
+				select {
+				case <-time.After(time.Duration(failures) * p.Backoff):
+				case <-ctx.Done():
+					continue
+				}
+			}
+			// 對沖中的其他嘗試仍在進行時立即補上一次，否則按重試處理
+			launch()
+			armHedge()
+		}
+	}
+
+	return last.value, last.cancel, last.err
+}
+
+// DoHTTP 按策略發送 HTTP 請求：狀態碼在 RetryStatus 中的響應會觸發重試，未採用的響應體自動關閉
+// 返回的響應體關閉時釋放勝出嘗試的 context
+func DoHTTP(ctx context.Context, p Policy, fn func(ctx context.Context, attempt int) (*http.Response, error)) (*http.Response, error) {
+	resp, release, err := Do(ctx, p, fn, func(resp *http.Response) bool {
+		return p.RetryableStatus(resp.StatusCode)
+	}, DiscardResponse)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// DiscardResponse 讀取少量剩餘內容後關閉響應體，使連接可被複用
+func DiscardResponse(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+}
+
+// releaseBody 關閉時釋放所屬嘗試的 context
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
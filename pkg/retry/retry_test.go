@@ -0,0 +1,184 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{ErrAttemptTimeout, ErrorTimeout},
+		{fmt.Errorf("get: %w", context.DeadlineExceeded), ErrorTimeout},
+		{errors.New("net/http: timeout awaiting response headers"), ErrorTimeout},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, ErrorReset},
+		{io.ErrUnexpectedEOF, ErrorReset},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ErrorConnect},
+		{&net.DNSError{Err: "no such host", Name: "x.invalid"}, ErrorConnect},
+		{errors.New("tls: bad certificate"), ""},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	valid := Policy{MaxAttempts: 2, RetryOn: []string{ErrorTimeout, ErrorAny}, RetryStatus: []int{503}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	for _, p := range []Policy{
+		{},
+		{MaxAttempts: 1, HedgeDelay: -time.Second},
+		{MaxAttempts: 1, RetryOn: []string{"sometimes"}},
+		{MaxAttempts: 1, RetryStatus: []int{42}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", p)
+		}
+	}
+}
+
+func TestDoHTTPRetryStatus(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	get := func(ctx context.Context, _ int) (*http.Response, error) {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		return http.DefaultClient.Do(req)
+	}
+
+	// 嘗試次數足夠時得到成功響應
+	resp, err := DoHTTP(context.Background(), Policy{MaxAttempts: 3, RetryStatus: []int{503}}, get)
+	if err != nil {
+		t.Fatalf("DoHTTP: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" || calls.Load() != 3 {
+		t.Errorf("status %d, body %q after %d calls", resp.StatusCode, body, calls.Load())
+	}
+
+	// 嘗試次數用完時返回最後一次響應
+	calls.Store(0)
+	resp, err = DoHTTP(context.Background(), Policy{MaxAttempts: 2, RetryStatus: []int{503}}, get)
+	if err != nil {
+		t.Fatalf("DoHTTP: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls.Load() != 2 {
+		t.Errorf("status %d after %d calls, want 503 after 2", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestDoRetryOn(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		name    string
+		policy  Policy
+		err     error
+		wantN   int32
+		wantErr bool
+	}{
+		{"retryable", Policy{MaxAttempts: 3, RetryOn: []string{ErrorConnect}}, refused, 3, true},
+		{"not listed", Policy{MaxAttempts: 3, RetryOn: []string{ErrorTimeout}}, refused, 1, true},
+		{"any", Policy{MaxAttempts: 2, RetryOn: []string{ErrorAny}}, errors.New("odd"), 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n atomic.Int32
+			_, release, err := Do(context.Background(), tt.policy, func(context.Context, int) (int, error) {
+				n.Add(1)
+				return 0, tt.err
+			}, nil, nil)
+			release()
+			if (err != nil) != tt.wantErr || n.Load() != tt.wantN {
+				t.Errorf("err = %v after %d attempts, want %d attempts", err, n.Load(), tt.wantN)
+			}
+		})
+	}
+}
+
+func TestDoAttemptTimeout(t *testing.T) {
+	p := Policy{MaxAttempts: 2, AttemptTimeout: 20 * time.Millisecond, RetryOn: []string{ErrorTimeout}}
+	v, release, err := Do(context.Background(), p, func(ctx context.Context, attempt int) (int, error) {
+		if attempt == 1 {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return attempt, nil
+	}, nil, nil)
+	defer release()
+	if err != nil || v != 2 {
+		t.Errorf("Do = %d, %v; want 2, nil", v, err)
+	}
+
+	_, release, err = Do(context.Background(), Policy{AttemptTimeout: 10 * time.Millisecond}, func(ctx context.Context, _ int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}, nil, nil)
+	release()
+	if !errors.Is(err, ErrAttemptTimeout) || Classify(err) != ErrorTimeout {
+		t.Errorf("err = %v, want ErrAttemptTimeout", err)
+	}
+}
+
+func TestDoHedge(t *testing.T) {
+	// 第一次嘗試很慢，對沖的第二次嘗試先返回
+	p := Policy{MaxAttempts: 2, HedgeDelay: 10 * time.Millisecond}
+	start := time.Now()
+	v, release, err := Do(context.Background(), p, func(ctx context.Context, attempt int) (string, error) {
+		if attempt == 1 {
+			select {
+			case <-time.After(2 * time.Second):
+				return "slow", nil
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+		return "fast", nil
+	}, nil, nil)
+	release()
+	if err != nil || v != "fast" {
+		t.Fatalf("Do = %q, %v; want fast", v, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hedged request took %v", elapsed)
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var n atomic.Int32
+	_, release, err := Do(ctx, Policy{MaxAttempts: 3, RetryOn: []string{ErrorAny}}, func(ctx context.Context, _ int) (int, error) {
+		n.Add(1)
+		return 0, ctx.Err()
+	}, nil, nil)
+	release()
+	if err == nil || !strings.Contains(err.Error(), "canceled") || n.Load() != 1 {
+		t.Errorf("err = %v after %d attempts; canceled requests must not be retried", err, n.Load())
+	}
+}
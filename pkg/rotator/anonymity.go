@@ -0,0 +1,92 @@
+package rotator
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// identityHeaders 匿名模式下總是刪除的頭部（攜帶客戶端地址或經過的代理）
+var identityHeaders = []string{
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Real-Ip",
+	"X-Client-Ip",
+	"Client-Ip",
+	"True-Client-Ip",
+	"Forwarded",
+	"Via",
+}
+
+// anonymizer 匿名模式：刪除發往目標的請求中可識別客戶端的頭部及匹配規則的頭部和 Cookie
+type anonymizer struct {
+	headers []string // 要刪除的頭部名稱通配符（小寫，path.Match 語法）
+	cookies []string // 要刪除的 Cookie 名稱通配符（區分大小寫）
+}
+
+// newAnonymizer 創建匿名模式規則，enabled 為 false 時返回 nil（不處理）；無效的通配符不匹配任何名稱
+func newAnonymizer(enabled bool, headers, cookies []string) *anonymizer {
+	if !enabled {
+		return nil
+	}
+	a := &anonymizer{cookies: cookies}
+	for _, pattern := range headers {
+		a.headers = append(a.headers, strings.ToLower(pattern))
+	}
+	return a
+}
+
+// clean 刪除身份頭部、匹配的頭部及匹配的 Cookie
+func (a *anonymizer) clean(header http.Header) {
+	if a == nil {
+		return
+	}
+	for _, name := range identityHeaders {
+		header.Del(name)
+	}
+	for name := range header {
+		if matchAny(a.headers, strings.ToLower(name)) {
+			delete(header, name)
+		}
+	}
+	if len(a.cookies) > 0 {
+		a.cleanCookies(header)
+	}
+}
+
+// cleanCookies 從 Cookie 頭中刪除名稱匹配規則的 Cookie，全部刪除時不再發送 Cookie 頭
+func (a *anonymizer) cleanCookies(header http.Header) {
+	values := header.Values("Cookie")
+	if len(values) == 0 {
+		return
+	}
+	var kept []string
+	for _, value := range values {
+		for _, pair := range strings.Split(value, ";") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			name, _, _ := strings.Cut(pair, "=")
+			if !matchAny(a.cookies, strings.TrimSpace(name)) {
+				kept = append(kept, pair)
+			}
+		}
+	}
+	if len(kept) == 0 {
+		header.Del("Cookie")
+		return
+	}
+	header.Set("Cookie", strings.Join(kept, "; "))
+}
+
+// matchAny 名稱是否匹配任一通配符
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package rotator
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAnonymizer(t *testing.T) {
+	if newAnonymizer(false, []string{"X-*"}, nil) != nil {
+		t.Fatal("disabled anonymity should return nil")
+	}
+
+	a := newAnonymizer(true, []string{"x-client-*", "X-Device-Id"}, []string{"_g*", "sid"})
+	header := http.Header{
+		"X-Forwarded-For":  {"10.0.0.1"},
+		"X-Real-Ip":        {"10.0.0.1"},
+		"Via":              {"1.1 corp"},
+		"Forwarded":        {"for=10.0.0.1"},
+		"X-Client-Name":    {"laptop"},
+		"X-Device-Id":      {"42"},
+		"X-Requested-With": {"XMLHttpRequest"},
+		"Cookie":           {"_ga=1; lang=en; _gid=2", "sid=abc"},
+	}
+	a.clean(header)
+
+	for _, name := range []string{"X-Forwarded-For", "X-Real-Ip", "Via", "Forwarded", "X-Client-Name", "X-Device-Id"} {
+		if v := header.Get(name); v != "" {
+			t.Errorf("%s should be stripped, got %q", name, v)
+		}
+	}
+	if header.Get("X-Requested-With") == "" {
+		t.Error("non-matching header should be kept")
+	}
+	if got := header.Get("Cookie"); got != "lang=en" {
+		t.Errorf("Cookie = %q, want lang=en", got)
+	}
+
+	header = http.Header{"Cookie": {"sid=abc"}}
+	a.clean(header)
+	if _, ok := header["Cookie"]; ok {
+		t.Error("Cookie header should be dropped when every cookie is stripped")
+	}
+}
+
+func TestAnonymityThroughProxy(t *testing.T) {
+	echo := newEchoServer(t)
+	server := NewProxyServer(nil, newDirectPool(t), WithAnonymity(true, nil, nil))
+	got := proxyRequest(t, server, echo.URL, http.Header{
+		"X-Forwarded-For": {"10.0.0.1"},
+		"Accept":          {"text/html"},
+	})
+	if v := got.Get("X-Forwarded-For"); v != "" {
+		t.Errorf("X-Forwarded-For leaked in anonymity mode: %q", v)
+	}
+	if got.Get("Accept") != "text/html" {
+		t.Errorf("regular headers should pass through, got %v", got)
+	}
+}
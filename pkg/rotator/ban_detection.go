@@ -0,0 +1,111 @@
+package rotator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultBanMaxBody 檢查封禁頁面時讀取的響應體上限
+const DefaultBanMaxBody = 64 << 10
+
+// BanRules 判斷目標響應是否表示上遊代理已被封禁的規則
+type BanRules struct {
+	Status       []int    // 表示封禁的狀態碼（如 403、429）
+	BodyPatterns []string // 匹配響應體開頭的正則（如驗證碼頁面），只檢查文本類響應
+	MaxBody      int64    // 匹配正則時讀取的響應體上限（0 表示 DefaultBanMaxBody）
+	Retries      int      // 被封禁後換代理重試的次數（0 表示只標記不重試，需請求體可重放）
+}
+
+// BanDetector 按規則識別目標的封禁響應：觸發封禁的代理標記為被該域名封禁（見 WithDomainMemory），
+// 並可經由另一個代理透明重試
+type BanDetector struct {
+	status   []int
+	patterns []*regexp.Regexp
+	maxBody  int64
+	retries  int
+}
+
+// NewBanDetector 校驗並編譯封禁規則，沒有任何狀態碼和正則時返回 nil（不啟用）
+func NewBanDetector(rules BanRules) (*BanDetector, error) {
+	if len(rules.Status) == 0 && len(rules.BodyPatterns) == 0 {
+		return nil, nil
+	}
+	d := &BanDetector{status: rules.Status, maxBody: rules.MaxBody, retries: rules.Retries}
+	for _, code := range rules.Status {
+		if code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid ban status %d", code)
+		}
+	}
+	for i, pattern := range rules.BodyPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("ban pattern %d: %w", i, err)
+		}
+		d.patterns = append(d.patterns, re)
+	}
+	if d.maxBody <= 0 {
+		d.maxBody = DefaultBanMaxBody
+	}
+	if d.retries < 0 {
+		return nil, fmt.Errorf("ban retries must not be negative")
+	}
+	return d, nil
+}
+
+// enabled 是否啟用封禁識別
+func (d *BanDetector) enabled() bool {
+	return d != nil
+}
+
+// retryable 被封禁時是否換代理重試
+func (d *BanDetector) retryable() bool {
+	return d.enabled() && d.retries > 0
+}
+
+// textual 響應是否為可能包含封禁頁面的文本類內容（HTML、純文本、JSON 或未聲明類型）
+func textual(header http.Header) bool {
+	ct := header.Get("Content-Type")
+	if ct == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || mediaType == "application/xhtml+xml"
+}
+
+// detect 判斷響應是否表示封禁；需要匹配響應體時讀取開頭至多 maxBody 字節，並把已讀取的內容放回響應體，
+// 轉發給客戶端的響應不受影響
+func (d *BanDetector) detect(resp *http.Response) bool {
+	if !d.enabled() {
+		return false
+	}
+	if slices.Contains(d.status, resp.StatusCode) {
+		return true
+	}
+	if len(d.patterns) == 0 || !textual(resp.Header) || resp.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	head, err := io.ReadAll(io.LimitReader(resp.Body, d.maxBody))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	if err != nil {
+		return false
+	}
+	for _, re := range d.patterns {
+		if re.Match(head) {
+			return true
+		}
+	}
+	return false
+}
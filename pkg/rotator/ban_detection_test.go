@@ -0,0 +1,97 @@
+package rotator
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewBanDetector(t *testing.T) {
+	if d, err := NewBanDetector(BanRules{}); d != nil || err != nil {
+		t.Fatalf("empty rules = %v, %v, want disabled", d, err)
+	}
+	if _, err := NewBanDetector(BanRules{Status: []int{42}}); err == nil {
+		t.Error("invalid status should be rejected")
+	}
+	if _, err := NewBanDetector(BanRules{BodyPatterns: []string{"("}}); err == nil {
+		t.Error("invalid pattern should be rejected")
+	}
+}
+
+func TestBanDetectorDetect(t *testing.T) {
+	d, err := NewBanDetector(BanRules{Status: []int{429}, BodyPatterns: []string{`(?i)captcha`}})
+	if err != nil {
+		t.Fatalf("NewBanDetector: %v", err)
+	}
+
+	newResp := func(status int, ct, body string) *http.Response {
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {ct}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}
+	}
+
+	if !d.detect(newResp(429, "text/plain", "")) {
+		t.Error("429 should be detected as a ban")
+	}
+
+	// 匹配響應體後響應體仍完整
+	resp := newResp(200, "text/html; charset=utf-8", "<html>Please solve the CAPTCHA</html>")
+	if !d.detect(resp) {
+		t.Error("captcha page should be detected as a ban")
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "<html>Please solve the CAPTCHA</html>" {
+		t.Errorf("body after detect = %q", body)
+	}
+
+	if d.detect(newResp(200, "image/png", "captcha")) {
+		t.Error("non-text responses should not be matched")
+	}
+	if d.detect(newResp(200, "text/html", "<html>ok</html>")) {
+		t.Error("normal page detected as a ban")
+	}
+}
+
+func TestBanRetry(t *testing.T) {
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+
+	bans, err := NewBanDetector(BanRules{Status: []int{http.StatusForbidden}, Retries: 1})
+	if err != nil {
+		t.Fatalf("NewBanDetector: %v", err)
+	}
+	server := NewProxyServer(nil, newDirectPool(t), WithBanDetector(bans), WithDomainMemory(time.Hour, 3))
+	front := httptest.NewServer(server.handler)
+	defer front.Close()
+
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+	resp, err := client.Get(target.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200 after retrying the banned attempt", resp.StatusCode)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("target hits = %d, want 2", n)
+	}
+	// 唯一的出口被封禁後放寬約束重試，重試成功即解除封禁
+	if recs := server.DomainRecords(false); len(recs) != 1 || recs[0].Domain != "127.0.0.1" || recs[0].Burned || recs[0].Successes != 1 {
+		t.Errorf("domain records = %+v, want one unburned record for 127.0.0.1", recs)
+	}
+}
@@ -0,0 +1,164 @@
+package rotator
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+)
+
+var throttledSeconds = metrics.NewCounterVec("dynamic_proxy_bandwidth_throttled_seconds_total",
+	"Time forwarding was paused by the bandwidth limits, by scope.", "scope")
+
+// 限速範圍
+const (
+	bandwidthGlobal = "global"
+	bandwidthClient = "client"
+)
+
+// tokenBucket 令牌桶：令牌按每秒 rate 字節補充，最多累積一秒的量；取出後可為負，表示需要等待的欠額
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// reserve 取出 n 字節的令牌，返回令牌補足前需要等待的時長
+func (b *tokenBucket) reserve(n int, rate int64, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.last.IsZero() {
+		b.tokens = float64(rate)
+	} else {
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*float64(rate), float64(rate))
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(rate) * float64(time.Second))
+}
+
+// bandwidthLimiter 轉發流量的限速（每秒字節數，0 表示不限制）：global 為所有客戶端合計，perClient 為每個客戶端；
+// 兩個方向的流量計入同一個額度（代理轉發的每個字節都要經由本機上行發送一次）。Reload 時新處理器沿用同一個實例，只更新速率
+type bandwidthLimiter struct {
+	global    atomic.Int64
+	perClient atomic.Int64
+	bucket    tokenBucket
+
+	mu      sync.Mutex
+	clients map[string]*clientBucket
+}
+
+// clientBucket 一個客戶端的令牌桶，refs 為正在使用它的轉發數，歸零時刪除
+type clientBucket struct {
+	tokenBucket
+	refs int
+}
+
+func newBandwidthLimiter(global, perClient int64) *bandwidthLimiter {
+	l := &bandwidthLimiter{clients: make(map[string]*clientBucket)}
+	l.set(global, perClient)
+	return l
+}
+
+// set 更新速率，已在限速的轉發按新速率繼續
+func (l *bandwidthLimiter) set(global, perClient int64) {
+	l.global.Store(global)
+	l.perClient.Store(perClient)
+}
+
+// shaper 為客戶端的一次轉發（響應體、CONNECT 隧道或升級連接）創建限速器，未設置限速時返回 nil；轉發結束後調用 close
+func (l *bandwidthLimiter) shaper(client string) *shaper {
+	if l.global.Load() <= 0 && l.perClient.Load() <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.clients[client]
+	if b == nil {
+		b = &clientBucket{}
+		l.clients[client] = b
+	}
+	b.refs++
+	return &shaper{limiter: l, client: client, bucket: b}
+}
+
+// shaper 按全局及客戶端額度限制一次轉發的讀取速度
+type shaper struct {
+	limiter *bandwidthLimiter
+	client  string
+	bucket  *clientBucket
+	once    sync.Once
+}
+
+// close 結束轉發，客戶端沒有其他轉發時刪除它的令牌桶
+func (s *shaper) close() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		l := s.limiter
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if s.bucket.refs--; s.bucket.refs == 0 {
+			delete(l.clients, s.client)
+		}
+	})
+}
+
+// reader 包裝轉發一個方向的讀取端（未限速時原樣返回）
+func (s *shaper) reader(r io.Reader) io.Reader {
+	if s == nil {
+		return r
+	}
+	return &shapedReader{r: r, s: s}
+}
+
+// chunk 單次讀取的上限：不超過最小的速率（一秒的量），避免一次讀取積累過多欠額
+func (s *shaper) chunk(n int) int {
+	for _, rate := range []int64{s.limiter.global.Load(), s.limiter.perClient.Load()} {
+		if rate > 0 && int64(n) > rate {
+			n = int(rate)
+		}
+	}
+	return n
+}
+
+// wait 取出 n 字節的令牌，額度不足時等待
+func (s *shaper) wait(n int) {
+	now := time.Now()
+	var delay time.Duration
+	scope := ""
+	if rate := s.limiter.global.Load(); rate > 0 {
+		if d := s.limiter.bucket.reserve(n, rate, now); d > delay {
+			delay, scope = d, bandwidthGlobal
+		}
+	}
+	if rate := s.limiter.perClient.Load(); rate > 0 {
+		if d := s.bucket.reserve(n, rate, now); d > delay {
+			delay, scope = d, bandwidthClient
+		}
+	}
+	if delay > 0 {
+		throttledSeconds.Add(delay.Seconds(), scope)
+		time.Sleep(delay)
+	}
+}
+
+// shapedReader 讀到數據後按額度等待的 io.Reader
+type shapedReader struct {
+	r io.Reader
+	s *shaper
+}
+
+func (r *shapedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p[:r.s.chunk(len(p))])
+	if n > 0 {
+		r.s.wait(n)
+	}
+	return n, err
+}
@@ -0,0 +1,58 @@
+package rotator
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	var b tokenBucket
+	now := time.Now()
+	// 初始可用一秒的量，超出部分按速率等待
+	if d := b.reserve(1000, 1000, now); d != 0 {
+		t.Errorf("first reserve waits %v, want 0", d)
+	}
+	if d := b.reserve(500, 1000, now); d != 500*time.Millisecond {
+		t.Errorf("reserve beyond burst waits %v, want 500ms", d)
+	}
+	// 補充的令牌先抵消欠額，且最多累積一秒的量
+	if d := b.reserve(0, 1000, now.Add(time.Second)); d != 0 {
+		t.Errorf("reserve after refill waits %v, want 0", d)
+	}
+	if d := b.reserve(2000, 1000, now.Add(time.Hour)); d != time.Second {
+		t.Errorf("reserve after long idle waits %v, want 1s", d)
+	}
+}
+
+func TestBandwidthShaper(t *testing.T) {
+	l := newBandwidthLimiter(0, 0)
+	if s := l.shaper("10.0.0.1"); s != nil {
+		t.Fatal("shaper created without limits")
+	}
+
+	l.set(0, 64<<10)
+	s := l.shaper("10.0.0.1")
+	other := l.shaper("10.0.0.1")
+	start := time.Now()
+	n, err := io.Copy(io.Discard, s.reader(bytes.NewReader(make([]byte, 96<<10))))
+	if err != nil || n != 96<<10 {
+		t.Fatalf("copy = %d, %v", n, err)
+	}
+	// 第一秒的量立即可用，其餘 32KB 按 64KB/s 需要約半秒
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("copy took %v, want about 500ms", elapsed)
+	}
+
+	// 客戶端的所有轉發結束後刪除其令牌桶
+	s.close()
+	s.close()
+	if len(l.clients) != 1 {
+		t.Errorf("client buckets = %d after one close, want 1", len(l.clients))
+	}
+	other.close()
+	if len(l.clients) != 0 {
+		t.Errorf("client buckets = %d after all closed, want 0", len(l.clients))
+	}
+}
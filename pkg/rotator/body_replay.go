@@ -0,0 +1,125 @@
+package rotator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+// DefaultBodyBufferBytes 預設在內存中緩衝的請求體大小
+const DefaultBodyBufferBytes = 1 << 20
+
+// replayBody 可重放的請求體：小請求體緩衝在內存，較大的落盤，超出上限則只能發送一次
+type replayBody struct {
+	mem  []byte
+	file *os.File
+	// spoolPath 打開時未能刪除（如 Windows）的臨時文件，關閉後刪除
+	spoolPath  string
+	size       int64
+	replayable bool
+	// stream 不可重放時的一次性讀取源（已讀部分 + 剩餘的客戶端請求體）
+	stream io.Reader
+	used   bool
+}
+
+// bufferRequestBody 讀取並緩衝客戶端請求體
+// memLimit 為內存緩衝上限；spoolLimit > 0 時超出內存上限的請求體寫入 spoolDir 下的臨時文件
+// 超出所有上限的請求體不可重放，重試時會被拒絕而不是發送截斷的內容
+func bufferRequestBody(r *http.Request, memLimit, spoolLimit int64, spoolDir string) (*replayBody, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return &replayBody{replayable: true}, nil
+	}
+
+	mem, err := io.ReadAll(io.LimitReader(r.Body, memLimit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if int64(len(mem)) <= memLimit {
+		return &replayBody{mem: mem, size: int64(len(mem)), replayable: true}, nil
+	}
+
+	if spoolLimit <= memLimit {
+		serverLog.WithField("url", r.URL.String()).Debugf("request body exceeds %d bytes, retry disabled", memLimit)
+		return &replayBody{stream: io.MultiReader(bytes.NewReader(mem), r.Body)}, nil
+	}
+
+	// 超出內存上限，寫入臨時文件
+	f, err := os.CreateTemp(spoolDir, "dynamic-proxy-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	// 刪除文件名，文件在關閉後自動回收；不能刪除打開中的文件的系統（Windows）上改為關閉後刪除
+	b := &replayBody{file: f}
+	if err := os.Remove(f.Name()); err != nil {
+		b.spoolPath = f.Name()
+	}
+
+	if _, err := f.Write(mem); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to spool request body: %w", err)
+	}
+	n, err := io.Copy(f, io.LimitReader(r.Body, spoolLimit-int64(len(mem))+1))
+	if err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to spool request body: %w", err)
+	}
+	size := int64(len(mem)) + n
+
+	if size <= spoolLimit {
+		b.size, b.replayable = size, true
+		return b, nil
+	}
+
+	serverLog.WithField("url", r.URL.String()).Debugf("request body exceeds spool limit %d bytes, retry disabled", spoolLimit)
+	b.stream = io.MultiReader(io.NewSectionReader(f, 0, size), r.Body)
+	return b, nil
+}
+
+// Replayable 請求體是否可以重新發送
+func (b *replayBody) Replayable() bool {
+	return b.replayable
+}
+
+// ContentLength 可重放時返回請求體長度，否則返回 -1（未知）
+func (b *replayBody) ContentLength() int64 {
+	if !b.replayable {
+		return -1
+	}
+	return b.size
+}
+
+// NewReader 返回一個新的請求體讀取器，不可重放的請求體只能獲取一次
+func (b *replayBody) NewReader() (io.ReadCloser, error) {
+	if !b.replayable {
+		if b.used {
+			return nil, fmt.Errorf("request body is too large to replay")
+		}
+		b.used = true
+		return io.NopCloser(b.stream), nil
+	}
+	if b.size == 0 {
+		return http.NoBody, nil
+	}
+	if b.file != nil {
+		return io.NopCloser(io.NewSectionReader(b.file, 0, b.size)), nil
+	}
+	return io.NopCloser(bytes.NewReader(b.mem)), nil
+}
+
+// Close 釋放臨時文件
+func (b *replayBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	if b.spoolPath != "" {
+		if rmErr := os.Remove(b.spoolPath); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) && err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
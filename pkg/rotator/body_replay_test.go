@@ -0,0 +1,89 @@
+package rotator
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBufferRequestBody(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		memLimit       int64
+		spoolLimit     int64
+		wantReplayable bool
+	}{
+		{"empty body", "", 16, 0, true},
+		{"fits in memory", "hello", 16, 0, true},
+		{"spooled to disk", strings.Repeat("a", 64), 16, 128, true},
+		{"too large without spool", strings.Repeat("a", 64), 16, 0, false},
+		{"too large for spool", strings.Repeat("a", 256), 16, 128, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(tt.body))
+			b, err := bufferRequestBody(r, tt.memLimit, tt.spoolLimit, t.TempDir())
+			if err != nil {
+				t.Fatalf("bufferRequestBody failed: %v", err)
+			}
+			defer b.Close()
+
+			if b.Replayable() != tt.wantReplayable {
+				t.Fatalf("Replayable() = %v, want %v", b.Replayable(), tt.wantReplayable)
+			}
+
+			// 第一次讀取必須得到完整請求體
+			reader, err := b.NewReader()
+			if err != nil {
+				t.Fatalf("NewReader failed: %v", err)
+			}
+			got, _ := io.ReadAll(reader)
+			if string(got) != tt.body {
+				t.Fatalf("first read got %d bytes, want %d", len(got), len(tt.body))
+			}
+
+			// 可重放的請求體再次讀取結果一致，不可重放的必須報錯而不是返回截斷內容
+			reader, err = b.NewReader()
+			if !tt.wantReplayable {
+				if err == nil {
+					t.Fatalf("expected error when replaying non-replayable body")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("second NewReader failed: %v", err)
+			}
+			got, _ = io.ReadAll(reader)
+			if string(got) != tt.body {
+				t.Errorf("replay got %d bytes, want %d", len(got), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestSpoolFileRemoved(t *testing.T) {
+	dir := t.TempDir()
+	r := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(strings.Repeat("a", 64)))
+	b, err := bufferRequestBody(r, 16, 128, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	// 打開時未能刪除的臨時文件（Windows）在關閉後刪除
+	f, err := os.CreateTemp(dir, "dynamic-proxy-body-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&replayBody{file: f, spoolPath: f.Name()}).Close(); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("spool files left behind: %v", entries)
+	}
+}
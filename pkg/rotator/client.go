@@ -0,0 +1,52 @@
+package rotator
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Transport 返回經由代理池輪換出口的 http.RoundTripper，無需啟動代理服務器即可在 Go 程序中使用
+//
+// 支持與 NewProxyServer 相同的選項（WithRotateInterval、WithSelectionStrategy、WithDiversity 等），
+// 監聽地址等服務器相關選項會被忽略。請求可通過 SiteHeader 指定站點標籤、TagHeader 指定自定義標籤，這些頭部不會發往目標。
+func Transport(bdb *badger.DB, opts ...Option) http.RoundTripper {
+	return &roundTripper{handler: newProxyHandler(bdb, newOptions(opts...))}
+}
+
+// roundTripper 每個請求按輪換規則選擇上遊代理
+type roundTripper struct {
+	handler *ProxyHandler
+}
+
+// RoundTrip 實現 http.RoundTripper
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	criteria := t.handler.criteriaFromHeader(req.Header)
+	criteria.host = strings.ToLower(req.URL.Hostname())
+	if slices.ContainsFunc(criteriaHeaders, func(name string) bool { _, ok := req.Header[name]; return ok }) {
+		// RoundTripper 不得修改調用方的請求
+		req = req.Clone(req.Context())
+		for _, name := range criteriaHeaders {
+			req.Header.Del(name)
+		}
+	}
+	return t.handler.getRandomTransport(criteria).RoundTrip(req)
+}
+
+// ProxyFunc 返回可直接賦值給 http.Transport.Proxy 的函數，每次建立新連接時從代理池選擇上遊代理
+//
+// 選項與 Transport 相同；選中直連類記錄時返回 nil（不經代理）。
+// http.Transport 默認復用連接，需要每個請求都更換出口時應設置 DisableKeepAlives。
+func ProxyFunc(bdb *badger.DB, opts ...Option) func(*http.Request) (*url.URL, error) {
+	h := newProxyHandler(bdb, newOptions(opts...))
+	return func(req *http.Request) (*url.URL, error) {
+		p, err := h.pickProxy(h.criteriaFromHeader(req.Header))
+		if err != nil {
+			return nil, err
+		}
+		return p.URL(), nil
+	}
+}
@@ -0,0 +1,67 @@
+package rotator
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientAllowlist 允許使用代理的客戶端地址（IP/CIDR），nil 表示不限制
+type clientAllowlist struct {
+	prefixes []netip.Prefix
+}
+
+// newClientAllowlist 解析客戶端允許列表，無效的條目記錄警告後忽略；列表為空時返回 nil（不限制）
+func newClientAllowlist(rules []string) *clientAllowlist {
+	if len(rules) == 0 {
+		return nil
+	}
+	a := &clientAllowlist{}
+	for _, rule := range rules {
+		prefix, err := parseClientRule(rule)
+		if err != nil {
+			serverLog.Warnf("Ignoring invalid client allowlist entry %q: %v", rule, err)
+			continue
+		}
+		a.prefixes = append(a.prefixes, prefix)
+	}
+	return a
+}
+
+// parseClientRule 解析一條客戶端規則：CIDR（10.0.0.0/8）或單個 IP
+func parseClientRule(rule string) (netip.Prefix, error) {
+	rule = strings.TrimSpace(rule)
+	if strings.Contains(rule, "/") {
+		prefix, err := netip.ParsePrefix(rule)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(rule)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// check 檢查請求的客戶端地址是否在允許列表內（不可解析的地址一律拒絕）
+func (a *clientAllowlist) check(r *http.Request) error {
+	if a == nil {
+		return nil
+	}
+	client := clientIdentity(r)
+	addr, err := netip.ParseAddr(client)
+	if err != nil {
+		return fmt.Errorf("client address %q not allowed", client)
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.prefixes {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("client %s is not in the allow list", addr)
+}
@@ -0,0 +1,50 @@
+package rotator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientAllowlist(t *testing.T) {
+	a := newClientAllowlist([]string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32", "bogus"})
+	tests := []struct {
+		remote string
+		allow  bool
+	}{
+		{"10.1.2.3:5000", true},
+		{"192.168.1.5:5000", true},
+		{"192.168.1.6:5000", false},
+		{"[::ffff:10.0.0.1]:5000", true},
+		{"[2001:db8::1]:5000", true},
+		{"[2001:db9::1]:5000", false},
+		{"pipe", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		r.RemoteAddr = tt.remote
+		if err := a.check(r); (err == nil) != tt.allow {
+			t.Errorf("%s: err = %v, want allowed %v", tt.remote, err, tt.allow)
+		}
+	}
+	if newClientAllowlist(nil) != nil {
+		t.Error("empty allowlist should not restrict clients")
+	}
+}
+
+func TestClientDenied(t *testing.T) {
+	echo := newEchoServer(t)
+	// 允許的客戶端正常轉發
+	proxyRequest(t, NewProxyServer(nil, newDirectPool(t), WithClientAllowlist("127.0.0.0/8")), echo.URL, http.Header{})
+
+	server := NewProxyServer(nil, newDirectPool(t), WithClientAllowlist("10.0.0.0/8"))
+	for _, method := range []string{http.MethodGet, http.MethodConnect} {
+		req := httptest.NewRequest(method, echo.URL, nil)
+		req.RemoteAddr = "127.0.0.1:5000"
+		w := httptest.NewRecorder()
+		server.handler.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden || w.Header().Get(ReasonHeader) != ReasonClientDenied {
+			t.Errorf("%s: status = %d (%s), want 403 %s", method, w.Code, w.Header().Get(ReasonHeader), ReasonClientDenied)
+		}
+	}
+}
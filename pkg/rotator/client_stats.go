@@ -0,0 +1,237 @@
+package rotator
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+)
+
+// ClientStats 單個客戶端的使用統計
+type ClientStats struct {
+	Client   string    `json:"client"`
+	Requests int64     `json:"requests"`
+	Errors   int64     `json:"errors"`
+	BytesIn  int64     `json:"bytes_in"`  // 客戶端發往上遊的字節數
+	BytesOut int64     `json:"bytes_out"` // 上遊返回客戶端的字節數
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// ErrorRate 錯誤率（0-1）
+func (s ClientStats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+// 排行依據
+const (
+	TopByRequests = "requests"
+	TopByBytes    = "bytes"
+	TopByErrors   = "errors"
+)
+
+// 客戶端統計的保留範圍：超過 clientIdleTTL 沒有請求的客戶端被刪除，
+// 客戶端數超過 maxTrackedClients 時刪除最久沒有請求的客戶端
+const (
+	clientIdleTTL     = 24 * time.Hour
+	maxTrackedClients = 10000
+)
+
+// clientTracker 按客戶端身份統計請求數、流量和錯誤
+type clientTracker struct {
+	mu         sync.Mutex
+	clients    map[string]*ClientStats
+	idleTTL    time.Duration
+	maxClients int
+	swept      time.Time // 上次清理閒置客戶端的時刻
+}
+
+func newClientTracker() *clientTracker {
+	return &clientTracker{
+		clients:    make(map[string]*ClientStats),
+		idleTTL:    clientIdleTTL,
+		maxClients: maxTrackedClients,
+	}
+}
+
+// record 記錄一次請求
+func (t *clientTracker) record(client string, bytesIn, bytesOut int64, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.clients[client]
+	if !ok {
+		s = &ClientStats{Client: client}
+		t.clients[client] = s
+	}
+	s.Requests++
+	s.BytesIn += bytesIn
+	s.BytesOut += bytesOut
+	if failed {
+		s.Errors++
+	}
+	s.LastSeen = time.Now()
+	t.sweep(s.LastSeen)
+}
+
+// sweep 每隔 idleTTL 刪除閒置的客戶端；客戶端數超過 maxClients 時刪除最久沒有請求的客戶端，
+// 保留 maxClients 的九成，避免每個新客戶端都觸發排序。調用方持有 t.mu
+func (t *clientTracker) sweep(now time.Time) {
+	if now.Sub(t.swept) >= t.idleTTL {
+		t.swept = now
+		for client, s := range t.clients {
+			if now.Sub(s.LastSeen) > t.idleTTL {
+				delete(t.clients, client)
+			}
+		}
+	}
+	if len(t.clients) <= t.maxClients {
+		return
+	}
+	list := make([]*ClientStats, 0, len(t.clients))
+	for _, s := range t.clients {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen.Before(list[j].LastSeen) })
+	for _, s := range list[:len(list)-t.maxClients*9/10] {
+		delete(t.clients, s.Client)
+	}
+}
+
+// top 返回按指定依據排序的前 n 個客戶端（n <= 0 表示全部）
+func (t *clientTracker) top(n int, by string) []ClientStats {
+	t.mu.Lock()
+	list := make([]ClientStats, 0, len(t.clients))
+	for _, s := range t.clients {
+		list = append(list, *s)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		switch by {
+		case TopByBytes:
+			return list[i].BytesIn+list[i].BytesOut > list[j].BytesIn+list[j].BytesOut
+		case TopByErrors:
+			return list[i].Errors > list[j].Errors
+		default:
+			return list[i].Requests > list[j].Requests
+		}
+	})
+
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// clientIdentity 客戶端身份（目前為來源 IP）
+func clientIdentity(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// trackingWriter 記錄響應狀態碼和字節數，CONNECT 隧道的流量由 handleConnect 填寫
+type trackingWriter struct {
+	http.ResponseWriter
+	status   int
+	bytesIn  int64
+	bytesOut int64
+}
+
+func (tw *trackingWriter) WriteHeader(status int) {
+	if tw.status == 0 {
+		tw.status = status
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *trackingWriter) Write(b []byte) (int, error) {
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	n, err := tw.ResponseWriter.Write(b)
+	tw.bytesOut += int64(n)
+	return n, err
+}
+
+// Flush 支持流式響應
+func (tw *trackingWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 支持 CONNECT 隧道
+func (tw *trackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := tw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	return h.Hijack()
+}
+
+// addTraffic 累加請求流量（請求體或隧道流量）
+func addTraffic(w http.ResponseWriter, in, out int64) {
+	if tw, ok := w.(*trackingWriter); ok {
+		tw.bytesIn += in
+		tw.bytesOut += out
+	}
+}
+
+// setStatus 記錄已接管連接的響應狀態碼（如協議升級的 101）
+func setStatus(w http.ResponseWriter, status int) {
+	if tw, ok := w.(*trackingWriter); ok && tw.status == 0 {
+		tw.status = status
+	}
+}
+
+// failed 請求是否失敗
+func (tw *trackingWriter) failed() bool {
+	return tw.status >= http.StatusBadRequest
+}
+
+// TopClients 返回使用量最高的客戶端（by: requests, bytes, errors）
+func (p *ProxyServer) TopClients(n int, by string) []ClientStats {
+	return p.currentHandler().clients.top(n, by)
+}
+
+// startClientStatsLogger 定期在日誌中輸出使用量最高的客戶端，HttpServer 關閉（Stop）時停止
+func (p *ProxyServer) startClientStatsLogger(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	done := make(chan struct{})
+	p.HttpServer.RegisterOnShutdown(sync.OnceFunc(func() { close(done) }))
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			for i, s := range p.TopClients(5, TopByRequests) {
+				serverLog.WithFields(logger.Fields{
+					"rank":       i + 1,
+					"client":     s.Client,
+					"requests":   s.Requests,
+					"errors":     s.Errors,
+					"error_rate": s.ErrorRate(),
+					"bytes_in":   s.BytesIn,
+					"bytes_out":  s.BytesOut,
+				}).Info("Top client")
+			}
+		}
+	}()
+}
@@ -0,0 +1,61 @@
+package rotator
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientTrackerBounds(t *testing.T) {
+	c := newClientTracker()
+	c.maxClients = 10
+	for i := range 11 {
+		c.record(fmt.Sprintf("10.0.0.%d", i), 0, 0, false)
+	}
+	// 超過上限時刪除最久沒有請求的客戶端，保留上限的九成
+	if len(c.clients) != 9 {
+		t.Fatalf("tracked %d clients, want 9", len(c.clients))
+	}
+	if _, ok := c.clients["10.0.0.0"]; ok {
+		t.Error("least recently seen client should be evicted first")
+	}
+	if _, ok := c.clients["10.0.0.10"]; !ok {
+		t.Error("newest client should be kept")
+	}
+
+	// 閒置超過 idleTTL 的客戶端在下一次清理時刪除
+	c.idleTTL = time.Minute
+	c.mu.Lock()
+	for _, s := range c.clients {
+		s.LastSeen = s.LastSeen.Add(-time.Hour)
+	}
+	c.swept = time.Time{}
+	c.mu.Unlock()
+	c.record("10.0.1.1", 0, 0, false)
+	if top := c.top(0, TopByRequests); len(top) != 1 || top[0].Client != "10.0.1.1" {
+		t.Errorf("after idle sweep = %+v, want only 10.0.1.1", top)
+	}
+}
+
+func TestClientStatsLoggerStops(t *testing.T) {
+	server := NewProxyServer(nil, newDirectPool(t), WithClientStatsLogInterval(time.Millisecond))
+	if !loggerRunning() {
+		t.Fatal("client stats logger not started")
+	}
+	server.Stop()
+	deadline := time.Now().Add(time.Second)
+	for loggerRunning() {
+		if time.Now().After(deadline) {
+			t.Fatal("client stats logger still running after Stop")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// loggerRunning 是否有 startClientStatsLogger 啟動的 goroutine
+func loggerRunning() bool {
+	buf := make([]byte, 1<<20)
+	return strings.Contains(string(buf[:runtime.Stack(buf, true)]), "startClientStatsLogger")
+}
@@ -0,0 +1,122 @@
+package rotator
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+func TestTransport(t *testing.T) {
+	target := newEchoServer(t)
+	client := &http.Client{Transport: Transport(newDirectPool(t))}
+
+	req, _ := http.NewRequest(http.MethodGet, target.URL, nil)
+	req.Header.Set(SiteHeader, "")
+	req.Header.Set("X-Test", "1")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var got http.Header
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode echo: %v", err)
+	}
+	if got.Get("X-Test") != "1" {
+		t.Errorf("X-Test not forwarded: %v", got)
+	}
+	if _, ok := got[SiteHeader]; ok {
+		t.Errorf("%s should not reach the target", SiteHeader)
+	}
+}
+
+func TestTransportPoolEmpty(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open badger: %v", err)
+	}
+	defer db.Close()
+
+	client := &http.Client{Transport: Transport(db)}
+	if _, err := client.Get("http://127.0.0.1:1/"); err == nil {
+		t.Fatal("expected error from empty pool")
+	}
+}
+
+func TestProxyFunc(t *testing.T) {
+	db := newDirectPool(t)
+	p := &pool.Proxy{IP: "10.0.0.1", Port: "3128", Protocol: "http", User: "u", Pass: "p", Updated: time.Now()}
+	if err := db.Update(func(txn *badger.Txn) error {
+		// 覆蓋直連出口，只保留 http 代理
+		if err := txn.Delete([]byte(pool.KeyOf("127.0.0.1", "1"))); err != nil {
+			return err
+		}
+		return txn.Set([]byte(p.Key()), p.DumpJSON())
+	}); err != nil {
+		t.Fatalf("seed proxy: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	u, err := ProxyFunc(db)(req)
+	if err != nil {
+		t.Fatalf("ProxyFunc: %v", err)
+	}
+	if u == nil || u.String() != "http://u:p@10.0.0.1:3128" {
+		t.Errorf("ProxyFunc = %v, want http://u:p@10.0.0.1:3128", u)
+	}
+}
+
+func TestTransportTags(t *testing.T) {
+	target := newEchoServer(t)
+	db := newDirectPool(t)
+	client := &http.Client{Transport: Transport(db, WithTags("paid"))}
+
+	if _, err := client.Get(target.URL); err == nil {
+		t.Fatal("untagged proxy should not match the default tags")
+	}
+	if _, err := pool.New(db).SetTags(pool.KeyOf("127.0.0.1", "1"), []string{"paid", "datacenter"}); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, target.URL, nil)
+	req.Header.Set(TagHeader, "Datacenter")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request with tag header: %v", err)
+	}
+	defer resp.Body.Close()
+	var got http.Header
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode echo: %v", err)
+	}
+	if _, ok := got[TagHeader]; ok {
+		t.Errorf("%s should not reach the target", TagHeader)
+	}
+}
+
+func TestTransportCriteria(t *testing.T) {
+	target := newEchoServer(t)
+	db := newDirectPool(t)
+
+	elite := &http.Client{Transport: Transport(db, WithCriteria(pool.Criteria{Anonymity: []string{"elite"}}))}
+	if _, err := elite.Get(target.URL); err == nil {
+		t.Error("proxy without anonymity should not match the base criteria")
+	}
+
+	direct := &http.Client{Transport: Transport(db, WithCriteria(pool.Criteria{Protocols: []string{"direct"}}))}
+	req, _ := http.NewRequest(http.MethodGet, target.URL, nil)
+	req.Header.Set(SiteHeader, "google")
+	if _, err := direct.Do(req); err == nil {
+		t.Error("request sites should narrow the base criteria")
+	}
+	resp, err := direct.Get(target.URL)
+	if err != nil {
+		t.Fatalf("request matching the base criteria: %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,122 @@
+package rotator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+)
+
+var (
+	// openConnections 當前打開的客戶端連接數（所有代理服務器共用）
+	openConnections atomic.Int64
+
+	_ = metrics.NewGaugeFunc("dynamic_proxy_open_connections",
+		"Client connections currently open on the proxy listener.", func() float64 { return float64(openConnections.Load()) })
+)
+
+// connLimits 客戶端連接數與隧道數上限（0 表示不限制）；Reload 時新處理器沿用同一個實例，只更新上限
+type connLimits struct {
+	maxConns   atomic.Int64
+	maxTunnels atomic.Int64
+	conns      atomic.Int64
+	tunnels    atomic.Int64
+}
+
+func newConnLimits(maxConns, maxTunnels int) *connLimits {
+	l := &connLimits{}
+	l.set(maxConns, maxTunnels)
+	return l
+}
+
+// set 更新上限，已打開的連接和隧道不受影響
+func (l *connLimits) set(maxConns, maxTunnels int) {
+	l.maxConns.Store(int64(maxConns))
+	l.maxTunnels.Store(int64(maxTunnels))
+}
+
+// acquire 在不超過上限時計入一個，返回是否成功
+func acquire(count, limit *atomic.Int64) bool {
+	for {
+		n := count.Load()
+		if max := limit.Load(); max > 0 && n >= max {
+			return false
+		}
+		if count.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// acquireTunnel 為新隧道（CONNECT 或協議升級）佔用名額，超過上限時返回錯誤；成功時隧道結束後調用 release
+func (l *connLimits) acquireTunnel() (release func(), err error) {
+	if !acquire(&l.tunnels, &l.maxTunnels) {
+		return nil, fmt.Errorf("too many open tunnels (limit %d)", l.maxTunnels.Load())
+	}
+	return func() { l.tunnels.Add(-1) }, nil
+}
+
+// listener 包裝監聽器：打開的連接數達到上限時，新連接收到 503 響應後即被關閉
+func (l *connLimits) listener(ln net.Listener) net.Listener {
+	return &limitListener{Listener: ln, limits: l}
+}
+
+// limitListener 限制同時打開的客戶端連接數的 net.Listener
+type limitListener struct {
+	net.Listener
+	limits *connLimits
+}
+
+// connLimitResponse 連接數超過上限時直接寫回的響應（此時還未讀取請求，無法經由 http.Server 處理，響應體中沒有請求 ID）
+var connLimitResponse = func() string {
+	body, _ := json.Marshal(ErrorResponse{Code: ReasonConnectionLimit, Message: errorMessages[ReasonConnectionLimit]})
+	return "HTTP/1.1 503 Service Unavailable\r\n" +
+		"Content-Type: application/json\r\n" +
+		ReasonHeader + ": " + ReasonConnectionLimit + "\r\n" +
+		"Connection: close\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)+1) + "\r\n" +
+		"\r\n" +
+		string(body) + "\n"
+}()
+
+func (ln *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := ln.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if acquire(&ln.limits.conns, &ln.limits.maxConns) {
+			openConnections.Add(1)
+			return &limitedConn{Conn: conn, limits: ln.limits}, nil
+		}
+		errorsTotal.Inc(ReasonConnectionLimit)
+		go rejectConn(conn)
+	}
+}
+
+// rejectConn 向超過上限的連接寫回 503 後關閉（TLS 連接先完成握手，客戶端無響應時最多等待一秒）
+func rejectConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(time.Second))
+	conn.Write([]byte(connLimitResponse))
+	conn.Close()
+}
+
+// limitedConn 關閉時釋放連接名額（被接管用作隧道的連接在隧道關閉時釋放）
+type limitedConn struct {
+	net.Conn
+	limits *connLimits
+	once   sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(func() {
+		c.limits.conns.Add(-1)
+		openConnections.Add(-1)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,137 @@
+package rotator
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConnectionLimit(t *testing.T) {
+	echo := newEchoServer(t)
+	server := NewProxyServer(nil, newDirectPool(t), WithConnectionLimits(1, 0))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go server.serve(ln)
+	defer server.HttpServer.Close()
+
+	// get 在連接上發送一個經由代理的請求
+	get := func(conn net.Conn) *http.Response {
+		t.Helper()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(conn, "GET %s/ HTTP/1.1\r\nHost: %s\r\n\r\n", echo.URL, echo.Listener.Addr())
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("read response: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	dial := func() net.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return conn
+	}
+
+	first := dial()
+	if resp := get(first); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first connection status = %d", resp.StatusCode)
+	}
+
+	// 第一個連接仍打開時新連接被拒絕
+	second := dial()
+	defer second.Close()
+	if resp := get(second); resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get(ReasonHeader) != ReasonConnectionLimit {
+		t.Errorf("second connection = %d (%s), want 503 %s", resp.StatusCode, resp.Header.Get(ReasonHeader), ReasonConnectionLimit)
+	}
+
+	// 第一個連接關閉後名額釋放
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for server.handler.limits.conns.Load() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	third := dial()
+	defer third.Close()
+	if resp := get(third); resp.StatusCode != http.StatusOK {
+		t.Errorf("connection after release = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestTunnelLimit(t *testing.T) {
+	target := newEchoListener(t)
+	server := NewProxyServer(nil, newDirectPool(t), WithConnectionLimits(0, 1))
+	openConnectTunnel(t, server, target.Addr().String())
+
+	front := httptest.NewServer(server.handler)
+	defer front.Close()
+	conn, err := net.Dial("tcp", front.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target.Addr(), target.Addr())
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatalf("CONNECT: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get(ReasonHeader) != ReasonTunnelLimit {
+		t.Errorf("second tunnel = %d (%s), want 503 %s", resp.StatusCode, resp.Header.Get(ReasonHeader), ReasonTunnelLimit)
+	}
+}
+
+func TestTLSListener(t *testing.T) {
+	dir := t.TempDir()
+	ca, _, err := LoadOrCreateCA(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA: %v", err)
+	}
+	cert, err := ca.certFor("127.0.0.1")
+	if err != nil {
+		t.Fatalf("certFor: %v", err)
+	}
+
+	echo := newEchoServer(t)
+	server := NewProxyServer(nil, newDirectPool(t),
+		WithTLS(&tls.Config{Certificates: []tls.Certificate{*cert}, NextProtos: []string{"http/1.1"}}))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go server.serve(ln)
+	defer server.HttpServer.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+	proxyURL := &url.URL{Scheme: "https", Host: ln.Addr().String()}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL), TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := client.Get(echo.URL)
+	if err != nil {
+		t.Fatalf("request through TLS proxy: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	// 明文連接無法使用
+	plain := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: ln.Addr().String()})}}
+	if resp, err := plain.Get(echo.URL); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Error("plaintext request served by the TLS listener")
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/retry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// handleConnect 處理 CONNECT 請求（HTTPS 代理）
+func (h *ProxyHandler) handleConnect(w http.ResponseWriter, r *http.Request, criteria requestCriteria) {
+	log := requestLogger(r).WithField("url", r.URL.Host)
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Errorf("Recovered panic in handleConnect: %v", rec)
+			writeProxyError(w, r, http.StatusInternalServerError, ReasonInternal, errors.New("Internal server error: unexpected panic"))
+		}
+	}()
+
+	// 限制同時打開的隧道數（隧道存續期間佔用名額）
+	releaseTunnel, err := h.limits.acquireTunnel()
+	if err != nil {
+		writeProxyError(w, r, http.StatusServiceUnavailable, ReasonTunnelLimit, err)
+		log.WithError(err).Warn("Tunnel limit")
+		return
+	}
+	defer releaseTunnel()
+
+	// MITM 模式下隧道內的每個請求各自佔用域名槽位
+	if h.mitm != nil {
+		h.handleMITM(w, r, criteria)
+		return
+	}
+
+	// 按目標域名限制並發（隧道存續期間佔用槽位）
+	release, err := h.acquireDomainSlot(r)
+	if err != nil {
+		writeProxyError(w, r, http.StatusServiceUnavailable, ReasonDomainLimit, err)
+		log.WithError(err).Warn("Domain concurrency limit")
+		return
+	}
+	defer release()
+
+	// 記錄連接開始
+	start := time.Now()
+	log.Debug("Starting tunnel")
+
+	// 解析目標主機和端口
+	host, port, err := net.SplitHostPort(r.URL.Host)
+	if err != nil {
+		host = r.URL.Host
+		port = "443"
+	}
+
+	_ = host
+	_ = port
+
+	// 經由上遊代理連接到目標，每次嘗試都會從數據庫選擇代理
+	conn, err := h.dialTunnel(r.Context(), r.URL.Host, criteria)
+	if err != nil {
+		status := http.StatusBadGateway
+		reason := selectionFailureReason(err)
+		if reason == ReasonPoolEmpty {
+			status = http.StatusServiceUnavailable
+		}
+		writeProxyError(w, r, status, reason, err)
+		log.WithError(err).Error("Failed to connect through upstream")
+		return
+	}
+
+	// 隧道建立後才返回 200，失敗時客戶端能收到錯誤狀態碼和原因
+	w.WriteHeader(http.StatusOK)
+
+	// 構建從客戶端到 proxy 的連接（hijack）
+	hijacker, clientOk := w.(http.Hijacker)
+	if !clientOk {
+		writeProxyError(w, r, http.StatusInternalServerError, ReasonInternal, errors.New("Hijacking not supported"))
+		conn.Close()
+		return
+	}
+
+	clientConn, _, err := hijacker.Hijack()
+	if err != nil {
+		log.WithError(err).Error("Failed to hijack client connection")
+		conn.Close()
+		return
+	}
+
+	// 設置連接超時
+	deadline := w.Header().Get("X-Done")
+	if deadline != "" {
+		if d, parseErr := time.ParseDuration(deadline); parseErr == nil {
+			clientConn.SetDeadline(time.Now().Add(d))
+			conn.SetDeadline(time.Now().Add(d))
+		}
+	}
+
+	// 兩個方向都空閒超過時限或存續超過最長時間時關閉隧道
+	tunnel := h.openTunnel(h.timeouts.IdleTunnel, func() {
+		clientConn.Close()
+		conn.Close()
+	})
+
+	// 按轉發限速讀取兩個方向的流量
+	shaper := h.bandwidth.shaper(criteria.client)
+	defer shaper.close()
+	_, span := tracer.Start(r.Context(), "proxy.transfer")
+
+	// 使用協程進行雙向通信
+	var wg sync.WaitGroup
+	var bytesIn, bytesOut int64
+
+	// 發送客戶端到目標的流量
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		bytesIn = hijackClientToTarget(shaper.reader(tunnel.reader(clientConn)), conn)
+	}()
+
+	// 發送目標到客戶端的流量
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		bytesOut = hijackTargetToClient(shaper.reader(tunnel.reader(conn)), clientConn)
+	}()
+
+	// 等待任務完成
+	wg.Wait()
+	reason := tunnel.close()
+	if reason != "" {
+		log.Debugf("Tunnel closed by %s limit", reason)
+	}
+	span.SetAttributes(attribute.Int64("proxy.bytes_in", bytesIn), attribute.Int64("proxy.bytes_out", bytesOut),
+		attribute.String("proxy.tunnel_expired", reason))
+	span.End()
+	addTraffic(w, bytesIn, bytesOut)
+
+	// 關閉連接
+	clientConn.Close()
+	conn.Close()
+
+	log.WithFields(logger.Fields{
+		"bytes_in":  bytesIn,
+		"bytes_out": bytesOut,
+		"duration":  time.Since(start).String(),
+	}).Debug("Tunnel closed")
+}
+
+// dialTunnel 經由上遊代理建立到目標的連接
+// 按重試策略換代理重撥（隧道沒有響應狀態碼，RetryStatus 不適用），每次撥號都重新選擇代理
+func (h *ProxyHandler) dialTunnel(ctx context.Context, addr string, criteria requestCriteria) (net.Conn, error) {
+	transport := h.getRandomTransport(criteria)
+	attempts := h.retry.Attempts()
+
+	conn, release, err := retry.Do(ctx, h.retry, func(ctx context.Context, attempt int) (net.Conn, error) {
+		// 代理選擇與撥號的 span 由 pool 的 Transport 創建
+		ctx, span := tracer.Start(ctx, "proxy.attempt", trace.WithAttributes(attribute.Int("proxy.attempt", attempt)))
+		conn, err := transport.DialContext(ctx, "tcp", addr)
+		endSpan(span, err)
+		if err != nil && attempt < attempts && h.retry.RetryableError(err) {
+			serverLog.WithField("url", addr).WithError(err).Warnf("Tunnel dial failed, retrying (%d/%d)", attempt, attempts)
+		}
+		return conn, err
+	}, nil, func(conn net.Conn) {
+		conn.Close()
+	})
+	// 連接建立後 context 取消不影響連接
+	release()
+	return conn, err
+}
+
+// hijackClientToTarget 發送客戶端流量到目標，返回轉發的字節數
+func hijackClientToTarget(clientConn io.Reader, targetConn net.Conn) (n int64) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			serverLog.Errorf("Panic in hijackClientToTarget: %v", rec)
+		}
+		targetConn.Close()
+	}()
+
+	n, _ = io.Copy(targetConn, clientConn)
+	return n
+}
+
+// hijackTargetToClient 發送目標流量到客戶端，返回轉發的字節數
+func hijackTargetToClient(targetConn io.Reader, clientConn net.Conn) (n int64) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			serverLog.Errorf("Panic in hijackTargetToClient: %v", rec)
+		}
+		clientConn.Close()
+	}()
+
+	n, _ = io.Copy(clientConn, targetConn)
+	return n
+}
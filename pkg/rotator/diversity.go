@@ -0,0 +1,143 @@
+package rotator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// 出口多樣性統計範圍
+const (
+	DiversityScopeGlobal = "global" // 所有客戶端共用一個窗口
+	DiversityScopeClient = "client" // 每個客戶端單獨計算
+)
+
+// diversityIdleTTL 超過此時間沒有選擇的統計範圍被刪除（下次選擇時從空窗口開始）
+const diversityIdleTTL = time.Hour
+
+// diversityTracker 保證最近 window 次選擇至少使用了 minNetworks 個不同的網段（IPv4 /16）
+type diversityTracker struct {
+	mu          sync.Mutex
+	window      int
+	minNetworks int
+	perClient   bool
+	recent      map[string]*diversityScope // 範圍 -> 最近的選擇
+	idleTTL     time.Duration
+	swept       time.Time // 上次清理閒置範圍的時刻
+}
+
+// diversityScope 一個統計範圍內最近的選擇
+type diversityScope struct {
+	networks []string // 最近選擇的網段（按時間順序）
+	lastSeen time.Time
+}
+
+// newDiversityTracker 創建多樣性約束，window 或 minNetworks <= 1 表示不啟用
+func newDiversityTracker(window, minNetworks int, scope string) *diversityTracker {
+	if window <= 1 || minNetworks <= 1 {
+		return nil
+	}
+	if minNetworks > window {
+		minNetworks = window
+	}
+	return &diversityTracker{
+		window:      window,
+		minNetworks: minNetworks,
+		perClient:   scope == DiversityScopeClient,
+		recent:      make(map[string]*diversityScope),
+		idleTTL:     diversityIdleTTL,
+	}
+}
+
+// enabled 是否啟用多樣性約束
+func (d *diversityTracker) enabled() bool {
+	return d != nil
+}
+
+// scopeKey 返回客戶端所屬的統計範圍
+func (d *diversityTracker) scopeKey(client string) string {
+	if d.perClient {
+		return client
+	}
+	return ""
+}
+
+// exclusions 返回下一次選擇需要避開的網段（窗口內網段數已滿足要求時返回 nil）
+func (d *diversityTracker) exclusions(client string) map[string]bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// 下一次選擇後窗口內保留的是最近 window-1 次選擇加上新選擇
+	var recent []string
+	if s, ok := d.recent[d.scopeKey(client)]; ok {
+		recent = s.networks
+	}
+	if n := len(recent) - (d.window - 1); n > 0 {
+		recent = recent[n:]
+	}
+
+	seen := make(map[string]bool, len(recent))
+	for _, network := range recent {
+		seen[network] = true
+	}
+	if len(seen) >= d.minNetworks {
+		return nil
+	}
+	return seen
+}
+
+// record 記錄一次選擇
+func (d *diversityTracker) record(client string, p *pool.Proxy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	key := d.scopeKey(client)
+	s, ok := d.recent[key]
+	if !ok {
+		s = &diversityScope{}
+		d.recent[key] = s
+	}
+	s.networks = append(s.networks, pool.NetworkOf(p.IP))
+	if n := len(s.networks) - d.window; n > 0 {
+		s.networks = append(s.networks[:0], s.networks[n:]...)
+	}
+	s.lastSeen = now
+	d.sweep(now)
+}
+
+// sweep 每隔 idleTTL 刪除閒置的統計範圍，避免按客戶端統計時範圍無限累積；調用方持有 d.mu
+func (d *diversityTracker) sweep(now time.Time) {
+	if now.Sub(d.swept) < d.idleTTL {
+		return
+	}
+	d.swept = now
+	for key, s := range d.recent {
+		if now.Sub(s.lastSeen) > d.idleTTL {
+			delete(d.recent, key)
+		}
+	}
+}
+
+// selectDiverseProxy 在多樣性約束下選擇代理，避開最近使用過的網段
+// 沒有其他網段的代理可用時放寬約束，而不是拒絕請求
+func (h *ProxyHandler) selectDiverseProxy(criteria requestCriteria) (*pool.Proxy, error) {
+	if !h.diversity.enabled() {
+		return h.pool.Select(criteria.Criteria)
+	}
+
+	constrained := criteria
+	constrained.ExcludeNetworks = h.diversity.exclusions(criteria.client)
+	p, err := h.pool.Select(constrained.Criteria)
+	if err != nil && constrained.ExcludeNetworks != nil {
+		serverLog.WithField("client", criteria.client).WithError(err).
+			Debug("no proxy outside recently used networks, relaxing diversity constraint")
+		p, err = h.pool.Select(criteria.Criteria)
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.diversity.record(criteria.client, p)
+	return p, nil
+}
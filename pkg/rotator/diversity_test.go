@@ -0,0 +1,73 @@
+package rotator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+func TestDiversityTracker(t *testing.T) {
+	if newDiversityTracker(0, 2, DiversityScopeGlobal).enabled() {
+		t.Fatalf("zero window should disable the tracker")
+	}
+
+	d := newDiversityTracker(4, 2, DiversityScopeGlobal)
+
+	// 窗口為空時無需避開任何網段
+	if ex := d.exclusions("a"); len(ex) != 0 {
+		t.Fatalf("empty window exclusions = %v, want none", ex)
+	}
+
+	d.record("a", &pool.Proxy{IP: "1.2.3.4"})
+	d.record("a", &pool.Proxy{IP: "1.2.9.9"})
+	ex := d.exclusions("b")
+	if !ex["1.2.0.0/16"] || len(ex) != 1 {
+		t.Fatalf("exclusions = %v, want only 1.2.0.0/16", ex)
+	}
+
+	// 窗口內已有兩個網段，約束已滿足
+	d.record("a", &pool.Proxy{IP: "5.6.7.8"})
+	if ex := d.exclusions("a"); ex != nil {
+		t.Fatalf("exclusions = %v, want none once min networks is reached", ex)
+	}
+
+	// 舊記錄滑出窗口後，只剩同一網段時重新要求換網段
+	for i := 0; i < 3; i++ {
+		d.record("a", &pool.Proxy{IP: "9.9.1.1"})
+	}
+	if ex := d.exclusions("a"); !ex["9.9.0.0/16"] {
+		t.Fatalf("exclusions = %v, want 9.9.0.0/16 after window slides", ex)
+	}
+}
+
+func TestDiversityTrackerPerClient(t *testing.T) {
+	d := newDiversityTracker(3, 2, DiversityScopeClient)
+
+	d.record("a", &pool.Proxy{IP: "1.2.3.4"})
+	if ex := d.exclusions("b"); len(ex) != 0 {
+		t.Errorf("client b exclusions = %v, want none", ex)
+	}
+	if ex := d.exclusions("a"); !ex["1.2.0.0/16"] {
+		t.Errorf("client a exclusions = %v, want 1.2.0.0/16", ex)
+	}
+}
+
+func TestDiversityTrackerEvictsIdleScopes(t *testing.T) {
+	d := newDiversityTracker(3, 2, DiversityScopeClient)
+	d.record("a", &pool.Proxy{IP: "1.2.3.4"})
+	d.record("b", &pool.Proxy{IP: "1.2.3.4"})
+
+	d.mu.Lock()
+	d.recent["a"].lastSeen = time.Now().Add(-2 * d.idleTTL)
+	d.swept = time.Time{}
+	d.mu.Unlock()
+	d.record("c", &pool.Proxy{IP: "5.6.7.8"})
+
+	if _, ok := d.recent["a"]; ok || len(d.recent) != 2 {
+		t.Errorf("scopes after sweep = %d, want idle client a removed", len(d.recent))
+	}
+	if ex := d.exclusions("a"); len(ex) != 0 {
+		t.Errorf("evicted client a exclusions = %v, want none", ex)
+	}
+}
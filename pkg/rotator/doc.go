@@ -0,0 +1,11 @@
+// Package rotator 輪換出口的 HTTP/HTTPS 代理服務器，每個請求（或每個輪換間隔）經由代理池中的不同上遊代理轉發
+//
+//	server := rotator.NewProxyServer(nil, db, rotator.WithAddr(":8080"), rotator.WithRotateInterval(5*time.Minute))
+//	if err := server.Start(); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// 不需要代理服務器時，可用 Transport 或 ProxyFunc 直接在 http.Client 中按相同規則輪換出口：
+//
+//	client := &http.Client{Transport: rotator.Transport(db, rotator.WithRotateInterval(5*time.Minute))}
+package rotator
@@ -0,0 +1,91 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// domainLimiter 限制每個目標域名同時進行中的請求數
+type domainLimiter struct {
+	mu    sync.Mutex
+	limit int
+	slots map[string]*domainSlot
+}
+
+// domainSlot 單個域名的信號量及引用計數（無人使用時回收）
+type domainSlot struct {
+	sem  chan struct{}
+	refs int
+}
+
+// newDomainLimiter 創建域名並發限制器，limit <= 0 表示不限制
+func newDomainLimiter(limit int) *domainLimiter {
+	return &domainLimiter{
+		limit: limit,
+		slots: make(map[string]*domainSlot),
+	}
+}
+
+// enabled 是否啟用域名並發限制
+func (l *domainLimiter) enabled() bool {
+	return l != nil && l.limit > 0
+}
+
+// acquire 獲取域名的並發槽位，超出限制時排隊等待直到 ctx 結束
+// 返回的 release 函數必須調用以歸還槽位
+func (l *domainLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	if !l.enabled() {
+		return func() {}, nil
+	}
+
+	domain := strings.ToLower(host)
+
+	l.mu.Lock()
+	slot, ok := l.slots[domain]
+	if !ok {
+		slot = &domainSlot{sem: make(chan struct{}, l.limit)}
+		l.slots[domain] = slot
+	}
+	slot.refs++
+	l.mu.Unlock()
+
+	select {
+	case slot.sem <- struct{}{}:
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				<-slot.sem
+				l.unref(domain, slot)
+			})
+		}, nil
+	case <-ctx.Done():
+		l.unref(domain, slot)
+		return nil, ctx.Err()
+	}
+}
+
+// unref 減少引用計數，無人使用時刪除域名槽位
+func (l *domainLimiter) unref(domain string, slot *domainSlot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slot.refs--
+	if slot.refs == 0 {
+		delete(l.slots, domain)
+	}
+}
+
+// acquireDomainSlot 為請求的目標域名獲取並發槽位（最多排隊等待 h.boundedTimeout()）
+func (h *ProxyHandler) acquireDomainSlot(r *http.Request) (func(), error) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.boundedTimeout())
+	defer cancel()
+
+	release, err := h.domainLimiter.acquire(ctx, r.URL.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("too many concurrent requests to %s: %w", r.URL.Hostname(), err)
+	}
+	return release, nil
+}
@@ -0,0 +1,87 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// slotRefs 域名槽位的引用計數，槽位已刪除時返回 -1
+func slotRefs(l *domainLimiter, domain string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if slot, ok := l.slots[domain]; ok {
+		return slot.refs
+	}
+	return -1
+}
+
+func TestDomainLimiter(t *testing.T) {
+	l := newDomainLimiter(1)
+	release, err := l.acquire(context.Background(), "Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 超出限制時排隊等待，ctx 結束後返回錯誤並歸還引用
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire over limit = %v, want deadline exceeded", err)
+	}
+	if refs := slotRefs(l, "example.com"); refs != 1 {
+		t.Errorf("refs after cancelled acquire = %d, want 1", refs)
+	}
+
+	// 其他域名不受影響
+	other, err := l.acquire(context.Background(), "other.com")
+	if err != nil {
+		t.Fatalf("acquire other domain: %v", err)
+	}
+	other()
+
+	// 排隊中的請求在槽位歸還後獲得槽位
+	acquired := make(chan func())
+	go func() {
+		r, err := l.acquire(context.Background(), "example.com")
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- r
+	}()
+	for slotRefs(l, "example.com") != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-acquired:
+		t.Fatal("acquired a slot over the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	// release 可重複調用，不會多歸還槽位
+	release()
+	if refs := slotRefs(l, "example.com"); refs != 1 {
+		t.Errorf("refs after double release = %d, want 1", refs)
+	}
+	waiter := <-acquired
+
+	waiter()
+	if refs := slotRefs(l, "example.com"); refs != -1 {
+		t.Errorf("slot kept with refs %d after last release, want deleted", refs)
+	}
+	if len(l.slots) != 0 {
+		t.Errorf("slots = %v, want empty", l.slots)
+	}
+}
+
+func TestDomainLimiterDisabled(t *testing.T) {
+	var nilLimiter *domainLimiter
+	for _, l := range []*domainLimiter{nilLimiter, newDomainLimiter(0)} {
+		release, err := l.acquire(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+}
@@ -0,0 +1,255 @@
+package rotator
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// DefaultDomainFailures 代理對同一目標域名連續失敗多少次後視為被該域名封禁
+const DefaultDomainFailures = 3
+
+// DomainRecord 代理在某個目標域名上的近期結果（供管理 API 顯示）
+type DomainRecord struct {
+	Domain    string    `json:"domain"`
+	Proxy     string    `json:"proxy"`
+	Successes int       `json:"successes"`
+	Failures  int       `json:"failures"` // 連續失敗次數
+	LastSeen  time.Time `json:"last_seen"`
+	Burned    bool      `json:"burned"`  // 被該域名封禁，選擇時避開
+	Expires   time.Time `json:"expires"` // 記錄（及封禁狀態）自動過期的時刻
+}
+
+// domainMemory 按（代理，目標域名）記錄近期成功與失敗：連續失敗達到 threshold 次的代理在 ttl 內視為被該域名封禁，
+// 訪問該域名的請求選擇代理時避開；超過 ttl 沒有新結果的記錄自動過期
+type domainMemory struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	threshold int
+	domains   map[string]map[string]*domainEntry // 域名 -> 代理（見 Proxy.Key）-> 近期結果
+	swept     time.Time                          // 上次清理過期記錄的時刻
+}
+
+// domainEntry 代理在一個域名上的近期結果
+type domainEntry struct {
+	proxy       string // 代理地址（顯示用）
+	successes   int
+	failures    int
+	lastSeen    time.Time
+	burnedUntil time.Time
+}
+
+// newDomainMemory 創建域名結果記錄，ttl 或 threshold <= 0 表示不啟用
+func newDomainMemory(ttl time.Duration, threshold int) *domainMemory {
+	if ttl <= 0 || threshold <= 0 {
+		return nil
+	}
+	return &domainMemory{
+		ttl:       ttl,
+		threshold: threshold,
+		domains:   make(map[string]map[string]*domainEntry),
+	}
+}
+
+// enabled 是否啟用域名結果記錄
+func (m *domainMemory) enabled() bool {
+	return m != nil
+}
+
+// entry 返回（代理，域名）的記錄，不存在或已過期時新建；調用方持有 m.mu
+func (m *domainMemory) entry(domain string, p *pool.Proxy, now time.Time) *domainEntry {
+	proxies, ok := m.domains[domain]
+	if !ok {
+		proxies = make(map[string]*domainEntry)
+		m.domains[domain] = proxies
+	}
+	e, ok := proxies[p.Key()]
+	if !ok || m.expired(e, now) {
+		e = &domainEntry{proxy: p.String()}
+		proxies[p.Key()] = e
+	}
+	return e
+}
+
+// expired 記錄是否已過期：超過 ttl 沒有新結果且不在封禁期內
+func (m *domainMemory) expired(e *domainEntry, now time.Time) bool {
+	return now.Sub(e.lastSeen) > m.ttl && !now.Before(e.burnedUntil)
+}
+
+// record 記錄代理訪問域名的一次結果：成功解除封禁並清零連續失敗，連續失敗達到閾值時封禁 ttl
+func (m *domainMemory) record(domain string, p *pool.Proxy, ok bool) {
+	if !m.enabled() || domain == "" || p == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	e := m.entry(domain, p, now)
+	e.lastSeen = now
+	if ok {
+		e.successes++
+		e.failures = 0
+		e.burnedUntil = time.Time{}
+	} else {
+		e.failures++
+		if e.failures >= m.threshold && !now.Before(e.burnedUntil) {
+			m.burnLocked(domain, e, now)
+		}
+	}
+	m.sweep(now)
+}
+
+// burn 立即把代理標記為被域名封禁（如目標返回了封禁頁面），封禁 ttl 後自動解除
+func (m *domainMemory) burn(domain string, p *pool.Proxy) {
+	if !m.enabled() || domain == "" || p == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	e := m.entry(domain, p, now)
+	e.lastSeen = now
+	e.failures++
+	m.burnLocked(domain, e, now)
+}
+
+// burnLocked 封禁記錄 e；調用方持有 m.mu
+func (m *domainMemory) burnLocked(domain string, e *domainEntry, now time.Time) {
+	e.burnedUntil = now.Add(m.ttl)
+	serverLog.WithFields(logger.Fields{"proxy": e.proxy, "domain": domain, "until": e.burnedUntil.Format(time.RFC3339)}).
+		Info("Upstream proxy burned for domain")
+}
+
+// sweep 每隔 ttl 刪除過期記錄，避免訪問過的域名無限累積；調用方持有 m.mu
+func (m *domainMemory) sweep(now time.Time) {
+	if now.Sub(m.swept) < m.ttl {
+		return
+	}
+	m.swept = now
+	for domain, proxies := range m.domains {
+		for key, e := range proxies {
+			if m.expired(e, now) {
+				delete(proxies, key)
+			}
+		}
+		if len(proxies) == 0 {
+			delete(m.domains, domain)
+		}
+	}
+}
+
+// burned 返回當前被域名封禁的代理（見 Proxy.Key），沒有時返回 nil
+func (m *domainMemory) burned(domain string) map[string]bool {
+	if !m.enabled() || domain == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var out map[string]bool
+	for key, e := range m.domains[domain] {
+		if now.Before(e.burnedUntil) {
+			if out == nil {
+				out = make(map[string]bool)
+			}
+			out[key] = true
+		}
+	}
+	return out
+}
+
+// snapshot 返回未過期的記錄，按域名和代理排序；burnedOnly 為 true 時只返回封禁中的記錄
+func (m *domainMemory) snapshot(burnedOnly bool) []DomainRecord {
+	out := make([]DomainRecord, 0)
+	if !m.enabled() {
+		return out
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for domain, proxies := range m.domains {
+		for _, e := range proxies {
+			if m.expired(e, now) {
+				continue
+			}
+			burned := now.Before(e.burnedUntil)
+			if burnedOnly && !burned {
+				continue
+			}
+			rec := DomainRecord{
+				Domain:    domain,
+				Proxy:     e.proxy,
+				Successes: e.successes,
+				Failures:  e.failures,
+				LastSeen:  e.lastSeen,
+				Burned:    burned,
+				Expires:   e.lastSeen.Add(m.ttl),
+			}
+			if burned {
+				rec.Expires = e.burnedUntil
+			}
+			out = append(out, rec)
+		}
+	}
+	slices.SortFunc(out, func(a, b DomainRecord) int {
+		if c := strings.Compare(a.Domain, b.Domain); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Proxy, b.Proxy)
+	})
+	return out
+}
+
+// inherit 重新加載配置時複製原記錄（新的 ttl 和閾值對之後的結果生效）；
+// 原處理器上進行中的請求仍寫入原記錄，因此複製而不是共用
+func (m *domainMemory) inherit(old *domainMemory) {
+	if !m.enabled() || !old.enabled() {
+		return
+	}
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	for domain, proxies := range old.domains {
+		copied := make(map[string]*domainEntry, len(proxies))
+		for key, e := range proxies {
+			c := *e
+			copied[key] = &c
+		}
+		m.domains[domain] = copied
+	}
+	m.swept = old.swept
+}
+
+// selectUnburnedProxy 選擇代理時避開被請求目標域名封禁的代理；
+// 所有滿足條件的代理都被封禁時放寬約束，而不是拒絕請求
+func (h *ProxyHandler) selectUnburnedProxy(criteria requestCriteria) (*pool.Proxy, error) {
+	burned := h.domains.burned(criteria.host)
+	if burned == nil {
+		return h.selectDiverseProxy(criteria)
+	}
+
+	constrained := criteria
+	constrained.Exclude = burned
+	for key := range criteria.Exclude {
+		constrained.Exclude[key] = true
+	}
+	p, err := h.selectDiverseProxy(constrained)
+	if err != nil {
+		serverLog.WithFields(logger.Fields{"domain": criteria.host, "burned": len(burned)}).WithError(err).
+			Debug("no proxy left that is not burned for the domain, relaxing constraint")
+		p, err = h.selectDiverseProxy(criteria)
+	}
+	return p, err
+}
+
+// DomainRecords 返回按（代理，目標域名）記錄的近期結果，burnedOnly 為 true 時只返回被封禁的（未啟用時為空）
+func (p *ProxyServer) DomainRecords(burnedOnly bool) []DomainRecord {
+	return p.currentHandler().domains.snapshot(burnedOnly)
+}
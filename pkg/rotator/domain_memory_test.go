@@ -0,0 +1,96 @@
+package rotator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+func TestDomainMemory(t *testing.T) {
+	if newDomainMemory(0, 3).enabled() {
+		t.Fatalf("zero ttl should disable domain memory")
+	}
+
+	m := newDomainMemory(time.Hour, 2)
+	a := &pool.Proxy{IP: "1.2.3.4", Port: "80", Protocol: "http"}
+	b := &pool.Proxy{IP: "5.6.7.8", Port: "80", Protocol: "http"}
+
+	m.record("example.com", a, false)
+	if burned := m.burned("example.com"); burned != nil {
+		t.Fatalf("burned after one failure = %v, want none", burned)
+	}
+	// 成功清零連續失敗
+	m.record("example.com", a, true)
+	m.record("example.com", a, false)
+	if burned := m.burned("example.com"); burned != nil {
+		t.Fatalf("burned after a success reset = %v, want none", burned)
+	}
+
+	m.record("example.com", a, false)
+	if burned := m.burned("example.com"); !burned[a.Key()] || len(burned) != 1 {
+		t.Fatalf("burned = %v, want only %s", burned, a.Key())
+	}
+	// 封禁只針對該域名
+	if burned := m.burned("other.com"); burned != nil {
+		t.Errorf("other.com burned = %v, want none", burned)
+	}
+
+	m.burn("other.com", b)
+	recs := m.snapshot(true)
+	if len(recs) != 2 || recs[0].Domain != "example.com" || recs[1].Domain != "other.com" || !recs[1].Burned {
+		t.Fatalf("burned records = %+v", recs)
+	}
+
+	// 封禁期過後自動解除，記錄隨之過期
+	m.domains["example.com"][a.Key()].burnedUntil = time.Now().Add(-time.Second)
+	m.domains["example.com"][a.Key()].lastSeen = time.Now().Add(-2 * time.Hour)
+	if burned := m.burned("example.com"); burned != nil {
+		t.Errorf("burned after ttl = %v, want none", burned)
+	}
+	if recs := m.snapshot(false); len(recs) != 1 || recs[0].Domain != "other.com" {
+		t.Errorf("records after ttl = %+v, want only other.com", recs)
+	}
+}
+
+func TestSelectUnburnedProxy(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open badger: %v", err)
+	}
+	defer db.Close()
+
+	a := &pool.Proxy{IP: "10.0.0.1", Port: "3128", Protocol: "http", Updated: time.Now()}
+	b := &pool.Proxy{IP: "10.0.0.2", Port: "3128", Protocol: "http", Updated: time.Now()}
+	if err := db.Update(func(txn *badger.Txn) error {
+		for _, p := range []*pool.Proxy{a, b} {
+			if err := txn.Set([]byte(p.Key()), p.DumpJSON()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed proxies: %v", err)
+	}
+
+	h := newProxyHandler(db, newOptions(WithDomainMemory(time.Hour, 1)))
+	h.domains.record("example.com", a, false)
+
+	criteria := requestCriteria{host: "example.com"}
+	for i := 0; i < 20; i++ {
+		p, err := h.pickProxy(criteria)
+		if err != nil {
+			t.Fatalf("pickProxy: %v", err)
+		}
+		if p.Key() == a.Key() {
+			t.Fatalf("selected %s, which is burned for example.com", a)
+		}
+	}
+
+	// 所有代理都被封禁時放寬約束
+	h.domains.record("example.com", b, false)
+	if _, err := h.pickProxy(criteria); err != nil {
+		t.Errorf("pickProxy with every proxy burned: %v", err)
+	}
+}
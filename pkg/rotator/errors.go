@@ -0,0 +1,102 @@
+package rotator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+	"github.com/e2u/dynamic-proxy/pkg/retry"
+)
+
+// ReasonHeader 代理返回錯誤時附帶的機器可讀原因頭部
+const ReasonHeader = "X-Proxy-Error"
+
+// 錯誤原因
+const (
+	ReasonPoolEmpty          = "pool_empty"           // 沒有滿足條件的可用代理
+	ReasonAllUpstreamsFailed = "all_upstreams_failed" // 所有嘗試的上遊代理都失敗
+	ReasonDomainLimit        = "domain_limit"         // 目標域名並發已滿且等待超時
+	ReasonConnectionLimit    = "connection_limit"     // 打開的客戶端連接數已達上限
+	ReasonTunnelLimit        = "tunnel_limit"         // 打開的隧道數已達上限
+	ReasonACLDenied          = "acl_denied"           // 訪問控制拒絕
+	ReasonClientDenied       = "client_denied"        // 客戶端不在允許列表內
+	ReasonQuotaExceeded      = "quota_exceeded"       // 超出配額
+	ReasonBadRequest         = "bad_request"          // 客戶端請求無效
+	ReasonInternal           = "internal_error"       // 代理內部錯誤
+)
+
+// 錯誤響應體中比原因更具體的錯誤碼（其他原因的錯誤碼與原因相同）
+const (
+	CodeNoProxyAvailable = "no_proxy_available" // 沒有滿足條件的可用代理（pool_empty）
+	CodeUpstreamTimeout  = "upstream_timeout"   // 上遊代理或目標超時
+	CodeUpstreamRefused  = "upstream_refused"   // 上遊代理拒絕連接或無法連接
+	CodeUpstreamFailed   = "upstream_failed"    // 上遊代理的其他失敗
+)
+
+// errorMessages 各錯誤碼返回給客戶端的說明（不包含內部錯誤的細節，細節按請求 ID 記錄在日誌中）
+var errorMessages = map[string]string{
+	CodeNoProxyAvailable:  "No upstream proxy is available for this request",
+	CodeUpstreamTimeout:   "The upstream proxy timed out",
+	CodeUpstreamRefused:   "The upstream proxy refused the connection",
+	CodeUpstreamFailed:    "The upstream proxy failed",
+	ReasonDomainLimit:     "Too many concurrent requests to the target domain",
+	ReasonConnectionLimit: "Too many open connections",
+	ReasonTunnelLimit:     "Too many open tunnels",
+	ReasonACLDenied:       "The target is not allowed by the access policy",
+	ReasonClientDenied:    "The client is not allowed to use this proxy",
+	ReasonQuotaExceeded:   "Quota exceeded",
+	ReasonBadRequest:      "Bad request",
+	ReasonInternal:        "Internal proxy error",
+}
+
+// ErrorResponse 代理返回錯誤時的 JSON 響應體
+type ErrorResponse struct {
+	Code      string `json:"code"`                 // 機器可讀的錯誤碼
+	Message   string `json:"message"`              // 說明
+	RequestID string `json:"request_id,omitempty"` // 請求 ID，與日誌中的 request_id 對應
+}
+
+var errorsTotal = metrics.NewCounterVec("dynamic_proxy_errors_total",
+	"Requests answered with an error by the proxy, by reason.", "reason")
+
+// writeProxyError 返回帶原因頭部和 JSON 錯誤體的響應並按原因計數；err 只記錄在日誌中，不返回給客戶端
+func writeProxyError(w http.ResponseWriter, r *http.Request, status int, reason string, err error) {
+	errorsTotal.Inc(reason)
+	code := errorCode(reason, err)
+	id := requestID(r)
+	requestLogger(r).WithFields(logger.Fields{"status": status, "code": code}).WithError(err).Debug("Proxy error response")
+
+	w.Header().Set(ReasonHeader, reason)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Code: code, Message: errorMessages[code], RequestID: id})
+}
+
+// errorCode 根據原因和錯誤判斷響應體中的錯誤碼：上遊失敗按錯誤類別細分
+func errorCode(reason string, err error) string {
+	switch reason {
+	case ReasonPoolEmpty:
+		return CodeNoProxyAvailable
+	case ReasonAllUpstreamsFailed:
+		switch retry.Classify(err) {
+		case retry.ErrorTimeout:
+			return CodeUpstreamTimeout
+		case retry.ErrorConnect:
+			return CodeUpstreamRefused
+		}
+		return CodeUpstreamFailed
+	}
+	return reason
+}
+
+// selectionFailureReason 根據選擇代理的錯誤判斷失敗原因
+func selectionFailureReason(err error) string {
+	if errors.Is(err, pool.ErrNoProxies) {
+		return ReasonPoolEmpty
+	}
+	return ReasonAllUpstreamsFailed
+}
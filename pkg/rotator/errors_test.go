@@ -0,0 +1,117 @@
+package rotator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+func TestErrorReasonHeader(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open badger: %v", err)
+	}
+	defer db.Close()
+
+	server := NewProxyServer(nil, db)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{name: "regular request", method: http.MethodGet, target: "http://example.com/", wantStatus: http.StatusServiceUnavailable},
+		{name: "connect", method: http.MethodConnect, target: "example.com:443", wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		before := errorsTotal.Value(ReasonPoolEmpty)
+
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.method == http.MethodConnect {
+			req.URL.Host = tt.target
+		}
+		rec := httptest.NewRecorder()
+		server.handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.wantStatus)
+		}
+		if got := rec.Header().Get(ReasonHeader); got != ReasonPoolEmpty {
+			t.Errorf("%s: %s = %q, want %q", tt.name, ReasonHeader, got, ReasonPoolEmpty)
+		}
+		if got := errorsTotal.Value(ReasonPoolEmpty); got != before+1 {
+			t.Errorf("%s: pool_empty counter = %v, want %v", tt.name, got, before+1)
+		}
+		var body ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("%s: decode error body: %v", tt.name, err)
+		}
+		if body.Code != CodeNoProxyAvailable || body.Message == "" || len(body.RequestID) != 16 {
+			t.Errorf("%s: error body = %+v", tt.name, body)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type = %q", tt.name, ct)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		reason string
+		err    error
+		want   string
+	}{
+		{ReasonPoolEmpty, pool.ErrNoProxies, CodeNoProxyAvailable},
+		{ReasonAllUpstreamsFailed, fmt.Errorf("attempt 2: %w", context.DeadlineExceeded), CodeUpstreamTimeout},
+		{ReasonAllUpstreamsFailed, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, CodeUpstreamRefused},
+		{ReasonAllUpstreamsFailed, errors.New("proxy returned 407"), CodeUpstreamFailed},
+		{ReasonACLDenied, errTargetDenied, ReasonACLDenied},
+	}
+	for _, tt := range tests {
+		if got := errorCode(tt.reason, tt.err); got != tt.want {
+			t.Errorf("errorCode(%s, %v) = %s, want %s", tt.reason, tt.err, got, tt.want)
+		}
+	}
+
+	// 內部錯誤的細節不返回給客戶端
+	rec := httptest.NewRecorder()
+	writeProxyError(rec, httptest.NewRequest(http.MethodGet, "http://example.com/", nil), http.StatusBadGateway,
+		ReasonAllUpstreamsFailed, errors.New("dial tcp 10.1.2.3:8080: secret detail"))
+	if strings.Contains(rec.Body.String(), "10.1.2.3") {
+		t.Errorf("error body leaks internal details: %s", rec.Body.String())
+	}
+}
+
+func TestVersionHeader(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open badger: %v", err)
+	}
+	defer db.Close()
+
+	for _, version := range []string{"", "v1.2.0 (3f2a9c1)"} {
+		server := NewProxyServer(nil, db, WithVersionHeader(version))
+		rec := httptest.NewRecorder()
+		server.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+		got, ok := rec.Header()[VersionHeader]
+		if version == "" && ok {
+			t.Errorf("%s should be absent when disabled, got %v", VersionHeader, got)
+		}
+		if version != "" && rec.Header().Get(VersionHeader) != version {
+			t.Errorf("%s = %q, want %q", VersionHeader, rec.Header().Get(VersionHeader), version)
+		}
+	}
+}
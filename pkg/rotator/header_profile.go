@@ -0,0 +1,82 @@
+package rotator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HeaderField 頭部模板中的一個頭部
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// HeaderProfile 命名的頭部模板：同一個瀏覽器會一起發送的一組請求頭（Accept-Language、sec-ch-ua 系列、User-Agent 等）
+type HeaderProfile struct {
+	Name    string
+	Headers []HeaderField // 同名頭部出現多次時發送多個值
+}
+
+// headerProfiles 按會話範圍為請求選擇一個頭部模板並應用
+type headerProfiles struct {
+	profiles []HeaderProfile
+	scope    string
+}
+
+// NewHeaderProfiles 創建應用頭部模板的請求修改器（見 WithRequestMutators）：scope 範圍內的請求（見 SessionScopeProxy 等）固定使用同一個模板，
+// 使經由不同出口的流量看起來來自各自一致的瀏覽器。應用模板時先刪除客戶端發送的客戶端提示頭部（Sec-Ch-Ua*），
+// 再設置模板中的頭部（覆蓋客戶端的同名頭部及 User-Agent 輪換的結果）
+func NewHeaderProfiles(profiles []HeaderProfile, scope string) (RequestMutator, error) {
+	if !validSessionScope(scope) {
+		return nil, fmt.Errorf("unknown header profile scope %q", scope)
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no header profiles")
+	}
+	names := make(map[string]bool, len(profiles))
+	for i, p := range profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("header profile %d: name is required", i)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("duplicate header profile %q", p.Name)
+		}
+		names[p.Name] = true
+		if len(p.Headers) == 0 {
+			return nil, fmt.Errorf("header profile %q: no headers", p.Name)
+		}
+		for _, f := range p.Headers {
+			if f.Name == "" {
+				return nil, fmt.Errorf("header profile %q: header name is required", p.Name)
+			}
+		}
+	}
+	return &headerProfiles{profiles: profiles, scope: scope}, nil
+}
+
+// MutateRequest 實現 RequestMutator
+func (hp *headerProfiles) MutateRequest(req *http.Request, info ExchangeInfo) error {
+	p := hp.pick(info)
+	for name := range req.Header {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "Sec-Ch-Ua") {
+			req.Header.Del(name)
+		}
+	}
+	set := make(map[string]bool, len(p.Headers))
+	for _, f := range p.Headers {
+		key := http.CanonicalHeaderKey(f.Name)
+		if set[key] {
+			req.Header.Add(key, f.Value)
+			continue
+		}
+		set[key] = true
+		req.Header.Set(key, f.Value)
+	}
+	return nil
+}
+
+// pick 按範圍選擇模板
+func (hp *headerProfiles) pick(info ExchangeInfo) HeaderProfile {
+	return hp.profiles[scopedRand(hp.scope, "header-profile", info).IntN(len(hp.profiles))]
+}
@@ -0,0 +1,88 @@
+package rotator
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+func TestNewHeaderProfiles(t *testing.T) {
+	valid := []HeaderProfile{{Name: "chrome", Headers: []HeaderField{{Name: "Accept-Language", Value: "en-US"}}}}
+	tests := []struct {
+		name     string
+		profiles []HeaderProfile
+		scope    string
+	}{
+		{"unknown scope", valid, "session"},
+		{"no profiles", nil, SessionScopeProxy},
+		{"missing name", []HeaderProfile{{Headers: valid[0].Headers}}, SessionScopeProxy},
+		{"duplicate name", append(valid, valid[0]), SessionScopeProxy},
+		{"no headers", []HeaderProfile{{Name: "empty"}}, SessionScopeProxy},
+	}
+	for _, tt := range tests {
+		if _, err := NewHeaderProfiles(tt.profiles, tt.scope); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestHeaderProfiles(t *testing.T) {
+	m, err := NewHeaderProfiles([]HeaderProfile{
+		{Name: "chrome", Headers: []HeaderField{
+			{Name: "User-Agent", Value: "Chrome"},
+			{Name: "sec-ch-ua", Value: `"Chromium";v="130"`},
+			{Name: "Accept-Language", Value: "en-US,en;q=0.9"},
+		}},
+		{Name: "firefox", Headers: []HeaderField{
+			{Name: "User-Agent", Value: "Firefox"},
+			{Name: "Accept-Language", Value: "de-DE"},
+			{Name: "Accept-Language", Value: "de;q=0.8"},
+		}},
+	}, SessionScopeProxy)
+	if err != nil {
+		t.Fatalf("NewHeaderProfiles: %v", err)
+	}
+
+	apply := func(p *pool.Proxy) http.Header {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set("User-Agent", "client")
+		req.Header.Set("Sec-Ch-Ua-Platform", `"Linux"`)
+		if err := m.MutateRequest(req, ExchangeInfo{Proxy: p}); err != nil {
+			t.Fatalf("MutateRequest: %v", err)
+		}
+		return req.Header
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		p := &pool.Proxy{IP: "10.0.0.1", Port: strconv.Itoa(8000 + i), Protocol: "http"}
+		h := apply(p)
+		ua := h.Get("User-Agent")
+		seen[ua] = true
+		// 同一出口總是使用同一個模板
+		if again := apply(p).Get("User-Agent"); again != ua {
+			t.Fatalf("profile changed for the same exit: %q then %q", ua, again)
+		}
+		// 客戶端的客戶端提示頭部被刪除，模板頭部整組應用
+		if h.Get("Sec-Ch-Ua-Platform") != "" {
+			t.Errorf("client hint from the client kept: %v", h)
+		}
+		switch ua {
+		case "Chrome":
+			if h.Get("Sec-Ch-Ua") == "" || h.Get("Accept-Language") != "en-US,en;q=0.9" {
+				t.Errorf("chrome profile applied partially: %v", h)
+			}
+		case "Firefox":
+			if h.Get("Sec-Ch-Ua") != "" || len(h.Values("Accept-Language")) != 2 {
+				t.Errorf("firefox profile applied partially: %v", h)
+			}
+		default:
+			t.Errorf("unexpected User-Agent %q", ua)
+		}
+	}
+	if len(seen) != 2 {
+		t.Errorf("profiles used across exits = %v, want both", seen)
+	}
+}
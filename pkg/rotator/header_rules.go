@@ -0,0 +1,149 @@
+package rotator
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+)
+
+// 頭部改寫方向
+const (
+	HeaderDirectionRequest  = "request"
+	HeaderDirectionResponse = "response"
+)
+
+// 頭部改寫動作
+const (
+	HeaderActionAdd     = "add"     // 追加值
+	HeaderActionSet     = "set"     // 設置（覆蓋）值
+	HeaderActionRemove  = "remove"  // 刪除頭部（設置 Match 時只刪除匹配的值）
+	HeaderActionReplace = "replace" // 用正則替換值
+)
+
+// HeaderRule 頭部改寫規則
+type HeaderRule struct {
+	Domain    string // 目標域名（後綴匹配，空表示所有域名）
+	Direction string // request 或 response
+	Action    string // add, set, remove, replace
+	Name      string // 頭部名稱
+	Value     string // 新值（replace 時為替換模板，支持 $1 等分組引用）
+	Match     string // 值匹配正則（replace 必填，remove 可選）
+}
+
+// compiledHeaderRule 預編譯的頭部改寫規則
+type compiledHeaderRule struct {
+	HeaderRule
+	re *regexp.Regexp
+}
+
+// HeaderRewriter 按規則改寫請求/響應頭部
+type HeaderRewriter struct {
+	rules []compiledHeaderRule
+}
+
+// NewHeaderRewriter 校驗並編譯頭部改寫規則
+func NewHeaderRewriter(rules []HeaderRule) (*HeaderRewriter, error) {
+	rw := &HeaderRewriter{}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("header rule %d: name is required", i)
+		}
+
+		switch rule.Direction {
+		case HeaderDirectionRequest, HeaderDirectionResponse:
+		default:
+			return nil, fmt.Errorf("header rule %d: invalid direction %q", i, rule.Direction)
+		}
+
+		cr := compiledHeaderRule{HeaderRule: rule}
+		cr.Domain = strings.ToLower(strings.TrimPrefix(rule.Domain, "."))
+		if rule.Match != "" {
+			re, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("header rule %d: invalid match regex: %w", i, err)
+			}
+			cr.re = re
+		}
+
+		switch rule.Action {
+		case HeaderActionAdd, HeaderActionSet, HeaderActionRemove:
+		case HeaderActionReplace:
+			if cr.re == nil {
+				return nil, fmt.Errorf("header rule %d: replace requires match", i)
+			}
+		default:
+			return nil, fmt.Errorf("header rule %d: invalid action %q", i, rule.Action)
+		}
+
+		rw.rules = append(rw.rules, cr)
+	}
+	return rw, nil
+}
+
+// matchDomain 判斷目標主機是否匹配規則域名
+func (r *compiledHeaderRule) matchDomain(host string) bool {
+	if r.Domain == "" {
+		return true
+	}
+	host = strings.ToLower(host)
+	return host == r.Domain || strings.HasSuffix(host, "."+r.Domain)
+}
+
+// RewriteRequest 改寫發往上遊的請求頭
+func (rw *HeaderRewriter) RewriteRequest(host string, header http.Header) {
+	rw.apply(HeaderDirectionRequest, host, header)
+}
+
+// RewriteResponse 改寫返回客戶端的響應頭
+func (rw *HeaderRewriter) RewriteResponse(host string, header http.Header) {
+	rw.apply(HeaderDirectionResponse, host, header)
+}
+
+// apply 按順序應用指定方向的規則
+func (rw *HeaderRewriter) apply(direction, host string, header http.Header) {
+	if rw == nil {
+		return
+	}
+
+	for i := range rw.rules {
+		rule := &rw.rules[i]
+		if rule.Direction != direction || !rule.matchDomain(host) {
+			continue
+		}
+
+		switch rule.Action {
+		case HeaderActionAdd:
+			header.Add(rule.Name, rule.Value)
+		case HeaderActionSet:
+			header.Set(rule.Name, rule.Value)
+		case HeaderActionRemove:
+			if rule.re == nil {
+				header.Del(rule.Name)
+				continue
+			}
+			var kept []string
+			for _, v := range header.Values(rule.Name) {
+				if !rule.re.MatchString(v) {
+					kept = append(kept, v)
+				}
+			}
+			header.Del(rule.Name)
+			for _, v := range kept {
+				header.Add(rule.Name, v)
+			}
+		case HeaderActionReplace:
+			values := header.Values(rule.Name)
+			if len(values) == 0 {
+				continue
+			}
+			header.Del(rule.Name)
+			for _, v := range values {
+				header.Add(rule.Name, rule.re.ReplaceAllString(v, rule.Value))
+			}
+		}
+		serverLog.WithFields(logger.Fields{"direction": direction, "action": rule.Action, "header": rule.Name, "url": host}).Trace("header rule applied")
+	}
+}
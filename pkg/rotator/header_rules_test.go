@@ -0,0 +1,86 @@
+package rotator
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHeaderRewriter(t *testing.T) {
+	rw, err := NewHeaderRewriter([]HeaderRule{
+		{Domain: "example.com", Direction: HeaderDirectionRequest, Action: HeaderActionSet, Name: "X-Api-Key", Value: "secret"},
+		{Direction: HeaderDirectionRequest, Action: HeaderActionRemove, Name: "X-Tracking"},
+		{Direction: HeaderDirectionRequest, Action: HeaderActionRemove, Name: "Cookie", Match: "^_ga="},
+		{Direction: HeaderDirectionResponse, Action: HeaderActionReplace, Name: "Server", Match: `^nginx/.*$`, Value: "nginx"},
+	})
+	if err != nil {
+		t.Fatalf("NewHeaderRewriter failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		host      string
+		direction string
+		in        http.Header
+		want      http.Header
+	}{
+		{
+			name:      "inject api key for matching subdomain",
+			host:      "api.example.com",
+			direction: HeaderDirectionRequest,
+			in:        http.Header{"X-Tracking": {"1"}},
+			want:      http.Header{"X-Api-Key": {"secret"}},
+		},
+		{
+			name:      "no api key for other domain",
+			host:      "example.org",
+			direction: HeaderDirectionRequest,
+			in:        http.Header{"Cookie": {"_ga=1", "session=abc"}},
+			want:      http.Header{"Cookie": {"session=abc"}},
+		},
+		{
+			name:      "replace response header",
+			host:      "example.org",
+			direction: HeaderDirectionResponse,
+			in:        http.Header{"Server": {"nginx/1.25.3"}},
+			want:      http.Header{"Server": {"nginx"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.direction == HeaderDirectionRequest {
+				rw.RewriteRequest(tt.host, tt.in)
+			} else {
+				rw.RewriteResponse(tt.host, tt.in)
+			}
+			if len(tt.in) != len(tt.want) {
+				t.Fatalf("got headers %v, want %v", tt.in, tt.want)
+			}
+			for k, v := range tt.want {
+				got := tt.in.Values(k)
+				if len(got) != len(v) {
+					t.Fatalf("header %s = %v, want %v", k, got, v)
+				}
+				for i := range v {
+					if got[i] != v[i] {
+						t.Errorf("header %s[%d] = %q, want %q", k, i, got[i], v[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewHeaderRewriterInvalid(t *testing.T) {
+	rules := [][]HeaderRule{
+		{{Direction: "sideways", Action: HeaderActionSet, Name: "X"}},
+		{{Direction: HeaderDirectionRequest, Action: "explode", Name: "X"}},
+		{{Direction: HeaderDirectionRequest, Action: HeaderActionReplace, Name: "X"}},
+		{{Direction: HeaderDirectionRequest, Action: HeaderActionRemove, Name: "X", Match: "("}},
+	}
+	for i, r := range rules {
+		if _, err := NewHeaderRewriter(r); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
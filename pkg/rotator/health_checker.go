@@ -1,4 +1,4 @@
-package proxy
+package rotator
 
 import (
 	"fmt"
@@ -8,7 +8,8 @@ import (
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
-	"github.com/sirupsen/logrus"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
 )
 
 // HealthChecker 代理健康檢查器
@@ -39,7 +40,7 @@ func (hc *HealthChecker) Start() {
 		ticker := time.NewTicker(hc.interval)
 		defer ticker.Stop()
 
-		logrus.Info("Starting proxy health checker")
+		healthLog.Info("Starting proxy health checker")
 
 		for range ticker.C {
 			hc.checkAllProxies()
@@ -49,24 +50,24 @@ func (hc *HealthChecker) Start() {
 
 // Stop 停止健康檢查
 func (hc *HealthChecker) Stop() {
-	logrus.Info("Stopping proxy health checker")
+	healthLog.Info("Stopping proxy health checker")
 }
 
 // checkAllProxies 檢查所有代理
 func (hc *HealthChecker) checkAllProxies() {
 	if hc.proxyServer == nil || hc.proxyServer.BDB == nil {
-		logrus.Warn("HealthChecker: proxyServer or BDB is nil")
+		healthLog.Warn("HealthChecker: proxyServer or BDB is nil")
 		return
 	}
 
 	// 從數據庫獲取所有代理
 	proxies, err := hc.listAllProxiesFromDB()
 	if err != nil {
-		logrus.Errorf("HealthChecker: failed to list proxies from DB: %v", err)
+		healthLog.Errorf("HealthChecker: failed to list proxies from DB: %v", err)
 		return
 	}
 
-	logrus.Debugf("Checking health of %d proxies", len(proxies))
+	healthLog.Debugf("Checking health of %d proxies", len(proxies))
 
 	for _, proxy := range proxies {
 		hc.checkProxy(proxy)
@@ -74,8 +75,8 @@ func (hc *HealthChecker) checkAllProxies() {
 }
 
 // listAllProxiesFromDB 從數據庫獲取所有代理
-func (hc *HealthChecker) listAllProxiesFromDB() ([]*Proxy, error) {
-	var proxies []*Proxy
+func (hc *HealthChecker) listAllProxiesFromDB() ([]*pool.Proxy, error) {
+	var proxies []*pool.Proxy
 	err := hc.proxyServer.BDB.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchSize = 100
@@ -84,10 +85,13 @@ func (hc *HealthChecker) listAllProxiesFromDB() ([]*Proxy, error) {
 
 		for it.Rewind(); it.Valid(); it.Next() {
 			item := it.Item()
+			if pool.IsMetaKey(item.Key()) {
+				continue
+			}
 			err := item.Value(func(val []byte) error {
-				p, err := LoadFromJSON(val)
+				p, err := pool.LoadFromJSON(val)
 				if err != nil {
-					logrus.Warnf("failed to parse proxy from DB: %v", err)
+					storeLog.Warnf("failed to parse proxy from DB: %v", err)
 					return nil
 				}
 				proxies = append(proxies, p)
@@ -103,14 +107,15 @@ func (hc *HealthChecker) listAllProxiesFromDB() ([]*Proxy, error) {
 }
 
 // checkProxy 單獨檢查一個代理
-func (hc *HealthChecker) checkProxy(proxy *Proxy) {
+func (hc *HealthChecker) checkProxy(proxy *pool.Proxy) {
 	// 構建健康檢查 URL
 	checkURL := hc.buildCheckURL(proxy)
 	if checkURL == "" {
 		return
 	}
 
-	logrus.Debugf("Checking proxy %s (%s) - %s", proxy.Type, proxy.Addr, checkURL)
+	log := healthLog.WithFields(logger.Fields{"proxy": proxy.Addr, "type": proxy.Type})
+	log.WithField("url", checkURL).Debug("Checking proxy")
 
 	// 重試機制
 	success := false
@@ -119,7 +124,7 @@ func (hc *HealthChecker) checkProxy(proxy *Proxy) {
 			success = true
 			break
 		} else {
-			logrus.Debugf("Proxy %s check attempt %d/%d failed: %v", proxy.Addr, i+1, hc.maxRetries, err)
+			log.WithError(err).Debugf("Check attempt %d/%d failed", i+1, hc.maxRetries)
 		}
 		time.Sleep(1 * time.Second)
 	}
@@ -128,7 +133,7 @@ func (hc *HealthChecker) checkProxy(proxy *Proxy) {
 }
 
 // attemptCheck 嘗試檢查代理健康狀態
-func (hc *HealthChecker) attemptCheck(proxy *Proxy, checkURL string) error {
+func (hc *HealthChecker) attemptCheck(proxy *pool.Proxy, checkURL string) error {
 	var err error
 
 	switch proxy.Type {
@@ -145,7 +150,7 @@ func (hc *HealthChecker) attemptCheck(proxy *Proxy, checkURL string) error {
 }
 
 // checkHTTPProxy 檢查 HTTP/HTTPS 代理
-func (hc *HealthChecker) checkHTTPProxy(proxy *Proxy, checkURL string) error {
+func (hc *HealthChecker) checkHTTPProxy(proxy *pool.Proxy, checkURL string) error {
 	// 構建帶有代理的 HTTP 請求
 	r, err := http.NewRequest("GET", checkURL, nil)
 	if err != nil {
@@ -187,7 +192,7 @@ func (hc *HealthChecker) checkHTTPProxy(proxy *Proxy, checkURL string) error {
 }
 
 // checkSOCKS5Proxy 檢查 SOCKS5 代理
-func (hc *HealthChecker) checkSOCKS5Proxy(proxy *Proxy) error {
+func (hc *HealthChecker) checkSOCKS5Proxy(proxy *pool.Proxy) error {
 	// 尝试连接到 SOCKS5 代理
 	dialer := &net.Dialer{
 		Timeout: hc.timeout,
@@ -206,7 +211,7 @@ func (hc *HealthChecker) checkSOCKS5Proxy(proxy *Proxy) error {
 }
 
 // checkDirectConnection 檢查直連
-func (hc *HealthChecker) checkDirectConnection(proxy *Proxy) error {
+func (hc *HealthChecker) checkDirectConnection(proxy *pool.Proxy) error {
 	dialer := &net.Dialer{
 		Timeout: hc.timeout,
 	}
@@ -222,7 +227,7 @@ func (hc *HealthChecker) checkDirectConnection(proxy *Proxy) error {
 }
 
 // buildCheckURL 構建健康檢查 URL
-func (hc *HealthChecker) buildCheckURL(proxy *Proxy) string {
+func (hc *HealthChecker) buildCheckURL(proxy *pool.Proxy) string {
 	// 使用一個簡單的健康檢查端點
 	// 實際應用中可以使用專門的健康檢查服務
 	switch proxy.Type {
@@ -239,24 +244,22 @@ func (hc *HealthChecker) buildCheckURL(proxy *Proxy) string {
 }
 
 // updateProxyHealthStatus 更新代理健康狀態
-func (hc *HealthChecker) updateProxyHealthStatus(proxy *Proxy, healthy bool) {
-	// 更新代理的 Disable 狀態
-	if !healthy {
-		proxy.Disable = true
-	} else {
-		proxy.Disable = false
+func (hc *HealthChecker) updateProxyHealthStatus(proxy *pool.Proxy, healthy bool) {
+	// 更新代理的健康評分和 Disable 狀態
+	proxy.RecordResult(healthy)
+	if healthy {
 		proxy.Updated = time.Now()
 	}
 
 	// 更新到數據庫
 	if hc.proxyServer != nil && hc.proxyServer.BDB != nil {
-		key := []byte(proxy.String())
+		key := []byte(proxy.Key())
 		val := proxy.DumpJSON()
 		err := hc.proxyServer.BDB.Update(func(txn *badger.Txn) error {
 			return txn.Set(key, val)
 		})
 		if err != nil {
-			logrus.Errorf("failed to update proxy status in DB: %v", err)
+			healthLog.Errorf("failed to update proxy status in DB: %v", err)
 		}
 	}
 
@@ -264,5 +267,5 @@ func (hc *HealthChecker) updateProxyHealthStatus(proxy *Proxy, healthy bool) {
 	if healthy {
 		status = "healthy"
 	}
-	logrus.Infof("Proxy %s (%s) status: %s", proxy.Type, proxy.Addr, status)
+	healthLog.WithFields(logger.Fields{"proxy": proxy.Addr, "type": proxy.Type, "status": status}).Info("Proxy health updated")
 }
@@ -0,0 +1,68 @@
+package rotator
+
+import (
+	"net/http"
+	"strings"
+)
+
+// hopHeaders 只對單跳連接有效、代理不應轉發的頭部（RFC 7230 6.1），Connection 中列出的頭部同樣不轉發
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection", // 非標準，但客戶端常用
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// X-Forwarded-For 處理方式
+const (
+	ForwardedForAppend  = "append"  // 在客戶端發送的值後追加客戶端地址
+	ForwardedForReplace = "replace" // 只發送客戶端地址，丟棄客戶端發送的值
+	ForwardedForOmit    = "omit"    // 不發送（匿名）
+)
+
+// connectionHasToken Connection 頭中是否包含指定選項（不區分大小寫）
+func connectionHasToken(header http.Header, token string) bool {
+	for _, value := range header.Values("Connection") {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeHopHeaders 刪除單跳頭部及 Connection 中列出的頭部，請求和響應均適用
+func removeHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// setForwardedFor 按 mode 設置發往上遊的 X-Forwarded-For，clientIP 為客戶端地址（不含端口）
+func setForwardedFor(header http.Header, mode, clientIP string) {
+	switch mode {
+	case ForwardedForOmit:
+		header.Del("X-Forwarded-For")
+	case ForwardedForReplace:
+		header.Set("X-Forwarded-For", clientIP)
+	default:
+		// 多個 X-Forwarded-For 頭等價於逗號連接的單個頭
+		if prior := header.Values("X-Forwarded-For"); len(prior) > 0 {
+			clientIP = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		header.Set("X-Forwarded-For", clientIP)
+	}
+}
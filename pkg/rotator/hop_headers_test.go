@@ -0,0 +1,72 @@
+package rotator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemoveHopHeaders(t *testing.T) {
+	header := http.Header{
+		"Connection":        {"keep-alive, X-Session", "X-Trace"},
+		"Keep-Alive":        {"timeout=5"},
+		"Te":                {"trailers"},
+		"Trailer":           {"Expires"},
+		"Transfer-Encoding": {"chunked"},
+		"Upgrade":           {"h2c"},
+		"Proxy-Connection":  {"keep-alive"},
+		"X-Session":         {"abc"},
+		"X-Trace":           {"1"},
+		"Content-Type":      {"text/plain"},
+	}
+	removeHopHeaders(header)
+	if len(header) != 1 || header.Get("Content-Type") != "text/plain" {
+		t.Errorf("only end-to-end headers should remain, got %v", header)
+	}
+}
+
+func TestSetForwardedFor(t *testing.T) {
+	tests := []struct {
+		mode  string
+		prior []string
+		want  []string
+	}{
+		{ForwardedForAppend, nil, []string{"192.0.2.1"}},
+		{ForwardedForAppend, []string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.1, 10.0.0.2, 192.0.2.1"}},
+		{ForwardedForReplace, []string{"10.0.0.1"}, []string{"192.0.2.1"}},
+		{ForwardedForOmit, []string{"10.0.0.1"}, nil},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.prior != nil {
+			header["X-Forwarded-For"] = tt.prior
+		}
+		setForwardedFor(header, tt.mode, "192.0.2.1")
+		got := header["X-Forwarded-For"]
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("%s with %v: X-Forwarded-For = %v, want %v", tt.mode, tt.prior, got, tt.want)
+		}
+	}
+}
+
+func TestHopHeadersNotReturned(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "X-Upstream-Hop")
+		w.Header().Set("X-Upstream-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-End-To-End", "1")
+	}))
+	defer origin.Close()
+
+	server := NewProxyServer(nil, newDirectPool(t))
+	rec := httptest.NewRecorder()
+	server.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, origin.URL, nil))
+	for _, name := range []string{"Connection", "X-Upstream-Hop", "Keep-Alive"} {
+		if v := rec.Header().Get(name); v != "" {
+			t.Errorf("hop-by-hop response header %s returned to client: %q", name, v)
+		}
+	}
+	if rec.Header().Get("X-End-To-End") != "1" {
+		t.Errorf("end-to-end response header dropped: %v", rec.Header())
+	}
+}
@@ -0,0 +1,56 @@
+package rotator
+
+import (
+	"net/http"
+	"strings"
+)
+
+// fingerprintHeaders 嚴格模式下總是刪除的頭部（可能暴露代理軟件或客戶端真實地址）
+var fingerprintHeaders = []string{
+	"Via",
+	"Forwarded",
+	"Proxy-Connection",
+	"Proxy-Authorization",
+	"Proxy-Authenticate",
+}
+
+// outboundHygiene 嚴格出站清理：刪除發往目標的請求中可識別本代理的頭部
+type outboundHygiene struct {
+	allow map[string]bool // 允許保留的 X- 頭部（規範化名稱）
+}
+
+// newOutboundHygiene 創建出站清理規則，strict 為 false 時返回 nil（不清理）
+func newOutboundHygiene(strict bool, allow []string) *outboundHygiene {
+	if !strict {
+		return nil
+	}
+	oh := &outboundHygiene{allow: make(map[string]bool, len(allow))}
+	for _, name := range allow {
+		oh.allow[http.CanonicalHeaderKey(name)] = true
+	}
+	return oh
+}
+
+// enabled 是否啟用嚴格模式
+func (oh *outboundHygiene) enabled() bool {
+	return oh != nil
+}
+
+// clean 刪除指紋頭部及所有未在允許列表中的 X- 頭部
+func (oh *outboundHygiene) clean(header http.Header) {
+	if oh == nil {
+		return
+	}
+	for _, name := range fingerprintHeaders {
+		header.Del(name)
+	}
+	for name := range header {
+		if strings.HasPrefix(name, "X-") && !oh.allow[name] {
+			delete(header, name)
+		}
+	}
+	// 客戶端未發送 User-Agent 時，Go 會添加預設的 Go-http-client，設為空值以禁止發送
+	if header.Get("User-Agent") == "" {
+		header["User-Agent"] = []string{""}
+	}
+}
@@ -0,0 +1,125 @@
+package rotator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// newEchoServer 返回收到的請求頭（JSON）的測試目標
+func newEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Clone()
+		if ua, ok := r.Header["User-Agent"]; ok {
+			header["User-Agent"] = ua
+		}
+		_ = json.NewEncoder(w).Encode(header)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newDirectPool 創建只包含一個直連出口的內存數據庫
+func newDirectPool(t *testing.T) *badger.DB {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open badger: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	p := &pool.Proxy{IP: "127.0.0.1", Port: "1", Protocol: "direct", Updated: time.Now()}
+	if err := db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(p.Key()), p.DumpJSON())
+	}); err != nil {
+		t.Fatalf("seed proxy: %v", err)
+	}
+	return db
+}
+
+// proxyRequest 經由代理服務器請求回顯服務器，返回目標收到的請求頭
+func proxyRequest(t *testing.T, server *ProxyServer, target string, header http.Header) http.Header {
+	t.Helper()
+	front := httptest.NewServer(server.handler)
+	defer front.Close()
+
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request through proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d (%s)", resp.StatusCode, resp.Header.Get(ReasonHeader))
+	}
+
+	var got http.Header
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode echo: %v", err)
+	}
+	return got
+}
+
+func TestStrictHygiene(t *testing.T) {
+	echo := newEchoServer(t)
+	db := newDirectPool(t)
+
+	clientHeader := http.Header{
+		"Via":             {"1.1 corp-gateway"},
+		"Forwarded":       {"for=10.0.0.1"},
+		"X-Forwarded-For": {"10.0.0.1"},
+		"X-Request-Id":    {"abc"},
+		"X-Csrf-Token":    {"keep-me"},
+		"Accept":          {"text/html"},
+		"User-Agent":      {"Mozilla/5.0"},
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		server := NewProxyServer(nil, db, WithStrictHygiene(true, []string{"x-csrf-token"}))
+		got := proxyRequest(t, server, echo.URL, clientHeader.Clone())
+
+		for _, name := range []string{"Via", "Forwarded", "X-Forwarded-For", "X-Request-Id"} {
+			if v := got.Get(name); v != "" {
+				t.Errorf("%s leaked to target: %q", name, v)
+			}
+		}
+		if got.Get("X-Csrf-Token") != "keep-me" {
+			t.Errorf("allowed header X-Csrf-Token was removed")
+		}
+		if got.Get("Accept") != "text/html" || got.Get("User-Agent") != "Mozilla/5.0" {
+			t.Errorf("regular headers should pass through, got %v", got)
+		}
+	})
+
+	t.Run("strict without user agent", func(t *testing.T) {
+		server := NewProxyServer(nil, db, WithStrictHygiene(true, nil))
+		// 空值使測試客戶端本身也不發送 User-Agent
+		got := proxyRequest(t, server, echo.URL, http.Header{"User-Agent": {""}})
+		if ua, ok := got["User-Agent"]; ok {
+			t.Errorf("default Go User-Agent leaked to target: %q", ua)
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		server := NewProxyServer(nil, db)
+		got := proxyRequest(t, server, echo.URL, clientHeader.Clone())
+
+		if xff := got.Get("X-Forwarded-For"); xff != "10.0.0.1, 127.0.0.1" {
+			t.Errorf("X-Forwarded-For = %q, want client address appended", xff)
+		}
+		if got.Get("X-Request-Id") != "abc" {
+			t.Errorf("X-Request-Id should pass through without strict mode")
+		}
+	})
+}
@@ -0,0 +1,10 @@
+package rotator
+
+import "github.com/e2u/dynamic-proxy/pkg/logger"
+
+// 組件日誌器（日誌後端見 logger.SetBackend，命令行程序中可通過 -log-components 單獨設置級別）
+var (
+	serverLog = logger.For("server")
+	healthLog = logger.For("health")
+	storeLog  = logger.For("store")
+)
@@ -0,0 +1,64 @@
+package rotator
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// ExchangeInfo 一次上遊嘗試的上下文，傳給請求與響應修改器
+type ExchangeInfo struct {
+	Client  string      // 客戶端身份（見 clientIdentity）
+	Host    string      // 目標主機名（小寫）
+	Proxy   *pool.Proxy // 本次嘗試經由的上遊代理
+	Attempt int         // 嘗試序號，從 1 開始
+}
+
+// RequestMutator 請求修改器：在請求經由上遊代理發出前修改它（頭部規範化、User-Agent 輪換、Cookie 隔離等），
+// 每次嘗試（包括換代理重試）各調用一次；返回錯誤時放棄請求
+type RequestMutator interface {
+	MutateRequest(req *http.Request, info ExchangeInfo) error
+}
+
+// ResponseMutator 響應修改器：在普通請求（不包括 CONNECT 隧道和協議升級）的上遊響應轉發給客戶端前修改它；替換 resp.Body 時須同時處理 Content-Length 等頭部。
+// 返回錯誤時向客戶端返回 502
+type ResponseMutator interface {
+	MutateResponse(resp *http.Response, info ExchangeInfo) error
+}
+
+// RequestMutatorFunc 函數形式的 RequestMutator
+type RequestMutatorFunc func(req *http.Request, info ExchangeInfo) error
+
+// MutateRequest 實現 RequestMutator
+func (f RequestMutatorFunc) MutateRequest(req *http.Request, info ExchangeInfo) error {
+	return f(req, info)
+}
+
+// ResponseMutatorFunc 函數形式的 ResponseMutator
+type ResponseMutatorFunc func(resp *http.Response, info ExchangeInfo) error
+
+// MutateResponse 實現 ResponseMutator
+func (f ResponseMutatorFunc) MutateResponse(resp *http.Response, info ExchangeInfo) error {
+	return f(resp, info)
+}
+
+// mutateRequest 按順序應用請求修改器（在頭部清理和改寫規則之後）
+func (h *ProxyHandler) mutateRequest(req *http.Request, info ExchangeInfo) error {
+	for i, m := range h.requestMutators {
+		if err := m.MutateRequest(req, info); err != nil {
+			return fmt.Errorf("request mutator %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// mutateResponse 按順序應用響應修改器（在響應頭改寫規則之後）
+func (h *ProxyHandler) mutateResponse(resp *http.Response, info ExchangeInfo) error {
+	for i, m := range h.responseMutators {
+		if err := m.MutateResponse(resp, info); err != nil {
+			return fmt.Errorf("response mutator %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package rotator
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRequestMutators(t *testing.T) {
+	echo := newEchoServer(t)
+	rw, err := NewHeaderRewriter([]HeaderRule{{Direction: HeaderDirectionRequest, Action: HeaderActionSet, Name: "X-Order", Value: "rule"}})
+	if err != nil {
+		t.Fatalf("NewHeaderRewriter: %v", err)
+	}
+	var seen ExchangeInfo
+	server := NewProxyServer(nil, newDirectPool(t),
+		WithHeaderRewriter(rw),
+		WithRequestMutators(RequestMutatorFunc(func(req *http.Request, info ExchangeInfo) error {
+			seen = info
+			// 修改器在頭部改寫規則之後執行
+			req.Header.Set("X-Order", req.Header.Get("X-Order")+",first")
+			return nil
+		})),
+		WithRequestMutators(RequestMutatorFunc(func(req *http.Request, info ExchangeInfo) error {
+			req.Header.Set("X-Order", req.Header.Get("X-Order")+",second")
+			return nil
+		})),
+	)
+
+	got := proxyRequest(t, server, echo.URL, http.Header{})
+	if v := got.Get("X-Order"); v != "rule,first,second" {
+		t.Errorf("X-Order = %q, want rule,first,second", v)
+	}
+	if seen.Host != "127.0.0.1" || seen.Proxy == nil || seen.Attempt != 1 || seen.Client == "" {
+		t.Errorf("exchange info = %+v", seen)
+	}
+}
+
+func TestResponseMutators(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello tracker")
+	}))
+	defer target.Close()
+
+	server := NewProxyServer(nil, newDirectPool(t), WithResponseMutators(ResponseMutatorFunc(func(resp *http.Response, _ ExchangeInfo) error {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		body = []byte(strings.ReplaceAll(string(body), "tracker", "world"))
+		resp.Body = io.NopCloser(strings.NewReader(string(body)))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		resp.Header.Set("X-Rewritten", "1")
+		return nil
+	})))
+	front := httptest.NewServer(server.handler)
+	defer front.Close()
+
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+	resp, err := client.Get(target.URL)
+	if err != nil {
+		t.Fatalf("request through proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello world" || resp.Header.Get("X-Rewritten") != "1" {
+		t.Errorf("response = %q %v, want rewritten body and header", body, resp.Header)
+	}
+}
+
+func TestRequestMutatorError(t *testing.T) {
+	echo := newEchoServer(t)
+	server := NewProxyServer(nil, newDirectPool(t), WithRequestMutators(RequestMutatorFunc(func(*http.Request, ExchangeInfo) error {
+		return errors.New("refused")
+	})))
+	front := httptest.NewServer(server.handler)
+	defer front.Close()
+
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+	resp, err := client.Get(echo.URL)
+	if err != nil {
+		t.Fatalf("request through proxy: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get(ReasonHeader) != ReasonInternal {
+		t.Errorf("status = %d (%s), want 500 internal_error", resp.StatusCode, resp.Header.Get(ReasonHeader))
+	}
+}
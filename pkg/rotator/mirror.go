@@ -0,0 +1,240 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+	"golang.org/x/net/html"
+)
+
+// 請求鏡像的預設值
+const (
+	DefaultMirrorMaxBody = 1 << 20
+	// maxConcurrentMirrors 同時進行的鏡像比較上限，超出時跳過抽樣
+	maxConcurrentMirrors = 4
+)
+
+// errMirrorSkipped 響應不適合比較（如響應體超出上限）
+var errMirrorSkipped = errors.New("response not comparable")
+
+// mirror 請求鏡像：按比例將 GET 請求經由另一個代理再發送一次並比較響應；
+// 不一致時經由第三個代理仲裁，與其餘兩個都不一致的代理視為篡改內容並禁用
+type mirror struct {
+	rate    float64
+	maxBody int64
+	slots   chan struct{}
+}
+
+// newMirror 創建請求鏡像，rate <= 0 時返回 nil（不啟用）
+func newMirror(rate float64, maxBody int64) *mirror {
+	if rate <= 0 {
+		return nil
+	}
+	if maxBody <= 0 {
+		maxBody = DefaultMirrorMaxBody
+	}
+	return &mirror{rate: rate, maxBody: maxBody, slots: make(chan struct{}, maxConcurrentMirrors)}
+}
+
+// sample 是否鏡像此請求（只抽樣沒有請求體的 GET 請求），抽中時佔用一個比較槽位，完成後須調用 done
+func (m *mirror) sample(r *http.Request) bool {
+	if m == nil || r.Method != http.MethodGet || r.ContentLength > 0 || rand.Float64() >= m.rate {
+		return false
+	}
+	select {
+	case m.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// done 釋放比較槽位
+func (m *mirror) done() {
+	<-m.slots
+}
+
+// contentSignature 響應內容的比較依據：HTML 只比較外部腳本/iframe 地址和內聯腳本數（忽略動態文本），
+// 其他類型比較完整響應體
+type contentSignature struct {
+	status int
+	digest string
+}
+
+// signatureOf 計算響應內容簽名
+func signatureOf(status int, contentType string, body []byte) contentSignature {
+	sum := sha256.New()
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "text/html" {
+		sum.Write([]byte(strings.Join(htmlMarkers(body), "\n")))
+	} else {
+		sum.Write(body)
+	}
+	return contentSignature{status: status, digest: hex.EncodeToString(sum.Sum(nil))}
+}
+
+// htmlMarkers 提取 HTML 中常被注入的元素：script/iframe 的 src 及內聯腳本數（排序後返回）
+func htmlMarkers(body []byte) []string {
+	var markers []string
+	inline := 0
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := z.TagName()
+		tag := string(name)
+		if tag != "script" && tag != "iframe" {
+			continue
+		}
+		src := ""
+		for hasAttr {
+			var key, val []byte
+			key, val, hasAttr = z.TagAttr()
+			if string(key) == "src" {
+				src = strings.TrimSpace(string(val))
+			}
+		}
+		switch {
+		case src != "":
+			markers = append(markers, tag+" "+src)
+		case tag == "script":
+			inline++
+		}
+	}
+	slices.Sort(markers)
+	return append(markers, "inline scripts: "+strconv.Itoa(inline))
+}
+
+// signatureCapture 邊轉發邊記錄主請求的響應體（超出上限後停止記錄）
+type signatureCapture struct {
+	buf      bytes.Buffer
+	max      int64
+	overflow bool
+}
+
+func (c *signatureCapture) Write(b []byte) (int, error) {
+	if !c.overflow {
+		if int64(c.buf.Len()+len(b)) > c.max {
+			c.overflow = true
+			c.buf.Reset()
+		} else {
+			c.buf.Write(b)
+		}
+	}
+	return len(b), nil
+}
+
+// signature 返回記錄的響應內容簽名，響應體超出上限時返回 errMirrorSkipped
+func (c *signatureCapture) signature(resp *http.Response) (contentSignature, error) {
+	if c.overflow {
+		return contentSignature{}, errMirrorSkipped
+	}
+	return signatureOf(resp.StatusCode, resp.Header.Get("Content-Type"), c.buf.Bytes()), nil
+}
+
+// mirrorResult 鏡像請求的結果
+type mirrorResult struct {
+	proxy *pool.Proxy
+	sig   contentSignature
+	err   error
+}
+
+// startMirror 在轉發主請求響應的同時經由另一個代理（不包括 primary）發送鏡像請求
+func (h *ProxyHandler) startMirror(tmpl *http.Request, criteria requestCriteria, primary *pool.Proxy) <-chan mirrorResult {
+	ch := make(chan mirrorResult, 1)
+	go func() {
+		p, sig, err := h.fetchSignature(tmpl, criteria, map[string]bool{primary.Key(): true})
+		ch <- mirrorResult{proxy: p, sig: sig, err: err}
+	}()
+	return ch
+}
+
+// fetchSignature 經由 criteria 選擇的代理（不包括 exclude 中的代理）發送鏡像請求並計算響應簽名
+func (h *ProxyHandler) fetchSignature(tmpl *http.Request, criteria requestCriteria, exclude map[string]bool) (*pool.Proxy, contentSignature, error) {
+	c := criteria.Criteria
+	c.Exclude = exclude
+	p, err := h.pool.Select(c)
+	if err != nil {
+		return nil, contentSignature{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.boundedTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tmpl.URL.String(), nil)
+	if err != nil {
+		return p, contentSignature{}, err
+	}
+	req.Header = tmpl.Header.Clone()
+	resp, err := (&http.Client{Transport: h.createTransport(p)}).Do(req)
+	if err != nil {
+		return p, contentSignature{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, h.mirror.maxBody+1))
+	if err != nil {
+		return p, contentSignature{}, err
+	}
+	if int64(len(body)) > h.mirror.maxBody {
+		return p, contentSignature{}, errMirrorSkipped
+	}
+	return p, signatureOf(resp.StatusCode, resp.Header.Get("Content-Type"), body), nil
+}
+
+// checkMirror 比較主請求與鏡像請求的響應，不一致時經由第三個代理仲裁並禁用篡改內容的代理；
+// tmpl 為已處理過頭部的上遊請求
+func (h *ProxyHandler) checkMirror(tmpl *http.Request, criteria requestCriteria, primary *pool.Proxy, primarySig contentSignature, mirrored mirrorResult) {
+	log := serverLog.WithFields(logger.Fields{"url": tmpl.URL.String(), "proxy": primary.String()})
+	if mirrored.err != nil {
+		log.WithError(mirrored.err).Debug("Mirror request skipped")
+		return
+	}
+	mirrorProxy, mirrorSig := mirrored.proxy, mirrored.sig
+	if mirrorSig == primarySig {
+		return
+	}
+
+	// 兩個響應不一致，由第三個代理決定哪一個被篡改
+	exclude := map[string]bool{primary.Key(): true, mirrorProxy.Key(): true}
+	arbiter, arbiterSig, err := h.fetchSignature(tmpl, criteria, exclude)
+	if err != nil {
+		log.WithField("mirror", mirrorProxy.String()).WithError(err).Info("Mirrored responses differ, no arbiter available")
+		return
+	}
+	var tampering *pool.Proxy
+	switch arbiterSig {
+	case mirrorSig:
+		tampering = primary
+	case primarySig:
+		tampering = mirrorProxy
+	default:
+		log.WithFields(logger.Fields{"mirror": mirrorProxy.String(), "arbiter": arbiter.String()}).
+			Debug("Mirrored responses all differ, content is probably dynamic")
+		return
+	}
+	h.disableTampering(tampering, tmpl.URL.String())
+}
+
+// disableTampering 禁用篡改響應內容的代理；p 由並發請求共享，只修改數據庫中的記錄
+func (h *ProxyHandler) disableTampering(p *pool.Proxy, url string) {
+	serverLog.WithFields(logger.Fields{"proxy": p.String(), "url": url}).Warn("Proxy tampers with response content, disabling")
+	if _, err := h.pool.MarkTampering(p.Key()); err != nil {
+		serverLog.WithField("proxy", p.String()).WithError(err).Error("Failed to disable tampering proxy")
+	}
+	h.reportFailure(p)
+}
@@ -0,0 +1,151 @@
+package rotator
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+const injectedScript = `<script src="http://ads.example/inject.js"></script>`
+
+// newTestHTTPProxy 啟動只支持 CONNECT 的測試代理，隧道內的請求由代理轉發；tamper 為 true 時在響應體末尾注入腳本
+func newTestHTTPProxy(t *testing.T, tamper bool) *pool.Proxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				connect, err := http.ReadRequest(br)
+				if err != nil || connect.Method != http.MethodConnect {
+					return
+				}
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+				req, err := http.ReadRequest(br)
+				if err != nil {
+					return
+				}
+				req.RequestURI = ""
+				req.URL.Scheme = "http"
+				req.URL.Host = connect.Host
+				resp, err := http.DefaultTransport.RoundTrip(req)
+				if err != nil {
+					return
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if tamper {
+					body = append(body, injectedScript...)
+				}
+				resp.Body = io.NopCloser(bytes.NewReader(body))
+				resp.ContentLength = int64(len(body))
+				resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+				resp.Write(conn)
+			}()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	return &pool.Proxy{IP: host, Port: port, Protocol: "http", Updated: time.Now()}
+}
+
+func TestSignatureOf(t *testing.T) {
+	page := func(text string) []byte {
+		return []byte(`<html><head><script src="/app.js"></script><script>init()</script></head><body>` + text + `</body></html>`)
+	}
+	base := signatureOf(200, "text/html; charset=utf-8", page("Mon 10:00"))
+
+	if got := signatureOf(200, "text/html", page("Tue 11:30")); got != base {
+		t.Error("dynamic text should not change an HTML signature")
+	}
+	if got := signatureOf(200, "text/html", append(page("Mon 10:00"), injectedScript...)); got == base {
+		t.Error("injected script should change the signature")
+	}
+	if got := signatureOf(200, "text/html", page("<script>ads()</script>")); got == base {
+		t.Error("injected inline script should change the signature")
+	}
+	if got := signatureOf(502, "text/html", page("Mon 10:00")); got == base {
+		t.Error("status should be part of the signature")
+	}
+	if signatureOf(200, "application/json", []byte(`{"a":1}`)) == signatureOf(200, "application/json", []byte(`{"a":2}`)) {
+		t.Error("non-HTML bodies should be compared byte for byte")
+	}
+}
+
+func TestMirrorDisablesTamperingProxy(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<html><body>now: `+time.Now().String()+`</body></html>`)
+	}))
+	defer origin.Close()
+
+	honestA, honestB, tampering := newTestHTTPProxy(t, false), newTestHTTPProxy(t, false), newTestHTTPProxy(t, true)
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, p := range []*pool.Proxy{honestA, honestB, tampering} {
+		if err := db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte(p.Key()), p.DumpJSON())
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewProxyServer(nil, db, WithMirror(1, 0)).handler
+	tmpl := httptest.NewRequest(http.MethodGet, origin.URL, nil)
+	var criteria requestCriteria
+
+	// 主請求經由篡改內容的代理，鏡像和仲裁經由兩個正常代理
+	primary, sig, err := h.fetchSignature(tmpl, criteria, map[string]bool{honestA.Key(): true, honestB.Key(): true})
+	if err != nil || primary.Key() != tampering.Key() {
+		t.Fatalf("primary fetch: %v, %v", primary, err)
+	}
+	h.checkMirror(tmpl, criteria, primary, sig, <-h.startMirror(tmpl, criteria, primary))
+
+	disabled := map[string]bool{}
+	db.View(func(txn *badger.Txn) error {
+		for _, p := range []*pool.Proxy{honestA, honestB, tampering} {
+			item, err := txn.Get([]byte(p.Key()))
+			if err != nil {
+				return err
+			}
+			item.Value(func(v []byte) error {
+				stored, _ := pool.LoadFromJSON(v)
+				disabled[p.Key()] = stored.Disable
+				return nil
+			})
+		}
+		return nil
+	})
+	if !disabled[tampering.Key()] {
+		t.Error("tampering proxy should be disabled")
+	}
+	if disabled[honestA.Key()] || disabled[honestB.Key()] {
+		t.Errorf("honest proxies should stay enabled: %v", disabled)
+	}
+	if primary.Disable || primary.Tampering {
+		t.Error("the shared selected proxy should not be modified")
+	}
+}
@@ -0,0 +1,329 @@
+package rotator
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MITM 證書與連接參數
+const (
+	caValidity      = 10 * 365 * 24 * time.Hour
+	leafValidity    = 365 * 24 * time.Hour
+	maxLeafCerts    = 1024 // 緩存的站點證書上限，超出時清空重建
+	mitmHandshake   = 10 * time.Second
+	mitmIdleTimeout = 90 * time.Second
+)
+
+// CertAuthority MITM 模式使用的本地 CA：按目標主機名簽發站點證書（帶緩存，可並發使用）
+type CertAuthority struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+	leafKey *ecdsa.PrivateKey // 所有站點證書共用的密鑰，省去每個主機生成密鑰的開銷
+
+	mu     sync.Mutex
+	leaves map[string]*tls.Certificate
+}
+
+// NewCertAuthority 在內存中生成新的 CA
+func NewCertAuthority() (*CertAuthority, error) {
+	certPEM, keyPEM, err := generateCA()
+	if err != nil {
+		return nil, err
+	}
+	return parseCA(certPEM, keyPEM)
+}
+
+// LoadOrCreateCA 從 PEM 文件加載 CA，文件不存在時生成新的 CA 並寫入（私鑰文件權限為 0600）；
+// created 表示本次新生成了 CA，需要將 certFile 導入客戶端的信任列表
+func LoadOrCreateCA(certFile, keyFile string) (ca *CertAuthority, created bool, err error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err == nil {
+		keyPEM, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, false, fmt.Errorf("read CA key: %w", err)
+		}
+		ca, err := parseCA(certPEM, keyPEM)
+		return ca, false, err
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, fmt.Errorf("read CA certificate: %w", err)
+	}
+
+	certPEM, keyPEM, err := generateCA()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, f := range []struct {
+		path string
+		data []byte
+		perm os.FileMode
+	}{
+		{keyFile, keyPEM, 0o600},
+		{certFile, certPEM, 0o644},
+	} {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+			return nil, false, err
+		}
+		if err := os.WriteFile(f.path, f.data, f.perm); err != nil {
+			return nil, false, fmt.Errorf("write %s: %w", f.path, err)
+		}
+	}
+	ca, err = parseCA(certPEM, keyPEM)
+	return ca, true, err
+}
+
+// generateCA 生成 ECDSA P-256 自簽名 CA，返回 PEM 編碼的證書和私鑰
+func generateCA() (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "dynamic-proxy MITM CA", Organization: []string{"dynamic-proxy"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// parseCA 解析 PEM 編碼的 CA 證書和私鑰
+func parseCA(certPEM, keyPEM []byte) (*CertAuthority, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse CA: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse CA: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, errors.New("parse CA: certificate is not a CA")
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("parse CA: unsupported private key type")
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &CertAuthority{
+		cert:    cert,
+		certPEM: certPEM,
+		key:     key,
+		leafKey: leafKey,
+		leaves:  make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// Certificate 返回 CA 證書（如用於構建信任該 CA 的 x509.CertPool）
+func (ca *CertAuthority) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// CertPEM 返回 PEM 編碼的 CA 證書，用於導入客戶端的信任列表
+func (ca *CertAuthority) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// certFor 返回 host（域名或 IP）的站點證書，不存在時簽發
+func (ca *CertAuthority) certFor(host string) (*tls.Certificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if cert, ok := ca.leaves[host]; ok && time.Now().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(leafValidity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &ca.leafKey.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("sign certificate for %s: %w", host, err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  ca.leafKey,
+		Leaf:        leaf,
+	}
+	if len(ca.leaves) >= maxLeafCerts {
+		clear(ca.leaves)
+	}
+	ca.leaves[host] = cert
+	return cert, nil
+}
+
+// randomSerial 生成 128 位隨機證書序列號
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// handleMITM 以 MITM 模式處理 CONNECT：接管客戶端連接，用 CA 簽發的證書完成 TLS 握手，
+// 隧道內的每個請求改寫為 https:// 絕對地址後按普通請求轉發（每個請求各自選擇上遊代理）
+func (h *ProxyHandler) handleMITM(w http.ResponseWriter, r *http.Request, criteria requestCriteria) {
+	log := requestLogger(r).WithField("url", r.URL.Host)
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeProxyError(w, r, http.StatusInternalServerError, ReasonInternal, errors.New("Hijacking not supported"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	clientConn, _, err := hijacker.Hijack()
+	if err != nil {
+		log.WithError(err).Error("Failed to hijack client connection")
+		return
+	}
+
+	host, port, err := net.SplitHostPort(r.URL.Host)
+	if err != nil {
+		host, port = r.URL.Host, "443"
+	}
+	authority := host
+	if port != "443" {
+		authority = net.JoinHostPort(host, port)
+	}
+
+	tlsConn := tls.Server(clientConn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			// 未發送 SNI（如按 IP 訪問）時按 CONNECT 目標簽發
+			if hello.ServerName != "" {
+				return h.mitm.certFor(hello.ServerName)
+			}
+			return h.mitm.certFor(host)
+		},
+		NextProtos: []string{"http/1.1"},
+	})
+	ctx, cancel := context.WithTimeout(r.Context(), mitmHandshake)
+	err = tlsConn.HandshakeContext(ctx)
+	cancel()
+	if err != nil {
+		log.WithError(err).Warn("MITM TLS handshake failed (does the client trust the CA?)")
+		clientConn.Close()
+		return
+	}
+
+	// 在解密後的連接上運行 HTTP 服務，連接關閉或被接管（協議升級）時結束
+	ln := newConnListener(tlsConn)
+	idle := mitmIdleTimeout
+	if h.timeouts.IdleTunnel > 0 {
+		idle = h.timeouts.IdleTunnel
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req.URL.Scheme = "https"
+			req.URL.Host = authority
+			req.RequestURI = ""
+			h.serve(w, req, &criteria)
+		}),
+		// 隧道內的請求沿用 CONNECT 請求的追蹤上下文
+		BaseContext:       func(net.Listener) context.Context { return context.WithoutCancel(r.Context()) },
+		IdleTimeout:       idle,
+		ReadHeaderTimeout: h.boundedTimeout(),
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				ln.Close()
+			}
+		},
+	}
+	// 空閒由 IdleTimeout 控制（轉發響應期間客戶端連接上可能長時間沒有數據），這裡只限制最長存續時間
+	tunnel := h.openTunnel(0, func() {
+		ln.Close()
+		tlsConn.Close()
+	})
+	_ = srv.Serve(ln)
+	if reason := tunnel.close(); reason != "" {
+		log.Debugf("MITM tunnel closed by %s limit", reason)
+	}
+	log.Debug("MITM tunnel closed")
+}
+
+// connListener 只返回一個連接的 net.Listener，關閉後 Accept 返回 net.ErrClosed
+type connListener struct {
+	conn      net.Conn
+	accepted  sync.Once
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	return &connListener{conn: conn, done: make(chan struct{})}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.accepted.Do(func() { conn = l.conn })
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
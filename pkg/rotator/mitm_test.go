@@ -0,0 +1,93 @@
+package rotator
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+
+	ca, created, err := LoadOrCreateCA(certFile, keyFile)
+	if err != nil || !created {
+		t.Fatalf("first load: created = %v, err = %v", created, err)
+	}
+	again, created, err := LoadOrCreateCA(certFile, keyFile)
+	if err != nil || created {
+		t.Fatalf("second load: created = %v, err = %v", created, err)
+	}
+	if !bytes.Equal(ca.CertPEM(), again.CertPEM()) {
+		t.Error("existing CA should be reused")
+	}
+
+	leaf, err := again.certFor("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+	if _, err := leaf.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots}); err != nil {
+		t.Errorf("leaf should chain to the CA: %v", err)
+	}
+	if cached, _ := again.certFor("example.com"); cached != leaf {
+		t.Error("leaf certificate should be cached per host")
+	}
+}
+
+func TestMITM(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(r.Header)
+	}))
+	defer origin.Close()
+
+	ca, err := NewCertAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw, err := NewHeaderRewriter([]HeaderRule{
+		{Direction: HeaderDirectionRequest, Action: HeaderActionSet, Name: "X-Injected", Value: "yes"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewProxyServer(nil, newDirectPool(t), WithMITM(ca), WithHeaderRewriter(rw))
+	server.handler.upstreamTLS = origin.Client().Transport.(*http.Transport).TLSClientConfig
+	server.handler.transports = nil
+	front := httptest.NewServer(server.handler)
+	defer front.Close()
+
+	frontURL, _ := url.Parse(front.URL)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(frontURL),
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+
+	for range 2 {
+		resp, err := client.Get(origin.URL + "/path")
+		if err != nil {
+			t.Fatalf("request through MITM proxy: %v", err)
+		}
+		var got http.Header
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issuer := resp.TLS.PeerCertificates[0].Issuer.CommonName; issuer != ca.Certificate().Subject.CommonName {
+			t.Errorf("certificate issued by %q, want the MITM CA", issuer)
+		}
+		if got.Get("X-Injected") != "yes" {
+			t.Errorf("header rules should apply to decrypted requests, got %v", got)
+		}
+	}
+}
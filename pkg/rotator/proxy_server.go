@@ -0,0 +1,924 @@
+package rotator
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+	"github.com/e2u/dynamic-proxy/pkg/retry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ProxyHandler struct {
+	// timeout 請求總時限（0 表示不限制），timeouts 各階段的時限
+	timeout       time.Duration
+	timeouts      Timeouts
+	BDB           *badger.DB
+	rotator       *intervalRotator
+	domainLimiter *domainLimiter
+	// retry 上遊重試與對沖策略（換代理重試）
+	retry retry.Policy
+	// headerRewriter 按配置規則改寫請求/響應頭部
+	headerRewriter *HeaderRewriter
+	// pool 代理池（選擇、撥號及使用統計）
+	pool *pool.Pool
+	// 請求體重放緩衝：內存上限、落盤上限及臨時目錄
+	bodyBufferBytes int64
+	bodySpoolBytes  int64
+	bodySpoolDir    string
+	// clients 按客戶端統計請求數、流量和錯誤
+	clients *clientTracker
+	// requests 最近完成的請求
+	requests *requestLog
+	// diversity 出口網段多樣性約束（nil 表示不啟用）
+	diversity *diversityTracker
+	// hygiene 嚴格出站清理（nil 表示不啟用）
+	hygiene *outboundHygiene
+	// forwardedFor X-Forwarded-For 處理方式（append, replace, omit）
+	forwardedFor string
+	// anonymizer 匿名模式（nil 表示不啟用）
+	anonymizer *anonymizer
+	// version 響應頭中報告的版本（空表示不添加）
+	version string
+	// requestIDHeader 是否在響應中添加 RequestIDHeader 頭
+	requestIDHeader bool
+	// transports 按上遊代理緩存的 Transport（nil 表示每個請求新建連接）
+	transports *pool.TransportCache
+	// mitm 解密 CONNECT 隧道用的 CA（nil 表示原樣轉發隧道）
+	mitm *CertAuthority
+	// upstreamTLS 訪問 HTTPS 目標時的 TLS 配置（nil 表示使用系統根證書）
+	upstreamTLS *tls.Config
+	// mirror 請求鏡像與篡改檢測（nil 表示不啟用）
+	mirror *mirror
+	// resolve 目標主機名解析方式（pool.ResolveRemote 或 pool.ResolveLocal）
+	resolve string
+	// clientAllow 允許使用代理的客戶端地址（nil 表示不限制）
+	clientAllow *clientAllowlist
+	// targetACL 目標主機訪問控制（nil 表示不限制）
+	targetACL *targetACL
+	// defaultTags 請求未指定 TagHeader 時代理必須帶有的標籤
+	defaultTags []string
+	// baseCriteria 所有請求都必須滿足的篩選條件（命名代理池），請求頭只能進一步收窄
+	baseCriteria pool.Criteria
+	// domains 按（代理，目標域名）記錄的近期結果（nil 表示不啟用）
+	domains *domainMemory
+	// bans 目標封禁響應識別（nil 表示不啟用）
+	bans *BanDetector
+	// requestMutators、responseMutators 按順序應用的請求與響應修改器
+	requestMutators  []RequestMutator
+	responseMutators []ResponseMutator
+	// limits 客戶端連接數與隧道數上限（Reload 時沿用）
+	limits *connLimits
+	// bandwidth 轉發限速（Reload 時沿用）
+	bandwidth *bandwidthLimiter
+}
+
+type ProxyServer struct {
+	HttpServer *http.Server
+	// handler 當前的請求處理器，Reload 時整體替換（mu 保護）
+	mu             sync.RWMutex
+	handler        *ProxyHandler
+	Timeout        time.Duration
+	ListenAddr     string
+	RotateInterval time.Duration
+	// DomainConcurrency 每個目標域名同時進行中的請求上限（0 表示不限制）
+	DomainConcurrency int
+	// ResponseSLO 上遊響應頭到達時限（0 表示不啟用），SLORetries 超時後換代理重試的次數
+	ResponseSLO time.Duration
+	SLORetries  int
+	BDB         *badger.DB
+	// TLSConfig 非 nil 時以 TLS 提供代理端點（HTTPS 代理），修改後需要重啟
+	TLSConfig *tls.Config
+}
+
+type Options struct {
+	// Timeout 請求總時限（0 表示不限制），Timeouts 為連接、握手、響應頭及隧道空閒各階段的時限
+	Timeout           time.Duration
+	Timeouts          Timeouts
+	ListenAddr        string
+	RotateInterval    time.Duration
+	DomainConcurrency int
+	ResponseSLO       time.Duration
+	SLORetries        int
+	HeaderRewriter    *HeaderRewriter
+	Strategy          string
+	BodyBufferBytes   int64
+	BodySpoolBytes    int64
+	BodySpoolDir      string
+	// ClientStatsLogInterval 定期輸出客戶端使用排行的間隔（0 表示不輸出）
+	ClientStatsLogInterval time.Duration
+	// 出口多樣性：最近 DiversityWindow 次選擇至少使用 DiversityMinNetworks 個不同 /16 網段
+	DiversityWindow      int
+	DiversityMinNetworks int
+	DiversityScope       string
+	// StrictHygiene 刪除發往目標的請求中可識別本代理的頭部，HygieneAllowHeaders 為允許保留的 X- 頭部
+	StrictHygiene       bool
+	HygieneAllowHeaders []string
+	// ForwardedFor X-Forwarded-For 處理方式：append（預設）、replace 或 omit，嚴格模式下總是不發送
+	ForwardedFor string
+	// Anonymous 匿名模式：刪除可識別客戶端的頭部，以及名稱匹配 AnonymousStripHeaders、AnonymousStripCookies 通配符的頭部和 Cookie
+	Anonymous             bool
+	AnonymousStripHeaders []string
+	AnonymousStripCookies []string
+	// Version 非空時在返回給客戶端的響應中添加 VersionHeader 頭
+	Version string
+	// RequestIDHeader 為 true 時在返回給客戶端的響應中添加 RequestIDHeader 頭（請求 ID 總是記錄在日誌和錯誤響應體中）
+	RequestIDHeader bool
+	// Retry 上遊重試策略（MaxAttempts 為 0 時由 ResponseSLO 和 SLORetries 推導）
+	Retry retry.Policy
+	// TransportCacheSize 按上遊代理緩存的 Transport 數（0 表示不緩存，每個請求新建連接），
+	// UpstreamIdleTimeout 為緩存連接的空閒超時
+	TransportCacheSize  int
+	UpstreamIdleTimeout time.Duration
+	// TargetACL 啟用目標主機訪問控制：TargetDeny 優先，TargetAllow 非空時只允許匹配的目標，
+	// AllowPrivateTargets 為 false 時拒絕私有、環回、鏈路本地等地址
+	TargetACL           bool
+	TargetAllow         []string
+	TargetDeny          []string
+	AllowPrivateTargets bool
+	// Tags 請求未指定 TagHeader 時代理必須帶有的標籤（如 paid）
+	Tags []string
+	// Criteria 所有請求都必須滿足的篩選條件（站點、標籤、國家、匿名級別、協議），用於按質量分層的命名代理池
+	Criteria pool.Criteria
+	// DNSResolution 目標主機名解析方式：pool.ResolveRemote（預設，交給上遊代理解析，避免 DNS 洩漏）或 pool.ResolveLocal
+	DNSResolution string
+	// MirrorRate 經由另一個代理鏡像 GET 請求以檢測篡改內容的比例（0 表示不啟用），MirrorMaxBody 為參與比較的響應體上限
+	MirrorRate    float64
+	MirrorMaxBody int64
+	// MITM 非 nil 時用此 CA 簽發的證書解密 CONNECT 隧道，隧道內的請求按普通請求處理
+	MITM *CertAuthority
+	// DomainMemoryTTL 非零時按（代理，目標域名）記錄近期結果：連續失敗 DomainFailures 次的代理在 DomainMemoryTTL 內
+	// 視為被該域名封禁，訪問該域名的請求不選擇它
+	DomainMemoryTTL time.Duration
+	DomainFailures  int
+	// BanDetector 非 nil 時識別目標的封禁響應（狀態碼或響應體），把代理標記為被該域名封禁並可換代理重試
+	BanDetector *BanDetector
+	// RequestMutators、ResponseMutators 按順序應用的請求與響應修改器
+	RequestMutators  []RequestMutator
+	ResponseMutators []ResponseMutator
+	// MaxConnections 同時打開的客戶端連接數上限，MaxTunnels 同時打開的 CONNECT 隧道及協議升級連接數上限（0 表示不限制），
+	// 超過上限的連接或隧道返回 503
+	MaxConnections int
+	MaxTunnels     int
+	// BandwidthLimit 所有客戶端合計的轉發速率上限，ClientBandwidthLimit 每個客戶端的轉發速率上限（每秒字節數，0 表示不限制）
+	BandwidthLimit       int64
+	ClientBandwidthLimit int64
+	// ClientAllow 允許使用代理的客戶端地址（IP 或 CIDR，空表示不限制），其他客戶端的請求返回 403
+	ClientAllow []string
+	// TLS 非 nil 時以 TLS 提供代理端點（客戶端以 https:// 代理地址連接），避免客戶端發送的憑據在本地網絡中明文傳輸
+	TLS *tls.Config
+}
+
+type Option func(options *Options)
+
+// WithTimeout 設置請求總時限（包括讀取響應體，0 表示不限制，用於大文件下載等長時間傳輸）
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.Timeout = timeout
+	}
+}
+
+// WithTimeouts 設置連接、TLS 握手、響應頭及隧道空閒各階段的時限
+func WithTimeouts(t Timeouts) Option {
+	return func(options *Options) {
+		options.Timeouts = t
+	}
+}
+
+func WithAddr(addr string) Option {
+	return func(options *Options) {
+		options.ListenAddr = addr
+	}
+}
+
+// WithRotateInterval 設置出口輪換間隔（0 表示每個請求都更換上遊代理）
+func WithRotateInterval(interval time.Duration) Option {
+	return func(options *Options) {
+		options.RotateInterval = interval
+	}
+}
+
+// WithDomainConcurrency 設置每個目標域名的最大並發請求數（0 表示不限制）
+func WithDomainConcurrency(n int) Option {
+	return func(options *Options) {
+		options.DomainConcurrency = n
+	}
+}
+
+// WithResponseSLO 設置上遊響應頭 SLO 及超時後換代理重試的次數（WithRetryPolicy 的簡寫）
+func WithResponseSLO(slo time.Duration, retries int) Option {
+	return func(options *Options) {
+		options.ResponseSLO = slo
+		options.SLORetries = retries
+	}
+}
+
+// WithRetryPolicy 設置上遊重試策略：失敗或返回 RetryStatus 狀態碼時換代理重試，
+// HedgeDelay 非零時上遊在該時間內未響應即並行經由另一個代理發出同一請求，採用先到的響應
+func WithRetryPolicy(p retry.Policy) Option {
+	return func(options *Options) {
+		options.Retry = p
+	}
+}
+
+// WithHeaderRewriter 設置頭部改寫規則
+func WithHeaderRewriter(rw *HeaderRewriter) Option {
+	return func(options *Options) {
+		options.HeaderRewriter = rw
+	}
+}
+
+// WithSelectionStrategy 設置代理選擇策略（random, throughput, score）
+func WithSelectionStrategy(strategy string) Option {
+	return func(options *Options) {
+		options.Strategy = strategy
+	}
+}
+
+// WithBodyBuffer 設置重試用的請求體緩衝：內存上限、落盤上限（0 表示不落盤）及臨時目錄
+func WithBodyBuffer(memBytes, spoolBytes int64, spoolDir string) Option {
+	return func(options *Options) {
+		options.BodyBufferBytes = memBytes
+		options.BodySpoolBytes = spoolBytes
+		options.BodySpoolDir = spoolDir
+	}
+}
+
+// WithClientStatsLogInterval 設置定期輸出客戶端使用排行的間隔
+func WithClientStatsLogInterval(interval time.Duration) Option {
+	return func(options *Options) {
+		options.ClientStatsLogInterval = interval
+	}
+}
+
+// WithDiversity 設置出口多樣性約束：最近 window 次選擇至少使用 minNetworks 個不同 /16 網段
+// scope 為 global（所有客戶端共用）或 client（按客戶端計算）
+func WithDiversity(window, minNetworks int, scope string) Option {
+	return func(options *Options) {
+		options.DiversityWindow = window
+		options.DiversityMinNetworks = minNetworks
+		options.DiversityScope = scope
+	}
+}
+
+// WithStrictHygiene 啟用嚴格出站清理：刪除 Via、Forwarded 及所有 X- 頭部（allow 中的除外），並不再添加 X-Forwarded-For
+func WithStrictHygiene(strict bool, allow []string) Option {
+	return func(options *Options) {
+		options.StrictHygiene = strict
+		options.HygieneAllowHeaders = allow
+	}
+}
+
+// WithForwardedFor 設置 X-Forwarded-For 處理方式：ForwardedForAppend、ForwardedForReplace 或 ForwardedForOmit
+func WithForwardedFor(mode string) Option {
+	return func(options *Options) {
+		options.ForwardedFor = mode
+	}
+}
+
+// WithAnonymity 啟用匿名模式：刪除 X-Forwarded-For、Via、Forwarded 等可識別客戶端的頭部，
+// 以及名稱匹配 headers（不區分大小寫）的頭部和匹配 cookies 的 Cookie（通配符為 path.Match 語法）
+func WithAnonymity(enabled bool, headers, cookies []string) Option {
+	return func(options *Options) {
+		options.Anonymous = enabled
+		options.AnonymousStripHeaders = headers
+		options.AnonymousStripCookies = cookies
+	}
+}
+
+// WithRequestIDHeader 在返回給客戶端的響應中添加 RequestIDHeader 頭，值為該請求在日誌中的 request_id
+func WithRequestIDHeader(enabled bool) Option {
+	return func(options *Options) {
+		options.RequestIDHeader = enabled
+	}
+}
+
+// WithVersionHeader 在返回給客戶端的響應中添加 VersionHeader 頭（空字符串表示不添加）
+func WithVersionHeader(version string) Option {
+	return func(options *Options) {
+		options.Version = version
+	}
+}
+
+// WithTargetACL 啟用目標主機訪問控制：規則為精確主機名、域名後綴（.example.com 或 *.example.com）或 IP/CIDR；
+// 拒絕列表優先，允許列表非空時只允許匹配的目標，allowPrivate 為 false 時拒絕私有、環回、鏈路本地等地址（防止 SSRF）
+func WithTargetACL(allow, deny []string, allowPrivate bool) Option {
+	return func(options *Options) {
+		options.TargetACL = true
+		options.TargetAllow = allow
+		options.TargetDeny = deny
+		options.AllowPrivateTargets = allowPrivate
+	}
+}
+
+// WithTags 設置預設標籤：請求未通過 TagHeader 指定標籤時，只選擇帶有所有這些標籤的代理
+func WithTags(tags ...string) Option {
+	return func(options *Options) {
+		options.Tags = tags
+	}
+}
+
+// WithCriteria 設置所有請求都必須滿足的篩選條件，請求頭中的站點和標籤在此基礎上疊加
+func WithCriteria(c pool.Criteria) Option {
+	return func(options *Options) {
+		options.Criteria = c
+	}
+}
+
+// WithDNSResolution 設置目標主機名解析方式：pool.ResolveRemote 或 pool.ResolveLocal
+func WithDNSResolution(mode string) Option {
+	return func(options *Options) {
+		options.DNSResolution = mode
+	}
+}
+
+// WithTransportCache 設置按上遊代理緩存的 Transport 數（0 表示不復用連接）及空閒連接超時
+func WithTransportCache(size int, idleTimeout time.Duration) Option {
+	return func(options *Options) {
+		options.TransportCacheSize = size
+		options.UpstreamIdleTimeout = idleTimeout
+	}
+}
+
+// WithMirror 按 rate（0~1）的比例將 GET 請求經由另一個代理再發送一次並比較響應，
+// 不一致時經由第三個代理仲裁，篡改內容（如注入廣告腳本）的代理被禁用；響應體超過 maxBody 的請求不比較
+func WithMirror(rate float64, maxBody int64) Option {
+	return func(options *Options) {
+		options.MirrorRate = rate
+		options.MirrorMaxBody = maxBody
+	}
+}
+
+// WithMITM 啟用 MITM 模式：用 ca 簽發的證書終止客戶端 CONNECT 隧道內的 TLS，
+// 解密後的請求同普通請求一樣經過頭部改寫、匿名處理、重試和日誌（客戶端需信任該 CA）
+func WithMITM(ca *CertAuthority) Option {
+	return func(options *Options) {
+		options.MITM = ca
+	}
+}
+
+// WithDomainMemory 按（代理，目標域名）記錄近期成功與失敗：連續失敗 failures 次的代理在 ttl 內視為被該域名封禁，
+// 訪問該域名的請求選擇代理時避開它，ttl 後自動解除（ttl 為 0 表示不啟用）
+func WithDomainMemory(ttl time.Duration, failures int) Option {
+	return func(options *Options) {
+		options.DomainMemoryTTL = ttl
+		options.DomainFailures = failures
+	}
+}
+
+// WithBanDetector 識別目標返回的封禁響應（如 403、429 或驗證碼頁面）：觸發的代理標記為被該域名封禁（需啟用 WithDomainMemory），
+// BanRules.Retries 大於 0 時經由另一個代理透明重試（請求體無法重放時不重試）
+func WithBanDetector(d *BanDetector) Option {
+	return func(options *Options) {
+		options.BanDetector = d
+	}
+}
+
+// WithRequestMutators 追加請求修改器：每次上遊嘗試在頭部清理和改寫規則之後按順序調用
+func WithRequestMutators(m ...RequestMutator) Option {
+	return func(options *Options) {
+		options.RequestMutators = append(options.RequestMutators, m...)
+	}
+}
+
+// WithResponseMutators 追加響應修改器：普通請求的上遊響應轉發給客戶端前在響應頭改寫規則之後按順序調用；
+// 設置了響應修改器時不進行請求鏡像（轉發的響應體已不是上遊原樣返回的內容）
+func WithResponseMutators(m ...ResponseMutator) Option {
+	return func(options *Options) {
+		options.ResponseMutators = append(options.ResponseMutators, m...)
+	}
+}
+
+// WithConnectionLimits 限制同時打開的客戶端連接數和隧道數（CONNECT 隧道及協議升級連接，0 表示不限制）：
+// 超過連接數上限的新連接收到 503 後被關閉，超過隧道數上限的 CONNECT 或升級請求返回 503，避免耗盡文件描述符
+func WithConnectionLimits(maxConnections, maxTunnels int) Option {
+	return func(options *Options) {
+		options.MaxConnections = maxConnections
+		options.MaxTunnels = maxTunnels
+	}
+}
+
+// WithBandwidthLimits 限制轉發速率（每秒字節數，0 表示不限制）：global 為所有客戶端合計，perClient 為每個客戶端；
+// 作用於響應體、CONNECT 隧道及升級連接的雙向流量，避免佔滿本機上行帶寬
+func WithBandwidthLimits(global, perClient int64) Option {
+	return func(options *Options) {
+		options.BandwidthLimit = global
+		options.ClientBandwidthLimit = perClient
+	}
+}
+
+// WithClientAllowlist 只允許來自指定地址（IP 或 CIDR，如 10.0.0.0/8）的客戶端使用代理，
+// 其他客戶端的請求在轉發之前返回 403，適合在可信網絡中代替代理認證
+func WithClientAllowlist(rules ...string) Option {
+	return func(options *Options) {
+		options.ClientAllow = append(options.ClientAllow, rules...)
+	}
+}
+
+// WithTLS 以 TLS 提供代理端點（HTTPS 代理），cfg 應只協商 HTTP/1.1（CONNECT 與協議升級需要接管連接）
+func WithTLS(cfg *tls.Config) Option {
+	return func(options *Options) {
+		options.TLS = cfg
+	}
+}
+
+func NewProxyServer(proxies []*pool.Proxy, bdb *badger.DB, opts ...Option) *ProxyServer {
+	cfg := newOptions(opts...)
+	handler := newProxyHandler(bdb, cfg)
+	httpServer := &http.Server{Addr: cfg.ListenAddr}
+	server := &ProxyServer{
+		handler:           handler,
+		ListenAddr:        cfg.ListenAddr,
+		Timeout:           cfg.Timeout,
+		RotateInterval:    cfg.RotateInterval,
+		DomainConcurrency: cfg.DomainConcurrency,
+		ResponseSLO:       cfg.ResponseSLO,
+		SLORetries:        cfg.SLORetries,
+		HttpServer:        httpServer,
+		BDB:               bdb,
+		TLSConfig:         cfg.TLS,
+	}
+	httpServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.currentHandler().ServeHTTP(w, r)
+	})
+	server.startClientStatsLogger(cfg.ClientStatsLogInterval)
+	return server
+}
+
+// newOptions 應用選項並補齊預設值
+func newOptions(opts ...Option) *Options {
+	cfg := &Options{
+		Timeout:         DefaultTimeout,
+		ListenAddr:      ":8080",
+		Strategy:        pool.StrategyRandom,
+		BodyBufferBytes: DefaultBodyBufferBytes,
+		ForwardedFor:    ForwardedForAppend,
+		DomainFailures:  DefaultDomainFailures,
+		DNSResolution:   pool.ResolveRemote,
+
+		TransportCacheSize:  pool.DefaultTransportCacheSize,
+		UpstreamIdleTimeout: pool.DefaultUpstreamIdleTimeout,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.Retry.MaxAttempts == 0 {
+		cfg.Retry = sloPolicy(cfg.ResponseSLO, cfg.SLORetries)
+	}
+	return cfg
+}
+
+// newProxyHandler 按選項創建請求處理器（代理服務器與 Transport 共用）
+func newProxyHandler(bdb *badger.DB, cfg *Options) *ProxyHandler {
+	h := &ProxyHandler{
+		timeout:         cfg.Timeout,
+		timeouts:        cfg.Timeouts,
+		BDB:             bdb,
+		rotator:         newIntervalRotator(cfg.RotateInterval),
+		domainLimiter:   newDomainLimiter(cfg.DomainConcurrency),
+		retry:           cfg.Retry,
+		headerRewriter:  cfg.HeaderRewriter,
+		pool:            pool.New(bdb, pool.WithStrategy(cfg.Strategy)),
+		bodyBufferBytes: cfg.BodyBufferBytes,
+		bodySpoolBytes:  cfg.BodySpoolBytes,
+		bodySpoolDir:    cfg.BodySpoolDir,
+		clients:         newClientTracker(),
+		requests:        newRequestLog(DefaultRequestLogSize),
+		diversity:       newDiversityTracker(cfg.DiversityWindow, cfg.DiversityMinNetworks, cfg.DiversityScope),
+		hygiene:         newOutboundHygiene(cfg.StrictHygiene, cfg.HygieneAllowHeaders),
+		forwardedFor:    cfg.ForwardedFor,
+		anonymizer:      newAnonymizer(cfg.Anonymous, cfg.AnonymousStripHeaders, cfg.AnonymousStripCookies),
+		version:         cfg.Version,
+		requestIDHeader: cfg.RequestIDHeader,
+		mitm:            cfg.MITM,
+		mirror:          newMirror(cfg.MirrorRate, cfg.MirrorMaxBody),
+		resolve:         cfg.DNSResolution,
+		defaultTags:     pool.NormalizeTags(cfg.Tags),
+		baseCriteria:    cfg.Criteria,
+		clientAllow:     newClientAllowlist(cfg.ClientAllow),
+		targetACL:       newTargetACL(cfg.TargetACL, cfg.TargetAllow, cfg.TargetDeny, cfg.AllowPrivateTargets),
+		domains:         newDomainMemory(cfg.DomainMemoryTTL, cfg.DomainFailures),
+		bans:            cfg.BanDetector,
+
+		requestMutators:  cfg.RequestMutators,
+		responseMutators: cfg.ResponseMutators,
+		limits:           newConnLimits(cfg.MaxConnections, cfg.MaxTunnels),
+		bandwidth:        newBandwidthLimiter(cfg.BandwidthLimit, cfg.ClientBandwidthLimit),
+	}
+	if cfg.TransportCacheSize > 0 {
+		h.transports = pool.NewTransportCache(cfg.TransportCacheSize, cfg.UpstreamIdleTimeout, h.transportOptions())
+	}
+	return h
+}
+
+func (p *ProxyServer) Start() error {
+	if p.TLSConfig != nil {
+		serverLog.Infof("Starting proxy server on %s (TLS)", p.ListenAddr)
+	} else {
+		serverLog.Infof("Starting proxy server on %s", p.ListenAddr)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		if err := p.listenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- fmt.Errorf("failed to start proxy server: %w", err)
+		}
+	}()
+	if err := waitForServer(p.ListenAddr, 5*time.Second); err != nil {
+		if shutdownErr := p.HttpServer.Shutdown(context.Background()); shutdownErr != nil {
+			serverLog.Errorf("Shutdown during startup failure: %v", shutdownErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// listenAndServe 監聽 ListenAddr 並提供服務
+func (p *ProxyServer) listenAndServe() error {
+	ln, err := net.Listen("tcp", p.ListenAddr)
+	if err != nil {
+		return err
+	}
+	return p.serve(ln)
+}
+
+// serve 在監聽器上提供服務：配置了 TLS 時先完成 TLS 握手，再限制連接數（超過上限的連接也能收到加密的 503 響應）
+func (p *ProxyServer) serve(ln net.Listener) error {
+	if p.TLSConfig != nil {
+		ln = tls.NewListener(ln, p.TLSConfig)
+	}
+	return p.HttpServer.Serve(p.currentHandler().limits.listener(ln))
+}
+
+func waitForServer(listenAddr string, timeout time.Duration) error {
+	checkAddr := strings.Replace(listenAddr, "0.0.0.0", "127.0.0.1", 1)
+
+	start := time.Now()
+	for time.Since(start) < timeout {
+		conn, err := net.DialTimeout("tcp", checkAddr, 100*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("server failed to start listening on %s within %v", checkAddr, timeout)
+}
+
+func (p *ProxyServer) Stop() error {
+	serverLog.Info("Stopping proxy server")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	if err := p.HttpServer.Shutdown(ctx); err != nil {
+		serverLog.Errorf("Shutdown error: %v", err)
+	}
+	cancel()
+	if h := p.currentHandler(); h.transports != nil {
+		h.transports.CloseIdleConnections()
+	}
+	serverLog.Info("Proxy server shut down")
+	return nil
+}
+
+func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, nil)
+}
+
+// serve 處理一個代理請求；inherited 非 nil 時為 MITM 隧道內解密的請求，未指定篩選條件時沿用 CONNECT 請求的條件
+func (h *ProxyHandler) serve(w http.ResponseWriter, r *http.Request, inherited *requestCriteria) {
+	// 每個請求分配一個 ID，記錄在日誌、追蹤和錯誤響應中
+	r = withRequestID(r)
+	r, span := startRequestSpan(r)
+	tw := &trackingWriter{ResponseWriter: w}
+	w = tw
+	defer endRequestSpan(span, tw)
+	if h.requestIDHeader {
+		w.Header().Set(RequestIDHeader, requestID(r))
+	}
+
+	// 不在允許列表內的客戶端不做任何處理（不計入客戶端統計）
+	if err := h.clientAllow.check(r); err != nil {
+		requestLogger(r).WithField("url", r.URL.String()).WithError(err).Warn("Client denied")
+		writeProxyError(w, r, http.StatusForbidden, ReasonClientDenied, err)
+		return
+	}
+
+	// 按客戶端統計請求數、流量和錯誤
+	client := clientIdentity(r)
+	start := time.Now()
+	defer func() {
+		h.clients.record(client, tw.bytesIn, tw.bytesOut, tw.failed())
+		h.requests.add(RequestRecord{
+			Time:       start,
+			RequestID:  requestID(r),
+			Client:     client,
+			Method:     r.Method,
+			Host:       r.URL.Host,
+			Status:     tw.status,
+			BytesIn:    tw.bytesIn,
+			BytesOut:   tw.bytesOut,
+			DurationMs: time.Since(start).Milliseconds(),
+		})
+		// 每個請求都會經過此處，級別未啟用時跳過字段構造
+		if !serverLog.Enabled(logger.LevelInfo) {
+			return
+		}
+		requestLogger(r).WithFields(logger.Fields{
+			"method":    r.Method,
+			"url":       r.URL.String(),
+			"client":    client,
+			"status":    tw.status,
+			"bytes_in":  tw.bytesIn,
+			"bytes_out": tw.bytesOut,
+			"duration":  time.Since(start).String(),
+		}).Info("request completed")
+	}()
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			requestLogger(r).WithField("url", r.URL.String()).Errorf("Recovered panic in ServeHTTP: %v", rec)
+			writeProxyError(w, r, http.StatusInternalServerError, ReasonInternal, errors.New("Internal server error: unexpected panic"))
+		}
+	}()
+
+	if h.version != "" {
+		w.Header().Set(VersionHeader, h.version)
+	}
+
+	r.Header.Del("Proxy-Connection")
+	r.Header.Del("Proxy-Authenticate")
+	r.Header.Del("Proxy-Authorization")
+
+	// 解析客戶端指定的代理篩選條件（如 X-Proxy-Site、X-Proxy-Tag）
+	specified := hasCriteriaHeader(r.Header)
+	criteria := h.criteriaFromRequest(r)
+	if inherited != nil && !specified {
+		criteria = *inherited
+	}
+	criteria.client = client
+	criteria.host = strings.ToLower(r.URL.Hostname())
+
+	if err := h.targetACL.check(r.Context(), r.URL.Hostname()); err != nil {
+		requestLogger(r).WithFields(logger.Fields{"url": r.URL.String(), "client": client}).WithError(err).Warn("Target denied")
+		writeProxyError(w, r, http.StatusForbidden, ReasonACLDenied, err)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		h.handleConnect(w, r, criteria)
+		return
+	}
+	if isUpgradeRequest(r.Header) {
+		h.handleUpgrade(w, r, criteria)
+		return
+	}
+
+	h.handleRegularRequest(w, r, criteria)
+}
+
+func (h *ProxyHandler) handleRegularRequest(w http.ResponseWriter, r *http.Request, criteria requestCriteria) {
+	log := requestLogger(r).WithField("url", r.URL.String())
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Errorf("Recovered panic in handleRegularRequest: %v", rec)
+			writeProxyError(w, r, http.StatusInternalServerError, ReasonInternal, errors.New("Internal server error: unexpected panic"))
+		}
+	}()
+
+	// 按目標域名限制並發，超出限制時排隊等待
+	release, err := h.acquireDomainSlot(r)
+	if err != nil {
+		writeProxyError(w, r, http.StatusServiceUnavailable, ReasonDomainLimit, err)
+		log.WithError(err).Warn("Domain concurrency limit")
+		return
+	}
+	defer release()
+
+	// 緩衝請求體，使換代理重試時可以完整重發
+	body, err := bufferRequestBody(r, h.bodyBufferBytes, h.bodySpoolBytes, h.bodySpoolDir)
+	if err != nil {
+		log.WithError(err).Error("Failed to buffer request body")
+		writeProxyError(w, r, http.StatusBadRequest, ReasonBadRequest, err)
+		return
+	}
+	defer body.Close()
+	if body.Replayable() {
+		addTraffic(w, body.size, 0)
+	}
+
+	// 按重試策略換代理重試（或對沖），每次嘗試都重新選擇代理
+	policy := h.forwardPolicy(body)
+	// 客戶端斷開不取消上遊請求，只沿用請求 ID 與追蹤上下文
+	up, release, err := retry.Do(context.WithoutCancel(r.Context()), policy, func(ctx context.Context, attempt int) (*upstreamResponse, error) {
+		return h.forwardAttempt(ctx, r, body, criteria, attempt, policy.Attempts())
+	}, func(up *upstreamResponse) bool {
+		return policy.RetryableStatus(up.resp.StatusCode) || up.banned && h.bans.retryable()
+	}, func(up *upstreamResponse) {
+		retry.DiscardResponse(up.resp)
+	})
+	defer release()
+	if err != nil {
+		var selErr *selectionError
+		if errors.As(err, &selErr) {
+			writeProxyError(w, r, http.StatusServiceUnavailable, selectionFailureReason(selErr.err), selErr.err)
+			log.WithError(selErr.err).Error("Failed to select proxy from DB")
+			return
+		}
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			log.WithError(reqErr.err).Error("Failed to create new request")
+			writeProxyError(w, r, http.StatusInternalServerError, ReasonInternal, reqErr.err)
+			return
+		}
+		log.WithError(err).Error("Upstream request failed")
+		writeProxyError(w, r, http.StatusBadGateway, ReasonAllUpstreamsFailed, err)
+		return
+	}
+	proxy, resp := up.proxy, up.resp
+	// 響應修改器可能替換響應體，關閉最終的響應體
+	defer func() { resp.Body.Close() }()
+
+	// 轉發響應頭（先按規則改寫並應用響應修改器，單跳頭部不轉發）
+	h.headerRewriter.RewriteResponse(r.URL.Hostname(), resp.Header)
+	if err := h.mutateResponse(resp, ExchangeInfo{Client: criteria.client, Host: criteria.host, Proxy: proxy, Attempt: up.attempt}); err != nil {
+		log.WithField("proxy", proxy.String()).WithError(err).Error("Response mutator failed")
+		writeProxyError(w, r, http.StatusBadGateway, ReasonInternal, err)
+		return
+	}
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	// 轉發狀態碼
+	w.WriteHeader(resp.StatusCode)
+
+	// 抽中鏡像時同時經由另一個代理發送同一請求，並記錄轉發的響應體用於比較
+	var respBody io.Reader = resp.Body
+	var capture *signatureCapture
+	var mirrored <-chan mirrorResult
+	if len(h.responseMutators) == 0 && h.mirror.sample(r) {
+		capture = &signatureCapture{max: h.mirror.maxBody}
+		respBody = io.TeeReader(resp.Body, capture)
+		mirrored = h.startMirror(resp.Request, criteria, proxy)
+	}
+
+	// 轉發響應體
+	_, span := tracer.Start(r.Context(), "proxy.transfer", trace.WithAttributes(attribute.String("proxy.upstream", proxy.String())))
+	shaper := h.bandwidth.shaper(criteria.client)
+	n, err := io.Copy(w, shaper.reader(respBody))
+	shaper.close()
+	span.SetAttributes(attribute.Int64("proxy.bytes_out", n))
+	endSpan(span, err)
+	if err != nil {
+		log.WithField("proxy", proxy.String()).WithError(err).Error("Error copying response body")
+	}
+	if capture != nil {
+		sig, sigErr := capture.signature(resp)
+		copyErr := err
+		go func() {
+			defer h.mirror.done()
+			res := <-mirrored
+			if copyErr == nil && sigErr == nil {
+				h.checkMirror(resp.Request, criteria, proxy, sig, res)
+			}
+		}()
+	}
+
+	// 記錄代理使用情況，未觸發重試的響應計為一次成功
+	h.pool.RecordUse(proxy)
+	if !h.retry.RetryableStatus(resp.StatusCode) {
+		h.pool.RecordHealth(proxy, true)
+		if !up.banned {
+			h.domains.record(criteria.host, proxy, true)
+		}
+	}
+}
+
+// upstreamResponse 單次上遊嘗試的結果
+type upstreamResponse struct {
+	proxy   *pool.Proxy
+	resp    *http.Response
+	banned  bool // 目標響應表示代理已被封禁
+	attempt int  // 嘗試序號
+}
+
+// selectionError 選擇代理失敗（不重試）
+type selectionError struct{ err error }
+
+func (e *selectionError) Error() string { return e.err.Error() }
+func (e *selectionError) Unwrap() error { return e.err }
+
+// requestError 構建上遊請求失敗（不重試）
+type requestError struct{ err error }
+
+func (e *requestError) Error() string { return e.err.Error() }
+func (e *requestError) Unwrap() error { return e.err }
+
+// forwardAttempt 選擇一個代理並經由它發送請求
+func (h *ProxyHandler) forwardAttempt(ctx context.Context, r *http.Request, body *replayBody, criteria requestCriteria, attempt, attempts int) (up *upstreamResponse, err error) {
+	log := requestLogger(r).WithField("url", r.URL.String())
+	ctx, span := tracer.Start(ctx, "proxy.attempt", trace.WithAttributes(attribute.Int("proxy.attempt", attempt)))
+	defer func() { endSpan(span, err) }()
+
+	// 從數據庫中選擇一個代理（每請求輪換或按時間間隔輪換）
+	proxy, err := h.tracedPickProxy(ctx, criteria)
+	if err != nil {
+		return nil, &selectionError{err}
+	}
+	log = log.WithField("proxy", proxy.String())
+	span.SetAttributes(attribute.String("proxy.upstream", proxy.String()))
+	log.Debugf("Selected upstream proxy (attempt %d/%d)", attempt, attempts)
+
+	req, err := h.newUpstreamRequest(ctx, r, body)
+	if err == nil {
+		err = h.mutateRequest(req, ExchangeInfo{Client: criteria.client, Host: criteria.host, Proxy: proxy, Attempt: attempt})
+	}
+	if err != nil {
+		return nil, &requestError{err}
+	}
+
+	client := &http.Client{
+		Transport: h.createTransport(proxy),
+		Timeout:   h.timeout,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		h.reportFailure(proxy)
+		h.domains.record(criteria.host, proxy, false)
+		if ctx.Err() == nil || errors.Is(context.Cause(ctx), retry.ErrAttemptTimeout) {
+			log.WithError(err).Warnf("Upstream attempt failed (%d/%d)", attempt, attempts)
+		}
+		return nil, err
+	}
+	if h.retry.RetryableStatus(resp.StatusCode) {
+		h.reportFailure(proxy)
+		h.domains.record(criteria.host, proxy, false)
+		log.WithField("status", resp.StatusCode).Debugf("Upstream returned retryable status (%d/%d)", attempt, attempts)
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	up = &upstreamResponse{proxy: proxy, resp: resp, attempt: attempt}
+	if h.bans.detect(resp) {
+		// 代理本身可用，只是被目標封禁：不降低健康度，只在該域名上避開它
+		up.banned = true
+		h.domains.burn(criteria.host, proxy)
+		if h.rotator.enabled() {
+			h.rotator.invalidate(proxy)
+		}
+		log.WithField("status", resp.StatusCode).Warnf("Upstream proxy banned by target (%d/%d)", attempt, attempts)
+	}
+	return up, nil
+}
+
+// newUpstreamRequest 根據客戶端請求構建發往上遊的請求（每次嘗試使用新的請求體讀取器）
+func (h *ProxyHandler) newUpstreamRequest(ctx context.Context, r *http.Request, body *replayBody) (*http.Request, error) {
+	reader, err := body.NewReader()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, r.URL.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = body.ContentLength()
+	if body.Replayable() {
+		req.GetBody = body.NewReader
+	}
+
+	// 只複製端到端頭部，單跳頭部（Connection、Keep-Alive、Upgrade 等）只對客戶端到本代理的連接有效
+	req.Header = make(http.Header)
+	for key, values := range r.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	removeHopHeaders(req.Header)
+	h.prepareUpstreamHeader(r, req.Header)
+	return req, nil
+}
+
+// prepareUpstreamHeader 處理發往上遊的請求頭：按配置設置 X-Forwarded-For 或按嚴格模式清理，再應用頭部改寫規則
+func (h *ProxyHandler) prepareUpstreamHeader(r *http.Request, header http.Header) {
+	if h.hygiene.enabled() {
+		// 嚴格模式：不透露客戶端地址，並刪除可識別代理的頭部（頭部改寫規則仍然生效）
+		h.hygiene.clean(header)
+	} else {
+		setForwardedFor(header, h.forwardedFor, clientIdentity(r))
+	}
+	// 匿名模式在頭部改寫規則之前執行，改寫規則仍可注入自定義頭部
+	h.anonymizer.clean(header)
+	h.headerRewriter.RewriteRequest(r.URL.Hostname(), header)
+}
@@ -0,0 +1,42 @@
+package rotator
+
+// Reload 按新的選項重建請求處理器：選擇策略、頭部改寫、訪問控制、標籤、輪換與重試等設置對之後的請求生效，
+// 進行中的請求和已建立的隧道繼續使用原處理器直至結束；客戶端統計、最近請求記錄及連接計數保留，監聽地址不能在運行時修改
+func (p *ProxyServer) Reload(opts ...Option) {
+	cfg := newOptions(opts...)
+	h := newProxyHandler(p.BDB, cfg)
+
+	p.mu.Lock()
+	old := p.handler
+	h.clients = old.clients
+	h.requests = old.requests
+	h.domains.inherit(old.domains)
+	// 連接與隧道計數沿用原處理器，新的上限對之後的連接生效
+	old.limits.set(cfg.MaxConnections, cfg.MaxTunnels)
+	h.limits = old.limits
+	old.bandwidth.set(cfg.BandwidthLimit, cfg.ClientBandwidthLimit)
+	h.bandwidth = old.bandwidth
+	p.handler = h
+	p.Timeout = cfg.Timeout
+	p.RotateInterval = cfg.RotateInterval
+	p.DomainConcurrency = cfg.DomainConcurrency
+	p.ResponseSLO = cfg.ResponseSLO
+	p.SLORetries = cfg.SLORetries
+	p.mu.Unlock()
+
+	if cfg.ListenAddr != p.ListenAddr {
+		serverLog.Warnf("Listen address change to %s requires a restart, still serving on %s", cfg.ListenAddr, p.ListenAddr)
+	}
+	// 原處理器的空閒上遊連接不再復用，進行中的請求不受影響
+	if old.transports != nil {
+		old.transports.CloseIdleConnections()
+	}
+	serverLog.Info("Proxy server settings reloaded")
+}
+
+// currentHandler 返回當前的請求處理器
+func (p *ProxyServer) currentHandler() *ProxyHandler {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.handler
+}
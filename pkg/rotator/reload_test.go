@@ -0,0 +1,41 @@
+package rotator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	target := newEchoServer(t)
+	server := NewProxyServer(nil, newDirectPool(t), WithTags("paid"))
+	front := httptest.NewServer(server.HttpServer.Handler)
+	defer front.Close()
+
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+	get := func() int {
+		t.Helper()
+		resp, err := client.Get(target.URL)
+		if err != nil {
+			t.Fatalf("request through proxy: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get(); status == http.StatusOK {
+		t.Fatal("untagged proxy should not match the default tags before reload")
+	}
+	server.Reload()
+	if status := get(); status != http.StatusOK {
+		t.Fatalf("status after reload = %d, want 200", status)
+	}
+	if top := server.TopClients(1, "requests"); len(top) != 1 || top[0].Requests != 2 {
+		t.Errorf("client stats should survive reload, got %+v", top)
+	}
+	if recent := server.RecentRequests(0); len(recent) != 2 || recent[0].Status != http.StatusOK {
+		t.Errorf("request log should survive reload, got %+v", recent)
+	}
+}
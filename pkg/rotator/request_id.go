@@ -0,0 +1,40 @@
+package rotator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+)
+
+// requestIDKey 請求上下文中保存請求 ID 的鍵
+type requestIDKey struct{}
+
+// newRequestID 生成不透明的請求 ID（16 個十六進制字符）
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// withRequestID 為請求分配 ID 並保存在上下文中
+func withRequestID(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, newRequestID()))
+}
+
+// requestID 返回請求的 ID（未分配時為空）
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger 返回帶請求 ID（及追蹤 ID）的日誌記錄器，用於把錯誤響應和追蹤與日誌對應起來
+func requestLogger(r *http.Request) *logger.Entry {
+	log := serverLog.WithField("request_id", requestID(r))
+	if id := traceID(r.Context()); id != "" {
+		log = log.WithField("trace_id", id)
+	}
+	return log
+}
@@ -0,0 +1,68 @@
+package rotator
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultRequestLogSize 最近請求記錄保留的條數
+const DefaultRequestLogSize = 200
+
+// RequestRecord 一個已完成請求的摘要（供管理界面顯示實時請求）
+type RequestRecord struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	Client     string    `json:"client"`
+	Method     string    `json:"method"`
+	Host       string    `json:"host"`
+	Status     int       `json:"status"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// requestLog 最近完成的請求（環形緩衝，超出容量時覆蓋最舊的記錄）
+type requestLog struct {
+	mu      sync.Mutex
+	records []RequestRecord
+	next    int
+	full    bool
+}
+
+func newRequestLog(size int) *requestLog {
+	return &requestLog{records: make([]RequestRecord, size)}
+}
+
+// add 記錄一個請求
+func (l *requestLog) add(rec RequestRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records[l.next] = rec
+	l.next = (l.next + 1) % len(l.records)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// recent 返回最近的 n 個請求，最新的在前（n <= 0 表示全部）
+func (l *requestLog) recent(n int) []RequestRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count := l.next
+	if l.full {
+		count = len(l.records)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+	out := make([]RequestRecord, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, l.records[(l.next-i+len(l.records))%len(l.records)])
+	}
+	return out
+}
+
+// RecentRequests 返回最近完成的 n 個請求，最新的在前（最多保留 DefaultRequestLogSize 條）
+func (p *ProxyServer) RecentRequests(n int) []RequestRecord {
+	return p.currentHandler().requests.recent(n)
+}
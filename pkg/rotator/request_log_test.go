@@ -0,0 +1,42 @@
+package rotator
+
+import "testing"
+
+func TestRequestLog(t *testing.T) {
+	l := newRequestLog(3)
+	if got := l.recent(0); len(got) != 0 {
+		t.Fatalf("empty log returned %d records", len(got))
+	}
+	for i := 1; i <= 5; i++ {
+		l.add(RequestRecord{Status: i})
+	}
+
+	statuses := func(records []RequestRecord) []int {
+		var out []int
+		for _, r := range records {
+			out = append(out, r.Status)
+		}
+		return out
+	}
+	tests := []struct {
+		n    int
+		want []int
+	}{
+		{0, []int{5, 4, 3}},
+		{2, []int{5, 4}},
+		{10, []int{5, 4, 3}},
+	}
+	for _, tt := range tests {
+		got := statuses(l.recent(tt.n))
+		if len(got) != len(tt.want) {
+			t.Errorf("recent(%d) = %v, want %v", tt.n, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("recent(%d) = %v, want %v", tt.n, got, tt.want)
+				break
+			}
+		}
+	}
+}
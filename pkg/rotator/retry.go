@@ -0,0 +1,31 @@
+package rotator
+
+import (
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/retry"
+)
+
+// sloPolicy 由響應頭 SLO 推導的轉發重試策略：SLO 超時即放棄當前代理並換一個重試（slo 為 0 時只嘗試一次）
+func sloPolicy(slo time.Duration, retries int) retry.Policy {
+	if slo <= 0 {
+		return retry.Policy{MaxAttempts: 1}
+	}
+	return retry.Policy{
+		MaxAttempts:    1 + retries,
+		AttemptTimeout: slo,
+		RetryOn:        []string{retry.ErrorTimeout},
+	}
+}
+
+// forwardPolicy 本次轉發使用的重試策略，被目標封禁後換代理重試時至少嘗試 1+BanRules.Retries 次；請求體無法重放時只嘗試一次
+func (h *ProxyHandler) forwardPolicy(body *replayBody) retry.Policy {
+	p := h.retry
+	if h.bans.retryable() {
+		p.MaxAttempts = max(p.Attempts(), 1+h.bans.retries)
+	}
+	if !body.Replayable() && (p.Attempts() > 1 || p.HedgeDelay > 0) {
+		p.MaxAttempts, p.HedgeDelay = 1, 0
+	}
+	return p
+}
@@ -0,0 +1,203 @@
+package rotator
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+	"github.com/e2u/dynamic-proxy/pkg/retry"
+)
+
+func TestForwardRetryPolicy(t *testing.T) {
+	var calls atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+
+	tests := []struct {
+		name       string
+		policy     retry.Policy
+		wantStatus int
+		wantCalls  int32
+	}{
+		{"retry on status", retry.Policy{MaxAttempts: 3, RetryStatus: []int{http.StatusServiceUnavailable}}, http.StatusOK, 3},
+		{"attempts exhausted", retry.Policy{MaxAttempts: 2, RetryStatus: []int{http.StatusServiceUnavailable}}, http.StatusServiceUnavailable, 2},
+		{"status not listed", retry.Policy{MaxAttempts: 3}, http.StatusServiceUnavailable, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			server := NewProxyServer(nil, newDirectPool(t), WithRetryPolicy(tt.policy))
+			front := httptest.NewServer(server.handler)
+			defer front.Close()
+
+			frontURL, _ := url.Parse(front.URL)
+			client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+			resp, err := client.Get(target.URL)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || calls.Load() != tt.wantCalls {
+				t.Errorf("status %d after %d upstream calls, want %d after %d", resp.StatusCode, calls.Load(), tt.wantStatus, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSLOPolicy(t *testing.T) {
+	opts := newOptions(WithResponseSLO(2*time.Second, 2))
+	if opts.Retry.MaxAttempts != 3 || opts.Retry.AttemptTimeout != 2*time.Second || !opts.Retry.RetryableError(retry.ErrAttemptTimeout) {
+		t.Errorf("SLO policy = %+v", opts.Retry)
+	}
+
+	// 顯式設置的策略優先
+	opts = newOptions(WithResponseSLO(2*time.Second, 2), WithRetryPolicy(retry.Policy{MaxAttempts: 5}))
+	if opts.Retry.MaxAttempts != 5 || opts.Retry.AttemptTimeout != 0 {
+		t.Errorf("explicit policy overridden: %+v", opts.Retry)
+	}
+
+	if opts := newOptions(); opts.Retry.Attempts() != 1 {
+		t.Errorf("default attempts = %d, want 1", opts.Retry.Attempts())
+	}
+}
+
+// newForwardingProxy 啟動轉發普通請求和 CONNECT 隧道的測試 HTTP 代理，hits 記錄收到的請求數；
+// stall 返回 true 的請求不響應，直到客戶端放棄或測試結束
+func newForwardingProxy(t *testing.T, stall func() bool, hits *atomic.Int32) *pool.Proxy {
+	t.Helper()
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if stall() {
+			select {
+			case <-r.Context().Done():
+			case <-stop:
+			}
+			return
+		}
+		if r.Method != http.MethodConnect {
+			r.RequestURI = ""
+			resp, err := http.DefaultTransport.RoundTrip(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go func() {
+			io.Copy(target, brw)
+			target.Close()
+		}()
+		io.Copy(conn, target)
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(stop) })
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	return &pool.Proxy{IP: host, Port: port, Protocol: "http", Updated: time.Now()}
+}
+
+// newSLOServer 兩個上遊代理中先收到請求的一個停頓，另一個正常轉發；失敗一次即在該域名上避開該代理，
+// 重試因此必定經由另一個代理。返回服務器及兩個代理收到的請求數
+func newSLOServer(t *testing.T, slo time.Duration) (*ProxyServer, [2]*atomic.Int32) {
+	t.Helper()
+	var stalled atomic.Bool
+	stall := func() bool { return stalled.CompareAndSwap(false, true) }
+	hits := [2]*atomic.Int32{new(atomic.Int32), new(atomic.Int32)}
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, n := range hits {
+		p := newForwardingProxy(t, stall, n)
+		if err := db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte(p.Key()), p.DumpJSON())
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewProxyServer(nil, db, WithResponseSLO(slo, 1), WithDomainMemory(time.Hour, 1)), hits
+}
+
+func TestResponseSLO(t *testing.T) {
+	const slo = 300 * time.Millisecond
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+
+	server, hits := newSLOServer(t, slo)
+	front := httptest.NewServer(server.handler)
+	defer front.Close()
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}, Timeout: 5 * time.Second}
+
+	start := time.Now()
+	resp, err := client.Get(target.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	elapsed := time.Since(start)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("response = %d %q, want 200 ok", resp.StatusCode, body)
+	}
+	if elapsed < slo || elapsed > 3*slo {
+		t.Errorf("request took %v, want the stalled attempt abandoned after %v", elapsed, slo)
+	}
+	if hits[0].Load() != 1 || hits[1].Load() != 1 {
+		t.Errorf("upstream hits = %d, %d; want one attempt through each proxy", hits[0].Load(), hits[1].Load())
+	}
+}
+
+func TestResponseSLOTunnel(t *testing.T) {
+	const slo = 300 * time.Millisecond
+	echo := newEchoListener(t)
+	server, hits := newSLOServer(t, slo)
+
+	start := time.Now()
+	conn, br := openConnectTunnel(t, server, echo.Addr().String())
+	if elapsed := time.Since(start); elapsed < slo || elapsed > 3*slo {
+		t.Errorf("tunnel took %v, want the stalled dial abandoned after %v", elapsed, slo)
+	}
+	if hits[0].Load() != 1 || hits[1].Load() != 1 {
+		t.Errorf("upstream hits = %d, %d; want one dial through each proxy", hits[0].Load(), hits[1].Load())
+	}
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "ping")
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("echo through tunnel = %q, %v", buf, err)
+	}
+}
@@ -0,0 +1,139 @@
+package rotator
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// maxRotationSlots 時間輪換記錄的篩選條件數上限：篩選條件來自客戶端的請求頭，超過時刪除最早到期的記錄
+const maxRotationSlots = 10000
+
+// intervalRotator 按時間間隔輪換出口代理（間隔內相同篩選條件的請求共用同一個上遊代理）
+type intervalRotator struct {
+	mu       sync.Mutex
+	interval time.Duration
+	slots    map[string]*rotationSlot
+	maxSlots int
+	swept    time.Time // 上次清理過期記錄的時刻
+}
+
+// rotationSlot 某個篩選條件下當前使用的代理
+type rotationSlot struct {
+	current  *pool.Proxy
+	expireAt time.Time
+}
+
+// newIntervalRotator 創建時間輪換器，interval <= 0 表示每個請求都輪換
+func newIntervalRotator(interval time.Duration) *intervalRotator {
+	return &intervalRotator{
+		interval: interval,
+		slots:    make(map[string]*rotationSlot),
+		maxSlots: maxRotationSlots,
+	}
+}
+
+// enabled 是否啟用時間輪換模式
+func (r *intervalRotator) enabled() bool {
+	return r != nil && r.interval > 0
+}
+
+// get 獲取某篩選條件下當前間隔內的代理，過期或未設置時調用 selectFn 選擇新代理。
+// selectFn 在鎖外調用，選擇期間其他篩選條件的請求不被阻塞；同一條件的並發請求都選擇了新代理時採用先寫入的一個
+func (r *intervalRotator) get(key string, selectFn func() (*pool.Proxy, error)) (*pool.Proxy, error) {
+	if p := r.current(key, time.Now()); p != nil {
+		return p, nil
+	}
+
+	p, err := selectFn()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if slot, ok := r.slots[key]; ok && slot.current != nil && now.Before(slot.expireAt) {
+		return slot.current, nil
+	}
+	slot := &rotationSlot{current: p, expireAt: now.Add(r.interval)}
+	r.slots[key] = slot
+	r.sweep(now)
+	serverLog.WithFields(logger.Fields{"proxy": p.String(), "next_rotation": slot.expireAt.Format(time.RFC3339)}).Info("Rotated upstream proxy")
+	return p, nil
+}
+
+// current 某篩選條件下當前間隔內的代理，過期或未設置時返回 nil
+func (r *intervalRotator) current(key string, now time.Time) *pool.Proxy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slot, ok := r.slots[key]; ok && now.Before(slot.expireAt) {
+		return slot.current
+	}
+	return nil
+}
+
+// sweep 每隔 interval 刪除已到期的記錄；記錄數超過 maxSlots 時刪除最早到期的記錄，
+// 保留 maxSlots 的九成，避免每個新條件都觸發排序。調用方持有 r.mu
+func (r *intervalRotator) sweep(now time.Time) {
+	if now.Sub(r.swept) >= r.interval {
+		r.swept = now
+		for key, slot := range r.slots {
+			if !now.Before(slot.expireAt) {
+				delete(r.slots, key)
+			}
+		}
+	}
+	if len(r.slots) <= r.maxSlots {
+		return
+	}
+	keys := make([]string, 0, len(r.slots))
+	for key := range r.slots {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return r.slots[keys[i]].expireAt.Before(r.slots[keys[j]].expireAt) })
+	for _, key := range keys[:len(keys)-r.maxSlots*9/10] {
+		delete(r.slots, key)
+	}
+}
+
+// invalidate 當前代理失敗時提前輪換（所有使用該代理的篩選條件）
+func (r *intervalRotator) invalidate(p *pool.Proxy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p == nil {
+		return
+	}
+	for key, slot := range r.slots {
+		if slot.current != nil && slot.current.Key() == p.Key() {
+			serverLog.WithField("proxy", p.String()).Info("Upstream proxy failed, rotating early")
+			delete(r.slots, key)
+		}
+	}
+}
+
+// pickProxy 根據輪換模式選擇滿足條件的上遊代理（每請求輪換或按時間間隔輪換）
+func (h *ProxyHandler) pickProxy(criteria requestCriteria) (*pool.Proxy, error) {
+	selectFn := func() (*pool.Proxy, error) {
+		return h.selectUnburnedProxy(criteria)
+	}
+	if !h.rotator.enabled() {
+		return selectFn()
+	}
+	return h.rotator.get(criteria.Key(), selectFn)
+}
+
+// reportFailure 上遊代理失敗時降低其健康度、丟棄其緩存連接並通知輪換器
+func (h *ProxyHandler) reportFailure(p *pool.Proxy) {
+	h.pool.RecordHealth(p, false)
+	if h.transports != nil {
+		h.transports.Evict(p)
+	}
+	if h.rotator.enabled() {
+		h.rotator.invalidate(p)
+	}
+}
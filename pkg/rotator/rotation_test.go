@@ -0,0 +1,114 @@
+package rotator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// sequence 依次返回 1.1.1.1、1.1.1.2… 的選擇函數，記錄調用次數
+func sequence(calls *int) func() (*pool.Proxy, error) {
+	return func() (*pool.Proxy, error) {
+		*calls++
+		return &pool.Proxy{IP: fmt.Sprintf("1.1.1.%d", *calls), Port: "80", Protocol: "http"}, nil
+	}
+}
+
+func TestIntervalRotator(t *testing.T) {
+	r := newIntervalRotator(time.Minute)
+	calls := 0
+	next := sequence(&calls)
+
+	// 間隔內相同條件的請求共用同一個代理，不同條件各自選擇
+	first, _ := r.get("site=a", next)
+	again, _ := r.get("site=a", next)
+	other, _ := r.get("site=b", next)
+	if first != again || calls != 2 || other == first {
+		t.Fatalf("got %s, %s, %s with %d selections; want the first proxy reused", first, again, other, calls)
+	}
+
+	// 間隔到期後選擇新代理
+	r.mu.Lock()
+	r.slots["site=a"].expireAt = time.Now().Add(-time.Second)
+	r.mu.Unlock()
+	if p, _ := r.get("site=a", next); p == first || calls != 3 {
+		t.Errorf("after the interval got %s with %d selections, want a new proxy", p, calls)
+	}
+
+	// 代理失敗時使用它的條件提前輪換
+	r.invalidate(other)
+	if p, _ := r.get("site=b", next); p == other || calls != 4 {
+		t.Errorf("after invalidate got %s with %d selections, want a new proxy", p, calls)
+	}
+}
+
+func TestIntervalRotatorSelectsOutsideLock(t *testing.T) {
+	r := newIntervalRotator(time.Minute)
+	calls := 0
+	next := sequence(&calls)
+
+	// 一個條件的選擇阻塞時，其他條件的請求照常完成
+	selecting, release := make(chan struct{}), make(chan struct{})
+	done := make(chan *pool.Proxy)
+	go func() {
+		p, _ := r.get("site=slow", func() (*pool.Proxy, error) {
+			close(selecting)
+			<-release
+			return &pool.Proxy{IP: "2.2.2.2", Port: "80", Protocol: "http"}, nil
+		})
+		done <- p
+	}()
+	<-selecting
+	fast := make(chan struct{})
+	go func() {
+		r.get("site=fast", next)
+		close(fast)
+	}()
+	select {
+	case <-fast:
+	case <-time.After(time.Second):
+		t.Fatal("get blocked while another criteria was selecting a proxy")
+	}
+
+	// 同一條件在選擇期間已由其他請求輪換時，採用已寫入的代理
+	winner := &pool.Proxy{IP: "3.3.3.3", Port: "80", Protocol: "http"}
+	r.get("site=slow", func() (*pool.Proxy, error) { return winner, nil })
+	close(release)
+	if p := <-done; p != winner {
+		t.Errorf("slow selection returned %s, want the proxy already rotated in (%s)", p, winner)
+	}
+}
+
+func TestIntervalRotatorEviction(t *testing.T) {
+	r := newIntervalRotator(time.Minute)
+	r.maxSlots = 10
+	calls := 0
+	next := sequence(&calls)
+
+	// 到期的記錄在下一次輪換時刪除
+	r.get("expired", next)
+	r.mu.Lock()
+	r.slots["expired"].expireAt = time.Now().Add(-time.Second)
+	r.swept = time.Now().Add(-2 * time.Minute)
+	r.mu.Unlock()
+	r.get("fresh", next)
+	if _, ok := r.slots["expired"]; ok {
+		t.Error("expired slot kept after sweep")
+	}
+
+	// 超過上限時刪除最早到期的記錄
+	for i := range 20 {
+		r.get(fmt.Sprintf("key-%d", i), next)
+	}
+	if len(r.slots) > r.maxSlots {
+		t.Errorf("slots = %d, want at most %d", len(r.slots), r.maxSlots)
+	}
+	if _, ok := r.slots["key-19"]; !ok {
+		t.Error("newest slot evicted")
+	}
+	if _, ok := r.slots["fresh"]; ok {
+		t.Error("oldest slot kept over the limit")
+	}
+}
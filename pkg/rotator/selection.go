@@ -0,0 +1,88 @@
+package rotator
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// SiteHeader 客戶端通過此請求頭指定代理必須可訪問的站點標籤（逗號分隔，需全部滿足）
+const SiteHeader = "X-Proxy-Site"
+
+// TagHeader 客戶端通過此請求頭指定代理必須帶有的自定義標籤（逗號分隔，需全部滿足），未指定時使用 WithTags 設置的預設標籤
+const TagHeader = "X-Proxy-Tag"
+
+// GoogleHeader 客戶端通過此請求頭（值為 1、true 或 yes）要求代理能訪問 Google 搜索（見 pool.Proxy.GoogleCapable）
+const GoogleHeader = "X-Proxy-Google"
+
+// VersionHeader 啟用 WithVersionHeader 時響應中攜帶的版本頭
+const VersionHeader = "X-Dynamic-Proxy-Version"
+
+// RequestIDHeader 啟用 WithRequestIDHeader 時響應中攜帶的請求 ID 頭
+const RequestIDHeader = "X-Request-Id"
+
+// requestCriteria 請求級別的代理篩選條件
+type requestCriteria struct {
+	pool.Criteria
+
+	client string // 客戶端身份（多樣性約束按客戶端統計時使用）
+	host   string // 目標域名（小寫，避開被該域名封禁的代理時使用）
+}
+
+// criteriaHeaders 指定篩選條件的請求頭，不會轉發到上遊
+var criteriaHeaders = []string{SiteHeader, TagHeader, GoogleHeader}
+
+// hasCriteriaHeader 請求是否指定了篩選條件
+func hasCriteriaHeader(header http.Header) bool {
+	for _, name := range criteriaHeaders {
+		if header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// criteriaFromRequest 從請求頭解析篩選條件，並刪除這些頭部以免轉發到上遊
+func (h *ProxyHandler) criteriaFromRequest(r *http.Request) requestCriteria {
+	criteria := h.criteriaFromHeader(r.Header)
+	for _, name := range criteriaHeaders {
+		r.Header.Del(name)
+	}
+	return criteria
+}
+
+// criteriaFromHeader 從請求頭解析篩選條件（不修改請求頭），未指定標籤時使用預設標籤；
+// 結果疊加在 WithCriteria 設置的基礎條件上
+func (h *ProxyHandler) criteriaFromHeader(header http.Header) requestCriteria {
+	base := h.baseCriteria
+	criteria := requestCriteria{Criteria: pool.NewCriteria(append(slices.Clone(base.Sites), splitHeaderValues(header, SiteHeader)...)...)}
+	tags := splitHeaderValues(header, TagHeader)
+	if len(pool.NormalizeTags(tags)) == 0 {
+		tags = h.defaultTags
+	}
+	criteria.Tags = pool.NormalizeTags(append(slices.Clone(base.Tags), tags...))
+	criteria.Countries, criteria.Anonymity, criteria.Protocols = base.Countries, base.Anonymity, base.Protocols
+	criteria.AllowTampering = base.AllowTampering
+	criteria.Google = base.Google || isTruthy(header.Get(GoogleHeader))
+	return criteria
+}
+
+// isTruthy 頭部值是否表示開啟
+func isTruthy(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// splitHeaderValues 返回頭部所有值按逗號拆分後的列表
+func splitHeaderValues(header http.Header, name string) []string {
+	var values []string
+	for _, v := range header.Values(name) {
+		values = append(values, strings.Split(v, ",")...)
+	}
+	return values
+}
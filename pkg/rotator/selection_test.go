@@ -0,0 +1,75 @@
+package rotator
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+func TestSiteHeaderSelection(t *testing.T) {
+	var forwarded atomic.Value
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded.Store(r.Header.Get(SiteHeader))
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+
+	never := func() bool { return false }
+	var googleHits, plainHits atomic.Int32
+	google := newForwardingProxy(t, never, &googleHits)
+	google.Sites = []string{"google", "amazon"}
+	plain := newForwardingProxy(t, never, &plainHits)
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, p := range []*pool.Proxy{google, plain} {
+		if err := db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte(p.Key()), p.DumpJSON())
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	front := httptest.NewServer(NewProxyServer(nil, db).handler)
+	defer front.Close()
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+	get := func(sites string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, target.URL, nil)
+		req.Header.Set(SiteHeader, sites)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	// 只經由通過了所有指定站點探測的代理，站點標籤不區分大小寫
+	// （經由同一代理的請求復用緩存的隧道，代理只收到一次 CONNECT）
+	for range 10 {
+		if resp := get("Google, amazon"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d (%s)", resp.StatusCode, resp.Header.Get(ReasonHeader))
+		}
+	}
+	if googleHits.Load() == 0 || plainHits.Load() != 0 {
+		t.Errorf("connections = %d via the matching proxy, %d via the other; want only the matching proxy", googleHits.Load(), plainHits.Load())
+	}
+	if v := forwarded.Load(); v != "" {
+		t.Errorf("%s forwarded to the target: %q", SiteHeader, v)
+	}
+
+	// 沒有代理通過探測的站點
+	if resp := get("netflix"); resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get(ReasonHeader) != ReasonPoolEmpty {
+		t.Errorf("unmatched site = %d (%s), want 503 %s", resp.StatusCode, resp.Header.Get(ReasonHeader), ReasonPoolEmpty)
+	}
+}
@@ -0,0 +1,42 @@
+package rotator
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+)
+
+// 會話範圍：User-Agent 輪換和頭部模板按範圍選擇，同一範圍內的請求看起來來自同一個瀏覽器
+const (
+	SessionScopeRequest = "request" // 每個請求重新選擇
+	SessionScopeClient  = "client"  // 同一客戶端固定使用一個
+	SessionScopeProxy   = "proxy"   // 同一出口代理固定使用一個（配合 WithRotateInterval，間隔內的請求看起來來自同一個瀏覽器）
+)
+
+// validSessionScope 是否為已知的會話範圍
+func validSessionScope(scope string) bool {
+	switch scope {
+	case SessionScopeRequest, SessionScopeClient, SessionScopeProxy:
+		return true
+	}
+	return false
+}
+
+// scopedRand 按範圍返回隨機數生成器：request 範圍每次不同，client、proxy 範圍以 salt 加客戶端或出口代理的哈希為種子，
+// 同一客戶端或出口總是得到相同的選擇（salt 區分不同功能，避免各自的選擇互相關聯）
+func scopedRand(scope, salt string, info ExchangeInfo) *rand.Rand {
+	switch {
+	case scope == SessionScopeClient:
+		return seededRand(salt + "|" + info.Client)
+	case scope == SessionScopeProxy && info.Proxy != nil:
+		return seededRand(salt + "|" + info.Proxy.Key())
+	}
+	return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// seededRand 以 key 的哈希為種子的隨機數生成器，同一 key 總是得到相同的序列
+func seededRand(key string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	seed := h.Sum64()
+	return rand.New(rand.NewPCG(seed, seed>>1|1))
+}
@@ -0,0 +1,160 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// errTargetDenied 目標被訪問控制拒絕
+var errTargetDenied = errors.New("target denied by access control")
+
+// sharedAddressSpace 運營商級 NAT 地址（RFC 6598），與私有地址一樣不應經由開放代理訪問
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// targetRules 目標主機規則：精確主機名、域名後綴（.example.com 或 *.example.com，包括 example.com 本身）及 IP/CIDR
+type targetRules struct {
+	hosts    map[string]bool
+	suffixes []string
+	prefixes []netip.Prefix
+}
+
+// parseTargetRules 解析規則，無效的 CIDR 記錄警告後忽略
+func parseTargetRules(rules []string) targetRules {
+	t := targetRules{hosts: make(map[string]bool)}
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		switch {
+		case rule == "":
+		case strings.Contains(rule, "/"):
+			prefix, err := netip.ParsePrefix(rule)
+			if err != nil {
+				serverLog.Warnf("Ignoring invalid target CIDR %q: %v", rule, err)
+				continue
+			}
+			t.prefixes = append(t.prefixes, prefix.Masked())
+		case strings.HasPrefix(rule, "*.") || strings.HasPrefix(rule, "."):
+			t.suffixes = append(t.suffixes, strings.TrimPrefix(strings.TrimPrefix(rule, "*"), "."))
+		default:
+			if addr, err := netip.ParseAddr(rule); err == nil {
+				t.prefixes = append(t.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+				continue
+			}
+			t.hosts[rule] = true
+		}
+	}
+	return t
+}
+
+func (t targetRules) empty() bool {
+	return len(t.hosts) == 0 && len(t.suffixes) == 0 && len(t.prefixes) == 0
+}
+
+// matchHost 主機名是否匹配精確或後綴規則
+func (t targetRules) matchHost(host string) bool {
+	if t.hosts[host] {
+		return true
+	}
+	for _, suffix := range t.suffixes {
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAddr IP 是否在 CIDR 規則內
+func (t targetRules) matchAddr(addr netip.Addr) bool {
+	for _, prefix := range t.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetACL 目標主機訪問控制：拒絕列表優先，允許列表非空時只允許匹配的目標；
+// 預設拒絕私有、環回、鏈路本地等地址，防止經由開放代理訪問運營者的內部網絡（SSRF）
+type targetACL struct {
+	allow        targetRules
+	deny         targetRules
+	allowPrivate bool
+	lookup       func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// newTargetACL 創建訪問控制，enabled 為 false 時返回 nil（不限制）
+func newTargetACL(enabled bool, allow, deny []string, allowPrivate bool) *targetACL {
+	if !enabled {
+		return nil
+	}
+	return &targetACL{
+		allow:        parseTargetRules(allow),
+		deny:         parseTargetRules(deny),
+		allowPrivate: allowPrivate,
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}
+}
+
+// check 檢查目標主機（域名或 IP，不含端口）是否允許訪問；
+// 需要按 IP 判斷時在本機解析域名，解析失敗時只按主機名規則判斷（由上遊代理解析）
+func (a *targetACL) check(ctx context.Context, host string) error {
+	if a == nil {
+		return nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else if len(a.deny.prefixes) > 0 || len(a.allow.prefixes) > 0 || !a.allowPrivate {
+		resolved, err := a.lookup(ctx, host)
+		if err != nil {
+			serverLog.WithField("host", host).WithError(err).Debug("Target lookup failed, checking host rules only")
+		}
+		addrs = resolved
+	}
+	for i := range addrs {
+		addrs[i] = addrs[i].Unmap()
+	}
+
+	if a.deny.matchHost(host) {
+		return fmt.Errorf("%w: %s is in the deny list", errTargetDenied, host)
+	}
+	for _, addr := range addrs {
+		if a.deny.matchAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to denied address %s", errTargetDenied, host, addr)
+		}
+	}
+	if !a.allow.empty() && !a.allow.matchHost(host) && !a.allowedAddrs(addrs) {
+		return fmt.Errorf("%w: %s is not in the allow list", errTargetDenied, host)
+	}
+	if !a.allowPrivate {
+		for _, addr := range addrs {
+			if isPrivateAddr(addr) && !a.allow.matchAddr(addr) {
+				return fmt.Errorf("%w: %s resolves to private address %s", errTargetDenied, host, addr)
+			}
+		}
+	}
+	return nil
+}
+
+// allowedAddrs 所有地址都在允許的 CIDR 內（沒有地址時返回 false）
+func (a *targetACL) allowedAddrs(addrs []netip.Addr) bool {
+	for _, addr := range addrs {
+		if !a.allow.matchAddr(addr) {
+			return false
+		}
+	}
+	return len(addrs) > 0
+}
+
+// isPrivateAddr 是否為不應經由開放代理訪問的地址（私有、環回、鏈路本地、未指定、組播及運營商級 NAT）
+func isPrivateAddr(addr netip.Addr) bool {
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() || sharedAddressSpace.Contains(addr)
+}
@@ -0,0 +1,82 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestTargetACL(t *testing.T) {
+	hosts := map[string][]netip.Addr{
+		"example.com":     {netip.MustParseAddr("93.184.215.14")},
+		"api.example.com": {netip.MustParseAddr("93.184.215.15")},
+		"intranet.corp":   {netip.MustParseAddr("10.1.2.3")},
+		"metadata.cloud":  {netip.MustParseAddr("169.254.169.254")},
+		"cdn.example.net": {netip.MustParseAddr("203.0.113.9")},
+	}
+	newACL := func(allow, deny []string, allowPrivate bool) *targetACL {
+		a := newTargetACL(true, allow, deny, allowPrivate)
+		a.lookup = func(_ context.Context, host string) ([]netip.Addr, error) {
+			if addrs, ok := hosts[host]; ok {
+				return addrs, nil
+			}
+			return nil, errors.New("no such host")
+		}
+		return a
+	}
+
+	tests := []struct {
+		name    string
+		acl     *targetACL
+		host    string
+		allowed bool
+	}{
+		{name: "public host", acl: newACL(nil, nil, false), host: "example.com", allowed: true},
+		{name: "loopback IP", acl: newACL(nil, nil, false), host: "127.0.0.1"},
+		{name: "IPv6 loopback", acl: newACL(nil, nil, false), host: "::1"},
+		{name: "host resolving to private", acl: newACL(nil, nil, false), host: "intranet.corp"},
+		{name: "link-local metadata", acl: newACL(nil, nil, false), host: "metadata.cloud"},
+		{name: "CGNAT", acl: newACL(nil, nil, false), host: "100.64.0.1"},
+		{name: "unresolvable host", acl: newACL(nil, nil, false), host: "unknown.invalid", allowed: true},
+		{name: "private allowed", acl: newACL(nil, nil, true), host: "10.0.0.1", allowed: true},
+		{name: "private CIDR explicitly allowed", acl: newACL([]string{"10.1.0.0/16"}, nil, false), host: "intranet.corp", allowed: true},
+		{name: "exact deny", acl: newACL(nil, []string{"example.com"}, false), host: "EXAMPLE.com.", allowed: false},
+		{name: "exact deny does not cover subdomain", acl: newACL(nil, []string{"example.com"}, false), host: "api.example.com", allowed: true},
+		{name: "suffix deny", acl: newACL(nil, []string{"*.example.com"}, false), host: "api.example.com"},
+		{name: "suffix deny covers apex", acl: newACL(nil, []string{".example.com"}, false), host: "example.com"},
+		{name: "CIDR deny on resolved IP", acl: newACL(nil, []string{"203.0.113.0/24"}, false), host: "cdn.example.net"},
+		{name: "deny wins over allow", acl: newACL([]string{".example.com"}, []string{"api.example.com"}, false), host: "api.example.com"},
+		{name: "allow list match", acl: newACL([]string{".example.com"}, nil, false), host: "api.example.com", allowed: true},
+		{name: "allow list miss", acl: newACL([]string{".example.com"}, nil, false), host: "cdn.example.net"},
+		{name: "allow list CIDR", acl: newACL([]string{"203.0.113.0/24"}, nil, false), host: "cdn.example.net", allowed: true},
+	}
+
+	for _, tt := range tests {
+		err := tt.acl.check(context.Background(), tt.host)
+		if tt.allowed && err != nil {
+			t.Errorf("%s: %s denied: %v", tt.name, tt.host, err)
+		}
+		if !tt.allowed && !errors.Is(err, errTargetDenied) {
+			t.Errorf("%s: %s should be denied, err = %v", tt.name, tt.host, err)
+		}
+	}
+}
+
+func TestTargetACLDeniesRequest(t *testing.T) {
+	echo := newEchoServer(t)
+	server := NewProxyServer(nil, newDirectPool(t), WithTargetACL(nil, nil, false))
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, echo.URL, nil),
+		httptest.NewRequest(http.MethodConnect, echo.Listener.Addr().String(), nil),
+	} {
+		rec := httptest.NewRecorder()
+		server.handler.ServeHTTP(rec, r)
+		if rec.Code != http.StatusForbidden || rec.Header().Get(ReasonHeader) != ReasonACLDenied {
+			t.Errorf("%s %s: status = %d, reason = %q; want 403 %s", r.Method, r.URL, rec.Code, rec.Header().Get(ReasonHeader), ReasonACLDenied)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package rotator
+
+import "time"
+
+// DefaultTimeout 預設的請求總時限；總時限為 0（不限制）時也用作排隊等待、鏡像請求等輔助操作的時限
+const DefaultTimeout = 30 * time.Second
+
+// Timeouts 轉發各階段的時限（請求總時限見 WithTimeout），0 表示使用預設值或不限制（見各字段）
+type Timeouts struct {
+	// Dial 連接上遊代理並完成代理握手的時限（0 表示 pool.DefaultDialTimeout）
+	Dial time.Duration
+	// TLSHandshake 與 HTTPS 目標 TLS 握手的時限（0 表示 pool.DefaultTLSHandshakeTimeout）
+	TLSHandshake time.Duration
+	// ResponseHeader 發出請求後等待響應頭的時限（0 表示不限制；與重試策略的單次嘗試時限同時設置時取較小者）
+	ResponseHeader time.Duration
+	// IdleTunnel CONNECT 隧道及協議升級連接兩個方向都沒有數據的時限，超過後關閉連接（0 表示不限制）
+	IdleTunnel time.Duration
+	// TunnelLifetime CONNECT 隧道及協議升級連接的最長存續時間，無論是否有數據，超過後關閉連接（0 表示不限制）
+	TunnelLifetime time.Duration
+}
+
+// responseHeaderTimeout 等待響應頭的時限：配置值與單次嘗試時限中較小的非零值
+func (h *ProxyHandler) responseHeaderTimeout() time.Duration {
+	a, b := h.timeouts.ResponseHeader, h.retry.AttemptTimeout
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// boundedTimeout 排隊等待、鏡像請求等輔助操作的時限：請求總時限，未限制時為 DefaultTimeout
+func (h *ProxyHandler) boundedTimeout() time.Duration {
+	if h.timeout > 0 {
+		return h.timeout
+	}
+	return DefaultTimeout
+}
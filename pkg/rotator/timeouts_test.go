@@ -0,0 +1,29 @@
+package rotator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/retry"
+)
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	tests := []struct {
+		header, attempt, want time.Duration
+	}{
+		{0, 0, 0},
+		{5 * time.Second, 0, 5 * time.Second},
+		{0, 3 * time.Second, 3 * time.Second},
+		{5 * time.Second, 3 * time.Second, 3 * time.Second},
+		{2 * time.Second, 3 * time.Second, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		h := &ProxyHandler{timeouts: Timeouts{ResponseHeader: tt.header}, retry: retry.Policy{AttemptTimeout: tt.attempt}}
+		if got := h.responseHeaderTimeout(); got != tt.want {
+			t.Errorf("header %v attempt %v: got %v, want %v", tt.header, tt.attempt, got, tt.want)
+		}
+	}
+	if got := (&ProxyHandler{}).boundedTimeout(); got != DefaultTimeout {
+		t.Errorf("bounded timeout without total timeout = %v, want %v", got, DefaultTimeout)
+	}
+}
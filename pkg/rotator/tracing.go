@@ -0,0 +1,72 @@
+package rotator
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer 代理請求的追蹤器：未配置 OpenTelemetry SDK 時為空操作
+var tracer = otel.Tracer("github.com/e2u/dynamic-proxy/pkg/rotator")
+
+// startRequestSpan 為代理請求創建根 span：客戶端帶有追蹤上下文（如 traceparent）時作為其子 span，
+// 追蹤上下文只用於關聯，不轉發給上遊
+func startRequestSpan(r *http.Request) (*http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, r.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("server.address", r.URL.Hostname()),
+			attribute.String("client.address", clientIdentity(r)),
+			attribute.String("request.id", requestID(r)),
+		))
+	return r.WithContext(ctx), span
+}
+
+// endRequestSpan 記錄響應狀態並結束根 span
+func endRequestSpan(span trace.Span, tw *trackingWriter) {
+	span.SetAttributes(
+		attribute.Int("http.response.status_code", tw.status),
+		attribute.Int64("proxy.bytes_in", tw.bytesIn),
+		attribute.Int64("proxy.bytes_out", tw.bytesOut),
+	)
+	if tw.status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(tw.status))
+	}
+	span.End()
+}
+
+// endSpan 結束一個階段的 span，err 非 nil 時記錄錯誤
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedPickProxy 在 proxy.select span 中選擇上遊代理（見 pickProxy）
+func (h *ProxyHandler) tracedPickProxy(ctx context.Context, criteria requestCriteria) (*pool.Proxy, error) {
+	_, span := tracer.Start(ctx, "proxy.select")
+	p, err := h.pickProxy(criteria)
+	if p != nil {
+		span.SetAttributes(attribute.String("proxy.upstream", p.String()))
+	}
+	endSpan(span, err)
+	return p, err
+}
+
+// traceID 返回上下文中的追蹤 ID（沒有有效的 span 時為空）
+func traceID(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package rotator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prev)
+
+	echo := newEchoServer(t)
+	server := NewProxyServer(nil, newDirectPool(t), WithRequestIDHeader(true))
+	front := httptest.NewServer(server.handler)
+	defer front.Close()
+
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+	resp, err := client.Get(echo.URL)
+	if err != nil {
+		t.Fatalf("request through proxy: %v", err)
+	}
+	resp.Body.Close()
+	id := resp.Header.Get(RequestIDHeader)
+	if len(id) != 16 {
+		t.Fatalf("%s = %q", RequestIDHeader, id)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	root, ok := spans[http.MethodGet]
+	if !ok {
+		t.Fatalf("no request span in %v", spans)
+	}
+	var gotID string
+	for _, attr := range root.Attributes() {
+		if attr.Key == "request.id" {
+			gotID = attr.Value.AsString()
+		}
+	}
+	if gotID != id {
+		t.Errorf("request span request.id = %q, want %q", gotID, id)
+	}
+	// 代理選擇、撥號和轉發階段都在同一個追蹤中
+	for _, name := range []string{"proxy.attempt", "proxy.select", "proxy.dial", "proxy.transfer"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Errorf("missing span %s", name)
+			continue
+		}
+		if s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s in a different trace", name)
+		}
+	}
+}
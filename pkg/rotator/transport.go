@@ -0,0 +1,45 @@
+package rotator
+
+import (
+	"net/http"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// transportOptions 經由固定代理的 Transport 選項（設置了單次嘗試時限時，響應頭超時即放棄當前代理）
+func (h *ProxyHandler) transportOptions() pool.TransportOptions {
+	return pool.TransportOptions{
+		ResponseHeaderTimeout: h.responseHeaderTimeout(),
+		DialTimeout:           h.timeouts.Dial,
+		TLSHandshakeTimeout:   h.timeouts.TLSHandshake,
+		TLSClientConfig:       h.upstreamTLS,
+		Resolve:               h.resolve,
+	}
+}
+
+// createTransport 返回經由指定代理的 Transport：啟用緩存時復用同一代理的連接，否則每次新建
+func (h *ProxyHandler) createTransport(proxy *pool.Proxy) *http.Transport {
+	if h.transports != nil {
+		return h.transports.Get(proxy)
+	}
+	return pool.Transport(proxy, h.transportOptions())
+}
+
+// createUpgradeTransport 返回經由指定代理、用於協議升級請求的 Transport（升級後的連接被接管，不放入緩存）
+func (h *ProxyHandler) createUpgradeTransport(proxy *pool.Proxy) *http.Transport {
+	return pool.Transport(proxy, h.transportOptions())
+}
+
+// getRandomTransport 創建每個新連接都選擇滿足條件的代理的 Transport（時間輪換模式下間隔內共用）
+func (h *ProxyHandler) getRandomTransport(criteria requestCriteria) *http.Transport {
+	return h.pool.TransportFunc(pool.TransportOptions{
+		DialTimeout:         h.timeouts.Dial,
+		TLSHandshakeTimeout: h.timeouts.TLSHandshake,
+		OnDialError: func(p *pool.Proxy, _ error) {
+			h.reportFailure(p)
+			h.domains.record(criteria.host, p, false)
+		},
+	}, func() (*pool.Proxy, error) {
+		return h.pickProxy(criteria)
+	})
+}
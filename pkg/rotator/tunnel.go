@@ -0,0 +1,135 @@
+package rotator
+
+import (
+	"cmp"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+)
+
+// 隧道被代理關閉的原因
+const (
+	tunnelIdle     = "idle"     // 兩個方向都空閒超過 Timeouts.IdleTunnel
+	tunnelLifetime = "lifetime" // 存續超過 Timeouts.TunnelLifetime
+)
+
+var (
+	// openTunnels 當前打開的隧道數（所有代理服務器共用，重新加載配置後仍計入舊處理器的隧道）
+	openTunnels atomic.Int64
+
+	_ = metrics.NewGaugeFunc("dynamic_proxy_open_tunnels",
+		"CONNECT tunnels and upgraded connections currently open.", func() float64 { return float64(openTunnels.Load()) })
+	tunnelsExpired = metrics.NewCounterVec("dynamic_proxy_tunnels_expired_total",
+		"Tunnels closed by the proxy for exceeding the idle or lifetime limit, by reason.", "reason")
+	tunnelDuration = metrics.NewHistogramVec("dynamic_proxy_tunnel_duration_seconds",
+		"Lifetime of closed tunnels, by how they ended (closed, idle or lifetime).", metrics.DurationBuckets, "reason")
+)
+
+// tunnelWatch 跟蹤一條打開的隧道（CONNECT 隧道或協議升級連接）：計入打開的隧道數，
+// 兩個方向都空閒超過時限或存續超過最長時間時調用 onExpire 關閉隧道
+type tunnelWatch struct {
+	idle     time.Duration
+	opened   time.Time
+	expires  time.Time // 最長存續的截止時間（零值表示不限制）
+	onExpire func()
+	last     atomic.Int64 // 最近一次讀到數據的時間（UnixNano）
+
+	mu     sync.Mutex
+	timer  *time.Timer
+	closed bool
+	reason string
+}
+
+// openTunnel 開始跟蹤隧道：idle 為空閒時限（0 表示不限制），最長存續時間見 Timeouts.TunnelLifetime；
+// onExpire 關閉隧道兩端的連接，隧道結束後必須調用 close
+func (h *ProxyHandler) openTunnel(idle time.Duration, onExpire func()) *tunnelWatch {
+	openTunnels.Add(1)
+	now := time.Now()
+	w := &tunnelWatch{idle: idle, opened: now, onExpire: onExpire}
+	if h.timeouts.TunnelLifetime > 0 {
+		w.expires = now.Add(h.timeouts.TunnelLifetime)
+	}
+	w.last.Store(now.UnixNano())
+	if _, wait := w.expiry(now); wait > 0 {
+		w.mu.Lock()
+		w.timer = time.AfterFunc(wait, w.check)
+		w.mu.Unlock()
+	}
+	return w
+}
+
+// expiry 判斷隧道在 now 時是否超過限制並返回原因；未超過時返回距離最近一個限制的時長（0 表示沒有限制）
+func (w *tunnelWatch) expiry(now time.Time) (reason string, wait time.Duration) {
+	if !w.expires.IsZero() {
+		wait = w.expires.Sub(now)
+		if wait <= 0 {
+			return tunnelLifetime, 0
+		}
+	}
+	if w.idle > 0 {
+		rest := w.idle - now.Sub(time.Unix(0, w.last.Load()))
+		if rest <= 0 {
+			return tunnelIdle, 0
+		}
+		if wait == 0 || rest < wait {
+			wait = rest
+		}
+	}
+	return "", wait
+}
+
+// check 計時器到期：期間有數據則按最近活動時間重新計時，超過限制時關閉隧道
+func (w *tunnelWatch) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	reason, wait := w.expiry(time.Now())
+	if reason == "" {
+		w.timer.Reset(wait)
+		return
+	}
+	w.closed = true
+	w.reason = reason
+	tunnelsExpired.Inc(reason)
+	go w.onExpire()
+}
+
+// close 結束跟蹤並記錄隧道存續時間，返回隧道被代理關閉的原因（tunnelIdle 或 tunnelLifetime，正常結束時為空）
+func (w *tunnelWatch) close() string {
+	openTunnels.Add(-1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	tunnelDuration.Observe(time.Since(w.opened).Seconds(), cmp.Or(w.reason, "closed"))
+	return w.reason
+}
+
+// reader 包裝隧道一個方向的讀取端，讀到數據時刷新空閒計時（不限制空閒時原樣返回）
+func (w *tunnelWatch) reader(r io.Reader) io.Reader {
+	if w.idle <= 0 {
+		return r
+	}
+	return &activityReader{r: r, w: w}
+}
+
+// activityReader 讀到數據時記錄活動時間的 io.Reader
+type activityReader struct {
+	r io.Reader
+	w *tunnelWatch
+}
+
+func (r *activityReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.w.last.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
@@ -0,0 +1,136 @@
+package rotator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newEchoListener 啟動原樣返回收到數據的 TCP 服務
+func newEchoListener(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+// openConnectTunnel 經由代理服務器建立到 target 的 CONNECT 隧道
+func openConnectTunnel(t *testing.T, server *ProxyServer, target string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	front := httptest.NewServer(server.handler)
+	t.Cleanup(front.Close)
+
+	conn, err := net.Dial("tcp", front.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatalf("CONNECT: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT status = %d", resp.StatusCode)
+	}
+	return conn, br
+}
+
+// waitClosed 等待隧道被代理關閉，返回等待的時長
+func waitClosed(t *testing.T, conn net.Conn, br *bufio.Reader) time.Duration {
+	t.Helper()
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("read = %v, want EOF after the tunnel is closed", err)
+	}
+	return time.Since(start)
+}
+
+func TestTunnelIdleTimeout(t *testing.T) {
+	target := newEchoListener(t)
+	idle := 200 * time.Millisecond
+	server := NewProxyServer(nil, newDirectPool(t), WithTimeouts(Timeouts{IdleTunnel: idle}))
+	before := tunnelsExpired.Value(tunnelIdle)
+	conn, br := openConnectTunnel(t, server, target.Addr().String())
+
+	// 持續有數據時隧道保持打開
+	buf := make([]byte, 4)
+	for i := 0; i < 5; i++ {
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := io.ReadFull(br, buf); err != nil {
+			t.Fatalf("tunnel closed while active: %v", err)
+		}
+		time.Sleep(idle / 2)
+	}
+
+	// 空閒超過時限後隧道被關閉
+	if waited := waitClosed(t, conn, br); waited > 2*time.Second {
+		t.Errorf("tunnel closed after %v, want about %v", waited, idle)
+	}
+	if got := tunnelsExpired.Value(tunnelIdle) - before; got != 1 {
+		t.Errorf("idle expirations = %v, want 1", got)
+	}
+}
+
+func TestTunnelLifetime(t *testing.T) {
+	target := newEchoListener(t)
+	lifetime := 300 * time.Millisecond
+	server := NewProxyServer(nil, newDirectPool(t), WithTimeouts(Timeouts{IdleTunnel: time.Minute, TunnelLifetime: lifetime}))
+	base := openTunnels.Load()
+	conn, br := openConnectTunnel(t, server, target.Addr().String())
+	if n := openTunnels.Load() - base; n != 1 {
+		t.Errorf("open tunnels = %d, want 1", n)
+	}
+
+	// 持續有數據也在到期後關閉
+	start := time.Now()
+	buf := make([]byte, 4)
+	for {
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			break
+		}
+		if _, err := io.ReadFull(br, buf); err != nil {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("tunnel still open after its lifetime")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed < lifetime/2 {
+		t.Errorf("tunnel closed after %v, want about %v", elapsed, lifetime)
+	}
+
+	// 隧道關閉後不再計入
+	deadline := time.Now().Add(2 * time.Second)
+	for openTunnels.Load() != base && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := openTunnels.Load() - base; n != 0 {
+		t.Errorf("open tunnels after close = %d, want 0", n)
+	}
+}
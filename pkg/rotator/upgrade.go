@@ -0,0 +1,179 @@
+package rotator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// isUpgradeRequest 是否為協議升級請求（如 WebSocket：Connection: Upgrade 且帶 Upgrade 頭）
+func isUpgradeRequest(header http.Header) bool {
+	return header.Get("Upgrade") != "" && connectionHasToken(header, "upgrade")
+}
+
+// keepUpgradeHeaders 刪除單跳頭部，只保留協議升級所需的 Connection: Upgrade 和 Upgrade
+func keepUpgradeHeaders(header http.Header) {
+	upgrade := header.Values("Upgrade")
+	removeHopHeaders(header)
+	header["Upgrade"] = upgrade
+	header.Set("Connection", "Upgrade")
+}
+
+// handleUpgrade 處理協議升級請求（如 ws:// 的 WebSocket）：經由上遊代理發出升級請求，
+// 目標返回 101 後接管客戶端連接並雙向轉發；目標拒絕升級時按普通響應返回
+func (h *ProxyHandler) handleUpgrade(w http.ResponseWriter, r *http.Request, criteria requestCriteria) {
+	log := requestLogger(r).WithField("url", r.URL.String())
+
+	// 限制同時打開的隧道數（隧道存續期間佔用名額）
+	releaseTunnel, err := h.limits.acquireTunnel()
+	if err != nil {
+		writeProxyError(w, r, http.StatusServiceUnavailable, ReasonTunnelLimit, err)
+		log.WithError(err).Warn("Tunnel limit")
+		return
+	}
+	defer releaseTunnel()
+
+	// 按目標域名限制並發（連接存續期間佔用槽位）
+	release, err := h.acquireDomainSlot(r)
+	if err != nil {
+		writeProxyError(w, r, http.StatusServiceUnavailable, ReasonDomainLimit, err)
+		log.WithError(err).Warn("Domain concurrency limit")
+		return
+	}
+	defer release()
+
+	proxy, err := h.tracedPickProxy(r.Context(), criteria)
+	if err != nil {
+		writeProxyError(w, r, http.StatusServiceUnavailable, selectionFailureReason(err), err)
+		log.WithError(err).Error("Failed to select proxy from DB")
+		return
+	}
+	log = log.WithField("proxy", proxy.String())
+
+	// 升級請求沒有可重發的請求體，升級後的連接也不能復用，因此不重試、不使用緩存的 Transport；
+	// 請求的 context 在 ServeHTTP 返回前不會取消，升級後的連接在轉發結束前保持有效
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, r.URL.String(), r.Body)
+	if err != nil {
+		log.WithError(err).Error("Failed to create new request")
+		writeProxyError(w, r, http.StatusInternalServerError, ReasonInternal, err)
+		return
+	}
+	req.ContentLength = r.ContentLength
+	req.Header = r.Header.Clone()
+	keepUpgradeHeaders(req.Header)
+	h.prepareUpstreamHeader(r, req.Header)
+	if err := h.mutateRequest(req, ExchangeInfo{Client: criteria.client, Host: criteria.host, Proxy: proxy, Attempt: 1}); err != nil {
+		log.WithError(err).Error("Request mutator failed")
+		writeProxyError(w, r, http.StatusInternalServerError, ReasonInternal, err)
+		return
+	}
+
+	start := time.Now()
+	resp, err := h.createUpgradeTransport(proxy).RoundTrip(req)
+	if err != nil {
+		h.reportFailure(proxy)
+		h.domains.record(criteria.host, proxy, false)
+		log.WithError(err).Error("Upstream upgrade request failed")
+		writeProxyError(w, r, http.StatusBadGateway, ReasonAllUpstreamsFailed, err)
+		return
+	}
+	defer resp.Body.Close()
+	h.pool.RecordUse(proxy)
+	h.headerRewriter.RewriteResponse(r.URL.Hostname(), resp.Header)
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		// 目標拒絕升級，按普通響應轉發
+		removeHopHeaders(resp.Header)
+		for key, values := range resp.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			log.WithError(err).Error("Error copying response body")
+		}
+		return
+	}
+	h.pool.RecordHealth(proxy, true)
+	h.domains.record(criteria.host, proxy, true)
+
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		writeProxyError(w, r, http.StatusBadGateway, ReasonInternal, errors.New("upstream switched protocols without a writable body"))
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeProxyError(w, r, http.StatusInternalServerError, ReasonInternal, errors.New("Hijacking not supported"))
+		return
+	}
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		log.WithError(err).Error("Failed to hijack client connection")
+		return
+	}
+	defer clientConn.Close()
+	setStatus(w, resp.StatusCode)
+
+	// 將 101 響應原樣返回客戶端（保留 Connection: Upgrade 和 Upgrade 頭）
+	for key, values := range w.Header() {
+		if resp.Header[key] == nil {
+			resp.Header[key] = values
+		}
+	}
+	fmt.Fprintf(clientBuf, "HTTP/1.1 %s\r\n", resp.Status)
+	if err := resp.Header.Write(clientBuf); err != nil {
+		log.WithError(err).Error("Failed to write upgrade response")
+		return
+	}
+	clientBuf.WriteString("\r\n")
+	if err := clientBuf.Flush(); err != nil {
+		log.WithError(err).Error("Failed to write upgrade response")
+		return
+	}
+
+	// 雙向轉發；客戶端在升級前已發送的數據保留在 clientBuf 的讀緩衝中
+	tunnel := h.openTunnel(h.timeouts.IdleTunnel, func() {
+		clientConn.Close()
+		upstream.Close()
+	})
+	shaper := h.bandwidth.shaper(criteria.client)
+	defer shaper.close()
+	_, span := tracer.Start(r.Context(), "proxy.transfer")
+	var wg sync.WaitGroup
+	var bytesIn, bytesOut int64
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer upstream.Close()
+		bytesIn, _ = io.Copy(upstream, shaper.reader(tunnel.reader(clientBuf.Reader)))
+	}()
+	go func() {
+		defer wg.Done()
+		defer clientConn.Close()
+		bytesOut, _ = io.Copy(clientConn, shaper.reader(tunnel.reader(upstream)))
+	}()
+	wg.Wait()
+	reason := tunnel.close()
+	if reason != "" {
+		log.Debugf("Upgraded connection closed by %s limit", reason)
+	}
+	span.SetAttributes(attribute.Int64("proxy.bytes_in", bytesIn), attribute.Int64("proxy.bytes_out", bytesOut),
+		attribute.String("proxy.tunnel_expired", reason))
+	span.End()
+	addTraffic(w, bytesIn, bytesOut)
+
+	log.WithFields(logger.Fields{
+		"protocol":  resp.Header.Get("Upgrade"),
+		"bytes_in":  bytesIn,
+		"bytes_out": bytesOut,
+		"duration":  time.Since(start).String(),
+	}).Debug("Upgraded connection closed")
+}
@@ -0,0 +1,131 @@
+package rotator
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newUpgradeEchoServer 接受 Upgrade: echo 的測試目標，升級後逐行回顯；received 返回升級請求的頭部
+func newUpgradeEchoServer(t *testing.T) (*httptest.Server, chan http.Header) {
+	t.Helper()
+	received := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		if !isUpgradeRequest(r.Header) || r.Header.Get("Upgrade") != "echo" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		buf.Flush()
+		for {
+			line, err := buf.ReadString('\n')
+			if err != nil {
+				return
+			}
+			buf.WriteString(line)
+			buf.Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+func TestUpgradeTunnel(t *testing.T) {
+	origin, received := newUpgradeEchoServer(t)
+	server := NewProxyServer(nil, newDirectPool(t))
+	front := httptest.NewServer(server.handler)
+	defer front.Close()
+
+	frontURL, _ := url.Parse(front.URL)
+	conn, err := net.Dial("tcp", frontURL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	originURL, _ := url.Parse(origin.URL)
+	fmt.Fprintf(conn, "GET %s/ws HTTP/1.1\r\nHost: %s\r\nConnection: keep-alive, Upgrade, X-Hop\r\nUpgrade: echo\r\nX-Hop: secret\r\nKeep-Alive: timeout=5\r\n\r\n",
+		origin.URL, originURL.Host)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("read upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Upgrade") != "echo" {
+		t.Fatalf("status = %d, Upgrade = %q", resp.StatusCode, resp.Header.Get("Upgrade"))
+	}
+
+	got := <-received
+	if got.Get("Connection") != "Upgrade" {
+		t.Errorf("Connection sent to origin = %q, want Upgrade", got.Get("Connection"))
+	}
+	for _, name := range []string{"X-Hop", "Keep-Alive"} {
+		if v := got.Get(name); v != "" {
+			t.Errorf("hop-by-hop header %s forwarded: %q", name, v)
+		}
+	}
+
+	for _, msg := range []string{"ping\n", "pong\n"} {
+		fmt.Fprint(conn, msg)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read echo: %v", err)
+		}
+		if line != msg {
+			t.Errorf("echo = %q, want %q", line, msg)
+		}
+	}
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	origin, _ := newUpgradeEchoServer(t)
+	server := NewProxyServer(nil, newDirectPool(t))
+	front := httptest.NewServer(server.handler)
+	defer front.Close()
+
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+	req, _ := http.NewRequest(http.MethodGet, origin.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "unknown")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("status = %d, want the origin's %d", resp.StatusCode, http.StatusUpgradeRequired)
+	}
+}
+
+func TestConnectionHeadersNotForwarded(t *testing.T) {
+	echo := newEchoServer(t)
+	server := NewProxyServer(nil, newDirectPool(t))
+	got := proxyRequest(t, server, echo.URL, http.Header{
+		"Connection": {"X-Hop"},
+		"X-Hop":      {"secret"},
+		"Upgrade":    {"h2c"},
+		"Accept":     {"*/*"},
+	})
+	for _, name := range []string{"X-Hop", "Upgrade"} {
+		if v := got.Get(name); v != "" {
+			t.Errorf("hop-by-hop header %s forwarded: %q", name, v)
+		}
+	}
+	if got.Get("Accept") != "*/*" {
+		t.Errorf("end-to-end header dropped: %v", got)
+	}
+}
@@ -0,0 +1,83 @@
+package rotator
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+)
+
+// userAgentRotator 把發往上遊的 User-Agent 替換為列表中的一個，列表為空時生成常見瀏覽器的 User-Agent
+type userAgentRotator struct {
+	agents []string
+	scope  string
+}
+
+// NewUserAgentRotator 創建替換 User-Agent 的請求修改器（見 WithRequestMutators）：
+// agents 為空時按瀏覽器、系統和版本生成常見的 User-Agent；scope 決定哪些請求使用同一個 User-Agent（見 SessionScopeProxy 等）
+func NewUserAgentRotator(agents []string, scope string) (RequestMutator, error) {
+	if !validSessionScope(scope) {
+		return nil, fmt.Errorf("unknown user agent scope %q", scope)
+	}
+	for i, ua := range agents {
+		if ua == "" {
+			return nil, fmt.Errorf("user agent %d is empty", i)
+		}
+	}
+	return &userAgentRotator{agents: agents, scope: scope}, nil
+}
+
+// MutateRequest 實現 RequestMutator
+func (u *userAgentRotator) MutateRequest(req *http.Request, info ExchangeInfo) error {
+	req.Header.Set("User-Agent", u.pick(info))
+	return nil
+}
+
+// pick 按範圍選擇 User-Agent
+func (u *userAgentRotator) pick(info ExchangeInfo) string {
+	r := scopedRand(u.scope, "user-agent", info)
+	if len(u.agents) > 0 {
+		return u.agents[r.IntN(len(u.agents))]
+	}
+	return generateUserAgent(r)
+}
+
+// 生成 User-Agent 使用的系統與瀏覽器版本（只取近期的主版本，過舊或過新的版本本身就是特徵）
+var (
+	uaWindows = []string{"Windows NT 10.0; Win64; x64"}
+	uaMacOS   = []string{"Macintosh; Intel Mac OS X 10_15_7"}
+	uaLinux   = []string{"X11; Linux x86_64"}
+	// Firefox 在 macOS 上以點號分隔系統版本
+	uaFirefoxOS = []string{"Windows NT 10.0; Win64; x64", "Macintosh; Intel Mac OS X 10.15", "X11; Linux x86_64", "X11; Ubuntu; Linux x86_64"}
+
+	uaChromeMajor  = [2]int{124, 131}
+	uaFirefoxMajor = [2]int{125, 133}
+	uaSafari       = []string{"17.4.1", "17.5", "17.6", "18.0", "18.1"}
+)
+
+// generateUserAgent 按常見瀏覽器的市場份額生成 User-Agent：Chrome（Windows、macOS、Linux）、Edge、Firefox、Safari
+func generateUserAgent(r *rand.Rand) string {
+	between := func(v [2]int) int { return v[0] + r.IntN(v[1]-v[0]+1) }
+	oneOf := func(list []string) string { return list[r.IntN(len(list))] }
+
+	switch n := r.IntN(100); {
+	case n < 45:
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 Safari/537.36",
+			oneOf(uaWindows), between(uaChromeMajor))
+	case n < 60:
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 Safari/537.36",
+			oneOf(uaMacOS), between(uaChromeMajor))
+	case n < 65:
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 Safari/537.36",
+			oneOf(uaLinux), between(uaChromeMajor))
+	case n < 75:
+		v := between(uaChromeMajor)
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 Safari/537.36 Edg/%d.0.0.0",
+			oneOf(uaWindows), v, v)
+	case n < 90:
+		v := between(uaFirefoxMajor)
+		return fmt.Sprintf("Mozilla/5.0 (%s; rv:%d.0) Gecko/20100101 Firefox/%d.0", oneOf(uaFirefoxOS), v, v)
+	default:
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/%s Safari/605.1.15",
+			oneOf(uaMacOS), oneOf(uaSafari))
+	}
+}
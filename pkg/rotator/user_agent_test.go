@@ -0,0 +1,69 @@
+package rotator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+func TestUserAgentRotator(t *testing.T) {
+	if _, err := NewUserAgentRotator(nil, "session"); err == nil {
+		t.Error("unknown scope should be rejected")
+	}
+	if _, err := NewUserAgentRotator([]string{""}, SessionScopeRequest); err == nil {
+		t.Error("empty user agent should be rejected")
+	}
+
+	agents := []string{"ua-a", "ua-b", "ua-c", "ua-d"}
+	m, err := NewUserAgentRotator(agents, SessionScopeProxy)
+	if err != nil {
+		t.Fatalf("NewUserAgentRotator: %v", err)
+	}
+	pick := func(m RequestMutator, info ExchangeInfo) string {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set("User-Agent", "curl/8.0")
+		if err := m.MutateRequest(req, info); err != nil {
+			t.Fatalf("MutateRequest: %v", err)
+		}
+		return req.Header.Get("User-Agent")
+	}
+
+	// 同一出口總是使用同一個 User-Agent
+	p := &pool.Proxy{IP: "1.2.3.4", Port: "80", Protocol: "http"}
+	first := pick(m, ExchangeInfo{Proxy: p, Client: "a"})
+	for i := 0; i < 10; i++ {
+		if ua := pick(m, ExchangeInfo{Proxy: p, Client: "b"}); ua != first {
+			t.Fatalf("proxy scope picked %q then %q for the same exit", first, ua)
+		}
+	}
+	if !strings.HasPrefix(first, "ua-") {
+		t.Errorf("user agent %q not from the list", first)
+	}
+
+	// 不同出口分散到列表中的多個 User-Agent
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		seen[pick(m, ExchangeInfo{Proxy: &pool.Proxy{IP: fmt.Sprintf("10.0.0.%d", i), Port: "80", Protocol: "http"}})] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("proxy scope used %d distinct user agents across exits", len(seen))
+	}
+}
+
+func TestGeneratedUserAgent(t *testing.T) {
+	m, err := NewUserAgentRotator(nil, SessionScopeClient)
+	if err != nil {
+		t.Fatalf("NewUserAgentRotator: %v", err)
+	}
+	u := m.(*userAgentRotator)
+	ua := u.pick(ExchangeInfo{Client: "10.0.0.1"})
+	if !strings.HasPrefix(ua, "Mozilla/5.0 (") {
+		t.Errorf("generated user agent = %q", ua)
+	}
+	if again := u.pick(ExchangeInfo{Client: "10.0.0.1"}); again != ua {
+		t.Errorf("client scope generated %q then %q", ua, again)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"cmp"
+
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// poolProxies 代理池的組成：按狀態、協議和國家的代理數
+var poolProxies = metrics.NewGaugeVec("dynamic_proxy_pool_proxies",
+	"Proxies in the pool by state (healthy, disabled or pending), protocol and country (as reported by the source, unknown if not provided).",
+	"state", "protocol", "country")
+
+// unknownLabel 協議或國家未知時的標籤值
+const unknownLabel = "unknown"
+
+// poolState 代理在代理池規模指標中的狀態：可用與選擇條件一致（見 Proxy.Usable）
+func poolState(p *pool.Proxy) string {
+	switch {
+	case p.Usable():
+		return "healthy"
+	case p.Disable:
+		return "disabled"
+	}
+	return "pending"
+}
+
+// updatePoolMetrics 按狀態、協議和國家重新統計代理數，已不存在的組合不再輸出
+func updatePoolMetrics(ps []*pool.Proxy) {
+	counts := make(map[[3]string]float64)
+	for _, p := range ps {
+		counts[[3]string{poolState(p), cmp.Or(p.Protocol, unknownLabel), cmp.Or(p.Country, unknownLabel)}]++
+	}
+	samples := make([]metrics.Sample, 0, len(counts))
+	for labels, n := range counts {
+		samples = append(samples, metrics.Sample{LabelValues: labels[:], Value: n})
+	}
+	poolProxies.Replace(samples)
+}
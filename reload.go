@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/internal/eventlog"
+	"github.com/e2u/dynamic-proxy/internal/logging"
+)
+
+// reloader 配置重新加載（長駐模式下由 SIGHUP 或管理 API 觸發）
+var reloader *configReloader
+
+// pendingSettings 重新加載後尚未應用到任務的配置
+var pendingSettings atomic.Pointer[config.Config]
+
+// lockJobs 獲取任務鎖，並應用重新加載後待生效的任務配置
+func lockJobs() {
+	cronMutex.Lock()
+	applyPendingSettings()
+}
+
+// unlockJobs 應用任務運行期間重新加載的配置後釋放任務鎖
+func unlockJobs() {
+	applyPendingSettings()
+	cronMutex.Unlock()
+}
+
+// applyPendingSettings 應用待生效的任務配置（調用方需持有 cronMutex）
+func applyPendingSettings() {
+	if cfg := pendingSettings.Swap(nil); cfg != nil {
+		applySettings(cfg)
+	}
+}
+
+// configReloader 重新讀取配置文件並應用可在運行時修改的部分（來源、定時任務、選擇策略、頭部改寫與訪問控制等），
+// 不關閉數據庫，也不中斷已建立的隧道；監聽地址、數據庫等需要重啟才能生效
+type configReloader struct {
+	path  string
+	flags func(*config.Config) // 重新應用命令行參數覆蓋
+
+	mu      sync.Mutex
+	current *config.Config
+	hooks   []func(*config.Config)
+}
+
+// newConfigReloader 創建配置重新加載器，cfg 為當前生效的配置
+func newConfigReloader(path string, cfg *config.Config, flags func(*config.Config)) *configReloader {
+	return &configReloader{path: path, flags: flags, current: cfg}
+}
+
+// Config 返回當前生效的配置
+func (r *configReloader) Config() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// OnReload 註冊配置重新加載後的回調，按註冊順序在 Reload 中執行
+func (r *configReloader) OnReload(fn func(*config.Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, fn)
+}
+
+// Reload 重新加載配置文件，校驗失敗時保留原配置並返回全部問題；
+// 採集、清理等任務正在運行時，任務使用的配置在其結束後才替換
+func (r *configReloader) Reload() (*config.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.Load(r.path)
+	if err != nil {
+		return nil, err
+	}
+	r.flags(cfg)
+	if err := checkConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Hash() == r.current.Hash() {
+		log.Info("Configuration unchanged, nothing to reload")
+		return cfg, nil
+	}
+	pending := restartRequired(r.current, cfg)
+	for _, field := range pending {
+		log.Warnf("Config %s changed, restart to apply", field)
+	}
+
+	// 任務正在運行時不等待，由該任務結束時應用（見 unlockJobs）
+	pendingSettings.Store(cfg)
+	if cronMutex.TryLock() {
+		applyPendingSettings()
+		cronMutex.Unlock()
+	} else {
+		log.Info("A job is running, source and job settings apply when it finishes")
+	}
+	if err := setLogLevels(logging.Levels{Level: cfg.Log.Level, Components: cfg.Log.Components}); err != nil {
+		log.Warnf("failed to apply log levels: %v", err)
+	}
+	for _, fn := range r.hooks {
+		fn(cfg)
+	}
+	r.current = cfg
+	events.Record(eventlog.ConfigReloaded, "", map[string]any{"config_hash": cfg.Hash(), "restart_required": pending})
+	log.WithField("config_hash", cfg.Hash()).Info("Configuration reloaded")
+	return cfg, nil
+}
+
+// Watch 收到 SIGHUP 時重新加載配置，返回停止監聽的函數
+func (r *configReloader) Watch() func() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sig:
+				log.Infof("Received SIGHUP, reloading %s", r.path)
+				if _, err := r.Reload(); err != nil {
+					log.Errorf("config reload failed, keeping the current config: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
+
+// restartRequired 返回有變化但只在重啟後生效的配置項
+func restartRequired(old, cfg *config.Config) []string {
+	poolListeners := func(c *config.Config) []string {
+		var list []string
+		for _, p := range c.Pools {
+			list = append(list, p.Name+"="+p.Listen)
+		}
+		return list
+	}
+	checks := []struct {
+		name    string
+		changed bool
+	}{
+		{"server.listen", old.Server.Listen != cfg.Server.Listen},
+		{"server.mitm", old.Server.MITM != cfg.Server.MITM},
+		{"server.upstream_proxy_tls", old.Server.UpstreamProxyTLS != cfg.Server.UpstreamProxyTLS},
+		{"server.tls", !reflect.DeepEqual(old.Server.TLS, cfg.Server.TLS)},
+		{"server.client_stats_log_interval", old.Server.ClientStatsLogInterval != cfg.Server.ClientStatsLogInterval},
+		{"pools (name or listen)", !slices.Equal(poolListeners(old), poolListeners(cfg))},
+		{"admin.listen / admin.tls / admin.token", old.Admin.Listen != cfg.Admin.Listen || !reflect.DeepEqual(old.Admin.TLS, cfg.Admin.TLS) || old.Admin.Token != cfg.Admin.Token},
+		{"acme", old.ACME != cfg.ACME},
+		{"dns", !reflect.DeepEqual(old.DNS, cfg.DNS)},
+		{"db", old.DB != cfg.DB},
+		{"replica", old.Replica != cfg.Replica},
+		{"cluster", !reflect.DeepEqual(old.Cluster, cfg.Cluster)},
+		{"log.format / log.file", old.Log.Format != cfg.Log.Format || old.Log.File != cfg.Log.File},
+		{"notify", !reflect.DeepEqual(old.Notify, cfg.Notify)},
+		{"telemetry", !reflect.DeepEqual(old.Telemetry, cfg.Telemetry)},
+		{"history.interval", old.History.Interval != cfg.History.Interval},
+		{"events.capacity", old.Events.Capacity != cfg.Events.Capacity},
+		{"chat.interval", old.Chat.Interval != cfg.Chat.Interval},
+		{"validation.queue_rate / queue_workers", old.Validation.QueueRate != cfg.Validation.QueueRate || old.Validation.QueueWorkers != cfg.Validation.QueueWorkers},
+	}
+	var fields []string
+	for _, c := range checks {
+		if c.changed {
+			fields = append(fields, c.name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// replicaClient 從主實例拉取代理列表的 HTTP 客戶端
+var replicaClient = &http.Client{Timeout: time.Minute}
+
+// syncFromPrimary 從主實例的管理 API（GET /api/proxies）拉取代理記錄並替換本地代理池
+func syncFromPrimary(primary string) error {
+	resp, err := replicaClient.Get(strings.TrimRight(primary, "/") + "/api/proxies")
+	if err != nil {
+		return fmt.Errorf("failed to fetch proxies from primary: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("primary returned %s", resp.Status)
+	}
+	// 響應中的使用統計與當前評分只屬於主實例，解碼時忽略
+	var ps []*pool.Proxy
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil {
+		return fmt.Errorf("failed to decode proxies from primary: %w", err)
+	}
+
+	res, err := proxyStore.Replace(ps)
+	if err != nil {
+		return fmt.Errorf("failed to store proxies from primary: %w", err)
+	}
+	updatePoolMetrics(ps)
+	replicaLog.Debugf("Synced %d proxies from primary: %d written, %d unchanged, %d deleted",
+		len(ps), res.Written, res.Unchanged, res.Deleted)
+	return nil
+}
+
+// watchReplica 立即並每隔 replica.interval 從主實例同步代理池，返回停止同步的函數；
+// 同步失敗時保留本地已有的代理繼續服務，等待下次同步
+func watchReplica(cfg config.ReplicaConfig) func() {
+	done := make(chan struct{})
+	go func() {
+		pull := func() {
+			if err := syncFromPrimary(cfg.Primary); err != nil {
+				replicaLog.Warnf("replica sync failed, serving the last synced pool: %v", err)
+			}
+		}
+		pull()
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pull()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
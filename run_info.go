@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/buildinfo"
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/internal/fetcher"
+	"github.com/e2u/dynamic-proxy/internal/sourcestats"
+	"github.com/e2u/dynamic-proxy/internal/state"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// dbPath Badger 數據庫目錄（取自配置 db.path，未設置時為平台數據目錄）
+var dbPath string
+
+// dbSize 打開數據庫前統計的磁盤佔用
+// 打開後值日誌會被預分配到 GB 級，因此只能在打開前統計
+var dbSize int64
+
+// 元數據名稱（存儲鍵為 pool.MetaPrefix + 名稱）
+const (
+	metaRun       = "run"
+	metaGather    = "gather"
+	metaSources   = "sources"
+	metaHTTPCache = "http_cache" // GitHub 來源文件的 ETag / Last-Modified
+)
+
+// 後台任務名（/api/state 的 jobs）
+const (
+	jobGather     = "gather"
+	jobHealth     = "health"
+	jobCleanup    = "cleanup"
+	jobValidation = "validation"
+)
+
+// jobs 後台任務的運行狀態
+var jobs = state.NewJobs(jobGather, jobHealth, jobCleanup, jobValidation)
+
+// currentRun 本次長駐運行的元數據（recordRunMeta 之後有效）
+var currentRun runMeta
+
+// runMeta 最近一次長駐運行（cron 或 -serve）的元數據
+type runMeta struct {
+	StartedAt  time.Time `json:"started_at"`
+	Version    string    `json:"version"`
+	ConfigHash string    `json:"config_hash"`
+	Mode       string    `json:"mode"`
+}
+
+// gatherMeta 最近一次採集的結果
+type gatherMeta struct {
+	CompletedAt time.Time `json:"completed_at"`
+	New         int64     `json:"new"`
+	Updated     int64     `json:"updated"`
+}
+
+// poolStats 代理池概況
+type poolStats struct {
+	Total      int       `json:"total"`
+	Healthy    int       `json:"healthy"`
+	Pending    int       `json:"pending"`   // 待驗證隊列中的候選代理數
+	KnownBad   int       `json:"known_bad"` // 最近首次驗證即失敗、再次採集到時跳過的候選代理數
+	LastGather time.Time `json:"last_gather,omitzero"`
+	DBSize     int64     `json:"db_size_bytes"`
+}
+
+// lifetimeReport 代理存活與更替統計（/api/lifetime）
+type lifetimeReport struct {
+	Pool sourcestats.Lifetime `json:"pool"`
+	// Alive 當前可用代理數，MedianAgeSeconds 為其自首次入庫起時長的中位數
+	Alive            int              `json:"alive"`
+	MedianAgeSeconds float64          `json:"median_age_seconds"`
+	Sources          []sourceLifetime `json:"sources"`
+}
+
+// sourceLifetime 單個來源的存活時間統計
+type sourceLifetime struct {
+	URL string `json:"url"`
+	sourcestats.Lifetime
+}
+
+// versionHeaderValue 啟用 server.version_header 時響應頭中報告的版本
+func versionHeaderValue(cfg *config.Config) string {
+	if !cfg.Server.VersionHeader {
+		return ""
+	}
+	info := buildinfo.Get()
+	return info.Version + " (" + info.Commit + ")"
+}
+
+// recordRunMeta 保存本次運行的元數據
+func recordRunMeta(cfg *config.Config, mode string) {
+	meta := runMeta{
+		StartedAt:  time.Now(),
+		Version:    buildinfo.Version,
+		ConfigHash: cfg.Hash(),
+		Mode:       mode,
+	}
+	currentRun = meta
+	if err := pool.SaveMeta(bdb, metaRun, meta); err != nil {
+		storeLog.Warnf("failed to save run metadata: %v", err)
+	}
+}
+
+// recordGather 保存採集完成時間與結果
+func recordGather(newCount, updated int64) {
+	meta := gatherMeta{CompletedAt: time.Now(), New: newCount, Updated: updated}
+	if err := pool.SaveMeta(bdb, metaGather, meta); err != nil {
+		storeLog.Warnf("failed to save gather metadata: %v", err)
+	}
+}
+
+// loadSourceStats 載入持久化的來源統計
+func loadSourceStats() {
+	var list []sourcestats.Stats
+	if _, err := pool.LoadMeta(bdb, metaSources, &list); err != nil {
+		storeLog.Warnf("failed to load source statistics: %v", err)
+		return
+	}
+	sourceStats.Restore(list)
+}
+
+// saveSourceStats 保存來源統計
+func saveSourceStats() {
+	if err := pool.SaveMeta(bdb, metaSources, sourceStats.Snapshot()); err != nil {
+		storeLog.Warnf("failed to save source statistics: %v", err)
+	}
+}
+
+// loadHTTPCache 讀取保存的來源文件校驗信息
+func loadHTTPCache() map[string]fetcher.Validator {
+	var entries map[string]fetcher.Validator
+	if _, err := pool.LoadMeta(bdb, metaHTTPCache, &entries); err != nil {
+		storeLog.Warnf("failed to load source cache validators: %v", err)
+	}
+	return entries
+}
+
+// saveHTTPCache 保存來源文件校驗信息
+func saveHTTPCache(cache *fetcher.ConditionalCache) {
+	if err := pool.SaveMeta(bdb, metaHTTPCache, cache.Entries()); err != nil {
+		storeLog.Warnf("failed to save source cache validators: %v", err)
+	}
+}
+
+// collectPoolStats 統計代理總數、可用數、待驗證數、最近採集時間與數據庫大小
+func collectPoolStats() (poolStats, error) {
+	var st poolStats
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		return st, err
+	}
+	st.Total = len(ps)
+	for _, p := range ps {
+		if p.Usable() {
+			st.Healthy++
+		}
+	}
+	if st.Pending, err = pool.QueueLen(bdb); err != nil {
+		return st, err
+	}
+	if st.KnownBad, err = pool.KnownBadCount(bdb); err != nil {
+		return st, err
+	}
+
+	var gm gatherMeta
+	if ok, err := pool.LoadMeta(bdb, metaGather, &gm); err != nil {
+		return st, err
+	} else if ok {
+		st.LastGather = gm.CompletedAt
+	}
+
+	st.DBSize = dbSize
+	return st, nil
+}
+
+// collectLifetime 統計失效代理的存活時間分佈與當前可用代理的存活時長
+func collectLifetime() (lifetimeReport, error) {
+	ps, err := listAllProxiesFromDB()
+	if err != nil {
+		return lifetimeReport{}, err
+	}
+	now := time.Now()
+	var ages []time.Duration
+	for _, p := range ps {
+		if p.Usable() && !p.Added.IsZero() {
+			ages = append(ages, now.Sub(p.Added))
+		}
+	}
+	report := lifetimeReport{Pool: sourceStats.PoolLifetime(), Alive: len(ages), Sources: []sourceLifetime{}}
+	if len(ages) > 0 {
+		slices.Sort(ages)
+		report.MedianAgeSeconds = ages[len(ages)/2].Seconds()
+	}
+	for _, s := range sourceStats.Snapshot() {
+		report.Sources = append(report.Sources, sourceLifetime{URL: s.URL, Lifetime: s.Lifetime()})
+	}
+	return report, nil
+}
+
+// buildState 生成 /api/state 狀態文檔
+func buildState(cfg *config.Config) (state.Document, error) {
+	st, err := collectPoolStats()
+	if err != nil {
+		return state.Document{}, err
+	}
+	return state.Document{
+		SchemaVersion: state.SchemaVersion,
+		GeneratedAt:   time.Now(),
+		Version:       buildinfo.Version,
+		Commit:        buildinfo.Get().Commit,
+		Mode:          currentRun.Mode,
+		StartedAt:     currentRun.StartedAt,
+		ConfigHash:    currentRun.ConfigHash,
+		Pool: state.Pool{
+			Total:       st.Total,
+			Healthy:     st.Healthy,
+			Pending:     st.Pending,
+			LastGather:  st.LastGather,
+			DBSizeBytes: st.DBSize,
+		},
+		Jobs: jobs.Snapshot(),
+		Listeners: state.Listeners{
+			Proxy: cfg.Server.Listen,
+			Admin: cfg.Admin.Listen,
+			DNS:   cfg.DNS.Listen,
+		},
+	}, nil
+}
+
+// logStartupBanner 啟動時輸出簡要的池概況（取代逐條輸出所有代理）
+func logStartupBanner(cfg *config.Config) {
+	st, err := collectPoolStats()
+	if err != nil {
+		log.Errorf("failed to collect pool stats: %v", err)
+		return
+	}
+	lastGather := "never"
+	if !st.LastGather.IsZero() {
+		lastGather = st.LastGather.Format(time.RFC3339)
+	}
+	log.WithFields(logger.Fields{
+		"version":     buildinfo.Version,
+		"commit":      buildinfo.Get().Commit,
+		"config_hash": cfg.Hash(),
+		"proxies":     st.Total,
+		"healthy":     st.Healthy,
+		"pending":     st.Pending,
+		"last_gather": lastGather,
+		"db_size":     formatBytes(st.DBSize),
+	}).Info("dynamic-proxy started")
+}
+
+// printInfo 輸出上次運行的元數據與當前池概況（-info）
+func printInfo() error {
+	info := struct {
+		Run     *runMeta             `json:"run,omitempty"`
+		Gather  *gatherMeta          `json:"gather,omitempty"`
+		Pool    poolStats            `json:"pool"`
+		Sources []sourcestats.Report `json:"sources,omitempty"`
+	}{}
+
+	var rm runMeta
+	if ok, err := pool.LoadMeta(bdb, metaRun, &rm); err != nil {
+		return err
+	} else if ok {
+		info.Run = &rm
+	}
+	var gm gatherMeta
+	if ok, err := pool.LoadMeta(bdb, metaGather, &gm); err != nil {
+		return err
+	} else if ok {
+		info.Gather = &gm
+	}
+	st, err := collectPoolStats()
+	if err != nil {
+		return err
+	}
+	info.Pool = st
+	info.Sources = sourceStats.Reports()
+
+	jb, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal info: %w", err)
+	}
+	fmt.Println(string(jb))
+	return nil
+}
+
+// dirSize 數據庫目錄中 SST 與值日誌文件的總大小
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".sst" && ext != ".vlog" {
+			return nil
+		}
+		if fi, err := d.Info(); err == nil {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// formatBytes 以易讀單位顯示字節數
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/e2u/dynamic-proxy/internal/paths"
+)
+
+// serviceName Windows 服務名
+const serviceName = "dynamic-proxy"
+
+var (
+	// shutdown 在請求退出時關閉（Windows 服務停止）
+	shutdown     = make(chan struct{})
+	shutdownOnce sync.Once
+	// fatal 長駐模式下無法恢復的錯誤，exitCode 為退出時的狀態碼
+	fatal    = make(chan error, 1)
+	exitCode int
+)
+
+// requestShutdown 請求長駐模式退出
+func requestShutdown() {
+	shutdownOnce.Do(func() { close(shutdown) })
+}
+
+// reportFatal 報告無法恢復的運行狀態（如數據庫不可用），長駐模式隨即關閉並以非零狀態退出，
+// 以便容器編排或服務管理器重啟進程
+func reportFatal(err error) {
+	select {
+	case fatal <- err:
+	default:
+	}
+}
+
+// waitForShutdown 阻塞直到收到 SIGINT / SIGTERM、requestShutdown 被調用或 reportFatal 報告致命狀態
+func waitForShutdown() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	select {
+	case s := <-sig:
+		log.Infof("Received %s, shutting down", s)
+	case <-shutdown:
+		log.Info("Shutdown requested, shutting down")
+	case err := <-fatal:
+		log.Errorf("Fatal: %v, shutting down", err)
+		exitCode = 1
+	}
+	draining.Store(true)
+}
+
+// openLogOutput 以追加方式打開日誌文件；未配置時作為 Windows 服務運行則使用平台日誌目錄，
+// 否則返回 nil（輸出到標準錯誤）
+func openLogOutput(path string) (io.Writer, error) {
+	if path == "" {
+		if !runningAsService() {
+			return nil, nil
+		}
+		p, err := paths.DefaultLogFile()
+		if err != nil {
+			return nil, err
+		}
+		path = p
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
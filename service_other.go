@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// runningAsService 非 Windows 平台由 systemd / launchd 等直接運行，始終為 false
+func runningAsService() bool {
+	return false
+}
+
+// runService 非 Windows 平台直接運行
+func runService(run func()) error {
+	run()
+	return nil
+}
+
+// serviceCommand service 子命令僅在 Windows 上可用
+func serviceCommand([]string) error {
+	return errors.New("the service command is only available on Windows; use systemd or launchd on this platform")
+}
@@ -0,0 +1,128 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceStopTimeout 服務停止時等待數據庫關閉的最長時間
+const serviceStopTimeout = 30 * time.Second
+
+// runningAsService 是否由 Windows 服務控制管理器啟動
+func runningAsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// runService 以 Windows 服務方式運行 run，收到停止請求時調用 requestShutdown 並等待 run 返回
+func runService(run func()) error {
+	return svc.Run(serviceName, &windowsService{run: run})
+}
+
+// windowsService 實現 svc.Handler
+type windowsService struct {
+	run func()
+}
+
+func (s *windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run()
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case <-done:
+			// 單次運行模式（如 -once）或啟動失敗
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopTimeout / time.Millisecond)}
+				requestShutdown()
+				select {
+				case <-done:
+				case <-time.After(serviceStopTimeout):
+					log.Warnf("service did not stop within %v", serviceStopTimeout)
+				}
+				return false, 0
+			}
+		}
+	}
+}
+
+// serviceCommand 管理 Windows 服務：install [flags...] | uninstall | start | stop
+// install 後的參數作為服務啟動參數，路徑須使用絕對路徑（服務的工作目錄為系統目錄）
+func serviceCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: dynamic-proxy service install [flags...] | uninstall | start | stop")
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if args[0] == "install" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		if exe, err = filepath.Abs(exe); err != nil {
+			return err
+		}
+		if s, err := m.OpenService(serviceName); err == nil {
+			s.Close()
+			return fmt.Errorf("service %s already exists", serviceName)
+		}
+		s, err := m.CreateService(serviceName, exe, mgr.Config{
+			DisplayName: "Dynamic Proxy",
+			Description: "Rotating HTTP proxy backed by a validated pool of public proxies",
+			StartType:   mgr.StartAutomatic,
+		}, args[1:]...)
+		if err != nil {
+			return fmt.Errorf("failed to create service: %w", err)
+		}
+		defer s.Close()
+		fmt.Printf("service %s installed (%s)\n", serviceName, exe)
+		return nil
+	}
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", serviceName, err)
+	}
+	defer s.Close()
+
+	switch args[0] {
+	case "uninstall":
+		if err := s.Delete(); err != nil {
+			return fmt.Errorf("failed to delete service: %w", err)
+		}
+		fmt.Printf("service %s removed\n", serviceName)
+	case "start":
+		if err := s.Start(); err != nil {
+			return fmt.Errorf("failed to start service: %w", err)
+		}
+	case "stop":
+		if _, err := s.Control(svc.Stop); err != nil {
+			return fmt.Errorf("failed to stop service: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown service command %q", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/buildinfo"
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/internal/metrics"
+	"github.com/e2u/dynamic-proxy/internal/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+// tracer 採集任務的追蹤器：未配置 telemetry.otlp_endpoint 時為空操作
+var tracer = otel.Tracer("github.com/e2u/dynamic-proxy")
+
+var (
+	gatherDuration = metrics.NewHistogramVec("dynamic_proxy_gather_duration_seconds",
+		"Duration of gather runs and of each source within them, by scope (run or source).", metrics.DurationBuckets, "scope")
+	gatheredProxies = metrics.NewCounterVec("dynamic_proxy_gathered_proxies_total",
+		"Candidate proxies stored by gather runs, by result (new or updated).", "result")
+)
+
+// telemetryShutdownTimeout 退出時導出剩餘追蹤和指標的最長等待時間
+const telemetryShutdownTimeout = 5 * time.Second
+
+// startTelemetry 按配置啟動 OTLP 導出，返回退出前調用的停止函數（未配置或啟動失敗時為空操作）
+func startTelemetry(cfg config.TelemetryConfig) func() {
+	if cfg.Endpoint == "" || (!cfg.Traces && !cfg.Metrics) {
+		return func() {}
+	}
+	shutdown, err := telemetry.Start(context.Background(), telemetry.Options{
+		Endpoint:       cfg.Endpoint,
+		Headers:        cfg.Headers,
+		Traces:         cfg.Traces,
+		Metrics:        cfg.Metrics,
+		SampleRatio:    cfg.SampleRatio,
+		MetricInterval: cfg.MetricInterval,
+		ServiceName:    cfg.ServiceName,
+		ServiceVersion: buildinfo.Get().Version,
+	}, metrics.Default)
+	if err != nil {
+		log.Errorf("OTLP export disabled: %v", err)
+		return func() {}
+	}
+	log.Infof("Exporting telemetry to %s (traces: %t, metrics: %t)", cfg.Endpoint, cfg.Traces, cfg.Metrics)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), telemetryShutdownTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Warnf("failed to flush telemetry: %v", err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/internal/top"
+)
+
+// topCommand top 子命令：終端界面，經由運行中實例的管理 API（admin.listen）顯示代理池概況、轉發速率和
+// 按使用次數或失敗次數排序的代理列表，可手動禁用或啟用代理；不讀取配置、不打開數據庫
+func topCommand(args []string) error {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	adminURL := fs.String("admin", "http://127.0.0.1:9090", "Admin API base URL of the running instance")
+	interval := fs.Duration("interval", 2*time.Second, "Refresh interval")
+	token := fs.String("token", os.Getenv(config.EnvPrefix+"ADMIN_TOKEN"), "Admin API token (admin.token), needed to disable or enable proxies")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *interval <= 0 {
+		return errors.New("-interval must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return top.Run(ctx, top.Options{Admin: *adminURL, Token: *token, Interval: *interval})
+}
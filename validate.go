@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/e2u/dynamic-proxy/internal/admin"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+const (
+	// validateMaxProxies POST /validate 單次請求最多驗證的代理數
+	validateMaxProxies = 256
+	// validateWorkers POST /validate 同時驗證的代理數
+	validateWorkers = 16
+)
+
+// readValidateRequest 讀取待驗證的代理列表：JSON {"proxies":[...]}、JSON 數組，或每行一個地址的純文本
+func readValidateRequest(r *http.Request) ([]string, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	trimmed := strings.TrimSpace(string(body))
+	switch {
+	case strings.HasPrefix(trimmed, "{"):
+		var req struct {
+			Proxies []string `json:"proxies"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, fmt.Errorf("invalid request body: %w", err)
+		}
+		return req.Proxies, nil
+	case strings.HasPrefix(trimmed, "["):
+		var list []string
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("invalid request body: %w", err)
+		}
+		return list, nil
+	}
+	var list []string
+	sc := bufio.NewScanner(strings.NewReader(trimmed))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			list = append(list, line)
+		}
+	}
+	return list, nil
+}
+
+// handleValidate POST /validate 按當前驗證策略驗證任意代理（不必在數據庫中，結果不寫入數據庫），
+// 按請求順序返回每個代理的協議、延遲、匿名級別和出口地址
+func handleValidate(w http.ResponseWriter, r *http.Request) {
+	list, err := readValidateRequest(r)
+	if err != nil {
+		admin.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(list) == 0 {
+		admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("no proxies to validate"))
+		return
+	}
+	if len(list) > validateMaxProxies {
+		admin.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("too many proxies: %d (max %d)", len(list), validateMaxProxies))
+		return
+	}
+
+	results := make([]pool.CheckResult, len(list))
+	sem := make(chan struct{}, validateWorkers)
+	var wg sync.WaitGroup
+	for i, addr := range list {
+		p, err := pool.ParseCandidate(addr)
+		if err != nil {
+			results[i] = pool.CheckResult{Proxy: addr, Error: err.Error()}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = pool.Check(p)
+		}()
+	}
+	wg.Wait()
+	admin.WriteJSON(w, http.StatusOK, results)
+}
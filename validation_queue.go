@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/e2u/dynamic-proxy/internal/config"
+	"github.com/e2u/dynamic-proxy/pkg/logger"
+	"github.com/e2u/dynamic-proxy/pkg/pool"
+)
+
+// validationCfg 驗證配置（取自配置 validation，用於隊列速率與並發）
+var validationCfg config.ValidationConfig
+
+const (
+	// queueBatch 每次從隊列讀取的代理數
+	queueBatch = 100
+	// queueIdleWait 隊列為空時再次檢查前的等待時間
+	queueIdleWait = 10 * time.Second
+)
+
+// startValidationQueue 在後台持續消費待驗證隊列，關閉 stop 後等待進行中的驗證結束，返回的通道隨之關閉
+func startValidationQueue(stop <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		validatorLog.Infof("Validation queue started (%.2g/s, %d workers)", validationCfg.QueueRate, validationCfg.QueueWorkers)
+		for {
+			n, err := drainValidationQueue(stop, validationCfg.QueueRate)
+			if err != nil {
+				validatorLog.Errorf("validation queue error: %v", err)
+			}
+			if n > 0 {
+				validatorLog.Infof("Validation queue drained: %d proxies validated", n)
+				reportPoolHealth()
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(queueIdleWait):
+			}
+		}
+	}()
+	return done
+}
+
+// drainValidationQueue 驗證隊列中的代理直到隊列為空或 stop 關閉，
+// rate > 0 時每秒最多開始 rate 個驗證；返回已驗證的代理數
+func drainValidationQueue(stop <-chan struct{}, rate float64) (total int, err error) {
+	var limit <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		limit = ticker.C
+	}
+	sem := make(chan struct{}, max(validationCfg.QueueWorkers, 1))
+	var wg sync.WaitGroup
+	var finish func(error)
+	defer func() {
+		wg.Wait()
+		if finish != nil {
+			finish(err)
+		}
+	}()
+
+	for {
+		var keys []string
+		keys, err = pool.QueuedKeys(bdb, queueBatch)
+		if err != nil || len(keys) == 0 {
+			return total, err
+		}
+		// 隊列非空時才記錄為一次任務運行
+		if finish == nil {
+			finish = jobs.Start(jobValidation)
+		}
+		for _, key := range keys {
+			if limit != nil {
+				select {
+				case <-stop:
+					return total, nil
+				case <-limit:
+				}
+			}
+			select {
+			case <-stop:
+				return total, nil
+			case sem <- struct{}{}:
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				validateQueued(key)
+			}()
+			total++
+		}
+		// 本批驗證完成（已移出隊列）後再讀取下一批，避免同一代理被重複驗證
+		wg.Wait()
+		saveSourceStats()
+	}
+}
+
+// validateQueued 驗證隊列中的一個代理，保存結果並移出隊列
+func validateQueued(key string) {
+	var p *pool.Proxy
+	err := bdb.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			p, err = pool.LoadFromJSON(val)
+			return err
+		})
+	})
+	if err != nil {
+		// 代理已被刪除或記錄損壞（由清理任務刪除），不再驗證
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			validatorLog.Warnf("failed to load queued proxy %s: %v", key, err)
+		}
+		if err := bdb.Update(func(txn *badger.Txn) error { return pool.Dequeue(txn, key) }); err != nil {
+			validatorLog.Errorf("failed to dequeue proxy %s: %v", key, err)
+		}
+		return
+	}
+
+	firstValidation := p.Updated.IsZero()
+	r := pool.Validate(p)
+	saved, err := validationWrites().save(r)
+	if errors.Is(err, pool.ErrProxyNotFound) {
+		validatorLog.WithField("proxy", key).Debug("proxy deleted during validation, result discarded")
+		return
+	}
+	if err != nil {
+		validatorLog.Errorf("failed to save validation result for %s: %v", key, err)
+		return
+	}
+	if !r.Healthy {
+		validatorLog.WithField("proxy", saved.String()).Debug("proxy is unhealthy")
+		return
+	}
+	validatorLog.WithFields(logger.Fields{"proxy": saved.String(), "source": saved.Source}).Info("proxy is healthy")
+	if firstValidation {
+		sourceStats.RecordValidated(saved.Source)
+	}
+}
+
+// validationWrites 驗證結果的唯一寫入方（首次使用時啟動，隨進程退出）
+var validationWrites = sync.OnceValue(startValidationWriter)
+
+// validationWriter 把並發驗證產生的結果依次應用到數據庫：驗證 goroutine 只讀取各自載入的代理記錄，
+// 不修改共享的 Proxy，驗證結果之間也不會因並發事務衝突（badger.ErrConflict）丟失寫入（與其他寫入的衝突由 ApplyValidation 重試）
+type validationWriter struct {
+	requests chan validationWrite
+}
+
+// validationWrite 一個待寫入的驗證結果，寫入完成後經 reply 返回更新後的記錄
+type validationWrite struct {
+	result pool.ValidationResult
+	reply  chan<- validationSaved
+}
+
+type validationSaved struct {
+	proxy *pool.Proxy
+	err   error
+}
+
+func startValidationWriter() *validationWriter {
+	w := &validationWriter{requests: make(chan validationWrite)}
+	go func() {
+		for req := range w.requests {
+			p, err := proxyStore.ApplyValidation(req.result)
+			req.reply <- validationSaved{proxy: p, err: err}
+		}
+	}()
+	return w
+}
+
+// save 提交驗證結果並等待寫入完成，返回更新後的代理記錄；代理在驗證期間被刪除時返回 pool.ErrProxyNotFound
+func (w *validationWriter) save(r pool.ValidationResult) (*pool.Proxy, error) {
+	reply := make(chan validationSaved, 1)
+	w.requests <- validationWrite{result: r, reply: reply}
+	s := <-reply
+	return s.proxy, s.err
+}